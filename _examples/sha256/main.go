@@ -12,9 +12,6 @@ import (
 	"github.com/go-git/go-git/v6/plumbing/object"
 )
 
-// This example requires building with the sha256 tag for it to work:
-// go run -tags sha256 main.go /tmp/repository
-
 // Basic example of how to initialise a repository using sha256 as the hashing algorithm.
 func main() {
 	CheckArgs("<directory>")
@@ -0,0 +1,377 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// DefaultAddr is the default address the daemon listens on.
+const DefaultAddr = ":9418"
+
+// exportOkFile is the file marking a repository as exported, unless
+// Daemon.ExportAll is set.
+const exportOkFile = "git-daemon-export-ok"
+
+var (
+	// ErrNotExported is returned when a repository is not exported by the
+	// daemon.
+	ErrNotExported = errors.New("repository not exported")
+	// ErrInvalidPath is returned when the path of a request is not allowed.
+	ErrInvalidPath = errors.New("invalid repository path")
+)
+
+// Daemon is a server for the git protocol, like git-daemon. It accepts
+// connections, reads their git protocol request and serves them using a
+// Backend.
+type Daemon struct {
+	// Backend serves the requests. It uses [NewBackend] with the
+	// [transport.DefaultLoader] when nil.
+	Backend *Backend
+	// BasePath is prepended to the paths requested, like --base-path. When
+	// set, only absolute paths are allowed.
+	BasePath string
+	// ExportAll serves all the repositories, like --export-all. Otherwise,
+	// only the repositories with a git-daemon-export-ok file are served.
+	ExportAll bool
+	// InterpolatedPath is the path template used for virtual hosting, like
+	// --interpolated-path. It's used instead of BasePath when the client
+	// sends the host it connected to, expanding the following sequences:
+	//   - %H and %CH, the host name requested by the client, lower cased.
+	//   - %IP, the IP address of the server.
+	//   - %P, the port requested by the client, or the one of the server.
+	//   - %D, the absolute path requested.
+	//   - %%, a literal %.
+	// The requests with a host that isn't a host name or an IP address, or
+	// expanding to a path outside of the directory preceding the first
+	// sequence, are refused.
+	InterpolatedPath string
+	// MaxConnections is the maximum number of connections served at the
+	// same time, like --max-connections. Further connections wait until one
+	// of them is closed. Zero means no limit.
+	MaxConnections int
+	// InitTimeout is the time to wait for the request of a client, like
+	// --init-timeout. Zero means no timeout.
+	InitTimeout time.Duration
+	// IdleTimeout is the time to wait for the client to send or accept data
+	// once the request is read, like --timeout. Zero means no timeout.
+	IdleTimeout time.Duration
+	// Timeout is the maximum duration of a connection. Zero means no
+	// timeout.
+	Timeout time.Duration
+	// ErrorLog is the logger used to log errors. If nil, no errors are
+	// logged.
+	ErrorLog *log.Logger
+}
+
+// ListenAndServe listens on the TCP network address addr, or DefaultAddr if
+// empty, and then calls Serve.
+func (d *Daemon) ListenAndServe(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	var lc net.ListenConfig
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return d.Serve(ctx, l)
+}
+
+// Serve accepts connections on the listener l, serving each of them in a new
+// goroutine. Once ctx is done, the listener is closed and Serve returns nil
+// after all the active connections are closed. The connections are not
+// interrupted, but IdleTimeout and Timeout still apply to them.
+func (d *Daemon) Serve(ctx context.Context, l net.Listener) error {
+	var b Backend
+	if d.Backend != nil {
+		b = *d.Backend
+	} else {
+		b = *NewBackend(nil)
+	}
+
+	loader := b.Loader
+	if loader == nil {
+		loader = transport.DefaultLoader
+	}
+
+	b.Loader = &daemonLoader{loader: loader, exportAll: d.ExportAll}
+
+	var sem chan struct{}
+	if d.MaxConnections > 0 {
+		sem = make(chan struct{}, d.MaxConnections)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() {
+		l.Close() //nolint:errcheck
+	})
+	defer stop()
+
+	connCtx := context.WithoutCancel(ctx)
+	for {
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sem != nil {
+				defer func() { <-sem }()
+			}
+
+			d.serveConn(connCtx, &b, conn)
+		}()
+	}
+}
+
+func (d *Daemon) serveConn(ctx context.Context, b *Backend, conn net.Conn) {
+	c := &timeoutConn{Conn: conn, idle: d.IdleTimeout}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+
+		c.deadline, _ = ctx.Deadline()
+	}
+
+	if d.InitTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.InitTimeout)) //nolint:errcheck
+	}
+
+	var req packp.GitProtoRequest
+	if err := req.Decode(conn); err != nil {
+		logf(d.ErrorLog, "error reading request from %s: %v", conn.RemoteAddr(), err)
+		conn.Close() //nolint:errcheck
+		return
+	}
+
+	pathname, err := d.resolvePath(conn, &req)
+	if err != nil {
+		logf(d.ErrorLog, "error serving %q from %s: %v", req.Pathname, conn.RemoteAddr(), err)
+		renderError(c, err) //nolint:errcheck
+		return
+	}
+
+	req.Pathname = pathname
+	c.touch()
+	b.ServeTCP(ctx, c, &req)
+}
+
+// resolvePath returns the path of the repository requested, applying the
+// base path or the interpolated path.
+func (d *Daemon) resolvePath(conn net.Conn, req *packp.GitProtoRequest) (string, error) {
+	dir := req.Pathname
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPath, dir)
+		}
+	}
+
+	if d.InterpolatedPath != "" && req.Host != "" {
+		if !strings.HasPrefix(dir, "/") {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPath, dir)
+		}
+
+		return d.interpolatePath(conn, req.Host, dir)
+	}
+
+	if d.BasePath != "" {
+		if !strings.HasPrefix(dir, "/") {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPath, dir)
+		}
+
+		return path.Join(d.BasePath, dir), nil
+	}
+
+	return dir, nil
+}
+
+// interpolatePath expands the interpolated path for the host hostport and
+// the path dir. Like the sanitize_client of git-daemon, it refuses the hosts
+// which aren't a host name or an IP address, and the paths outside of the
+// root of the interpolated path.
+func (d *Daemon) interpolatePath(conn net.Conn, hostport, dir string) (string, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+
+	host = strings.ToLower(host)
+	if !validHost(host) {
+		return "", fmt.Errorf("%w: host %q", ErrInvalidPath, hostport)
+	}
+
+	var ip string
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		ip = addr.IP.String()
+		if port == "" {
+			port = fmt.Sprint(addr.Port)
+		}
+	}
+
+	for _, c := range port {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("%w: host %q", ErrInvalidPath, hostport)
+		}
+	}
+
+	r := strings.NewReplacer(
+		"%%", "%",
+		"%CH", host,
+		"%H", host,
+		"%IP", ip,
+		"%P", port,
+		"%D", dir,
+	)
+
+	pathname := path.Clean(r.Replace(d.InterpolatedPath))
+	if !isUnder(interpolationRoot(d.InterpolatedPath), pathname) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPath, pathname)
+	}
+
+	return pathname, nil
+}
+
+// validHost returns whether host, lower cased, is a host name or an IP
+// address that is safe to use as a path element.
+func validHost(host string) bool {
+	if host == "" || host[0] == '.' || strings.Contains(host, "..") {
+		return false
+	}
+
+	if net.ParseIP(host) != nil {
+		return true
+	}
+
+	for _, c := range host {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// interpolationRoot returns the directory of the interpolated path template
+// preceding its first sequence.
+func interpolationRoot(template string) string {
+	if i := strings.IndexByte(template, '%'); i >= 0 {
+		return path.Dir(template[:i])
+	}
+
+	return path.Clean(template)
+}
+
+// isUnder returns whether the clean path p is root or one of its
+// descendants.
+func isUnder(root, p string) bool {
+	switch {
+	case root == p:
+		return true
+	case root == "/":
+		return strings.HasPrefix(p, "/")
+	case root == ".":
+		return p != ".." && !strings.HasPrefix(p, "../") && !strings.HasPrefix(p, "/")
+	}
+
+	return strings.HasPrefix(p, root+"/")
+}
+
+// daemonLoader loads the repositories exported by the daemon.
+type daemonLoader struct {
+	loader    transport.Loader
+	exportAll bool
+}
+
+// Load implements transport.Loader.
+func (l *daemonLoader) Load(ep *transport.Endpoint) (storage.Storer, error) {
+	st, err := l.loader.Load(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.exportAll {
+		return st, nil
+	}
+
+	fss, ok := st.(storer.FilesystemStorer)
+	if !ok {
+		return nil, ErrNotExported
+	}
+
+	if _, err := fss.Filesystem().Stat(exportOkFile); err != nil {
+		return nil, ErrNotExported
+	}
+
+	return st, nil
+}
+
+// timeoutConn is a net.Conn extending its deadline on each read and write,
+// up to an optional overall deadline.
+type timeoutConn struct {
+	net.Conn
+	idle     time.Duration
+	deadline time.Time
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	c.touch()
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	c.touch()
+	return c.Conn.Write(p)
+}
+
+// touch sets the deadline of the connection.
+func (c *timeoutConn) touch() {
+	deadline := c.deadline
+	if c.idle > 0 {
+		idle := time.Now().Add(c.idle)
+		if deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+
+	c.Conn.SetDeadline(deadline) //nolint:errcheck
+}
+
+// logf logs the given message to the error log if it is set.
+func logf(logger *log.Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,266 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	gittransport "github.com/go-git/go-git/v6/plumbing/transport/git"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// startDaemon serves d on a new listener, returning its port. The daemon is
+// stopped on cleanup.
+func startDaemon(t testing.TB, d *Daemon) int {
+	t.Helper()
+
+	l := test.ListenTCP(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Serve(ctx, l)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newEndpoint(t testing.TB, host string, port int, path string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("git://%s:%d/%s", host, port, path))
+	require.NoError(t, err)
+	return ep
+}
+
+// handshake connects to the repository at ep using git-upload-pack.
+func handshake(t testing.TB, ep *transport.Endpoint) error {
+	sess, err := gittransport.DefaultClient.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+
+	conn, err := sess.Handshake(context.Background(), transport.UploadPackService)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+type DaemonUploadPackSuite struct {
+	test.UploadPackSuite
+}
+
+func TestDaemonUploadPackSuite(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+	suite.Run(t, new(DaemonUploadPackSuite))
+}
+
+func (s *DaemonUploadPackSuite) SetupTest() {
+	base := filepath.Join(s.T().TempDir(), "go-git-daemon")
+	port := startDaemon(s.T(), &Daemon{BasePath: base, ExportAll: true})
+
+	basic := test.PrepareRepository(s.T(), fixtures.Basic().One(), base, "basic.git")
+	empty := test.PrepareRepository(s.T(), fixtures.ByTag("empty").One(), base, "empty.git")
+
+	s.Client = gittransport.DefaultClient
+	s.Endpoint = newEndpoint(s.T(), "localhost", port, "basic.git")
+	s.Storer = filesystem.NewStorage(basic, nil)
+	s.EmptyEndpoint = newEndpoint(s.T(), "localhost", port, "empty.git")
+	s.EmptyStorer = filesystem.NewStorage(empty, nil)
+	s.NonExistentEndpoint = newEndpoint(s.T(), "localhost", port, "non-existent.git")
+	s.NonExistentStorer = memory.NewStorage()
+}
+
+func TestDaemonExportOk(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+
+	base := filepath.Join(t.TempDir(), "go-git-daemon")
+	fs := test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	port := startDaemon(t, &Daemon{BasePath: base})
+	ep := newEndpoint(t, "localhost", port, "basic.git")
+
+	err := handshake(t, ep)
+	require.ErrorContains(t, err, ErrNotExported.Error())
+
+	f, err := fs.Create(exportOkFile)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, handshake(t, ep))
+}
+
+func TestDaemonInterpolatedPath(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+
+	base := t.TempDir()
+	test.PrepareRepository(t, fixtures.Basic().One(), filepath.Join(base, "localhost"), "basic.git")
+	port := startDaemon(t, &Daemon{
+		BasePath:         filepath.Join(base, "unused"),
+		InterpolatedPath: filepath.ToSlash(base) + "/%H%D",
+		ExportAll:        true,
+	})
+
+	require.NoError(t, handshake(t, newEndpoint(t, "LocalHost", port, "basic.git")))
+
+	err := handshake(t, newEndpoint(t, "127.0.0.1", port, "basic.git"))
+	require.ErrorContains(t, err, transport.ErrRepositoryNotFound.Error())
+
+	// A malicious host can't escape the interpolated path.
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &packp.GitProtoRequest{
+		RequestCommand: transport.UploadPackService.String(),
+		Pathname:       "/basic.git",
+		Host:           "../" + filepath.Base(base) + "/localhost",
+	}
+	require.NoError(t, req.Encode(conn))
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Contains(t, string(resp), ErrInvalidPath.Error())
+}
+
+func TestDaemonResolvePath(t *testing.T) {
+	l := test.ListenTCP(t)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tests := []struct {
+		d        Daemon
+		host     string
+		pathname string
+		want     string
+		err      error
+	}{
+		{Daemon{}, "", "/repo.git", "/repo.git", nil},
+		{Daemon{}, "", "/foo/../repo.git", "", ErrInvalidPath},
+		{Daemon{BasePath: "/srv/git"}, "", "/repo.git", "/srv/git/repo.git", nil},
+		{Daemon{BasePath: "/srv/git"}, "", "repo.git", "", ErrInvalidPath},
+		{Daemon{BasePath: "/srv/git", InterpolatedPath: "/srv/%H/%P%D"}, "", "/repo.git", "/srv/git/repo.git", nil},
+		{Daemon{InterpolatedPath: "/srv/%H/%P%D"}, "Example.com:1234", "/repo.git", "/srv/example.com/1234/repo.git", nil},
+		{Daemon{InterpolatedPath: "/srv/%CH/%IP/100%%/%D"}, "example.com", "/repo.git", "/srv/example.com/127.0.0.1/100%/repo.git", nil},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, "[::1]:1234", "/repo.git", "/srv/::1/repo.git", nil},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, "../../etc", "/passwd", "", ErrInvalidPath},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, "..:1234", "/repo.git", "", ErrInvalidPath},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, ".hidden", "/repo.git", "", ErrInvalidPath},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, "foo\\bar", "/repo.git", "", ErrInvalidPath},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, "foo/bar", "/repo.git", "", ErrInvalidPath},
+		{Daemon{InterpolatedPath: "/srv/%H%D"}, "example.com:../x", "/repo.git", "", ErrInvalidPath},
+		{Daemon{InterpolatedPath: "/srv/repo-%H%D"}, "example.com", "/repo.git", "/srv/repo-example.com/repo.git", nil},
+		{Daemon{InterpolatedPath: "/srv/%P/%D"}, "example.com:1234", "/", "/srv/1234", nil},
+	}
+
+	for _, tc := range tests {
+		req := &packp.GitProtoRequest{Host: tc.host, Pathname: tc.pathname}
+		got, err := tc.d.resolvePath(conn, req)
+		if tc.err != nil {
+			require.ErrorIs(t, err, tc.err, tc.pathname)
+			continue
+		}
+
+		require.NoError(t, err, tc.pathname)
+		require.Equal(t, tc.want, got, tc.pathname)
+	}
+}
+
+func TestDaemonTimeouts(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+
+	base := filepath.Join(t.TempDir(), "go-git-daemon")
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	port := startDaemon(t, &Daemon{
+		BasePath:    base,
+		ExportAll:   true,
+		InitTimeout: 100 * time.Millisecond,
+		IdleTimeout: 100 * time.Millisecond,
+	})
+
+	addr := fmt.Sprintf("localhost:%d", port)
+
+	// No request is sent, the connection is closed once InitTimeout expires.
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+
+	// The advertised references are read, but no request follows, so the
+	// connection fails and is closed once IdleTimeout expires.
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &packp.GitProtoRequest{
+		RequestCommand: transport.UploadPackService.String(),
+		Pathname:       "/basic.git",
+		Host:           addr,
+	}
+	require.NoError(t, req.Encode(conn))
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "refs/heads/master")
+	require.Contains(t, string(data), "i/o timeout")
+}
+
+func TestDaemonShutdown(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+
+	l := test.ListenTCP(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Daemon{ExportAll: true}).Serve(ctx, l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+
+	// Give the daemon time to accept the connection before shutting down.
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("Serve returned with an active connection")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, conn.Close())
+	require.NoError(t, <-done)
+
+	_, err = net.Dial("tcp", l.Addr().String())
+	require.Error(t, err)
+}
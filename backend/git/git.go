@@ -27,7 +27,7 @@ type Backend struct {
 	ReceivePack bool
 	// ArchivePack indicates whether the handler should handle
 	// git-upload-archive requests.
-	// ArchivePack bool // TODO: Implement git-upload-archive support
+	ArchivePack bool
 }
 
 // NewBackend creates a new [Backend] for the given loader. It defaults to
@@ -38,14 +38,12 @@ func NewBackend(loader transport.Loader) *Backend {
 		Loader:      loader,
 		UploadPack:  true,
 		ReceivePack: false,
-		// ArchivePack: true, // TODO: Implement git-upload-archive support
+		ArchivePack: true,
 	}
 }
 
-// ServeTCP implements the [Handler] interface for the [Backend].
-// TODO: Support idle timeout based on the context. Something like
-// context.WithIdleTimeout where it resets the timer on each read/write
-// operation.
+// ServeTCP implements the [Handler] interface for the [Backend]. It doesn't
+// apply any timeout on the connection, see [Daemon] for a complete server.
 func (b *Backend) ServeTCP(ctx context.Context, c io.ReadWriteCloser, req *packp.GitProtoRequest) {
 	loader := b.Loader
 	if loader == nil {
@@ -61,8 +59,8 @@ func (b *Backend) ServeTCP(ctx context.Context, c io.ReadWriteCloser, req *packp
 	svc := transport.Service(req.RequestCommand)
 	switch {
 	case svc == transport.UploadPackService && b.UploadPack,
-		svc == transport.ReceivePackService && b.ReceivePack:
-		// TODO: Support git-upload-archive
+		svc == transport.ReceivePackService && b.ReceivePack,
+		svc == transport.UploadArchiveService && b.ArchivePack:
 	default:
 		renderError(wc, transport.ErrUnsupportedService) //nolint:errcheck
 		return
@@ -105,6 +103,10 @@ func (b *Backend) ServeTCP(ctx context.Context, c io.ReadWriteCloser, req *packp
 			&transport.ReceivePackOptions{
 				GitProtocol: version,
 			})
+	case transport.UploadArchiveService:
+		err = transport.UploadArchive(ctx, st,
+			io.NopCloser(r), ioutil.WriteNopCloser(wc),
+			&transport.UploadArchiveOptions{})
 	}
 
 	if err != nil {
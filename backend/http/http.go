@@ -39,8 +39,7 @@ var services = []service{
 	{regexp.MustCompile("(.*?)/objects/pack/pack-[0-9a-f]{40}\\.idx$"), http.MethodGet, getIdxFile, ""},
 	{regexp.MustCompile("(.*?)/objects/pack/pack-[0-9a-f]{64}\\.idx$"), http.MethodGet, getIdxFile, ""},
 
-	// TODO: Support git-upload-archive
-	// {regexp.MustCompile("(.*?)/git-upload-archive$"), http.MethodPost, serviceRpc, transport.UploadArchiveService},
+	{regexp.MustCompile("(.*?)/git-upload-archive$"), http.MethodPost, serviceRpc, transport.UploadArchiveService},
 	{regexp.MustCompile("(.*?)/git-upload-pack$"), http.MethodPost, serviceRpc, transport.UploadPackService},
 	{regexp.MustCompile("(.*?)/git-receive-pack$"), http.MethodPost, serviceRpc, transport.ReceivePackService},
 }
@@ -189,8 +188,10 @@ func serviceRpc(w http.ResponseWriter, r *http.Request) {
 				AdvertiseRefs: false,
 				StatelessRPC:  true,
 			})
+	case transport.UploadArchiveService:
+		err = transport.UploadArchive(ctx, st, reader, frw,
+			&transport.UploadArchiveOptions{})
 	default:
-		// TODO: Support git-upload-archive
 		logf(errorLog, "unknown service: %s", svc.Name())
 		renderStatusError(w, http.StatusNotFound)
 		return
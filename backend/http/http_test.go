@@ -1,6 +1,8 @@
 package http
 
 import (
+	"archive/tar"
+	"context"
 	"io"
 	"net/http/httptest"
 	"testing"
@@ -8,6 +10,7 @@ import (
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/stretchr/testify/require"
@@ -45,7 +48,7 @@ e8d3ffab552895c19b9fcf7aa264d277cde33881	refs/remotes/origin/branch
 6ecf0ef2c2dffb796033e5a02219af86ec6584e5	refs/remotes/origin/master
 `
 	expectedSmart := `001e# service=git-upload-pack
-000000b46ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD` + "\x00" + `agent=` + capability.DefaultAgent() + ` ofs-delta side-band-64k multi_ack multi_ack_detailed side-band no-progress shallow symref=HEAD:refs/heads/master
+000000c06ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD` + "\x00" + `agent=` + capability.DefaultAgent() + ` ofs-delta side-band-64k multi_ack multi_ack_detailed side-band no-progress shallow include-tag symref=HEAD:refs/heads/master
 003fe8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/branch
 003f6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master
 00466ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/remotes/origin/HEAD
@@ -83,3 +86,39 @@ func TestDumbInfoRefs(t *testing.T) {
 func TestSmartInfoRefs(t *testing.T) {
 	testInfoRefs(t, true)
 }
+
+func TestUploadArchive(t *testing.T) {
+	s := httptest.NewServer(NewBackend(&fixturesLoader{t}))
+	defer s.Close()
+
+	ep, err := transport.NewEndpoint(s.URL + "/basic.git")
+	require.NoError(t, err)
+
+	sess, err := githttp.DefaultTransport.NewSession(nil, ep, nil)
+	require.NoError(t, err)
+
+	archiver, ok := sess.(transport.Archiver)
+	require.True(t, ok)
+
+	rc, err := archiver.Archive(context.TODO(), &transport.ArchiveRequest{
+		Treeish: "master",
+		Paths:   []string{"go"},
+	})
+	require.NoError(t, err)
+	defer rc.Close() //nolint:errcheck
+
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag != tar.TypeXGlobalHeader {
+			names = append(names, hdr.Name)
+		}
+	}
+
+	require.Equal(t, []string{"go/", "go/example.go"}, names)
+}
@@ -0,0 +1,183 @@
+// Package ssh implements a server handler serving git repositories over SSH,
+// to be used with [github.com/gliderlabs/ssh] servers.
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// Permission is the access a user has to a repository.
+type Permission int
+
+const (
+	// NoAccess denies any access to the repository. The repository is
+	// reported as not found, so its existence is not disclosed.
+	NoAccess Permission = iota
+	// ReadAccess allows fetching from the repository, using the
+	// git-upload-pack and git-upload-archive commands.
+	ReadAccess
+	// WriteAccess allows pushing to the repository, using the
+	// git-receive-pack command, in addition to ReadAccess.
+	WriteAccess
+)
+
+// AuthorizeFunc returns the permission of the user of an SSH session on the
+// repository at ep. key is the public key the user authenticated with, or nil
+// if another authentication method was used. The user name and the remote
+// address are available in ctx.
+type AuthorizeFunc func(ctx ssh.Context, key ssh.PublicKey, ep *transport.Endpoint) (Permission, error)
+
+// Backend represents a Git SSH handler that can handle git-upload-pack,
+// git-receive-pack, and git-upload-archive exec requests.
+//
+// Users are authenticated by the [ssh.Server], e.g. using
+// [ssh.PublicKeyAuth], while the Backend authorizes them using Authorize.
+type Backend struct {
+	// Loader is used to load repositories. It uses [transport.DefaultLoader]
+	// when nil. The endpoints of the repositories are in the form
+	// ssh://localhost/<path>, where path is the one given in the command.
+	Loader transport.Loader
+	// Authorize returns the permission of the users on the repositories. When
+	// nil, all the users have ReadAccess to all the repositories.
+	Authorize AuthorizeFunc
+	// ErrorLog is the logger used to log errors. If nil, no errors are logged.
+	ErrorLog *log.Logger
+}
+
+// NewBackend creates a new [Backend] for the given loader. Unless Authorize
+// is set, repositories are served read-only.
+func NewBackend(loader transport.Loader) *Backend {
+	return &Backend{
+		Loader: loader,
+	}
+}
+
+// ServeSSH handles the command executed in the given SSH session. It can be
+// used as the [ssh.Handler] of a server.
+func (b *Backend) ServeSSH(s ssh.Session) {
+	if err := b.serve(s); err != nil {
+		logf(b.ErrorLog, "error serving %q: %v", s.RawCommand(), err)
+		renderError(s, err) //nolint:errcheck
+		s.Exit(1)           //nolint:errcheck
+		return
+	}
+
+	s.Exit(0) //nolint:errcheck
+}
+
+func (b *Backend) serve(s ssh.Session) error {
+	svc, repo, err := parseCommand(s.Command())
+	if err != nil {
+		return err
+	}
+
+	ep := &transport.Endpoint{
+		Protocol: "ssh",
+		Host:     "localhost",
+		Path:     repo,
+	}
+
+	perm := ReadAccess
+	if b.Authorize != nil {
+		perm, err = b.Authorize(s.Context(), s.PublicKey(), ep)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case perm <= NoAccess:
+		return transport.ErrRepositoryNotFound
+	case svc == transport.ReceivePackService && perm < WriteAccess:
+		return transport.ErrAuthorizationFailed
+	}
+
+	loader := b.Loader
+	if loader == nil {
+		loader = transport.DefaultLoader
+	}
+
+	st, err := loader.Load(ep)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.Context()
+	r := io.NopCloser(s)
+	w := ioutil.WriteNopCloser(s)
+	version := gitProtocol(s.Environ())
+	switch svc {
+	case transport.UploadPackService:
+		return transport.UploadPack(ctx, st, r, w, &transport.UploadPackOptions{
+			GitProtocol: version,
+		})
+	case transport.ReceivePackService:
+		return transport.ReceivePack(ctx, st, r, w, &transport.ReceivePackOptions{
+			GitProtocol: version,
+		})
+	default:
+		return transport.UploadArchive(ctx, st, r, w, &transport.UploadArchiveOptions{})
+	}
+}
+
+// parseCommand returns the service and the repository path of an exec
+// request, like git-upload-pack '/repo.git' or git upload-pack 'repo.git'.
+// Relative paths are resolved from the root of the loader.
+func parseCommand(args []string) (transport.Service, string, error) {
+	if len(args) == 3 && args[0] == "git" {
+		args = []string{"git-" + args[1], args[2]}
+	}
+
+	if len(args) != 2 {
+		return "", "", fmt.Errorf("%w: invalid command", transport.ErrUnsupportedService)
+	}
+
+	svc := transport.Service(args[0])
+	switch svc {
+	case transport.UploadPackService,
+		transport.ReceivePackService,
+		transport.UploadArchiveService:
+	default:
+		return "", "", fmt.Errorf("%w: %s", transport.ErrUnsupportedService, args[0])
+	}
+
+	repo := strings.TrimPrefix(args[1], "~/")
+	if repo == "" {
+		return "", "", transport.ErrRepositoryNotFound
+	}
+
+	return svc, path.Join("/", repo), nil
+}
+
+// gitProtocol returns the value of the GIT_PROTOCOL environment variable
+// sent by the client, used to request protocol v2.
+func gitProtocol(env []string) string {
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "GIT_PROTOCOL="); ok {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// logf logs the given message to the error log if it is set.
+func logf(logger *log.Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, v...)
+	}
+}
+
+func renderError(w io.Writer, err error) error {
+	_, err = pktline.WriteError(w, err)
+	return err
+}
@@ -0,0 +1,217 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gliderlabs/ssh"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v6/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	stdssh "golang.org/x/crypto/ssh"
+)
+
+// permissions are the permissions of the test users on all repositories.
+var permissions = map[string]Permission{
+	"git":    WriteAccess,
+	"reader": ReadAccess,
+}
+
+func authorize(ctx ssh.Context, _ ssh.PublicKey, _ *transport.Endpoint) (Permission, error) {
+	return permissions[ctx.User()], nil
+}
+
+func startServer(t testing.TB, b *Backend) int {
+	t.Helper()
+
+	l := test.ListenTCP(t)
+	server := &ssh.Server{
+		Handler: b.ServeSSH,
+		PasswordHandler: func(ssh.Context, string) bool {
+			return true
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.ErrorIs(t, server.Serve(l), net.ErrClosed)
+	}()
+
+	t.Cleanup(func() {
+		require.NoError(t, l.Close())
+		<-done
+	})
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+var client = gitssh.NewTransport(nil)
+
+// testAuth authenticates with an empty password, accepting any host key. It
+// sets the host key algorithms, so no known_hosts file is needed.
+type testAuth struct {
+	user string
+}
+
+func newAuth(user string) transport.AuthMethod {
+	return &testAuth{user: user}
+}
+
+func (a *testAuth) Name() string {
+	return gitssh.PasswordName
+}
+
+func (a *testAuth) String() string {
+	return fmt.Sprintf("user: %s, name: %s", a.user, a.Name())
+}
+
+func (a *testAuth) ClientConfig() (*stdssh.ClientConfig, error) {
+	return &stdssh.ClientConfig{
+		User:              a.user,
+		Auth:              []stdssh.AuthMethod{stdssh.Password("")},
+		HostKeyCallback:   stdssh.InsecureIgnoreHostKey(),
+		HostKeyAlgorithms: []string{stdssh.KeyAlgoED25519, stdssh.KeyAlgoRSASHA256, stdssh.KeyAlgoRSA},
+	}, nil
+}
+
+func newEndpoint(t testing.TB, port int, path string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf(
+		"ssh://git@localhost:%d/%s", port, filepath.ToSlash(path),
+	))
+	require.NoError(t, err)
+	return ep
+}
+
+type UploadPackSuite struct {
+	test.UploadPackSuite
+}
+
+func TestUploadPackSuite(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+	suite.Run(t, new(UploadPackSuite))
+}
+
+func (s *UploadPackSuite) SetupTest() {
+	base := filepath.Join(s.T().TempDir(), "go-git-ssh")
+	port := startServer(s.T(), NewBackend(nil))
+
+	basic := test.PrepareRepository(s.T(), fixtures.Basic().One(), base, "basic.git")
+	empty := test.PrepareRepository(s.T(), fixtures.ByTag("empty").One(), base, "empty.git")
+
+	s.Client = client
+	s.EmptyAuth = newAuth("git")
+	s.Endpoint = newEndpoint(s.T(), port, basic.Root())
+	s.Storer = filesystem.NewStorage(basic, cache.NewObjectLRUDefault())
+	s.EmptyEndpoint = newEndpoint(s.T(), port, empty.Root())
+	s.EmptyStorer = filesystem.NewStorage(empty, cache.NewObjectLRUDefault())
+	s.NonExistentEndpoint = newEndpoint(s.T(), port, filepath.Join(base, "non-existent.git"))
+	s.NonExistentStorer = memory.NewStorage()
+}
+
+type ReceivePackSuite struct {
+	test.ReceivePackSuite
+}
+
+func TestReceivePackSuite(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+	suite.Run(t, new(ReceivePackSuite))
+}
+
+func (s *ReceivePackSuite) SetupTest() {
+	base := filepath.Join(s.T().TempDir(), "go-git-ssh")
+	port := startServer(s.T(), &Backend{Authorize: authorize})
+
+	basic := test.PrepareRepository(s.T(), fixtures.Basic().One(), base, "basic.git")
+	empty := test.PrepareRepository(s.T(), fixtures.ByTag("empty").One(), base, "empty.git")
+
+	s.Client = client
+	s.EmptyAuth = newAuth("git")
+	s.Endpoint = newEndpoint(s.T(), port, basic.Root())
+	s.Storer = filesystem.NewStorage(basic, cache.NewObjectLRUDefault())
+	s.EmptyEndpoint = newEndpoint(s.T(), port, empty.Root())
+	s.EmptyStorer = filesystem.NewStorage(empty, cache.NewObjectLRUDefault())
+	s.NonExistentEndpoint = newEndpoint(s.T(), port, filepath.Join(base, "non-existent.git"))
+	s.NonExistentStorer = memory.NewStorage()
+}
+
+func TestAuthorize(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("tcp connections are not available in wasm")
+	}
+
+	base := filepath.Join(t.TempDir(), "go-git-ssh")
+	basic := test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	port := startServer(t, &Backend{Authorize: authorize})
+	ep := newEndpoint(t, port, basic.Root())
+
+	handshake := func(user string, svc transport.Service) error {
+		sess, err := client.NewSession(memory.NewStorage(), ep, newAuth(user))
+		require.NoError(t, err)
+
+		conn, err := sess.Handshake(context.Background(), svc)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	}
+
+	require.NoError(t, handshake("git", transport.UploadPackService))
+	require.NoError(t, handshake("git", transport.ReceivePackService))
+	require.NoError(t, handshake("reader", transport.UploadPackService))
+
+	err := handshake("reader", transport.ReceivePackService)
+	require.ErrorContains(t, err, transport.ErrAuthorizationFailed.Error())
+
+	err = handshake("unknown", transport.UploadPackService)
+	require.ErrorContains(t, err, transport.ErrRepositoryNotFound.Error())
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		svc  transport.Service
+		path string
+		err  error
+	}{
+		{[]string{"git-upload-pack", "/repo.git"}, transport.UploadPackService, "/repo.git", nil},
+		{[]string{"git-receive-pack", "repo.git"}, transport.ReceivePackService, "/repo.git", nil},
+		{[]string{"git", "upload-archive", "~/foo/repo.git"}, transport.UploadArchiveService, "/foo/repo.git", nil},
+		{[]string{"git-upload-pack", "/foo/../../repo.git"}, transport.UploadPackService, "/repo.git", nil},
+		{[]string{"git-upload-pack", ""}, "", "", transport.ErrRepositoryNotFound},
+		{[]string{"git-upload-pack"}, "", "", transport.ErrUnsupportedService},
+		{[]string{"rm", "-rf"}, "", "", transport.ErrUnsupportedService},
+	}
+
+	for _, tc := range tests {
+		svc, path, err := parseCommand(tc.args)
+		if tc.err != nil {
+			require.ErrorIs(t, err, tc.err, tc.args)
+			continue
+		}
+
+		require.NoError(t, err, tc.args)
+		require.Equal(t, tc.svc, svc, tc.args)
+		require.Equal(t, tc.path, path, tc.args)
+	}
+}
+
+func TestGitProtocol(t *testing.T) {
+	require.Equal(t, "version=2", gitProtocol([]string{"FOO=bar", "GIT_PROTOCOL=version=2"}))
+	require.Equal(t, "", gitProtocol([]string{"FOO=bar"}))
+}
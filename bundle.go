@@ -0,0 +1,241 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+var (
+	// ErrEmptyBundle is returned by CreateBundle when none of the given
+	// revisions is a reference.
+	ErrEmptyBundle = errors.New("refusing to create empty bundle")
+	// ErrBundleObjectFormat is returned by VerifyBundle when the object format
+	// of the bundle doesn't match the one of the repository.
+	ErrBundleObjectFormat = errors.New("bundle object format mismatch")
+)
+
+const bundlePackWindow = 10
+
+// CreateBundle writes to w a bundle with the given revisions, like
+// git-bundle create. Each revision can be:
+//   - a reference name, resolved like ResolveRevision, which is included in
+//     the bundle along with all the objects reachable from it.
+//   - "--all", to include all the references of the repository.
+//   - "^<rev>", to exclude the objects reachable from rev.
+//   - "<rev1>..<rev2>", to include rev2 excluding rev1.
+//
+// Other revisions, like commit ids, add their objects to the bundle but are
+// not listed as references. The commits needed by the bundle but excluded
+// from it are listed as prerequisites.
+func (r *Repository) CreateBundle(w io.Writer, revs []string) error {
+	b := &bundleBuilder{r: r, refs: make(map[plumbing.ReferenceName]struct{})}
+	for _, rev := range revs {
+		if err := b.add(rev); err != nil {
+			return err
+		}
+	}
+
+	if len(b.header.References) == 0 {
+		return ErrEmptyBundle
+	}
+
+	objs, err := revlist.Objects(r.Storer, b.wants, b.excludes)
+	if err != nil {
+		return err
+	}
+
+	if len(b.excludes) > 0 {
+		b.header.Prerequisites, err = bundlePrerequisites(r.Storer, objs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The header must match the object format of the packfile, which is
+	// the one of the storage.
+	b.header.ObjectFormat = storerObjectFormat(r.Storer)
+	if err := bundle.NewEncoder(w).Encode(&b.header); err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, r.Storer, false).Encode(objs, bundlePackWindow)
+	return err
+}
+
+// VerifyBundle reads the header of the bundle from rd and checks that it can
+// be unbundled into the repository, i.e. that the repository has all its
+// prerequisites. The header is returned, listing the references of the
+// bundle, like git-bundle list-heads.
+func (r *Repository) VerifyBundle(rd io.Reader) (*bundle.Header, error) {
+	h := &bundle.Header{}
+	if err := bundle.NewDecoder(rd).Decode(h); err != nil {
+		return nil, err
+	}
+
+	if f := storerObjectFormat(r.Storer); h.ObjectFormat != f {
+		return nil, fmt.Errorf("%w: bundle uses %s, repository uses %s",
+			ErrBundleObjectFormat, h.ObjectFormat, f)
+	}
+
+	if err := bundle.VerifyPrerequisites(r.Storer, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// storerObjectFormat returns the object format of the objects of s, SHA-1
+// when it doesn't implement storer.ObjectFormatStorer.
+func storerObjectFormat(s storer.EncodedObjectStorer) formatcfg.ObjectFormat {
+	if fs, ok := s.(storer.ObjectFormatStorer); ok {
+		return fs.ObjectFormat()
+	}
+
+	return formatcfg.SHA1
+}
+
+type bundleBuilder struct {
+	r        *Repository
+	header   bundle.Header
+	refs     map[plumbing.ReferenceName]struct{}
+	wants    []plumbing.Hash
+	excludes []plumbing.Hash
+}
+
+func (b *bundleBuilder) add(rev string) error {
+	switch {
+	case rev == "--all":
+		return b.addAll()
+	case strings.HasPrefix(rev, "^"):
+		return b.exclude(rev[1:])
+	case strings.Contains(rev, ".."):
+		from, to, _ := strings.Cut(rev, "..")
+		if from == "" {
+			from = plumbing.HEAD.String()
+		}
+		if to == "" {
+			to = plumbing.HEAD.String()
+		}
+
+		if err := b.exclude(from); err != nil {
+			return err
+		}
+
+		return b.include(to)
+	default:
+		return b.include(rev)
+	}
+}
+
+func (b *bundleBuilder) addAll() error {
+	iter, err := b.r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(ref *plumbing.Reference) error {
+		resolved, err := storer.ResolveReference(b.r.Storer, ref.Name())
+		if err != nil {
+			// Skip broken symbolic references.
+			return nil
+		}
+
+		b.addReference(plumbing.NewHashReference(ref.Name(), resolved.Hash()))
+		return nil
+	})
+}
+
+func (b *bundleBuilder) include(rev string) error {
+	// Like git, references keep the name they were given with once expanded,
+	// e.g. HEAD is listed as HEAD.
+	for _, rule := range plumbing.RefRevParseRules {
+		name := plumbing.ReferenceName(fmt.Sprintf(rule, rev))
+		ref, err := storer.ResolveReference(b.r.Storer, name)
+		if err == nil {
+			b.addReference(plumbing.NewHashReference(name, ref.Hash()))
+			return nil
+		}
+	}
+
+	h, err := b.r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return fmt.Errorf("resolving %q: %w", rev, err)
+	}
+
+	b.wants = append(b.wants, *h)
+	return nil
+}
+
+func (b *bundleBuilder) exclude(rev string) error {
+	h, err := b.r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return fmt.Errorf("resolving %q: %w", rev, err)
+	}
+
+	b.excludes = append(b.excludes, *h)
+	return nil
+}
+
+func (b *bundleBuilder) addReference(ref *plumbing.Reference) {
+	if _, ok := b.refs[ref.Name()]; ok {
+		return
+	}
+
+	b.refs[ref.Name()] = struct{}{}
+	b.header.References = append(b.header.References, ref)
+	b.wants = append(b.wants, ref.Hash())
+}
+
+// bundlePrerequisites returns the parents of the commits in objs that are
+// not in objs themselves.
+func bundlePrerequisites(s storer.EncodedObjectStorer, objs []plumbing.Hash) ([]bundle.Prerequisite, error) {
+	included := make(map[plumbing.Hash]struct{}, len(objs))
+	for _, h := range objs {
+		included[h] = struct{}{}
+	}
+
+	seen := make(map[plumbing.Hash]struct{})
+	var prereqs []bundle.Prerequisite
+	for _, h := range objs {
+		commit, err := object.GetCommit(s, h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range commit.ParentHashes {
+			if _, ok := included[p]; ok {
+				continue
+			}
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+
+			prereq := bundle.Prerequisite{Hash: p}
+			if parent, err := object.GetCommit(s, p); err == nil {
+				prereq.Comment, _, _ = strings.Cut(parent.Message, "\n")
+			}
+			prereqs = append(prereqs, prereq)
+		}
+	}
+
+	sort.Slice(prereqs, func(i, j int) bool {
+		return prereqs[i].Hash.Compare(prereqs[j].Hash.Bytes()) < 0
+	})
+
+	return prereqs, nil
+}
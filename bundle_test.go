@@ -0,0 +1,184 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/suite"
+)
+
+type BundleSuite struct {
+	BaseSuite
+}
+
+func TestBundleSuite(t *testing.T) {
+	suite.Run(t, new(BundleSuite))
+}
+
+var (
+	bundleMasterHash = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	bundleOldHash    = plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+)
+
+func (s *BundleSuite) writeBundle(r *Repository, revs ...string) string {
+	path := filepath.Join(s.T().TempDir(), "repo.bundle")
+	f, err := os.Create(path)
+	s.Require().NoError(err)
+	defer f.Close()
+
+	s.Require().NoError(r.CreateBundle(f, revs))
+	return path
+}
+
+func (s *BundleSuite) TestCreateBundleAndClone() {
+	path := s.writeBundle(s.Repository, "HEAD", "master")
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+
+	h, err := s.Repository.VerifyBundle(bytes.NewReader(data))
+	s.Require().NoError(err)
+	s.Equal(bundle.V2, h.Version)
+	s.Empty(h.Prerequisites)
+	s.Equal([]*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.HEAD, bundleMasterHash),
+		plumbing.NewHashReference("refs/heads/master", bundleMasterHash),
+	}, h.References)
+
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: path})
+	s.Require().NoError(err)
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(bundleMasterHash, head.Hash())
+
+	_, err = r.CommitObject(bundleOldHash)
+	s.NoError(err)
+}
+
+func (s *BundleSuite) TestCreateBundleIncremental() {
+	s.Require().NoError(s.Repository.Storer.SetReference(
+		plumbing.NewHashReference("refs/heads/old", bundleOldHash)))
+
+	full := s.writeBundle(s.Repository, "old")
+	incremental := s.writeBundle(s.Repository, "old..master")
+
+	data, err := os.ReadFile(incremental)
+	s.Require().NoError(err)
+	h, err := s.Repository.VerifyBundle(bytes.NewReader(data))
+	s.Require().NoError(err)
+	s.Require().NotEmpty(h.Prerequisites)
+	s.Contains(h.Prerequisites, bundle.Prerequisite{Hash: bundleOldHash, Comment: "some code"})
+	s.Equal([]*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", bundleMasterHash),
+	}, h.References)
+
+	empty, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	_, err = empty.VerifyBundle(bytes.NewReader(data))
+	s.ErrorIs(err, bundle.ErrMissingPrerequisites)
+
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: full, ReferenceName: "refs/heads/old"})
+	s.Require().NoError(err)
+
+	_, err = r.CommitObject(bundleMasterHash)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+
+	remote, err := r.CreateRemote(&config.RemoteConfig{Name: "bundle", URLs: []string{incremental}})
+	s.Require().NoError(err)
+	s.Require().NoError(remote.Fetch(&FetchOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/remotes/bundle/master"},
+	}))
+
+	ref, err := r.Reference("refs/remotes/bundle/master", false)
+	s.Require().NoError(err)
+	s.Equal(bundleMasterHash, ref.Hash())
+
+	_, err = r.CommitObject(bundleMasterHash)
+	s.NoError(err)
+}
+
+func (s *BundleSuite) TestCreateBundleMissingPrerequisites() {
+	path := s.writeBundle(s.Repository, "^"+bundleOldHash.String(), "master")
+
+	_, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: path})
+	s.ErrorIs(err, bundle.ErrMissingPrerequisites)
+}
+
+func (s *BundleSuite) TestCreateBundleEmpty() {
+	err := s.Repository.CreateBundle(&bytes.Buffer{}, []string{bundleMasterHash.String()})
+	s.ErrorIs(err, ErrEmptyBundle)
+
+	err = s.Repository.CreateBundle(&bytes.Buffer{}, []string{"missing"})
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+// configFormatStorer is a storage whose config reports another object format
+// than the one of its objects.
+type configFormatStorer struct {
+	*memory.Storage
+	format formatcfg.ObjectFormat
+}
+
+func (s *configFormatStorer) Config() (*config.Config, error) {
+	cfg, err := s.Storage.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c := *cfg
+	c.Extensions.ObjectFormat = s.format
+	return &c, nil
+}
+
+func (s *BundleSuite) TestCreateBundleStorerObjectFormat() {
+	sto := memory.NewStorage()
+	r, err := Clone(sto, nil, &CloneOptions{URL: s.GetBasicLocalRepositoryURL()})
+	s.Require().NoError(err)
+
+	r.Storer = &configFormatStorer{Storage: sto, format: formatcfg.SHA256}
+	path := s.writeBundle(r, "HEAD", "master")
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+
+	h, err := r.VerifyBundle(bytes.NewReader(data))
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA1, h.ObjectFormat)
+
+	_, err = Clone(memory.NewStorage(), nil, &CloneOptions{URL: path})
+	s.NoError(err)
+}
+
+func (s *BundleSuite) TestCloneBundleSHA256() {
+	origin, err := PlainInit(s.T().TempDir(), false, WithObjectFormat(formatcfg.SHA256))
+	s.Require().NoError(err)
+	wt, err := origin.Worktree()
+	s.Require().NoError(err)
+	head, err := wt.Commit("foo", &CommitOptions{
+		Author:            &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Now()},
+		AllowEmptyCommits: true,
+	})
+	s.Require().NoError(err)
+
+	path := s.writeBundle(origin, "HEAD", "master")
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: path})
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA256, cfg.Extensions.ObjectFormat)
+
+	ref, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(head, ref.Hash())
+}
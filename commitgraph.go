@@ -0,0 +1,242 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcg "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/object/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+const (
+	fetchSection             = "fetch"
+	fetchWriteCommitGraphKey = "writeCommitGraph"
+	// commitGraphSizeMultiple is how many times bigger than the new layer
+	// of a commit-graph chain the top layers must be not to be merged with
+	// it, like the --size-multiple default of git.
+	commitGraphSizeMultiple = 2
+)
+
+// WriteCommitGraphOptions describes how the commit-graph should be written.
+type WriteCommitGraphOptions struct {
+	// Reachable writes the commits reachable from the references, instead
+	// of all the commits of the repository.
+	Reachable bool
+	// Split writes the commits which aren't in the commit-graph yet as a
+	// new layer of a commit-graph chain, instead of rewriting the whole
+	// commit-graph in a single file. Like git, the top layers of the chain
+	// are merged with the new one while they have less than twice its
+	// commits, so the chain stays short.
+	Split bool
+	// Append keeps the commits of the existing commit-graph when it's
+	// rewritten in a single file, even if they aren't written otherwise.
+	// The commits of the layers of a chain are always kept.
+	Append bool
+}
+
+// WriteCommitGraph writes the commit-graph of the repository, used to walk
+// the commits without decoding them, with their generation numbers and
+// corrected commit dates (generation data v2). Shallow repositories don't
+// have a commit-graph, since the parents of some commits are missing.
+func (r *Repository) WriteCommitGraph(o WriteCommitGraphOptions) error {
+	cgs, ok := baseStorer(r.Storer).(storer.CommitGraphStorer)
+	if !ok {
+		return ErrCommitGraphNotSupported
+	}
+
+	shallow, err := r.Storer.Shallow()
+	if err != nil || len(shallow) > 0 {
+		return err
+	}
+
+	tips, err := r.commitGraphTips(o.Reachable)
+	if err != nil {
+		return err
+	}
+
+	if o.Split {
+		ccs, ok := cgs.(storer.CommitGraphChainStorer)
+		if !ok {
+			return ErrCommitGraphNotSupported
+		}
+
+		return r.writeCommitGraphLayer(ccs, tips)
+	}
+
+	if o.Append {
+		idx, err := cgs.CommitGraph()
+		if err != nil {
+			return err
+		}
+
+		if idx != nil {
+			tips, err = r.appendCommitGraphHashes(tips, idx, 0)
+			idx.Close() //nolint:errcheck
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	idx, err := commitgraph.NewMemoryIndex(r.Storer, tips)
+	if err != nil {
+		return err
+	}
+
+	return cgs.SetCommitGraph(idx)
+}
+
+// commitGraphTips returns the objects whose commits, and their ancestors,
+// are written to the commit-graph.
+func (r *Repository) commitGraphTips(reachable bool) ([]plumbing.Hash, error) {
+	var tips []plumbing.Hash
+	if !reachable {
+		iter, err := r.Storer.IterEncodedObjects(plumbing.CommitObject)
+		if err != nil {
+			return nil, err
+		}
+
+		err = iter.ForEach(func(o plumbing.EncodedObject) error {
+			tips = append(tips, o.Hash())
+			return nil
+		})
+
+		return tips, err
+	}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+
+		return nil
+	})
+
+	return tips, err
+}
+
+// appendCommitGraphHashes appends to hs the commits of idx following the
+// first from ones, which are still in the repository.
+func (r *Repository) appendCommitGraphHashes(hs []plumbing.Hash, idx formatcg.Index, from uint32) ([]plumbing.Hash, error) {
+	for i := from; i < idx.MaximumNumberOfHashes(); i++ {
+		h, err := idx.GetHashByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.Storer.HasEncodedObject(h) == nil {
+			hs = append(hs, h)
+		}
+	}
+
+	return hs, nil
+}
+
+// writeCommitGraphLayer adds the commits reachable from tips which aren't in
+// the commit-graph chain yet as a new layer, merged with the top layers of
+// the chain which aren't big enough.
+func (r *Repository) writeCommitGraphLayer(ccs storer.CommitGraphChainStorer, tips []plumbing.Hash) error {
+	layers, err := ccs.CommitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	var top formatcg.Index
+	if len(layers) > 0 {
+		top = layers[len(layers)-1]
+		defer top.Close() //nolint:errcheck
+	} else {
+		// The commits of a commit-graph file become part of the new layer.
+		idx, err := ccs.CommitGraph()
+		if err != nil {
+			return err
+		}
+
+		if idx != nil {
+			tips, err = r.appendCommitGraphHashes(tips, idx, 0)
+			idx.Close() //nolint:errcheck
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	idx, err := commitgraph.NewMemoryIndexWithParent(r.Storer, tips, top)
+	if err != nil {
+		return err
+	}
+
+	count := idx.MaximumNumberOfHashes() - commitGraphCount(layers, len(layers))
+	keep := len(layers)
+	for keep > 0 {
+		n := commitGraphCount(layers, keep) - commitGraphCount(layers, keep-1)
+		if n > commitGraphSizeMultiple*count {
+			break
+		}
+
+		count += n
+		keep--
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	if keep < len(layers) {
+		tips, err = r.appendCommitGraphHashes(tips, top, commitGraphCount(layers, keep))
+		if err != nil {
+			return err
+		}
+
+		var base formatcg.Index
+		if keep > 0 {
+			base = layers[keep-1]
+		}
+
+		if idx, err = commitgraph.NewMemoryIndexWithParent(r.Storer, tips, base); err != nil {
+			return err
+		}
+	}
+
+	return ccs.AddCommitGraphLayer(keep, idx)
+}
+
+// commitGraphCount returns the number of commits of the first n layers of
+// a commit-graph chain.
+func commitGraphCount(layers []formatcg.Index, n int) uint32 {
+	if n == 0 {
+		return 0
+	}
+
+	return layers[n-1].MaximumNumberOfHashes()
+}
+
+// writeFetchedCommitGraph adds the fetched commits to the commit-graph
+// chain, if fetch.writeCommitGraph is true.
+func (r *Repository) writeFetchedCommitGraph() error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	switch v := cfg.Raw.Section(fetchSection).Options.Get(fetchWriteCommitGraphKey); strings.ToLower(v) {
+	case "", "false", "no", "off", "0":
+		return nil
+	case "true", "yes", "on", "1":
+	default:
+		return fmt.Errorf("invalid %s.%s: %q", fetchSection, fetchWriteCommitGraphKey, v)
+	}
+
+	if _, ok := baseStorer(r.Storer).(storer.CommitGraphChainStorer); !ok {
+		return nil
+	}
+
+	return r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true, Split: true})
+}
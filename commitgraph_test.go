@@ -0,0 +1,234 @@
+package git
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+)
+
+type CommitGraphSuite struct {
+	BaseSuite
+}
+
+func TestCommitGraphSuite(t *testing.T) {
+	suite.Run(t, new(CommitGraphSuite))
+}
+
+// initCommitGraph returns a repository with the given number of commits.
+func (s *CommitGraphSuite) initCommitGraph(commits int) (*filesystem.Storage, *Repository) {
+	sto := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	r, err := Init(sto, WithWorkTree(memfs.New()))
+	s.Require().NoError(err)
+
+	s.commit(r, commits, false)
+	return sto, r
+}
+
+func (s *CommitGraphSuite) commit(r *Repository, commits int, writeCommitGraph bool) {
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	for i := 0; i < commits; i++ {
+		_, err := w.Commit("commit", &CommitOptions{
+			AllowEmptyCommits: true,
+			Author:            &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(int64(1e9+i), 0)},
+			WriteCommitGraph:  writeCommitGraph,
+		})
+		s.Require().NoError(err)
+	}
+}
+
+// layers returns the number of commits of each layer of the commit-graph
+// chain.
+func (s *CommitGraphSuite) layers(sto *filesystem.Storage) []uint32 {
+	chain, err := sto.CommitGraphChain()
+	s.Require().NoError(err)
+
+	var counts []uint32
+	var prev uint32
+	for _, l := range chain {
+		counts = append(counts, l.MaximumNumberOfHashes()-prev)
+		prev = l.MaximumNumberOfHashes()
+	}
+
+	if len(chain) > 0 {
+		s.Require().NoError(chain[len(chain)-1].Close())
+	}
+
+	return counts
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraph() {
+	fs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, fs)
+	s.Require().NoError(err)
+
+	s.Require().NoError(r.WriteCommitGraph(WriteCommitGraphOptions{}))
+
+	idx, err := sto.CommitGraph()
+	s.Require().NoError(err)
+	s.Require().NotNil(idx)
+	defer idx.Close()
+
+	var commits int
+	iter, err := r.CommitObjects()
+	s.Require().NoError(err)
+	s.Require().NoError(iter.ForEach(func(c *object.Commit) error {
+		commits++
+		i, err := idx.GetIndexByHash(c.Hash)
+		s.Require().NoError(err)
+		data, err := idx.GetCommitDataByIndex(i)
+		s.Require().NoError(err)
+		s.Equal(c.TreeHash, data.TreeHash)
+		s.Len(data.ParentHashes, len(c.ParentHashes))
+		for i, p := range c.ParentHashes {
+			s.Equal(p, data.ParentHashes[i])
+		}
+
+		s.Equal(c.Committer.When.Unix(), data.When.Unix())
+		return nil
+	}))
+
+	s.Len(idx.Hashes(), commits)
+	s.True(idx.HasGenerationV2())
+
+	i, err := idx.GetIndexByHash(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.Require().NoError(err)
+	data, err := idx.GetCommitDataByIndex(i)
+	s.Require().NoError(err)
+	s.Equal(uint64(7), data.Generation)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphNotSupported() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	s.ErrorIs(r.WriteCommitGraph(WriteCommitGraphOptions{}), ErrCommitGraphNotSupported)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphSplit() {
+	sto, r := s.initCommitGraph(4)
+	s.Require().NoError(r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true, Split: true}))
+	s.Equal([]uint32{4}, s.layers(sto))
+
+	// The new layer is much smaller than the previous one.
+	s.commit(r, 1, true)
+	s.Equal([]uint32{4, 1}, s.layers(sto))
+
+	// The new layer is as big as the previous one, which is half as big as
+	// the first one, so they're all merged.
+	s.commit(r, 1, true)
+	s.Equal([]uint32{6}, s.layers(sto))
+
+	files, err := sto.Filesystem().ReadDir("objects/info/commit-graphs")
+	s.Require().NoError(err)
+	s.Len(files, 2)
+
+	// Without new commits, nothing is written.
+	s.Require().NoError(r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true, Split: true}))
+	s.Equal([]uint32{6}, s.layers(sto))
+
+	idx, err := sto.CommitGraph()
+	s.Require().NoError(err)
+	defer idx.Close()
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	i, err := idx.GetIndexByHash(head.Hash())
+	s.Require().NoError(err)
+	data, err := idx.GetCommitDataByIndex(i)
+	s.Require().NoError(err)
+	s.Equal(uint64(6), data.Generation)
+	s.True(idx.HasGenerationV2())
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphSplitFile() {
+	sto, r := s.initCommitGraph(3)
+	s.Require().NoError(r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true}))
+	s.commit(r, 1, false)
+
+	// The commits of the commit-graph file go into the first layer.
+	s.Require().NoError(r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true, Split: true}))
+	s.Equal([]uint32{4}, s.layers(sto))
+
+	_, err := sto.Filesystem().Stat("objects/info/commit-graph")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	// Writing a single file removes the chain.
+	s.Require().NoError(r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true}))
+	s.Empty(s.layers(sto))
+	files, err := sto.Filesystem().ReadDir("objects/info/commit-graphs")
+	s.Require().NoError(err)
+	s.Empty(files)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphAppend() {
+	sto, r := s.initCommitGraph(2)
+	head, err := r.Head()
+	s.Require().NoError(err)
+	s.commit(r, 1, false)
+
+	// The last commit isn't reachable anymore.
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, head.Hash())))
+
+	count := func(o WriteCommitGraphOptions) int {
+		s.Require().NoError(r.WriteCommitGraph(o))
+		idx, err := sto.CommitGraph()
+		s.Require().NoError(err)
+		defer idx.Close()
+		return len(idx.Hashes())
+	}
+
+	s.Equal(3, count(WriteCommitGraphOptions{}))
+	s.Equal(2, count(WriteCommitGraphOptions{Reachable: true}))
+	s.Equal(3, count(WriteCommitGraphOptions{}))
+	s.Equal(3, count(WriteCommitGraphOptions{Reachable: true, Append: true}))
+}
+
+func (s *CommitGraphSuite) TestFetchWriteCommitGraph() {
+	sto := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	r, err := Init(sto)
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section(fetchSection).SetOption(fetchWriteCommitGraphKey, "true")
+	s.Require().NoError(r.SetConfig(cfg))
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(r.Fetch(&FetchOptions{}))
+
+	s.Equal([]uint32{9}, s.layers(sto))
+}
+
+func (s *CommitGraphSuite) TestFetchWriteCommitGraphInvalid() {
+	r, err := Init(filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault()))
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section(fetchSection).SetOption(fetchWriteCommitGraphKey, "foo")
+	s.Require().NoError(r.SetConfig(cfg))
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+	s.Require().NoError(err)
+	s.ErrorContains(r.Fetch(&FetchOptions{}), "invalid fetch.writeCommitGraph")
+}
@@ -114,6 +114,21 @@ func (s *BaseSuite) GetLocalRepositoryURL(f *fixtures.Fixture) string {
 	return f.DotGit(fixtures.WithTargetDir(s.T().TempDir)).Root()
 }
 
+// GetBasicFilterLocalRepositoryURL returns the URL of the basic fixture,
+// which allows the clients to filter the objects.
+func (s *BaseSuite) GetBasicFilterLocalRepositoryURL() string {
+	url := s.GetBasicLocalRepositoryURL()
+	r, err := PlainOpen(url)
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section("uploadpack").SetOption("allowFilter", "true")
+	s.Require().NoError(r.SetConfig(cfg))
+
+	return url
+}
+
 func (s *BaseSuite) TemporalHomeDir() (path string, clean func()) {
 	home, err := os.UserHomeDir()
 	s.Require().NoError(err)
@@ -0,0 +1,982 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// objectConverter converts objects to another object format. The objects
+// they reference are converted first, since the converted IDs of an object
+// depends on the converted IDs of the objects it references.
+type objectConverter struct {
+	from storer.EncodedObjectStorer
+	to   formatcfg.ObjectFormat
+	// mapped, if not nil, returns the converted ID of the objects
+	// converted before.
+	mapped func(plumbing.Hash) (plumbing.Hash, bool, error)
+	// converted, if not nil, is called with each converted object.
+	converted func(plumbing.EncodedObject) error
+	// ids maps the IDs of the objects converted to their converted IDs.
+	ids *compatmap.Map
+}
+
+// convertFrame is an object being converted, with the objects it references
+// which remain to be converted.
+type convertFrame struct {
+	o    plumbing.EncodedObject
+	refs []plumbing.Hash
+}
+
+func newObjectConverter(from storer.EncodedObjectStorer, to formatcfg.ObjectFormat) *objectConverter {
+	return &objectConverter{from: from, to: to, ids: compatmap.NewMap()}
+}
+
+// convert converts the object h, along with the objects it references which
+// weren't converted yet, returning its converted ID.
+func (c *objectConverter) convert(h plumbing.Hash) (plumbing.Hash, error) {
+	if id, ok, err := c.lookup(h); err != nil || ok {
+		return id, err
+	}
+
+	// The objects are walked depth first without recursion, as histories
+	// can be deeper than the stack.
+	f, err := c.frame(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	stack := []*convertFrame{f}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		if len(f.refs) > 0 {
+			ref := f.refs[0]
+			f.refs = f.refs[1:]
+			_, ok, err := c.lookup(ref)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			if !ok {
+				next, err := c.frame(ref)
+				if err != nil {
+					return plumbing.ZeroHash, err
+				}
+
+				stack = append(stack, next)
+			}
+
+			continue
+		}
+
+		stack = stack[:len(stack)-1]
+		if err := c.convertObject(f.o); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	id, _ := c.ids.CompatID(h)
+	return id, nil
+}
+
+func (c *objectConverter) frame(h plumbing.Hash) (*convertFrame, error) {
+	o, err := c.from.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return nil, fmt.Errorf("converting object %s: %w", h, err)
+	}
+
+	refs, err := object.ReferencedObjects(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &convertFrame{o: o, refs: refs}, nil
+}
+
+// convertObject converts o, whose referenced objects are converted.
+func (c *objectConverter) convertObject(o plumbing.EncodedObject) error {
+	dst := plumbing.NewMemoryObject(c.to)
+	err := object.ConvertObject(o, dst, func(id plumbing.Hash, gitlink bool) (plumbing.Hash, error) {
+		// The commits of the submodules can only be converted if they're
+		// already mapped.
+		mapped, ok, err := c.lookup(id)
+		switch {
+		case err != nil || ok:
+		case gitlink:
+			err = fmt.Errorf("converting object %s: %w: %s", o.Hash(), ErrCompatSubmodule, id)
+		default:
+			err = fmt.Errorf("converting object %s: %w: %s", o.Hash(), plumbing.ErrObjectNotFound, id)
+		}
+
+		return mapped, err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.ids.Add(o.Hash(), dst.Hash())
+	if c.converted != nil {
+		return c.converted(dst)
+	}
+
+	return nil
+}
+
+func (c *objectConverter) lookup(h plumbing.Hash) (plumbing.Hash, bool, error) {
+	if id, ok := c.ids.CompatID(h); ok {
+		return id, true, nil
+	}
+
+	if c.mapped == nil {
+		return plumbing.ZeroHash, false, nil
+	}
+
+	return c.mapped(h)
+}
+
+// compatStorage presents a repository with a compat object format as if it
+// were in that format, to talk to the remotes using it. The objects and the
+// references are read converted to the compat object format. The objects
+// written are kept in memory, then converted back and stored along with
+// their mapping before the references are updated, since the objects they
+// reference must be converted first. The mappings of the objects converted
+// when read are kept in memory too, and stored at once with the others.
+type compatStorage struct {
+	storage.Storer
+
+	cos          storer.CompatObjectStorer
+	objectFormat formatcfg.ObjectFormat
+	compatFormat formatcfg.ObjectFormat
+	pending      *memory.Storage
+	mapped       *compatmap.Map
+}
+
+// newCompatStorage returns the compatStorage of s, whose config must have a
+// compat object format.
+func newCompatStorage(s storage.Storer) (*compatStorage, error) {
+	cos, ok := baseStorer(s).(storer.CompatObjectStorer)
+	if !ok {
+		return nil, ErrCompatObjectFormatNotSupported
+	}
+
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Extensions.CompatObjectFormat == nil {
+		return nil, ErrCompatObjectFormatNotSupported
+	}
+
+	cs := &compatStorage{
+		Storer:       s,
+		cos:          cos,
+		objectFormat: cfg.Extensions.ObjectFormat,
+		compatFormat: *cfg.Extensions.CompatObjectFormat,
+		mapped:       compatmap.NewMap(),
+	}
+
+	cs.pending, err = newMemoryStorage(cs.compatFormat)
+	return cs, err
+}
+
+// newMemoryStorage returns a memory.Storage of objects of the format f.
+func newMemoryStorage(f formatcfg.ObjectFormat) (*memory.Storage, error) {
+	s := memory.NewStorage()
+	cfg := config.NewConfig()
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.ObjectFormat = f
+	return s, s.SetConfig(cfg)
+}
+
+// Config returns the config of the repository, with the object formats
+// swapped.
+func (s *compatStorage) Config() (*config.Config, error) {
+	cfg, err := s.Storer.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return swapObjectFormats(cfg, s.compatFormat, s.objectFormat), nil
+}
+
+// SetConfig stores cfg, with the object formats swapped back.
+func (s *compatStorage) SetConfig(cfg *config.Config) error {
+	return s.Storer.SetConfig(swapObjectFormats(cfg, s.objectFormat, s.compatFormat))
+}
+
+func swapObjectFormats(cfg *config.Config, f, compat formatcfg.ObjectFormat) *config.Config {
+	c := *cfg
+	c.Extensions.ObjectFormat = f
+	c.Extensions.CompatObjectFormat = &compat
+	return &c
+}
+
+// ObjectFormat honors the storer.ObjectFormatStorer interface.
+func (s *compatStorage) ObjectFormat() formatcfg.ObjectFormat {
+	return s.compatFormat
+}
+
+// compatID returns the compat object ID of the object h, converting it and
+// the objects it references if they aren't mapped yet, such as the objects
+// created since the last fetch from or push to a remote in the compat
+// object format.
+func (s *compatStorage) compatID(h plumbing.Hash) (plumbing.Hash, error) {
+	c := newObjectConverter(s.Storer, s.compatFormat)
+	c.ids = s.mapped
+	c.mapped = func(h plumbing.Hash) (plumbing.Hash, bool, error) {
+		return mappedID(s.cos.CompatObjectID(h))
+	}
+
+	return c.convert(h)
+}
+
+// objectID returns the ID of the object whose compat object ID is h.
+func (s *compatStorage) objectID(h plumbing.Hash) (plumbing.Hash, error) {
+	if id, ok := s.mapped.ID(h); ok {
+		return id, nil
+	}
+
+	return s.cos.ObjectIDFromCompat(h)
+}
+
+func mappedID(id plumbing.Hash, err error) (plumbing.Hash, bool, error) {
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return plumbing.ZeroHash, false, nil
+	}
+
+	return id, err == nil, err
+}
+
+// NewEncodedObject returns a new object of the compat object format.
+func (s *compatStorage) NewEncodedObject() plumbing.EncodedObject {
+	return s.pending.NewEncodedObject()
+}
+
+// SetEncodedObject keeps o until the references are updated.
+func (s *compatStorage) SetEncodedObject(o plumbing.EncodedObject) (plumbing.Hash, error) {
+	return s.pending.SetEncodedObject(o)
+}
+
+// RawObjectWriter returns a writer of an object kept until the references
+// are updated.
+func (s *compatStorage) RawObjectWriter(typ plumbing.ObjectType, sz int64) (io.WriteCloser, error) {
+	return s.pending.RawObjectWriter(typ, sz)
+}
+
+// EncodedObject returns the object h, converted to the compat object format.
+func (s *compatStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if o, err := s.pending.EncodedObject(t, h); err == nil {
+		return o, nil
+	}
+
+	id, err := s.objectID(h)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := s.Storer.EncodedObject(t, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := s.pending.NewEncodedObject()
+	err = object.ConvertObject(o, dst, func(id plumbing.Hash, gitlink bool) (plumbing.Hash, error) {
+		if gitlink {
+			return s.submoduleCompatID(o.Hash(), id)
+		}
+
+		return s.compatID(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// submoduleCompatID returns the compat object ID of the commit h of a
+// submodule of the tree, which must be mapped since the submodule objects
+// aren't stored in the repository.
+func (s *compatStorage) submoduleCompatID(tree, h plumbing.Hash) (plumbing.Hash, error) {
+	id, ok, err := mappedID(s.cos.CompatObjectID(h))
+	if err == nil && !ok {
+		err = fmt.Errorf("converting object %s: %w: %s", tree, ErrCompatSubmodule, h)
+	}
+
+	return id, err
+}
+
+// HasEncodedObject returns nil if the object h is stored.
+func (s *compatStorage) HasEncodedObject(h plumbing.Hash) error {
+	if s.pending.HasEncodedObject(h) == nil {
+		return nil
+	}
+
+	id, err := s.objectID(h)
+	if err != nil {
+		return err
+	}
+
+	return s.Storer.HasEncodedObject(id)
+}
+
+// EncodedObjectSize returns the size of the object h, converted to the
+// compat object format.
+func (s *compatStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	o, err := s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return 0, err
+	}
+
+	return o.Size(), nil
+}
+
+// IterEncodedObjects returns an iterator of the objects of type t, converted
+// to the compat object format.
+func (s *compatStorage) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	iter, err := s.Storer.IterEncodedObjects(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []plumbing.Hash
+	err = iter.ForEach(func(o plumbing.EncodedObject) error {
+		id, err := s.compatID(o.Hash())
+		ids = append(ids, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for h := range s.pending.Objects {
+		ids = append(ids, h)
+	}
+
+	return storer.NewEncodedObjectLookupIter(s, t, ids), nil
+}
+
+// Reference returns the reference n, converted to the compat object format.
+func (s *compatStorage) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	ref, err := s.Storer.Reference(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.compatReference(ref)
+}
+
+// IterReferences returns an iterator of the references, converted to the
+// compat object format.
+func (s *compatStorage) IterReferences() (storer.ReferenceIter, error) {
+	iter, err := s.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		ref, err := s.compatReference(ref)
+		refs = append(refs, ref)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+// SetReference stores the objects kept in memory, then ref converted back.
+func (s *compatStorage) SetReference(ref *plumbing.Reference) error {
+	ref, err := s.reference(ref)
+	if err != nil {
+		return err
+	}
+
+	return s.Storer.SetReference(ref)
+}
+
+// CheckAndSetReference stores the objects kept in memory, then ref converted
+// back if old matches the stored reference.
+func (s *compatStorage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	ref, err := s.reference(ref)
+	if err != nil {
+		return err
+	}
+
+	if old != nil {
+		if old, err = s.reference(old); err != nil {
+			return err
+		}
+	}
+
+	return s.Storer.CheckAndSetReference(ref, old)
+}
+
+func (s *compatStorage) compatReference(ref *plumbing.Reference) (*plumbing.Reference, error) {
+	if ref.Type() != plumbing.HashReference {
+		return ref, nil
+	}
+
+	id, err := s.compatID(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return plumbing.NewHashReference(ref.Name(), id), nil
+}
+
+// reference returns ref converted back, after storing the objects kept in
+// memory.
+func (s *compatStorage) reference(ref *plumbing.Reference) (*plumbing.Reference, error) {
+	if ref.Type() != plumbing.HashReference {
+		return ref, nil
+	}
+
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+
+	id, err := s.objectID(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return plumbing.NewHashReference(ref.Name(), id), nil
+}
+
+// Shallow returns the shallow commits, converted to the compat object
+// format.
+func (s *compatStorage) Shallow() ([]plumbing.Hash, error) {
+	shallows, err := s.Storer.Shallow()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]plumbing.Hash, 0, len(shallows))
+	for _, h := range shallows {
+		id, err := s.compatID(h)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// SetShallow stores the objects kept in memory, then the shallow commits
+// converted back.
+func (s *compatStorage) SetShallow(shallows []plumbing.Hash) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	ids := make([]plumbing.Hash, 0, len(shallows))
+	for _, h := range shallows {
+		id, err := s.objectID(h)
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return s.Storer.SetShallow(ids)
+}
+
+// flush converts the objects kept in memory back, then stores them along
+// with the mappings kept in memory.
+func (s *compatStorage) flush() error {
+	if len(s.pending.Objects) > 0 {
+		if err := s.flushObjects(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.cos.SetCompatObjectIDs(s.mapped); err != nil {
+		return err
+	}
+
+	s.mapped = compatmap.NewMap()
+	return nil
+}
+
+// flushObjects converts the objects kept in memory back and stores them,
+// keeping their mapping.
+func (s *compatStorage) flushObjects() error {
+	converted, err := newMemoryStorage(s.objectFormat)
+	if err != nil {
+		return err
+	}
+
+	c := newObjectConverter(s.pending, s.objectFormat)
+	c.mapped = func(h plumbing.Hash) (plumbing.Hash, bool, error) {
+		if id, ok := s.mapped.ID(h); ok {
+			return id, true, nil
+		}
+
+		return mappedID(s.cos.ObjectIDFromCompat(h))
+	}
+
+	c.converted = func(o plumbing.EncodedObject) error {
+		_, err := converted.SetEncodedObject(o)
+		return err
+	}
+
+	for h := range s.pending.Objects {
+		if _, err := c.convert(h); err != nil {
+			return err
+		}
+	}
+
+	if err := writeObjects(s.Storer, converted); err != nil {
+		return err
+	}
+
+	_ = c.ids.ForEach(func(compat, id plumbing.Hash) error {
+		s.mapped.Add(id, compat)
+		return nil
+	})
+
+	s.pending, err = newMemoryStorage(s.compatFormat)
+	return err
+}
+
+// writeObjects writes the objects of src to s, in a packfile if s supports
+// it.
+func writeObjects(s storage.Storer, src *memory.Storage) (err error) {
+	pw, ok := baseStorer(s).(storer.PackfileWriter)
+	if !ok {
+		for _, o := range src.Objects {
+			if _, err := s.SetEncodedObject(o); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	hs := make([]plumbing.Hash, 0, len(src.Objects))
+	for h := range src.Objects {
+		hs = append(hs, h)
+	}
+
+	// The packfile is parsed in the object format of its objects, which
+	// isn't the one of the repository yet when converting it.
+	var w io.WriteCloser
+	if ppw, ok := pw.(packfile.ParserPackfileWriter); ok {
+		w, err = ppw.PackfileWriterWithOptions(packfile.WithObjectFormat(src.ObjectFormat()))
+	} else {
+		w, err = pw.PackfileWriter()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+	_, err = packfile.NewEncoder(w, src, false).Encode(hs, config.DefaultPackWindow)
+	return err
+}
+
+// ConvertObjectFormat converts the repository to the object format f, with
+// its former object format as compat object format, so it can still fetch
+// from and push to the remotes using it, like git does. The objects, the
+// references, the reflogs, the index and the shallow commits are rewritten
+// with the new object IDs, the reflog entries of the objects which don't
+// exist anymore are dropped. The objects are converted in memory before the
+// repository is changed, then written along with the compat object IDs, and
+// the old objects are only deleted once the config uses the new object
+// format and the references are rewritten.
+//
+// The submodules can't be converted, since the IDs of their commits in the
+// new object format aren't known: ErrCompatSubmodule is returned for the
+// trees with submodules, before the repository is changed. Likewise, the
+// trees with submodules whose commits aren't mapped can't be sent to or
+// received from the remotes using the compat object format.
+func (r *Repository) ConvertObjectFormat(f formatcfg.ObjectFormat) error {
+	cos, ok := baseStorer(r.Storer).(storer.CompatObjectStorer)
+	if !ok {
+		return ErrCompatObjectFormatNotSupported
+	}
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	old := cfg.Extensions.ObjectFormat
+	if old == f {
+		return nil
+	}
+
+	if cfg.Extensions.CompatObjectFormat != nil {
+		return fmt.Errorf("%w: the repository already has a compat object format", ErrCompatObjectFormatNotSupported)
+	}
+
+	converted, err := newMemoryStorage(f)
+	if err != nil {
+		return err
+	}
+
+	c := newObjectConverter(r.Storer, f)
+	c.converted = func(o plumbing.EncodedObject) error {
+		_, err := converted.SetEncodedObject(o)
+		return err
+	}
+
+	if err := r.convertObjects(c); err != nil {
+		return err
+	}
+
+	conv, err := r.convertRepositoryState(c)
+	if err != nil {
+		return err
+	}
+
+	oldObjects, err := r.listObjects()
+	if err != nil {
+		return err
+	}
+
+	// The converted objects are written along with the old ones, which are
+	// only deleted once the repository uses the new object format.
+	if err := r.writeConvertedObjects(cos, converted, c, cfg, f, old); err != nil {
+		return err
+	}
+
+	if err := conv.write(r); err != nil {
+		return err
+	}
+
+	if err := r.deleteObjects(oldObjects); err != nil {
+		return err
+	}
+
+	if err := r.updateMultiPackIndex(&RepackConfig{}); err != nil {
+		return err
+	}
+
+	if conv.commitGraph {
+		return r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true})
+	}
+
+	return nil
+}
+
+// convertObjects converts all the objects of the repository.
+func (r *Repository) convertObjects(c *objectConverter) error {
+	iter, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	var hs []plumbing.Hash
+	err = iter.ForEach(func(o plumbing.EncodedObject) error {
+		hs = append(hs, o.Hash())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hs {
+		if _, err := c.convert(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// convertedState is the state of a repository, other than its objects,
+// converted to another object format.
+type convertedState struct {
+	refs        []*plumbing.Reference
+	reflogs     map[plumbing.ReferenceName][]*reflog.Entry
+	index       *index.Index
+	shallows    []plumbing.Hash
+	commitGraph bool
+}
+
+// convertRepositoryState converts the state of the repository referencing
+// objects with the IDs of c, whose objects are converted.
+func (r *Repository) convertRepositoryState(c *objectConverter) (*convertedState, error) {
+	conv := &convertedState{reflogs: make(map[plumbing.ReferenceName][]*reflog.Entry)}
+	mapID := func(h plumbing.Hash) (plumbing.Hash, error) {
+		id, ok := c.ids.CompatID(h)
+		if !ok {
+			return plumbing.ZeroHash, fmt.Errorf("%w: %s", plumbing.ErrObjectNotFound, h)
+		}
+
+		return id, nil
+	}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			id, err := mapID(ref.Hash())
+			if err != nil {
+				return fmt.Errorf("converting reference %s: %w", ref.Name(), err)
+			}
+
+			ref = plumbing.NewHashReference(ref.Name(), id)
+		}
+
+		conv.refs = append(conv.refs, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rs, ok := baseStorer(r.Storer).(storer.ReflogStorer); ok {
+		names, err := rs.Reflogs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			entries, err := rs.Reflog(name)
+			if err != nil {
+				return nil, err
+			}
+
+			kept := make([]*reflog.Entry, 0, len(entries))
+			for _, e := range entries {
+				old, ok := c.ids.CompatID(e.Old)
+				if !ok && !e.Old.IsZero() {
+					continue
+				}
+
+				ne := *e
+				if ne.New, ok = c.ids.CompatID(e.New); ok {
+					ne.Old = old
+					kept = append(kept, &ne)
+				}
+			}
+
+			conv.reflogs[name] = kept
+		}
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(idx.Entries) > 0 {
+		// The extensions are dropped, they are computed again when needed.
+		conv.index = &index.Index{Version: idx.Version}
+		for _, e := range idx.Entries {
+			ne := *e
+			if ne.Hash, err = mapID(e.Hash); err != nil {
+				return nil, fmt.Errorf("converting index entry %s: %w", e.Name, err)
+			}
+
+			conv.index.Entries = append(conv.index.Entries, &ne)
+		}
+	}
+
+	shallows, err := r.Storer.Shallow()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range shallows {
+		id, err := mapID(h)
+		if err != nil {
+			return nil, err
+		}
+
+		conv.shallows = append(conv.shallows, id)
+	}
+
+	if cgs, ok := baseStorer(r.Storer).(storer.CommitGraphStorer); ok {
+		cg, err := cgs.CommitGraph()
+		if err != nil {
+			return nil, err
+		}
+
+		if cg != nil {
+			conv.commitGraph = true
+			cg.Close() //nolint:errcheck
+		}
+	}
+
+	return conv, nil
+}
+
+// write writes the converted state to r.
+func (conv *convertedState) write(r *Repository) error {
+	for _, ref := range conv.refs {
+		// The reference is removed first, so it's dropped from the packed
+		// references too, instead of being shadowed by a loose one.
+		if ref.Type() == plumbing.HashReference {
+			if err := r.Storer.RemoveReference(ref.Name()); err != nil {
+				return err
+			}
+		}
+
+		if err := r.Storer.SetReference(ref); err != nil {
+			return err
+		}
+	}
+
+	if rs, ok := baseStorer(r.Storer).(storer.ReflogStorer); ok {
+		for name, entries := range conv.reflogs {
+			if err := rs.SetReflog(name, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	if conv.index != nil {
+		if err := r.Storer.SetIndex(conv.index); err != nil {
+			return err
+		}
+	}
+
+	if len(conv.shallows) == 0 {
+		return nil
+	}
+
+	return r.Storer.SetShallow(conv.shallows)
+}
+
+// writeConvertedObjects writes the converted objects and their compat object
+// IDs, then switches the config to the object format f, with old as compat
+// object format. On failure, the converted objects are deleted, leaving the
+// repository unchanged.
+func (r *Repository) writeConvertedObjects(
+	cos storer.CompatObjectStorer, converted *memory.Storage, c *objectConverter,
+	cfg *config.Config, f, old formatcfg.ObjectFormat,
+) (err error) {
+	before, err := r.listObjects()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if after, lerr := r.listObjects(); lerr == nil {
+			_ = r.deleteObjects(after.diff(before))
+		}
+	}()
+
+	if err := writeObjects(r.Storer, converted); err != nil {
+		return err
+	}
+
+	ids := compatmap.NewMap()
+	_ = c.ids.ForEach(func(id, converted plumbing.Hash) error {
+		ids.Add(converted, id)
+		return nil
+	})
+
+	if err := cos.SetCompatObjectIDs(ids); err != nil {
+		return err
+	}
+
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.ObjectFormat = f
+	cfg.Extensions.CompatObjectFormat = &old
+	return r.Storer.SetConfig(cfg)
+}
+
+// objectList lists the loose objects and the packs of a repository.
+type objectList struct {
+	loose []plumbing.Hash
+	packs []plumbing.Hash
+}
+
+// diff returns the objects of l which aren't in o.
+func (l *objectList) diff(o *objectList) *objectList {
+	d := &objectList{}
+	for _, h := range l.loose {
+		if !slices.Contains(o.loose, h) {
+			d.loose = append(d.loose, h)
+		}
+	}
+
+	for _, h := range l.packs {
+		if !slices.Contains(o.packs, h) {
+			d.packs = append(d.packs, h)
+		}
+	}
+
+	return d
+}
+
+// listObjects lists the loose objects and the packs of the repository, if
+// its storage supports them.
+func (r *Repository) listObjects() (*objectList, error) {
+	l := &objectList{}
+	if los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer); ok {
+		err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+			l.loose = append(l.loose, h)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if pos, ok := baseStorer(r.Storer).(storer.PackedObjectStorer); ok {
+		packs, err := pos.ObjectPacks()
+		if err != nil {
+			return nil, err
+		}
+
+		l.packs = packs
+	}
+
+	return l, nil
+}
+
+// deleteObjects deletes the loose objects and the packs of l.
+func (r *Repository) deleteObjects(l *objectList) error {
+	if los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer); ok {
+		for _, h := range l.loose {
+			if err := los.DeleteLooseObject(h); err != nil {
+				return err
+			}
+		}
+	}
+
+	if pos, ok := baseStorer(r.Storer).(storer.PackedObjectStorer); ok {
+		for _, h := range l.packs {
+			if err := pos.DeleteOldObjectPackAndIndex(h, time.Time{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
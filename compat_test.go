@@ -0,0 +1,338 @@
+package git
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+)
+
+func (s *RepositorySuite) commitCount(r *Repository, h plumbing.Hash) int {
+	iter, err := r.Log(&LogOptions{From: h})
+	s.Require().NoError(err)
+
+	var count int
+	s.Require().NoError(iter.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	}))
+
+	return count
+}
+
+func (s *RepositorySuite) TestConvertObjectFormat() {
+	fs := fixtures.Basic().One().DotGit()
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.Require().NoError(err)
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	commits := s.commitCount(r, head.Hash())
+
+	s.Require().NoError(r.ConvertObjectFormat(formatcfg.SHA256))
+
+	// The repository is opened again, so nothing is read from the caches.
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err = Open(sto, nil)
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA256, cfg.Extensions.ObjectFormat)
+	s.Require().NotNil(cfg.Extensions.CompatObjectFormat)
+	s.Equal(formatcfg.SHA1, *cfg.Extensions.CompatObjectFormat)
+
+	ref, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA256Size, ref.Hash().Size())
+	s.Equal(commits, s.commitCount(r, ref.Hash()))
+
+	id, err := sto.CompatObjectID(ref.Hash())
+	s.Require().NoError(err)
+	s.Equal(head.Hash(), id)
+
+	id, err = sto.ObjectIDFromCompat(head.Hash())
+	s.Require().NoError(err)
+	s.Equal(ref.Hash(), id)
+
+	s.ErrorIs(r.ConvertObjectFormat(formatcfg.SHA1), ErrCompatObjectFormatNotSupported)
+}
+
+// setConfigFailStorage is a storage failing to set the config.
+type setConfigFailStorage struct {
+	*filesystem.Storage
+}
+
+var errSetConfig = errors.New("set config failed")
+
+func (s *setConfigFailStorage) SetConfig(*config.Config) error {
+	return errSetConfig
+}
+
+func (s *RepositorySuite) TestConvertObjectFormatFailure() {
+	fs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+
+	r, err := Open(&setConfigFailStorage{sto}, nil)
+	s.Require().NoError(err)
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	commits := s.commitCount(r, head.Hash())
+
+	s.ErrorIs(r.ConvertObjectFormat(formatcfg.SHA256), errSetConfig)
+
+	// The repository is left unchanged.
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err = Open(sto, nil)
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA1, cfg.Extensions.ObjectFormat)
+	s.Nil(cfg.Extensions.CompatObjectFormat)
+
+	ref, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(head.Hash(), ref.Hash())
+	s.Equal(commits, s.commitCount(r, ref.Hash()))
+
+	after, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.ElementsMatch(packs, after)
+}
+
+func (s *RepositorySuite) TestConvertObjectFormatMemory() {
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	s.Require().NoError(err)
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+
+	s.Require().NoError(r.ConvertObjectFormat(formatcfg.SHA256))
+
+	ref, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA256Size, ref.Hash().Size())
+
+	commit, err := r.CommitObject(ref.Hash())
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA256Size, commit.TreeHash.Size())
+
+	id, err := r.Storer.(storer.CompatObjectStorer).CompatObjectID(ref.Hash())
+	s.Require().NoError(err)
+	s.Equal(head.Hash(), id)
+}
+
+// commitSubmodule stores a commit whose tree has a submodule at the commit
+// sub, returning its ID.
+func (s *RepositorySuite) commitSubmodule(sto storer.EncodedObjectStorer, sub plumbing.Hash) plumbing.Hash {
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: "sub", Mode: filemode.Submodule, Hash: sub}}}
+	o := sto.NewEncodedObject()
+	s.Require().NoError(tree.Encode(o))
+	treeID, err := sto.SetEncodedObject(o)
+	s.Require().NoError(err)
+
+	sig := object.Signature{Name: "go-git", Email: "go-git@fake.local", When: time.Unix(1700000000, 0)}
+	commit := &object.Commit{Author: sig, Committer: sig, Message: "submodule\n", TreeHash: treeID}
+	o = sto.NewEncodedObject()
+	s.Require().NoError(commit.Encode(o))
+	id, err := sto.SetEncodedObject(o)
+	s.Require().NoError(err)
+	return id
+}
+
+func (s *RepositorySuite) TestConvertObjectFormatSubmodule() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+
+	h := s.commitSubmodule(r.Storer, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, h)))
+
+	s.ErrorIs(r.ConvertObjectFormat(formatcfg.SHA256), ErrCompatSubmodule)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA1, cfg.Extensions.ObjectFormat)
+
+	_, err = r.CommitObject(h)
+	s.NoError(err)
+}
+
+func (s *RepositorySuite) TestCompatStorageSubmodule() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	s.Require().NoError(r.ConvertObjectFormat(formatcfg.SHA256))
+
+	sub := plumbing.NewHash("a7c8f6b2e4d1c0b9a8f7e6d5c4b3a2918f7e6d5c4b3a2918f7e6d5c4b3a29180")
+	h := s.commitSubmodule(r.Storer, sub)
+
+	cs, err := newCompatStorage(r.Storer)
+	s.Require().NoError(err)
+	_, err = cs.compatID(h)
+	s.ErrorIs(err, ErrCompatSubmodule)
+
+	// The submodule commit is converted once it's mapped.
+	compatSub := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	ids := compatmap.NewMap()
+	ids.Add(sub, compatSub)
+	s.Require().NoError(cs.cos.SetCompatObjectIDs(ids))
+
+	id, err := cs.compatID(h)
+	s.Require().NoError(err)
+
+	commit, err := object.GetCommit(cs, id)
+	s.Require().NoError(err)
+	tree, err := commit.Tree()
+	s.Require().NoError(err)
+	s.Equal(compatSub, tree.Entries[0].Hash)
+	s.Equal(filemode.Submodule, tree.Entries[0].Mode)
+}
+
+// countingCompatStorer counts the writes of the mappings.
+type countingCompatStorer struct {
+	storer.CompatObjectStorer
+	writes int
+}
+
+func (s *countingCompatStorer) SetCompatObjectIDs(m *compatmap.Map) error {
+	s.writes++
+	return s.CompatObjectStorer.SetCompatObjectIDs(m)
+}
+
+func (s *RepositorySuite) TestCompatStorageMappings() {
+	r, err := PlainInit(s.T().TempDir(), false)
+	s.Require().NoError(err)
+	s.Require().NoError(r.ConvertObjectFormat(formatcfg.SHA256))
+	commits := []plumbing.Hash{createCommit(s, r), createCommit(s, r)}
+
+	cs, err := newCompatStorage(r.Storer)
+	s.Require().NoError(err)
+	cos := &countingCompatStorer{CompatObjectStorer: cs.cos}
+	cs.cos = cos
+
+	// The mappings are kept in memory until the storage is flushed.
+	for _, h := range commits {
+		id, err := cs.compatID(h)
+		s.Require().NoError(err)
+
+		back, err := cs.objectID(id)
+		s.Require().NoError(err)
+		s.Equal(h, back)
+	}
+
+	s.Zero(cos.writes)
+	s.Require().NoError(cs.flush())
+	s.Equal(1, cos.writes)
+
+	id, err := cos.CompatObjectID(commits[1])
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA1Size, id.Size())
+}
+
+// storerConnection is a connection whose storer can be replaced.
+type storerConnection struct {
+	transport.Connection
+	st storage.Storer
+}
+
+func (c *storerConnection) SetStorer(st storage.Storer) {
+	c.st = st
+}
+
+// closeConnection is a connection whose storer can't be replaced.
+type closeConnection struct {
+	transport.Connection
+	closed bool
+}
+
+func (c *closeConnection) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (s *RepositorySuite) TestUseStorer() {
+	st := memory.NewStorage()
+	var connected storage.Storer
+	connect := func(st storage.Storer) (transport.Connection, error) {
+		connected = st
+		return &closeConnection{}, nil
+	}
+
+	// The connection is reused when it can change its storer.
+	sc := &storerConnection{}
+	conn, err := useStorer(sc, st, connect)
+	s.Require().NoError(err)
+	s.Same(sc, conn)
+	s.Same(st, sc.st)
+	s.Nil(connected)
+
+	cc := &closeConnection{}
+	conn, err = useStorer(cc, st, connect)
+	s.Require().NoError(err)
+	s.NotSame(cc, conn)
+	s.True(cc.closed)
+	s.Same(st, connected)
+}
+
+func (s *RepositorySuite) TestFetchAndPushCompatObjectFormat() {
+	origin, err := PlainInit(s.T().TempDir(), false)
+	s.Require().NoError(err)
+	createCommit(s, origin)
+
+	r, err := PlainClone(s.T().TempDir(), &CloneOptions{URL: origin.wt.Root()})
+	s.Require().NoError(err)
+	s.Require().NoError(r.ConvertObjectFormat(formatcfg.SHA256))
+
+	// The new commits of the remote are converted when fetched.
+	head := createCommit(s, origin)
+	s.Require().NoError(r.Fetch(&FetchOptions{}))
+
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName(DefaultRemoteName, "master"), false)
+	s.Require().NoError(err)
+	s.Equal(formatcfg.SHA256Size, ref.Hash().Size())
+	s.Equal(2, s.commitCount(r, ref.Hash()))
+
+	cos := r.Storer.(storer.CompatObjectStorer)
+	id, err := cos.CompatObjectID(ref.Hash())
+	s.Require().NoError(err)
+	s.Equal(head, id)
+
+	// The local commits are converted back when pushed.
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+	s.Require().NoError(w.Reset(&ResetOptions{Commit: ref.Hash(), Mode: HardReset}))
+
+	h := createCommit(s, r)
+	s.Require().NoError(r.Push(&PushOptions{}))
+
+	id, err = cos.CompatObjectID(h)
+	s.Require().NoError(err)
+
+	ref, err = origin.Reference(plumbing.Master, false)
+	s.Require().NoError(err)
+	s.Equal(id, ref.Hash())
+
+	origin, err = PlainOpen(origin.wt.Root())
+	s.Require().NoError(err)
+	s.Equal(3, s.commitCount(origin, ref.Hash()))
+
+	s.ErrorIs(r.Fetch(&FetchOptions{}), NoErrAlreadyUpToDate)
+}
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/go-git/go-billy/v6/osfs"
 	"github.com/go-git/go-git/v6/internal/url"
@@ -31,6 +33,14 @@ const (
 	DefaultProtocolVersion = protocol.V0 // go-git only supports V0 at the moment
 )
 
+const (
+	// RefStorageFiles is the reference storage of the loose references
+	// and the packed-refs file.
+	RefStorageFiles = "files"
+	// RefStorageReftable is the reference storage of the reftable stack.
+	RefStorageReftable = "reftable"
+)
+
 // ConfigStorer generic storage of Config object
 type ConfigStorer interface {
 	Config() (*Config, error)
@@ -42,6 +52,7 @@ var (
 	ErrRemoteConfigNotFound  = errors.New("remote config not found")
 	ErrRemoteConfigEmptyURL  = errors.New("remote config: empty URL")
 	ErrRemoteConfigEmptyName = errors.New("remote config: empty name")
+	ErrInvalidRefStorage     = errors.New("invalid ref storage format")
 )
 
 // Scope defines the scope of a config file, such as local, global or system.
@@ -96,6 +107,12 @@ type Config struct {
 		// compression.  The default is 10.  A value of 0 turns off
 		// delta compression entirely.
 		Window uint
+		// Depth is the maximum length of the delta chains. The default is
+		// 50.
+		Depth uint
+		// WindowMemory limits the size of the objects in the sliding
+		// window, on top of Window. The default is 0, for no limit.
+		WindowMemory uint64
 	}
 
 	Init struct {
@@ -114,6 +131,23 @@ type Config struct {
 		// This setting must not be changed after repository initialization
 		// (e.g. clone or init).
 		ObjectFormat format.ObjectFormat
+
+		// CompatObjectFormat, if not nil, is the object format the IDs of
+		// the objects are mapped to, so the repository can talk to the
+		// remotes using it. The objects are converted between both
+		// formats when fetched from or pushed to these remotes.
+		CompatObjectFormat *format.ObjectFormat
+
+		// PartialClone is the name of the promisor remote of a partial
+		// clone, the objects missing from the repository are fetched from
+		// it when needed.
+		PartialClone string
+
+		// RefStorage is the format of the reference storage, either
+		// RefStorageFiles, the default, or RefStorageReftable. As
+		// ObjectFormat, it must not be changed after the repository
+		// initialization.
+		RefStorage string
 	}
 
 	Protocol struct {
@@ -159,6 +193,7 @@ func NewConfig() *Config {
 	}
 
 	config.Pack.Window = DefaultPackWindow
+	config.Pack.Depth = DefaultPackDepth
 	config.Protocol.Version = DefaultProtocolVersion
 
 	return config
@@ -280,6 +315,8 @@ const (
 	worktreeKey                = "worktree"
 	commentCharKey             = "commentChar"
 	windowKey                  = "window"
+	depthKey                   = "depth"
+	windowMemoryKey            = "windowMemory"
 	mergeKey                   = "merge"
 	rebaseKey                  = "rebase"
 	nameKey                    = "name"
@@ -288,12 +325,21 @@ const (
 	defaultBranchKey           = "defaultBranch"
 	repositoryFormatVersionKey = "repositoryformatversion"
 	objectFormat               = "objectformat"
+	compatObjectFormatKey      = "compatobjectformat"
+	partialCloneKey            = "partialclone"
+	refStorageKey              = "refstorage"
+	promisorKey                = "promisor"
+	partialCloneFilterKey      = "partialclonefilter"
 	mirrorKey                  = "mirror"
 	versionKey                 = "version"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
 	DefaultPackWindow = uint(10)
+
+	// DefaultPackDepth holds the maximum length of the delta chains. The
+	// value 50 is the same used by git command.
+	DefaultPackDepth = uint(50)
 )
 
 // Unmarshal parses a git-config file and stores it.
@@ -307,6 +353,12 @@ func (c *Config) Unmarshal(b []byte) error {
 	}
 
 	c.unmarshalCore()
+	if err := c.unmarshalObjectFormat(); err != nil {
+		return err
+	}
+	if err := c.unmarshalExtensions(); err != nil {
+		return err
+	}
 	c.unmarshalUser()
 	c.unmarshalInit()
 	if err := c.unmarshalPack(); err != nil {
@@ -339,6 +391,45 @@ func (c *Config) unmarshalCore() {
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
 }
 
+// unmarshalObjectFormat reads the repository format version and the object
+// format of the repository, failing on the unknown object formats.
+func (c *Config) unmarshalObjectFormat() error {
+	v := c.Raw.Section(coreSection).Options.Get(repositoryFormatVersionKey)
+	c.Core.RepositoryFormatVersion = format.RepositoryFormatVersion(v)
+
+	f, err := parseObjectFormat(c.Raw.Section(extensionsSection).Options.Get(objectFormat))
+	if err != nil {
+		return err
+	}
+
+	c.Extensions.ObjectFormat = f
+	return nil
+}
+
+func (c *Config) unmarshalExtensions() error {
+	s := c.Raw.Section(extensionsSection)
+	c.Extensions.CompatObjectFormat = nil
+	if v := s.Options.Get(compatObjectFormatKey); v != "" {
+		compat, err := parseObjectFormat(v)
+		if err != nil {
+			return err
+		}
+
+		c.Extensions.CompatObjectFormat = &compat
+	}
+
+	c.Extensions.PartialClone = s.Options.Get(partialCloneKey)
+
+	switch f := s.Options.Get(refStorageKey); f {
+	case "", RefStorageFiles, RefStorageReftable:
+		c.Extensions.RefStorage = f
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidRefStorage, f)
+	}
+
+	return nil
+}
+
 func (c *Config) unmarshalUser() {
 	s := c.Raw.Section(userSection)
 	c.User.Name = s.Options.Get(nameKey)
@@ -365,9 +456,60 @@ func (c *Config) unmarshalPack() error {
 		}
 		c.Pack.Window = uint(winUint)
 	}
+
+	c.Pack.Depth = DefaultPackDepth
+	if depth := s.Options.Get(depthKey); depth != "" {
+		d, err := strconv.ParseUint(depth, 10, 32)
+		if err != nil {
+			return err
+		}
+		c.Pack.Depth = uint(d)
+	}
+
+	c.Pack.WindowMemory = 0
+	if mem := s.Options.Get(windowMemoryKey); mem != "" {
+		m, err := parseSize(mem)
+		if err != nil {
+			return err
+		}
+		c.Pack.WindowMemory = m
+	}
+
 	return nil
 }
 
+// parseSize parses a size with an optional k, m or g unit suffix.
+func parseSize(v string) (uint64, error) {
+	if v == "" {
+		return 0, strconv.ErrSyntax
+	}
+
+	var shift uint
+	switch v[len(v)-1] {
+	case 'k', 'K':
+		shift = 10
+	case 'm', 'M':
+		shift = 20
+	case 'g', 'G':
+		shift = 30
+	}
+
+	if shift > 0 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if n > math.MaxUint64>>shift {
+		return 0, strconv.ErrRange
+	}
+
+	return n << shift, nil
+}
+
 func (c *Config) unmarshalRemotes() error {
 	s := c.Raw.Section(remoteSection)
 	for _, sub := range s.Subsections {
@@ -500,12 +642,35 @@ func (c *Config) marshalCore() {
 	}
 }
 
+// parseObjectFormat returns the object format named v, SHA-1 if empty.
+func parseObjectFormat(v string) (format.ObjectFormat, error) {
+	switch v {
+	case "", format.SHA1.String():
+		return format.SHA1, nil
+	case format.SHA256.String():
+		return format.SHA256, nil
+	default:
+		return format.SHA1, fmt.Errorf("%w: %s", format.ErrInvalidObjectFormat, v)
+	}
+}
+
 func (c *Config) marshalExtensions() {
 	// Extensions are only supported on Version 1, therefore
 	// ignore them otherwise.
 	if c.Core.RepositoryFormatVersion == format.Version_1 {
 		s := c.Raw.Section(extensionsSection)
 		s.SetOption(objectFormat, c.Extensions.ObjectFormat.String())
+		if c.Extensions.CompatObjectFormat != nil {
+			s.SetOption(compatObjectFormatKey, c.Extensions.CompatObjectFormat.String())
+		} else {
+			s.RemoveOption(compatObjectFormatKey)
+		}
+		if c.Extensions.PartialClone != "" {
+			s.SetOption(partialCloneKey, c.Extensions.PartialClone)
+		}
+		if c.Extensions.RefStorage != "" {
+			s.SetOption(refStorageKey, c.Extensions.RefStorage)
+		}
 	}
 }
 
@@ -543,6 +708,15 @@ func (c *Config) marshalPack() {
 	if c.Pack.Window != DefaultPackWindow {
 		s.SetOption(windowKey, fmt.Sprintf("%d", c.Pack.Window))
 	}
+
+	if c.Pack.Depth != DefaultPackDepth {
+		s.SetOption(depthKey, fmt.Sprintf("%d", c.Pack.Depth))
+	}
+
+	// The window memory may be written with a unit.
+	if m, err := parseSize(s.Options.Get(windowMemoryKey)); c.Pack.WindowMemory != 0 && (err != nil || m != c.Pack.WindowMemory) {
+		s.SetOption(windowMemoryKey, fmt.Sprintf("%d", c.Pack.WindowMemory))
+	}
 }
 
 func (c *Config) marshalRemotes() {
@@ -652,6 +826,12 @@ type RemoteConfig struct {
 	URLs []string
 	// Mirror indicates that the repository is a mirror of remote.
 	Mirror bool
+	// Promisor indicates that the remote is a promisor remote, the objects
+	// missing from a partial clone can be fetched from it.
+	Promisor bool
+	// PartialCloneFilter is the object filter used when fetching from a
+	// promisor remote, e.g. "blob:none".
+	PartialCloneFilter string
 
 	// insteadOfRulesApplied have urls been modified
 	insteadOfRulesApplied bool
@@ -708,6 +888,18 @@ func (c *RemoteConfig) unmarshal(s *format.Subsection) error {
 	c.Fetch = fetch
 	c.Mirror = c.raw.Options.Get(mirrorKey) == "true"
 
+	// Like git, promisor is a boolean, e.g. "yes" or "1".
+	switch v := c.raw.Options.Get(promisorKey); strings.ToLower(v) {
+	case "", "false", "no", "off", "0":
+		c.Promisor = false
+	case "true", "yes", "on", "1":
+		c.Promisor = true
+	default:
+		return fmt.Errorf("invalid %s.%s.%s: %q", remoteSection, c.Name, promisorKey, v)
+	}
+
+	c.PartialCloneFilter = c.raw.Options.Get(partialCloneFilterKey)
+
 	return nil
 }
 
@@ -743,6 +935,14 @@ func (c *RemoteConfig) marshal() *format.Subsection {
 		c.raw.SetOption(mirrorKey, strconv.FormatBool(c.Mirror))
 	}
 
+	if c.Promisor {
+		c.raw.SetOption(promisorKey, strconv.FormatBool(c.Promisor))
+	}
+
+	if c.PartialCloneFilter != "" {
+		c.raw.SetOption(partialCloneFilterKey, c.PartialCloneFilter)
+	}
+
 	return c.raw
 }
 
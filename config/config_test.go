@@ -9,6 +9,7 @@ import (
 	"github.com/go-git/go-billy/v6/osfs"
 	"github.com/go-git/go-billy/v6/util"
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/stretchr/testify/suite"
 )
@@ -37,6 +38,8 @@ func (s *ConfigSuite) TestUnmarshal() {
 		email = richard@example.com
 [pack]
 		window = 20
+		depth = 30
+		windowMemory = 2m
 [remote "origin"]
 		url = git@github.com:mcuadros/go-git.git
 		fetch = +refs/heads/*:refs/remotes/origin/*
@@ -77,6 +80,8 @@ func (s *ConfigSuite) TestUnmarshal() {
 	s.Equal("Richard Roe", cfg.Committer.Name)
 	s.Equal("richard@example.com", cfg.Committer.Email)
 	s.Equal(uint(20), cfg.Pack.Window)
+	s.Equal(uint(30), cfg.Pack.Depth)
+	s.Equal(uint64(2<<20), cfg.Pack.WindowMemory)
 	s.Len(cfg.Remotes, 4)
 	s.Equal("origin", cfg.Remotes["origin"].Name)
 	s.Equal([]string{"git@github.com:mcuadros/go-git.git"}, cfg.Remotes["origin"].URLs)
@@ -103,6 +108,8 @@ func (s *ConfigSuite) TestMarshal() {
 	worktree = bar
 [pack]
 	window = 20
+	depth = 30
+	windowMemory = 1024
 [remote "alt"]
 	url = git@github.com:mcuadros/go-git.git
 	url = git@github.com:src-d/go-git.git
@@ -130,6 +137,8 @@ func (s *ConfigSuite) TestMarshal() {
 	cfg.Core.IsBare = true
 	cfg.Core.Worktree = "bar"
 	cfg.Pack.Window = 20
+	cfg.Pack.Depth = 30
+	cfg.Pack.WindowMemory = 1024
 	cfg.Init.DefaultBranch = "main"
 	cfg.Remotes["origin"] = &RemoteConfig{
 		Name: "origin",
@@ -348,6 +357,8 @@ func (s *ConfigSuite) TestRemoteConfigDefaultValues() {
 	s.Len(config.Submodules, 0)
 	s.NotNil(config.Raw)
 	s.Equal(DefaultPackWindow, config.Pack.Window)
+	s.Equal(DefaultPackDepth, config.Pack.Depth)
+	s.Zero(config.Pack.WindowMemory)
 }
 
 func (s *ConfigSuite) TestLoadConfigLocalScope() {
@@ -398,6 +409,117 @@ func (s *ConfigSuite) TestProtocol() {
 	s.NoError(err)
 }
 
+func (s *ConfigSuite) TestPartialClone() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[extensions]
+	partialclone = origin
+[remote "origin"]
+	url = https://example.com/repo.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	promisor = true
+	partialclonefilter = blob:none
+`)
+
+	cfg := NewConfig()
+	err := cfg.Unmarshal(input)
+	s.NoError(err)
+
+	s.Equal("origin", cfg.Extensions.PartialClone)
+	s.True(cfg.Remotes["origin"].Promisor)
+	s.Equal("blob:none", cfg.Remotes["origin"].PartialCloneFilter)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(output), "partialclone = origin")
+	s.Contains(string(output), "promisor = true")
+	s.Contains(string(output), "partialclonefilter = blob:none")
+}
+
+func (s *ConfigSuite) TestPromisorBoolean() {
+	for v, expected := range map[string]bool{"yes": true, "On": true, "1": true, "no": false, "0": false} {
+		cfg := NewConfig()
+		s.NoError(cfg.Unmarshal([]byte("[remote \"origin\"]\n\turl = foo\n\tpromisor = " + v + "\n")))
+		s.Equal(expected, cfg.Remotes["origin"].Promisor, v)
+	}
+
+	err := NewConfig().Unmarshal([]byte("[remote \"origin\"]\n\turl = foo\n\tpromisor = foo\n"))
+	s.ErrorContains(err, "remote.origin.promisor")
+}
+
+func (s *ConfigSuite) TestRefStorage() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[extensions]
+	refStorage = reftable
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal(RefStorageReftable, cfg.Extensions.RefStorage)
+
+	cfg = NewConfig()
+	cfg.Core.RepositoryFormatVersion = format.Version_1
+	cfg.Extensions.RefStorage = RefStorageReftable
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(output), "refstorage = reftable")
+
+	err = NewConfig().Unmarshal([]byte("[extensions]\n\trefStorage = foo\n"))
+	s.ErrorIs(err, ErrInvalidRefStorage)
+}
+
+func (s *ConfigSuite) TestObjectFormat() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[extensions]
+	objectFormat = sha256
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal(format.RepositoryFormatVersion(format.Version_1), cfg.Core.RepositoryFormatVersion)
+	s.Equal(format.SHA256, cfg.Extensions.ObjectFormat)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(output), "objectFormat = sha256")
+
+	cfg = NewConfig()
+	s.NoError(cfg.Unmarshal([]byte("[core]\n\tbare = true\n")))
+	s.Equal(format.SHA1, cfg.Extensions.ObjectFormat)
+
+	err = NewConfig().Unmarshal([]byte("[extensions]\n\tobjectFormat = foo\n"))
+	s.ErrorIs(err, format.ErrInvalidObjectFormat)
+}
+
+func (s *ConfigSuite) TestCompatObjectFormat() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[extensions]
+	objectFormat = sha256
+	compatObjectFormat = sha1
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal(format.SHA256, cfg.Extensions.ObjectFormat)
+	s.Require().NotNil(cfg.Extensions.CompatObjectFormat)
+	s.Equal(format.SHA1, *cfg.Extensions.CompatObjectFormat)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(output), "compatObjectFormat = sha1")
+
+	cfg.Extensions.CompatObjectFormat = nil
+	output, err = cfg.Marshal()
+	s.NoError(err)
+	s.NotContains(string(output), "compatObjectFormat")
+
+	err = NewConfig().Unmarshal([]byte("[extensions]\n\tcompatObjectFormat = foo\n"))
+	s.ErrorIs(err, format.ErrInvalidObjectFormat)
+}
+
 func (s *ConfigSuite) TestUnmarshalRemotes() {
 	input := []byte(`[core]
 	bare = true
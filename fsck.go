@@ -0,0 +1,675 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+const fsckSection = "fsck"
+
+// FsckOptions describes how a repository check should be performed.
+type FsckOptions struct {
+	// ConnectivityOnly only checks that the objects reachable from the
+	// references, the reflogs and the index exist, skipping the
+	// verification of the integrity and the syntax of the objects.
+	ConnectivityOnly bool
+	// NoReflogs doesn't consider the objects referenced only by the
+	// reflogs as reachable.
+	NoReflogs bool
+}
+
+// FsckSeverity is the severity of a problem found by Fsck.
+type FsckSeverity int
+
+const (
+	// FsckIgnore problems aren't reported.
+	FsckIgnore FsckSeverity = iota
+	// FsckInfo problems are only informative.
+	FsckInfo
+	// FsckWarn problems are reported, but the object is still valid.
+	FsckWarn
+	// FsckError problems make the object invalid.
+	FsckError
+)
+
+func (s FsckSeverity) String() string {
+	switch s {
+	case FsckIgnore:
+		return "ignore"
+	case FsckInfo:
+		return "info"
+	case FsckWarn:
+		return "warning"
+	case FsckError:
+		return "error"
+	default:
+		return fmt.Sprintf("FsckSeverity(%d)", int(s))
+	}
+}
+
+// FsckMessageID identifies a kind of problem found by Fsck, as git does.
+// Its severity can be changed with the fsck.<id> configuration option, to
+// error, warn or ignore.
+type FsckMessageID string
+
+// The problems found by Fsck. The errors make the object invalid.
+const (
+	FsckBadDate                 FsckMessageID = "badDate"
+	FsckBadDateOverflow         FsckMessageID = "badDateOverflow"
+	FsckBadEmail                FsckMessageID = "badEmail"
+	FsckBadName                 FsckMessageID = "badName"
+	FsckBadObjectSha1           FsckMessageID = "badObjectSha1"
+	FsckBadParentSha1           FsckMessageID = "badParentSha1"
+	FsckBadTimezone             FsckMessageID = "badTimezone"
+	FsckBadTree                 FsckMessageID = "badTree"
+	FsckBadTreeSha1             FsckMessageID = "badTreeSha1"
+	FsckBadType                 FsckMessageID = "badType"
+	FsckDuplicateEntries        FsckMessageID = "duplicateEntries"
+	FsckMissingAuthor           FsckMessageID = "missingAuthor"
+	FsckMissingCommitter        FsckMessageID = "missingCommitter"
+	FsckMissingEmail            FsckMessageID = "missingEmail"
+	FsckMissingNameBeforeEmail  FsckMessageID = "missingNameBeforeEmail"
+	FsckMissingObject           FsckMessageID = "missingObject"
+	FsckMissingSpaceBeforeDate  FsckMessageID = "missingSpaceBeforeDate"
+	FsckMissingSpaceBeforeEmail FsckMessageID = "missingSpaceBeforeEmail"
+	FsckMissingTagEntry         FsckMessageID = "missingTagEntry"
+	FsckMissingTree             FsckMessageID = "missingTree"
+	FsckMissingTypeEntry        FsckMessageID = "missingTypeEntry"
+	FsckMultipleAuthors         FsckMessageID = "multipleAuthors"
+	FsckNulInHeader             FsckMessageID = "nulInHeader"
+	FsckTreeNotSorted           FsckMessageID = "treeNotSorted"
+	FsckUnterminatedHeader      FsckMessageID = "unterminatedHeader"
+	FsckZeroPaddedDate          FsckMessageID = "zeroPaddedDate"
+)
+
+// The problems found by Fsck which are only warnings.
+const (
+	FsckBadFilemode        FsckMessageID = "badFilemode"
+	FsckEmptyName          FsckMessageID = "emptyName"
+	FsckFullPathname       FsckMessageID = "fullPathname"
+	FsckHasDot             FsckMessageID = "hasDot"
+	FsckHasDotdot          FsckMessageID = "hasDotdot"
+	FsckHasDotgit          FsckMessageID = "hasDotgit"
+	FsckNullSha1           FsckMessageID = "nullSha1"
+	FsckZeroPaddedFilemode FsckMessageID = "zeroPaddedFilemode"
+	FsckNulInCommit        FsckMessageID = "nulInCommit"
+)
+
+// The problems found by Fsck which are only informative.
+const (
+	FsckBadTagName         FsckMessageID = "badTagName"
+	FsckMissingTaggerEntry FsckMessageID = "missingTaggerEntry"
+)
+
+// fsckSeverities are the default severities of the problems, the same as
+// git's.
+var fsckSeverities = map[FsckMessageID]FsckSeverity{
+	FsckBadDate:                 FsckError,
+	FsckBadDateOverflow:         FsckError,
+	FsckBadEmail:                FsckError,
+	FsckBadName:                 FsckError,
+	FsckBadObjectSha1:           FsckError,
+	FsckBadParentSha1:           FsckError,
+	FsckBadTimezone:             FsckError,
+	FsckBadTree:                 FsckError,
+	FsckBadTreeSha1:             FsckError,
+	FsckBadType:                 FsckError,
+	FsckDuplicateEntries:        FsckError,
+	FsckMissingAuthor:           FsckError,
+	FsckMissingCommitter:        FsckError,
+	FsckMissingEmail:            FsckError,
+	FsckMissingNameBeforeEmail:  FsckError,
+	FsckMissingObject:           FsckError,
+	FsckMissingSpaceBeforeDate:  FsckError,
+	FsckMissingSpaceBeforeEmail: FsckError,
+	FsckMissingTagEntry:         FsckError,
+	FsckMissingTree:             FsckError,
+	FsckMissingTypeEntry:        FsckError,
+	FsckMultipleAuthors:         FsckError,
+	FsckNulInHeader:             FsckError,
+	FsckTreeNotSorted:           FsckError,
+	FsckUnterminatedHeader:      FsckError,
+	FsckZeroPaddedDate:          FsckError,
+	FsckBadFilemode:             FsckWarn,
+	FsckEmptyName:               FsckWarn,
+	FsckFullPathname:            FsckWarn,
+	FsckHasDot:                  FsckWarn,
+	FsckHasDotdot:               FsckWarn,
+	FsckHasDotgit:               FsckWarn,
+	FsckNullSha1:                FsckWarn,
+	FsckZeroPaddedFilemode:      FsckWarn,
+	FsckNulInCommit:             FsckWarn,
+	FsckBadTagName:              FsckInfo,
+	FsckMissingTaggerEntry:      FsckInfo,
+}
+
+// newFsckSeverities returns the severities of the problems, overridden by
+// the fsck section of the configuration.
+func newFsckSeverities(cfg *config.Config) (map[FsckMessageID]FsckSeverity, error) {
+	severities := make(map[FsckMessageID]FsckSeverity, len(fsckSeverities))
+	for id, s := range fsckSeverities {
+		severities[id] = s
+	}
+
+	for _, opt := range cfg.Raw.Section(fsckSection).Options {
+		for id := range fsckSeverities {
+			if !strings.EqualFold(opt.Key, string(id)) {
+				continue
+			}
+
+			switch strings.ToLower(opt.Value) {
+			case "error":
+				severities[id] = FsckError
+			case "warn":
+				severities[id] = FsckWarn
+			case "ignore":
+				severities[id] = FsckIgnore
+			default:
+				return nil, fmt.Errorf("invalid %s.%s: %q", fsckSection, opt.Key, opt.Value)
+			}
+		}
+	}
+
+	return severities, nil
+}
+
+// FsckProblem is a problem found in the syntax of an object.
+type FsckProblem struct {
+	Object   plumbing.Hash
+	Type     plumbing.ObjectType
+	ID       FsckMessageID
+	Severity FsckSeverity
+	Message  string
+}
+
+func (p FsckProblem) String() string {
+	return fmt.Sprintf("%s in %s %s: %s: %s", p.Severity, p.Type, p.Object, p.ID, p.Message)
+}
+
+// FsckCorruption is an object, or a packfile, which can't be read or whose
+// content doesn't match its hash.
+type FsckCorruption struct {
+	// Object is the corrupted object, zero if the whole packfile is.
+	Object plumbing.Hash
+	// Pack is the corrupted packfile, zero for the objects.
+	Pack plumbing.Hash
+	Err  error
+}
+
+// FsckObject is an object reported by Fsck. The type of the missing objects
+// is the one expected by the objects referencing them.
+type FsckObject struct {
+	Hash plumbing.Hash
+	Type plumbing.ObjectType
+}
+
+// FsckResult is the outcome of Fsck.
+type FsckResult struct {
+	// Problems are the problems found in the syntax of the objects, whose
+	// severity isn't ignore.
+	Problems []FsckProblem
+	// Corrupted are the objects and packfiles which can't be read.
+	Corrupted []FsckCorruption
+	// Missing are the objects reachable from the references, the reflogs
+	// or the index which don't exist.
+	Missing []FsckObject
+	// Dangling are the unreachable objects not referenced by any other
+	// object.
+	Dangling []FsckObject
+}
+
+// HasErrors returns true if there are corrupted or missing objects, or
+// problems with the error severity.
+func (r *FsckResult) HasErrors() bool {
+	if len(r.Corrupted) > 0 || len(r.Missing) > 0 {
+		return true
+	}
+
+	for _, p := range r.Problems {
+		if p.Severity == FsckError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fsck checks the integrity of the repository, like git fsck. The loose
+// objects and the packfiles are verified against their hashes and
+// checksums, the syntax of the commits, trees and tags is validated, and the
+// objects reachable from the references, the reflogs and the index are
+// checked to exist. Like git, the objects missing from a partial clone which
+// are referenced by the objects of its promisor packfiles aren't reported.
+// The unreachable objects not referenced by any other are reported as
+// dangling. The severity of the problems can be changed with the
+// fsck.<id> configuration options.
+func (r *Repository) Fsck(o FsckOptions) (*FsckResult, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	severities, err := newFsckSeverities(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fsck{
+		r:          r,
+		o:          o,
+		severities: severities,
+		result:     &FsckResult{},
+		objects:    make(map[plumbing.Hash]*fsckNode),
+	}
+
+	if cfg.Extensions.PartialClone != "" {
+		f.promisor = make(map[plumbing.Hash]struct{})
+	}
+
+	if !o.ConnectivityOnly {
+		if err := f.verify(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.readObjects(); err != nil {
+		return nil, err
+	}
+
+	if err := f.walk(); err != nil {
+		return nil, err
+	}
+
+	f.dangling()
+	return f.result, nil
+}
+
+// fsckNode is an object read by fsck.
+type fsckNode struct {
+	typ        plumbing.ObjectType
+	links      []fsckLink
+	referenced bool
+	reachable  bool
+}
+
+// fsckLink is a reference from an object to another, of the given type.
+type fsckLink struct {
+	hash plumbing.Hash
+	typ  plumbing.ObjectType
+}
+
+type fsck struct {
+	r          *Repository
+	o          FsckOptions
+	severities map[FsckMessageID]FsckSeverity
+	result     *FsckResult
+	objects    map[plumbing.Hash]*fsckNode
+	// promisor holds the objects of the promisor packfiles, if the
+	// repository is a partial clone.
+	promisor map[plumbing.Hash]struct{}
+}
+
+// verify verifies the loose objects and the packfiles, if the storer is able
+// to.
+func (f *fsck) verify() error {
+	ov, ok := baseStorer(f.r.Storer).(storer.ObjectVerifier)
+	if !ok {
+		return nil
+	}
+
+	if los, ok := baseStorer(f.r.Storer).(storer.LooseObjectStorer); ok {
+		err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+			if err := ov.VerifyLooseObject(h); err != nil {
+				f.result.Corrupted = append(f.result.Corrupted, FsckCorruption{Object: h, Err: err})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if pos, ok := baseStorer(f.r.Storer).(storer.PackedObjectStorer); ok {
+		packs, err := pos.ObjectPacks()
+		if err != nil {
+			return err
+		}
+
+		for _, h := range packs {
+			if err := ov.VerifyObjectPack(h); err != nil {
+				f.result.Corrupted = append(f.result.Corrupted, FsckCorruption{Pack: h, Err: err})
+			}
+		}
+	}
+
+	return nil
+}
+
+// readObjects reads every object, checking their syntax and recording their
+// links. The objects which can't be read are reported as corrupted.
+func (f *fsck) readObjects() error {
+	hashes, err := f.objectHashes()
+	if err != nil {
+		return err
+	}
+
+	corrupted := make(map[plumbing.Hash]struct{})
+	for _, c := range f.result.Corrupted {
+		corrupted[c.Object] = struct{}{}
+	}
+
+	for _, h := range hashes {
+		if _, ok := f.objects[h]; ok {
+			continue
+		}
+
+		obj, err := f.r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err == nil {
+			err = f.readObject(obj)
+		}
+
+		if err != nil {
+			// The object exists, even if it can't be read.
+			f.objects[h] = &fsckNode{typ: plumbing.AnyObject}
+			if _, ok := corrupted[h]; !ok {
+				f.result.Corrupted = append(f.result.Corrupted, FsckCorruption{Object: h, Err: err})
+			}
+		}
+	}
+
+	return nil
+}
+
+// objectHashes lists the loose and packed objects, from the indexes of the
+// packfiles when possible, so a corrupted object doesn't stop the listing.
+func (f *fsck) objectHashes() ([]plumbing.Hash, error) {
+	var hashes []plumbing.Hash
+	los, lok := baseStorer(f.r.Storer).(storer.LooseObjectStorer)
+	pos, pok := baseStorer(f.r.Storer).(storer.PackedObjectStorer)
+	bs, bok := baseStorer(f.r.Storer).(storer.BitmapStorer)
+	if !lok || !pok || !bok {
+		iter, err := f.r.Storer.IterEncodedObjects(plumbing.AnyObject)
+		if err != nil {
+			return nil, err
+		}
+
+		err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+			hashes = append(hashes, obj.Hash())
+			return nil
+		})
+
+		return hashes, err
+	}
+
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		hashes = append(hashes, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	packs, err := pos.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	pps, pok := baseStorer(f.r.Storer).(storer.PromisorPackStorer)
+	for _, pack := range packs {
+		idx, err := bs.ObjectPackIndex(pack)
+		if err != nil {
+			f.result.Corrupted = append(f.result.Corrupted, FsckCorruption{Pack: pack, Err: err})
+			continue
+		}
+
+		promisor := false
+		if f.promisor != nil && pok {
+			if promisor, err = pps.IsPromisorPack(pack); err != nil {
+				return nil, err
+			}
+		}
+
+		entries, err := idx.Entries()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			e, err := entries.Next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				entries.Close() //nolint:errcheck
+				return nil, err
+			}
+
+			hashes = append(hashes, e.Hash)
+			if promisor {
+				f.promisor[e.Hash] = struct{}{}
+			}
+		}
+
+		entries.Close() //nolint:errcheck
+	}
+
+	return hashes, nil
+}
+
+// readObject checks the syntax of an object, unless only the connectivity is
+// checked, and records its links.
+func (f *fsck) readObject(obj plumbing.EncodedObject) error {
+	node := &fsckNode{typ: obj.Type()}
+	if obj.Type() == plumbing.BlobObject {
+		f.objects[obj.Hash()] = node
+		return nil
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	c := &fsckChecker{idSize: obj.Hash().Size()}
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		c.checkCommit(data)
+	case plumbing.TreeObject:
+		c.checkTree(data)
+	case plumbing.TagObject:
+		c.checkTag(data)
+	}
+
+	node.links = c.links
+	f.objects[obj.Hash()] = node
+	if f.o.ConnectivityOnly {
+		return nil
+	}
+
+	for _, report := range c.reports {
+		severity := f.severities[report.id]
+		if severity == FsckIgnore {
+			continue
+		}
+
+		f.result.Problems = append(f.result.Problems, FsckProblem{
+			Object:   obj.Hash(),
+			Type:     obj.Type(),
+			ID:       report.id,
+			Severity: severity,
+			Message:  report.message,
+		})
+	}
+
+	return nil
+}
+
+// walk marks the objects reachable from the references, the reflogs and the
+// index, reporting the missing ones but the ones promised by the promisor
+// objects.
+func (f *fsck) walk() error {
+	roots, err := f.roots()
+	if err != nil {
+		return err
+	}
+
+	shallow, err := f.r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+
+	shallows := make(map[plumbing.Hash]struct{}, len(shallow))
+	for _, h := range shallow {
+		shallows[h] = struct{}{}
+	}
+
+	for _, node := range f.objects {
+		for _, l := range node.links {
+			if n, ok := f.objects[l.hash]; ok {
+				n.referenced = true
+			}
+		}
+	}
+
+	promised := make(map[plumbing.Hash]struct{})
+	for h := range f.promisor {
+		for _, l := range f.objects[h].links {
+			promised[l.hash] = struct{}{}
+		}
+	}
+
+	missing := make(map[plumbing.Hash]struct{})
+	for len(roots) > 0 {
+		l := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+
+		node, ok := f.objects[l.hash]
+		if !ok {
+			if _, ok := promised[l.hash]; ok {
+				continue
+			}
+
+			if _, ok := missing[l.hash]; !ok {
+				missing[l.hash] = struct{}{}
+				f.result.Missing = append(f.result.Missing, FsckObject{Hash: l.hash, Type: l.typ})
+			}
+
+			continue
+		}
+
+		if node.reachable {
+			continue
+		}
+
+		node.reachable = true
+		for _, link := range node.links {
+			if _, ok := shallows[l.hash]; ok && link.typ == plumbing.CommitObject {
+				continue
+			}
+
+			roots = append(roots, link)
+		}
+	}
+
+	sort.Slice(f.result.Missing, func(i, j int) bool {
+		return f.result.Missing[i].Hash.Compare(f.result.Missing[j].Hash.Bytes()) < 0
+	})
+
+	return nil
+}
+
+// roots returns the objects referenced by the references, the reflogs,
+// unless NoReflogs, and the index.
+func (f *fsck) roots() ([]fsckLink, error) {
+	var roots []fsckLink
+	refs, err := f.r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			roots = append(roots, fsckLink{hash: ref.Hash(), typ: plumbing.AnyObject})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := f.r.Storer.Reference(plumbing.HEAD)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, err
+	}
+
+	if head != nil && head.Type() == plumbing.HashReference {
+		roots = append(roots, fsckLink{hash: head.Hash(), typ: plumbing.CommitObject})
+	}
+
+	if rs, ok := baseStorer(f.r.Storer).(storer.ReflogStorer); ok && !f.o.NoReflogs {
+		names, err := rs.Reflogs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			entries, err := rs.Reflog(name)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				for _, h := range []plumbing.Hash{e.Old, e.New} {
+					if !h.IsZero() {
+						roots = append(roots, fsckLink{hash: h, typ: plumbing.AnyObject})
+					}
+				}
+			}
+		}
+	}
+
+	idx, err := f.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Mode != filemode.Submodule {
+			roots = append(roots, fsckLink{hash: e.Hash, typ: plumbing.BlobObject})
+		}
+	}
+
+	return roots, nil
+}
+
+// dangling reports the unreachable objects not referenced by any other,
+// except the corrupted ones.
+func (f *fsck) dangling() {
+	for h, node := range f.objects {
+		if !node.reachable && !node.referenced && node.typ != plumbing.AnyObject {
+			f.result.Dangling = append(f.result.Dangling, FsckObject{Hash: h, Type: node.typ})
+		}
+	}
+
+	sort.Slice(f.result.Dangling, func(i, j int) bool {
+		return f.result.Dangling[i].Hash.Compare(f.result.Dangling[j].Hash.Bytes()) < 0
+	})
+}
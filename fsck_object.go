@@ -0,0 +1,407 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+)
+
+// fsckReport is a problem found by a fsckChecker, before its severity is
+// known.
+type fsckReport struct {
+	id      FsckMessageID
+	message string
+}
+
+// fsckChecker checks the syntax of the raw content of the commits, trees and
+// tags the same way git fsck does, collecting the problems and the links to
+// other objects.
+type fsckChecker struct {
+	idSize  int
+	reports []fsckReport
+	links   []fsckLink
+}
+
+func (c *fsckChecker) report(id FsckMessageID, format string, args ...any) {
+	c.reports = append(c.reports, fsckReport{id: id, message: fmt.Sprintf(format, args...)})
+}
+
+func (c *fsckChecker) link(h plumbing.Hash, t plumbing.ObjectType) {
+	c.links = append(c.links, fsckLink{hash: h, typ: t})
+}
+
+// verifyHeaders checks that the headers don't have NUL bytes and are
+// terminated by an empty line, or by the end of the content.
+func (c *fsckChecker) verifyHeaders(data []byte) bool {
+	for i, b := range data {
+		switch {
+		case b == 0:
+			c.report(FsckNulInHeader, "unterminated header: NUL at offset %d", i)
+			return false
+		case b == '\n' && i+1 < len(data) && data[i+1] == '\n':
+			return true
+		}
+	}
+
+	if len(data) > 0 && data[len(data)-1] == '\n' {
+		return true
+	}
+
+	c.report(FsckUnterminatedHeader, "unterminated header")
+	return false
+}
+
+// header returns the value of the header line of data starting with the
+// given key, and the following lines.
+func header(data []byte, key string) (value, rest []byte, ok bool) {
+	if !bytes.HasPrefix(data, []byte(key+" ")) {
+		return nil, data, false
+	}
+
+	data = data[len(key)+1:]
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, data, false
+	}
+
+	return data[:i], data[i+1:], true
+}
+
+func (c *fsckChecker) parseHash(v []byte) (plumbing.Hash, bool) {
+	if len(v) != c.idSize*2 {
+		return plumbing.ZeroHash, false
+	}
+
+	return plumbing.FromHex(string(v))
+}
+
+func (c *fsckChecker) checkCommit(data []byte) {
+	if !c.verifyHeaders(data) {
+		return
+	}
+
+	v, buf, ok := header(data, "tree")
+	if !ok {
+		c.report(FsckMissingTree, "invalid format - expected 'tree' line")
+		return
+	}
+
+	h, ok := c.parseHash(v)
+	if !ok {
+		c.report(FsckBadTreeSha1, "invalid 'tree' line format - bad sha1")
+		return
+	}
+
+	c.link(h, plumbing.TreeObject)
+	for {
+		v, rest, ok := header(buf, "parent")
+		if !ok {
+			break
+		}
+
+		h, ok := c.parseHash(v)
+		if !ok {
+			c.report(FsckBadParentSha1, "invalid 'parent' line format - bad sha1")
+			return
+		}
+
+		c.link(h, plumbing.CommitObject)
+		buf = rest
+	}
+
+	var authors int
+	for {
+		v, rest, ok := header(buf, "author")
+		if !ok {
+			break
+		}
+
+		authors++
+		if !c.checkIdent(v) {
+			return
+		}
+
+		buf = rest
+	}
+
+	if authors == 0 {
+		c.report(FsckMissingAuthor, "invalid format - expected 'author' line")
+		return
+	}
+
+	if authors > 1 {
+		c.report(FsckMultipleAuthors, "invalid format - multiple 'author' lines")
+	}
+
+	v, _, ok = header(buf, "committer")
+	if !ok {
+		c.report(FsckMissingCommitter, "invalid format - expected 'committer' line")
+		return
+	}
+
+	if !c.checkIdent(v) {
+		return
+	}
+
+	if bytes.IndexByte(data, 0) >= 0 {
+		c.report(FsckNulInCommit, "NUL byte in the commit object body")
+	}
+}
+
+func (c *fsckChecker) checkTag(data []byte) {
+	if !c.verifyHeaders(data) {
+		return
+	}
+
+	v, buf, ok := header(data, "object")
+	if !ok {
+		c.report(FsckMissingObject, "invalid format - expected 'object' line")
+		return
+	}
+
+	h, ok := c.parseHash(v)
+	if !ok {
+		c.report(FsckBadObjectSha1, "invalid 'object' line format - bad sha1")
+		return
+	}
+
+	v, buf, ok = header(buf, "type")
+	if !ok {
+		c.report(FsckMissingTypeEntry, "invalid format - expected 'type' line")
+		return
+	}
+
+	t, err := plumbing.ParseObjectType(string(v))
+	if err != nil || !t.Valid() || t.IsDelta() {
+		c.report(FsckBadType, "invalid 'type' value")
+		return
+	}
+
+	c.link(h, t)
+	v, buf, ok = header(buf, "tag")
+	if !ok {
+		c.report(FsckMissingTagEntry, "invalid format - expected 'tag' line")
+		return
+	}
+
+	if err := plumbing.NewTagReferenceName(string(v)).Validate(); err != nil {
+		c.report(FsckBadTagName, "invalid 'tag' name: %s", v)
+	}
+
+	v, _, ok = header(buf, "tagger")
+	if !ok {
+		c.report(FsckMissingTaggerEntry, "invalid format - expected 'tagger' line")
+		return
+	}
+
+	c.checkIdent(v)
+}
+
+// checkIdent checks the identity of an author, a committer or a tagger line,
+// in the "Name <email> timestamp timezone" format. It returns false if
+// there's a problem.
+func (c *fsckChecker) checkIdent(ident []byte) bool {
+	// The line is terminated by its newline, and at returns NUL past it,
+	// like the C strings git reads.
+	p := append(append(make([]byte, 0, len(ident)+1), ident...), '\n')
+	at := func(i int) byte {
+		if i < len(p) {
+			return p[i]
+		}
+
+		return 0
+	}
+
+	if at(0) == '<' {
+		c.report(FsckMissingNameBeforeEmail, "invalid author/committer line - missing name before email")
+		return false
+	}
+
+	i := bytes.IndexAny(p, "<>\n")
+	if at(i) == '>' {
+		c.report(FsckBadName, "invalid author/committer line - bad name")
+		return false
+	}
+
+	if at(i) != '<' {
+		c.report(FsckMissingEmail, "invalid author/committer line - missing email")
+		return false
+	}
+
+	if at(i-1) != ' ' {
+		c.report(FsckMissingSpaceBeforeEmail, "invalid author/committer line - missing space before email")
+		return false
+	}
+
+	i++
+	i += bytes.IndexAny(p[i:], "<>\n")
+	if at(i) != '>' {
+		c.report(FsckBadEmail, "invalid author/committer line - bad email")
+		return false
+	}
+
+	i++
+	if at(i) != ' ' {
+		c.report(FsckMissingSpaceBeforeDate, "invalid author/committer line - missing space before date")
+		return false
+	}
+
+	i++
+	if at(i) == '0' && at(i+1) != ' ' {
+		c.report(FsckZeroPaddedDate, "invalid author/committer line - zero-padded date")
+		return false
+	}
+
+	end := i
+	for isDigit(at(end)) {
+		end++
+	}
+
+	if end > i {
+		if t, err := strconv.ParseUint(string(p[i:end]), 10, 64); err != nil || t > math.MaxInt64 {
+			c.report(FsckBadDateOverflow, "invalid author/committer line - date causes integer overflow")
+			return false
+		}
+	}
+
+	if end == i || at(end) != ' ' {
+		c.report(FsckBadDate, "invalid author/committer line - bad date")
+		return false
+	}
+
+	i = end + 1
+	if (at(i) != '+' && at(i) != '-') ||
+		!isDigit(at(i+1)) || !isDigit(at(i+2)) || !isDigit(at(i+3)) || !isDigit(at(i+4)) ||
+		at(i+5) != '\n' {
+		c.report(FsckBadTimezone, "invalid author/committer line - bad time zone")
+		return false
+	}
+
+	return true
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// fsckTreeReports are the problems reported once per tree, in git's order.
+var fsckTreeReports = []fsckReport{
+	{FsckNullSha1, "contains entries pointing to null sha1"},
+	{FsckFullPathname, "contains full pathnames"},
+	{FsckEmptyName, "contains empty pathname"},
+	{FsckHasDot, "contains '.'"},
+	{FsckHasDotdot, "contains '..'"},
+	{FsckHasDotgit, "contains '.git'"},
+	{FsckZeroPaddedFilemode, "contains zero-padded file modes"},
+	{FsckBadFilemode, "contains bad file modes"},
+	{FsckDuplicateEntries, "contains duplicate file entries"},
+	{FsckTreeNotSorted, "not properly sorted"},
+}
+
+func (c *fsckChecker) checkTree(data []byte) {
+	found := make(map[FsckMessageID]bool)
+	var prevName []byte
+	var prevMode filemode.FileMode
+	for first := true; len(data) > 0; first = false {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp <= 0 || nul < sp || len(data) < nul+1+c.idSize {
+			c.report(FsckBadTree, "cannot be parsed as a tree")
+			return
+		}
+
+		rawMode, name := data[:sp], data[sp+1:nul]
+		mode, err := strconv.ParseUint(string(rawMode), 8, 32)
+		if err != nil {
+			c.report(FsckBadTree, "cannot be parsed as a tree")
+			return
+		}
+
+		h, _ := plumbing.FromBytes(data[nul+1 : nul+1+c.idSize])
+		data = data[nul+1+c.idSize:]
+
+		fm := filemode.FileMode(mode)
+		switch fm {
+		case filemode.Dir:
+			c.link(h, plumbing.TreeObject)
+		case filemode.Submodule:
+		default:
+			c.link(h, plumbing.BlobObject)
+		}
+
+		found[FsckNullSha1] = found[FsckNullSha1] || h.IsZero()
+		found[FsckFullPathname] = found[FsckFullPathname] || bytes.IndexByte(name, '/') >= 0
+		found[FsckEmptyName] = found[FsckEmptyName] || len(name) == 0
+		found[FsckHasDot] = found[FsckHasDot] || string(name) == "."
+		found[FsckHasDotdot] = found[FsckHasDotdot] || string(name) == ".."
+		found[FsckHasDotgit] = found[FsckHasDotgit] || bytes.EqualFold(name, []byte(".git"))
+		found[FsckZeroPaddedFilemode] = found[FsckZeroPaddedFilemode] || rawMode[0] == '0'
+
+		switch fm {
+		case filemode.Regular, filemode.Executable, filemode.Deprecated,
+			filemode.Symlink, filemode.Dir, filemode.Submodule:
+		default:
+			found[FsckBadFilemode] = true
+		}
+
+		if !first {
+			switch verifyTreeOrder(prevMode, prevName, fm, name) {
+			case FsckDuplicateEntries:
+				found[FsckDuplicateEntries] = true
+			case FsckTreeNotSorted:
+				found[FsckTreeNotSorted] = true
+			}
+		}
+
+		prevName, prevMode = name, fm
+	}
+
+	for _, r := range fsckTreeReports {
+		if found[r.id] {
+			c.report(r.id, "%s", r.message)
+		}
+	}
+}
+
+// verifyTreeOrder checks that two consecutive tree entries are sorted the
+// way git sorts them, as if the directories had a trailing slash.
+func verifyTreeOrder(mode1 filemode.FileMode, name1 []byte, mode2 filemode.FileMode, name2 []byte) FsckMessageID {
+	n := min(len(name1), len(name2))
+	switch cmp := bytes.Compare(name1[:n], name2[:n]); {
+	case cmp < 0:
+		return ""
+	case cmp > 0:
+		return FsckTreeNotSorted
+	}
+
+	var c1, c2 byte
+	if n < len(name1) {
+		c1 = name1[n]
+	}
+
+	if n < len(name2) {
+		c2 = name2[n]
+	}
+
+	if c1 == 0 && c2 == 0 {
+		return FsckDuplicateEntries
+	}
+
+	if c1 == 0 && mode1 == filemode.Dir {
+		c1 = '/'
+	}
+
+	if c2 == 0 && mode2 == filemode.Dir {
+		c2 = '/'
+	}
+
+	if c1 < c2 {
+		return ""
+	}
+
+	return FsckTreeNotSorted
+}
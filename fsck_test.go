@@ -0,0 +1,292 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+)
+
+type FsckSuite struct {
+	BaseSuite
+}
+
+func TestFsckSuite(t *testing.T) {
+	suite.Run(t, new(FsckSuite))
+}
+
+// setRawObject stores an object with the given content, referenced by a
+// tag so it's reachable.
+func (s *FsckSuite) setRawObject(r *Repository, t plumbing.ObjectType, content string) plumbing.Hash {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(t)
+	w, err := obj.Writer()
+	s.Require().NoError(err)
+	_, err = w.Write([]byte(content))
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	h, err := r.Storer.SetEncodedObject(obj)
+	s.Require().NoError(err)
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(h.String()), h)))
+
+	return h
+}
+
+func (s *FsckSuite) problems(res *FsckResult, h plumbing.Hash) []FsckMessageID {
+	var ids []FsckMessageID
+	for _, p := range res.Problems {
+		if p.Object == h {
+			ids = append(ids, p.ID)
+		}
+	}
+
+	return ids
+}
+
+func (s *FsckSuite) TestFsck() {
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.Require().NoError(err)
+
+	res, err := r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.False(res.HasErrors())
+	s.Empty(res.Problems)
+	s.Empty(res.Corrupted)
+	s.Empty(res.Missing)
+	s.Empty(res.Dangling)
+}
+
+func (s *FsckSuite) TestFsckDangling() {
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, nil)
+	s.Require().NoError(err)
+
+	s.Require().NoError(sto.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master)))
+	s.Require().NoError(sto.RemoveReference("refs/heads/v4"))
+	s.Require().NoError(sto.RemoveReference("refs/remotes/origin/v4"))
+
+	// The v4 branch is still referenced by the reflogs.
+	res, err := r.Fsck(FsckOptions{ConnectivityOnly: true})
+	s.Require().NoError(err)
+	s.Empty(res.Dangling)
+
+	res, err = r.Fsck(FsckOptions{ConnectivityOnly: true, NoReflogs: true})
+	s.Require().NoError(err)
+	s.False(res.HasErrors())
+	s.Equal([]FsckObject{{Hash: plumbing.NewHash(gcV4Commit), Type: plumbing.CommitObject}}, res.Dangling)
+}
+
+func (s *FsckSuite) TestFsckMissing() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+
+	tree := plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	parent := plumbing.NewHash("0000000000000000000000000000000000000001")
+	h := s.setRawObject(r, plumbing.CommitObject, fmt.Sprintf(
+		"tree %s\nparent %s\nauthor A <a@example.com> 1234567890 +0000\ncommitter C <c@example.com> 1234567890 +0000\n\nmessage\n",
+		tree, parent,
+	))
+
+	res, err := r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.True(res.HasErrors())
+	s.Empty(res.Problems)
+	s.Empty(res.Dangling)
+	s.Equal([]FsckObject{
+		{Hash: parent, Type: plumbing.CommitObject},
+		{Hash: tree, Type: plumbing.TreeObject},
+	}, res.Missing)
+
+	// The parents of the shallow commits aren't needed.
+	s.Require().NoError(r.Storer.SetShallow([]plumbing.Hash{h}))
+	res, err = r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.Equal([]FsckObject{{Hash: tree, Type: plumbing.TreeObject}}, res.Missing)
+}
+
+func (s *FsckSuite) TestFsckPartialClone() {
+	dir := s.T().TempDir()
+	r, err := PlainClone(dir, &CloneOptions{
+		URL:    s.GetBasicFilterLocalRepositoryURL(),
+		Bare:   true,
+		Filter: packp.FilterBlobNone(),
+	})
+	s.Require().NoError(err)
+
+	// The blobs missing from the promisor packfile aren't reported.
+	res, err := r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.False(res.HasErrors())
+	s.Empty(res.Missing)
+
+	// They are once the repository isn't a partial clone anymore.
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Extensions.PartialClone = ""
+	cfg.Raw.Section("extensions").RemoveOption("partialclone")
+	s.Require().NoError(r.SetConfig(cfg))
+
+	r, err = PlainOpen(dir)
+	s.Require().NoError(err)
+	res, err = r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.True(res.HasErrors())
+	s.NotEmpty(res.Missing)
+}
+
+func (s *FsckSuite) TestFsckCommit() {
+	const tree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	for content, expected := range map[string][]FsckMessageID{
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                            nil,
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\ncommitter C <c@d> 01234 +0000\n\nmsg\n":                           {FsckZeroPaddedDate},
+		"tree " + tree + "\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                                                       {FsckMissingAuthor},
+		"tree " + tree + "\nauthor A<a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                             {FsckMissingSpaceBeforeEmail},
+		"tree " + tree + "\nauthor A <a@b> 1234 +00x0\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                            {FsckBadTimezone},
+		"tree " + tree + "\nauthor A <a@b> 99999999999999999999999 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":         {FsckBadDateOverflow},
+		"tree " + tree + "\nauthor A <a@b> soon +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                            {FsckBadDate},
+		"tree " + tree + "\nauthor <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                              {FsckMissingNameBeforeEmail},
+		"tree " + tree + "\nauthor A > 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                                {FsckBadName},
+		"tree " + tree + "\nauthor A 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                                  {FsckMissingEmail},
+		"tree " + tree + "\nauthor A <a@b 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                             {FsckBadEmail},
+		"tree " + tree + "\nauthor A <a@b>1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                             {FsckMissingSpaceBeforeDate},
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\nauthor B <b@c> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n": {FsckMultipleAuthors},
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\n\nmsg\n":                                                          {FsckMissingCommitter},
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\x00\n":                        {FsckNulInCommit},
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000":                                     {FsckUnterminatedHeader},
+		"tree " + tree + "\nauthor A <a@b> 1234 +0000\x00\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                        {FsckNulInHeader},
+		"tree 4b825dc6\nauthor A <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                                {FsckBadTreeSha1},
+		"author A <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                                               {FsckMissingTree},
+		"tree " + tree + "\nparent 12\nauthor A <a@b> 1234 +0000\ncommitter C <c@d> 1234 +0000\n\nmsg\n":                 {FsckBadParentSha1},
+	} {
+		r, err := Init(memory.NewStorage())
+		s.Require().NoError(err)
+		s.setRawObject(r, plumbing.TreeObject, "")
+		h := s.setRawObject(r, plumbing.CommitObject, content)
+
+		res, err := r.Fsck(FsckOptions{})
+		s.Require().NoError(err)
+		s.Equal(expected, s.problems(res, h), content)
+	}
+}
+
+func (s *FsckSuite) TestFsckTag() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	blob := s.setRawObject(r, plumbing.BlobObject, "hello\n")
+
+	for content, expected := range map[string][]FsckMessageID{
+		"object %s\ntype blob\ntag v1\ntagger T <t@t> 1234 +0000\n\nmsg\n":  nil,
+		"object %s\ntype blob\ntag bad..name\n\nmsg\n":                      {FsckBadTagName, FsckMissingTaggerEntry},
+		"object %s\ntype blub\ntag v1\ntagger T <t@t> 1234 +0000\n\nmsg\n":  {FsckBadType},
+		"object %s\ntag v1\ntagger T <t@t> 1234 +0000\n\nmsg\n":             {FsckMissingTypeEntry},
+		"object %s\ntype blob\ntagger T <t@t> 1234 +0000\n\nmsg\n":          {FsckMissingTagEntry},
+		"object %s\ntype blob\ntag v1\ntagger T <t@t> 1234 0000\n\nmsg\n":   {FsckBadTimezone},
+		"type blob\ntag v1\ntagger T <t@t> 1234 +0000\n\nmsg\n%s":           {FsckMissingObject},
+		"object %s0\ntype blob\ntag v1\ntagger T <t@t> 1234 +0000\n\nmsg\n": {FsckBadObjectSha1},
+	} {
+		h := s.setRawObject(r, plumbing.TagObject, fmt.Sprintf(content, blob))
+
+		res, err := r.Fsck(FsckOptions{})
+		s.Require().NoError(err)
+		s.Equal(expected, s.problems(res, h), content)
+	}
+}
+
+func (s *FsckSuite) TestFsckTree() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	blob := s.setRawObject(r, plumbing.BlobObject, "hello\n")
+	tree := s.setRawObject(r, plumbing.TreeObject, "")
+
+	entry := func(mode, name string, h plumbing.Hash) string {
+		return mode + " " + name + "\x00" + string(h.Bytes())
+	}
+
+	for content, expected := range map[string][]FsckMessageID{
+		entry("100644", "a", blob) + entry("40000", "a-", tree) + entry("40000", "b", tree): nil,
+		entry("40000", "a", tree) + entry("100644", "a-", blob):                             {FsckTreeNotSorted},
+		entry("100644", "b", blob) + entry("100644", "a", blob):                             {FsckTreeNotSorted},
+		entry("100644", "a", blob) + entry("100644", "a", blob):                             {FsckDuplicateEntries},
+		entry("100644", "a", blob) + entry("40000", "a", tree):                              {FsckDuplicateEntries},
+		entry("100600", "a", blob):                                                          {FsckBadFilemode},
+		entry("0100644", "a", blob):                                                         {FsckZeroPaddedFilemode},
+		entry("100644", ".git", blob):                                                       {FsckHasDotgit},
+		entry("100644", ".GIT", blob):                                                       {FsckHasDotgit},
+		entry("100644", ".", blob) + entry("100644", "..", blob):                            {FsckHasDot, FsckHasDotdot},
+		entry("100644", "", blob):                                                           {FsckEmptyName},
+		entry("100644", "a/b", blob):                                                        {FsckFullPathname},
+		entry("100644", "a", plumbing.ZeroHash):                                             {FsckNullSha1},
+		entry("100644", "a", blob)[:10]:                                                     {FsckBadTree},
+		"a" + entry("100644", "a", blob):                                                    {FsckBadTree},
+	} {
+		h := s.setRawObject(r, plumbing.TreeObject, content)
+
+		res, err := r.Fsck(FsckOptions{})
+		s.Require().NoError(err)
+		s.Equal(expected, s.problems(res, h), content)
+	}
+}
+
+func (s *FsckSuite) TestFsckConfig() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	h := s.setRawObject(r, plumbing.CommitObject,
+		"tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\ncommitter C <c@d> 1234 +0000\n\nmsg\n")
+
+	res, err := r.Fsck(FsckOptions{ConnectivityOnly: true})
+	s.Require().NoError(err)
+	s.Empty(res.Problems)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section(fsckSection).SetOption("missingauthor", "warn")
+	s.Require().NoError(r.SetConfig(cfg))
+
+	res, err = r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.Require().Len(res.Problems, 1)
+	s.Equal(FsckWarn, res.Problems[0].Severity)
+	s.Equal(fmt.Sprintf("warning in commit %s: missingAuthor: invalid format - expected 'author' line", h), res.Problems[0].String())
+
+	cfg.Raw.Section(fsckSection).SetOption("missingauthor", "ignore")
+	s.Require().NoError(r.SetConfig(cfg))
+	res, err = r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.Empty(res.Problems)
+
+	cfg.Raw.Section(fsckSection).SetOption("missingauthor", "maybe")
+	s.Require().NoError(r.SetConfig(cfg))
+	_, err = r.Fsck(FsckOptions{})
+	s.ErrorContains(err, "fsck.missingauthor")
+}
+
+func (s *FsckSuite) TestFsckCorrupted() {
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.Require().NoError(err)
+
+	// Replace a loose commit by a loose blob.
+	commit := plumbing.NewHash("050621ae3a3f2244191aea0a754921794dc6838c")
+	data, err := util.ReadFile(fs, "objects/00/97821d427a3c3385898eb13b50dcbc8702b8a3")
+	s.Require().NoError(err)
+	s.Require().NoError(fs.Remove("objects/05/0621ae3a3f2244191aea0a754921794dc6838c"))
+	s.Require().NoError(util.WriteFile(fs, "objects/05/0621ae3a3f2244191aea0a754921794dc6838c", data, 0o444))
+
+	res, err := r.Fsck(FsckOptions{})
+	s.Require().NoError(err)
+	s.True(res.HasErrors())
+	s.Require().NotEmpty(res.Corrupted)
+	s.Equal(commit, res.Corrupted[0].Object)
+	s.ErrorContains(res.Corrupted[0].Err, "hash mismatch")
+}
@@ -0,0 +1,399 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/promisor"
+)
+
+const (
+	gcSection              = "gc"
+	gcAutoKey              = "auto"
+	gcAutoPackLimitKey     = "autoPackLimit"
+	gcAggressiveWindowKey  = "aggressiveWindow"
+	gcPruneExpireKey       = "pruneExpire"
+	gcReflogExpireKey      = "reflogExpire"
+	gcWriteCommitGraphKey  = "writeCommitGraph"
+	defaultGCAuto          = 6700
+	defaultGCAutoPackLimit = 50
+	defaultAggressiveWin   = 250
+	defaultPruneExpire     = "2.weeks.ago"
+	defaultReflogExpire    = "90.days.ago"
+)
+
+// GCOptions describes how a garbage collection should be performed.
+type GCOptions struct {
+	// Aggressive looks for deltas among more objects, gc.aggressiveWindow
+	// (250 by default) instead of pack.window, producing a smaller packfile
+	// more slowly.
+	Aggressive bool
+	// Auto only collects the garbage if there are more loose objects than
+	// gc.auto (6700 by default), or more packfiles than gc.autoPackLimit (50
+	// by default). Setting gc.autoPackLimit to 0 disables the packfiles
+	// check, and gc.auto to 0 disables the automatic collection altogether.
+	Auto bool
+	// PruneExpire is the time before which the unreachable objects are
+	// deleted, the ones of newer packfiles being loosened. If zero,
+	// gc.pruneExpire is used, two weeks ago by default.
+	PruneExpire time.Time
+}
+
+// gcConfig is the gc section of the configuration.
+type gcConfig struct {
+	auto             int
+	autoPackLimit    int
+	aggressiveWindow uint
+	// pruneExpire and reflogExpire are zero if they never expire.
+	pruneExpire      time.Time
+	reflogExpire     time.Time
+	writeCommitGraph bool
+}
+
+func newGCConfig(cfg *config.Config, now time.Time) (*gcConfig, error) {
+	s := cfg.Raw.Section(gcSection)
+	c := &gcConfig{
+		auto:             defaultGCAuto,
+		autoPackLimit:    defaultGCAutoPackLimit,
+		aggressiveWindow: defaultAggressiveWin,
+		writeCommitGraph: true,
+	}
+
+	for key, n := range map[string]*int{gcAutoKey: &c.auto, gcAutoPackLimitKey: &c.autoPackLimit} {
+		if v := s.Options.Get(key); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s.%s: %q", gcSection, key, v)
+			}
+
+			*n = i
+		}
+	}
+
+	if v := s.Options.Get(gcAggressiveWindowKey); v != "" {
+		w, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s.%s: %q", gcSection, gcAggressiveWindowKey, v)
+		}
+
+		c.aggressiveWindow = uint(w)
+	}
+
+	for key, t := range map[string]*time.Time{gcPruneExpireKey: &c.pruneExpire, gcReflogExpireKey: &c.reflogExpire} {
+		v := s.Options.Get(key)
+		if v == "" {
+			v = defaultPruneExpire
+			if key == gcReflogExpireKey {
+				v = defaultReflogExpire
+			}
+		}
+
+		expire, err := parseExpiry(v, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s.%s: %q", gcSection, key, v)
+		}
+
+		*t = expire
+	}
+
+	switch v := s.Options.Get(gcWriteCommitGraphKey); strings.ToLower(v) {
+	case "", "true", "yes", "on", "1":
+	case "false", "no", "off", "0":
+		c.writeCommitGraph = false
+	default:
+		return nil, fmt.Errorf("invalid %s.%s: %q", gcSection, gcWriteCommitGraphKey, v)
+	}
+
+	return c, nil
+}
+
+var errInvalidExpiry = errors.New("invalid expiry date")
+
+// expiryUnits are the units of the relative expiry dates.
+var expiryUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// parseExpiry parses an expiry date of the configuration relative to now,
+// such as "2.weeks.ago", "now", "never" or "2006-01-02". The zero time is
+// returned if it never expires.
+func parseExpiry(v string, now time.Time) (time.Time, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		return now, nil
+	}
+
+	fields := strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		unit, ok := expiryUnits[strings.TrimSuffix(fields[1], "s")]
+		if err != nil || !ok || n < 0 {
+			return time.Time{}, errInvalidExpiry
+		}
+
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errInvalidExpiry
+}
+
+// GC collects the garbage of the repository, like git gc. The references
+// are packed, the reflog entries older than gc.reflogExpire (90 days by
+// default) are expired, and the objects reachable from the references, the
+// reflogs and the index are repacked in a single packfile, along with a
+// commit-graph unless gc.writeCommitGraph is false. The unreachable objects
+// of the packfiles newer than the prune expiry date are written as loose
+// objects, and the unreachable loose objects older than it are deleted. In
+// a partial clone, the missing objects aren't fetched, and the packfiles
+// received from the promisor remote are kept.
+func (r *Repository) GC(o GCOptions) error {
+	pos, ok := baseStorer(r.Storer).(storer.PackedObjectStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	gc, err := newGCConfig(cfg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if o.Auto {
+		if needed, err := r.needsGC(pos, gc); err != nil || !needed {
+			return err
+		}
+	}
+
+	if err := r.Storer.PackRefs(); err != nil {
+		return err
+	}
+
+	if err := r.expireReflogs(gc.reflogExpire); err != nil {
+		return err
+	}
+
+	// The objects of a partial clone are walked without fetching the
+	// missing ones, which are promised by the remote.
+	ow := newObjectWalker(baseStorer(r.Storer))
+	_, ow.promisor = r.Storer.(promisor.Storage)
+	if err := ow.walkAllRefs(); err != nil {
+		return err
+	}
+
+	if err := r.walkReflogs(ow); err != nil {
+		return err
+	}
+
+	if err := r.walkIndex(ow); err != nil {
+		return err
+	}
+
+	pack := newPackOptions(cfg)
+	if o.Aggressive {
+		pack.window = gc.aggressiveWindow
+	}
+
+	expire := o.PruneExpire
+	if expire.IsZero() {
+		expire = gc.pruneExpire
+	}
+
+	// Like git gc, the unreachable objects of the packfiles newer than the
+	// prune expiry date are loosened, all of them if they never expire, so
+	// the objects which aren't referenced yet by a concurrent push or fetch
+	// aren't dropped.
+	unpack := expire
+	if unpack.IsZero() {
+		unpack = time.Unix(0, 0)
+	}
+
+	if err := r.repackObjects(&RepackConfig{UnpackUnreachable: unpack}, ow, pack); err != nil {
+		return err
+	}
+
+	if los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer); ok && !expire.IsZero() {
+		err := pruneObjects(los, ow, PruneOptions{
+			OnlyObjectsOlderThan: expire,
+			Handler:              los.DeleteLooseObject,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := baseStorer(r.Storer).(storer.CommitGraphStorer); ok && gc.writeCommitGraph {
+		return r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true})
+	}
+
+	return nil
+}
+
+// needsGC returns true if there are too many loose objects or packfiles,
+// according to gc.auto and gc.autoPackLimit.
+func (r *Repository) needsGC(pos storer.PackedObjectStorer, gc *gcConfig) (bool, error) {
+	if gc.auto <= 0 {
+		return false, nil
+	}
+
+	if gc.autoPackLimit > 0 {
+		packs, err := pos.ObjectPacks()
+		if err != nil {
+			return false, err
+		}
+
+		if len(packs) > gc.autoPackLimit {
+			return true, nil
+		}
+	}
+
+	los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer)
+	if !ok {
+		return false, nil
+	}
+
+	var loose int
+	err := los.ForEachObjectHash(func(plumbing.Hash) error {
+		loose++
+		if loose > gc.auto {
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil && err != storer.ErrStop {
+		return false, err
+	}
+
+	return loose > gc.auto, nil
+}
+
+// expireReflogs removes the reflog entries older than expire, unless it's
+// zero.
+func (r *Repository) expireReflogs(expire time.Time) error {
+	rs, ok := baseStorer(r.Storer).(storer.ReflogStorer)
+	if !ok || expire.IsZero() {
+		return nil
+	}
+
+	names, err := rs.Reflogs()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		entries, err := rs.Reflog(name)
+		if err != nil {
+			return err
+		}
+
+		kept := make([]*reflog.Entry, 0, len(entries))
+		for _, e := range entries {
+			if !e.When.Before(expire) {
+				kept = append(kept, e)
+			}
+		}
+
+		if len(kept) == len(entries) {
+			continue
+		}
+
+		if err := rs.SetReflog(name, kept); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkReflogs walks the objects recorded by the reflogs which still exist.
+func (r *Repository) walkReflogs(ow *objectWalker) error {
+	rs, ok := baseStorer(r.Storer).(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	names, err := rs.Reflogs()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		entries, err := rs.Reflog(name)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			for _, h := range []plumbing.Hash{e.Old, e.New} {
+				if err := r.walkIfExists(ow, h); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkIndex walks the blobs of the index which exist.
+func (r *Repository) walkIndex(ow *objectWalker) error {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := r.walkIfExists(ow, e.Hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) walkIfExists(ow *objectWalker, h plumbing.Hash) error {
+	if h.IsZero() || ow.isSeen(h) {
+		return nil
+	}
+
+	if err := ow.Storer.HasEncodedObject(h); err != nil {
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	return ow.walkObjectTree(h)
+}
@@ -0,0 +1,315 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+)
+
+const (
+	gcMasterCommit = "320cb470e3e2998b215a4b1744ce5afb7de3ba5d"
+	gcV4Commit     = "e8788ad9165781196e917292d6055cba1d78664e"
+)
+
+type GCSuite struct {
+	BaseSuite
+}
+
+func TestGCSuite(t *testing.T) {
+	suite.Run(t, new(GCSuite))
+}
+
+// openGC opens the unpacked fixture, whose v4 branch is only referenced by
+// the reflogs once removed, with the given gc options.
+func (s *GCSuite) openGC(options map[string]string) (billy.Filesystem, *Repository) {
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, fs)
+	s.Require().NoError(err)
+
+	s.Require().NoError(sto.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master)))
+	s.Require().NoError(sto.RemoveReference("refs/heads/v4"))
+	s.Require().NoError(sto.RemoveReference("refs/remotes/origin/v4"))
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	for k, v := range options {
+		cfg.Raw.Section(gcSection).SetOption(k, v)
+	}
+	s.Require().NoError(r.SetConfig(cfg))
+
+	return fs, r
+}
+
+func (s *GCSuite) looseObjects(fs billy.Filesystem) int {
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	var count int
+	s.Require().NoError(sto.ForEachObjectHash(func(plumbing.Hash) error {
+		count++
+		return nil
+	}))
+
+	return count
+}
+
+func (s *GCSuite) looseHashes(fs billy.Filesystem) map[plumbing.Hash]bool {
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	hashes := make(map[plumbing.Hash]bool)
+	s.Require().NoError(sto.ForEachObjectHash(func(h plumbing.Hash) error {
+		hashes[h] = true
+		return nil
+	}))
+
+	return hashes
+}
+
+func (s *GCSuite) TestGC() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fs, r := s.openGC(nil)
+	s.Require().NoError(r.GC(GCOptions{PruneExpire: time.Now().Add(time.Hour)}))
+
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	s.Zero(s.looseObjects(fs))
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Len(packs, 1)
+
+	loose, err := sto.CountLooseRefs()
+	s.Require().NoError(err)
+	s.Zero(loose)
+
+	// The reflog entries are older than 90 days.
+	entries, err := sto.Reflog(plumbing.HEAD)
+	s.Require().NoError(err)
+	s.Empty(entries)
+
+	s.NoError(sto.HasEncodedObject(plumbing.NewHash(gcMasterCommit)))
+	s.ErrorIs(sto.HasEncodedObject(plumbing.NewHash(gcV4Commit)), plumbing.ErrObjectNotFound)
+
+	cg, err := sto.CommitGraph()
+	s.Require().NoError(err)
+	s.Require().NotNil(cg)
+	defer cg.Close()
+	_, err = cg.GetIndexByHash(plumbing.NewHash(gcMasterCommit))
+	s.NoError(err)
+	_, err = cg.GetIndexByHash(plumbing.NewHash(gcV4Commit))
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+}
+
+func (s *GCSuite) TestGCPlainOpen() {
+	url := s.GetBasicLocalRepositoryURL()
+	dir := s.T().TempDir()
+	_, err := PlainClone(dir, &CloneOptions{URL: url})
+	s.Require().NoError(err)
+
+	r, err := PlainOpen(dir)
+	s.Require().NoError(err)
+	s.Require().NoError(r.GC(GCOptions{}))
+
+	r, err = PlainOpen(dir)
+	s.Require().NoError(err)
+
+	loose, err := r.Storer.CountLooseRefs()
+	s.Require().NoError(err)
+	s.Zero(loose)
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	_, err = r.CommitObject(head.Hash())
+	s.NoError(err)
+}
+
+func (s *GCSuite) TestGCPartialClone() {
+	dir := s.T().TempDir()
+	_, err := PlainClone(dir, &CloneOptions{
+		URL:    s.GetBasicFilterLocalRepositoryURL(),
+		Bare:   true,
+		Filter: packp.FilterBlobNone(),
+	})
+	s.Require().NoError(err)
+
+	promisors, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "pack-*.promisor"))
+	s.Require().NoError(err)
+	s.Require().Len(promisors, 1)
+
+	r, err := PlainOpen(dir)
+	s.Require().NoError(err)
+
+	// A blob fetched lazily, in a promisor pack as well.
+	blob := plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d")
+	_, err = r.BlobObject(blob)
+	s.Require().NoError(err)
+
+	s.Require().NoError(r.GC(GCOptions{}))
+
+	// The promisor packs are kept, and the missing blobs aren't fetched.
+	after, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "pack-*.promisor"))
+	s.Require().NoError(err)
+	s.Len(after, 2)
+	s.Contains(after, promisors[0])
+
+	sto := filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	s.NoError(sto.HasEncodedObject(blob))
+	s.ErrorIs(sto.HasEncodedObject(plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492")), plumbing.ErrObjectNotFound)
+	s.NoError(sto.HasEncodedObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")))
+}
+
+func (s *GCSuite) TestGCReflogs() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fs, r := s.openGC(map[string]string{
+		gcReflogExpireKey:     "never",
+		gcWriteCommitGraphKey: "false",
+	})
+	s.Require().NoError(r.GC(GCOptions{Aggressive: true, PruneExpire: time.Now().Add(time.Hour)}))
+
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	entries, err := sto.Reflog(plumbing.HEAD)
+	s.Require().NoError(err)
+	s.Len(entries, 25)
+
+	// The v4 branch is still referenced by the reflogs.
+	s.NoError(sto.HasEncodedObject(plumbing.NewHash(gcV4Commit)))
+
+	cg, err := sto.CommitGraph()
+	s.Require().NoError(err)
+	s.Nil(cg)
+}
+
+func (s *GCSuite) TestGCPruneExpire() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fs, r := s.openGC(map[string]string{gcPruneExpireKey: "never"})
+	before := s.looseHashes(fs)
+	s.Require().NoError(r.GC(GCOptions{}))
+
+	// The unreachable objects are kept loose, the reachable ones are packed.
+	after := s.looseHashes(fs)
+	s.NotZero(after)
+	var packed int
+	for h := range before {
+		if !after[h] {
+			packed++
+		}
+	}
+	s.NotZero(packed)
+}
+
+func (s *GCSuite) TestGCAuto() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fs, r := s.openGC(nil)
+	before := s.looseObjects(fs)
+	s.Require().NoError(r.GC(GCOptions{Auto: true}))
+	s.Equal(before, s.looseObjects(fs))
+
+	fs, r = s.openGC(map[string]string{gcAutoPackLimitKey: "1"})
+	s.Require().NoError(r.GC(GCOptions{Auto: true}))
+	packs, err := filesystem.NewStorage(fs, cache.NewObjectLRUDefault()).ObjectPacks()
+	s.Require().NoError(err)
+	s.Len(packs, 1)
+
+	fs, r = s.openGC(map[string]string{gcAutoKey: "0", gcAutoPackLimitKey: "1"})
+	s.Require().NoError(r.GC(GCOptions{Auto: true}))
+	s.Equal(before, s.looseObjects(fs))
+
+	_, r = s.openGC(map[string]string{gcAutoKey: "many"})
+	s.ErrorContains(r.GC(GCOptions{Auto: true}), "gc.auto")
+}
+
+func (s *GCSuite) TestGCNotSupported() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	h, err := r.Storer.SetEncodedObject(obj)
+	s.Require().NoError(err)
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference("refs/tags/blob", h)))
+
+	s.Error(r.GC(GCOptions{}))
+}
+
+func (s *GCSuite) TestParseExpiry() {
+	now := time.Date(2020, 3, 15, 12, 0, 0, 0, time.UTC)
+	for v, expected := range map[string]time.Time{
+		"never":               {},
+		"false":               {},
+		"now":                 now,
+		"all":                 now,
+		"2.weeks.ago":         now.AddDate(0, 0, -14),
+		"1 day ago":           now.AddDate(0, 0, -1),
+		"90.days.ago":         now.AddDate(0, 0, -90),
+		"3.hours.ago":         now.Add(-3 * time.Hour),
+		"2020-01-02":          time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		"2020-01-02 03:04:05": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	} {
+		t, err := parseExpiry(v, now)
+		s.NoError(err, v)
+		s.True(expected.Equal(t), v)
+	}
+
+	for _, v := range []string{"", "soon", "2.fortnights.ago", "-1.days.ago"} {
+		_, err := parseExpiry(v, now)
+		s.ErrorIs(err, errInvalidExpiry, v)
+	}
+}
+
+var _ storer.ReflogStorer = &filesystem.Storage{}
+
+func (s *GCSuite) TestGCUnpackUnreachable() {
+	fs := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, nil)
+	s.Require().NoError(err)
+
+	// The commit of the branch is only packed, and unreachable once the
+	// branch is removed.
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	s.Require().NoError(sto.RemoveReference("refs/heads/branch"))
+	s.Require().NoError(sto.RemoveReference("refs/remotes/origin/branch"))
+	s.Zero(s.looseObjects(fs))
+
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(packs, 1)
+	now := time.Now()
+	path := fs.Join("objects", "pack", "pack-"+packs[0].String()+".pack")
+	s.Require().NoError(os.Chtimes(filepath.Join(fs.Root(), path), now, now))
+
+	// The packfile is newer than the prune expiry date.
+	s.Require().NoError(r.GC(GCOptions{}))
+	s.NotZero(s.looseObjects(fs))
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	s.NoError(sto.HasEncodedObject(branch))
+
+	// The loosened objects are pruned once they expire.
+	r, err = Open(sto, nil)
+	s.Require().NoError(err)
+	s.Require().NoError(r.GC(GCOptions{PruneExpire: time.Now().Add(time.Hour)}))
+	s.Zero(s.looseObjects(fs))
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	s.ErrorIs(sto.HasEncodedObject(branch), plumbing.ErrObjectNotFound)
+}
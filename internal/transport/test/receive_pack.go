@@ -334,7 +334,7 @@ func (s *ReceivePackSuite) checkRemoteReference(ep *transport.Endpoint,
 			break
 		}
 	}
-	if head == plumbing.ZeroHash {
+	if head.IsZero() {
 		s.Require().False(ok)
 	} else {
 		s.Require().True(ok)
@@ -0,0 +1,80 @@
+package url
+
+import (
+	neturl "net/url"
+	"strings"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ssh":   "22",
+	"git":   "9418",
+}
+
+// MatchConfig reports whether the URL of a config subsection, like the ones
+// of http.<url>.* or credential.<url>.*, matches u, following the rules of
+// git:
+//   - the schemes must be equal.
+//   - the hosts must be equal, the labels of the pattern being * matching any
+//     label.
+//   - the ports must be equal, the default one of the scheme being used if
+//     missing.
+//   - the path of the pattern must be a prefix of the one of u, ending at a
+//     slash.
+//   - the user of the pattern, if any, must be equal.
+//
+// The returned specificity is higher for the patterns matching a longer
+// path, or the user, so the most specific ones can be selected.
+func MatchConfig(pattern string, u *neturl.URL) (specificity int, ok bool) {
+	p, err := neturl.Parse(pattern)
+	if err != nil || p.Scheme == "" || p.Host == "" {
+		return 0, false
+	}
+
+	if !strings.EqualFold(p.Scheme, u.Scheme) ||
+		!matchHost(p.Hostname(), u.Hostname()) ||
+		port(p) != port(u) {
+		return 0, false
+	}
+
+	path := strings.TrimSuffix(p.Path, "/")
+	if path != "" && u.Path != path && !strings.HasPrefix(u.Path, path+"/") {
+		return 0, false
+	}
+
+	specificity = 2 * len(path)
+	if p.User != nil {
+		if u.User == nil || p.User.Username() != u.User.Username() {
+			return 0, false
+		}
+
+		specificity++
+	}
+
+	return specificity, true
+}
+
+func matchHost(pattern, host string) bool {
+	pl := strings.Split(strings.ToLower(pattern), ".")
+	hl := strings.Split(strings.ToLower(host), ".")
+	if len(pl) != len(hl) {
+		return false
+	}
+
+	for i := range pl {
+		if pl[i] != "*" && pl[i] != hl[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func port(u *neturl.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+
+	return defaultPorts[strings.ToLower(u.Scheme)]
+}
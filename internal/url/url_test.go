@@ -1,6 +1,7 @@
 package url
 
 import (
+	neturl "net/url"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -102,3 +103,36 @@ func (s *URLSuite) TestFindScpLikeComponents() {
 		s.Equal(tc.path, path, tc.url)
 	}
 }
+
+func (s *URLSuite) TestMatchConfig() {
+	u, err := neturl.Parse("https://user@git.example.com/org/repo.git")
+	s.Require().NoError(err)
+
+	for pattern, specificity := range map[string]int{
+		"https://git.example.com":              0,
+		"https://git.example.com:443/":         0,
+		"https://*.example.com":                0,
+		"https://git.example.com/org":          8,
+		"https://git.example.com/org/":         8,
+		"https://user@git.example.com/org":     9,
+		"https://git.example.com/org/repo.git": 26,
+	} {
+		got, ok := MatchConfig(pattern, u)
+		s.True(ok, pattern)
+		s.Equal(specificity, got, pattern)
+	}
+
+	for _, pattern := range []string{
+		"http://git.example.com",
+		"https://example.com",
+		"https://*.com",
+		"https://git.example.com:8443",
+		"https://git.example.com/or",
+		"https://git.example.com/other",
+		"https://other@git.example.com",
+		"git.example.com",
+	} {
+		_, ok := MatchConfig(pattern, u)
+		s.False(ok, pattern)
+	}
+}
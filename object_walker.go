@@ -1,6 +1,7 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/go-git/go-git/v6/plumbing"
@@ -15,10 +16,13 @@ type objectWalker struct {
 	// seen map can become huge if walking over large
 	// repos. Thus using struct{} as the value type.
 	seen map[plumbing.Hash]struct{}
+	// promisor skips the missing objects instead of failing, as they are
+	// promised by the promisor remote of a partial clone.
+	promisor bool
 }
 
 func newObjectWalker(s storage.Storer) *objectWalker {
-	return &objectWalker{s, map[plumbing.Hash]struct{}{}}
+	return &objectWalker{Storer: s, seen: map[plumbing.Hash]struct{}{}}
 }
 
 // walkAllRefs walks all (hash) references from the repo.
@@ -48,6 +52,22 @@ func (p *objectWalker) add(hash plumbing.Hash) {
 	p.seen[hash] = struct{}{}
 }
 
+// addBlob remembers the blob hash, unless it's a missing promisor object.
+func (p *objectWalker) addBlob(hash plumbing.Hash) error {
+	if p.promisor && !p.isSeen(hash) {
+		err := p.Storer.HasEncodedObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	p.add(hash)
+	return nil
+}
+
 // walkObjectTree walks over all objects and remembers references
 // to them in the objectWalker. This is used instead of the revlist
 // walks because memory usage is tight with huge repos.
@@ -59,6 +79,10 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 	p.add(hash)
 	// Fetch the object.
 	obj, err := object.GetObject(p.Storer, hash)
+	if p.promisor && errors.Is(err, plumbing.ErrObjectNotFound) {
+		delete(p.seen, hash)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("getting object %s failed: %v", hash, err)
 	}
@@ -85,7 +109,9 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 			// Other non-tree objects are somewhat rare, so they
 			// are not special-cased.
 			if obj.Entries[i].Mode|0755 == filemode.Executable {
-				p.add(obj.Entries[i].Hash)
+				if err := p.addBlob(obj.Entries[i].Hash); err != nil {
+					return err
+				}
 				continue
 			}
 			// Normal walk for sub-trees (and symlinks etc).
@@ -96,6 +122,8 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 		}
 	case *object.Tag:
 		return p.walkObjectTree(obj.Target)
+	case *object.Blob:
+		// Blobs have no children, e.g. the ones of the index.
 	default:
 		// Error out on unhandled object types.
 		return fmt.Errorf("unknown object %X %s %T", obj.ID(), obj.Type(), obj)
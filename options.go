@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -10,7 +11,9 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/archive"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v6/plumbing/transport"
@@ -30,7 +33,10 @@ const (
 	DefaultSubmoduleRecursionDepth SubmoduleRecursivity = 10
 )
 
-var ErrMissingURL = errors.New("URL field is required")
+var (
+	ErrMissingURL     = errors.New("URL field is required")
+	ErrMissingTreeish = errors.New("treeish field is required")
+)
 
 // CloneOptions describes how a clone should be performed.
 type CloneOptions struct {
@@ -66,6 +72,9 @@ type CloneOptions struct {
 	// Progress is where the human readable information sent by the server is
 	// stored, if nil nothing is stored and the capability (if supported)
 	// no-progress, is sent to the server to avoid send this information.
+	// When it implements progress.Reporter, such as a
+	// sideband.ProgressWriter, the progress of the local indexing of the
+	// packfile and of the checkout is reported to it too.
 	Progress sideband.Progress
 	// Tags describe how the tags will be fetched from the remote repository,
 	// by default is AllTags.
@@ -153,6 +162,9 @@ type PullOptions struct {
 	// Progress is where the human readable information sent by the server is
 	// stored, if nil nothing is stored and the capability (if supported)
 	// no-progress, is sent to the server to avoid send this information.
+	// When it implements progress.Reporter, such as a
+	// sideband.ProgressWriter, the progress of the local indexing of the
+	// packfile and of the checkout is reported to it too.
 	Progress sideband.Progress
 	// Force allows the pull to update a local branch even when the remote
 	// branch does not descend from it.
@@ -206,6 +218,9 @@ type FetchOptions struct {
 	// Progress is where the human readable information sent by the server is
 	// stored, if nil nothing is stored and the capability (if supported)
 	// no-progress, is sent to the server to avoid send this information.
+	// When it implements progress.Reporter, such as a
+	// sideband.ProgressWriter, the progress of the local indexing of the
+	// packfile is reported to it too.
 	Progress sideband.Progress
 	// Tags describe how the tags will be fetched from the remote repository,
 	// by default is TagFollowing.
@@ -290,6 +305,11 @@ type PushOptions struct {
 	Atomic bool
 	// ProxyOptions provides info required for connecting to a proxy.
 	ProxyOptions transport.ProxyOptions
+	// SignedPush, when set, is used to sign a push certificate that is sent
+	// to the server along with the reference updates. The pusher identity is
+	// taken from the committer or user configuration. The push fails if the
+	// server does not support push-cert.
+	SignedPush Signer
 }
 
 // ForceWithLease sets fields on the lease
@@ -369,6 +389,9 @@ type CheckoutOptions struct {
 	Keep bool
 	// SparseCheckoutDirectories
 	SparseCheckoutDirectories []string
+	// Progress, if not nil, is notified of the progress of the checkout of
+	// the files.
+	Progress progress.Reporter
 }
 
 // Validate validates the fields and sets the default values.
@@ -431,11 +454,15 @@ type ResetOptions struct {
 
 	// SkipSparseDirValidation will skip the validation for SparseDirs.
 	SkipSparseDirValidation bool
+
+	// Progress, if not nil, is notified of the progress of the checkout of
+	// the files.
+	Progress progress.Reporter
 }
 
 // Validate validates the fields and sets the default values.
 func (o *ResetOptions) Validate(r *Repository) error {
-	if o.Commit == plumbing.ZeroHash {
+	if o.Commit.IsZero() {
 		ref, err := r.Head()
 		if err != nil {
 			return err
@@ -564,6 +591,9 @@ type CommitOptions struct {
 	// Amend will create a new commit object and replace the commit that HEAD currently
 	// points to. Cannot be used with All nor Parents.
 	Amend bool
+	// WriteCommitGraph adds the new commit to the commit-graph chain, as
+	// Repository.WriteCommitGraph does with the Reachable and Split options.
+	WriteCommitGraph bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -721,6 +751,46 @@ type ListOptions struct {
 	Timeout int
 }
 
+// ArchiveOptions describes how a remote archive should be requested.
+type ArchiveOptions struct {
+	// Treeish is the tree, commit or tag to archive, optionally followed by
+	// a colon and a path, e.g. "main:docs". Unless the server allows
+	// unreachable objects, it must be a reference name.
+	Treeish string
+	// Format is the archive format, defaults to tar.
+	Format archive.Format
+	// Prefix is prepended to every path in the archive.
+	Prefix string
+	// Paths restricts the archive to the given paths.
+	Paths []string
+	// CompressionLevel is the compression level, see [archive.Options].
+	CompressionLevel int
+	// Auth credentials, if required, to use with the remote repository.
+	Auth transport.AuthMethod
+	// Progress is where the human readable information sent by the server is
+	// stored, if nil nothing is stored.
+	Progress sideband.Progress
+	// InsecureSkipTLS skips ssl verify if protocol is https
+	InsecureSkipTLS bool
+	// CABundle specify additional ca bundle with system cert pool
+	CABundle []byte
+	// ProxyOptions provides info required for connecting to a proxy.
+	ProxyOptions transport.ProxyOptions
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ArchiveOptions) Validate() error {
+	if o.Treeish == "" {
+		return ErrMissingTreeish
+	}
+
+	if _, err := archive.ParseFormat(string(o.Format)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // PeelingOption represents the different ways to handle peeled references.
 //
 // Peeled references represent the underlying object of an annotated
@@ -797,6 +867,21 @@ type PlainOpenOptions struct {
 // Validate validates the fields and sets the default values.
 func (o *PlainOpenOptions) Validate() error { return nil }
 
+// PromisorOptions describes how the objects missing from a partial clone are
+// fetched from its promisor remote.
+type PromisorOptions struct {
+	// Context is the context of the fetches, context.Background() if nil.
+	Context context.Context
+	// Auth credentials, if required, to use with the promisor remote.
+	Auth transport.AuthMethod
+	// InsecureSkipTLS skips ssl verify if protocol is https
+	InsecureSkipTLS bool
+	// CABundle specify additional ca bundle with system cert pool
+	CABundle []byte
+	// ProxyOptions provides info required for connecting to a proxy.
+	ProxyOptions transport.ProxyOptions
+}
+
 var ErrNoRestorePaths = errors.New("you must specify path(s) to restore")
 
 // RestoreOptions describes how a restore should be performed.
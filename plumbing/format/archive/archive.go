@@ -0,0 +1,403 @@
+// Package archive implements encoding of git trees as tar and zip archives,
+// compatible with the ones produced by git-archive.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// Format is an archive format.
+type Format string
+
+// Supported archive formats.
+const (
+	Tar   Format = "tar"
+	TarGz Format = "tar.gz"
+	Tgz   Format = "tgz"
+	Zip   Format = "zip"
+)
+
+const (
+	// DefaultCompression uses the default compression level of the format.
+	DefaultCompression = 0
+	// NoCompression stores the files without compressing them.
+	NoCompression = -1
+)
+
+var (
+	// ErrUnsupportedFormat is returned when the archive format is unknown.
+	ErrUnsupportedFormat = errors.New("unsupported archive format")
+	// ErrInvalidCompressionLevel is returned when the compression level is
+	// out of range.
+	ErrInvalidCompressionLevel = errors.New("invalid compression level")
+)
+
+// Formats returns the list of supported formats.
+func Formats() []Format {
+	return []Format{Tar, TarGz, Tgz, Zip}
+}
+
+// ParseFormat parses the given format name. An empty name defaults to Tar.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return Tar, nil
+	}
+
+	for _, f := range Formats() {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+}
+
+// Options holds the options used to encode an archive.
+type Options struct {
+	// Format is the archive format, defaults to Tar.
+	Format Format
+	// Prefix is prepended to every path in the archive. Like git, a
+	// trailing slash must be included to put the files in a directory.
+	Prefix string
+	// Paths restricts the archive to the given paths, relative to the root
+	// of the tree. All the paths are included when empty.
+	Paths []string
+	// ModTime is the modification time set to all the entries, usually the
+	// committer time. The current time is used when zero.
+	ModTime time.Time
+	// CommitID, when set, is stored in the archive, as a pax global header
+	// in tar archives or as the archive comment in zip archives.
+	CommitID plumbing.Hash
+	// CompressionLevel is the compression level, from 1 (best speed) to 9
+	// (best compression), DefaultCompression or NoCompression.
+	CompressionLevel int
+}
+
+// Encoder writes tree archives to an output stream.
+type Encoder struct {
+	w io.Writer
+	s storer.EncodedObjectStorer
+}
+
+// NewEncoder returns a new Encoder that writes to w, reading the objects
+// from s.
+func NewEncoder(w io.Writer, s storer.EncodedObjectStorer) *Encoder {
+	return &Encoder{w: w, s: s}
+}
+
+// entryWriter is implemented by each archive format.
+type entryWriter interface {
+	writeDir(name string) error
+	writeFile(name string, mode filemode.FileMode, size int64, r io.Reader) error
+	writeSymlink(name, target string) error
+	Close() error
+}
+
+// Encode writes an archive of the given tree.
+func (e *Encoder) Encode(tree *object.Tree, opts *Options) (err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var level int
+	switch l := opts.CompressionLevel; {
+	case l == DefaultCompression:
+		level = flate.DefaultCompression
+	case l == NoCompression:
+		level = flate.NoCompression
+	case l >= flate.BestSpeed && l <= flate.BestCompression:
+		level = l
+	default:
+		return fmt.Errorf("%w: %d", ErrInvalidCompressionLevel, l)
+	}
+
+	modTime := opts.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	var ew entryWriter
+	switch format := opts.Format; format {
+	case "", Tar:
+		ew, err = newTarWriter(e.w, nil, modTime, opts.CommitID)
+	case TarGz, Tgz:
+		var gz *gzip.Writer
+		gz, err = gzip.NewWriterLevel(e.w, level)
+		if err != nil {
+			return err
+		}
+		ew, err = newTarWriter(gz, gz, modTime, opts.CommitID)
+	case Zip:
+		ew, err = newZipWriter(e.w, level, modTime, opts.CommitID)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Prefix != "" && strings.HasSuffix(opts.Prefix, "/") {
+		if err := ew.writeDir(opts.Prefix); err != nil {
+			return err
+		}
+	}
+
+	if err := e.encodeTree(ew, tree, opts); err != nil {
+		_ = ew.Close()
+		return err
+	}
+
+	return ew.Close()
+}
+
+func (e *Encoder) encodeTree(ew entryWriter, tree *object.Tree, opts *Options) error {
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !matchPaths(name, entry.Mode == filemode.Dir, opts.Paths) {
+			continue
+		}
+
+		fullname := opts.Prefix + name
+		switch entry.Mode {
+		case filemode.Dir, filemode.Submodule:
+			err = ew.writeDir(fullname + "/")
+		case filemode.Symlink:
+			err = e.encodeSymlink(ew, fullname, entry.Hash)
+		default:
+			err = e.encodeFile(ew, fullname, entry.Mode, entry.Hash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *Encoder) encodeFile(ew entryWriter, name string, mode filemode.FileMode, h plumbing.Hash) error {
+	obj, err := e.s.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:errcheck
+
+	return ew.writeFile(name, mode, obj.Size(), r)
+}
+
+func (e *Encoder) encodeSymlink(ew entryWriter, name string, h plumbing.Hash) error {
+	obj, err := e.s.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:errcheck
+
+	target, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return ew.writeSymlink(name, string(target))
+}
+
+// matchPaths returns true if name is one of paths, is inside one of them or,
+// for directories, contains one of them.
+func matchPaths(name string, isDir bool, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+
+	for _, p := range paths {
+		p = strings.Trim(path.Clean(p), "/")
+		if p == "." || p == "" || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+
+		if isDir && strings.HasPrefix(p, name+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileMode returns the permissions git uses in archives, which are the ones
+// resulting from applying the default tar.umask of 0002.
+func fileMode(mode filemode.FileMode) int64 {
+	switch mode {
+	case filemode.Executable:
+		return 0o775
+	case filemode.Symlink:
+		return 0o777
+	default:
+		return 0o664
+	}
+}
+
+type tarWriter struct {
+	tw      *tar.Writer
+	c       io.Closer
+	modTime time.Time
+}
+
+func newTarWriter(w io.Writer, c io.Closer, modTime time.Time, commit plumbing.Hash) (*tarWriter, error) {
+	tw := &tarWriter{tw: tar.NewWriter(w), c: c, modTime: modTime}
+	if commit.IsZero() {
+		return tw, nil
+	}
+
+	// Like git, the commit id is stored as a comment in a pax global
+	// header, so it can be retrieved with git get-tar-commit-id.
+	err := tw.tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": commit.String()},
+	})
+
+	return tw, err
+}
+
+func (w *tarWriter) header(name string, typ byte, mode int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: typ,
+		Name:     name,
+		Mode:     mode,
+		ModTime:  w.modTime,
+		Uname:    "root",
+		Gname:    "root",
+	}
+}
+
+func (w *tarWriter) writeDir(name string) error {
+	return w.tw.WriteHeader(w.header(name, tar.TypeDir, 0o775))
+}
+
+func (w *tarWriter) writeFile(name string, mode filemode.FileMode, size int64, r io.Reader) error {
+	hdr := w.header(name, tar.TypeReg, fileMode(mode))
+	hdr.Size = size
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarWriter) writeSymlink(name, target string) error {
+	hdr := w.header(name, tar.TypeSymlink, fileMode(filemode.Symlink))
+	hdr.Linkname = target
+	return w.tw.WriteHeader(hdr)
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+
+	if w.c != nil {
+		return w.c.Close()
+	}
+
+	return nil
+}
+
+type zipWriter struct {
+	zw      *zip.Writer
+	method  uint16
+	modTime time.Time
+}
+
+func newZipWriter(w io.Writer, level int, modTime time.Time, commit plumbing.Hash) (*zipWriter, error) {
+	zw := zip.NewWriter(w)
+	method := zip.Deflate
+	if level == flate.NoCompression {
+		method = zip.Store
+	} else {
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+
+	if !commit.IsZero() {
+		if err := zw.SetComment(commit.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	return &zipWriter{zw: zw, method: method, modTime: modTime}, nil
+}
+
+func (w *zipWriter) header(name string, mode int64, unixType uint32, method uint16) *zip.FileHeader {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: w.modTime,
+	}
+
+	// Store the unix permissions in the external attributes, like git does.
+	hdr.CreatorVersion = 3<<8 | 20
+	hdr.ExternalAttrs = (unixType | uint32(mode)) << 16
+	return hdr
+}
+
+func (w *zipWriter) writeDir(name string) error {
+	_, err := w.zw.CreateHeader(w.header(name, 0o775, 0o040000, zip.Store))
+	return err
+}
+
+func (w *zipWriter) writeFile(name string, mode filemode.FileMode, size int64, r io.Reader) error {
+	hdr := w.header(name, fileMode(mode), 0o100000, w.method)
+	hdr.UncompressedSize64 = uint64(size)
+	fw, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipWriter) writeSymlink(name, target string) error {
+	fw, err := w.zw.CreateHeader(w.header(name, fileMode(filemode.Symlink), 0o120000, zip.Store))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(fw, target)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
@@ -0,0 +1,178 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/stretchr/testify/suite"
+)
+
+type ArchiveSuite struct {
+	suite.Suite
+	Storer storer.EncodedObjectStorer
+	Commit *object.Commit
+	Tree   *object.Tree
+}
+
+func TestArchiveSuite(t *testing.T) {
+	suite.Run(t, new(ArchiveSuite))
+}
+
+func (s *ArchiveSuite) SetupSuite() {
+	s.Storer = filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+
+	var err error
+	s.Commit, err = object.GetCommit(s.Storer, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.Require().NoError(err)
+	s.Tree, err = s.Commit.Tree()
+	s.Require().NoError(err)
+}
+
+func (s *ArchiveSuite) encode(opts *Options) []byte {
+	var buf bytes.Buffer
+	s.Require().NoError(NewEncoder(&buf, s.Storer).Encode(s.Tree, opts))
+	return buf.Bytes()
+}
+
+func (s *ArchiveSuite) readTar(r io.Reader) (map[string]*tar.Header, map[string][]byte) {
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		s.Require().NoError(err)
+
+		content, err := io.ReadAll(tr)
+		s.Require().NoError(err)
+		headers[hdr.Name] = hdr
+		contents[hdr.Name] = content
+	}
+
+	return headers, contents
+}
+
+func (s *ArchiveSuite) TestParseFormat() {
+	for _, name := range []string{"tar", "tar.gz", "tgz", "zip"} {
+		f, err := ParseFormat(name)
+		s.NoError(err)
+		s.Equal(Format(name), f)
+	}
+
+	f, err := ParseFormat("")
+	s.NoError(err)
+	s.Equal(Tar, f)
+
+	_, err = ParseFormat("rar")
+	s.ErrorIs(err, ErrUnsupportedFormat)
+}
+
+func (s *ArchiveSuite) TestEncodeTar() {
+	data := s.encode(&Options{
+		Prefix:   "repo/",
+		ModTime:  s.Commit.Committer.When,
+		CommitID: s.Commit.Hash,
+	})
+
+	headers, contents := s.readTar(bytes.NewReader(data))
+	s.Contains(headers, "repo/")
+	s.Contains(headers, "repo/go/")
+	s.Contains(headers, "repo/vendor/foo.go")
+	s.Len(contents["repo/CHANGELOG"], 18)
+
+	hdr := headers["repo/go/example.go"]
+	s.Require().NotNil(hdr)
+	s.Equal(int64(0o664), hdr.Mode)
+	s.Equal(byte(tar.TypeReg), hdr.Typeflag)
+	s.True(s.Commit.Committer.When.Equal(hdr.ModTime))
+
+	global := headers["pax_global_header"]
+	s.Require().NotNil(global)
+	s.Equal(s.Commit.Hash.String(), global.PAXRecords["comment"])
+}
+
+func (s *ArchiveSuite) TestEncodeTarGz() {
+	data := s.encode(&Options{Format: TarGz, CompressionLevel: 9})
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	s.Require().NoError(err)
+
+	headers, _ := s.readTar(gz)
+	s.Contains(headers, "go/example.go")
+	s.NotContains(headers, "pax_global_header")
+}
+
+func (s *ArchiveSuite) TestEncodeZip() {
+	data := s.encode(&Options{Format: Zip, CommitID: s.Commit.Hash})
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	s.Require().NoError(err)
+	s.Equal(s.Commit.Hash.String(), zr.Comment)
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	s.Contains(files, "go/")
+	f := files["CHANGELOG"]
+	s.Require().NotNil(f)
+	s.Equal(zip.Deflate, f.Method)
+
+	r, err := f.Open()
+	s.Require().NoError(err)
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	s.Require().NoError(err)
+	s.Equal("Initial changelog\n", string(content))
+}
+
+func (s *ArchiveSuite) TestEncodeZipNoCompression() {
+	data := s.encode(&Options{Format: Zip, CompressionLevel: NoCompression})
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	s.Require().NoError(err)
+	for _, f := range zr.File {
+		s.Equal(zip.Store, f.Method)
+	}
+}
+
+func (s *ArchiveSuite) TestEncodePaths() {
+	data := s.encode(&Options{Paths: []string{"go", "json/short.json"}})
+
+	headers, _ := s.readTar(bytes.NewReader(data))
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	s.ElementsMatch([]string{"go/", "go/example.go", "json/", "json/short.json"}, names)
+}
+
+func (s *ArchiveSuite) TestEncodeInvalidOptions() {
+	err := NewEncoder(io.Discard, s.Storer).Encode(s.Tree, &Options{CompressionLevel: 10})
+	s.ErrorIs(err, ErrInvalidCompressionLevel)
+
+	err = NewEncoder(io.Discard, s.Storer).Encode(s.Tree, &Options{Format: "rar"})
+	s.ErrorIs(err, ErrUnsupportedFormat)
+}
+
+func (s *ArchiveSuite) TestEncodeDefaultModTime() {
+	before := time.Now().Add(-time.Second)
+	headers, _ := s.readTar(bytes.NewReader(s.encode(nil)))
+	s.True(headers["LICENSE"].ModTime.After(before))
+}
@@ -0,0 +1,367 @@
+package bitmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+var (
+	// ErrMalformedBitmap is returned by Decode when the file is corrupted.
+	ErrMalformedBitmap = errors.New("malformed bitmap file")
+	// ErrUnsupportedVersion is returned by Decode when the version of the
+	// file isn't supported.
+	ErrUnsupportedVersion = errors.New("unsupported bitmap version")
+	// ErrUnsupportedFlags is returned by Decode when the file has extensions
+	// which aren't supported.
+	ErrUnsupportedFlags = errors.New("unsupported bitmap flags")
+	// ErrPackMismatch is returned by Decode when the file doesn't belong to
+	// the packfile.
+	ErrPackMismatch = errors.New("bitmap doesn't match the packfile")
+)
+
+const (
+	signature = "BITM"
+	version   = 1
+
+	// optFullDAG is set when the bitmaps are closed under reachability,
+	// which is required.
+	optFullDAG = 0x1
+	// optHashCache is set when the name-hash cache is present.
+	optHashCache = 0x4
+	// optLookupTable is set when the lookup table is present.
+	optLookupTable = 0x10
+
+	szLookupEntry = 12
+)
+
+// Index is the reachability bitmap index of a packfile.
+type Index struct {
+	pack plumbing.Hash
+
+	// objects are the objects of the packfile in the order of the packfile,
+	// i.e. the positions of the bitmaps, and sorted are the same objects
+	// sorted by ID, i.e. the positions of the packfile index.
+	objects   []plumbing.Hash
+	sorted    []plumbing.Hash
+	positions map[plumbing.Hash]int
+
+	types      [4]*Bitmap
+	commits    map[plumbing.Hash]*Bitmap
+	nameHashes []uint32
+}
+
+// NewIndex returns an Index of the packfile pack, without any bitmap, to be
+// filled before encoding it.
+func NewIndex(pack plumbing.Hash, idx idxfile.Index) (*Index, error) {
+	sorted, err := indexEntries(idx.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := indexEntries(idx.EntriesByOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sorted) != len(objects) {
+		return nil, ErrPackMismatch
+	}
+
+	positions := make(map[plumbing.Hash]int, len(objects))
+	for i, h := range objects {
+		positions[h] = i
+	}
+
+	i := &Index{
+		pack:      pack,
+		objects:   objects,
+		sorted:    sorted,
+		positions: positions,
+		commits:   make(map[plumbing.Hash]*Bitmap),
+	}
+
+	for t := range i.types {
+		i.types[t] = &Bitmap{}
+	}
+
+	return i, nil
+}
+
+func indexEntries(entries func() (idxfile.EntryIter, error)) ([]plumbing.Hash, error) {
+	iter, err := entries()
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close() //nolint:errcheck
+
+	var hashes []plumbing.Hash
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return hashes, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, e.Hash)
+	}
+}
+
+// Decode reads and decodes the bitmap file of r, belonging to the packfile
+// pack indexed by idx.
+func Decode(r io.Reader, pack plumbing.Hash, idx idxfile.Index) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hashSize := pack.Size()
+	if len(data) < 12+2*hashSize || string(data[:4]) != signature {
+		return nil, ErrMalformedBitmap
+	}
+
+	if binary.BigEndian.Uint16(data[4:]) != version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	flags := binary.BigEndian.Uint16(data[6:])
+	if flags&optFullDAG == 0 || flags&^(optFullDAG|optHashCache|optLookupTable) != 0 {
+		return nil, ErrUnsupportedFlags
+	}
+
+	f := format.SHA1
+	if hashSize == format.SHA256Size {
+		f = format.SHA256
+	}
+
+	h, err := hash.FromObjectFormat(f)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(data) - hashSize
+	h.Write(data[:end])
+	if !bytes.Equal(h.Sum(nil), data[end:]) {
+		return nil, ErrMalformedBitmap
+	}
+
+	if !bytes.Equal(data[12:12+hashSize], pack.Bytes()) {
+		return nil, ErrPackMismatch
+	}
+
+	i, err := NewIndex(pack, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	if flags&optLookupTable != 0 {
+		end -= count * szLookupEntry
+	}
+
+	if flags&optHashCache != 0 {
+		end -= len(i.objects) * 4
+		if end < 0 {
+			return nil, ErrMalformedBitmap
+		}
+
+		i.nameHashes = make([]uint32, len(i.objects))
+		for pos := range i.nameHashes {
+			i.nameHashes[pos] = binary.BigEndian.Uint32(data[end+pos*4:])
+		}
+	}
+
+	if end < 12+hashSize {
+		return nil, ErrMalformedBitmap
+	}
+
+	if err := i.decodeBitmaps(data[12+hashSize:end], count); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (i *Index) decodeBitmaps(data []byte, count int) error {
+	for t := range i.types {
+		b, n, err := decodeEWAH(data)
+		if err != nil {
+			return err
+		}
+
+		i.types[t] = b
+		data = data[n:]
+	}
+
+	entries := make([]*Bitmap, 0, count)
+	for len(entries) < count {
+		if len(data) < 6 {
+			return ErrMalformedBitmap
+		}
+
+		pos := int(binary.BigEndian.Uint32(data))
+		xor := int(data[4])
+		b, n, err := decodeEWAH(data[6:])
+		if err != nil {
+			return err
+		}
+
+		if pos >= len(i.sorted) || xor > len(entries) {
+			return ErrMalformedBitmap
+		}
+
+		if xor > 0 {
+			b.Xor(entries[len(entries)-xor])
+		}
+
+		entries = append(entries, b)
+		i.commits[i.sorted[pos]] = b
+		data = data[6+n:]
+	}
+
+	return nil
+}
+
+// Pack returns the hash of the packfile.
+func (i *Index) Pack() plumbing.Hash {
+	return i.pack
+}
+
+// Count returns the number of objects of the packfile.
+func (i *Index) Count() int {
+	return len(i.objects)
+}
+
+// Position returns the position of the object h in the bitmaps, and false
+// if it isn't in the packfile.
+func (i *Index) Position(h plumbing.Hash) (int, bool) {
+	pos, ok := i.positions[h]
+	return pos, ok
+}
+
+// Hash returns the object at the position pos of the bitmaps.
+func (i *Index) Hash(pos int) plumbing.Hash {
+	return i.objects[pos]
+}
+
+func typeIndex(t plumbing.ObjectType) int {
+	switch t {
+	case plumbing.CommitObject:
+		return 0
+	case plumbing.TreeObject:
+		return 1
+	case plumbing.BlobObject:
+		return 2
+	case plumbing.TagObject:
+		return 3
+	default:
+		return -1
+	}
+}
+
+// TypeBitmap returns the bitmap of the objects of type t, which must not be
+// modified.
+func (i *Index) TypeBitmap(t plumbing.ObjectType) *Bitmap {
+	if n := typeIndex(t); n >= 0 {
+		return i.types[n]
+	}
+
+	return &Bitmap{}
+}
+
+// SetType records the type of the object at the position pos.
+func (i *Index) SetType(pos int, t plumbing.ObjectType) {
+	if n := typeIndex(t); n >= 0 {
+		i.types[n].Set(pos)
+	}
+}
+
+// Commits returns the commits having a bitmap, in the order of the
+// packfile.
+func (i *Index) Commits() []plumbing.Hash {
+	commits := make([]plumbing.Hash, 0, len(i.commits))
+	for h := range i.commits {
+		commits = append(commits, h)
+	}
+
+	sort.Slice(commits, func(a, b int) bool {
+		return i.positions[commits[a]] < i.positions[commits[b]]
+	})
+
+	return commits
+}
+
+// Bitmap returns the bitmap of the objects reachable from the given commit,
+// which must not be modified, and false if the commit has no bitmap.
+func (i *Index) Bitmap(commit plumbing.Hash) (*Bitmap, bool) {
+	b, ok := i.commits[commit]
+	return b, ok
+}
+
+// SetBitmap records the bitmap of the objects reachable from the given
+// commit, which must be in the packfile along with all of them.
+func (i *Index) SetBitmap(commit plumbing.Hash, b *Bitmap) error {
+	if _, ok := i.positions[commit]; !ok || b.Len() > len(i.objects) {
+		return ErrPackMismatch
+	}
+
+	i.commits[commit] = b
+	return nil
+}
+
+// NameHash returns the hash of the path of the object at the position pos,
+// and false if it's unknown.
+func (i *Index) NameHash(pos int) (uint32, bool) {
+	if i.nameHashes == nil {
+		return 0, false
+	}
+
+	return i.nameHashes[i.sortedPosition(pos)], true
+}
+
+// SetNameHash records the hash of the path of the object at the position
+// pos, as returned by HashName.
+func (i *Index) SetNameHash(pos int, hash uint32) {
+	if i.nameHashes == nil {
+		i.nameHashes = make([]uint32, len(i.objects))
+	}
+
+	i.nameHashes[i.sortedPosition(pos)] = hash
+}
+
+// sortedPosition returns the position in the packfile index of the object
+// at the position pos of the bitmaps, which is the one of the name-hash
+// cache.
+func (i *Index) sortedPosition(pos int) int {
+	h := i.objects[pos]
+	return sort.Search(len(i.sorted), func(n int) bool {
+		return i.sorted[n].Compare(h.Bytes()) >= 0
+	})
+}
+
+// HashName returns the hash of the path of an object stored in the
+// name-hash cache, such that similar paths have close hashes, the last
+// characters being the most significant ones.
+func HashName(name string) uint32 {
+	var h uint32
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; c {
+		case ' ', '\t', '\n', '\r':
+		default:
+			h = h>>2 + uint32(c)<<24
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,144 @@
+package bitmap
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEWAH(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(42))
+	cases := map[string]*Bitmap{
+		"empty":  {},
+		"single": {words: []uint64{1 << 42}},
+		"runs": {words: []uint64{
+			0, 0, 0, ^uint64(0), ^uint64(0), 5, 0, ^uint64(0), 7, 9, 0, 1,
+		}},
+	}
+
+	random := &Bitmap{}
+	for i := 0; i < 1000; i++ {
+		random.Set(rnd.Intn(100000))
+	}
+
+	cases["random"] = random
+
+	for name, b := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := encodeEWAH([]byte("prefix"), b)
+			decoded, n, err := decodeEWAH(data[len("prefix"):])
+			require.NoError(t, err)
+			require.Equal(t, len(data)-len("prefix"), n)
+			require.Equal(t, b.Count(), decoded.Count())
+			require.Equal(t, b.Len(), decoded.Len())
+			b.ForEach(func(i int) {
+				require.True(t, decoded.Get(i))
+			})
+		})
+	}
+
+	_, _, err := decodeEWAH([]byte{0, 0, 0, 1, 0, 0, 0, 2})
+	require.ErrorIs(t, err, ErrMalformedBitmap)
+}
+
+func TestBitmapOperations(t *testing.T) {
+	t.Parallel()
+
+	a, b := &Bitmap{}, &Bitmap{}
+	a.Set(1)
+	a.Set(70)
+	b.Set(70)
+	b.Set(200)
+
+	or := a.Clone()
+	or.Or(b)
+	require.Equal(t, 3, or.Count())
+	require.Equal(t, 201, or.Len())
+
+	andNot := a.Clone()
+	andNot.AndNot(b)
+	var bits []int
+	andNot.ForEach(func(i int) { bits = append(bits, i) })
+	require.Equal(t, []int{1}, bits)
+
+	xor := a.Clone()
+	xor.Xor(b)
+	require.False(t, xor.Get(70))
+	require.True(t, xor.Get(200))
+	require.Equal(t, 2, a.Count())
+}
+
+func TestHashName(t *testing.T) {
+	t.Parallel()
+
+	require.Zero(t, HashName(""))
+	require.Equal(t, uint32('a')<<24, HashName("a"))
+	require.Equal(t, uint32('a')<<22+uint32('b')<<24, HashName("a b"))
+	require.Equal(t, HashName("dir/file.go"), HashName("dir/file.go\n"))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	f := fixtures.Basic().One()
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(f.Idx()).Decode(idx))
+	pack := plumbing.NewHash(f.PackfileHash)
+
+	i, err := NewIndex(pack, idx)
+	require.NoError(t, err)
+	require.Equal(t, 31, i.Count())
+
+	head := plumbing.NewHash(f.Head)
+	pos, ok := i.Position(head)
+	require.True(t, ok)
+	require.Equal(t, head, i.Hash(pos))
+	i.SetType(pos, plumbing.CommitObject)
+	i.SetNameHash(pos, HashName("CHANGELOG"))
+
+	b := &Bitmap{}
+	for n := 0; n < i.Count(); n += 2 {
+		b.Set(n)
+	}
+
+	require.NoError(t, i.SetBitmap(head, b))
+	require.ErrorIs(t, i.SetBitmap(plumbing.ZeroHash, b), ErrPackMismatch)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode(i))
+	data := buf.Bytes()
+
+	decoded, err := Decode(bytes.NewReader(data), pack, idx)
+	require.NoError(t, err)
+	require.Equal(t, []plumbing.Hash{head}, decoded.Commits())
+	require.True(t, decoded.TypeBitmap(plumbing.CommitObject).Get(pos))
+	require.Equal(t, 1, decoded.TypeBitmap(plumbing.CommitObject).Count())
+	require.Zero(t, decoded.TypeBitmap(plumbing.BlobObject).Count())
+
+	hash, ok := decoded.NameHash(pos)
+	require.True(t, ok)
+	require.Equal(t, HashName("CHANGELOG"), hash)
+
+	got, ok := decoded.Bitmap(head)
+	require.True(t, ok)
+	require.Equal(t, b.Count(), got.Count())
+	_, ok = decoded.Bitmap(plumbing.ZeroHash)
+	require.False(t, ok)
+
+	_, err = Decode(bytes.NewReader(data), plumbing.ZeroHash, idx)
+	require.ErrorIs(t, err, ErrPackMismatch)
+
+	data[len(data)/2] ^= 0xff
+	_, err = Decode(bytes.NewReader(data), pack, idx)
+	require.ErrorIs(t, err, ErrMalformedBitmap)
+}
@@ -0,0 +1,19 @@
+// Package bitmap implements encoding and decoding of reachability bitmap
+// files.
+//
+// A reachability bitmap file is stored next to a packfile, as
+// pack-<hash>.bitmap. For some of the commits of the packfile, it stores the
+// set of objects reachable from them as a bitmap of the objects of the
+// packfile, in the order of the packfile. The bitmaps are compressed with
+// EWAH, and may be XORed with a previous one:
+//
+//   - A header with the checksum of the packfile.
+//   - The bitmaps of the commits, trees, blobs and tags of the packfile.
+//   - The bitmaps of the selected commits.
+//   - Optionally, the name-hash cache: the hash of the path of each object,
+//     used to find delta bases.
+//   - Optionally, a lookup table of the selected commits.
+//
+// See https://git-scm.com/docs/gitformat-pack#_pack_bitmap_files_have_the_following_format
+// for the format specification.
+package bitmap
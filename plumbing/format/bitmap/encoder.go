@@ -0,0 +1,68 @@
+package bitmap
+
+import (
+	"encoding/binary"
+	"io"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+// Encoder writes bitmap files.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the bitmap file of idx. The bitmaps of the commits aren't
+// XORed, and the name-hash cache is written if any name hash was set.
+func (e *Encoder) Encode(idx *Index) error {
+	f := format.SHA1
+	if idx.pack.Size() == format.SHA256Size {
+		f = format.SHA256
+	}
+
+	h, err := hash.FromObjectFormat(f)
+	if err != nil {
+		return err
+	}
+
+	commits := idx.Commits()
+	flags := uint16(optFullDAG)
+	if idx.nameHashes != nil {
+		flags |= optHashCache
+	}
+
+	data := []byte(signature)
+	data = binary.BigEndian.AppendUint16(data, version)
+	data = binary.BigEndian.AppendUint16(data, flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(commits)))
+	data = append(data, idx.pack.Bytes()...)
+
+	for _, b := range idx.types {
+		data = encodeEWAH(data, b)
+	}
+
+	for _, c := range commits {
+		pos := idx.sortedPosition(idx.positions[c])
+		data = binary.BigEndian.AppendUint32(data, uint32(pos))
+		data = append(data, 0, 0)
+		data = encodeEWAH(data, idx.commits[c])
+	}
+
+	for _, n := range idx.nameHashes {
+		data = binary.BigEndian.AppendUint32(data, n)
+	}
+
+	h.Write(data)
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(h.Sum(nil))
+	return err
+}
@@ -0,0 +1,190 @@
+package bitmap
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	rlwRunningBits = 32
+	rlwLiteralBits = 31
+
+	maxRunningLength = 1<<rlwRunningBits - 1
+	maxLiteralWords  = 1<<rlwLiteralBits - 1
+)
+
+// Bitmap is a set of objects of a packfile, each bit being the position of
+// an object in the packfile. The zero value is an empty bitmap.
+type Bitmap struct {
+	words []uint64
+}
+
+// Set adds the position i to the bitmap.
+func (b *Bitmap) Set(i int) {
+	w := i / 64
+	for len(b.words) <= w {
+		b.words = append(b.words, 0)
+	}
+
+	b.words[w] |= 1 << (uint(i) % 64)
+}
+
+// Get returns true if the position i is in the bitmap.
+func (b *Bitmap) Get(i int) bool {
+	w := i / 64
+	if i < 0 || w >= len(b.words) {
+		return false
+	}
+
+	return b.words[w]&(1<<(uint(i)%64)) != 0
+}
+
+// Or adds the positions of o to the bitmap.
+func (b *Bitmap) Or(o *Bitmap) {
+	for len(b.words) < len(o.words) {
+		b.words = append(b.words, 0)
+	}
+
+	for i, w := range o.words {
+		b.words[i] |= w
+	}
+}
+
+// AndNot removes the positions of o from the bitmap.
+func (b *Bitmap) AndNot(o *Bitmap) {
+	for i := 0; i < len(b.words) && i < len(o.words); i++ {
+		b.words[i] &^= o.words[i]
+	}
+}
+
+// Xor flips the positions of o in the bitmap.
+func (b *Bitmap) Xor(o *Bitmap) {
+	for len(b.words) < len(o.words) {
+		b.words = append(b.words, 0)
+	}
+
+	for i, w := range o.words {
+		b.words[i] ^= w
+	}
+}
+
+// Clone returns a copy of the bitmap.
+func (b *Bitmap) Clone() *Bitmap {
+	return &Bitmap{words: append([]uint64(nil), b.words...)}
+}
+
+// Count returns the number of positions in the bitmap.
+func (b *Bitmap) Count() int {
+	var n int
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+
+	return n
+}
+
+// Len returns the highest position in the bitmap plus one.
+func (b *Bitmap) Len() int {
+	for i := len(b.words) - 1; i >= 0; i-- {
+		if b.words[i] != 0 {
+			return i*64 + 64 - bits.LeadingZeros64(b.words[i])
+		}
+	}
+
+	return 0
+}
+
+// ForEach calls fn with each position of the bitmap, in increasing order.
+func (b *Bitmap) ForEach(fn func(i int)) {
+	for i, w := range b.words {
+		for w != 0 {
+			fn(i*64 + bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+}
+
+// decodeEWAH decodes the EWAH compressed bitmap at the start of data,
+// returning it along with its size.
+func decodeEWAH(data []byte) (*Bitmap, int, error) {
+	if len(data) < 8 {
+		return nil, 0, ErrMalformedBitmap
+	}
+
+	bitSize := binary.BigEndian.Uint32(data)
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	size := 8 + n*8 + 4
+	if n < 0 || len(data) < size {
+		return nil, 0, ErrMalformedBitmap
+	}
+
+	maxWords := (int(bitSize) + 63) / 64
+	b := &Bitmap{words: make([]uint64, 0, maxWords)}
+	for pos := 0; pos < n; {
+		rlw := binary.BigEndian.Uint64(data[8+pos*8:])
+		running := rlw >> 1 & maxRunningLength
+		literals := int(rlw >> (1 + rlwRunningBits))
+		if len(b.words)+int(running)+literals > maxWords || pos+1+literals > n {
+			return nil, 0, ErrMalformedBitmap
+		}
+
+		var fill uint64
+		if rlw&1 != 0 {
+			fill = ^uint64(0)
+		}
+
+		for i := uint64(0); i < running; i++ {
+			b.words = append(b.words, fill)
+		}
+
+		for i := 0; i < literals; i++ {
+			b.words = append(b.words, binary.BigEndian.Uint64(data[8+(pos+1+i)*8:]))
+		}
+
+		pos += 1 + literals
+	}
+
+	return b, size, nil
+}
+
+// encodeEWAH appends to dst the EWAH compressed b.
+func encodeEWAH(dst []byte, b *Bitmap) []byte {
+	bitSize := b.Len()
+	words := b.words[:(bitSize+63)/64]
+
+	var buf []uint64
+	var last int
+	for i := 0; ; {
+		last = len(buf)
+		buf = append(buf, 0)
+
+		var fill, running uint64
+		if i < len(words) && (words[i] == 0 || words[i] == ^uint64(0)) {
+			clean := words[i]
+			fill = clean & 1
+			for i < len(words) && words[i] == clean && running < maxRunningLength {
+				running++
+				i++
+			}
+		}
+
+		start := i
+		for i < len(words) && words[i] != 0 && words[i] != ^uint64(0) && i-start < maxLiteralWords {
+			i++
+		}
+
+		buf = append(buf, words[start:i]...)
+		buf[last] = fill | running<<1 | uint64(i-start)<<(1+rlwRunningBits)
+		if i >= len(words) {
+			break
+		}
+	}
+
+	dst = binary.BigEndian.AppendUint32(dst, uint32(bitSize))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(buf)))
+	for _, w := range buf {
+		dst = binary.BigEndian.AppendUint64(dst, w)
+	}
+
+	return binary.BigEndian.AppendUint32(dst, uint32(last))
+}
@@ -0,0 +1,121 @@
+// Package bundle implements encoding and decoding of git bundle files, as
+// created by git-bundle.
+//
+// A bundle is a header, listing the references it contains and the commits
+// it requires, followed by a packfile with the objects of the references.
+// See https://git-scm.com/docs/gitformat-bundle.
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// Version is the version of a bundle.
+type Version int
+
+const (
+	// V2 is the original bundle version, only supporting SHA1 repositories.
+	V2 Version = 2
+	// V3 is the bundle version supporting capabilities, used for SHA256
+	// repositories and filtered bundles.
+	V3 Version = 3
+)
+
+const (
+	v2Signature = "# v2 git bundle\n"
+	v3Signature = "# v3 git bundle\n"
+
+	capabilityPrefix   = '@'
+	prerequisitePrefix = '-'
+
+	objectFormatCapability = "object-format"
+	filterCapability       = "filter"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when the bundle version is not
+	// supported.
+	ErrUnsupportedVersion = errors.New("unsupported bundle version")
+	// ErrMalformedBundle is returned when the bundle header is corrupted.
+	ErrMalformedBundle = errors.New("malformed bundle")
+	// ErrUnsupportedCapability is returned when the bundle requires a
+	// capability that is not supported.
+	ErrUnsupportedCapability = errors.New("unsupported bundle capability")
+	// ErrMissingPrerequisites is returned when the repository lacks the
+	// prerequisite commits of a bundle.
+	ErrMissingPrerequisites = errors.New("repository lacks prerequisite commits")
+)
+
+// Prerequisite is a commit that must exist in the repository the bundle is
+// unbundled into. The bundle doesn't contain the objects reachable from it.
+type Prerequisite struct {
+	// Hash is the id of the commit.
+	Hash plumbing.Hash
+	// Comment is a free-form text, usually the subject of the commit.
+	Comment string
+}
+
+// Header is the header of a bundle.
+type Header struct {
+	// Version is the version of the bundle. When encoding, V2 is used if it's
+	// not set, unless the header requires V3 capabilities.
+	Version Version
+	// ObjectFormat is the hash algorithm used by the bundle objects.
+	ObjectFormat format.ObjectFormat
+	// Filter is the object filter used to create the bundle, if any, like
+	// "blob:none".
+	Filter string
+	// Prerequisites are the commits the bundle requires.
+	Prerequisites []Prerequisite
+	// References are the references contained in the bundle, pointing to
+	// objects in the packfile.
+	References []*plumbing.Reference
+}
+
+// IsBundle reports whether r starts with a bundle signature.
+func IsBundle(r io.Reader) (bool, error) {
+	buf := make([]byte, len(v2Signature))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	switch string(buf) {
+	case v2Signature, v3Signature:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// VerifyPrerequisites checks that all the prerequisites of the bundle are
+// commits present in s, returning an error wrapping ErrMissingPrerequisites
+// otherwise.
+func VerifyPrerequisites(s storer.EncodedObjectStorer, h *Header) error {
+	var missing []string
+	for _, p := range h.Prerequisites {
+		if _, err := s.EncodedObject(plumbing.CommitObject, p.Hash); err != nil {
+			if !errors.Is(err, plumbing.ErrObjectNotFound) {
+				return err
+			}
+
+			missing = append(missing, p.Hash.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingPrerequisites, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package bundle
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/stretchr/testify/suite"
+)
+
+type BundleSuite struct {
+	suite.Suite
+}
+
+func TestBundleSuite(t *testing.T) {
+	suite.Run(t, new(BundleSuite))
+}
+
+const v2Bundle = `# v2 git bundle
+-918c48b83bd081e863dbe1b80f8998f058cd8294 Second commit
+6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master
+6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD
+
+PACK`
+
+func (s *BundleSuite) TestDecodeV2() {
+	d := NewDecoder(strings.NewReader(v2Bundle))
+
+	h := &Header{}
+	s.Require().NoError(d.Decode(h))
+	s.Equal(V2, h.Version)
+	s.Equal(format.SHA1, h.ObjectFormat)
+	s.Equal([]Prerequisite{{
+		Hash:    plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+		Comment: "Second commit",
+	}}, h.Prerequisites)
+	s.Equal([]*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewReferenceFromStrings("HEAD", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, h.References)
+
+	pack, err := io.ReadAll(d)
+	s.NoError(err)
+	s.Equal("PACK", string(pack))
+}
+
+func (s *BundleSuite) TestEncodeV2() {
+	h := &Header{}
+	s.Require().NoError(NewDecoder(strings.NewReader(v2Bundle)).Decode(h))
+
+	var buf bytes.Buffer
+	s.Require().NoError(NewEncoder(&buf).Encode(h))
+	s.Equal(strings.TrimSuffix(v2Bundle, "PACK"), buf.String())
+}
+
+func (s *BundleSuite) TestEncodeDecodeV3() {
+	h := &Header{
+		ObjectFormat: format.SHA256,
+		Filter:       "blob:none",
+		References: []*plumbing.Reference{
+			plumbing.NewReferenceFromStrings("refs/heads/main",
+				"a0f6fe8bf8ae7325b2e7e96b7e8b0a3ff4bc0d8ec3dce6f6b6d9dbbe1a3f67b8"),
+		},
+	}
+
+	var buf bytes.Buffer
+	s.Require().NoError(NewEncoder(&buf).Encode(h))
+	s.True(strings.HasPrefix(buf.String(), "# v3 git bundle\n@object-format=sha256\n@filter=blob:none\n"))
+
+	decoded := &Header{}
+	s.Require().NoError(NewDecoder(&buf).Decode(decoded))
+	s.Equal(V3, decoded.Version)
+	s.Equal(format.SHA256, decoded.ObjectFormat)
+	s.Equal("blob:none", decoded.Filter)
+	s.Equal(h.References, decoded.References)
+}
+
+func (s *BundleSuite) TestEncodeV2Unsupported() {
+	err := NewEncoder(io.Discard).Encode(&Header{Version: V2, Filter: "blob:none"})
+	s.ErrorIs(err, ErrUnsupportedCapability)
+
+	err = NewEncoder(io.Discard).Encode(&Header{Version: 4})
+	s.ErrorIs(err, ErrUnsupportedVersion)
+}
+
+func (s *BundleSuite) TestDecodeErrors() {
+	for input, expected := range map[string]error{
+		"# v4 git bundle\n\n":                                           ErrUnsupportedVersion,
+		"# v2 git bundle\n@object-format=sha1\n\n":                      ErrMalformedBundle,
+		"# v3 git bundle\n@unknown\n\n":                                 ErrUnsupportedCapability,
+		"# v3 git bundle\n@object-format=md5\n\n":                       format.ErrInvalidObjectFormat,
+		"# v2 git bundle\n-1234 short\n\n":                              ErrMalformedBundle,
+		"# v2 git bundle\n6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n\n": ErrMalformedBundle,
+		"# v2 git bundle\n":                                             ErrMalformedBundle,
+	} {
+		err := NewDecoder(strings.NewReader(input)).Decode(&Header{})
+		s.ErrorIs(err, expected, input)
+	}
+}
+
+func (s *BundleSuite) TestIsBundle() {
+	ok, err := IsBundle(strings.NewReader(v2Bundle))
+	s.NoError(err)
+	s.True(ok)
+
+	ok, err = IsBundle(strings.NewReader("# v3 git bundle\n"))
+	s.NoError(err)
+	s.True(ok)
+
+	ok, err = IsBundle(strings.NewReader("PACK"))
+	s.NoError(err)
+	s.False(ok)
+}
@@ -0,0 +1,131 @@
+package bundle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// Decoder reads and decodes bundles from an input stream.
+type Decoder struct {
+	*bufio.Reader
+}
+
+// NewDecoder builds a new bundle decoder, that reads from r. After decoding
+// the header, the packfile can be read from the Decoder itself.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{bufio.NewReader(r)}
+}
+
+// Decode reads the bundle header from the stream into h, leaving the stream
+// at the start of the packfile.
+func (d *Decoder) Decode(h *Header) error {
+	line, err := d.readLine()
+	if err != nil {
+		return err
+	}
+
+	switch line + "\n" {
+	case v2Signature:
+		h.Version = V2
+	case v3Signature:
+		h.Version = V3
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, line)
+	}
+
+	h.ObjectFormat = format.SHA1
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+
+		if line == "" {
+			return nil
+		}
+
+		switch line[0] {
+		case capabilityPrefix:
+			if h.Version != V3 {
+				return fmt.Errorf("%w: capability in v%d bundle", ErrMalformedBundle, h.Version)
+			}
+
+			if err := h.decodeCapability(line[1:]); err != nil {
+				return err
+			}
+		case prerequisitePrefix:
+			id, comment, _ := strings.Cut(line[1:], " ")
+			hash, err := h.parseHash(id)
+			if err != nil {
+				return err
+			}
+
+			h.Prerequisites = append(h.Prerequisites, Prerequisite{Hash: hash, Comment: comment})
+		default:
+			id, name, ok := strings.Cut(line, " ")
+			if !ok || name == "" {
+				return fmt.Errorf("%w: invalid reference line %q", ErrMalformedBundle, line)
+			}
+
+			hash, err := h.parseHash(id)
+			if err != nil {
+				return err
+			}
+
+			h.References = append(h.References,
+				plumbing.NewHashReference(plumbing.ReferenceName(name), hash))
+		}
+	}
+}
+
+func (d *Decoder) readLine() (string, error) {
+	line, err := d.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", fmt.Errorf("%w: unexpected end of header", ErrMalformedBundle)
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (h *Header) decodeCapability(line string) error {
+	key, value, _ := strings.Cut(line, "=")
+	switch key {
+	case objectFormatCapability:
+		switch value {
+		case format.SHA1.String():
+			h.ObjectFormat = format.SHA1
+		case format.SHA256.String():
+			h.ObjectFormat = format.SHA256
+		default:
+			return fmt.Errorf("%w: %s", format.ErrInvalidObjectFormat, value)
+		}
+	case filterCapability:
+		h.Filter = value
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedCapability, key)
+	}
+
+	return nil
+}
+
+func (h *Header) parseHash(id string) (plumbing.Hash, error) {
+	if len(id) != h.ObjectFormat.HexSize() {
+		return plumbing.ZeroHash, fmt.Errorf("%w: invalid object id %q", ErrMalformedBundle, id)
+	}
+
+	hash, ok := plumbing.FromHex(id)
+	if !ok {
+		return plumbing.ZeroHash, fmt.Errorf("%w: invalid object id %q", ErrMalformedBundle, id)
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,62 @@
+package bundle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// Encoder writes bundle headers to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w. The packfile must be
+// written to w after encoding the header.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the bundle header h.
+func (e *Encoder) Encode(h *Header) error {
+	version := h.Version
+	needsV3 := h.ObjectFormat != format.SHA1 || h.Filter != ""
+	switch {
+	case version == 0 && needsV3:
+		version = V3
+	case version == 0:
+		version = V2
+	case version == V2 && needsV3:
+		return fmt.Errorf("%w: v2 bundles only support sha1 and no filter", ErrUnsupportedCapability)
+	case version != V2 && version != V3:
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	bw := bufio.NewWriter(e.w)
+	if version == V3 {
+		bw.WriteString(v3Signature)
+		fmt.Fprintf(bw, "%c%s=%s\n", capabilityPrefix, objectFormatCapability, h.ObjectFormat)
+		if h.Filter != "" {
+			fmt.Fprintf(bw, "%c%s=%s\n", capabilityPrefix, filterCapability, h.Filter)
+		}
+	} else {
+		bw.WriteString(v2Signature)
+	}
+
+	for _, p := range h.Prerequisites {
+		if p.Comment != "" {
+			fmt.Fprintf(bw, "%c%s %s\n", prerequisitePrefix, p.Hash, p.Comment)
+		} else {
+			fmt.Fprintf(bw, "%c%s\n", prerequisitePrefix, p.Hash)
+		}
+	}
+
+	for _, ref := range h.References {
+		fmt.Fprintf(bw, "%s %s\n", ref.Hash(), ref.Name())
+	}
+
+	bw.WriteString("\n")
+	return bw.Flush()
+}
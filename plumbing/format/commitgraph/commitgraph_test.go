@@ -3,12 +3,15 @@ package commitgraph_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
 	"github.com/go-git/go-billy/v6/util"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	commitgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/storage/filesystem"
@@ -200,3 +203,112 @@ func (s *CommitgraphSuite) TestReencodeInMemory() {
 		testDecodeHelper(s, tmpIndex)
 	}
 }
+
+// testCommits returns the commit data of a history with a merge, whose ids
+// are of the given object format.
+func testCommits(f config.ObjectFormat) ([]plumbing.Hash, []*commitgraph.CommitData) {
+	hashes := make([]plumbing.Hash, 5)
+	for i := range hashes {
+		hasher := plumbing.NewHasher(f, plumbing.CommitObject, 1)
+		hasher.Write([]byte{byte(i)})
+		hashes[i] = hasher.Sum()
+	}
+
+	parents := [][]plumbing.Hash{
+		{},
+		{hashes[0]},
+		{hashes[1]},
+		{hashes[2]},
+		{hashes[3], hashes[1]},
+	}
+
+	data := make([]*commitgraph.CommitData, len(hashes))
+	for i := range hashes {
+		data[i] = &commitgraph.CommitData{
+			TreeHash:     hashes[len(hashes)-1-i],
+			ParentHashes: parents[i],
+			Generation:   uint64(i + 1),
+			GenerationV2: uint64(1e9 + i),
+			When:         time.Unix(int64(1e9+i), 0),
+		}
+	}
+
+	return hashes, data
+}
+
+func testCheckCommits(s *CommitgraphSuite, index commitgraph.Index, hashes []plumbing.Hash, data []*commitgraph.CommitData) {
+	s.Len(index.Hashes(), len(hashes))
+	s.True(index.HasGenerationV2())
+	for i, h := range hashes {
+		idx, err := index.GetIndexByHash(h)
+		s.Require().NoError(err)
+		commitData, err := index.GetCommitDataByIndex(idx)
+		s.Require().NoError(err)
+		s.Equal(data[i].TreeHash, commitData.TreeHash)
+		s.Equal(data[i].ParentHashes, commitData.ParentHashes)
+		s.Equal(data[i].Generation, commitData.Generation)
+		s.Equal(data[i].GenerationV2, commitData.GenerationV2)
+	}
+}
+
+func (s *CommitgraphSuite) TestEncodeSHA256() {
+	hashes, data := testCommits(config.SHA256)
+	memoryIndex := commitgraph.NewMemoryIndex()
+	for i, h := range hashes {
+		memoryIndex.Add(h, data[i])
+	}
+
+	fs := memfs.New()
+	f, err := fs.Create("commit-graph")
+	s.Require().NoError(err)
+	s.Require().NoError(commitgraph.NewEncoder(f, commitgraph.WithObjectFormat(config.SHA256)).Encode(memoryIndex))
+	s.Require().NoError(f.Close())
+
+	index := testReadIndex(s, fs, "commit-graph")
+	defer index.Close()
+	testCheckCommits(s, index, hashes, data)
+}
+
+func (s *CommitgraphSuite) TestEncodeLayer() {
+	for _, f := range []config.ObjectFormat{config.SHA1, config.SHA256} {
+		hashes, data := testCommits(f)
+		fs := memfs.New()
+
+		// The first layer has the first three commits, and the second one
+		// the others.
+		var layers []plumbing.Hash
+		var base commitgraph.Index
+		for _, commits := range [][]int{{0, 1, 2}, {3, 4}} {
+			memoryIndex := commitgraph.NewMemoryIndexWithParent(base)
+			for _, i := range commits {
+				memoryIndex.Add(hashes[i], data[i])
+			}
+
+			w, err := fs.Create("layer")
+			s.Require().NoError(err)
+			h, err := commitgraph.NewEncoder(w, commitgraph.WithObjectFormat(f)).EncodeLayer(memoryIndex, base, layers)
+			s.Require().NoError(err)
+			s.Require().NoError(w.Close())
+			s.Equal(f.Size(), h.Size())
+
+			path := fs.Join("objects", "info", "commit-graphs", "graph-"+h.String()+".graph")
+			s.Require().NoError(fs.Rename("layer", path))
+			layers = append(layers, h)
+
+			r, err := fs.Open(path)
+			s.Require().NoError(err)
+			base, err = commitgraph.OpenFileIndexWithParent(r, base)
+			s.Require().NoError(err)
+		}
+
+		s.Require().NoError(base.Close())
+
+		chain := layers[0].String() + "\n" + layers[1].String() + "\n"
+		s.Require().NoError(util.WriteFile(fs, fs.Join("objects", "info", "commit-graphs", "commit-graph-chain"), []byte(chain), 0o644))
+
+		index, err := commitgraph.OpenChainIndex(fs)
+		s.Require().NoError(err)
+		testCheckCommits(s, index, hashes, data)
+		s.Require().NoError(index.Close())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/utils/binary"
 )
@@ -16,21 +17,73 @@ type Encoder struct {
 	hash hash.Hash
 }
 
+// EncoderOption configures an Encoder.
+type EncoderOption func(*Encoder)
+
+// WithObjectFormat sets the object format of the commits of the
+// commit-graph files, SHA-1 by default.
+func WithObjectFormat(f config.ObjectFormat) EncoderOption {
+	return func(e *Encoder) {
+		if f == config.SHA256 {
+			e.hash = hash.New(crypto.SHA256)
+		}
+	}
+}
+
 // NewEncoder returns a new stream encoder that writes to w.
-func NewEncoder(w io.Writer) *Encoder {
-	// TODO: Support passing an ObjectFormat (sha256)
-	h := hash.New(crypto.SHA1)
-	mw := io.MultiWriter(w, h)
-	return &Encoder{mw, h}
+func NewEncoder(w io.Writer, opts ...EncoderOption) *Encoder {
+	e := &Encoder{hash: hash.New(crypto.SHA1)}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.Writer = io.MultiWriter(w, e.hash)
+	return e
 }
 
 // Encode writes an index into the commit-graph file
 func (e *Encoder) Encode(idx Index) error {
-	// Get all the hashes in the input index
-	hashes := idx.Hashes()
+	_, err := e.encode(idx, idx.Hashes(), 0, nil)
+	return err
+}
+
+// EncodeLayer writes the commits of idx which follow the ones of base as a
+// layer of a commit-graph chain, and returns its checksum, which names its
+// file. base is the index of the previous layers of the chain, whose
+// checksums are given from the oldest, and idx usually has it as parent.
+func (e *Encoder) EncodeLayer(idx, base Index, layers []plumbing.Hash) (plumbing.Hash, error) {
+	var baseCount uint32
+	if base != nil {
+		baseCount = base.MaximumNumberOfHashes()
+	}
+
+	hashes := make([]plumbing.Hash, 0, idx.MaximumNumberOfHashes()-baseCount)
+	for i := baseCount; i < idx.MaximumNumberOfHashes(); i++ {
+		h, err := idx.GetHashByIndex(i)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		hashes = append(hashes, h)
+	}
+
+	sum, err := e.encode(idx, hashes, baseCount, layers)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, _ := plumbing.FromBytes(sum)
+	return h, nil
+}
 
+// encode writes the commits of idx with the given hashes, which follow the
+// baseCount commits of the given previous layers.
+func (e *Encoder) encode(idx Index, hashes []plumbing.Hash, baseCount uint32, layers []plumbing.Hash) ([]byte, error) {
 	// Sort the inout and prepare helper structures we'll need for encoding
-	hashToIndex, fanout, extraEdgesCount, generationV2OverflowCount := e.prepare(idx, hashes)
+	hashToIndex, fanout, extraEdgesCount, generationV2OverflowCount, err := e.prepare(idx, hashes, baseCount)
+	if err != nil {
+		return nil, err
+	}
 
 	chunkSignatures := [][]byte{OIDFanoutChunk.Signature(), OIDLookupChunk.Signature(), CommitDataChunk.Signature()}
 	chunkSizes := []uint64{szUint32 * lenFanout, uint64(len(hashes) * e.hash.Size()), uint64(len(hashes) * (e.hash.Size() + szCommitData))}
@@ -46,47 +99,54 @@ func (e *Encoder) Encode(idx Index) error {
 			chunkSizes = append(chunkSizes, uint64(generationV2OverflowCount)*szUint64)
 		}
 	}
+	if len(layers) > 0 {
+		chunkSignatures = append(chunkSignatures, BaseGraphsListChunk.Signature())
+		chunkSizes = append(chunkSizes, uint64(len(layers)*e.hash.Size()))
+	}
 
-	if err := e.encodeFileHeader(len(chunkSignatures)); err != nil {
-		return err
+	if err := e.encodeFileHeader(len(chunkSignatures), len(layers)); err != nil {
+		return nil, err
 	}
 	if err := e.encodeChunkHeaders(chunkSignatures, chunkSizes); err != nil {
-		return err
+		return nil, err
 	}
 	if err := e.encodeFanout(fanout); err != nil {
-		return err
+		return nil, err
 	}
 	if err := e.encodeOidLookup(hashes); err != nil {
-		return err
+		return nil, err
 	}
 
 	extraEdges, generationV2Data, err := e.encodeCommitData(hashes, hashToIndex, idx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err = e.encodeExtraEdges(extraEdges); err != nil {
-		return err
+		return nil, err
 	}
 	if idx.HasGenerationV2() {
 		overflows, err := e.encodeGenerationV2Data(generationV2Data)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if err = e.encodeGenerationV2Overflow(overflows); err != nil {
-			return err
+			return nil, err
 		}
 	}
+	if err = e.encodeOidLookup(layers); err != nil {
+		return nil, err
+	}
 
 	return e.encodeChecksum()
 }
 
-func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[plumbing.Hash]uint32, fanout []uint32, extraEdgesCount uint32, generationV2OverflowCount uint32) {
+func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash, baseCount uint32) (hashToIndex map[plumbing.Hash]uint32, fanout []uint32, extraEdgesCount uint32, generationV2OverflowCount uint32, err error) {
 	// Sort the hashes and build our index
 	plumbing.HashesSort(hashes)
 	hashToIndex = make(map[plumbing.Hash]uint32)
 	fanout = make([]uint32, lenFanout)
 	for i, hash := range hashes {
-		hashToIndex[hash] = uint32(i)
+		hashToIndex[hash] = baseCount + uint32(i)
 		fanout[hash.Bytes()[0]]++
 	}
 
@@ -98,8 +158,11 @@ func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[pl
 	hasGenerationV2 := idx.HasGenerationV2()
 
 	// Find out if we will need extra edge table
-	for i := 0; i < len(hashes); i++ {
-		v, _ := idx.GetCommitDataByIndex(uint32(i))
+	for i := baseCount; i < baseCount+uint32(len(hashes)); i++ {
+		var v *CommitData
+		if v, err = idx.GetCommitDataByIndex(i); err != nil {
+			return
+		}
 		if len(v.ParentHashes) > 2 {
 			extraEdgesCount += uint32(len(v.ParentHashes) - 1)
 		}
@@ -111,13 +174,13 @@ func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[pl
 	return
 }
 
-func (e *Encoder) encodeFileHeader(chunkCount int) (err error) {
+func (e *Encoder) encodeFileHeader(chunkCount, baseCount int) (err error) {
 	if _, err = e.Write(commitFileSignature); err == nil {
 		version := byte(1)
 		if crypto.Hash(e.hash.Size()) == crypto.Hash(crypto.SHA256.Size()) {
 			version = byte(2)
 		}
-		_, err = e.Write([]byte{1, version, byte(chunkCount), 0})
+		_, err = e.Write([]byte{1, version, byte(chunkCount), byte(baseCount)})
 	}
 	return
 }
@@ -169,22 +232,27 @@ func (e *Encoder) encodeCommitData(hashes []plumbing.Hash, hashToIndex map[plumb
 			return
 		}
 
+		parents := make([]uint32, len(commitData.ParentHashes))
+		for i, parentHash := range commitData.ParentHashes {
+			if parents[i], err = parentIndex(parentHash, hashToIndex, idx); err != nil {
+				return
+			}
+		}
+
 		var parent1, parent2 uint32
-		if len(commitData.ParentHashes) == 0 {
+		if len(parents) == 0 {
 			parent1 = parentNone
 			parent2 = parentNone
-		} else if len(commitData.ParentHashes) == 1 {
-			parent1 = hashToIndex[commitData.ParentHashes[0]]
+		} else if len(parents) == 1 {
+			parent1 = parents[0]
 			parent2 = parentNone
-		} else if len(commitData.ParentHashes) == 2 {
-			parent1 = hashToIndex[commitData.ParentHashes[0]]
-			parent2 = hashToIndex[commitData.ParentHashes[1]]
-		} else if len(commitData.ParentHashes) > 2 {
-			parent1 = hashToIndex[commitData.ParentHashes[0]]
+		} else if len(parents) == 2 {
+			parent1 = parents[0]
+			parent2 = parents[1]
+		} else if len(parents) > 2 {
+			parent1 = parents[0]
 			parent2 = uint32(len(extraEdges)) | parentOctopusUsed
-			for _, parentHash := range commitData.ParentHashes[1:] {
-				extraEdges = append(extraEdges, hashToIndex[parentHash])
-			}
+			extraEdges = append(extraEdges, parents[1:]...)
 			extraEdges[len(extraEdges)-1] |= parentLast
 		}
 
@@ -207,6 +275,16 @@ func (e *Encoder) encodeCommitData(hashes []plumbing.Hash, hashToIndex map[plumb
 	return
 }
 
+// parentIndex returns the index of the parent commit h in the written
+// commit-graph, or in the previous layers of the chain.
+func parentIndex(h plumbing.Hash, hashToIndex map[plumbing.Hash]uint32, idx Index) (uint32, error) {
+	if i, ok := hashToIndex[h]; ok {
+		return i, nil
+	}
+
+	return idx.GetIndexByHash(h)
+}
+
 func (e *Encoder) encodeExtraEdges(extraEdges []uint32) (err error) {
 	for _, parent := range extraEdges {
 		if err = binary.WriteUint32(e, parent); err != nil {
@@ -245,7 +323,11 @@ func (e *Encoder) encodeGenerationV2Overflow(overflows []uint64) (err error) {
 	return
 }
 
-func (e *Encoder) encodeChecksum() error {
-	_, err := e.Write(e.hash.Sum(nil)[:e.hash.Size()])
-	return err
+func (e *Encoder) encodeChecksum() ([]byte, error) {
+	sum := e.hash.Sum(nil)[:e.hash.Size()]
+	if _, err := e.Write(sum); err != nil {
+		return nil, err
+	}
+
+	return sum, nil
 }
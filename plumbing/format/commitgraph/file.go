@@ -2,7 +2,6 @@ package commitgraph
 
 import (
 	"bytes"
-	"crypto"
 	encbin "encoding/binary"
 	"errors"
 	"io"
@@ -18,7 +17,7 @@ var (
 	// file version is not supported.
 	ErrUnsupportedVersion = errors.New("unsupported version")
 	// ErrUnsupportedHash is returned by OpenFileIndex when the commit graph
-	// hash function is not supported. Currently only SHA-1 is defined and
+	// hash function is not supported. Only SHA-1 and SHA-256 are defined and
 	// supported.
 	ErrUnsupportedHash = errors.New("unsupported hash algorithm")
 	// ErrMalformedCommitGraphFile is returned by OpenFileIndex when the commit
@@ -72,7 +71,7 @@ func OpenFileIndexWithParent(reader ReaderAtCloser, parent Index) (Index, error)
 	if reader == nil {
 		return nil, io.ErrUnexpectedEOF
 	}
-	fi := &fileIndex{reader: reader, parent: parent, objSize: config.SHA1Size}
+	fi := &fileIndex{reader: reader, parent: parent}
 
 	if err := fi.verifyFileHeader(); err != nil {
 		return nil, err
@@ -129,8 +128,12 @@ func (fi *fileIndex) verifyFileHeader() error {
 	if header[0] != 1 {
 		return ErrUnsupportedVersion
 	}
-	if !(fi.objSize == crypto.SHA1.Size() && header[1] == 1) &&
-		!(fi.objSize == crypto.SHA256.Size() && header[1] == 2) {
+	switch header[1] {
+	case 1:
+		fi.objSize = config.SHA1Size
+	case 2:
+		fi.objSize = config.SHA256Size
+	default:
 		// Unknown hash type / unsupported hash type
 		return ErrUnsupportedHash
 	}
@@ -188,6 +191,7 @@ func (fi *fileIndex) readFanout() error {
 // GetIndexByHash looks up the provided hash in the commit-graph fanout and returns the index of the commit data for the given hash.
 func (fi *fileIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 	var oid plumbing.Hash
+	oid.ResetBySize(fi.objSize)
 
 	// Find the hash in the oid lookup table
 	var low uint32
@@ -245,8 +249,8 @@ func (fi *fileIndex) GetCommitDataByIndex(idx uint32) (*CommitData, error) {
 	offset := fi.offsets[CommitDataChunk] + int64(idx)*int64(fi.objSize+szCommitData)
 	commitDataReader := io.NewSectionReader(fi.reader, offset, int64(fi.objSize+szCommitData))
 
-	// TODO: Add support for SHA256
 	var treeHash plumbing.Hash
+	treeHash.ResetBySize(fi.objSize)
 	_, err := treeHash.ReadFrom(commitDataReader)
 	if err != nil {
 		return nil, err
@@ -347,6 +351,8 @@ func (fi *fileIndex) GetHashByIndex(idx uint32) (found plumbing.Hash, err error)
 		return found, ErrMalformedCommitGraphFile
 	}
 
+	found.ResetBySize(fi.objSize)
+
 	offset := fi.offsets[OIDLookupChunk] + int64(idx)*int64(fi.objSize)
 	if _, err := found.ReadFrom(io.NewSectionReader(fi.reader, offset, int64(found.Size()))); err != nil {
 		return found, err
@@ -378,6 +384,7 @@ func (fi *fileIndex) getHashesFromIndexes(indexes []uint32) ([]plumbing.Hash, er
 		}
 
 		offset := fi.offsets[OIDLookupChunk] + int64(idx)*int64(fi.objSize)
+		hashes[i].ResetBySize(fi.objSize)
 		if _, err := hashes[i].ReadFrom(io.NewSectionReader(fi.reader, offset, int64(hashes[i].Size()))); err != nil {
 			return nil, err
 		}
@@ -399,6 +406,7 @@ func (fi *fileIndex) Hashes() []plumbing.Hash {
 
 	for i := uint32(0); i < fi.fanout[0xff]; i++ {
 		h := &hashes[i+fi.minimumNumberOfHashes]
+		h.ResetBySize(fi.objSize)
 		offset := fi.offsets[OIDLookupChunk] + int64(i)*int64(h.Size())
 		n, err := h.ReadFrom(io.NewSectionReader(fi.reader, offset, int64(h.Size())))
 		if err != nil || n < int64(h.Size()) {
@@ -12,6 +12,10 @@ type MemoryIndex struct {
 	commitData      []commitData
 	indexMap        map[plumbing.Hash]uint32
 	hasGenerationV2 bool
+	parent          Index
+	// minimumNumberOfHashes is the number of commits of the parent, which
+	// come before the ones of the index.
+	minimumNumberOfHashes uint32
 }
 
 type commitData struct {
@@ -21,17 +25,36 @@ type commitData struct {
 
 // NewMemoryIndex creates in-memory commit graph representation
 func NewMemoryIndex() *MemoryIndex {
-	return &MemoryIndex{
+	return NewMemoryIndexWithParent(nil)
+}
+
+// NewMemoryIndexWithParent creates in-memory commit graph representation
+// of the commits added on top of the ones of parent, such as a commit-graph
+// chain, which the added commits may have as parents. The index of the
+// added commits follow the ones of the parent.
+func NewMemoryIndexWithParent(parent Index) *MemoryIndex {
+	mi := &MemoryIndex{
 		indexMap:        make(map[plumbing.Hash]uint32),
 		hasGenerationV2: true,
+		parent:          parent,
 	}
+
+	if parent != nil {
+		mi.minimumNumberOfHashes = parent.MaximumNumberOfHashes()
+	}
+
+	return mi
 }
 
 // GetIndexByHash gets the index in the commit graph from commit hash, if available
 func (mi *MemoryIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 	i, ok := mi.indexMap[h]
 	if ok {
-		return i, nil
+		return i + mi.minimumNumberOfHashes, nil
+	}
+
+	if mi.parent != nil {
+		return mi.parent.GetIndexByHash(h)
 	}
 
 	return 0, plumbing.ErrObjectNotFound
@@ -39,6 +62,11 @@ func (mi *MemoryIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 
 // GetHashByIndex gets the hash given an index in the commit graph
 func (mi *MemoryIndex) GetHashByIndex(i uint32) (plumbing.Hash, error) {
+	if i < mi.minimumNumberOfHashes {
+		return mi.parent.GetHashByIndex(i)
+	}
+
+	i -= mi.minimumNumberOfHashes
 	if i >= uint32(len(mi.commitData)) {
 		return plumbing.ZeroHash, plumbing.ErrObjectNotFound
 	}
@@ -49,6 +77,11 @@ func (mi *MemoryIndex) GetHashByIndex(i uint32) (plumbing.Hash, error) {
 // GetCommitDataByIndex gets the commit node from the commit graph using index
 // obtained from child node, if available
 func (mi *MemoryIndex) GetCommitDataByIndex(i uint32) (*CommitData, error) {
+	if i < mi.minimumNumberOfHashes {
+		return mi.parent.GetCommitDataByIndex(i)
+	}
+
+	i -= mi.minimumNumberOfHashes
 	if i >= uint32(len(mi.commitData)) {
 		return nil, plumbing.ErrObjectNotFound
 	}
@@ -70,9 +103,14 @@ func (mi *MemoryIndex) GetCommitDataByIndex(i uint32) (*CommitData, error) {
 	return commitData.CommitData, nil
 }
 
-// Hashes returns all the hashes that are available in the index
+// Hashes returns all the hashes that are available in the index, including
+// the ones of the parent.
 func (mi *MemoryIndex) Hashes() []plumbing.Hash {
-	hashes := make([]plumbing.Hash, 0, len(mi.indexMap))
+	var hashes []plumbing.Hash
+	if mi.parent != nil {
+		hashes = mi.parent.Hashes()
+	}
+
 	for k := range mi.indexMap {
 		hashes = append(hashes, k)
 	}
@@ -94,14 +132,22 @@ func (mi *MemoryIndex) Add(hash plumbing.Hash, data *CommitData) {
 }
 
 func (mi *MemoryIndex) HasGenerationV2() bool {
+	if mi.parent != nil && !mi.parent.HasGenerationV2() {
+		return false
+	}
+
 	return mi.hasGenerationV2
 }
 
-// Close closes the index
+// Close closes the parent index if it exists.
 func (mi *MemoryIndex) Close() error {
+	if mi.parent != nil {
+		return mi.parent.Close()
+	}
+
 	return nil
 }
 
 func (mi *MemoryIndex) MaximumNumberOfHashes() uint32 {
-	return uint32(len(mi.indexMap))
+	return mi.minimumNumberOfHashes + uint32(len(mi.indexMap))
 }
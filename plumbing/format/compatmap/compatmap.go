@@ -0,0 +1,257 @@
+package compatmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+var (
+	// ErrMalformedMap is returned by Decode when the file is corrupted.
+	ErrMalformedMap = errors.New("malformed compat map file")
+	// ErrUnsupportedVersion is returned by Decode when the version of the
+	// file isn't supported.
+	ErrUnsupportedVersion = errors.New("unsupported compat map version")
+	// ErrUnsupportedHash is returned by Decode when the hash function of the
+	// file isn't supported.
+	ErrUnsupportedHash = errors.New("unsupported compat map hash function")
+)
+
+const (
+	// Extension is the extension of the map files.
+	Extension = "map"
+	// Prefix is the prefix of the name of the map files, followed by their
+	// checksum.
+	Prefix = "compat-"
+
+	signature = "CMAP"
+	version   = 1
+
+	szHeader   = 12
+	szPosition = 4
+)
+
+// Mapping is a bidirectional mapping between the object IDs of a repository
+// and their IDs in its compat object format.
+type Mapping interface {
+	// CompatID returns the compat object ID of the object id.
+	CompatID(id plumbing.Hash) (plumbing.Hash, bool)
+	// ID returns the object ID of the object whose compat object ID is
+	// compat.
+	ID(compat plumbing.Hash) (plumbing.Hash, bool)
+}
+
+// Map is an in-memory Mapping, like the one of the loose object index.
+type Map struct {
+	compat map[plumbing.Hash]plumbing.Hash
+	ids    map[plumbing.Hash]plumbing.Hash
+}
+
+// NewMap returns an empty Map.
+func NewMap() *Map {
+	return &Map{
+		compat: make(map[plumbing.Hash]plumbing.Hash),
+		ids:    make(map[plumbing.Hash]plumbing.Hash),
+	}
+}
+
+// Add maps the object id to the compat object ID compat.
+func (m *Map) Add(id, compat plumbing.Hash) {
+	m.compat[id] = compat
+	m.ids[compat] = id
+}
+
+// CompatID implements Mapping.
+func (m *Map) CompatID(id plumbing.Hash) (plumbing.Hash, bool) {
+	c, ok := m.compat[id]
+	return c, ok
+}
+
+// ID implements Mapping.
+func (m *Map) ID(compat plumbing.Hash) (plumbing.Hash, bool) {
+	id, ok := m.ids[compat]
+	return id, ok
+}
+
+// Len returns the number of mappings.
+func (m *Map) Len() int {
+	return len(m.compat)
+}
+
+// ForEach calls fn for each mapping, sorted by object ID, until it returns
+// an error.
+func (m *Map) ForEach(fn func(id, compat plumbing.Hash) error) error {
+	ids := make([]plumbing.Hash, 0, len(m.compat))
+	for id := range m.compat {
+		ids = append(ids, id)
+	}
+
+	plumbing.HashesSort(ids)
+	for _, id := range ids {
+		if err := fn(id, m.compat[id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// File is a decoded map file.
+type File struct {
+	objectFormat format.ObjectFormat
+	compatFormat format.ObjectFormat
+	count        int
+	ids          []byte
+	compat       []byte
+	positions    []byte
+	checksum     []byte
+}
+
+// Decode reads and decodes the map file of r, verifying its checksum.
+func Decode(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < szHeader || string(data[:4]) != signature {
+		return nil, ErrMalformedMap
+	}
+
+	if data[4] != version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	f := &File{}
+	if f.objectFormat, err = decodeHashVersion(data[5]); err != nil {
+		return nil, err
+	}
+
+	if f.compatFormat, err = decodeHashVersion(data[6]); err != nil {
+		return nil, err
+	}
+
+	h, err := hash.FromObjectFormat(f.objectFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	f.count = int(binary.BigEndian.Uint32(data[8:]))
+	szID, szCompat := f.objectFormat.Size(), f.compatFormat.Size()
+	end := szHeader + f.count*(szID+szCompat+szPosition)
+	if len(data) != end+h.Size() {
+		return nil, ErrMalformedMap
+	}
+
+	h.Write(data[:end])
+	f.checksum = data[end:]
+	if !bytes.Equal(h.Sum(nil), f.checksum) {
+		return nil, ErrMalformedMap
+	}
+
+	f.ids = data[szHeader : szHeader+f.count*szID]
+	f.compat = data[szHeader+f.count*szID : szHeader+f.count*(szID+szCompat)]
+	f.positions = data[szHeader+f.count*(szID+szCompat) : end]
+	for i := 0; i < f.count; i++ {
+		if int(binary.BigEndian.Uint32(f.positions[i*szPosition:])) >= f.count {
+			return nil, ErrMalformedMap
+		}
+	}
+
+	return f, nil
+}
+
+func decodeHashVersion(v byte) (format.ObjectFormat, error) {
+	switch v {
+	case 1:
+		return format.SHA1, nil
+	case 2:
+		return format.SHA256, nil
+	default:
+		return format.SHA1, ErrUnsupportedHash
+	}
+}
+
+// ObjectFormat returns the object format of the object IDs.
+func (f *File) ObjectFormat() format.ObjectFormat {
+	return f.objectFormat
+}
+
+// CompatObjectFormat returns the object format of the compat object IDs.
+func (f *File) CompatObjectFormat() format.ObjectFormat {
+	return f.compatFormat
+}
+
+// Checksum returns the checksum of the file.
+func (f *File) Checksum() []byte {
+	return f.checksum
+}
+
+// Count returns the number of mappings.
+func (f *File) Count() int {
+	return f.count
+}
+
+func (f *File) id(i int) []byte {
+	sz := f.objectFormat.Size()
+	return f.ids[i*sz : (i+1)*sz]
+}
+
+func (f *File) compatID(i int) []byte {
+	sz := f.compatFormat.Size()
+	return f.compat[i*sz : (i+1)*sz]
+}
+
+func (f *File) position(i int) int {
+	return int(binary.BigEndian.Uint32(f.positions[i*szPosition:]))
+}
+
+// CompatID implements Mapping.
+func (f *File) CompatID(id plumbing.Hash) (plumbing.Hash, bool) {
+	b := id.Bytes()
+	i := sort.Search(f.count, func(i int) bool {
+		return bytes.Compare(f.id(i), b) >= 0
+	})
+
+	if i == f.count || !bytes.Equal(f.id(i), b) {
+		return plumbing.ZeroHash, false
+	}
+
+	c, _ := plumbing.FromBytes(f.compatID(i))
+	return c, true
+}
+
+// ID implements Mapping.
+func (f *File) ID(compat plumbing.Hash) (plumbing.Hash, bool) {
+	b := compat.Bytes()
+	i := sort.Search(f.count, func(i int) bool {
+		return bytes.Compare(f.compatID(f.position(i)), b) >= 0
+	})
+
+	if i == f.count || !bytes.Equal(f.compatID(f.position(i)), b) {
+		return plumbing.ZeroHash, false
+	}
+
+	id, _ := plumbing.FromBytes(f.id(f.position(i)))
+	return id, true
+}
+
+// ForEach calls fn for each mapping, sorted by object ID, until it returns
+// an error.
+func (f *File) ForEach(fn func(id, compat plumbing.Hash) error) error {
+	for i := 0; i < f.count; i++ {
+		id, _ := plumbing.FromBytes(f.id(i))
+		c, _ := plumbing.FromBytes(f.compatID(i))
+		if err := fn(id, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
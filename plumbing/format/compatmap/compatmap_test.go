@@ -0,0 +1,135 @@
+package compatmap_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/stretchr/testify/require"
+)
+
+func testMap(n int) *compatmap.Map {
+	m := compatmap.NewMap()
+	for i := 0; i < n; i++ {
+		id := plumbing.ComputeHash(plumbing.BlobObject, []byte(fmt.Sprint(i)))
+		compat := plumbing.NewHash(fmt.Sprintf("%064x", (i*7919)%1000))
+		m.Add(id, compat)
+	}
+
+	return m
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	m := testMap(100)
+
+	var buf bytes.Buffer
+	checksum, err := compatmap.NewEncoder(&buf, format.SHA1, format.SHA256).Encode(m)
+	require.NoError(t, err)
+
+	f, err := compatmap.Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, format.SHA1, f.ObjectFormat())
+	require.Equal(t, format.SHA256, f.CompatObjectFormat())
+	require.Equal(t, checksum.Bytes(), f.Checksum())
+	require.Equal(t, 100, f.Count())
+
+	err = m.ForEach(func(id, compat plumbing.Hash) error {
+		c, ok := f.CompatID(id)
+		require.True(t, ok)
+		require.Equal(t, compat, c)
+
+		h, ok := f.ID(compat)
+		require.True(t, ok)
+		require.Equal(t, id, h)
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, ok := f.CompatID(plumbing.ComputeHash(plumbing.BlobObject, []byte("missing")))
+	require.False(t, ok)
+	_, ok = f.ID(plumbing.NewHash(fmt.Sprintf("%064x", 1000)))
+	require.False(t, ok)
+
+	var ids []plumbing.Hash
+	require.NoError(t, f.ForEach(func(id, _ plumbing.Hash) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	require.Len(t, ids, 100)
+	for i := 1; i < len(ids); i++ {
+		require.Negative(t, ids[i-1].Compare(ids[i].Bytes()))
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	_, err := compatmap.NewEncoder(&buf, format.SHA256, format.SHA1).Encode(compatmap.NewMap())
+	require.NoError(t, err)
+
+	data := buf.Bytes()
+	f, err := compatmap.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, 0, f.Count())
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-1] ^= 0xff
+	_, err = compatmap.Decode(bytes.NewReader(corrupted))
+	require.ErrorIs(t, err, compatmap.ErrMalformedMap)
+
+	corrupted = bytes.Clone(data)
+	corrupted[4] = 2
+	_, err = compatmap.Decode(bytes.NewReader(corrupted))
+	require.ErrorIs(t, err, compatmap.ErrUnsupportedVersion)
+
+	_, err = compatmap.Decode(bytes.NewReader(data[:8]))
+	require.ErrorIs(t, err, compatmap.ErrMalformedMap)
+}
+
+func TestLooseIndex(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, compatmap.EncodeLooseIndex(&buf, testMap(2)))
+
+	extra := compatmap.NewMap()
+	id := plumbing.ComputeHash(plumbing.BlobObject, []byte("0"))
+	compat := plumbing.NewHash(fmt.Sprintf("%064x", 42))
+	extra.Add(id, compat)
+	require.NoError(t, compatmap.AppendLooseIndex(&buf, extra))
+	require.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n"))-1)
+	require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("# loose-object-idx\n")))
+
+	m := compatmap.NewMap()
+	require.NoError(t, compatmap.DecodeLooseIndex(&buf, m))
+	require.Equal(t, 2, m.Len())
+
+	c, ok := m.CompatID(id)
+	require.True(t, ok)
+	require.Equal(t, compat, c)
+
+	h, ok := m.ID(compat)
+	require.True(t, ok)
+	require.Equal(t, id, h)
+}
+
+func TestDecodeLooseIndexMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{
+		"loose-object-idx\n",
+		"# loose-object-idx\nfoo\n",
+		"# loose-object-idx\nfoo bar\n",
+	} {
+		err := compatmap.DecodeLooseIndex(bytes.NewBufferString(data), compatmap.NewMap())
+		require.ErrorIs(t, err, compatmap.ErrMalformedLooseIndex, data)
+	}
+
+	require.NoError(t, compatmap.DecodeLooseIndex(&bytes.Buffer{}, compatmap.NewMap()))
+}
@@ -0,0 +1,29 @@
+// Package compatmap implements encoding and decoding of the object ID
+// mappings of the repositories with a compat object format.
+//
+// A repository whose extensions.compatObjectFormat is set keeps, for each
+// of its objects, the ID the object would have in the compat object format,
+// so it can talk to the remotes using that format. The mappings are stored
+// in two kinds of files of the objects directory.
+//
+// The loose object index, objects/loose-object-idx, is a text file which
+// new mappings are appended to, one per line after a header:
+//
+//	# loose-object-idx
+//	<object ID> <compat object ID>
+//
+// The map files, objects/pack/compat-<checksum>.map, store the mappings of
+// a batch of objects at once, like the objects of a fetched packfile. They
+// are made of a header, the sorted object IDs, the compat object IDs in the
+// same order, the positions of the mappings sorted by compat object ID and
+// a trailing checksum:
+//
+//   - 4-byte signature "CMAP".
+//   - 1-byte version, 1.
+//   - 1-byte hash version of the object IDs, 1 for SHA-1 and 2 for SHA-256.
+//   - 1-byte hash version of the compat object IDs.
+//   - 1-byte padding, 0.
+//   - 4-byte number of mappings.
+//
+// The checksum uses the hash function of the object IDs.
+package compatmap
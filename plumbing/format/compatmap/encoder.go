@@ -0,0 +1,90 @@
+package compatmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+// Encoder writes map files.
+type Encoder struct {
+	w            io.Writer
+	objectFormat format.ObjectFormat
+	compatFormat format.ObjectFormat
+}
+
+// NewEncoder returns an Encoder writing to w the map files of the objects
+// of the object format f, whose compat object format is compat.
+func NewEncoder(w io.Writer, f, compat format.ObjectFormat) *Encoder {
+	return &Encoder{w: w, objectFormat: f, compatFormat: compat}
+}
+
+// Encode writes the mappings of m, returning the checksum of the file.
+func (e *Encoder) Encode(m *Map) (plumbing.Hash, error) {
+	var ids, compat []byte
+	var compatIDs []plumbing.Hash
+	err := m.ForEach(func(id, c plumbing.Hash) error {
+		if id.Size() != e.objectFormat.Size() || c.Size() != e.compatFormat.Size() {
+			return fmt.Errorf("%w: %s %s", ErrUnsupportedHash, id, c)
+		}
+
+		ids = append(ids, id.Bytes()...)
+		compat = append(compat, c.Bytes()...)
+		compatIDs = append(compatIDs, c)
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	positions := make([]int, len(compatIDs))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	sort.Slice(positions, func(i, j int) bool {
+		return compatIDs[positions[i]].Compare(compatIDs[positions[j]].Bytes()) < 0
+	})
+
+	h, err := hash.FromObjectFormat(e.objectFormat)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	header := []byte(signature)
+	header = append(header, version, hashVersion(e.objectFormat), hashVersion(e.compatFormat), 0)
+	header = binary.BigEndian.AppendUint32(header, uint32(m.Len()))
+
+	pos := make([]byte, 0, len(positions)*szPosition)
+	for _, p := range positions {
+		pos = binary.BigEndian.AppendUint32(pos, uint32(p))
+	}
+
+	w := io.MultiWriter(e.w, h)
+	for _, data := range [][]byte{header, ids, compat, pos} {
+		if _, err := w.Write(data); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	sum := h.Sum(nil)
+	if _, err := e.w.Write(sum); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	checksum, _ := plumbing.FromBytes(sum)
+	return checksum, nil
+}
+
+func hashVersion(f format.ObjectFormat) byte {
+	if f == format.SHA256 {
+		return 2
+	}
+
+	return 1
+}
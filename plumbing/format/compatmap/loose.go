@@ -0,0 +1,74 @@
+package compatmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// LooseIndexFileName is the name of the loose object index in the objects
+// directory.
+const LooseIndexFileName = "loose-object-idx"
+
+const looseIndexHeader = "# loose-object-idx"
+
+// ErrMalformedLooseIndex is returned by DecodeLooseIndex when the loose
+// object index is corrupted.
+var ErrMalformedLooseIndex = errors.New("malformed loose object index")
+
+// DecodeLooseIndex reads the loose object index of r, adding its mappings
+// to m. The later mappings of an object replace the earlier ones.
+func DecodeLooseIndex(r io.Reader, m *Map) error {
+	s := bufio.NewScanner(r)
+	if !s.Scan() {
+		return s.Err()
+	}
+
+	if s.Text() != looseIndexHeader {
+		return ErrMalformedLooseIndex
+	}
+
+	for s.Scan() {
+		id, compat, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrMalformedLooseIndex, s.Text())
+		}
+
+		h, ok := plumbing.FromHex(id)
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrMalformedLooseIndex, s.Text())
+		}
+
+		c, ok := plumbing.FromHex(compat)
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrMalformedLooseIndex, s.Text())
+		}
+
+		m.Add(h, c)
+	}
+
+	return s.Err()
+}
+
+// EncodeLooseIndex writes the loose object index of the mappings of m,
+// starting with its header.
+func EncodeLooseIndex(w io.Writer, m *Map) error {
+	if _, err := fmt.Fprintln(w, looseIndexHeader); err != nil {
+		return err
+	}
+
+	return AppendLooseIndex(w, m)
+}
+
+// AppendLooseIndex writes the mappings of m to w, to be appended to an
+// existing loose object index.
+func AppendLooseIndex(w io.Writer, m *Map) error {
+	return m.ForEach(func(id, compat plumbing.Hash) error {
+		_, err := fmt.Fprintf(w, "%s %s\n", id, compat)
+		return err
+	})
+}
@@ -12,18 +12,23 @@ import (
 type Encoder struct {
 	io.Writer
 	hash hash.Hash
+	w    io.Writer
 }
 
 // NewEncoder returns a new stream encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
-	// TODO: Support passing an ObjectFormat (sha256)
-	h := hash.New(crypto.SHA1)
-	mw := io.MultiWriter(w, h)
-	return &Encoder{mw, h}
+	return &Encoder{w: w}
 }
 
-// Encode encodes an MemoryIndex to the encoder writer.
+// Encode encodes an MemoryIndex to the encoder writer. The checksum of the
+// index uses the hash function of the object IDs of idx.
 func (e *Encoder) Encode(idx *MemoryIndex) (int, error) {
+	e.hash = hash.New(crypto.SHA1)
+	if idx.idSize() == crypto.SHA256.Size() {
+		e.hash = hash.New(crypto.SHA256)
+	}
+	e.Writer = io.MultiWriter(e.w, e.hash)
+
 	flow := []func(*MemoryIndex) (int, error){
 		e.encodeHeader,
 		e.encodeFanout,
@@ -135,6 +140,7 @@ func (e *Encoder) encodeChecksums(idx *MemoryIndex) (int, error) {
 		return 0, err
 	}
 
+	idx.IdxChecksum.ResetBySize(idx.idSize())
 	if _, err := idx.IdxChecksum.Write(e.hash.Sum(nil)[:e.hash.Size()]); err != nil {
 		return 0, err
 	}
@@ -222,7 +222,9 @@ func (idx *MemoryIndex) genOffsetHash() error {
 	for firstLevel, fanoutValue := range idx.Fanout {
 		mappedFirstLevel := idx.FanoutMapping[firstLevel]
 		for secondLevel := uint32(0); i < fanoutValue; i++ {
-			hash.Write(idx.Names[mappedFirstLevel][secondLevel*uint32(idx.idSize()):])
+			pos := secondLevel * uint32(idx.idSize())
+			hash.ResetBySize(idx.idSize())
+			hash.Write(idx.Names[mappedFirstLevel][pos : pos+uint32(idx.idSize())])
 			offset := int64(idx.getOffset(mappedFirstLevel, int(secondLevel)))
 			idx.offsetHash[offset] = hash
 			secondLevel++
@@ -307,7 +309,9 @@ func (i *idxfileEntryIter) Next() (*Entry, error) {
 
 		mappedFirstLevel := i.idx.FanoutMapping[i.firstLevel]
 		entry := new(Entry)
-		entry.Hash.Write(i.idx.Names[mappedFirstLevel][i.secondLevel*i.idx.idSize():])
+		pos := i.secondLevel * i.idx.idSize()
+		entry.Hash.ResetBySize(i.idx.idSize())
+		entry.Hash.Write(i.idx.Names[mappedFirstLevel][pos : pos+i.idx.idSize()])
 		entry.Offset = i.idx.getOffset(mappedFirstLevel, i.secondLevel)
 		entry.CRC32 = i.idx.getCRC32(mappedFirstLevel, i.secondLevel)
 
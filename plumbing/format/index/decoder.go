@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/utils/binary"
 )
@@ -30,7 +31,9 @@ var (
 )
 
 const (
-	entryHeaderLength = 62
+	// entryHeaderLength is the length of the fixed-size fields of an entry,
+	// its object ID excluded.
+	entryHeaderLength = 42
 	entryExtended     = 0x4000
 	entryValid        = 0x8000
 	nameMask          = 0xfff
@@ -48,10 +51,37 @@ type Decoder struct {
 	extReader *bufio.Reader
 }
 
+// Option configures an Encoder or a Decoder.
+type Option func(*options)
+
+type options struct {
+	objectFormat format.ObjectFormat
+}
+
+// WithObjectFormat sets the object format of the index, the one of the
+// object IDs of its entries and of its checksum, SHA-1 by default.
+func WithObjectFormat(f format.ObjectFormat) Option {
+	return func(o *options) {
+		o.objectFormat = f
+	}
+}
+
+func newHash(opts []Option) hash.Hash {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.objectFormat == format.SHA256 {
+		return hash.New(crypto.SHA256)
+	}
+
+	return hash.New(crypto.SHA1)
+}
+
 // NewDecoder returns a new decoder that reads from r.
-func NewDecoder(r io.Reader) *Decoder {
-	// TODO: Support passing an ObjectFormat (sha256)
-	h := hash.New(crypto.SHA1)
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	h := newHash(opts)
 	buf := bufio.NewReader(r)
 	return &Decoder{
 		buf:       buf,
@@ -117,6 +147,7 @@ func (d *Decoder) readEntry(idx *Index) (*Entry, error) {
 		return nil, err
 	}
 
+	e.Hash.ResetBySize(d.hash.Size())
 	if _, err := e.Hash.ReadFrom(d.r); err != nil {
 		return nil, err
 	}
@@ -125,7 +156,7 @@ func (d *Decoder) readEntry(idx *Index) (*Entry, error) {
 		return nil, err
 	}
 
-	read := entryHeaderLength
+	read := entryHeaderLength + d.hash.Size()
 
 	if sec != 0 || nsec != 0 {
 		e.CreatedAt = time.Unix(int64(sec), int64(nsec))
@@ -263,19 +294,19 @@ func (d *Decoder) readExtension(idx *Index) error {
 	switch {
 	case bytes.Equal(header[:], treeExtSignature):
 		idx.Cache = &Tree{}
-		d := &treeExtensionDecoder{r}
+		d := &treeExtensionDecoder{r, d.hash.Size()}
 		if err := d.Decode(idx.Cache); err != nil {
 			return err
 		}
 	case bytes.Equal(header[:], resolveUndoExtSignature):
 		idx.ResolveUndo = &ResolveUndo{}
-		d := &resolveUndoDecoder{r}
+		d := &resolveUndoDecoder{r, d.hash.Size()}
 		if err := d.Decode(idx.ResolveUndo); err != nil {
 			return err
 		}
 	case bytes.Equal(header[:], endOfIndexEntryExtSignature):
 		idx.EndOfIndexEntry = &EndOfIndexEntry{}
-		d := &endOfIndexEntryDecoder{r}
+		d := &endOfIndexEntryDecoder{r, d.hash.Size()}
 		if err := d.Decode(idx.EndOfIndexEntry); err != nil {
 			return err
 		}
@@ -308,6 +339,7 @@ func (d *Decoder) getExtensionReader() (*bufio.Reader, error) {
 func (d *Decoder) readChecksum(expected []byte) error {
 	var h plumbing.Hash
 
+	h.ResetBySize(d.hash.Size())
 	if _, err := h.ReadFrom(d.r); err != nil {
 		return err
 	}
@@ -342,7 +374,8 @@ func validateHeader(r io.Reader) (version uint32, err error) {
 }
 
 type treeExtensionDecoder struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	idSize int
 }
 
 func (d *treeExtensionDecoder) Decode(t *Tree) error {
@@ -402,6 +435,7 @@ func (d *treeExtensionDecoder) readEntry() (*TreeEntry, error) {
 	}
 
 	e.Trees = i
+	e.Hash.ResetBySize(d.idSize)
 	_, err = e.Hash.ReadFrom(d.r)
 	if err != nil {
 		return nil, err
@@ -410,7 +444,8 @@ func (d *treeExtensionDecoder) readEntry() (*TreeEntry, error) {
 }
 
 type resolveUndoDecoder struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	idSize int
 }
 
 func (d *resolveUndoDecoder) Decode(ru *ResolveUndo) error {
@@ -448,6 +483,7 @@ func (d *resolveUndoDecoder) readEntry() (*ResolveUndoEntry, error) {
 
 	for s := range e.Stages {
 		var h plumbing.Hash
+		h.ResetBySize(d.idSize)
 		if _, err := h.ReadFrom(d.r); err != nil {
 			return nil, err
 		}
@@ -477,7 +513,8 @@ func (d *resolveUndoDecoder) readStage(e *ResolveUndoEntry, s Stage) error {
 }
 
 type endOfIndexEntryDecoder struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	idSize int
 }
 
 func (d *endOfIndexEntryDecoder) Decode(e *EndOfIndexEntry) error {
@@ -487,6 +524,7 @@ func (d *endOfIndexEntryDecoder) Decode(e *EndOfIndexEntry) error {
 		return err
 	}
 
+	e.Hash.ResetBySize(d.idSize)
 	_, err = e.Hash.ReadFrom(d.r)
 	return err
 }
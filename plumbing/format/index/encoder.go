@@ -2,7 +2,6 @@ package index
 
 import (
 	"bytes"
-	"crypto"
 	"errors"
 	"fmt"
 	"io"
@@ -32,9 +31,8 @@ type Encoder struct {
 }
 
 // NewEncoder returns a new encoder that writes to w.
-func NewEncoder(w io.Writer) *Encoder {
-	// TODO: Support passing an ObjectFormat (sha256)
-	h := hash.New(crypto.SHA1)
+func NewEncoder(w io.Writer, opts ...Option) *Encoder {
+	h := newHash(opts)
 	mw := io.MultiWriter(w, h)
 	return &Encoder{mw, h, nil}
 }
@@ -79,7 +77,7 @@ func (e *Encoder) encodeEntries(idx *Index) error {
 		if err := e.encodeEntry(idx, entry); err != nil {
 			return err
 		}
-		entryLength := entryHeaderLength
+		entryLength := entryHeaderLength + e.hash.Size()
 		if entry.IntentToAdd || entry.SkipWorktree {
 			entryLength += 2
 		}
@@ -104,6 +102,11 @@ func (e *Encoder) encodeEntry(idx *Index, entry *Entry) error {
 		return err
 	}
 
+	// The object ID has the size of the object format of the index, whatever
+	// the one of the entry, as for the zero hash of the intent-to-add entries.
+	id := make([]byte, e.hash.Size())
+	copy(id, entry.Hash.Bytes())
+
 	flags := uint16(entry.Stage&0x3) << 12
 	if l := len(entry.Name); l < nameMask {
 		flags |= uint16(l)
@@ -120,7 +123,7 @@ func (e *Encoder) encodeEntry(idx *Index, entry *Entry) error {
 		entry.UID,
 		entry.GID,
 		entry.Size,
-		entry.Hash.Bytes(),
+		id,
 	}
 
 	flagsFlow := []interface{}{flags}
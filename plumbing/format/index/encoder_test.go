@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -56,6 +57,43 @@ func TestEncode(t *testing.T) {
 
 }
 
+func TestEncodeSHA256(t *testing.T) {
+	for _, version := range []uint32{2, 4} {
+		idx := &Index{
+			Version: version,
+			Entries: []*Entry{{
+				CreatedAt:  time.Now(),
+				ModifiedAt: time.Now(),
+				Size:       12,
+				Hash:       plumbing.NewHash("ca505bc4d562eed2fe8e6842bc345a244a1ffa9b01be21cad66f5f1de6a71dfe"),
+				Name:       "foo",
+			}, {
+				CreatedAt:    time.Now(),
+				ModifiedAt:   time.Now(),
+				Name:         "bar",
+				IntentToAdd:  true,
+				SkipWorktree: true,
+			}},
+		}
+
+		buf := bytes.NewBuffer(nil)
+		e := NewEncoder(buf, WithObjectFormat(format.SHA256))
+		require.NoError(t, e.Encode(idx))
+
+		output := &Index{}
+		d := NewDecoder(buf, WithObjectFormat(format.SHA256))
+		require.NoError(t, d.Decode(output))
+
+		require.Len(t, output.Entries, 2)
+		assert.Equal(t, "bar", output.Entries[0].Name)
+		assert.True(t, output.Entries[0].IntentToAdd)
+		assert.Equal(t, format.SHA256Size, output.Entries[0].Hash.Size())
+		assert.True(t, output.Entries[0].Hash.IsZero())
+		assert.Equal(t, "foo", output.Entries[1].Name)
+		assert.Equal(t, idx.Entries[1].Hash.String(), output.Entries[1].Hash.String())
+	}
+}
+
 func TestEncodeV4(t *testing.T) {
 	idx := &Index{
 		Version: 4,
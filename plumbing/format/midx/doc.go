@@ -0,0 +1,18 @@
+// Package midx implements encoding and decoding of multi-pack-index files.
+//
+// A multi-pack-index indexes the objects of several packfiles of the same
+// object directory, so an object is looked up once instead of once per
+// packfile index. It's stored at objects/pack/multi-pack-index, and made of
+// a header, a table of contents of chunks and a trailing checksum:
+//
+//   - PNAM: the names of the indexes of the packfiles, sorted.
+//   - OIDF: the fanout table of the object IDs.
+//   - OIDL: the sorted object IDs.
+//   - OOFF: the packfile of each object, and its offset in it.
+//   - LOFF: the offsets which don't fit in 31 bits, if any.
+//
+// When an object is in several packfiles, only one of them is indexed.
+//
+// See https://git-scm.com/docs/gitformat-pack#_multi_pack_index_midx_files_have_the_following_format
+// for the format specification.
+package midx
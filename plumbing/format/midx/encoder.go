@@ -0,0 +1,186 @@
+package midx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+// Pack is a packfile to index.
+type Pack struct {
+	// Name is the name of the index of the packfile, such as
+	// pack-<hash>.idx.
+	Name string
+	// Index is the index of the packfile.
+	Index idxfile.Index
+}
+
+// Encoder writes multi-pack-index files.
+type Encoder struct {
+	w            io.Writer
+	objectFormat format.ObjectFormat
+}
+
+// NewEncoder returns an Encoder writing to w the multi-pack-index files of
+// the given object format.
+func NewEncoder(w io.Writer, f format.ObjectFormat) *Encoder {
+	return &Encoder{w: w, objectFormat: f}
+}
+
+// Encode writes the multi-pack-index of packs. When an object is in several
+// packfiles, the first one of packs is indexed, so they should be sorted
+// from the preferred one, usually the newest.
+func (e *Encoder) Encode(packs []Pack) error {
+	names := make([]string, len(packs))
+	for i, p := range packs {
+		names[i] = p.Name
+	}
+
+	sort.Strings(names)
+	ids := make(map[string]uint32, len(names))
+	for i, name := range names {
+		ids[name] = uint32(i)
+	}
+
+	entries, err := collectEntries(packs, ids)
+	if err != nil {
+		return err
+	}
+
+	var pnam bytes.Buffer
+	for _, name := range names {
+		pnam.WriteString(name)
+		pnam.WriteByte(0)
+	}
+
+	for pnam.Len()%4 != 0 {
+		pnam.WriteByte(0)
+	}
+
+	var fanout [lenFanout]uint32
+	oidl := make([]byte, 0, len(entries)*e.objectFormat.Size())
+	ooff := make([]byte, 0, len(entries)*8)
+	var loff []byte
+	for _, entry := range entries {
+		id := entry.Hash.Bytes()
+		fanout[id[0]]++
+		oidl = append(oidl, id...)
+		ooff = binary.BigEndian.AppendUint32(ooff, entry.Pack)
+		if entry.Offset < uint64(largeOffsetFlag) {
+			ooff = binary.BigEndian.AppendUint32(ooff, uint32(entry.Offset))
+			continue
+		}
+
+		ooff = binary.BigEndian.AppendUint32(ooff, largeOffsetFlag|uint32(len(loff)/szOffset))
+		loff = binary.BigEndian.AppendUint64(loff, entry.Offset)
+	}
+
+	oidf := make([]byte, 0, lenFanout*4)
+	var total uint32
+	for _, n := range fanout {
+		total += n
+		oidf = binary.BigEndian.AppendUint32(oidf, total)
+	}
+
+	type chunk struct {
+		id   [4]byte
+		data []byte
+	}
+
+	chunks := []chunk{
+		{chunkPackNames, pnam.Bytes()},
+		{chunkOIDFanout, oidf},
+		{chunkOIDLookup, oidl},
+		{chunkObjectOffset, ooff},
+	}
+
+	if len(loff) > 0 {
+		chunks = append(chunks, chunk{chunkLargeOffsets, loff})
+	}
+
+	h, err := hash.FromObjectFormat(e.objectFormat)
+	if err != nil {
+		return err
+	}
+
+	oidVersion := byte(1)
+	if e.objectFormat == format.SHA256 {
+		oidVersion = 2
+	}
+
+	header := []byte(signature)
+	header = append(header, version, oidVersion, byte(len(chunks)), 0)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(names)))
+
+	offset := uint64(szHeader + (len(chunks)+1)*szChunkEntry)
+	for _, c := range chunks {
+		header = append(header, c.id[:]...)
+		header = binary.BigEndian.AppendUint64(header, offset)
+		offset += uint64(len(c.data))
+	}
+
+	header = append(header, 0, 0, 0, 0)
+	header = binary.BigEndian.AppendUint64(header, offset)
+
+	w := io.MultiWriter(e.w, h)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		if _, err := w.Write(c.data); err != nil {
+			return err
+		}
+	}
+
+	_, err = e.w.Write(h.Sum(nil))
+	return err
+}
+
+// collectEntries returns the objects of packs sorted by ID, each one in the
+// first packfile containing it.
+func collectEntries(packs []Pack, ids map[string]uint32) ([]Entry, error) {
+	seen := make(map[plumbing.Hash]struct{})
+	var entries []Entry
+	for _, p := range packs {
+		iter, err := p.Index.Entries()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			e, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				iter.Close() //nolint:errcheck
+				return nil, err
+			}
+
+			if _, ok := seen[e.Hash]; ok {
+				continue
+			}
+
+			seen[e.Hash] = struct{}{}
+			entries = append(entries, Entry{Hash: e.Hash, Pack: ids[p.Name], Offset: e.Offset})
+		}
+
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Hash.Compare(entries[j].Hash.Bytes()) < 0
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,304 @@
+package midx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+var (
+	// ErrMalformedMultiPackIndex is returned by Decode when the file is
+	// corrupted.
+	ErrMalformedMultiPackIndex = errors.New("malformed multi-pack-index file")
+	// ErrUnsupportedVersion is returned by Decode when the version of the
+	// file isn't supported.
+	ErrUnsupportedVersion = errors.New("unsupported multi-pack-index version")
+	// ErrUnsupportedHash is returned by Decode when the hash function of the
+	// file isn't supported.
+	ErrUnsupportedHash = errors.New("unsupported multi-pack-index hash function")
+	// ErrIncrementalNotSupported is returned by Decode for the files of an
+	// incremental multi-pack-index chain.
+	ErrIncrementalNotSupported = errors.New("incremental multi-pack-index not supported")
+)
+
+const (
+	// FileName is the name of the multi-pack-index file in the packfiles
+	// directory.
+	FileName = "multi-pack-index"
+
+	signature = "MIDX"
+	version   = 1
+
+	szHeader     = 12
+	szChunkEntry = 12
+	lenFanout    = 256
+	szOffset     = 8
+
+	// largeOffsetFlag is set on the offsets stored in the LOFF chunk.
+	largeOffsetFlag = uint32(1) << 31
+)
+
+var (
+	chunkPackNames    = [4]byte{'P', 'N', 'A', 'M'}
+	chunkOIDFanout    = [4]byte{'O', 'I', 'D', 'F'}
+	chunkOIDLookup    = [4]byte{'O', 'I', 'D', 'L'}
+	chunkObjectOffset = [4]byte{'O', 'O', 'F', 'F'}
+	chunkLargeOffsets = [4]byte{'L', 'O', 'F', 'F'}
+)
+
+// Entry is an object of a multi-pack-index.
+type Entry struct {
+	// Hash is the object ID.
+	Hash plumbing.Hash
+	// Pack is the index of the packfile in PackNames.
+	Pack uint32
+	// Offset is the offset of the object in the packfile.
+	Offset uint64
+}
+
+// MultiPackIndex is a decoded multi-pack-index file.
+type MultiPackIndex struct {
+	objectFormat format.ObjectFormat
+	hashSize     int
+	packNames    []string
+	fanout       [lenFanout]uint32
+	oids         []byte
+	offsets      []byte
+	largeOffsets []byte
+	checksum     []byte
+}
+
+// Decode reads and decodes the multi-pack-index file of r, verifying its
+// checksum.
+func Decode(r io.Reader) (*MultiPackIndex, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < szHeader || string(data[:4]) != signature {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	if data[4] != version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	m := &MultiPackIndex{}
+	switch data[5] {
+	case 1:
+		m.objectFormat = format.SHA1
+	case 2:
+		m.objectFormat = format.SHA256
+	default:
+		return nil, ErrUnsupportedHash
+	}
+
+	if data[7] != 0 {
+		return nil, ErrIncrementalNotSupported
+	}
+
+	m.hashSize = m.objectFormat.Size()
+	if len(data) < szHeader+m.hashSize {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	h, err := hash.FromObjectFormat(m.objectFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(data) - m.hashSize
+	h.Write(data[:end])
+	m.checksum = data[end:]
+	if !bytes.Equal(h.Sum(nil), m.checksum) {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	chunks, err := readChunks(data[:end], int(data[6]))
+	if err != nil {
+		return nil, err
+	}
+
+	packCount := binary.BigEndian.Uint32(data[8:])
+	if err := m.decodePackNames(chunks[chunkPackNames], packCount); err != nil {
+		return nil, err
+	}
+
+	fanout := chunks[chunkOIDFanout]
+	if len(fanout) != lenFanout*4 {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	for i := range m.fanout {
+		m.fanout[i] = binary.BigEndian.Uint32(fanout[i*4:])
+		if i > 0 && m.fanout[i] < m.fanout[i-1] {
+			return nil, ErrMalformedMultiPackIndex
+		}
+	}
+
+	count := int(m.fanout[lenFanout-1])
+	m.oids = chunks[chunkOIDLookup]
+	m.offsets = chunks[chunkObjectOffset]
+	m.largeOffsets = chunks[chunkLargeOffsets]
+	if len(m.oids) != count*m.hashSize || len(m.offsets) != count*8 ||
+		len(m.largeOffsets)%szOffset != 0 {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	return m, nil
+}
+
+// readChunks returns the contents of the chunks of the table of contents.
+func readChunks(data []byte, n int) (map[[4]byte][]byte, error) {
+	if len(data) < szHeader+(n+1)*szChunkEntry {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	chunks := make(map[[4]byte][]byte, n)
+	toc := data[szHeader:]
+	for i := 0; i < n; i++ {
+		var id [4]byte
+		copy(id[:], toc[i*szChunkEntry:])
+		start := binary.BigEndian.Uint64(toc[i*szChunkEntry+4:])
+		end := binary.BigEndian.Uint64(toc[(i+1)*szChunkEntry+4:])
+		if start > end || end > uint64(len(data)) {
+			return nil, ErrMalformedMultiPackIndex
+		}
+
+		chunks[id] = data[start:end]
+	}
+
+	return chunks, nil
+}
+
+func (m *MultiPackIndex) decodePackNames(chunk []byte, count uint32) error {
+	// The chunk is padded with zeros to a multiple of 4 bytes.
+	for _, name := range strings.Split(string(chunk), "\x00") {
+		if name != "" {
+			m.packNames = append(m.packNames, name)
+		}
+	}
+
+	if uint32(len(m.packNames)) != count || !sort.StringsAreSorted(m.packNames) {
+		return ErrMalformedMultiPackIndex
+	}
+
+	return nil
+}
+
+// ObjectFormat returns the object format of the object IDs.
+func (m *MultiPackIndex) ObjectFormat() format.ObjectFormat {
+	return m.objectFormat
+}
+
+// PackNames returns the names of the indexes of the packfiles, such as
+// pack-<hash>.idx, sorted.
+func (m *MultiPackIndex) PackNames() []string {
+	return m.packNames
+}
+
+// Checksum returns the checksum of the file.
+func (m *MultiPackIndex) Checksum() []byte {
+	return m.checksum
+}
+
+// Count returns the number of objects.
+func (m *MultiPackIndex) Count() int {
+	return int(m.fanout[lenFanout-1])
+}
+
+func (m *MultiPackIndex) hash(i int) []byte {
+	return m.oids[i*m.hashSize : (i+1)*m.hashSize]
+}
+
+// find returns the position of the first object ID greater or equal than
+// id, among the ones starting with the same byte.
+func (m *MultiPackIndex) find(id []byte) int {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(m.fanout[id[0]-1])
+	}
+
+	hi := int(m.fanout[id[0]])
+	return lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(m.hash(lo+i), id) >= 0
+	})
+}
+
+// Entry returns the i-th object, in the order of the object IDs.
+func (m *MultiPackIndex) Entry(i int) (Entry, error) {
+	if i < 0 || i >= m.Count() {
+		return Entry{}, plumbing.ErrObjectNotFound
+	}
+
+	h, _ := plumbing.FromBytes(m.hash(i))
+	pack := binary.BigEndian.Uint32(m.offsets[i*8:])
+	offset := binary.BigEndian.Uint32(m.offsets[i*8+4:])
+	e := Entry{Hash: h, Pack: pack, Offset: uint64(offset)}
+	if offset&largeOffsetFlag != 0 {
+		pos := int(offset &^ largeOffsetFlag)
+		if (pos+1)*szOffset > len(m.largeOffsets) {
+			return Entry{}, ErrMalformedMultiPackIndex
+		}
+
+		e.Offset = binary.BigEndian.Uint64(m.largeOffsets[pos*szOffset:])
+	}
+
+	if e.Pack >= uint32(len(m.packNames)) {
+		return Entry{}, ErrMalformedMultiPackIndex
+	}
+
+	return e, nil
+}
+
+// FindOffset returns the packfile and the offset of the object h, or
+// plumbing.ErrObjectNotFound if it isn't indexed.
+func (m *MultiPackIndex) FindOffset(h plumbing.Hash) (pack uint32, offset int64, err error) {
+	id := h.Bytes()
+	if len(id) != m.hashSize {
+		return 0, 0, plumbing.ErrObjectNotFound
+	}
+
+	i := m.find(id)
+	if i >= m.Count() || !bytes.Equal(m.hash(i), id) {
+		return 0, 0, plumbing.ErrObjectNotFound
+	}
+
+	e, err := m.Entry(i)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return e.Pack, int64(e.Offset), nil
+}
+
+// Contains returns true if the object h is indexed.
+func (m *MultiPackIndex) Contains(h plumbing.Hash) bool {
+	_, _, err := m.FindOffset(h)
+	return err == nil
+}
+
+// HashesWithPrefix returns the object IDs starting with prefix.
+func (m *MultiPackIndex) HashesWithPrefix(prefix []byte) []plumbing.Hash {
+	var hashes []plumbing.Hash
+	start, end := 0, m.Count()
+	if len(prefix) > 0 {
+		start = m.find(prefix)
+		end = int(m.fanout[prefix[0]])
+	}
+
+	for i := start; i < end && bytes.HasPrefix(m.hash(i), prefix); i++ {
+		h, _ := plumbing.FromBytes(m.hash(i))
+		hashes = append(hashes, h)
+	}
+
+	return hashes
+}
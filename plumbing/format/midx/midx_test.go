@@ -0,0 +1,164 @@
+package midx_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/midx"
+	"github.com/stretchr/testify/require"
+)
+
+func fixturePack(t *testing.T, f *fixtures.Fixture) midx.Pack {
+	t.Helper()
+
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(f.Idx()).Decode(idx))
+	return midx.Pack{Name: fmt.Sprintf("pack-%s.idx", f.PackfileHash), Index: idx}
+}
+
+func indexEntries(t *testing.T, idx idxfile.Index) []*idxfile.Entry {
+	t.Helper()
+
+	iter, err := idx.Entries()
+	require.NoError(t, err)
+	defer iter.Close() //nolint:errcheck
+
+	var entries []*idxfile.Entry
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return entries
+		}
+
+		require.NoError(t, err)
+		entries = append(entries, e)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	// The packfiles share most of their objects.
+	packs := []midx.Pack{
+		fixturePack(t, fixtures.Basic().ByTag("ref-delta").One()),
+		fixturePack(t, fixtures.Basic().One()),
+		fixturePack(t, fixtures.ByTag("root-reference").One()),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, midx.NewEncoder(&buf, format.SHA1).Encode(packs))
+
+	m, err := midx.Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, format.SHA1, m.ObjectFormat())
+	require.Len(t, m.PackNames(), 3)
+	require.IsIncreasing(t, m.PackNames())
+
+	seen := make(map[plumbing.Hash]bool)
+	for _, p := range packs {
+		for _, e := range indexEntries(t, p.Index) {
+			pack, offset, err := m.FindOffset(e.Hash)
+			require.NoError(t, err)
+
+			if !seen[e.Hash] {
+				// The objects are indexed in the first pack containing them.
+				require.Equal(t, p.Name, m.PackNames()[pack])
+				require.Equal(t, int64(e.Offset), offset)
+			}
+
+			seen[e.Hash] = true
+		}
+	}
+
+	require.Equal(t, len(seen), m.Count())
+
+	var last plumbing.Hash
+	for i := 0; i < m.Count(); i++ {
+		e, err := m.Entry(i)
+		require.NoError(t, err)
+		if i > 0 {
+			require.Positive(t, e.Hash.Compare(last.Bytes()))
+		}
+
+		last = e.Hash
+	}
+
+	_, _, err = m.FindOffset(plumbing.NewHash("0000000000000000000000000000000000000001"))
+	require.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	require.True(t, m.Contains(h))
+	require.Equal(t, []plumbing.Hash{h}, m.HashesWithPrefix(h.Bytes()[:4]))
+	require.Len(t, m.HashesWithPrefix(nil), m.Count())
+}
+
+// largeIndex is an idxfile.Index whose entries have large offsets.
+type largeIndex struct {
+	idxfile.Index
+	entries []*idxfile.Entry
+}
+
+func (i *largeIndex) Entries() (idxfile.EntryIter, error) {
+	return &sliceIter{entries: i.entries}, nil
+}
+
+type sliceIter struct {
+	entries []*idxfile.Entry
+}
+
+func (i *sliceIter) Next() (*idxfile.Entry, error) {
+	if len(i.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	e := i.entries[0]
+	i.entries = i.entries[1:]
+	return e, nil
+}
+
+func (i *sliceIter) Close() error {
+	return nil
+}
+
+func TestLargeOffsets(t *testing.T) {
+	t.Parallel()
+
+	idx := &largeIndex{entries: []*idxfile.Entry{
+		{Hash: plumbing.NewHash("1000000000000000000000000000000000000000"), Offset: 12},
+		{Hash: plumbing.NewHash("2000000000000000000000000000000000000000"), Offset: 1 << 31},
+		{Hash: plumbing.NewHash("3000000000000000000000000000000000000000"), Offset: 1 << 40},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, midx.NewEncoder(&buf, format.SHA1).Encode([]midx.Pack{{Name: "pack-a.idx", Index: idx}}))
+
+	m, err := midx.Decode(&buf)
+	require.NoError(t, err)
+	for _, e := range idx.entries {
+		pack, offset, err := m.FindOffset(e.Hash)
+		require.NoError(t, err)
+		require.Zero(t, pack)
+		require.Equal(t, int64(e.Offset), offset)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, midx.NewEncoder(&buf, format.SHA1).Encode([]midx.Pack{fixturePack(t, fixtures.Basic().One())}))
+
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	_, err := midx.Decode(bytes.NewReader(data))
+	require.ErrorIs(t, err, midx.ErrMalformedMultiPackIndex)
+
+	_, err = midx.Decode(bytes.NewReader([]byte("MIDX")))
+	require.ErrorIs(t, err, midx.ErrMalformedMultiPackIndex)
+}
@@ -18,6 +18,7 @@ var ErrOverflow = errors.New("objfile: declared data length exceeded (overflow)"
 // not close the underlying io.Writer.
 type Writer struct {
 	raw    io.Writer
+	format format.ObjectFormat
 	hasher plumbing.Hasher
 	multi  io.Writer
 	zlib   *zlib.Writer
@@ -33,10 +34,17 @@ type Writer struct {
 // The returned Writer implements io.WriteCloser. Close should be called when
 // finished with the Writer. Close will not close the underlying io.Writer.
 func NewWriter(w io.Writer) *Writer {
+	return NewWriterWithObjectFormat(w, format.SHA1)
+}
+
+// NewWriterWithObjectFormat returns a new Writer writing to w, whose Hash is
+// computed using the given object format.
+func NewWriterWithObjectFormat(w io.Writer, f format.ObjectFormat) *Writer {
 	zlib := sync.GetZlibWriter(w)
 	return &Writer{
-		raw:  w,
-		zlib: zlib,
+		raw:    w,
+		format: f,
+		zlib:   zlib,
 	}
 }
 
@@ -65,7 +73,7 @@ func (w *Writer) WriteHeader(t plumbing.ObjectType, size int64) error {
 func (w *Writer) prepareForWrite(t plumbing.ObjectType, size int64) {
 	w.pending = size
 
-	w.hasher = plumbing.NewHasher(format.SHA1, t, size)
+	w.hasher = plumbing.NewHasher(w.format, t, size)
 	w.multi = io.MultiWriter(w.zlib, w.hasher)
 }
 
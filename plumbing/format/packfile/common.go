@@ -23,19 +23,34 @@ const (
 	maskType        = uint8(112) // 0111 0000
 )
 
+// ParserPackfileWriter is an optional method for the storer.PackfileWriter
+// storers parsing the written packfile, it enables passing them the options
+// of their Parser, such as WithProgress.
+type ParserPackfileWriter interface {
+	// PackfileWriterWithOptions is the same as PackfileWriter, parsing the
+	// packfile with the given options.
+	PackfileWriterWithOptions(opts ...ParserOption) (io.WriteCloser, error)
+}
+
 // UpdateObjectStorage updates the storer with the objects in the given
-// packfile.
-func UpdateObjectStorage(s storer.Storer, packfile io.Reader) error {
+// packfile. The options are passed to the Parser of the packfile, when
+// the storer writes the packfile directly, only if it implements
+// ParserPackfileWriter.
+func UpdateObjectStorage(s storer.Storer, packfile io.Reader, opts ...ParserOption) error {
 	start := time.Now()
 	defer func() {
 		trace.Performance.Printf("performance: %.9f s: update_obj_storage", time.Since(start).Seconds())
 	}()
 
+	if pw, ok := s.(ParserPackfileWriter); ok && len(opts) > 0 {
+		return writePackfile(pw.PackfileWriterWithOptions, packfile, opts...)
+	}
+
 	if pw, ok := s.(storer.PackfileWriter); ok {
 		return WritePackfileToObjectStorage(pw, packfile)
 	}
 
-	p := NewParser(packfile, WithStorage(s))
+	p := NewParser(packfile, append([]ParserOption{WithStorage(s)}, opts...)...)
 
 	_, err := p.Parse()
 	return err
@@ -47,7 +62,17 @@ func WritePackfileToObjectStorage(
 	sw storer.PackfileWriter,
 	packfile io.Reader,
 ) (err error) {
-	w, err := sw.PackfileWriter()
+	return writePackfile(func(...ParserOption) (io.WriteCloser, error) {
+		return sw.PackfileWriter()
+	}, packfile)
+}
+
+func writePackfile(
+	newWriter func(...ParserOption) (io.WriteCloser, error),
+	packfile io.Reader,
+	opts ...ParserOption,
+) (err error) {
+	w, err := newWriter(opts...)
 	if err != nil {
 		return err
 	}
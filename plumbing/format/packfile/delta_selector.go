@@ -9,7 +9,7 @@ import (
 )
 
 const (
-	// deltas based on deltas, how many steps we can do.
+	// deltas based on deltas, how many steps we can do by default.
 	// 50 is the default value used in JGit
 	maxDepth = int64(50)
 )
@@ -22,10 +22,14 @@ var applyDelta = map[plumbing.ObjectType]bool{
 
 type deltaSelector struct {
 	storer storer.EncodedObjectStorer
+	// depth is the maximum length of the delta chains.
+	depth int64
+	// windowMemory limits the size of the objects in the window, if not 0.
+	windowMemory uint64
 }
 
 func newDeltaSelector(s storer.EncodedObjectStorer) *deltaSelector {
-	return &deltaSelector{s}
+	return &deltaSelector{storer: s, depth: maxDepth}
 }
 
 // ObjectsToPack creates a list of ObjectToPack from the hashes
@@ -178,6 +182,11 @@ func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*O
 		return err
 	}
 
+	// The reused delta would make the chain too long.
+	if int64(base.Depth) >= dw.depth {
+		return dw.undeltify(otp)
+	}
+
 	otp.SetDelta(base, otp.Object)
 	return nil
 }
@@ -250,6 +259,7 @@ func (dw *deltaSelector) walk(
 			continue
 		}
 
+		memory := uint64(target.Size())
 		for j := i - 1; j >= 0 && i-j < int(packWindow); j-- {
 			base := objectsToPack[j]
 			// Objects must use only the same type as their delta base.
@@ -259,6 +269,13 @@ func (dw *deltaSelector) walk(
 				break
 			}
 
+			// The window is shrunk to fit in its memory limit, but the
+			// closest object is always tried, like git does.
+			memory += uint64(base.Size())
+			if dw.windowMemory > 0 && memory > dw.windowMemory && j < i-1 {
+				break
+			}
+
 			if err := dw.tryToDeltify(indexMap, base, target); err != nil {
 				return err
 			}
@@ -321,6 +338,11 @@ func (dw *deltaSelector) tryToDeltify(indexMap map[plumbing.Hash]*deltaIndex, ba
 
 func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 	targetDepth int, targetDelta bool) int64 {
+	// No deltas are allowed at all.
+	if dw.depth <= 0 {
+		return 0
+	}
+
 	if !targetDelta {
 		// Any delta should be no more than 50% of the original size
 		// (for text files deflate of whole form should shrink 50%).
@@ -329,7 +351,7 @@ func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 		// Evenly distribute delta size limits over allowed depth.
 		// If src is non-delta (depth = 0), delta <= 50% of original.
 		// If src is almost at limit (9/10), delta <= 10% of original.
-		return n * (maxDepth - int64(baseDepth)) / maxDepth
+		return n * (dw.depth - int64(baseDepth)) / dw.depth
 	}
 
 	// With a delta base chosen any new delta must be "better".
@@ -337,8 +359,9 @@ func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 	d := int64(targetDepth)
 	n := targetSize
 
-	// If target depth is bigger than maxDepth, this delta is not suitable to be used.
-	if d >= maxDepth {
+	// If target depth is bigger than the maximum depth, this delta is not
+	// suitable to be used.
+	if d >= dw.depth {
 		return 0
 	}
 
@@ -347,7 +370,7 @@ func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 	//
 	// If src is near limit (depth=9/10) and base is whole (depth=0)
 	// a new delta dependent on src must be 1/10th the size.
-	return n * (maxDepth - int64(baseDepth)) / (maxDepth - d)
+	return n * (dw.depth - int64(baseDepth)) / (dw.depth - d)
 }
 
 type byTypeAndSize []*ObjectToPack
@@ -238,3 +238,51 @@ func (s *DeltaSelectorSuite) TestMaxDepth() {
 	dsl := s.ds.deltaSizeLimit(0, 0, int(maxDepth), true)
 	s.Equal(int64(0), dsl)
 }
+
+func (s *DeltaSelectorSuite) TestDepth() {
+	hashes := []plumbing.Hash{
+		s.hashes["o1"],
+		s.hashes["o2"],
+		s.hashes["o3"],
+	}
+
+	// The chains can't be longer than one delta, so o3 uses o1 as base.
+	s.ds.depth = 1
+	otp, err := s.ds.ObjectsToPack(hashes, 10)
+	s.NoError(err)
+	s.Len(otp, 3)
+	s.True(otp[1].IsDelta())
+	s.Equal(1, otp[1].Depth)
+	s.True(otp[2].IsDelta())
+	s.Equal(1, otp[2].Depth)
+	s.Equal(otp[0], otp[2].Base)
+
+	s.ds.depth = 0
+	otp, err = s.ds.ObjectsToPack(hashes, 10)
+	s.NoError(err)
+	for _, o := range otp {
+		s.False(o.IsDelta())
+	}
+}
+
+func (s *DeltaSelectorSuite) TestWindowMemory() {
+	hashes := []plumbing.Hash{
+		s.hashes["base"],
+		s.hashes["smallTarget"],
+		s.hashes["target"],
+	}
+
+	// Don't sort, so base is out of the window memory of target, unlike
+	// smallTarget which is the closest object and is always tried.
+	s.ds.windowMemory = 1
+	otp, err := s.ds.objectsToPack(hashes, 10)
+	s.NoError(err)
+	s.NoError(s.ds.walk(otp, 10))
+	s.False(otp[2].IsDelta())
+
+	s.ds.windowMemory = 0
+	otp, err = s.ds.objectsToPack(hashes, 10)
+	s.NoError(err)
+	s.NoError(s.ds.walk(otp, 10))
+	s.True(otp[2].IsDelta())
+}
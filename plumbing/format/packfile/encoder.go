@@ -4,9 +4,11 @@ import (
 	"compress/zlib"
 	"crypto"
 	"fmt"
+	stdhash "hash"
 	"io"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/binary"
@@ -19,7 +21,7 @@ type Encoder struct {
 	selector *deltaSelector
 	w        *offsetWriter
 	zw       *zlib.Writer
-	hasher   plumbing.Hasher
+	hasher   stdhash.Hash
 
 	useRefDeltas bool
 }
@@ -27,21 +29,35 @@ type Encoder struct {
 // NewEncoder creates a new packfile encoder using a specific Writer and
 // EncodedObjectStorer. By default deltas used to generate the packfile will be
 // OFSDeltaObject. To use Reference deltas, set useRefDeltas to true.
-func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool) *Encoder {
-	h := plumbing.Hasher{
-		// TODO: Support passing an ObjectFormat (sha256)
-		Hash: hash.New(crypto.SHA1),
+//
+// The packfile uses the object format of the storage when it implements
+// storer.ObjectFormatStorer, SHA-1 otherwise.
+func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool, opts ...EncoderOption) *Encoder {
+	f := format.SHA1
+	if fs, ok := s.(storer.ObjectFormatStorer); ok {
+		f = fs.ObjectFormat()
+	}
+
+	h, err := hash.FromObjectFormat(f)
+	if err != nil {
+		h = hash.New(crypto.SHA1)
 	}
 	mw := io.MultiWriter(w, h)
 	ow := newOffsetWriter(mw)
 	zw := zlib.NewWriter(mw)
-	return &Encoder{
+	e := &Encoder{
 		selector:     newDeltaSelector(s),
 		w:            ow,
 		zw:           zw,
 		hasher:       h,
 		useRefDeltas: useRefDeltas,
 	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
 }
 
 // Encode creates a packfile containing all the objects referenced in
@@ -200,7 +216,7 @@ func (e *Encoder) entryHead(typeNum plumbing.ObjectType, size int64) error {
 }
 
 func (e *Encoder) footer() (plumbing.Hash, error) {
-	h := e.hasher.Sum()
+	h, _ := plumbing.FromBytes(e.hasher.Sum(nil))
 	_, err := h.WriteTo(e.w)
 	return h, err
 }
@@ -0,0 +1,23 @@
+package packfile
+
+// EncoderOption configures an Encoder.
+type EncoderOption func(*Encoder)
+
+// WithDeltaDepth sets the maximum length of the delta chains, pack.depth in
+// git. Longer chains make a smaller packfile whose objects are slower to
+// read. When not used, it defaults to 50.
+func WithDeltaDepth(depth uint) EncoderOption {
+	return func(e *Encoder) {
+		e.selector.depth = int64(depth)
+	}
+}
+
+// WithWindowMemory limits the size of the objects in the sliding window
+// used for delta compression, pack.windowMemory in git, so fewer objects
+// are compared to the big ones. When not used, or 0, only the size of the
+// window applies.
+func WithWindowMemory(limit uint64) EncoderOption {
+	return func(e *Encoder) {
+		e.selector.windowMemory = limit
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"io"
 	"testing"
 
+	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/storage/memory"
 	"github.com/stretchr/testify/suite"
@@ -91,6 +93,47 @@ func (s *EncoderSuite) TestHashNotFound() {
 	s.ErrorIs(err, plumbing.ErrObjectNotFound)
 }
 
+func (s *EncoderSuite) TestEncodeSHA256() {
+	cfg := config.NewConfig()
+	cfg.Core.RepositoryFormatVersion = format.Version_1
+	cfg.Extensions.ObjectFormat = format.SHA256
+	s.NoError(s.store.SetConfig(cfg))
+	s.enc = NewEncoder(s.buf, s.store, false)
+
+	o := s.store.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	w, err := o.Writer()
+	s.NoError(err)
+	_, err = w.Write([]byte("hello world!"))
+	s.NoError(err)
+	s.NoError(w.Close())
+
+	h, err := s.store.SetEncodedObject(o)
+	s.NoError(err)
+	s.Equal("ca505bc4d562eed2fe8e6842bc345a244a1ffa9b01be21cad66f5f1de6a71dfe", h.String())
+
+	encHash, err := s.enc.Encode([]plumbing.Hash{h}, 10)
+	s.NoError(err)
+	s.Equal(format.SHA256Size, encHash.Size())
+
+	iw := new(idxfile.Writer)
+	p := NewParser(bytes.NewReader(s.buf.Bytes()),
+		WithObjectFormat(format.SHA256),
+		WithScannerObservers(iw),
+	)
+
+	decHash, err := p.Parse()
+	s.NoError(err)
+	s.Equal(encHash, decHash)
+
+	idx, err := iw.Index()
+	s.NoError(err)
+
+	ok, err := idx.Contains(h)
+	s.NoError(err)
+	s.True(ok)
+}
+
 func (s *EncoderSuite) TestDecodeEncodeWithDeltaDecodeREF() {
 	s.enc = NewEncoder(s.buf, s.store, true)
 	s.simpleDeltaTest()
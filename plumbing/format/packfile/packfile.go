@@ -206,12 +206,7 @@ func (p *Packfile) init() error {
 			return
 		}
 
-		var opts []ScannerOption
-		if p.objectIdSize == format.SHA256Size {
-			opts = append(opts, WithSHA256())
-		}
-
-		p.scanner = NewScanner(p.file, opts...)
+		p.scanner = NewScanner(p.file, withObjectFormat(p.objectFormat()))
 		// Validate packfile signature.
 		if !p.scanner.Scan() {
 			p.onceErr = p.scanner.Error()
@@ -293,7 +288,7 @@ func (p *Packfile) objectFromHeader(oh *ObjectHeader) (plumbing.EncodedObject, e
 }
 
 func (p *Packfile) getMemoryObject(oh *ObjectHeader) (plumbing.EncodedObject, error) {
-	var obj = new(plumbing.MemoryObject)
+	var obj = plumbing.NewMemoryObject(p.objectFormat())
 	obj.SetSize(oh.Size)
 	obj.SetType(oh.Type)
 
@@ -350,6 +345,16 @@ func (p *Packfile) getMemoryObject(oh *ObjectHeader) (plumbing.EncodedObject, er
 	return obj, nil
 }
 
+// objectFormat returns the object format of the packfile, which is the one
+// of its object IDs.
+func (p *Packfile) objectFormat() format.ObjectFormat {
+	if p.objectIdSize == format.SHA256Size {
+		return format.SHA256
+	}
+
+	return format.SHA1
+}
+
 // errInvalidWindows is the Windows equivalent to os.ErrInvalid
 const errInvalidWindows = "The parameter is incorrect."
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-git/go-git/v6/plumbing"
 	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/sync"
@@ -34,9 +35,10 @@ type Parser struct {
 	cache         *parserCache
 	lowMemoryMode bool
 
-	scanner   *Scanner
-	observers []Observer
-	hasher    plumbing.Hasher
+	scanner      *Scanner
+	observers    []Observer
+	objectFormat format.ObjectFormat
+	progress     progress.Reporter
 
 	checksum plumbing.Hash
 	m        stdsync.Mutex
@@ -54,16 +56,14 @@ type LowMemoryCapable interface {
 // When a storage is set, the objects are written to storage as they
 // are parsed.
 func NewParser(data io.Reader, opts ...ParserOption) *Parser {
-	p := &Parser{
-		hasher: plumbing.NewHasher(format.SHA1, plumbing.AnyObject, 0),
-	}
+	p := &Parser{}
 	for _, opt := range opts {
 		if opt != nil {
 			opt(p)
 		}
 	}
 
-	p.scanner = NewScanner(data)
+	p.scanner = NewScanner(data, withObjectFormat(p.objectFormat))
 
 	if p.storage != nil {
 		p.scanner.storage = p.storage
@@ -137,6 +137,8 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 	var pendingDeltas []*ObjectHeader
 	var pendingDeltaREFs []*ObjectHeader
 
+	indexing := progress.NewMeter(p.progress, progress.Indexing, 0)
+	var indexed uint64
 	for p.scanner.Scan() {
 		data := p.scanner.Data()
 		switch data.Section {
@@ -145,9 +147,12 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 
 			p.resetCache(int(header.ObjectsQty))
 			p.onHeader(header.ObjectsQty)
+			indexing.SetTotal(uint64(header.ObjectsQty))
 
 		case ObjectSection:
 			oh := data.Value().(ObjectHeader)
+			indexed++
+			indexing.Update(indexed, uint64(p.scanner.scannerReader.offset))
 			if oh.Type.IsDelta() {
 				if oh.Type == plumbing.OFSDeltaObject {
 					pendingDeltas = append(pendingDeltas, &oh)
@@ -173,11 +178,22 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 		return plumbing.ZeroHash, ErrEmptyPackfile
 	}
 
+	if err := p.scanner.Error(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	indexing.Done(indexed, uint64(p.scanner.scannerReader.offset))
+
+	deltas := uint64(len(pendingDeltaREFs) + len(pendingDeltas))
+	resolving := progress.NewMeter(p.progress, progress.Resolving, deltas)
+	var resolved uint64
 	for _, oh := range pendingDeltaREFs {
 		err := p.processDelta(oh)
 		if err != nil {
 			return plumbing.ZeroHash, fmt.Errorf("processing ref-delta at offset %v: %w", oh.Offset, err)
 		}
+		resolved++
+		resolving.Update(resolved, 0)
 	}
 
 	for _, oh := range pendingDeltas {
@@ -185,7 +201,10 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 		if err != nil {
 			return plumbing.ZeroHash, fmt.Errorf("processing ofs-delta at offset %v: %w", oh.Offset, err)
 		}
+		resolved++
+		resolving.Update(resolved, 0)
 	}
+	resolving.Done(resolved, 0)
 
 	// Return to pool all objects used.
 	go func() {
@@ -285,7 +304,7 @@ func (p *Parser) parentReader(parent *ObjectHeader) (io.ReaderAt, error) {
 	// from either cache or storage, else we would need to inflate
 	// it to then inflate the current object, which could go on
 	// indefinitely.
-	if p.storage != nil && parent.Hash != plumbing.ZeroHash {
+	if p.storage != nil && !parent.Hash.IsZero() {
 		obj, err := p.storage.EncodedObject(parent.Type, parent.Hash)
 		if err == nil {
 			// Ensure that external references have the correct type and size.
@@ -343,16 +362,16 @@ func (p *Parser) applyPatchBaseHeader(ota *ObjectHeader, delta io.Reader, target
 	}
 
 	typ := ota.Type
-	if ota.Hash == plumbing.ZeroHash {
+	if ota.Hash.IsZero() {
 		typ = ota.parent.Type
 	}
 
-	sz, h, err := patchDeltaWriter(target, parentContents, delta, typ, wh)
+	sz, h, err := patchDeltaWriter(target, parentContents, delta, typ, p.objectFormat, wh)
 	if err != nil {
 		return err
 	}
 
-	if ota.Hash == plumbing.ZeroHash {
+	if ota.Hash.IsZero() {
 		ota.Type = typ
 		ota.Size = int64(sz)
 		ota.Hash = h
@@ -1,15 +1,30 @@
 package packfile
 
 import (
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 )
 
 type ParserOption func(*Parser)
 
-// WithStorage sets the storage to be used while parsing a pack file.
+// WithStorage sets the storage to be used while parsing a pack file. The
+// object format of the pack file is the one of the storage, when it
+// implements storer.ObjectFormatStorer.
 func WithStorage(storage storer.EncodedObjectStorer) ParserOption {
 	return func(p *Parser) {
 		p.storage = storage
+		if s, ok := storage.(storer.ObjectFormatStorer); ok {
+			p.objectFormat = s.ObjectFormat()
+		}
+	}
+}
+
+// WithObjectFormat sets the object format of the pack file, SHA-1 when not
+// used: the one of its checksum and of the IDs of its objects.
+func WithObjectFormat(f format.ObjectFormat) ParserOption {
+	return func(p *Parser) {
+		p.objectFormat = f
 	}
 }
 
@@ -45,3 +60,11 @@ func WithHighMemoryMode() ParserOption {
 		p.lowMemoryMode = false
 	}
 }
+
+// WithProgress sets the Reporter notified of the progress of the parsing:
+// the indexing of the objects, and the resolution of the deltas.
+func WithProgress(r progress.Reporter) ParserOption {
+	return func(p *Parser) {
+		p.progress = r
+	}
+}
@@ -1,6 +1,7 @@
 package packfile_test
 
 import (
+	"bytes"
 	"io"
 	"reflect"
 	"testing"
@@ -11,7 +12,10 @@ import (
 	"github.com/go-git/go-git/v6"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
@@ -108,6 +112,47 @@ func TestParserHashes(t *testing.T) {
 	}
 }
 
+func TestParserSHA256(t *testing.T) {
+	f := fixtures.ByTag("packfile-sha256").One()
+
+	obs := new(testObserver)
+	w := new(idxfile.Writer)
+	parser := packfile.NewParser(f.Packfile(),
+		packfile.WithObjectFormat(format.SHA256),
+		packfile.WithScannerObservers(obs, w),
+	)
+
+	checksum, err := parser.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, f.PackfileHash, checksum.String())
+
+	hashes := make(map[string]plumbing.ObjectType)
+	for _, o := range obs.objects {
+		hashes[o.hash] = o.otype
+	}
+
+	assert.Equal(t, map[string]plumbing.ObjectType{
+		"233fbe36fbc685c391d6e48049c1e6558a6742dba527281d02896bcba43a8950": plumbing.CommitObject,
+		"0d8d657df872bef9d0684fe4bc4ee3a088b6f0f72d64f951daff9465068905ac": plumbing.CommitObject,
+		"757ba6c738cdd774ea77094c52350acb8de989889a63f90972702ff6c5df69d4": plumbing.BlobObject,
+		"a3490718a0b0e8564981306fcfb3c8e5e5b8dd4c00d477d635350c92c542e15c": plumbing.TreeObject,
+		"fc90aec557362385e83d1f2046e2f8c2d52fdaeb5ba570a5f82b403e12340370": plumbing.TreeObject,
+		"1f307724f91af43be1570b77aeef69c5010e8136e50bef83c28de2918a08f494": plumbing.BlobObject,
+	}, hashes)
+
+	// The index built from the pack is the one written by git.
+	idx, err := w.Index()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = idxfile.NewEncoder(&buf).Encode(idx)
+	require.NoError(t, err)
+
+	expected, err := io.ReadAll(f.Idx())
+	require.NoError(t, err)
+	assert.Equal(t, expected, buf.Bytes())
+}
+
 func TestThinPack(t *testing.T) {
 	// Initialize an empty repository
 	r, err := git.PlainInit(t.TempDir(), true)
@@ -180,6 +225,20 @@ func TestMemoryResolveExternalRefs(t *testing.T) {
 	assert.NotEqual(t, plumbing.ZeroHash, checksum)
 }
 
+func TestParseCorrupted(t *testing.T) {
+	data, err := io.ReadAll(fixtures.Basic().One().Packfile())
+	require.NoError(t, err)
+
+	checksum := append([]byte(nil), data...)
+	checksum[len(checksum)-1] ^= 0xff
+	_, err = packfile.NewParser(bytes.NewReader(checksum)).Parse()
+	assert.ErrorIs(t, err, packfile.ErrMalformedPackfile)
+
+	truncated := data[:len(data)/2]
+	_, err = packfile.NewParser(bytes.NewReader(truncated)).Parse()
+	assert.Error(t, err)
+}
+
 func BenchmarkParseBasic(b *testing.B) {
 	f := fixtures.Basic().One().Packfile()
 	scanner := packfile.NewScanner(f)
@@ -291,3 +350,38 @@ func (t *testObserver) put(pos int64, o observerObject) {
 	t.pos[pos] = len(t.objects)
 	t.objects = append(t.objects, o)
 }
+
+func TestUpdateObjectStorageProgress(t *testing.T) {
+	for name, st := range map[string]storer.Storer{
+		"memory":     memory.NewStorage(),
+		"filesystem": filesystem.NewStorage(osfs.New(t.TempDir()), cache.NewObjectLRUDefault()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var events []progress.Event
+			r := progress.ReporterFunc(func(e progress.Event) {
+				events = append(events, e)
+			})
+
+			f := fixtures.Basic().One()
+			require.NoError(t, packfile.UpdateObjectStorage(st, f.Packfile(), packfile.WithProgress(r)))
+
+			last := make(map[progress.Phase]progress.Event)
+			for _, e := range events {
+				require.LessOrEqual(t, e.Current, e.Total)
+				last[e.Phase] = e
+			}
+
+			require.Len(t, last, 2)
+			indexing := last[progress.Indexing]
+			require.True(t, indexing.Done)
+			require.Equal(t, uint64(31), indexing.Total)
+			require.Equal(t, uint64(31), indexing.Current)
+			require.NotZero(t, indexing.Bytes)
+
+			resolving := last[progress.Resolving]
+			require.True(t, resolving.Done)
+			require.NotZero(t, resolving.Total)
+			require.Equal(t, resolving.Total, resolving.Current)
+		})
+	}
+}
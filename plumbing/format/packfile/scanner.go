@@ -461,6 +461,7 @@ func packFooter(r *Scanner) (stateFn, error) {
 	actual := r.packhash.Sum(nil)
 
 	var checksum plumbing.Hash
+	checksum.ResetBySize(r.packhash.Size())
 	_, err := checksum.ReadFrom(r.scannerReader)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read PACK checksum: %w", ErrMalformedPackfile)
@@ -1,8 +1,12 @@
 package packfile
 
 import (
+	"crypto"
+	"io"
+
 	"github.com/go-git/go-git/v6/plumbing"
 	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	gogithash "github.com/go-git/go-git/v6/plumbing/hash"
 )
 
 type ScannerOption func(*Scanner)
@@ -15,3 +19,19 @@ func WithSHA256() ScannerOption {
 		s.hasher256 = &h
 	}
 }
+
+// withObjectFormat sets the object format of the pack file, used to hash its
+// objects and its checksum, and as the size of the object IDs it refers to.
+func withObjectFormat(f format.ObjectFormat) ScannerOption {
+	return func(s *Scanner) {
+		if f != format.SHA256 {
+			return
+		}
+
+		s.hasher = plumbing.NewHasher(f, plumbing.AnyObject, 0)
+		s.packhash = gogithash.New(crypto.SHA256)
+		s.scannerReader.crc = io.MultiWriter(s.crc, s.packhash)
+		s.scannerReader.wbuf.Reset(s.scannerReader.crc)
+		s.objectIDSize = f.Size()
+	}
+}
@@ -0,0 +1,12 @@
+// Package reflog implements encoding and decoding of reflog files.
+//
+// The reflog of a reference records the successive values of the
+// reference, one line per update, oldest first:
+//
+//	<old-id> SP <new-id> SP <name> SP <<email>> SP <time> SP <tz> TAB <message> LF
+//
+// The reflogs of the files reference backend are stored in the logs
+// directory, e.g. logs/HEAD and logs/refs/heads/main.
+//
+// See https://git-scm.com/docs/git-reflog for more information.
+package reflog
@@ -0,0 +1,157 @@
+package reflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// ErrMalformedEntry is returned by Decode when a line isn't a valid entry.
+var ErrMalformedEntry = errors.New("malformed reflog entry")
+
+// Entry is an update of a reference recorded in its reflog.
+type Entry struct {
+	// Old and New are the values of the reference before and after the
+	// update, Old being the zero hash when the reference was created.
+	Old, New plumbing.Hash
+	// Name and Email identify who updated the reference.
+	Name, Email string
+	// When is the time of the update, in the time zone of the committer.
+	When time.Time
+	// Message describes the update.
+	Message string
+}
+
+// Decode reads and decodes the entries of the reflog r, oldest first. The
+// empty lines are skipped.
+func Decode(r io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		e, err := decodeEntry(line)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func decodeEntry(line []byte) (*Entry, error) {
+	ids := bytes.SplitN(line, []byte{' '}, 3)
+	if len(ids) != 3 {
+		return nil, ErrMalformedEntry
+	}
+
+	oldID, ok := plumbing.FromHex(string(ids[0]))
+	if !ok {
+		return nil, ErrMalformedEntry
+	}
+
+	newID, ok := plumbing.FromHex(string(ids[1]))
+	if !ok || oldID.Size() != newID.Size() {
+		return nil, ErrMalformedEntry
+	}
+
+	e := &Entry{Old: oldID, New: newID}
+	sig := ids[2]
+	if tab := bytes.IndexByte(sig, '\t'); tab >= 0 {
+		e.Message = string(sig[tab+1:])
+		sig = sig[:tab]
+	}
+
+	open := bytes.LastIndexByte(sig, '<')
+	close := bytes.LastIndexByte(sig, '>')
+	if open < 0 || close < open {
+		return nil, ErrMalformedEntry
+	}
+
+	e.Name = string(bytes.TrimSpace(sig[:open]))
+	e.Email = string(sig[open+1 : close])
+
+	when, err := decodeTime(bytes.TrimSpace(sig[close+1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	e.When = when
+	return e, nil
+}
+
+// decodeTime decodes the "<seconds> <tz>" time of an entry.
+func decodeTime(b []byte) (time.Time, error) {
+	ts, tz, ok := bytes.Cut(b, []byte{' '})
+	if !ok || len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return time.Time{}, ErrMalformedEntry
+	}
+
+	sec, err := strconv.ParseInt(string(ts), 10, 64)
+	if err != nil {
+		return time.Time{}, ErrMalformedEntry
+	}
+
+	hours, err1 := strconv.Atoi(string(tz[1:3]))
+	mins, err2 := strconv.Atoi(string(tz[3:]))
+	if err1 != nil || err2 != nil {
+		return time.Time{}, ErrMalformedEntry
+	}
+
+	offset := hours*60*60 + mins*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	return time.Unix(sec, 0).In(time.FixedZone("", offset)), nil
+}
+
+// Encode writes the given entries to w, in the reflog format.
+func Encode(w io.Writer, entries []*Entry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if _, err := bw.WriteString(e.Old.String() + " " + e.New.String() + " "); err != nil {
+			return err
+		}
+
+		sec := e.When.Unix()
+		if sec < 0 {
+			sec = 0
+		}
+
+		if _, err := fmt.Fprintf(bw, "%s <%s> %d %s", e.Name, e.Email, sec, e.When.Format("-0700")); err != nil {
+			return err
+		}
+
+		// The message is a single line, omitted along with its separator
+		// when empty.
+		if msg := strings.ReplaceAll(e.Message, "\n", " "); msg != "" {
+			if _, err := bw.WriteString("\t" + msg); err != nil {
+				return err
+			}
+		}
+
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
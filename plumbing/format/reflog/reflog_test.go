@@ -0,0 +1,55 @@
+package reflog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/stretchr/testify/require"
+)
+
+const log = "0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe <john@example.com> 1427814270 +0200\tclone: from https://github.com/git-fixtures/basic.git\n" +
+	"e8d3ffab552895c19b9fcf7aa264d277cde33881 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@example.com> 1427814290 -0130\n" +
+	"\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 John Doe <john@example.com> 1427814300 +0000\tcommit: message\twith tab\n"
+
+func TestDecodeEncode(t *testing.T) {
+	t.Parallel()
+
+	entries, err := Decode(strings.NewReader(log))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	e := entries[0]
+	require.Equal(t, plumbing.ZeroHash, e.Old)
+	require.Equal(t, plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"), e.New)
+	require.Equal(t, "John Doe", e.Name)
+	require.Equal(t, "john@example.com", e.Email)
+	require.Equal(t, int64(1427814270), e.When.Unix())
+	_, offset := e.When.Zone()
+	require.Equal(t, 2*60*60, offset)
+	require.Equal(t, "clone: from https://github.com/git-fixtures/basic.git", e.Message)
+
+	require.Empty(t, entries[1].Message)
+	require.Equal(t, "commit: message\twith tab", entries[2].Message)
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, entries))
+	require.Equal(t, strings.Replace(log, "\n\n", "\n", 1), buf.String())
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{
+		"foo\n",
+		"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881\n",
+		"0000000000000000000000000000000000000000 zzz John Doe <john@example.com> 1427814270 +0200\n",
+		"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe 1427814270 +0200\n",
+		"0000000000000000000000000000000000000000 e8d3ffab552895c19b9fcf7aa264d277cde33881 John Doe <john@example.com> now\n",
+	} {
+		_, err := Decode(strings.NewReader(line))
+		require.ErrorIs(t, err, ErrMalformedEntry, line)
+	}
+}
@@ -0,0 +1,232 @@
+package reftable
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+const (
+	// blockHeaderSize is the size of the block type and length.
+	blockHeaderSize = 4
+	// restartInterval is the number of records between the restart points,
+	// whose keys aren't prefix compressed.
+	restartInterval = 16
+	// maxRestarts is the maximum number of restart points of a block.
+	maxRestarts = 1<<16 - 1
+)
+
+// blockWriter encodes the records of a block.
+type blockWriter struct {
+	typ byte
+	// headerOff is the size of the file header preceding the first block.
+	headerOff int
+	size      int
+
+	buf      []byte
+	restarts []uint32
+	lastKey  []byte
+	entries  int
+}
+
+func newBlockWriter(typ byte, header []byte, size int) *blockWriter {
+	bw := &blockWriter{typ: typ, headerOff: len(header), size: size}
+	bw.buf = append(bw.buf, header...)
+	bw.buf = append(bw.buf, typ, 0, 0, 0)
+	return bw
+}
+
+// add appends a record to the block, returning false if it doesn't fit.
+func (bw *blockWriter) add(key []byte, extra byte, value []byte) bool {
+	restart := bw.entries%restartInterval == 0 && len(bw.restarts) < maxRestarts
+	last := bw.lastKey
+	restarts := len(bw.restarts)
+	if restart {
+		last = nil
+		restarts++
+	}
+
+	rec := encodeKey(nil, last, key, extra)
+	rec = append(rec, value...)
+	if len(bw.buf)+len(rec)+3*restarts+2 > bw.size {
+		return false
+	}
+
+	if restart {
+		bw.restarts = append(bw.restarts, uint32(len(bw.buf)))
+	}
+
+	bw.buf = append(bw.buf, rec...)
+	bw.lastKey = append(bw.lastKey[:0], key...)
+	bw.entries++
+	return true
+}
+
+// finish returns the encoded block, with the file header for the first
+// block. The log blocks are compressed.
+func (bw *blockWriter) finish() ([]byte, error) {
+	for _, r := range bw.restarts {
+		var b [3]byte
+		putUint24(b[:], r)
+		bw.buf = append(bw.buf, b[:]...)
+	}
+
+	bw.buf = binary.BigEndian.AppendUint16(bw.buf, uint16(len(bw.restarts)))
+	putUint24(bw.buf[bw.headerOff+1:], uint32(len(bw.buf)))
+	if bw.typ != blockTypeLog {
+		return bw.buf, nil
+	}
+
+	start := bw.headerOff + blockHeaderSize
+	var compressed bytes.Buffer
+	compressed.Write(bw.buf[:start])
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(bw.buf[start:]); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+// blockReader decodes the records of a block.
+type blockReader struct {
+	typ byte
+	// data is the block, uncompressed and up to the restart points.
+	data []byte
+	// headerOff is the size of the file header preceding the first block.
+	headerOff int
+	// restarts are the offsets of the restart points.
+	restarts []uint32
+	// size is the number of bytes taken by the block in the file, including
+	// the padding.
+	size int
+}
+
+// readBlock decodes the block of data at off. headerOff is the size of the
+// file header preceding the block and blockSize the block size of the
+// table, zero for unaligned tables.
+func readBlock(data []byte, off, headerOff, blockSize int) (*blockReader, error) {
+	start := off + headerOff
+	if start+blockHeaderSize > len(data) {
+		return nil, ErrMalformedTable
+	}
+
+	br := &blockReader{typ: data[start], headerOff: headerOff}
+	blockLen := int(uint24(data[start+1:]))
+	if blockLen < headerOff+blockHeaderSize+2 {
+		return nil, ErrMalformedTable
+	}
+
+	if br.typ == blockTypeLog {
+		src := bytes.NewReader(data[start+blockHeaderSize:])
+		zr, err := zlib.NewReader(src)
+		if err != nil {
+			return nil, ErrMalformedTable
+		}
+
+		block := make([]byte, blockLen)
+		copy(block, data[off:start+blockHeaderSize])
+		if _, err := io.ReadFull(zr, block[headerOff+blockHeaderSize:]); err != nil {
+			return nil, ErrMalformedTable
+		}
+
+		// Reading past the end of the stream checks its checksum. As src is
+		// an io.ByteReader, the decompressor doesn't read ahead, so what's
+		// left of src is the next block.
+		if n, err := zr.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			return nil, ErrMalformedTable
+		}
+
+		br.data = block
+		br.size = len(data) - off - src.Len()
+	} else {
+		if off+blockLen > len(data) {
+			return nil, ErrMalformedTable
+		}
+
+		br.data = data[off : off+blockLen]
+		br.size = blockLen
+		// The blocks are padded to the block size, unless the table is
+		// unaligned and the next block follows immediately.
+		if blockSize > 0 && blockLen < blockSize &&
+			(off+blockLen >= len(data) || data[off+blockLen] == 0) {
+			br.size = blockSize
+		}
+	}
+
+	n := int(binary.BigEndian.Uint16(br.data[len(br.data)-2:]))
+	restartsOff := len(br.data) - 2 - 3*n
+	if n == 0 || restartsOff < headerOff+blockHeaderSize {
+		return nil, ErrMalformedTable
+	}
+
+	br.restarts = make([]uint32, n)
+	for i := range br.restarts {
+		br.restarts[i] = uint24(br.data[restartsOff+3*i:])
+		if int(br.restarts[i]) >= restartsOff {
+			return nil, ErrMalformedTable
+		}
+	}
+
+	br.data = br.data[:restartsOff]
+	return br, nil
+}
+
+// iter returns an iterator over the records of the block.
+func (br *blockReader) iter() *blockIter {
+	return &blockIter{c: cursor{b: br.data, off: br.headerOff + blockHeaderSize}}
+}
+
+// seek returns an iterator starting at the restart point preceding the
+// first record with a key greater or equal than want.
+func (br *blockReader) seek(want []byte) (*blockIter, error) {
+	var err error
+	i := sort.Search(len(br.restarts), func(i int) bool {
+		c := cursor{b: br.data, off: int(br.restarts[i])}
+		key, _, kerr := c.key(nil)
+		if kerr != nil {
+			err = kerr
+			return true
+		}
+
+		return bytes.Compare(key, want) > 0
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	it := br.iter()
+	if i > 0 {
+		it.c.off = int(br.restarts[i-1])
+	}
+
+	return it, nil
+}
+
+// blockIter iterates over the records of a block. next decodes the key of
+// the next record, leaving the cursor at its value, which must be decoded
+// before calling next again.
+type blockIter struct {
+	c   cursor
+	key []byte
+}
+
+func (it *blockIter) next() (extra byte, ok bool, err error) {
+	if it.c.off >= len(it.c.b) {
+		return 0, false, nil
+	}
+
+	it.key, extra, err = it.c.key(it.key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return extra, true, nil
+}
@@ -0,0 +1,14 @@
+// Package reftable implements encoding and decoding of reftable files, the
+// reference storage format enabled by extensions.refStorage=reftable.
+//
+// A reftable is an immutable file of sorted reference and reflog records,
+// split in blocks with prefix compressed keys and restart points for binary
+// searching, and optionally indexed. The reflog blocks are compressed with
+// zlib. A repository stores its references in a stack of tables, listed
+// oldest first in the tables.list file of the reftable directory, where the
+// records of the newer tables override the ones of the older tables. Each
+// update of the references adds a table to the stack, and the tables are
+// compacted to keep their number logarithmic.
+//
+// See https://git-scm.com/docs/reftable for the format specification.
+package reftable
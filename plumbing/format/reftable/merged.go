@@ -0,0 +1,190 @@
+package reftable
+
+import (
+	"io"
+	"strings"
+)
+
+// Merged is the merged view of a stack of tables, where the records of the
+// newer tables override the ones of the older tables.
+type Merged struct {
+	// tables are sorted from the oldest to the newest.
+	tables []*Table
+}
+
+// NewMerged returns the merged view of tables, sorted from the oldest to the
+// newest.
+func NewMerged(tables []*Table) *Merged {
+	return &Merged{tables: tables}
+}
+
+// Tables returns the tables, from the oldest to the newest.
+func (m *Merged) Tables() []*Table {
+	return m.tables
+}
+
+// MaxUpdateIndex returns the maximum update index of the tables.
+func (m *Merged) MaxUpdateIndex() uint64 {
+	if len(m.tables) == 0 {
+		return 0
+	}
+
+	return m.tables[len(m.tables)-1].MaxUpdateIndex()
+}
+
+// Ref returns the reference record of name, or nil if it doesn't exist or
+// has been deleted.
+func (m *Merged) Ref(name string) (*RefRecord, error) {
+	for i := len(m.tables) - 1; i >= 0; i-- {
+		r, err := m.tables[i].Ref(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if r == nil {
+			continue
+		}
+
+		if r.Type == RefValueDeletion {
+			return nil, nil
+		}
+
+		return r, nil
+	}
+
+	return nil, nil
+}
+
+// Refs returns an iterator over the reference records, sorted by name,
+// excluding the deleted ones.
+func (m *Merged) Refs() (RefIter, error) {
+	return m.refs(false)
+}
+
+func (m *Merged) refs(deletions bool) (RefIter, error) {
+	it := &mergedRefIter{deletions: deletions}
+	for _, t := range m.tables {
+		ti := t.Refs()
+		r, err := ti.Next()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		it.iters = append(it.iters, ti)
+		it.heads = append(it.heads, r)
+	}
+
+	return it, nil
+}
+
+// Logs returns an iterator over the log records, sorted by name and from the
+// newest to the oldest, excluding the deleted ones.
+func (m *Merged) Logs() (LogIter, error) {
+	return m.logs(false, func(t *Table) (LogIter, error) { return t.Logs(), nil })
+}
+
+// RefLogs returns an iterator over the log records of name, from the newest
+// to the oldest, excluding the deleted ones.
+func (m *Merged) RefLogs(name string) (LogIter, error) {
+	return m.logs(false, func(t *Table) (LogIter, error) { return t.RefLogs(name) })
+}
+
+func (m *Merged) logs(deletions bool, iter func(*Table) (LogIter, error)) (LogIter, error) {
+	it := &mergedLogIter{deletions: deletions}
+	for _, t := range m.tables {
+		ti, err := iter(t)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := ti.Next()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		it.iters = append(it.iters, ti)
+		it.heads = append(it.heads, r)
+	}
+
+	return it, nil
+}
+
+type mergedRefIter struct {
+	// iters and heads are sorted from the oldest to the newest table.
+	iters     []RefIter
+	heads     []*RefRecord
+	deletions bool
+}
+
+func (it *mergedRefIter) Next() (*RefRecord, error) {
+	for {
+		best := -1
+		for i := len(it.heads) - 1; i >= 0; i-- {
+			if it.heads[i] != nil && (best < 0 || strings.Compare(it.heads[i].RefName, it.heads[best].RefName) < 0) {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			return nil, io.EOF
+		}
+
+		r := it.heads[best]
+		for i, h := range it.heads {
+			if h == nil || h.RefName != r.RefName {
+				continue
+			}
+
+			next, err := it.iters[i].Next()
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+
+			it.heads[i] = next
+		}
+
+		if r.Type != RefValueDeletion || it.deletions {
+			return r, nil
+		}
+	}
+}
+
+type mergedLogIter struct {
+	// iters and heads are sorted from the oldest to the newest table.
+	iters     []LogIter
+	heads     []*LogRecord
+	deletions bool
+}
+
+func (it *mergedLogIter) Next() (*LogRecord, error) {
+	for {
+		best := -1
+		for i := len(it.heads) - 1; i >= 0; i-- {
+			if it.heads[i] != nil && (best < 0 || compareLogs(it.heads[i], it.heads[best]) < 0) {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			return nil, io.EOF
+		}
+
+		r := it.heads[best]
+		for i, h := range it.heads {
+			if h == nil || compareLogs(h, r) != 0 {
+				continue
+			}
+
+			next, err := it.iters[i].Next()
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+
+			it.heads[i] = next
+		}
+
+		if !r.Deleted || it.deletions {
+			return r, nil
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package reftable
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+var (
+	// ErrMalformedTable is returned when a table can't be decoded.
+	ErrMalformedTable = errors.New("reftable: malformed table")
+	// ErrUnsortedRecords is returned by the Writer when the records aren't
+	// added in sorted order.
+	ErrUnsortedRecords = errors.New("reftable: records must be added in sorted order")
+	// ErrRecordTooBig is returned by the Writer when a record doesn't fit in
+	// a block.
+	ErrRecordTooBig = errors.New("reftable: record too big for the block size")
+)
+
+const (
+	blockTypeRef   = 'r'
+	blockTypeLog   = 'g'
+	blockTypeIndex = 'i'
+	blockTypeObj   = 'o'
+)
+
+// RefValueType is the type of the value of a reference record.
+type RefValueType uint8
+
+const (
+	// RefValueDeletion is a record deleting the reference from the older
+	// tables of the stack.
+	RefValueDeletion RefValueType = iota
+	// RefValueHash is a reference to an object.
+	RefValueHash
+	// RefValuePeeled is a reference to an annotated tag, along with the
+	// object the tag points to.
+	RefValuePeeled
+	// RefValueSymbolic is a symbolic reference.
+	RefValueSymbolic
+)
+
+// RefRecord is a reference record of a table.
+type RefRecord struct {
+	// RefName is the name of the reference.
+	RefName string
+	// UpdateIndex is the update index of the transaction that wrote the
+	// record.
+	UpdateIndex uint64
+	// Type is the type of the value.
+	Type RefValueType
+	// Hash is the object of the RefValueHash and RefValuePeeled records.
+	Hash plumbing.Hash
+	// PeeledHash is the object pointed by the tag of the RefValuePeeled
+	// records.
+	PeeledHash plumbing.Hash
+	// Target is the target reference of the RefValueSymbolic records.
+	Target string
+}
+
+// LogRecord is a reflog record of a table.
+type LogRecord struct {
+	// RefName is the name of the reference.
+	RefName string
+	// UpdateIndex is the update index of the transaction that wrote the
+	// record. The records of a reference are sorted from the newest to the
+	// oldest.
+	UpdateIndex uint64
+	// Deleted is true for the records deleting the log entry of the same
+	// reference and update index from the older tables of the stack.
+	Deleted bool
+	// OldHash and NewHash are the values of the reference before and after
+	// the update.
+	OldHash, NewHash plumbing.Hash
+	// Name and Email identify the committer of the update.
+	Name, Email string
+	// Time is the time of the update, in seconds since the Unix epoch.
+	Time uint64
+	// TZOffset is the time zone of the update, in the hhmm form of git,
+	// e.g. -700 for -0700.
+	TZOffset int16
+	// Message is the reflog message.
+	Message string
+}
+
+func (r *LogRecord) key() []byte {
+	return logKey(r.RefName, r.UpdateIndex)
+}
+
+func logKey(name string, updateIndex uint64) []byte {
+	key := make([]byte, 0, len(name)+9)
+	key = append(key, name...)
+	key = append(key, 0)
+	return binary.BigEndian.AppendUint64(key, math.MaxUint64-updateIndex)
+}
+
+// putVarint appends v with the variable length encoding of reftable, which
+// is the same as the offsets of the ofs-delta objects of the packfiles.
+func putVarint(b []byte, v uint64) []byte {
+	var buf [10]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		v--
+		i--
+		buf[i] = 0x80 | byte(v&0x7f)
+	}
+
+	return append(b, buf[i:]...)
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+func putString(b []byte, s string) []byte {
+	b = putVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// encodeKey appends the prefix compressed key of a record, relative to the
+// key of the previous record, with the extra 3 bits of the record type.
+func encodeKey(b, last, key []byte, extra byte) []byte {
+	prefix := 0
+	for prefix < len(last) && prefix < len(key) && last[prefix] == key[prefix] {
+		prefix++
+	}
+
+	b = putVarint(b, uint64(prefix))
+	b = putVarint(b, uint64(len(key)-prefix)<<3|uint64(extra))
+	return append(b, key[prefix:]...)
+}
+
+// putHash appends h with the hash size of the table, the zero hash being
+// of the SHA-1 format whatever the table is.
+func putHash(b []byte, h plumbing.Hash, size int) []byte {
+	id := h.Bytes()
+	if len(id) >= size {
+		return append(b, id[:size]...)
+	}
+
+	b = append(b, id...)
+	return append(b, make([]byte, size-len(id))...)
+}
+
+func encodeRefValue(b []byte, r *RefRecord, minUpdateIndex uint64, hashSize int) []byte {
+	b = putVarint(b, r.UpdateIndex-minUpdateIndex)
+	switch r.Type {
+	case RefValueHash:
+		b = putHash(b, r.Hash, hashSize)
+	case RefValuePeeled:
+		b = putHash(b, r.Hash, hashSize)
+		b = putHash(b, r.PeeledHash, hashSize)
+	case RefValueSymbolic:
+		b = putString(b, r.Target)
+	}
+
+	return b
+}
+
+func encodeLogValue(b []byte, r *LogRecord, hashSize int) []byte {
+	if r.Deleted {
+		return b
+	}
+
+	b = putHash(b, r.OldHash, hashSize)
+	b = putHash(b, r.NewHash, hashSize)
+	b = putString(b, r.Name)
+	b = putString(b, r.Email)
+	b = putVarint(b, r.Time)
+	b = binary.BigEndian.AppendUint16(b, uint16(r.TZOffset))
+	return putString(b, r.Message)
+}
+
+// cursor decodes the fields of the records.
+type cursor struct {
+	b   []byte
+	off int
+}
+
+func (c *cursor) varint() (uint64, error) {
+	if c.off >= len(c.b) {
+		return 0, ErrMalformedTable
+	}
+
+	v := uint64(c.b[c.off] & 0x7f)
+	for c.b[c.off]&0x80 != 0 {
+		c.off++
+		if c.off >= len(c.b) || v > math.MaxUint64>>7-1 {
+			return 0, ErrMalformedTable
+		}
+		v = (v+1)<<7 | uint64(c.b[c.off]&0x7f)
+	}
+	c.off++
+
+	return v, nil
+}
+
+func (c *cursor) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(c.b)-c.off) {
+		return nil, ErrMalformedTable
+	}
+
+	b := c.b[c.off : c.off+int(n)]
+	c.off += int(n)
+	return b, nil
+}
+
+func (c *cursor) string() (string, error) {
+	n, err := c.varint()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := c.bytes(n)
+	return string(b), err
+}
+
+func (c *cursor) hash(size int) (plumbing.Hash, error) {
+	b, err := c.bytes(uint64(size))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, _ := plumbing.FromBytes(b)
+	return h, nil
+}
+
+// key decodes the prefix compressed key of a record, returning the key and
+// the extra 3 bits of the record type.
+func (c *cursor) key(last []byte) ([]byte, byte, error) {
+	prefix, err := c.varint()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	v, err := c.varint()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if prefix > uint64(len(last)) {
+		return nil, 0, ErrMalformedTable
+	}
+
+	suffix, err := c.bytes(v >> 3)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key := make([]byte, 0, int(prefix)+len(suffix))
+	key = append(key, last[:prefix]...)
+	return append(key, suffix...), byte(v & 7), nil
+}
+
+func (c *cursor) refValue(key []byte, extra byte, minUpdateIndex uint64, hashSize int) (*RefRecord, error) {
+	delta, err := c.varint()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RefRecord{
+		RefName:     string(key),
+		UpdateIndex: minUpdateIndex + delta,
+		Type:        RefValueType(extra),
+	}
+
+	switch r.Type {
+	case RefValueDeletion:
+	case RefValueHash:
+		r.Hash, err = c.hash(hashSize)
+	case RefValuePeeled:
+		if r.Hash, err = c.hash(hashSize); err == nil {
+			r.PeeledHash, err = c.hash(hashSize)
+		}
+	case RefValueSymbolic:
+		r.Target, err = c.string()
+	default:
+		return nil, ErrMalformedTable
+	}
+
+	return r, err
+}
+
+func (c *cursor) logValue(key []byte, extra byte, hashSize int) (*LogRecord, error) {
+	if len(key) < 9 || key[len(key)-9] != 0 {
+		return nil, ErrMalformedTable
+	}
+
+	r := &LogRecord{
+		RefName:     string(key[:len(key)-9]),
+		UpdateIndex: math.MaxUint64 - binary.BigEndian.Uint64(key[len(key)-8:]),
+	}
+
+	switch extra {
+	case 0:
+		r.Deleted = true
+		return r, nil
+	case 1:
+	default:
+		return nil, ErrMalformedTable
+	}
+
+	var err error
+	if r.OldHash, err = c.hash(hashSize); err != nil {
+		return nil, err
+	}
+	if r.NewHash, err = c.hash(hashSize); err != nil {
+		return nil, err
+	}
+	if r.Name, err = c.string(); err != nil {
+		return nil, err
+	}
+	if r.Email, err = c.string(); err != nil {
+		return nil, err
+	}
+	if r.Time, err = c.varint(); err != nil {
+		return nil, err
+	}
+
+	tz, err := c.bytes(2)
+	if err != nil {
+		return nil, err
+	}
+	r.TZOffset = int16(binary.BigEndian.Uint16(tz))
+
+	r.Message, err = c.string()
+	return r, err
+}
+
+func compareLogs(a, b *LogRecord) int {
+	if c := strings.Compare(a.RefName, b.RefName); c != 0 {
+		return c
+	}
+
+	switch {
+	case a.UpdateIndex > b.UpdateIndex:
+		return -1
+	case a.UpdateIndex < b.UpdateIndex:
+		return 1
+	}
+
+	return 0
+}
+
+func hashSize(f format.ObjectFormat) int {
+	if f == format.SHA256 {
+		return format.SHA256Size
+	}
+
+	return format.SHA1Size
+}
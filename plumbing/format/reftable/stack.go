@@ -0,0 +1,567 @@
+package reftable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v6"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+const (
+	// TablesListFile is the file listing the tables of the stack.
+	TablesListFile = "tables.list"
+	lockFile       = TablesListFile + ".lock"
+
+	// compactionFactor is the geometric factor between the sizes of the
+	// tables of the stack, kept by the automatic compaction.
+	compactionFactor = 2
+	// maxReloads is the number of times the tables are reloaded when a
+	// table is removed by a concurrent compaction while loading them.
+	maxReloads = 5
+)
+
+// ErrLocked is returned when the stack is locked by another writer.
+var ErrLocked = errors.New("reftable: the stack is locked")
+
+// StackOptions are the options of a Stack.
+type StackOptions struct {
+	// ObjectFormat is the object format of the hashes, SHA-1 if empty.
+	ObjectFormat format.ObjectFormat
+	// BlockSize is the size of the blocks of the new tables,
+	// DefaultBlockSize if zero.
+	BlockSize int
+	// DisableAutoCompaction disables the compaction of the tables after
+	// each addition, which keeps the sizes of the tables in a geometric
+	// sequence.
+	DisableAutoCompaction bool
+}
+
+// Stack is the stack of tables of a reftable directory. The tables are
+// listed from the oldest to the newest in the tables.list file, which is
+// replaced atomically with a lock file on each update.
+type Stack struct {
+	fs   billy.Filesystem
+	opts StackOptions
+
+	// mu serializes the updates of the stack within the process, the lock
+	// file serializing them between processes.
+	mu sync.Mutex
+
+	cmu   sync.Mutex
+	cache map[string]*Table
+}
+
+// NewStack returns the Stack of the reftable directory fs.
+func NewStack(fs billy.Filesystem, opts *StackOptions) *Stack {
+	s := &Stack{fs: fs, cache: make(map[string]*Table)}
+	if opts != nil {
+		s.opts = *opts
+	}
+
+	return s
+}
+
+// Exists returns true if the stack has a tables.list file.
+func (s *Stack) Exists() (bool, error) {
+	_, err := s.fs.Stat(TablesListFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Merged returns the merged view of the current tables of the stack.
+func (s *Stack) Merged() (*Merged, error) {
+	_, m, err := s.load()
+	return m, err
+}
+
+// Ref returns the reference record of name, or nil if it doesn't exist.
+func (s *Stack) Ref(name string) (*RefRecord, error) {
+	m, err := s.Merged()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Ref(name)
+}
+
+func (s *Stack) load() ([]string, *Merged, error) {
+	for i := 0; ; i++ {
+		names, err := s.readList()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tables, err := s.openTables(names)
+		if errors.Is(err, os.ErrNotExist) && i < maxReloads {
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return names, NewMerged(tables), nil
+	}
+}
+
+func (s *Stack) readList() ([]string, error) {
+	f, err := s.fs.Open(TablesListFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range strings.Split(string(data), "\n") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (s *Stack) openTables(names []string) ([]*Table, error) {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	cache := make(map[string]*Table, len(names))
+	tables := make([]*Table, 0, len(names))
+	for _, name := range names {
+		t, ok := s.cache[name]
+		if !ok {
+			var err error
+			if t, err = s.readTable(name); err != nil {
+				return nil, err
+			}
+		}
+
+		cache[name] = t
+		tables = append(tables, t)
+	}
+
+	s.cache = cache
+	return tables, nil
+}
+
+func (s *Stack) readTable(name string) (*Table, error) {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+	t, err := ReadTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// writeTable writes a new table with the records written by fn, returning
+// its name.
+func (s *Stack) writeTable(minIndex, maxIndex uint64, fn func(*Writer) error) (string, *Table, error) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, &WriterOptions{
+		BlockSize:      s.opts.BlockSize,
+		ObjectFormat:   s.opts.ObjectFormat,
+		MinUpdateIndex: minIndex,
+		MaxUpdateIndex: maxIndex,
+	})
+
+	if err := fn(w); err != nil {
+		return "", nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+
+	t, err := NewTable(buf.Bytes())
+	if err != nil {
+		return "", nil, err
+	}
+
+	f, err := s.fs.TempFile(".", "tmp_table_")
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = s.fs.Remove(f.Name())
+		return "", nil, err
+	}
+
+	name := fmt.Sprintf("0x%012x-0x%012x-%08x.ref", minIndex, maxIndex, rand.Uint32())
+	if err := s.fs.Rename(f.Name(), name); err != nil {
+		_ = s.fs.Remove(f.Name())
+		return "", nil, err
+	}
+
+	s.cmu.Lock()
+	s.cache[name] = t
+	s.cmu.Unlock()
+	return name, t, nil
+}
+
+// lock locks the stack, returning the lock file along with the current
+// tables.
+func (s *Stack) lock() (billy.File, []string, *Merged, error) {
+	s.mu.Lock()
+	f, err := s.fs.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if err != nil {
+		s.mu.Unlock()
+		if os.IsExist(err) {
+			return nil, nil, nil, ErrLocked
+		}
+
+		return nil, nil, nil, err
+	}
+
+	names, m, err := s.load()
+	if err != nil {
+		s.unlock(f)
+		return nil, nil, nil, err
+	}
+
+	return f, names, m, nil
+}
+
+func (s *Stack) unlock(f billy.File) {
+	_ = f.Close()
+	_ = s.fs.Remove(lockFile)
+	s.mu.Unlock()
+}
+
+// commitList replaces tables.list with names, and removes the tables of old
+// which aren't in names anymore. The stack is unlocked.
+func (s *Stack) commitList(f billy.File, old, names []string) error {
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+	}
+
+	_, err := f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = s.fs.Rename(lockFile, TablesListFile)
+	}
+
+	if err != nil {
+		_ = s.fs.Remove(lockFile)
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Unlock()
+
+	current := make(map[string]bool, len(names))
+	for _, name := range names {
+		current[name] = true
+	}
+
+	// The removal of the compacted tables is best effort, the readers
+	// reload the stack when a table is missing.
+	for _, name := range old {
+		if !current[name] {
+			_ = s.fs.Remove(name)
+		}
+	}
+
+	return nil
+}
+
+// Compact compacts all the tables of the stack in a single one, dropping the
+// deleted records.
+func (s *Stack) Compact() error {
+	f, names, m, err := s.lock()
+	if err != nil {
+		return err
+	}
+
+	if len(names) < 2 {
+		s.unlock(f)
+		return nil
+	}
+
+	name, err := s.compact(m.tables, false)
+	if err != nil {
+		s.unlock(f)
+		return err
+	}
+
+	return s.commitList(f, names, []string{name})
+}
+
+// compact writes a table merging tables, returning its name. The deleted
+// records are kept if there are older tables, as they hide their records.
+func (s *Stack) compact(tables []*Table, deletions bool) (string, error) {
+	m := NewMerged(tables)
+	refs, err := m.refs(deletions)
+	if err != nil {
+		return "", err
+	}
+
+	logs, err := m.logs(deletions, func(t *Table) (LogIter, error) { return t.Logs(), nil })
+	if err != nil {
+		return "", err
+	}
+
+	minIndex := tables[0].MinUpdateIndex()
+	maxIndex := tables[len(tables)-1].MaxUpdateIndex()
+	name, _, err := s.writeTable(minIndex, maxIndex, func(w *Writer) error {
+		for {
+			r, err := refs.Next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := w.AddRef(r); err != nil {
+				return err
+			}
+		}
+
+		for {
+			r, err := logs.Next()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := w.AddLog(r); err != nil {
+				return err
+			}
+		}
+	})
+
+	return name, err
+}
+
+// autoCompact compacts the segment of tables breaking the geometric
+// sequence of their sizes, if any, returning the new list of names.
+func (s *Stack) autoCompact(names []string, tables []*Table) ([]string, error) {
+	start, end := compactionSegment(tables)
+	if end-start < 2 {
+		return names, nil
+	}
+
+	name, err := s.compact(tables[start:end], start > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	compacted := append([]string(nil), names[:start]...)
+	compacted = append(compacted, name)
+	return append(compacted, names[end:]...), nil
+}
+
+// compactionSegment returns the range of tables to compact to restore the
+// geometric sequence of their sizes, where each table is at least twice as
+// big as the next one.
+func compactionSegment(tables []*Table) (start, end int) {
+	sizes := make([]uint64, len(tables))
+	for i, t := range tables {
+		sizes[i] = uint64(len(t.data) - t.headerSize)
+	}
+
+	var total uint64
+	for i := len(sizes) - 1; i > 0; i-- {
+		if sizes[i-1] < sizes[i]*compactionFactor {
+			end = i + 1
+			total = sizes[i]
+			break
+		}
+	}
+
+	if end == 0 {
+		return 0, 0
+	}
+
+	start = end - 1
+	for i := start; i > 0; i-- {
+		if sizes[i-1] >= total*compactionFactor {
+			break
+		}
+
+		start = i - 1
+		total += sizes[i-1]
+	}
+
+	return start, end
+}
+
+// Addition is an update of the stack, adding a table with the records. The
+// stack is locked until the addition is committed or closed, so the records
+// can be checked against the current ones first.
+type Addition struct {
+	s      *Stack
+	lock   billy.File
+	names  []string
+	merged *Merged
+	refs   []*RefRecord
+	logs   []*LogRecord
+	done   bool
+}
+
+// NewAddition locks the stack and returns an Addition. It returns ErrLocked
+// if the stack is locked by another process.
+func (s *Stack) NewAddition() (*Addition, error) {
+	f, names, m, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Addition{s: s, lock: f, names: names, merged: m}, nil
+}
+
+// Merged returns the merged view of the tables of the stack when it was
+// locked, which can't change until the addition is committed or closed.
+func (a *Addition) Merged() *Merged {
+	return a.merged
+}
+
+// UpdateIndex returns the update index of the records of the addition.
+func (a *Addition) UpdateIndex() uint64 {
+	return a.merged.MaxUpdateIndex() + 1
+}
+
+// AddRef adds a reference record, which overrides the previous records of
+// the same reference in the addition. Its update index is set on commit.
+func (a *Addition) AddRef(r *RefRecord) {
+	a.refs = append(a.refs, r)
+}
+
+// AddLog adds a log record. Its update index is set on commit if it's zero.
+func (a *Addition) AddLog(r *LogRecord) {
+	a.logs = append(a.logs, r)
+}
+
+// Commit writes the table of the records, if any, and adds it to the stack,
+// compacting the tables as needed. The stack is unlocked. Committing an
+// empty addition creates the tables.list file of a new stack.
+func (a *Addition) Commit() error {
+	if a.done {
+		return nil
+	}
+
+	a.done = true
+	if len(a.refs) == 0 && len(a.logs) == 0 {
+		// The list is written anyway, creating it for a new stack.
+		return a.s.commitList(a.lock, a.names, a.names)
+	}
+
+	index := a.UpdateIndex()
+	maxIndex := index
+	refs := make(map[string]*RefRecord, len(a.refs))
+	for _, r := range a.refs {
+		r := *r
+		r.UpdateIndex = index
+		refs[r.RefName] = &r
+	}
+
+	sorted := make([]*RefRecord, 0, len(refs))
+	for _, r := range refs {
+		sorted = append(sorted, r)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].RefName < sorted[j].RefName })
+
+	logs := make([]*LogRecord, 0, len(a.logs))
+	for _, r := range a.logs {
+		r := *r
+		if r.UpdateIndex == 0 {
+			r.UpdateIndex = index
+		}
+
+		maxIndex = max(maxIndex, r.UpdateIndex)
+		logs = append(logs, &r)
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool { return compareLogs(logs[i], logs[j]) < 0 })
+
+	name, t, err := a.s.writeTable(index, maxIndex, func(w *Writer) error {
+		for _, r := range sorted {
+			if err := w.AddRef(r); err != nil {
+				return err
+			}
+		}
+
+		for i, r := range logs {
+			// The last record added for an update index wins.
+			if i+1 < len(logs) && compareLogs(logs[i+1], r) == 0 {
+				continue
+			}
+
+			if err := w.AddLog(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		a.s.unlock(a.lock)
+		return err
+	}
+
+	names := append(append([]string(nil), a.names...), name)
+	if !a.s.opts.DisableAutoCompaction {
+		tables := append(append([]*Table(nil), a.merged.tables...), t)
+		if names, err = a.s.autoCompact(names, tables); err != nil {
+			_ = a.s.fs.Remove(name)
+			a.s.unlock(a.lock)
+			return err
+		}
+	}
+
+	return a.s.commitList(a.lock, append(a.names, name), names)
+}
+
+// Close abandons the addition if it isn't committed, unlocking the stack.
+func (a *Addition) Close() error {
+	if a.done {
+		return nil
+	}
+
+	a.done = true
+	a.s.unlock(a.lock)
+	return nil
+}
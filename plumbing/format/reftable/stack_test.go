@@ -0,0 +1,212 @@
+package reftable
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/stretchr/testify/require"
+)
+
+func addRefs(t *testing.T, s *Stack, refs ...*RefRecord) {
+	t.Helper()
+
+	a, err := s.NewAddition()
+	require.NoError(t, err)
+	defer a.Close() //nolint:errcheck
+
+	for _, r := range refs {
+		a.AddRef(r)
+	}
+
+	require.NoError(t, a.Commit())
+}
+
+func TestStack(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	s := NewStack(fs, &StackOptions{DisableAutoCompaction: true})
+
+	ok, err := s.Exists()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	addRefs(t, s,
+		&RefRecord{RefName: "HEAD", Type: RefValueSymbolic, Target: "refs/heads/main"},
+		&RefRecord{RefName: "refs/heads/main", Type: RefValueHash, Hash: hashN(1)},
+		&RefRecord{RefName: "refs/heads/other", Type: RefValueHash, Hash: hashN(2)},
+	)
+	addRefs(t, s, &RefRecord{RefName: "refs/heads/main", Type: RefValueHash, Hash: hashN(3)})
+	addRefs(t, s, &RefRecord{RefName: "refs/heads/other", Type: RefValueDeletion})
+
+	ok, err = s.Exists()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	m, err := s.Merged()
+	require.NoError(t, err)
+	require.Len(t, m.Tables(), 3)
+	require.Equal(t, uint64(3), m.MaxUpdateIndex())
+
+	r, err := s.Ref("refs/heads/main")
+	require.NoError(t, err)
+	require.Equal(t, hashN(3), r.Hash)
+	require.Equal(t, uint64(2), r.UpdateIndex)
+
+	r, err = s.Ref("refs/heads/other")
+	require.NoError(t, err)
+	require.Nil(t, r)
+
+	it, err := m.Refs()
+	require.NoError(t, err)
+	refs := readRefs(t, it)
+	require.Len(t, refs, 2)
+	require.Equal(t, "HEAD", refs[0].RefName)
+	require.Equal(t, "refs/heads/main", refs[1].RefName)
+
+	require.NoError(t, s.Compact())
+
+	m, err = s.Merged()
+	require.NoError(t, err)
+	require.Len(t, m.Tables(), 1)
+	require.Equal(t, refs, readRefs(t, m.Tables()[0].Refs()))
+
+	files, err := fs.ReadDir("")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+}
+
+func TestStackAutoCompaction(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	s := NewStack(fs, nil)
+	for i := 0; i < 64; i++ {
+		addRefs(t, s, &RefRecord{
+			RefName: fmt.Sprintf("refs/heads/branch%02d", i),
+			Type:    RefValueHash,
+			Hash:    hashN(i),
+		})
+	}
+
+	m, err := s.Merged()
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(m.Tables()), 7)
+	require.Equal(t, uint64(64), m.MaxUpdateIndex())
+
+	it, err := m.Refs()
+	require.NoError(t, err)
+	require.Len(t, readRefs(t, it), 64)
+
+	names, err := s.readList()
+	require.NoError(t, err)
+	files, err := fs.ReadDir("")
+	require.NoError(t, err)
+	require.Len(t, files, len(names)+1)
+}
+
+func TestStackLocked(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	require.NoError(t, util.WriteFile(fs, lockFile, nil, 0o666))
+
+	s := NewStack(fs, nil)
+	_, err := s.NewAddition()
+	require.ErrorIs(t, err, ErrLocked)
+}
+
+func TestStackLogs(t *testing.T) {
+	t.Parallel()
+
+	s := NewStack(memfs.New(), &StackOptions{DisableAutoCompaction: true})
+	for i := 0; i < 3; i++ {
+		a, err := s.NewAddition()
+		require.NoError(t, err)
+		a.AddRef(&RefRecord{RefName: "refs/heads/main", Type: RefValueHash, Hash: hashN(i)})
+		a.AddLog(&LogRecord{RefName: "refs/heads/main", NewHash: hashN(i), Message: fmt.Sprint(i)})
+		require.NoError(t, a.Commit())
+	}
+
+	a, err := s.NewAddition()
+	require.NoError(t, err)
+	a.AddLog(&LogRecord{RefName: "refs/heads/main", UpdateIndex: 2, Deleted: true})
+	require.NoError(t, a.Commit())
+
+	m, err := s.Merged()
+	require.NoError(t, err)
+	it, err := m.RefLogs("refs/heads/main")
+	require.NoError(t, err)
+	logs := readLogs(t, it)
+	require.Len(t, logs, 2)
+	require.Equal(t, "2", logs[0].Message)
+	require.Equal(t, "0", logs[1].Message)
+
+	require.NoError(t, s.Compact())
+	m, err = s.Merged()
+	require.NoError(t, err)
+	it, err = m.Logs()
+	require.NoError(t, err)
+	require.Len(t, readLogs(t, it), 2)
+}
+
+// TestStackGit reads the stack of a repository created by git 2.45.2 with
+// --ref-format=reftable: a first table of several ref blocks with an index,
+// holding 1000 tags, and three tables updating a branch, deleting a tag and
+// adding a symbolic reference.
+func TestStackGit(t *testing.T) {
+	t.Parallel()
+
+	first := plumbing.NewHash("f5fc6ed24119b8dedc02118b526d0c04e7beb38a")
+	second := plumbing.NewHash("355a28664b2c30615588de5c09b34142672cb8c1")
+
+	s := NewStack(osfs.New("testdata/git"), nil)
+	m, err := s.Merged()
+	require.NoError(t, err)
+	require.Len(t, m.Tables(), 4)
+	require.Equal(t, uint64(7), m.MaxUpdateIndex())
+
+	table := m.Tables()[0]
+	require.Greater(t, table.Size(), 4*table.blockSize)
+	require.NotZero(t, table.refIndexPos)
+
+	for i := 1; i <= 1000; i++ {
+		r, err := s.Ref(fmt.Sprintf("refs/tags/v%04d", i))
+		require.NoError(t, err)
+		if i == 7 {
+			require.Nil(t, r)
+			continue
+		}
+
+		require.NotNil(t, r, i)
+		require.Equal(t, first, r.Hash)
+	}
+
+	it, err := m.Refs()
+	require.NoError(t, err)
+	refs := readRefs(t, it)
+	require.Len(t, refs, 1003)
+	require.Equal(t, []*RefRecord{
+		{RefName: "HEAD", UpdateIndex: 1, Type: RefValueSymbolic, Target: "refs/heads/main"},
+		{RefName: "refs/heads/alias", UpdateIndex: 7, Type: RefValueSymbolic, Target: "refs/heads/main"},
+		{RefName: "refs/heads/main", UpdateIndex: 3, Type: RefValueHash, Hash: second},
+		{RefName: "refs/heads/topic", UpdateIndex: 5, Type: RefValueHash, Hash: second},
+	}, refs[:4])
+
+	logs, err := m.RefLogs("refs/heads/main")
+	require.NoError(t, err)
+	require.Equal(t, []*LogRecord{
+		{
+			RefName: "refs/heads/main", UpdateIndex: 3, OldHash: first, NewHash: second,
+			Name: "A", Email: "a@example.com", Time: 1700000000, Message: "commit: second\n",
+		},
+		{
+			RefName: "refs/heads/main", UpdateIndex: 2, NewHash: first,
+			Name: "A", Email: "a@example.com", Time: 1700000000, Message: "commit (initial): first\n",
+		},
+	}, readLogs(t, logs))
+}
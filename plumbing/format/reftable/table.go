@@ -0,0 +1,416 @@
+package reftable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// Table is a decoded table. Tables are immutable, so a Table can be used
+// concurrently.
+type Table struct {
+	data []byte
+
+	version        int
+	blockSize      int
+	objectFormat   format.ObjectFormat
+	hashSize       int
+	minUpdateIndex uint64
+	maxUpdateIndex uint64
+	headerSize     int
+
+	refIndexPos uint64
+	logPos      uint64
+	logIndexPos uint64
+	hasRefs     bool
+	hasLogs     bool
+}
+
+// ReadTable reads and decodes the table of r.
+func ReadTable(r io.Reader) (*Table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTable(data)
+}
+
+// NewTable decodes the table of data, which must not be modified afterwards.
+func NewTable(data []byte) (*Table, error) {
+	if len(data) < headerSize(1) || string(data[:4]) != magic {
+		return nil, ErrMalformedTable
+	}
+
+	t := &Table{
+		version:      int(data[4]),
+		blockSize:    int(uint24(data[5:])),
+		objectFormat: format.SHA1,
+	}
+
+	switch t.version {
+	case 1:
+	case 2:
+		if len(data) < headerSize(2) {
+			return nil, ErrMalformedTable
+		}
+
+		switch binary.BigEndian.Uint32(data[8:]) {
+		case hashIDSHA1:
+		case hashIDSHA256:
+			t.objectFormat = format.SHA256
+		default:
+			return nil, ErrMalformedTable
+		}
+	default:
+		return nil, ErrMalformedTable
+	}
+
+	t.headerSize = headerSize(t.version)
+	t.hashSize = hashSize(t.objectFormat)
+	if len(data) < t.headerSize+footerSize(t.version) {
+		return nil, ErrMalformedTable
+	}
+
+	footerOff := len(data) - footerSize(t.version)
+	footer := data[footerOff:]
+	if !bytes.Equal(footer[:t.headerSize], data[:t.headerSize]) ||
+		crc32.ChecksumIEEE(footer[:len(footer)-4]) != binary.BigEndian.Uint32(footer[len(footer)-4:]) {
+		return nil, ErrMalformedTable
+	}
+
+	t.data = data[:footerOff]
+	t.minUpdateIndex = binary.BigEndian.Uint64(data[t.headerSize-16:])
+	t.maxUpdateIndex = binary.BigEndian.Uint64(data[t.headerSize-8:])
+
+	f := footer[t.headerSize:]
+	t.refIndexPos = binary.BigEndian.Uint64(f)
+	t.logPos = binary.BigEndian.Uint64(f[24:])
+	t.logIndexPos = binary.BigEndian.Uint64(f[32:])
+	for _, pos := range []uint64{t.refIndexPos, t.logPos, t.logIndexPos} {
+		if pos >= uint64(len(t.data)) && pos != 0 {
+			return nil, ErrMalformedTable
+		}
+	}
+
+	if len(t.data) > t.headerSize {
+		switch t.data[t.headerSize] {
+		case blockTypeRef:
+			t.hasRefs = true
+		case blockTypeLog:
+			t.hasLogs = true
+		}
+	}
+
+	t.hasLogs = t.hasLogs || t.logPos > 0
+	return t, nil
+}
+
+// ObjectFormat returns the object format of the hashes of the table.
+func (t *Table) ObjectFormat() format.ObjectFormat {
+	return t.objectFormat
+}
+
+// MinUpdateIndex returns the minimum update index of the records.
+func (t *Table) MinUpdateIndex() uint64 {
+	return t.minUpdateIndex
+}
+
+// MaxUpdateIndex returns the maximum update index of the records.
+func (t *Table) MaxUpdateIndex() uint64 {
+	return t.maxUpdateIndex
+}
+
+// Size returns the size of the table file.
+func (t *Table) Size() int {
+	return len(t.data) + footerSize(t.version)
+}
+
+// block returns the block at off, or nil if there isn't any block of type
+// typ, which is any type if zero.
+func (t *Table) block(off uint64, typ byte) (*blockReader, error) {
+	if off >= uint64(len(t.data)) {
+		return nil, nil
+	}
+
+	headerOff := 0
+	if off == 0 {
+		headerOff = t.headerSize
+	}
+
+	if off+uint64(headerOff) >= uint64(len(t.data)) {
+		return nil, nil
+	}
+
+	if typ != 0 && t.data[off+uint64(headerOff)] != typ {
+		return nil, nil
+	}
+
+	return readBlock(t.data, int(off), headerOff, t.blockSize)
+}
+
+// tableIter iterates over the records of the consecutive blocks of a type.
+type tableIter struct {
+	t   *Table
+	typ byte
+	off uint64
+	br  *blockReader
+	bi  *blockIter
+}
+
+func (t *Table) iter(typ byte, off uint64) *tableIter {
+	return &tableIter{t: t, typ: typ, off: off}
+}
+
+// seek positions the iterator at the restart point preceding want, in the
+// block at the current offset.
+func (ti *tableIter) seek(want []byte) error {
+	br, err := ti.t.block(ti.off, ti.typ)
+	if err != nil || br == nil {
+		return err
+	}
+
+	ti.br = br
+	ti.bi, err = br.seek(want)
+	return err
+}
+
+func (ti *tableIter) next() (extra byte, ok bool, err error) {
+	for {
+		if ti.bi == nil {
+			ti.br, err = ti.t.block(ti.off, ti.typ)
+			if err != nil || ti.br == nil {
+				return 0, false, err
+			}
+
+			ti.bi = ti.br.iter()
+		}
+
+		extra, ok, err = ti.bi.next()
+		if err != nil || ok {
+			return extra, ok, err
+		}
+
+		ti.off += uint64(ti.br.size)
+		ti.bi = nil
+	}
+}
+
+func (ti *tableIter) key() []byte {
+	return ti.bi.key
+}
+
+func (ti *tableIter) cursor() *cursor {
+	return &ti.bi.c
+}
+
+// seekIndex returns the offset of the block of the records with a key
+// greater or equal than want, using the index at pos, or false if there
+// isn't any.
+func (t *Table) seekIndex(pos uint64, want []byte) (uint64, bool, error) {
+	for {
+		ti := t.iter(blockTypeIndex, pos)
+		if err := ti.seek(want); err != nil {
+			return 0, false, err
+		}
+
+		var off uint64
+		for {
+			_, ok, err := ti.next()
+			if err != nil || !ok {
+				return 0, false, err
+			}
+
+			if off, err = ti.cursor().varint(); err != nil {
+				return 0, false, err
+			}
+
+			if bytes.Compare(ti.key(), want) >= 0 {
+				break
+			}
+		}
+
+		if off >= uint64(len(t.data)) {
+			return 0, false, ErrMalformedTable
+		}
+
+		headerOff := uint64(0)
+		if off == 0 {
+			headerOff = uint64(t.headerSize)
+		}
+
+		if t.data[off+headerOff] != blockTypeIndex {
+			return off, true, nil
+		}
+
+		if off == pos {
+			return 0, false, ErrMalformedTable
+		}
+
+		pos = off
+	}
+}
+
+// Ref returns the reference record of name, or nil if the table doesn't
+// have any. The returned record may be a deletion.
+func (t *Table) Ref(name string) (*RefRecord, error) {
+	if !t.hasRefs {
+		return nil, nil
+	}
+
+	want := []byte(name)
+	off := uint64(0)
+	if t.refIndexPos > 0 {
+		var ok bool
+		var err error
+		if off, ok, err = t.seekIndex(t.refIndexPos, want); err != nil || !ok {
+			return nil, err
+		}
+	}
+
+	ti := t.iter(blockTypeRef, off)
+	if err := ti.seek(want); err != nil {
+		return nil, err
+	}
+
+	for {
+		extra, ok, err := ti.next()
+		if err != nil || !ok {
+			return nil, err
+		}
+
+		r, err := ti.cursor().refValue(ti.key(), extra, t.minUpdateIndex, t.hashSize)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c := bytes.Compare(ti.key(), want); {
+		case c == 0:
+			return r, nil
+		case c > 0:
+			return nil, nil
+		}
+	}
+}
+
+// Refs returns an iterator over the reference records, sorted by name,
+// including the deletions.
+func (t *Table) Refs() RefIter {
+	it := &tableRefIter{t: t}
+	if t.hasRefs {
+		it.ti = t.iter(blockTypeRef, 0)
+	}
+
+	return it
+}
+
+// Logs returns an iterator over the log records, sorted by name and from
+// the newest to the oldest, including the deletions.
+func (t *Table) Logs() LogIter {
+	it := &tableLogIter{t: t}
+	if t.hasLogs {
+		it.ti = t.iter(blockTypeLog, t.logPos)
+	}
+
+	return it
+}
+
+// RefLogs returns an iterator over the log records of name, from the newest
+// to the oldest, including the deletions.
+func (t *Table) RefLogs(name string) (LogIter, error) {
+	it := &tableLogIter{t: t, name: name, filter: true}
+	if !t.hasLogs {
+		return it, nil
+	}
+
+	want := logKey(name, ^uint64(0))
+	off := t.logPos
+	if t.logIndexPos > 0 {
+		var ok bool
+		var err error
+		if off, ok, err = t.seekIndex(t.logIndexPos, want); err != nil || !ok {
+			return it, err
+		}
+	}
+
+	it.ti = t.iter(blockTypeLog, off)
+	return it, it.ti.seek(want)
+}
+
+// RefIter is an iterator over reference records. Next returns io.EOF when
+// there are no more records.
+type RefIter interface {
+	Next() (*RefRecord, error)
+}
+
+// LogIter is an iterator over log records. Next returns io.EOF when there
+// are no more records.
+type LogIter interface {
+	Next() (*LogRecord, error)
+}
+
+type tableRefIter struct {
+	t  *Table
+	ti *tableIter
+}
+
+func (it *tableRefIter) Next() (*RefRecord, error) {
+	if it.ti == nil {
+		return nil, io.EOF
+	}
+
+	extra, ok, err := it.ti.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		it.ti = nil
+		return nil, io.EOF
+	}
+
+	return it.ti.cursor().refValue(it.ti.key(), extra, it.t.minUpdateIndex, it.t.hashSize)
+}
+
+type tableLogIter struct {
+	t  *Table
+	ti *tableIter
+	// name is the reference of the records, if filter is set.
+	name   string
+	filter bool
+}
+
+func (it *tableLogIter) Next() (*LogRecord, error) {
+	for it.ti != nil {
+		extra, ok, err := it.ti.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		r, err := it.ti.cursor().logValue(it.ti.key(), extra, it.t.hashSize)
+		if err != nil {
+			return nil, err
+		}
+
+		if !it.filter {
+			return r, nil
+		}
+
+		switch c := bytes.Compare([]byte(r.RefName), []byte(it.name)); {
+		case c == 0:
+			return r, nil
+		case c > 0:
+			it.ti = nil
+		}
+	}
+
+	it.ti = nil
+	return nil, io.EOF
+}
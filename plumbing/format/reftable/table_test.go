@@ -0,0 +1,251 @@
+package reftable
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVarint(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []uint64{0, 1, 127, 128, 255, 16383, 16384, 1 << 32, math.MaxUint64} {
+		b := putVarint(nil, v)
+		c := cursor{b: b}
+		got, err := c.varint()
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+		require.Equal(t, len(b), c.off)
+	}
+
+	// The encoding is the one of the ofs-delta offsets.
+	require.Equal(t, []byte{0x80, 0x00}, putVarint(nil, 128))
+}
+
+func hashN(i int) plumbing.Hash {
+	return plumbing.NewHash(fmt.Sprintf("%040x", i+1))
+}
+
+func writeTable(t *testing.T, opts *WriterOptions, refs []*RefRecord, logs []*LogRecord) *Table {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts)
+	for _, r := range refs {
+		require.NoError(t, w.AddRef(r))
+	}
+
+	for _, l := range logs {
+		require.NoError(t, w.AddLog(l))
+	}
+
+	require.NoError(t, w.Close())
+
+	tbl, err := NewTable(buf.Bytes())
+	require.NoError(t, err)
+	return tbl
+}
+
+func readRefs(t *testing.T, it RefIter) []*RefRecord {
+	t.Helper()
+
+	var refs []*RefRecord
+	for {
+		r, err := it.Next()
+		if err == io.EOF {
+			return refs
+		}
+
+		require.NoError(t, err)
+		refs = append(refs, r)
+	}
+}
+
+func readLogs(t *testing.T, it LogIter) []*LogRecord {
+	t.Helper()
+
+	var logs []*LogRecord
+	for {
+		r, err := it.Next()
+		if err == io.EOF {
+			return logs
+		}
+
+		require.NoError(t, err)
+		logs = append(logs, r)
+	}
+}
+
+func TestTableRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	refs := []*RefRecord{
+		{RefName: "HEAD", UpdateIndex: 1, Type: RefValueSymbolic, Target: "refs/heads/main"},
+		{RefName: "refs/heads/deleted", UpdateIndex: 2, Type: RefValueDeletion},
+	}
+
+	// Enough references for several blocks and an index.
+	for i := 0; i < 2000; i++ {
+		refs = append(refs, &RefRecord{
+			RefName:     fmt.Sprintf("refs/heads/main%05d", i),
+			UpdateIndex: 2,
+			Type:        RefValueHash,
+			Hash:        hashN(i),
+		})
+	}
+
+	refs = append(refs, &RefRecord{
+		RefName:     "refs/tags/v1.0.0",
+		UpdateIndex: 1,
+		Type:        RefValuePeeled,
+		Hash:        hashN(1),
+		PeeledHash:  hashN(2),
+	})
+
+	logs := []*LogRecord{
+		{
+			RefName: "refs/heads/main", UpdateIndex: 2,
+			OldHash: hashN(1), NewHash: hashN(2),
+			Name: "John Doe", Email: "john@example.com",
+			Time: 1700000000, TZOffset: -700, Message: "commit: second",
+		},
+		{
+			RefName: "refs/heads/main", UpdateIndex: 1,
+			OldHash: plumbing.ZeroHash, NewHash: hashN(1),
+			Name: "John Doe", Email: "john@example.com",
+			Time: 1600000000, TZOffset: 200, Message: "commit (initial): first",
+		},
+		{RefName: "refs/heads/other", UpdateIndex: 2, Deleted: true},
+	}
+
+	tbl := writeTable(t, &WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 2}, refs, logs)
+	require.NotZero(t, tbl.refIndexPos)
+	require.NotZero(t, tbl.logPos)
+	require.Equal(t, uint64(1), tbl.MinUpdateIndex())
+	require.Equal(t, uint64(2), tbl.MaxUpdateIndex())
+
+	require.Equal(t, refs, readRefs(t, tbl.Refs()))
+	require.Equal(t, logs, readLogs(t, tbl.Logs()))
+
+	for _, r := range refs {
+		got, err := tbl.Ref(r.RefName)
+		require.NoError(t, err)
+		require.Equal(t, r, got)
+	}
+
+	for _, name := range []string{"A", "refs/heads/main", "refs/heads/main00000a", "zzz"} {
+		got, err := tbl.Ref(name)
+		require.NoError(t, err)
+		require.Nil(t, got, name)
+	}
+
+	it, err := tbl.RefLogs("refs/heads/main")
+	require.NoError(t, err)
+	require.Equal(t, logs[:2], readLogs(t, it))
+
+	it, err = tbl.RefLogs("refs/heads/none")
+	require.NoError(t, err)
+	require.Empty(t, readLogs(t, it))
+}
+
+func TestTableMultiLevelIndex(t *testing.T) {
+	t.Parallel()
+
+	var refs []*RefRecord
+	for i := 0; i < 5000; i++ {
+		refs = append(refs, &RefRecord{
+			RefName:     fmt.Sprintf("refs/tags/%08d-with-a-long-name-to-fill-the-blocks", i),
+			UpdateIndex: 1,
+			Type:        RefValueHash,
+			Hash:        hashN(i),
+		})
+	}
+
+	tbl := writeTable(t, &WriterOptions{BlockSize: 256, MinUpdateIndex: 1, MaxUpdateIndex: 1}, refs, nil)
+	require.NotZero(t, tbl.refIndexPos)
+	require.False(t, tbl.hasLogs)
+
+	for _, i := range []int{0, 1, 999, 2500, 4999} {
+		got, err := tbl.Ref(refs[i].RefName)
+		require.NoError(t, err)
+		require.Equal(t, refs[i], got)
+	}
+
+	require.Len(t, readRefs(t, tbl.Refs()), len(refs))
+}
+
+func TestTableSHA256(t *testing.T) {
+	t.Parallel()
+
+	h, _ := plumbing.FromHex(fmt.Sprintf("%064x", 42))
+	refs := []*RefRecord{{RefName: "refs/heads/main", UpdateIndex: 1, Type: RefValueHash, Hash: h}}
+	tbl := writeTable(t, &WriterOptions{ObjectFormat: format.SHA256, MinUpdateIndex: 1, MaxUpdateIndex: 1}, refs, nil)
+	require.Equal(t, format.SHA256, tbl.ObjectFormat())
+	require.Equal(t, 2, tbl.version)
+	require.Equal(t, refs, readRefs(t, tbl.Refs()))
+}
+
+func TestTableEmpty(t *testing.T) {
+	t.Parallel()
+
+	tbl := writeTable(t, nil, nil, nil)
+	require.Equal(t, headerSize(1)+footerSize(1), tbl.Size())
+	require.Empty(t, readRefs(t, tbl.Refs()))
+	require.Empty(t, readLogs(t, tbl.Logs()))
+}
+
+func TestWriterUnsorted(t *testing.T) {
+	t.Parallel()
+
+	w := NewWriter(io.Discard, &WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 1})
+	require.NoError(t, w.AddRef(&RefRecord{RefName: "refs/heads/b", UpdateIndex: 1}))
+	require.ErrorIs(t, w.AddRef(&RefRecord{RefName: "refs/heads/a", UpdateIndex: 1}), ErrUnsortedRecords)
+}
+
+func TestNewTableMalformed(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, &WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 1})
+	require.NoError(t, w.AddRef(&RefRecord{RefName: "HEAD", UpdateIndex: 1, Type: RefValueSymbolic, Target: "refs/heads/main"}))
+	require.NoError(t, w.Close())
+
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	_, err := NewTable(data)
+	require.ErrorIs(t, err, ErrMalformedTable)
+
+	_, err = NewTable([]byte("REFT"))
+	require.ErrorIs(t, err, ErrMalformedTable)
+}
+
+func TestTableManyLogs(t *testing.T) {
+	t.Parallel()
+
+	var logs []*LogRecord
+	for i := 0; i < 3000; i++ {
+		logs = append(logs, &LogRecord{
+			RefName:     fmt.Sprintf("refs/heads/branch%04d", i/10),
+			UpdateIndex: uint64(10 - i%10),
+			NewHash:     hashN(i),
+			Name:        "John Doe",
+			Email:       "john@example.com",
+			Message:     fmt.Sprintf("update %d", i),
+		})
+	}
+
+	tbl := writeTable(t, &WriterOptions{BlockSize: 1024, MinUpdateIndex: 1, MaxUpdateIndex: 10}, nil, logs)
+	require.False(t, tbl.hasRefs)
+	require.NotZero(t, tbl.logIndexPos)
+	require.Equal(t, logs, readLogs(t, tbl.Logs()))
+
+	it, err := tbl.RefLogs("refs/heads/branch0150")
+	require.NoError(t, err)
+	require.Equal(t, logs[1500:1510], readLogs(t, it))
+}
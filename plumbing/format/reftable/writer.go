@@ -0,0 +1,318 @@
+package reftable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+const (
+	// DefaultBlockSize is the block size of the tables written by git.
+	DefaultBlockSize = 4096
+	// maxBlockSize is the maximum block size, limited by the uint24 block
+	// lengths.
+	maxBlockSize = 1<<24 - 1
+
+	magic = "REFT"
+	// maxIndexBlocks is the maximum number of blocks of a section or index
+	// level not requiring an index.
+	maxIndexBlocks = 3
+
+	hashIDSHA1   = 0x73686131 // "sha1"
+	hashIDSHA256 = 0x73323536 // "s256"
+)
+
+// ErrInvalidBlockSize is returned by the Writer when the block size is too
+// big.
+var ErrInvalidBlockSize = errors.New("reftable: invalid block size")
+
+// WriterOptions are the options of a Writer.
+type WriterOptions struct {
+	// BlockSize is the size of the blocks, DefaultBlockSize if zero.
+	BlockSize int
+	// ObjectFormat is the object format of the hashes, SHA-1 if empty. The
+	// SHA-1 tables are written with version 1 of the format, for
+	// compatibility with the older readers, and the SHA-256 ones with
+	// version 2.
+	ObjectFormat format.ObjectFormat
+	// MinUpdateIndex and MaxUpdateIndex are the range of the update indexes
+	// of the reference records.
+	MinUpdateIndex, MaxUpdateIndex uint64
+}
+
+type indexEntry struct {
+	key []byte
+	off uint64
+}
+
+// Writer writes a table. The reference records must be added first, sorted
+// by name, followed by the log records, sorted by name and from the newest
+// to the oldest update index.
+type Writer struct {
+	w        io.Writer
+	opts     WriterOptions
+	hashSize int
+	header   []byte
+
+	off            uint64
+	pendingPadding int
+	bw             *blockWriter
+	section        byte
+	lastKey        []byte
+	entries        int
+	index          []indexEntry
+
+	refIndexPos uint64
+	logPos      uint64
+	logIndexPos uint64
+	err         error
+}
+
+// NewWriter returns a Writer writing a table to w.
+func NewWriter(w io.Writer, opts *WriterOptions) *Writer {
+	tw := &Writer{w: w}
+	if opts != nil {
+		tw.opts = *opts
+	}
+
+	if tw.opts.BlockSize == 0 {
+		tw.opts.BlockSize = DefaultBlockSize
+	}
+
+	if tw.opts.BlockSize > maxBlockSize || tw.opts.BlockSize < 256 {
+		tw.err = ErrInvalidBlockSize
+	}
+
+	tw.hashSize = hashSize(tw.opts.ObjectFormat)
+	tw.header = encodeHeader(tw.opts.ObjectFormat, tw.opts.BlockSize,
+		tw.opts.MinUpdateIndex, tw.opts.MaxUpdateIndex)
+	return tw
+}
+
+func encodeHeader(f format.ObjectFormat, blockSize int, minIndex, maxIndex uint64) []byte {
+	h := make([]byte, 0, headerSize(2))
+	h = append(h, magic...)
+	if f == format.SHA256 {
+		h = append(h, 2, 0, 0, 0)
+		putUint24(h[5:], uint32(blockSize))
+		h = binary.BigEndian.AppendUint32(h, hashIDSHA256)
+	} else {
+		h = append(h, 1, 0, 0, 0)
+		putUint24(h[5:], uint32(blockSize))
+	}
+
+	h = binary.BigEndian.AppendUint64(h, minIndex)
+	return binary.BigEndian.AppendUint64(h, maxIndex)
+}
+
+func headerSize(version int) int {
+	if version == 2 {
+		return 28
+	}
+
+	return 24
+}
+
+func footerSize(version int) int {
+	return headerSize(version) + 5*8 + 4
+}
+
+// AddRef adds a reference record. Its update index must be within the range
+// of the options.
+func (w *Writer) AddRef(r *RefRecord) error {
+	if r.UpdateIndex < w.opts.MinUpdateIndex || r.UpdateIndex > w.opts.MaxUpdateIndex {
+		return errors.New("reftable: update index out of range")
+	}
+
+	if r.Type > RefValueSymbolic {
+		return errors.New("reftable: invalid reference value type")
+	}
+
+	if w.section == blockTypeLog {
+		return ErrUnsortedRecords
+	}
+
+	value := encodeRefValue(nil, r, w.opts.MinUpdateIndex, w.hashSize)
+	return w.add(blockTypeRef, []byte(r.RefName), byte(r.Type), value)
+}
+
+// AddLog adds a log record.
+func (w *Writer) AddLog(r *LogRecord) error {
+	var extra byte = 1
+	if r.Deleted {
+		extra = 0
+	}
+
+	return w.add(blockTypeLog, r.key(), extra, encodeLogValue(nil, r, w.hashSize))
+}
+
+func (w *Writer) add(typ byte, key []byte, extra byte, value []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.section != typ {
+		if w.err = w.finishSection(); w.err != nil {
+			return w.err
+		}
+
+		w.section = typ
+		w.entries = 0
+		if typ == blockTypeLog {
+			// The log section starts after the padding of the last block.
+			w.logPos = w.off + uint64(w.pendingPadding)
+		}
+	}
+
+	if w.entries > 0 && bytes.Compare(key, w.lastKey) <= 0 {
+		return ErrUnsortedRecords
+	}
+
+	if w.err = w.addToBlock(typ, key, extra, value); w.err != nil {
+		return w.err
+	}
+
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.entries++
+	return nil
+}
+
+func (w *Writer) addToBlock(typ byte, key []byte, extra byte, value []byte) error {
+	if w.bw == nil {
+		w.bw = w.newBlock(typ)
+	}
+
+	if w.bw.add(key, extra, value) {
+		return nil
+	}
+
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	w.bw = w.newBlock(typ)
+	if !w.bw.add(key, extra, value) {
+		return ErrRecordTooBig
+	}
+
+	return nil
+}
+
+func (w *Writer) newBlock(typ byte) *blockWriter {
+	var header []byte
+	if w.off == 0 {
+		header = w.header
+	}
+
+	return newBlockWriter(typ, header, w.opts.BlockSize)
+}
+
+// flushBlock writes the current block, after the padding of the previous
+// one, and records it in the index.
+func (w *Writer) flushBlock() error {
+	if w.bw == nil || w.bw.entries == 0 {
+		return nil
+	}
+
+	data, err := w.bw.finish()
+	if err != nil {
+		return err
+	}
+
+	if w.pendingPadding > 0 {
+		if err := w.write(make([]byte, w.pendingPadding)); err != nil {
+			return err
+		}
+		w.pendingPadding = 0
+	}
+
+	w.index = append(w.index, indexEntry{
+		key: append([]byte(nil), w.bw.lastKey...),
+		off: w.off,
+	})
+
+	if err := w.write(data); err != nil {
+		return err
+	}
+
+	if w.bw.typ != blockTypeLog {
+		w.pendingPadding = w.opts.BlockSize - len(data)
+	}
+
+	w.bw = nil
+	return nil
+}
+
+// finishSection writes the last block of the current section, and its index
+// if it has more than a few blocks. The index has as many levels as needed
+// for the top one to have a few blocks.
+func (w *Writer) finishSection() error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	var indexPos uint64
+	for len(w.index) > maxIndexBlocks {
+		level := w.index
+		w.index = nil
+		indexPos = w.off + uint64(w.pendingPadding)
+		for _, e := range level {
+			if err := w.addToBlock(blockTypeIndex, e.key, 0, putVarint(nil, e.off)); err != nil {
+				return err
+			}
+		}
+
+		if err := w.flushBlock(); err != nil {
+			return err
+		}
+	}
+
+	switch w.section {
+	case blockTypeRef:
+		w.refIndexPos = indexPos
+	case blockTypeLog:
+		w.logIndexPos = indexPos
+	}
+
+	w.index = nil
+	return nil
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.off += uint64(n)
+	return err
+}
+
+// Close writes the last blocks and the footer of the table. It doesn't close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.finishSection(); err != nil {
+		return err
+	}
+
+	if w.off == 0 {
+		if err := w.write(w.header); err != nil {
+			return err
+		}
+	}
+
+	footer := append([]byte(nil), w.header...)
+	footer = binary.BigEndian.AppendUint64(footer, w.refIndexPos)
+	// No object blocks are written, so obj_id_len and obj_position are zero.
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, 0)
+	footer = binary.BigEndian.AppendUint64(footer, w.logPos)
+	footer = binary.BigEndian.AppendUint64(footer, w.logIndexPos)
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(footer))
+	w.err = w.write(footer)
+	return w.err
+}
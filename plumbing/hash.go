@@ -18,7 +18,12 @@ var ZeroHash ObjectID
 
 // ComputeHash compute the hash for a given ObjectType and content
 func ComputeHash(t ObjectType, content []byte) Hash {
-	ha, err := newHasher(format.SHA1)
+	return computeHash(format.SHA1, t, content)
+}
+
+// computeHash computes the hash of the given object using the object format f.
+func computeHash(f format.ObjectFormat, t ObjectType, content []byte) Hash {
+	ha, err := newHasher(f)
 	if err != nil {
 		return ZeroHash
 	}
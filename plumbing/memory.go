@@ -3,6 +3,8 @@ package plumbing
 import (
 	"bytes"
 	"io"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 )
 
 // MemoryObject on memory Object implementation
@@ -11,6 +13,13 @@ type MemoryObject struct {
 	h    Hash
 	cont []byte
 	sz   int64
+	f    format.ObjectFormat
+}
+
+// NewMemoryObject returns an empty MemoryObject whose Hash is computed using
+// the given object format. The zero value of MemoryObject uses SHA-1.
+func NewMemoryObject(f format.ObjectFormat) *MemoryObject {
+	return &MemoryObject{f: f}
 }
 
 // Hash returns the object Hash, the hash is calculated on-the-fly the first
@@ -19,7 +28,7 @@ type MemoryObject struct {
 // size of the content is exactly the object size.
 func (o *MemoryObject) Hash() Hash {
 	if o.h.IsZero() && int64(len(o.cont)) == o.sz {
-		o.h = ComputeHash(o.t, o.cont)
+		o.h = computeHash(o.f, o.t, o.cont)
 	}
 
 	if o.h.IsZero() {
@@ -151,3 +151,40 @@ func (s *CommitNodeSuite) TestMixedGraph() {
 	testParents(s, nodeIndex)
 	testCommitAndTree(s, nodeIndex)
 }
+
+func (s *CommitNodeSuite) TestNewMemoryIndex() {
+	f := fixtures.ByTag("commit-graph").One()
+	storer := unpackRepository(f)
+	reader, err := storer.Filesystem().Open(path.Join("objects", "info", "commit-graph"))
+	s.NoError(err)
+	defer reader.Close()
+	fileIndex, err := commitgraph.OpenFileIndex(reader)
+	s.NoError(err)
+	defer fileIndex.Close()
+
+	memoryIndex, err := NewMemoryIndex(storer, fileIndex.Hashes())
+	s.NoError(err)
+	s.True(memoryIndex.HasGenerationV2())
+	s.ElementsMatch(fileIndex.Hashes(), memoryIndex.Hashes())
+
+	for _, hash := range fileIndex.Hashes() {
+		i, err := fileIndex.GetIndexByHash(hash)
+		s.NoError(err)
+		expected, err := fileIndex.GetCommitDataByIndex(i)
+		s.NoError(err)
+
+		i, err = memoryIndex.GetIndexByHash(hash)
+		s.NoError(err)
+		data, err := memoryIndex.GetCommitDataByIndex(i)
+		s.NoError(err)
+		s.Equal(expected.TreeHash, data.TreeHash)
+		s.ElementsMatch(expected.ParentHashes, data.ParentHashes)
+		s.Equal(expected.Generation, data.Generation)
+		s.Equal(expected.When.Unix(), data.When.Unix())
+		if fileIndex.HasGenerationV2() {
+			s.Equal(expected.GenerationV2, data.GenerationV2)
+		}
+	}
+
+	testWalker(s, NewGraphCommitNodeIndex(memoryIndex, storer))
+}
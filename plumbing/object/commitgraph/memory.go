@@ -0,0 +1,155 @@
+package commitgraph
+
+import (
+	"github.com/go-git/go-git/v6/plumbing"
+	commitgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// generationV1Max is the highest topological level stored in a
+// commit-graph, the deeper commits having this one.
+const generationV1Max = 0x3FFFFFFF
+
+// NewMemoryIndex returns a commit-graph of the commits reachable from the
+// given objects, with their generation numbers and corrected commit dates,
+// to be encoded. The objects which aren't commits or annotated tags of
+// commits are ignored.
+func NewMemoryIndex(s storer.EncodedObjectStorer, tips []plumbing.Hash) (*commitgraph.MemoryIndex, error) {
+	return NewMemoryIndexWithParent(s, tips, nil)
+}
+
+// NewMemoryIndexWithParent is like NewMemoryIndex, but the commits already
+// in parent, such as the previous layers of a commit-graph chain, aren't
+// added, the returned commit-graph being on top of parent.
+func NewMemoryIndexWithParent(s storer.EncodedObjectStorer, tips []plumbing.Hash, parent commitgraph.Index) (*commitgraph.MemoryIndex, error) {
+	type item struct {
+		commit  *object.Commit
+		parents bool
+	}
+
+	data := make(map[plumbing.Hash]*commitgraph.CommitData)
+	idx := commitgraph.NewMemoryIndexWithParent(parent)
+
+	// known returns the data of the commit h if it was already added, to
+	// the parent or to idx.
+	known := func(h plumbing.Hash) (*commitgraph.CommitData, error) {
+		if cd, ok := data[h]; ok || parent == nil {
+			return cd, nil
+		}
+
+		i, err := parent.GetIndexByHash(h)
+		if err == plumbing.ErrObjectNotFound {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return parent.GetCommitDataByIndex(i)
+	}
+
+	var pending []item
+	for _, h := range tips {
+		commit, err := peelCommit(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if commit == nil {
+			continue
+		}
+
+		cd, err := known(commit.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if cd == nil {
+			pending = append(pending, item{commit: commit})
+		}
+	}
+
+	for len(pending) > 0 {
+		it := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		c := it.commit
+		if _, ok := data[c.Hash]; ok {
+			continue
+		}
+
+		if !it.parents {
+			pending = append(pending, item{commit: c, parents: true})
+			for _, p := range c.ParentHashes {
+				cd, err := known(p)
+				if err != nil {
+					return nil, err
+				}
+
+				if cd != nil {
+					continue
+				}
+
+				pc, err := object.GetCommit(s, p)
+				if err != nil {
+					return nil, err
+				}
+
+				pending = append(pending, item{commit: pc})
+			}
+
+			continue
+		}
+
+		// The parents are done, the generation of the commit follows.
+		cd := &commitgraph.CommitData{
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			Generation:   1,
+			When:         c.Committer.When,
+		}
+
+		corrected := uint64(c.Committer.When.Unix())
+		for _, p := range c.ParentHashes {
+			pd, err := known(p)
+			if err != nil {
+				return nil, err
+			}
+
+			if pd.Generation+1 > cd.Generation {
+				cd.Generation = min(pd.Generation+1, generationV1Max)
+			}
+
+			if pd.GenerationV2+1 > corrected {
+				corrected = pd.GenerationV2 + 1
+			}
+		}
+
+		cd.GenerationV2 = corrected
+		data[c.Hash] = cd
+		idx.Add(c.Hash, cd)
+	}
+
+	return idx, nil
+}
+
+// peelCommit returns the commit h, or pointed by the annotated tag h, or nil
+// if it's another object.
+func peelCommit(s storer.EncodedObjectStorer, h plumbing.Hash) (*object.Commit, error) {
+	for {
+		o, err := object.GetObject(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		switch o := o.(type) {
+		case *object.Commit:
+			return o, nil
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil
+		}
+	}
+}
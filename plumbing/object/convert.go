@@ -0,0 +1,185 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+var (
+	commitTreePrefix     = []byte("tree ")
+	commitParentPrefix   = []byte("parent ")
+	commitMergeTagPrefix = []byte("mergetag object ")
+	tagObjectPrefix      = []byte("object ")
+	gitlinkMode          = []byte("160000")
+)
+
+// ReferencedObjects returns the IDs of the objects referenced by o: the tree
+// and the parents of a commit, the entries of a tree and the target of a
+// tag. The submodules of a tree, which aren't stored in the repository, are
+// skipped.
+func ReferencedObjects(o plumbing.EncodedObject) ([]plumbing.Hash, error) {
+	var ids []plumbing.Hash
+	_, err := rewriteObjectIDs(o, func(id plumbing.Hash, gitlink bool) (plumbing.Hash, error) {
+		if !gitlink {
+			ids = append(ids, id)
+		}
+
+		return id, nil
+	})
+
+	return ids, err
+}
+
+// ConvertObject writes to dst the object o converted to the object format of
+// dst, as git does for the repositories with a compat object format: the IDs
+// of the objects it references are replaced by the ones returned by mapID,
+// the rest of its content, signatures included, is kept as is. The gitlink
+// argument of mapID is true for the commits of the submodules of a tree,
+// which aren't stored in the repository.
+func ConvertObject(o, dst plumbing.EncodedObject, mapID func(id plumbing.Hash, gitlink bool) (plumbing.Hash, error)) (err error) {
+	dst.SetType(o.Type())
+	if o.Type() == plumbing.BlobObject {
+		dst.SetSize(o.Size())
+		return copyObjectContent(o, dst)
+	}
+
+	content, err := rewriteObjectIDs(o, mapID)
+	if err != nil {
+		return err
+	}
+
+	dst.SetSize(int64(len(content)))
+	w, err := dst.Writer()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+	_, err = w.Write(content)
+	return err
+}
+
+func copyObjectContent(o, dst plumbing.EncodedObject) (err error) {
+	r, err := o.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	w, err := dst.Writer()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// rewriteObjectIDs returns the content of o, with the IDs of the objects it
+// references replaced by the ones returned by fn.
+func rewriteObjectIDs(o plumbing.EncodedObject, fn func(id plumbing.Hash, gitlink bool) (plumbing.Hash, error)) ([]byte, error) {
+	if o.Type() == plumbing.BlobObject {
+		return nil, nil
+	}
+
+	content, err := readObjectContent(o)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Type() {
+	case plumbing.CommitObject:
+		return rewriteHeaderIDs(content, fn, commitTreePrefix, commitParentPrefix, commitMergeTagPrefix)
+	case plumbing.TagObject:
+		return rewriteHeaderIDs(content, fn, tagObjectPrefix)
+	case plumbing.TreeObject:
+		return rewriteTreeIDs(content, o.Hash().Size(), fn)
+	default:
+		return nil, ErrUnsupportedObject
+	}
+}
+
+func readObjectContent(o plumbing.EncodedObject) (content []byte, err error) {
+	r, err := o.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	return io.ReadAll(r)
+}
+
+// rewriteHeaderIDs rewrites the hexadecimal IDs of the header lines of a
+// commit or a tag starting with one of the given prefixes.
+func rewriteHeaderIDs(content []byte, fn func(plumbing.Hash, bool) (plumbing.Hash, error), prefixes ...[]byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(content))
+	for len(content) > 0 {
+		line, rest, found := bytes.Cut(content, []byte("\n"))
+		content = rest
+		if len(line) == 0 {
+			// The message follows the header, as is.
+			out.WriteByte('\n')
+			out.Write(content)
+			break
+		}
+
+		for _, p := range prefixes {
+			if !bytes.HasPrefix(line, p) {
+				continue
+			}
+
+			id, ok := plumbing.FromHex(string(line[len(p):]))
+			if !ok {
+				return nil, fmt.Errorf("malformed object header: %q", line)
+			}
+
+			mapped, err := fn(id, false)
+			if err != nil {
+				return nil, err
+			}
+
+			line = append(bytes.Clone(p), mapped.String()...)
+			break
+		}
+
+		out.Write(line)
+		if found {
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// rewriteTreeIDs rewrites the IDs of the entries of a tree, each one made of
+// a mode, a name and the binary ID of idSize bytes.
+func rewriteTreeIDs(content []byte, idSize int, fn func(plumbing.Hash, bool) (plumbing.Hash, error)) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(content))
+	for len(content) > 0 {
+		nul := bytes.IndexByte(content, 0)
+		if nul < 0 || len(content) < nul+1+idSize {
+			return nil, fmt.Errorf("malformed tree entry")
+		}
+
+		mode, _, _ := bytes.Cut(content[:nul], []byte(" "))
+		id, _ := plumbing.FromBytes(content[nul+1 : nul+1+idSize])
+		mapped, err := fn(id, bytes.Equal(mode, gitlinkMode))
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(content[:nul+1])
+		out.Write(mapped.Bytes())
+		content = content[nul+1+idSize:]
+	}
+
+	return out.Bytes(), nil
+}
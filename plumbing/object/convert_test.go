@@ -0,0 +1,106 @@
+package object
+
+import (
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/stretchr/testify/require"
+)
+
+// objectConverter converts the objects of s, and the ones they reference,
+// to the object format f.
+type objectConverter struct {
+	s       storer.EncodedObjectStorer
+	f       format.ObjectFormat
+	ids     map[plumbing.Hash]plumbing.Hash
+	objects map[plumbing.Hash]plumbing.EncodedObject
+}
+
+func (c *objectConverter) convert(t *testing.T, h plumbing.Hash) plumbing.Hash {
+	if id, ok := c.ids[h]; ok {
+		return id
+	}
+
+	o, err := c.s.EncodedObject(plumbing.AnyObject, h)
+	require.NoError(t, err)
+
+	refs, err := ReferencedObjects(o)
+	require.NoError(t, err)
+	for _, ref := range refs {
+		c.convert(t, ref)
+	}
+
+	dst := plumbing.NewMemoryObject(c.f)
+	require.NoError(t, ConvertObject(o, dst, func(id plumbing.Hash, _ bool) (plumbing.Hash, error) {
+		return c.ids[id], nil
+	}))
+
+	c.ids[h] = dst.Hash()
+	c.objects[dst.Hash()] = dst
+	return dst.Hash()
+}
+
+func TestConvertObject(t *testing.T) {
+	t.Parallel()
+
+	s := filesystem.NewStorage(fixtures.ByURL("https://github.com/git-fixtures/tags.git").One().DotGit(), cache.NewObjectLRUDefault())
+	to := &objectConverter{s: s, f: format.SHA256,
+		ids: make(map[plumbing.Hash]plumbing.Hash), objects: make(map[plumbing.Hash]plumbing.EncodedObject)}
+
+	iter, err := s.IterEncodedObjects(plumbing.AnyObject)
+	require.NoError(t, err)
+	require.NoError(t, iter.ForEach(func(o plumbing.EncodedObject) error {
+		id := to.convert(t, o.Hash())
+		require.Equal(t, format.SHA256Size, id.Size())
+		require.Equal(t, o.Type(), to.objects[id].Type())
+		return nil
+	}))
+
+	// The tag b742a2a9 points to the commit f7b877701fbf855b44c0a9e86f3fdce2c298b07f.
+	tag, err := DecodeTag(s, to.objects[to.ids[plumbing.NewHash("b742a2a9fa0afcfa9a6fad080980fbc26b007c69")]])
+	require.NoError(t, err)
+	require.Equal(t, "annotated-tag", tag.Name)
+	require.Equal(t, to.ids[plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f")], tag.Target)
+
+	// Converting the objects back gives the original ones.
+	originals := make(map[plumbing.Hash]plumbing.Hash, len(to.ids))
+	for original, id := range to.ids {
+		originals[id] = original
+	}
+
+	for id, o := range to.objects {
+		dst := plumbing.NewMemoryObject(format.SHA1)
+		require.NoError(t, ConvertObject(o, dst, func(h plumbing.Hash, _ bool) (plumbing.Hash, error) {
+			return originals[h], nil
+		}))
+
+		require.Equal(t, originals[id], dst.Hash())
+	}
+}
+
+func TestReferencedObjects(t *testing.T) {
+	t.Parallel()
+
+	s := filesystem.NewStorage(fixtures.ByURL("https://github.com/git-fixtures/tags.git").One().DotGit(), cache.NewObjectLRUDefault())
+	o, err := s.EncodedObject(plumbing.TagObject, plumbing.NewHash("b742a2a9fa0afcfa9a6fad080980fbc26b007c69"))
+	require.NoError(t, err)
+
+	refs, err := ReferencedObjects(o)
+	require.NoError(t, err)
+	require.Equal(t, []plumbing.Hash{plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f")}, refs)
+
+	c, err := GetCommit(s, plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f"))
+	require.NoError(t, err)
+
+	o, err = s.EncodedObject(plumbing.CommitObject, c.Hash)
+	require.NoError(t, err)
+
+	refs, err = ReferencedObjects(o)
+	require.NoError(t, err)
+	require.Equal(t, append([]plumbing.Hash{c.TreeHash}, c.ParentHashes...), refs)
+}
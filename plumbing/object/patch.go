@@ -12,6 +12,7 @@ import (
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/filemode"
 	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/diff"
 
 	dmp "github.com/sergi/go-diff/diffmatchpatch"
@@ -27,6 +28,10 @@ func getPatch(message string, changes ...*Change) (*Patch, error) {
 }
 
 func getPatchContext(ctx context.Context, message string, changes ...*Change) (*Patch, error) {
+	if err := prefetchChanges(changes); err != nil {
+		return nil, err
+	}
+
 	var filePatches []fdiff.FilePatch
 	for _, c := range changes {
 		select {
@@ -46,6 +51,30 @@ func getPatchContext(ctx context.Context, message string, changes ...*Change) (*
 	return &Patch{message, filePatches}, nil
 }
 
+// prefetchChanges retrieves at once the blobs of the changes, when the
+// storer supports it, e.g. in partial clones.
+func prefetchChanges(changes []*Change) error {
+	var s storer.EncodedObjectStorer
+	var hashes []plumbing.Hash
+	for _, c := range changes {
+		for _, e := range []ChangeEntry{c.From, c.To} {
+			if e.Tree == nil || e.TreeEntry.Mode == filemode.Submodule {
+				continue
+			}
+
+			s = e.Tree.s
+			hashes = append(hashes, e.TreeEntry.Hash)
+		}
+	}
+
+	p, ok := s.(storer.ObjectPrefetcher)
+	if !ok || len(hashes) == 0 {
+		return nil
+	}
+
+	return p.PrefetchObjects(hashes)
+}
+
 func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, error) {
 	from, to, err := c.Files()
 	if err != nil {
@@ -256,7 +256,9 @@ func (t *Tree) Decode(o plumbing.EncodedObject) (err error) {
 			return err
 		}
 
+		// The entries hold object IDs of the object format of the tree.
 		var hash plumbing.Hash
+		hash.ResetBySize(t.Hash.Size())
 		if _, err = hash.ReadFrom(r); err != nil {
 			return err
 		}
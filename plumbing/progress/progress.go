@@ -0,0 +1,176 @@
+// Package progress implements structured progress events, reported by the
+// remote operations, from the sideband progress messages of the server, and
+// by the local ones, such as indexing a packfile or checking out files.
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Phase is the name of an operation reporting progress. The phases use the
+// names of the progress messages of git.
+type Phase string
+
+const (
+	// Enumerating is the phase the server enumerates the objects to send.
+	Enumerating Phase = "Enumerating objects"
+	// Counting is the phase the server counts the objects to send.
+	Counting Phase = "Counting objects"
+	// Compressing is the phase the server compresses the objects to send.
+	Compressing Phase = "Compressing objects"
+	// Writing is the phase the objects are written to the remote.
+	Writing Phase = "Writing objects"
+	// Receiving is the phase the objects are received from the remote.
+	Receiving Phase = "Receiving objects"
+	// Indexing is the phase the objects of a received packfile are indexed.
+	Indexing Phase = "Indexing objects"
+	// Resolving is the phase the deltas of a received packfile are resolved.
+	Resolving Phase = "Resolving deltas"
+	// CheckingOut is the phase the files are written to the worktree.
+	CheckingOut Phase = "Checking out files"
+)
+
+// Event is a progress report of a phase.
+type Event struct {
+	// Phase is the name of the operation, one of the Phase constants for
+	// the known ones.
+	Phase Phase
+	// Current is the number of items done.
+	Current uint64
+	// Total is the number of items to do, zero if unknown.
+	Total uint64
+	// Bytes is the number of bytes transferred or processed, zero if
+	// unknown.
+	Bytes uint64
+	// Throughput is the number of bytes per second, zero if unknown.
+	Throughput uint64
+	// Done is true when the phase is finished.
+	Done bool
+	// Remote is true when the event was reported by the server.
+	Remote bool
+}
+
+// Percent returns the percentage of the items done, or -1 if the total is
+// unknown.
+func (e Event) Percent() int {
+	if e.Total == 0 {
+		return -1
+	}
+
+	return int(e.Current * 100 / e.Total)
+}
+
+// Reporter is implemented by the receivers of progress events.
+type Reporter interface {
+	// Report is called for each progress event.
+	Report(Event)
+}
+
+// ReporterFunc is an adapter to use a function as a Reporter.
+type ReporterFunc func(Event)
+
+// Report calls f(e).
+func (f ReporterFunc) Report(e Event) {
+	f(e)
+}
+
+// DefaultInterval is the minimum interval between the events reported by a
+// Meter, except for the first and last ones of a phase.
+const DefaultInterval = 100 * time.Millisecond
+
+// Meter reports the progress of a local phase to a Reporter, computing the
+// throughput and limiting the frequency of the events. A nil Meter reports
+// nothing, so it can be used unconditionally.
+type Meter struct {
+	r     Reporter
+	phase Phase
+	total uint64
+
+	mu       sync.Mutex
+	start    time.Time
+	last     time.Time
+	interval time.Duration
+	done     bool
+}
+
+// NewMeter returns a Meter of phase reporting to r, or nil if r is nil.
+// total is the number of items to do, zero if unknown.
+func NewMeter(r Reporter, phase Phase, total uint64) *Meter {
+	if r == nil {
+		return nil
+	}
+
+	return &Meter{
+		r:        r,
+		phase:    phase,
+		total:    total,
+		start:    time.Now(),
+		interval: DefaultInterval,
+	}
+}
+
+// SetTotal sets the number of items to do.
+func (m *Meter) SetTotal(total uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.total = total
+	m.mu.Unlock()
+}
+
+// Update reports that current items and bytes are done. The events are
+// limited to one per interval, except the first one and the one reaching the
+// total.
+func (m *Meter) Update(current, bytes uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if !m.last.IsZero() && now.Sub(m.last) < m.interval && (m.total == 0 || current < m.total) {
+		return
+	}
+
+	m.last = now
+	m.r.Report(m.event(now, current, bytes, false))
+}
+
+// Done reports that the phase is finished, with current items and bytes
+// done. Only the first call reports an event.
+func (m *Meter) Done(current, bytes uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.done {
+		return
+	}
+
+	m.done = true
+	m.r.Report(m.event(time.Now(), current, bytes, true))
+}
+
+func (m *Meter) event(now time.Time, current, bytes uint64, done bool) Event {
+	e := Event{
+		Phase:   m.phase,
+		Current: current,
+		Total:   m.total,
+		Bytes:   bytes,
+		Done:    done,
+	}
+
+	if elapsed := now.Sub(m.start); bytes > 0 && elapsed > 0 {
+		e.Throughput = uint64(float64(bytes) / elapsed.Seconds())
+	}
+
+	return e
+}
@@ -0,0 +1,45 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter(t *testing.T) {
+	var events []Event
+	m := NewMeter(ReporterFunc(func(e Event) {
+		events = append(events, e)
+	}), Indexing, 0)
+	m.interval = time.Hour
+
+	m.SetTotal(3)
+	m.Update(1, 10)
+	m.Update(2, 20)
+	m.Update(3, 30)
+	m.Done(3, 30)
+	m.Done(3, 30)
+
+	require.Len(t, events, 3)
+	require.Equal(t, uint64(1), events[0].Current)
+	require.Equal(t, uint64(3), events[1].Current)
+	require.False(t, events[1].Done)
+	require.True(t, events[2].Done)
+	for _, e := range events {
+		require.Equal(t, Indexing, e.Phase)
+		require.Equal(t, uint64(3), e.Total)
+		require.False(t, e.Remote)
+	}
+	require.Equal(t, 100, events[2].Percent())
+	require.Equal(t, -1, Event{}.Percent())
+}
+
+func TestNilMeter(t *testing.T) {
+	m := NewMeter(nil, Indexing, 1)
+	require.Nil(t, m)
+
+	m.SetTotal(2)
+	m.Update(1, 1)
+	m.Done(2, 2)
+}
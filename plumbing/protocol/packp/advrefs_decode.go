@@ -105,20 +105,22 @@ func decodeFirstHash(p *advRefsDecoder) decoderStateFn {
 		return nil
 	}
 
-	// TODO: Use object-format (when available) for hash size. Git 2.41+
-	if len(p.line) < hashSize {
+	// The size of the hash is the one of the object format of the
+	// repository, the object-format capability following it.
+	size := hexHashSize(p.line)
+	if len(p.line) < size {
 		p.error("cannot read hash, pkt-line too short")
 		return nil
 	}
 
-	h, ok := plumbing.FromHex(string(p.line[:hashSize]))
+	h, ok := plumbing.FromHex(string(p.line[:size]))
 	if !ok {
-		p.error("invalid hash text: %s", p.line[:hashSize])
+		p.error("invalid hash text: %s", p.line[:size])
 		return nil
 	}
 
 	p.hash = h
-	p.line = p.line[hashSize:]
+	p.line = p.line[size:]
 
 	if p.hash.IsZero() {
 		return decodeSkipNoRefs
@@ -235,14 +237,14 @@ func decodeShallow(p *advRefsDecoder) decoderStateFn {
 	}
 	p.line = bytes.TrimPrefix(p.line, shallow)
 
-	if len(p.line) != hashSize {
+	if !isHexHashSize(len(p.line)) {
 		p.error(fmt.Sprintf(
 			"malformed shallow hash: wrong length, expected 40 bytes, read %d bytes",
 			len(p.line)))
 		return nil
 	}
 
-	text := p.line[:hashSize]
+	text := p.line
 	h, ok := plumbing.FromHex(string(text))
 	if !ok {
 		p.error("invalid hash text: %s", string(text))
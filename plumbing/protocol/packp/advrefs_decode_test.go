@@ -127,6 +127,32 @@ func (s *AdvRefsDecodeSuite) TestFirstIsNotHead() {
 		ar.References["refs/heads/master"])
 }
 
+func (s *AdvRefsDecodeSuite) TestZeroIdSHA256() {
+	payloads := []string{
+		strings.Repeat("0", 64) + " capabilities^{}\x00object-format=sha256\n",
+		"",
+	}
+	ar := s.testDecodeOK(payloads)
+	s.Nil(ar.Head)
+	s.Equal([]string{"sha256"}, ar.Capabilities.Get(capability.ObjectFormat))
+}
+
+func (s *AdvRefsDecodeSuite) TestSHA256() {
+	payloads := []string{
+		"4cd8cda3e8ce793d0833790ffef73456511b9df56e6cfbf6f2e68cc5ea386d63 HEAD\x00object-format=sha256\n",
+		"cacd052cb93fe5d4f51fd3e1db31b766851e4b32646c158fdc5f0901ff274683 refs/heads/master\n",
+		"shallow ac9d653841063f1e459d2429a27e96d86eec2a93368be14bc2beb7604fcbd0b4\n",
+		"",
+	}
+	ar := s.testDecodeOK(payloads)
+	s.Equal("4cd8cda3e8ce793d0833790ffef73456511b9df56e6cfbf6f2e68cc5ea386d63", ar.Head.String())
+	s.Equal("cacd052cb93fe5d4f51fd3e1db31b766851e4b32646c158fdc5f0901ff274683",
+		ar.References["refs/heads/master"].String())
+	s.Equal([]plumbing.Hash{
+		plumbing.NewHash("ac9d653841063f1e459d2429a27e96d86eec2a93368be14bc2beb7604fcbd0b4"),
+	}, ar.Shallows)
+}
+
 func (s *AdvRefsDecodeSuite) TestShortRef() {
 	payloads := []string{
 		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 H",
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 )
@@ -92,7 +94,7 @@ func encodeFirstLine(e *advRefsEncoder) encoderStateFn {
 	capabilities := formatCaps(e.data.Capabilities)
 
 	if e.firstRefName == "" {
-		firstLine = fmt.Sprintf(formatFirstLine, plumbing.ZeroHash.String(), "capabilities^{}", capabilities)
+		firstLine = fmt.Sprintf(formatFirstLine, zeroID(e.data.Capabilities), "capabilities^{}", capabilities)
 	} else {
 		firstLine = fmt.Sprintf(formatFirstLine, e.firstRefHash.String(), e.firstRefName, capabilities)
 	}
@@ -104,6 +106,18 @@ func encodeFirstLine(e *advRefsEncoder) encoderStateFn {
 	return encodeRefs
 }
 
+// zeroID returns the zero-id of the object format advertised by c, SHA-1 by
+// default.
+func zeroID(c *capability.List) string {
+	if c != nil {
+		if f := c.Get(capability.ObjectFormat); len(f) == 1 && f[0] == format.SHA256.String() {
+			return strings.Repeat("0", format.SHA256HexSize)
+		}
+	}
+
+	return plumbing.ZeroHash.String()
+}
+
 func formatCaps(c *capability.List) string {
 	if c == nil {
 		return ""
@@ -42,6 +42,18 @@ func (s *AdvRefsEncodeSuite) TestZeroValue() {
 	testEncode(s, ar, expected)
 }
 
+func (s *AdvRefsEncodeSuite) TestZeroValueSHA256() {
+	ar := NewAdvRefs()
+	s.NoError(ar.Capabilities.Set(capability.ObjectFormat, "sha256"))
+
+	expected := pktlines(s.T(),
+		strings.Repeat("0", 64)+" capabilities^{}\x00object-format=sha256\n",
+		"",
+	)
+
+	testEncode(s, ar, expected)
+}
+
 func (s *AdvRefsEncodeSuite) TestHead() {
 	hash := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
 	ar := &AdvRefs{
@@ -1,14 +1,17 @@
 package packp
 
 import (
+	"bytes"
 	"fmt"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 )
 
 type stateFn func() stateFn
 
 const (
 	// common
-	hashSize = 40
+	hashSize = format.SHA1HexSize
 
 	// advrefs
 	head   = "HEAD"
@@ -32,6 +35,7 @@ var (
 	deepenCommits   = []byte("deepen ")
 	deepenSince     = []byte("deepen-since ")
 	deepenReference = []byte("deepen-not ")
+	filter          = []byte("filter ")
 
 	// shallow-update
 	unshallow = []byte("unshallow ")
@@ -72,3 +76,25 @@ func (err *ErrUnexpectedData) Error() string {
 
 	return fmt.Sprintf("%s (%s)", err.Msg, err.Data)
 }
+
+// isHexHashSize returns true if n is the size of the hexadecimal object IDs
+// of one of the supported object formats.
+func isHexHashSize(n int) bool {
+	return n == format.SHA1HexSize || n == format.SHA256HexSize
+}
+
+// hexHashSize returns the size of the hexadecimal object ID at the start of
+// line, ended by a space or by the end of the line: the one of SHA-256 when
+// it has its size, the one of SHA-1 otherwise.
+func hexHashSize(line []byte) int {
+	n := bytes.IndexByte(line, ' ')
+	if n == -1 {
+		n = len(line)
+	}
+
+	if n == format.SHA256HexSize {
+		return format.SHA256HexSize
+	}
+
+	return hashSize
+}
@@ -0,0 +1,200 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+)
+
+const (
+	// PushCertVersion is the push certificate version supported by go-git.
+	PushCertVersion = "0.1"
+
+	pushCertHeader = "push-cert"
+	pushCertEnd    = "push-cert-end"
+)
+
+var (
+	// ErrMalformedPushCert is returned when a push certificate can't be
+	// decoded, or when its version isn't supported.
+	ErrMalformedPushCert = errors.New("malformed push certificate")
+
+	certVersionPrefix = []byte("certificate version ")
+	certPusherPrefix  = []byte("pusher ")
+	certPusheePrefix  = []byte("pushee ")
+	certNoncePrefix   = []byte("nonce ")
+	certOptionPrefix  = []byte("push-option ")
+	signatureBegin    = []byte("-----BEGIN ")
+)
+
+// PushCertificate represents a signed push certificate sent by the client
+// when both ends support the push-cert capability. The certificate carries
+// the update commands and is signed by the pusher.
+//
+// See https://git-scm.com/docs/gitprotocol-pack#_push_certificate
+type PushCertificate struct {
+	// Version is the certificate version, usually PushCertVersion.
+	Version string
+	// Pusher is the identity of the signer, in the form of
+	// "Name <email> timestamp timezone".
+	Pusher string
+	// Pushee is the URL of the repository being pushed to, stripped of any
+	// credentials.
+	Pushee string
+	// Nonce is the nonce advertised by the server with push-cert=<nonce>.
+	Nonce string
+	// Options are the push-options included in the certificate.
+	Options []string
+	// Commands are the reference update commands.
+	Commands []*Command
+	// Signature is the detached signature of the certificate payload.
+	Signature []byte
+
+	// payload is the raw payload of a decoded certificate, which is what
+	// the signature covers.
+	payload []byte
+}
+
+// Payload returns the signed part of the certificate, that is, everything
+// but the signature. Decoded certificates return the payload as received.
+func (c *PushCertificate) Payload() []byte {
+	if c.payload != nil {
+		return c.payload
+	}
+
+	var buf bytes.Buffer
+	version := c.Version
+	if version == "" {
+		version = PushCertVersion
+	}
+
+	fmt.Fprintf(&buf, "%s%s\n", certVersionPrefix, version)
+	fmt.Fprintf(&buf, "%s%s\n", certPusherPrefix, c.Pusher)
+	if c.Pushee != "" {
+		fmt.Fprintf(&buf, "%s%s\n", certPusheePrefix, c.Pushee)
+	}
+	if c.Nonce != "" {
+		fmt.Fprintf(&buf, "%s%s\n", certNoncePrefix, c.Nonce)
+	}
+	for _, opt := range c.Options {
+		fmt.Fprintf(&buf, "%s%s\n", certOptionPrefix, opt)
+	}
+	buf.WriteByte('\n')
+	for _, cmd := range c.Commands {
+		fmt.Fprintf(&buf, "%s\n", formatCommand(cmd))
+	}
+
+	return buf.Bytes()
+}
+
+// encode writes the certificate lines to the given writer, starting right
+// after the push-cert line and including the push-cert-end line.
+func (c *PushCertificate) encode(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.Write(c.Payload())
+	buf.Write(c.Signature)
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	for {
+		line, err := buf.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if _, err := pktline.Write(w, line); err != nil {
+			return err
+		}
+	}
+
+	_, err := pktline.Writef(w, "%s\n", pushCertEnd)
+	return err
+}
+
+// pushCertDecoder decodes a certificate line by line. Lines belonging to the
+// header are parsed until the first empty line, after that, update commands
+// follow until the signature begins.
+type pushCertDecoder struct {
+	cert      *PushCertificate
+	inHeader  bool
+	inSig     bool
+	payload   bytes.Buffer
+	signature bytes.Buffer
+}
+
+func newPushCertDecoder(cert *PushCertificate) *pushCertDecoder {
+	return &pushCertDecoder{cert: cert, inHeader: true}
+}
+
+func (d *pushCertDecoder) decodeLine(line []byte) error {
+	if d.inSig {
+		d.signature.Write(line)
+		return nil
+	}
+
+	text := bytes.TrimSuffix(line, []byte("\n"))
+	if !bytes.HasPrefix(text, signatureBegin) {
+		d.payload.Write(text)
+		d.payload.WriteByte('\n')
+	}
+
+	if d.inHeader {
+		switch {
+		case len(text) == 0:
+			d.inHeader = false
+		case bytes.HasPrefix(text, certVersionPrefix):
+			d.cert.Version = string(text[len(certVersionPrefix):])
+		case bytes.HasPrefix(text, certPusherPrefix):
+			d.cert.Pusher = string(text[len(certPusherPrefix):])
+		case bytes.HasPrefix(text, certPusheePrefix):
+			d.cert.Pushee = string(text[len(certPusheePrefix):])
+		case bytes.HasPrefix(text, certNoncePrefix):
+			d.cert.Nonce = string(text[len(certNoncePrefix):])
+		case bytes.HasPrefix(text, certOptionPrefix):
+			d.cert.Options = append(d.cert.Options, string(text[len(certOptionPrefix):]))
+		default:
+			// Unknown headers are ignored, like upstream does.
+		}
+
+		return nil
+	}
+
+	if bytes.HasPrefix(text, signatureBegin) {
+		d.inSig = true
+		d.signature.Write(line)
+		return nil
+	}
+
+	if len(text) == 0 {
+		return nil
+	}
+
+	cmd, err := parseCommand(text)
+	if err != nil {
+		return err
+	}
+
+	d.cert.Commands = append(d.cert.Commands, cmd)
+	return nil
+}
+
+func (d *pushCertDecoder) finish() error {
+	if d.inHeader || d.cert.Version == "" || d.cert.Pusher == "" {
+		return ErrMalformedPushCert
+	}
+
+	if !strings.HasPrefix(d.cert.Version, "0.") {
+		return fmt.Errorf("%w: unsupported version %q", ErrMalformedPushCert, d.cert.Version)
+	}
+
+	d.cert.payload = d.payload.Bytes()
+	if d.signature.Len() > 0 {
+		d.cert.Signature = d.signature.Bytes()
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package packp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/stretchr/testify/suite"
+)
+
+type PushCertSuite struct {
+	suite.Suite
+}
+
+func TestPushCertSuite(t *testing.T) {
+	suite.Run(t, new(PushCertSuite))
+}
+
+func (s *PushCertSuite) newCertificate() *PushCertificate {
+	return &PushCertificate{
+		Version: PushCertVersion,
+		Pusher:  "John Doe <john@example.com> 1234567890 +0000",
+		Pushee:  "https://example.com/repo.git",
+		Nonce:   "1234567890-abcdef",
+		Options: []string{"ci.skip"},
+		Commands: []*Command{
+			{
+				Name: plumbing.ReferenceName("refs/heads/master"),
+				Old:  plumbing.NewHash("1ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+				New:  plumbing.NewHash("2ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+			},
+		},
+		Signature: []byte("-----BEGIN PGP SIGNATURE-----\nsig\n-----END PGP SIGNATURE-----\n"),
+	}
+}
+
+func (s *PushCertSuite) TestPayload() {
+	cert := s.newCertificate()
+	expected := "certificate version 0.1\n" +
+		"pusher John Doe <john@example.com> 1234567890 +0000\n" +
+		"pushee https://example.com/repo.git\n" +
+		"nonce 1234567890-abcdef\n" +
+		"push-option ci.skip\n" +
+		"\n" +
+		"1ecf0ef2c2dffb796033e5a02219af86ec6584e5 2ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n"
+
+	s.Equal(expected, string(cert.Payload()))
+}
+
+func (s *PushCertSuite) TestEncode() {
+	req := NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	req.Certificate = s.newCertificate()
+
+	expected := pktlines(s.T(),
+		"push-cert\x00report-status",
+		"certificate version 0.1\n",
+		"pusher John Doe <john@example.com> 1234567890 +0000\n",
+		"pushee https://example.com/repo.git\n",
+		"nonce 1234567890-abcdef\n",
+		"push-option ci.skip\n",
+		"\n",
+		"1ecf0ef2c2dffb796033e5a02219af86ec6584e5 2ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+		"-----BEGIN PGP SIGNATURE-----\n",
+		"sig\n",
+		"-----END PGP SIGNATURE-----\n",
+		"push-cert-end\n",
+		"",
+	)
+
+	var buf bytes.Buffer
+	s.Require().NoError(req.Encode(&buf))
+	s.Equal(string(expected), buf.String())
+}
+
+func (s *PushCertSuite) TestEncodeDecode() {
+	req := NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	req.Certificate = s.newCertificate()
+
+	var buf bytes.Buffer
+	s.Require().NoError(req.Encode(&buf))
+
+	obtained := NewUpdateRequests()
+	s.Require().NoError(obtained.Decode(&buf))
+
+	cert := obtained.Certificate
+	s.Require().NotNil(cert)
+	s.Equal(req.Certificate.Pusher, cert.Pusher)
+	s.Equal(req.Certificate.Pushee, cert.Pushee)
+	s.Equal(req.Certificate.Nonce, cert.Nonce)
+	s.Equal(req.Certificate.Options, cert.Options)
+	s.Equal(req.Certificate.Commands, cert.Commands)
+	s.Equal(req.Certificate.Commands, obtained.Commands)
+	s.Equal(req.Certificate.Signature, cert.Signature)
+	s.Equal(req.Certificate.Payload(), cert.Payload())
+	s.True(obtained.Capabilities.Supports(capability.ReportStatus))
+}
+
+func (s *PushCertSuite) TestDecodeKeepsUnknownHeadersInPayload() {
+	input := pktlines(s.T(),
+		"push-cert\x00report-status",
+		"certificate version 0.1\n",
+		"pusher John Doe <john@example.com> 1234567890 +0000\n",
+		"x-unknown header\n",
+		"\n",
+		"1ecf0ef2c2dffb796033e5a02219af86ec6584e5 2ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+		"push-cert-end\n",
+		"",
+	)
+
+	req := NewUpdateRequests()
+	s.Require().NoError(req.Decode(bytes.NewReader(input)))
+	s.Contains(string(req.Certificate.Payload()), "x-unknown header\n")
+	s.Nil(req.Certificate.Signature)
+	s.Len(req.Commands, 1)
+}
+
+func (s *PushCertSuite) TestDecodeMissingEnd() {
+	input := pktlines(s.T(),
+		"push-cert\x00report-status",
+		"certificate version 0.1\n",
+		"pusher John Doe <john@example.com> 1234567890 +0000\n",
+		"\n",
+		"",
+	)
+
+	req := NewUpdateRequests()
+	s.ErrorIs(req.Decode(bytes.NewReader(input)), ErrMalformedPushCert)
+}
+
+func (s *PushCertSuite) TestDecodeMissingPusher() {
+	input := pktlines(s.T(),
+		"push-cert\x00report-status",
+		"certificate version 0.1\n",
+		"\n",
+		"1ecf0ef2c2dffb796033e5a02219af86ec6584e5 2ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+		"push-cert-end\n",
+		"",
+	)
+
+	req := NewUpdateRequests()
+	s.ErrorIs(req.Decode(bytes.NewReader(input)), ErrMalformedPushCert)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
 )
 
@@ -76,11 +77,12 @@ func (r *ShallowUpdate) decodeUnshallowLine(line []byte) error {
 }
 
 func (r *ShallowUpdate) decodeLine(line, prefix []byte, expLen int) (plumbing.Hash, error) {
-	if len(line) != expLen {
+	// expLen is the length of the line with a SHA-1 hash.
+	if len(line) != expLen && len(line) != expLen-hashSize+format.SHA256HexSize {
 		return plumbing.ZeroHash, fmt.Errorf("malformed %s%q", prefix, line)
 	}
 
-	raw := string(line[expLen-40 : expLen])
+	raw := string(line[len(prefix):])
 	return plumbing.NewHash(raw), nil
 }
 
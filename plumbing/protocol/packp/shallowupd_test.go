@@ -56,6 +56,24 @@ func (s *ShallowUpdateSuite) TestDecode() {
 	}, su.Shallows)
 }
 
+func (s *ShallowUpdateSuite) TestDecodeSHA256() {
+	raw := "" +
+		"004dshallow aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\n" +
+		"004funshallow bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\n" +
+		"0000"
+
+	su := &ShallowUpdate{}
+	err := su.Decode(bytes.NewBufferString(raw))
+	s.NoError(err)
+
+	s.Equal([]plumbing.Hash{
+		plumbing.NewHash("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+	}, su.Shallows)
+	s.Equal([]plumbing.Hash{
+		plumbing.NewHash("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"),
+	}, su.Unshallows)
+}
+
 func (s *ShallowUpdateSuite) TestDecodeUnshallow() {
 	raw := "" +
 		"0036unshallow aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" +
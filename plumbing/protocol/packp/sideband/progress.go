@@ -0,0 +1,117 @@
+package sideband
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing/progress"
+)
+
+// progressLine matches the progress messages of git, such as:
+//
+//	Counting objects: 100% (5/5), done.
+//	Enumerating objects: 1234
+//	Receiving objects:  45% (450/1000), 1.20 MiB | 2.40 MiB/s
+var progressLine = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*?):\s+` +
+	`(?:(\d+)%\s+\((\d+)/(\d+)\)|(\d+))` +
+	`(?:,\s+([\d.]+)\s+(bytes|KiB|MiB|GiB)(?:\s+\|\s+([\d.]+)\s+(bytes|KiB|MiB|GiB)/s)?)?` +
+	`(,\s+done\.?)?\s*$`)
+
+var byteUnits = map[string]float64{
+	"bytes": 1,
+	"KiB":   1 << 10,
+	"MiB":   1 << 20,
+	"GiB":   1 << 30,
+}
+
+// ParseProgress parses a progress message sent by the server, with or
+// without the "remote: " prefix. It returns false if line isn't a progress
+// message, such as the "Total" summary.
+func ParseProgress(line string) (progress.Event, bool) {
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "remote:"))
+	m := progressLine.FindStringSubmatch(line)
+	if m == nil {
+		return progress.Event{}, false
+	}
+
+	e := progress.Event{
+		Phase:  progress.Phase(m[1]),
+		Done:   m[10] != "",
+		Remote: true,
+	}
+
+	if m[5] != "" {
+		e.Current, _ = strconv.ParseUint(m[5], 10, 64)
+	} else {
+		e.Current, _ = strconv.ParseUint(m[3], 10, 64)
+		e.Total, _ = strconv.ParseUint(m[4], 10, 64)
+	}
+
+	e.Bytes = parseBytes(m[6], m[7])
+	e.Throughput = parseBytes(m[8], m[9])
+	return e, true
+}
+
+func parseBytes(value, unit string) uint64 {
+	if value == "" {
+		return 0
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+
+	return uint64(f * byteUnits[unit])
+}
+
+// ProgressWriter is a Progress parsing the progress messages written to it
+// into events reported to a progress.Reporter. It's also a progress.Reporter
+// itself forwarding the events, so it can be used as the progress of the
+// operations reporting both remote and local progress. It's safe for
+// concurrent use, the events being reported to r one at a time.
+type ProgressWriter struct {
+	r progress.Reporter
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewProgressWriter returns a ProgressWriter reporting to r.
+func NewProgressWriter(r progress.Reporter) *ProgressWriter {
+	return &ProgressWriter{r: r}
+}
+
+// Write parses the complete progress messages of p, the messages being
+// terminated by either a carriage return or a new line. The incomplete ones
+// are kept until the next call.
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		if e, ok := ParseProgress(string(w.buf[:i])); ok {
+			w.r.Report(e)
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Report forwards e to the progress.Reporter.
+func (w *ProgressWriter) Report(e progress.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.r.Report(e)
+}
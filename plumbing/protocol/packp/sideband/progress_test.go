@@ -0,0 +1,93 @@
+package sideband
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing/progress"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProgress(t *testing.T) {
+	for line, expected := range map[string]progress.Event{
+		"Enumerating objects: 1234": {
+			Phase: progress.Enumerating, Current: 1234, Remote: true,
+		},
+		"remote: Counting objects: 100% (5/5), done.": {
+			Phase: progress.Counting, Current: 5, Total: 5, Done: true, Remote: true,
+		},
+		"Compressing objects:  50% (2/4)": {
+			Phase: progress.Compressing, Current: 2, Total: 4, Remote: true,
+		},
+		"Receiving objects:  45% (450/1000), 1.50 MiB | 512.00 KiB/s": {
+			Phase: progress.Receiving, Current: 450, Total: 1000,
+			Bytes: 3 << 19, Throughput: 512 << 10, Remote: true,
+		},
+		"Writing objects: 100% (3/3), 250 bytes | 250.00 KiB/s, done.": {
+			Phase: progress.Writing, Current: 3, Total: 3,
+			Bytes: 250, Throughput: 250 << 10, Done: true, Remote: true,
+		},
+	} {
+		e, ok := ParseProgress(line)
+		require.True(t, ok, line)
+		require.Equal(t, expected, e, line)
+	}
+
+	for _, line := range []string{
+		"",
+		"Total 5 (delta 0), reused 0 (delta 0), pack-reused 0",
+		"remote: some message",
+	} {
+		_, ok := ParseProgress(line)
+		require.False(t, ok, line)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var events []progress.Event
+	w := NewProgressWriter(progress.ReporterFunc(func(e progress.Event) {
+		events = append(events, e)
+	}))
+
+	for _, s := range []string{
+		"Counting objects:  50% (1/2)\r",
+		"Counting objects: 100% (2/2)\rCounting ",
+		"objects: 100% (2/2), done.\nTotal 2 (delta 0)\n",
+	} {
+		n, err := w.Write([]byte(s))
+		require.NoError(t, err)
+		require.Equal(t, len(s), n)
+	}
+
+	w.Report(progress.Event{Phase: progress.Resolving, Current: 1, Total: 1, Done: true})
+
+	require.Equal(t, []progress.Event{
+		{Phase: progress.Counting, Current: 1, Total: 2, Remote: true},
+		{Phase: progress.Counting, Current: 2, Total: 2, Remote: true},
+		{Phase: progress.Counting, Current: 2, Total: 2, Done: true, Remote: true},
+		{Phase: progress.Resolving, Current: 1, Total: 1, Done: true},
+	}, events)
+}
+
+func TestProgressWriterConcurrent(t *testing.T) {
+	var events int
+	w := NewProgressWriter(progress.ReporterFunc(func(progress.Event) {
+		events++
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			w.Write([]byte("Counting objects: 100% (2/2)\r")) //nolint:errcheck
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		w.Report(progress.Event{Phase: progress.Resolving})
+	}
+
+	wg.Wait()
+	require.Equal(t, 200, events)
+}
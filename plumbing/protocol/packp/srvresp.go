@@ -94,7 +94,8 @@ func (r *ServerResponse) decodeACKLine(line []byte) (err error) {
 	}
 
 	var ack ACK
-	// TODO: Dynamic hash size and sha256 support
+	// The size of the hash, and so its object format, is the one of the
+	// hexadecimal text.
 	ack.Hash = plumbing.NewHash(string(bytes.TrimSuffix(parts[1], []byte("\n"))))
 	err = io.EOF
 
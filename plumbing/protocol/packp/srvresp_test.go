@@ -66,6 +66,18 @@ func (s *ServerResponseSuite) TestDecodeACK() {
 	s.Equal(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), sr.ACKs[0].Hash)
 }
 
+func (s *ServerResponseSuite) TestDecodeACKSHA256() {
+	raw := "004fACK 4cd8cda3e8ce793d0833790ffef73456511b9df56e6cfbf6f2e68cc5ea386d63 ready\n"
+
+	sr := &ServerResponse{}
+	err := sr.Decode(bytes.NewBufferString(raw))
+	s.NoError(err)
+
+	s.Len(sr.ACKs, 1)
+	s.Equal("4cd8cda3e8ce793d0833790ffef73456511b9df56e6cfbf6f2e68cc5ea386d63", sr.ACKs[0].Hash.String())
+	s.Equal(ACKReady, sr.ACKs[0].Status)
+}
+
 func (s *ServerResponseSuite) TestDecodeMultipleACK() {
 	raw := "" +
 		"003aACK 1111111111111111111111111111111111111111 continue\n" +
@@ -97,17 +97,18 @@ func (d *ulReqDecoder) decodeFirstWant() stateFn {
 }
 
 func (d *ulReqDecoder) readHash() (plumbing.Hash, bool) {
-	if len(d.line) < hashSize {
+	size := hexHashSize(d.line)
+	if len(d.line) < size {
 		d.err = fmt.Errorf("malformed hash: %v", d.line)
 		return plumbing.ZeroHash, false
 	}
 
-	h, ok := plumbing.FromHex(string(d.line[:hashSize]))
+	h, ok := plumbing.FromHex(string(d.line[:size]))
 	if !ok {
-		d.error("invalid hash text: %s", d.line[:hashSize])
+		d.error("invalid hash text: %s", d.line[:size])
 		return plumbing.ZeroHash, false
 	}
-	d.line = d.line[hashSize:]
+	d.line = d.line[size:]
 
 	return h, true
 }
@@ -136,6 +137,10 @@ func (d *ulReqDecoder) decodeOtherWants() stateFn {
 		return d.decodeDeepen
 	}
 
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
 	if len(d.line) == 0 {
 		return nil
 	}
@@ -161,6 +166,10 @@ func (d *ulReqDecoder) decodeShallow() stateFn {
 		return d.decodeDeepen
 	}
 
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
 	if len(d.line) == 0 {
 		return nil
 	}
@@ -244,11 +253,36 @@ func (d *ulReqDecoder) decodeDeepenReference() stateFn {
 	return d.decodeFlush
 }
 
+// Expected format: filter <filter-spec>
+func (d *ulReqDecoder) decodeFilter() stateFn {
+	d.line = bytes.TrimPrefix(d.line, filter)
+	if len(d.line) == 0 {
+		d.error("empty filter specification")
+		return nil
+	}
+
+	d.data.Filter = Filter(d.line)
+
+	if ok := d.nextLine(); !ok {
+		return nil
+	}
+
+	if len(d.line) != 0 {
+		d.err = fmt.Errorf("unexpected payload while expecting a flush-pkt: %q", d.line)
+	}
+
+	return nil
+}
+
 func (d *ulReqDecoder) decodeFlush() stateFn {
 	if ok := d.nextLine(); !ok {
 		return nil
 	}
 
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
 	if len(d.line) != 0 {
 		d.err = fmt.Errorf("unexpected payload while expecting a flush-pkt: %q", d.line)
 	}
@@ -567,3 +567,39 @@ func (s *UlReqDecodeSuite) TestExtraData() {
 	r := toPktLines(s.T(), payloads)
 	s.testDecoderErrorMatches(r, ".*unexpected payload.*")
 }
+
+func (s *UlReqDecodeSuite) TestFilter() {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"filter blob:none",
+		"",
+	}
+	ur, _ := s.testDecodeOK(payloads, 0)
+
+	s.Equal(FilterBlobNone(), ur.Filter)
+}
+
+func (s *UlReqDecodeSuite) TestFilterWithShallowAndDepth() {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"shallow aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"deepen 2",
+		"filter combine:blob%3Anone+tree%3A1",
+		"",
+	}
+	ur, _ := s.testDecodeOK(payloads, 0)
+
+	s.Equal(DepthCommits(2), ur.Depth)
+	s.Equal(FilterCombine(FilterBlobNone(), FilterTreeDepth(1)), ur.Filter)
+}
+
+func (s *UlReqDecodeSuite) TestFilterExtraData() {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"filter blob:none",
+		"filter tree:0",
+		"",
+	}
+	r := toPktLines(s.T(), payloads)
+	s.testDecoderErrorMatches(r, ".*unexpected payload.*")
+}
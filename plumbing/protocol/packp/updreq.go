@@ -18,23 +18,30 @@ type UpdateRequests struct {
 	Capabilities *capability.List
 	Commands     []*Command
 	Shallow      *plumbing.Hash
-	// TODO: Support push-cert
+	// Certificate is the signed push certificate, if any. When set, the
+	// commands are sent as part of the certificate instead of the command
+	// list, and Commands is ignored when encoding.
+	Certificate *PushCertificate
 }
 
 // NewUpdateRequests returns a new UpdateRequests.
 func NewUpdateRequests() *UpdateRequests {
-	// TODO: Add support for push-cert
 	return &UpdateRequests{
 		Capabilities: capability.NewList(),
 	}
 }
 
 func (req *UpdateRequests) validate() error {
-	if len(req.Commands) == 0 {
+	cmds := req.Commands
+	if req.Certificate != nil {
+		cmds = req.Certificate.Commands
+	}
+
+	if len(cmds) == 0 {
 		return ErrEmptyCommands
 	}
 
-	for _, c := range req.Commands {
+	for _, c := range cmds {
 		if err := c.validate(); err != nil {
 			return err
 		}
@@ -59,15 +66,15 @@ type Command struct {
 }
 
 func (c *Command) Action() Action {
-	if c.Old == plumbing.ZeroHash && c.New == plumbing.ZeroHash {
+	if c.Old.IsZero() && c.New.IsZero() {
 		return Invalid
 	}
 
-	if c.Old == plumbing.ZeroHash {
+	if c.Old.IsZero() {
 		return Create
 	}
 
-	if c.New == plumbing.ZeroHash {
+	if c.New.IsZero() {
 		return Delete
 	}
 
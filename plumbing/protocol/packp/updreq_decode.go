@@ -141,7 +141,7 @@ func (d *updReqDecoder) decodeShallow() error {
 		return nil
 	}
 
-	if len(b) != shallowLineLength {
+	if !isHexHashSize(len(b) - len(shallow)) {
 		return errInvalidShallowLineLength(len(b))
 	}
 
@@ -163,6 +163,10 @@ func (d *updReqDecoder) decodeCommands() error {
 	// Process the first line which contains both command and capabilities
 	payload := d.payload
 
+	if bytes.HasPrefix(payload, []byte(pushCertHeader+"\x00")) {
+		return d.decodeCertificate()
+	}
+
 	// The first line must contain capabilities separated by a null byte
 	sep := bytes.IndexByte(payload, 0)
 	if sep == -1 {
@@ -203,6 +207,43 @@ func (d *updReqDecoder) decodeCommands() error {
 	}
 }
 
+func (d *updReqDecoder) decodeCertificate() error {
+	caps := bytes.TrimSuffix(d.payload[len(pushCertHeader)+1:], []byte("\n"))
+	if err := d.req.Capabilities.Decode(caps); err != nil {
+		return err
+	}
+
+	cert := &PushCertificate{}
+	cd := newPushCertDecoder(cert)
+	for {
+		if err := d.readLine(ErrMalformedPushCert); err != nil {
+			return err
+		}
+
+		if d.length == pktline.Flush {
+			return ErrMalformedPushCert
+		}
+
+		if string(bytes.TrimSuffix(d.payload, []byte("\n"))) == pushCertEnd {
+			break
+		}
+
+		if err := cd.decodeLine(d.payload); err != nil {
+			return err
+		}
+	}
+
+	if err := cd.finish(); err != nil {
+		return err
+	}
+
+	d.req.Certificate = cert
+	d.req.Commands = cert.Commands
+
+	// The certificate is followed by a flush line.
+	return d.readLine(errNoFlush)
+}
+
 func (d *updReqDecoder) decodeFlush() error {
 	// We should always have a flush line at the end of the request.
 	if len(d.payload) != 0 || d.length != pktline.Flush {
@@ -239,7 +280,7 @@ func parseCommand(b []byte) (*Command, error) {
 }
 
 func parseHash(s string) (plumbing.Hash, error) {
-	if len(s) != hashSize {
+	if !isHexHashSize(len(s)) {
 		return plumbing.ZeroHash, errInvalidHashSize(len(s))
 	}
 
@@ -3,6 +3,7 @@ package packp
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
@@ -19,6 +20,10 @@ func (req *UpdateRequests) Encode(w io.Writer) error {
 		return err
 	}
 
+	if req.Certificate != nil {
+		return req.encodeCertificate(w, req.Certificate, req.Capabilities)
+	}
+
 	if err := req.encodeCommands(w, req.Commands, req.Capabilities); err != nil {
 		return err
 	}
@@ -55,8 +60,33 @@ func (req *UpdateRequests) encodeCommands(w io.Writer,
 	return pktline.WriteFlush(w)
 }
 
+func (req *UpdateRequests) encodeCertificate(w io.Writer,
+	cert *PushCertificate, cap *capability.List,
+) error {
+	if _, err := pktline.Writef(w, "%s\x00%s",
+		pushCertHeader, cap.String()); err != nil {
+		return err
+	}
+
+	if err := cert.encode(w); err != nil {
+		return err
+	}
+
+	return pktline.WriteFlush(w)
+}
+
 func formatCommand(cmd *Command) string {
 	o := cmd.Old.String()
 	n := cmd.New.String()
+
+	// The zero ID of a creation or a deletion has the object format of the
+	// other one.
+	if cmd.Old.IsZero() {
+		o = strings.Repeat("0", cmd.New.HexSize())
+	}
+	if cmd.New.IsZero() {
+		n = strings.Repeat("0", cmd.Old.HexSize())
+	}
+
 	return fmt.Sprintf("%s %s %s", o, n, cmd.Name)
 }
@@ -3,6 +3,7 @@ package packp
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/go-git/go-git/v6/plumbing"
@@ -56,6 +57,32 @@ func (s *UpdReqEncodeSuite) TestOneUpdateCommand() {
 	s.testEncode(r, expected)
 }
 
+func (s *UpdReqEncodeSuite) TestSHA256Commands() {
+	hash := plumbing.NewHash("4cd8cda3e8ce793d0833790ffef73456511b9df56e6cfbf6f2e68cc5ea386d63")
+	zero := strings.Repeat("0", 64)
+
+	r := NewUpdateRequests()
+	r.Commands = []*Command{
+		{Name: plumbing.ReferenceName("created"), Old: plumbing.ZeroHash, New: hash},
+		{Name: plumbing.ReferenceName("deleted"), Old: hash, New: plumbing.ZeroHash},
+	}
+
+	expected := pktlines(s.T(),
+		zero+" "+hash.String()+" created\x00",
+		hash.String()+" "+zero+" deleted",
+		"",
+	)
+
+	s.testEncode(r, expected)
+
+	decoded := NewUpdateRequests()
+	s.NoError(decoded.Decode(bytes.NewReader(expected)))
+	s.Len(decoded.Commands, 2)
+	s.Equal(hash.String(), decoded.Commands[0].New.String())
+	s.True(decoded.Commands[0].Old.IsZero())
+	s.Equal(hash.String(), decoded.Commands[1].Old.String())
+}
+
 func (s *UpdReqEncodeSuite) TestMultipleCommands() {
 	hash1 := plumbing.NewHash("1ecf0ef2c2dffb796033e5a02219af86ec6584e5")
 	hash2 := plumbing.NewHash("2ecf0ef2c2dffb796033e5a02219af86ec6584e5")
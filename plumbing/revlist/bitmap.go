@@ -0,0 +1,379 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/bitmap"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// bitmapCommitInterval is the number of commits between the ones having a
+// bitmap, besides the tips.
+const bitmapCommitInterval = 100
+
+var (
+	errNoBitmap    = errors.New("no reachability bitmap")
+	errNotInBitmap = errors.New("object not in the reachability bitmap")
+	errInvalidType = errors.New("object type not valid")
+)
+
+// bitmapWalker adds to bitmaps the objects reachable from others, using the
+// bitmaps of the commits having one instead of walking them.
+type bitmapWalker struct {
+	s   storer.EncodedObjectStorer
+	idx *bitmap.Index
+	// walked, if not nil, is called with each object walked, along with its
+	// type and path.
+	walked func(pos int, t plumbing.ObjectType, path string)
+}
+
+func (w *bitmapWalker) set(b *bitmap.Bitmap, pos int, t plumbing.ObjectType, path string) {
+	b.Set(pos)
+	if w.walked != nil {
+		w.walked(pos, t, path)
+	}
+}
+
+// add adds to b the objects reachable from h, which must be in the
+// packfile along with all of them.
+func (w *bitmapWalker) add(b *bitmap.Bitmap, h plumbing.Hash) error {
+	pos, ok := w.idx.Position(h)
+	if !ok {
+		return errNotInBitmap
+	}
+
+	if b.Get(pos) {
+		return nil
+	}
+
+	o, err := w.s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return err
+	}
+
+	switch o.Type() {
+	case plumbing.CommitObject:
+		return w.addCommits(b, h)
+	case plumbing.TreeObject:
+		return w.addTree(b, h, "")
+	case plumbing.BlobObject:
+		w.set(b, pos, plumbing.BlobObject, "")
+		return nil
+	case plumbing.TagObject:
+		tag, err := object.DecodeTag(w.s, o)
+		if err != nil {
+			return err
+		}
+
+		w.set(b, pos, plumbing.TagObject, "")
+		return w.add(b, tag.Target)
+	default:
+		return fmt.Errorf("%w: %s", errInvalidType, o.Type())
+	}
+}
+
+// addCommits adds to b the commit h and its ancestors, along with their
+// trees.
+func (w *bitmapWalker) addCommits(b *bitmap.Bitmap, h plumbing.Hash) error {
+	pending := []plumbing.Hash{h}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		pos, ok := w.idx.Position(h)
+		if !ok {
+			return errNotInBitmap
+		}
+
+		if b.Get(pos) {
+			continue
+		}
+
+		if reachable, ok := w.idx.Bitmap(h); ok {
+			b.Or(reachable)
+			continue
+		}
+
+		commit, err := object.GetCommit(w.s, h)
+		if err != nil {
+			return err
+		}
+
+		w.set(b, pos, plumbing.CommitObject, "")
+		if err := w.addTree(b, commit.TreeHash, ""); err != nil {
+			return err
+		}
+
+		pending = append(pending, commit.ParentHashes...)
+	}
+
+	return nil
+}
+
+// addTree adds to b the tree h at the given path and its entries.
+func (w *bitmapWalker) addTree(b *bitmap.Bitmap, h plumbing.Hash, path string) error {
+	pos, ok := w.idx.Position(h)
+	if !ok {
+		return errNotInBitmap
+	}
+
+	if b.Get(pos) {
+		return nil
+	}
+
+	tree, err := object.GetTree(w.s, h)
+	if err != nil {
+		return err
+	}
+
+	w.set(b, pos, plumbing.TreeObject, path)
+	for _, e := range tree.Entries {
+		name := e.Name
+		if path != "" {
+			name = path + "/" + e.Name
+		}
+
+		switch e.Mode {
+		case filemode.Submodule:
+			continue
+		case filemode.Dir:
+			if err := w.addTree(b, e.Hash, name); err != nil {
+				return err
+			}
+		default:
+			pos, ok := w.idx.Position(e.Hash)
+			if !ok {
+				return errNotInBitmap
+			}
+
+			if !b.Get(pos) {
+				w.set(b, pos, plumbing.BlobObject, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// BuildBitmap returns the reachability bitmap index of the packfile pack,
+// indexed by idx, with the bitmaps of the commits reachable from tips and
+// the name-hash cache. The tips, and all the objects reachable from them,
+// must be in the packfile.
+func BuildBitmap(
+	s storer.EncodedObjectStorer,
+	pack plumbing.Hash,
+	idx idxfile.Index,
+	tips []plumbing.Hash,
+) (*bitmap.Index, error) {
+	bi, err := bitmap.NewIndex(pack, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := &bitmap.Bitmap{}
+	w := &bitmapWalker{s: s, idx: bi, walked: func(pos int, t plumbing.ObjectType, path string) {
+		if !typed.Get(pos) {
+			typed.Set(pos)
+			bi.SetType(pos, t)
+			bi.SetNameHash(pos, bitmap.HashName(path))
+		}
+	}}
+
+	commits, err := tipCommits(w, tips)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := commitsTopoOrder(s, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := hashListToSet(commits)
+	for i, h := range order {
+		if !selected[h] && (i+1)%bitmapCommitInterval != 0 {
+			continue
+		}
+
+		b := &bitmap.Bitmap{}
+		if err := w.addCommits(b, h); err != nil {
+			return nil, err
+		}
+
+		if err := bi.SetBitmap(h, b); err != nil {
+			return nil, err
+		}
+	}
+
+	// The objects which aren't reachable from the tips are in the packfile
+	// anyway.
+	for pos := 0; pos < bi.Count(); pos++ {
+		if typed.Get(pos) {
+			continue
+		}
+
+		o, err := s.EncodedObject(plumbing.AnyObject, bi.Hash(pos))
+		if err != nil {
+			return nil, err
+		}
+
+		w.walked(pos, o.Type(), "")
+	}
+
+	return bi, nil
+}
+
+// tipCommits returns the commits pointed by tips, directly or through
+// annotated tags, which are recorded in the bitmap index.
+func tipCommits(w *bitmapWalker, tips []plumbing.Hash) ([]plumbing.Hash, error) {
+	var commits []plumbing.Hash
+	for _, h := range tips {
+		for {
+			pos, ok := w.idx.Position(h)
+			if !ok {
+				return nil, errNotInBitmap
+			}
+
+			o, err := w.s.EncodedObject(plumbing.AnyObject, h)
+			if err != nil {
+				return nil, err
+			}
+
+			if o.Type() != plumbing.TagObject {
+				if o.Type() == plumbing.CommitObject {
+					commits = append(commits, h)
+				}
+
+				break
+			}
+
+			tag, err := object.DecodeTag(w.s, o)
+			if err != nil {
+				return nil, err
+			}
+
+			w.walked(pos, plumbing.TagObject, "")
+			h = tag.Target
+		}
+	}
+
+	return commits, nil
+}
+
+// commitsTopoOrder returns the commits reachable from commits, each one
+// after its parents.
+func commitsTopoOrder(s storer.EncodedObjectStorer, commits []plumbing.Hash) ([]plumbing.Hash, error) {
+	type item struct {
+		hash    plumbing.Hash
+		parents bool
+	}
+
+	var order []plumbing.Hash
+	visited := make(map[plumbing.Hash]bool)
+	pending := make([]item, 0, len(commits))
+	for i := len(commits) - 1; i >= 0; i-- {
+		pending = append(pending, item{hash: commits[i]})
+	}
+
+	for len(pending) > 0 {
+		it := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if it.parents {
+			order = append(order, it.hash)
+			continue
+		}
+
+		if visited[it.hash] {
+			continue
+		}
+
+		visited[it.hash] = true
+		commit, err := object.GetCommit(s, it.hash)
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, item{hash: it.hash, parents: true})
+		for _, p := range commit.ParentHashes {
+			if !visited[p] {
+				pending = append(pending, item{hash: p})
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// reachableWithBitmap returns the bitmap of the objects reachable from objs
+// but not from ignore, using the reachability bitmap of s. It fails if s
+// doesn't have one covering all the objects.
+func reachableWithBitmap(
+	s storer.EncodedObjectStorer,
+	objs,
+	ignore []plumbing.Hash,
+) (*bitmap.Index, *bitmap.Bitmap, error) {
+	bs, ok := s.(storer.BitmapStorer)
+	if !ok {
+		return nil, nil, errNoBitmap
+	}
+
+	idx, err := bs.Bitmap()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if idx == nil {
+		return nil, nil, errNoBitmap
+	}
+
+	w := &bitmapWalker{s: s, idx: idx}
+	wants := &bitmap.Bitmap{}
+	for _, h := range objs {
+		if err := w.add(wants, h); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	haves := &bitmap.Bitmap{}
+	for _, h := range ignore {
+		err := w.add(haves, h)
+		if errors.Is(err, errNotInBitmap) {
+			// The objects to ignore may be missing.
+			if _, err := s.EncodedObject(plumbing.AnyObject, h); errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+		}
+
+		if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, nil, err
+		}
+	}
+
+	wants.AndNot(haves)
+	return idx, wants, nil
+}
+
+// CountObjects returns the number of objects reachable from objs but not
+// from ignore, the ones returned by Objects. The reachability bitmap of s is
+// used if possible, without listing them.
+func CountObjects(
+	s storer.EncodedObjectStorer,
+	objs,
+	ignore []plumbing.Hash,
+) (int, error) {
+	if _, b, err := reachableWithBitmap(s, objs, ignore); err == nil {
+		return b.Count(), nil
+	}
+
+	hashes, err := ObjectsWithStorageForIgnores(s, s, objs, ignore)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(hashes), nil
+}
@@ -0,0 +1,81 @@
+package revlist
+
+import (
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitmapObjects(t *testing.T) {
+	t.Parallel()
+
+	sto := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	packs, err := sto.ObjectPacks()
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+
+	idx, err := sto.ObjectPackIndex(packs[0])
+	require.NoError(t, err)
+
+	tips := []plumbing.Hash{
+		plumbing.NewHash(someCommitBranch),
+		plumbing.NewHash(someCommitOtherBranch),
+	}
+
+	b, err := BuildBitmap(sto, packs[0], idx, tips)
+	require.NoError(t, err)
+	require.Equal(t, tips, b.Commits())
+	require.Equal(t, 9, b.TypeBitmap(plumbing.CommitObject).Count())
+	require.Equal(t, 12, b.TypeBitmap(plumbing.TreeObject).Count())
+	require.Equal(t, 10, b.TypeBitmap(plumbing.BlobObject).Count())
+
+	walked := func(objs, ignore []plumbing.Hash) []plumbing.Hash {
+		hashes, err := ObjectsWithStorageForIgnores(sto, sto, objs, ignore)
+		require.NoError(t, err)
+		return hashes
+	}
+
+	cases := []struct {
+		objs, ignore []string
+	}{
+		{[]string{someCommitOtherBranch}, nil},
+		{[]string{someCommitOtherBranch}, []string{someCommit}},
+		{[]string{someCommitOtherBranch, someCommitBranch}, []string{initialCommit}},
+		{[]string{secondCommit}, []string{"0000000000000000000000000000000000000001"}},
+		{[]string{"a8d315b2b1c615d43042c3a62402b8a54288cf5c"}, []string{initialCommit}},
+	}
+
+	// Without the bitmap written, the objects are walked.
+	_, _, err = reachableWithBitmap(sto, tips, nil)
+	require.ErrorIs(t, err, errNoBitmap)
+
+	require.NoError(t, sto.SetBitmap(b))
+	for _, c := range cases {
+		objs, ignore := toHashes(c.objs), toHashes(c.ignore)
+		expected := walked(objs, ignore)
+
+		_, _, err := reachableWithBitmap(sto, objs, ignore)
+		require.NoError(t, err)
+
+		got, err := Objects(sto, objs, ignore)
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, got)
+
+		n, err := CountObjects(sto, objs, ignore)
+		require.NoError(t, err)
+		require.Equal(t, len(expected), n)
+	}
+}
+
+func toHashes(l []string) []plumbing.Hash {
+	var hs []plumbing.Hash
+	for _, h := range l {
+		hs = append(hs, plumbing.NewHash(h))
+	}
+
+	return hs
+}
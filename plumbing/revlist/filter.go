@@ -0,0 +1,396 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// ErrInvalidFilter is returned by ParseFilter when the filter spec is not
+// valid or not supported.
+var ErrInvalidFilter = errors.New("invalid filter spec")
+
+// Filter omits objects from the result of ObjectsWithFilter, like the
+// --filter option of git-rev-list. Use ParseFilter to create one.
+type Filter interface {
+	// include reports whether the object is included in the result.
+	include(o *filterObject) (bool, error)
+	// walkTree reports whether the entries of the trees at the given
+	// depth from the root tree must be walked.
+	walkTree(depth int) bool
+}
+
+// filterObject is an object being walked by ObjectsWithFilter.
+type filterObject struct {
+	s    storer.EncodedObjectStorer
+	hash plumbing.Hash
+	typ  plumbing.ObjectType
+	// depth is the depth from the root tree of trees and blobs.
+	depth int
+}
+
+func (o *filterObject) size() (int64, error) {
+	return o.s.EncodedObjectSize(o.hash)
+}
+
+// ParseFilter parses a filter spec, as sent by git clients in the filter
+// line of an upload-request. The supported specs are:
+//   - blob:none, omitting all the blobs.
+//   - blob:limit=<n>[kmg], omitting the blobs of at least n bytes.
+//   - tree:<depth>, omitting the trees and blobs whose depth from the root
+//     tree is at least depth.
+//   - object:type=<type>, omitting the objects not of the given type.
+//   - combine:<filter>+<filter>..., omitting the objects omitted by any of
+//     the URL encoded filters.
+func ParseFilter(spec string) (Filter, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "blob":
+		if arg == "none" {
+			return blobNoneFilter{}, nil
+		}
+
+		if v, ok := strings.CutPrefix(arg, "limit="); ok {
+			limit, err := parseBlobLimit(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %w", ErrInvalidFilter, spec, err)
+			}
+
+			return blobLimitFilter{limit: limit}, nil
+		}
+	case "tree":
+		depth, err := strconv.ParseUint(arg, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidFilter, spec, err)
+		}
+
+		return treeDepthFilter{depth: int(depth)}, nil
+	case "object":
+		if v, ok := strings.CutPrefix(arg, "type="); ok {
+			switch t, _ := plumbing.ParseObjectType(v); t {
+			case plumbing.CommitObject, plumbing.TreeObject, plumbing.BlobObject, plumbing.TagObject:
+				return objectTypeFilter{typ: t}, nil
+			}
+		}
+	case "combine":
+		var filters combineFilter
+		for _, part := range strings.Split(arg, "+") {
+			sub, err := url.QueryUnescape(part)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %w", ErrInvalidFilter, spec, err)
+			}
+
+			f, err := ParseFilter(sub)
+			if err != nil {
+				return nil, err
+			}
+
+			filters = append(filters, f)
+		}
+
+		return filters, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrInvalidFilter, spec)
+}
+
+// parseBlobLimit parses a size with an optional k, m or g unit suffix.
+func parseBlobLimit(v string) (int64, error) {
+	var shift uint
+	if len(v) > 0 {
+		switch v[len(v)-1] {
+		case 'k', 'K':
+			shift = 10
+		case 'm', 'M':
+			shift = 20
+		case 'g', 'G':
+			shift = 30
+		}
+	}
+
+	if shift > 0 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.ParseUint(v, 10, 63)
+	if err != nil {
+		return 0, err
+	}
+
+	if n > math.MaxInt64>>shift {
+		return 0, strconv.ErrRange
+	}
+
+	return int64(n) << shift, nil
+}
+
+type blobNoneFilter struct{}
+
+func (blobNoneFilter) include(o *filterObject) (bool, error) {
+	return o.typ != plumbing.BlobObject, nil
+}
+
+func (blobNoneFilter) walkTree(int) bool { return true }
+
+type blobLimitFilter struct {
+	limit int64
+}
+
+func (f blobLimitFilter) include(o *filterObject) (bool, error) {
+	if o.typ != plumbing.BlobObject {
+		return true, nil
+	}
+
+	size, err := o.size()
+	if err != nil {
+		return false, err
+	}
+
+	return size < f.limit, nil
+}
+
+func (blobLimitFilter) walkTree(int) bool { return true }
+
+type treeDepthFilter struct {
+	depth int
+}
+
+func (f treeDepthFilter) include(o *filterObject) (bool, error) {
+	switch o.typ {
+	case plumbing.TreeObject, plumbing.BlobObject:
+		return o.depth < f.depth, nil
+	default:
+		return true, nil
+	}
+}
+
+func (f treeDepthFilter) walkTree(depth int) bool {
+	return depth+1 < f.depth
+}
+
+type objectTypeFilter struct {
+	typ plumbing.ObjectType
+}
+
+func (f objectTypeFilter) include(o *filterObject) (bool, error) {
+	return o.typ == f.typ, nil
+}
+
+func (f objectTypeFilter) walkTree(int) bool {
+	return f.typ == plumbing.TreeObject || f.typ == plumbing.BlobObject
+}
+
+type combineFilter []Filter
+
+func (f combineFilter) include(o *filterObject) (bool, error) {
+	for _, sub := range f {
+		ok, err := sub.include(o)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (f combineFilter) walkTree(depth int) bool {
+	for _, sub := range f {
+		if !sub.walkTree(depth) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ObjectsWithFilter is the same as Objects, but the objects omitted by the
+// filter are not returned. Like git, the given objects are returned even if
+// they are omitted by the filter, and only the objects reachable from them
+// are filtered. A nil filter omits no object.
+func ObjectsWithFilter(
+	s storer.EncodedObjectStorer,
+	objs,
+	ignore []plumbing.Hash,
+	filter Filter,
+) ([]plumbing.Hash, error) {
+	if filter == nil {
+		return Objects(s, objs, ignore)
+	}
+
+	ignore, err := objects(s, ignore, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &filterWalker{
+		s:       s,
+		filter:  filter,
+		ignore:  ignore,
+		seen:    hashListToSet(ignore),
+		visited: make(map[plumbing.Hash]bool),
+		depths:  make(map[plumbing.Hash]int),
+		result:  make(map[plumbing.Hash]bool),
+	}
+
+	for _, h := range objs {
+		if err := w.processObject(h, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return hashSetToList(w.result), nil
+}
+
+// filterWalker walks the objects reachable from the given ones, keeping the
+// ones included by the filter.
+type filterWalker struct {
+	s      storer.EncodedObjectStorer
+	filter Filter
+	ignore []plumbing.Hash
+	// seen holds the ignored objects and the walked commits and tags.
+	seen    map[plumbing.Hash]bool
+	visited map[plumbing.Hash]bool
+	// depths holds the lowest depth each tree and blob was walked at, as
+	// objects omitted deep in a tree can be included closer to the root.
+	depths map[plumbing.Hash]int
+	result map[plumbing.Hash]bool
+}
+
+func (w *filterWalker) processObject(h plumbing.Hash, explicit bool) error {
+	if w.seen[h] {
+		return nil
+	}
+
+	o, err := w.s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return fmt.Errorf("getting object: %w", err)
+	}
+
+	switch o.Type() {
+	case plumbing.CommitObject:
+		commit, err := object.DecodeCommit(w.s, o)
+		if err != nil {
+			return fmt.Errorf("decoding object: %w", err)
+		}
+
+		return reachableCommits(commit, w.seen, w.visited, w.ignore, w.addCommit, func(tree *object.Tree) error {
+			return w.walkTree(tree.Hash, 0)
+		})
+	case plumbing.TagObject:
+		tag, err := object.DecodeTag(w.s, o)
+		if err != nil {
+			return fmt.Errorf("decoding object: %w", err)
+		}
+
+		w.seen[h] = true
+		if explicit {
+			w.result[h] = true
+		} else if err := w.add(h, plumbing.TagObject, 0); err != nil {
+			return err
+		}
+
+		return w.processObject(tag.Target, false)
+	case plumbing.TreeObject:
+		if explicit {
+			w.result[h] = true
+		}
+
+		return w.walkTree(h, 0)
+	case plumbing.BlobObject:
+		if explicit {
+			w.result[h] = true
+		}
+
+		return w.walkBlob(h, 0)
+	default:
+		return fmt.Errorf("object type not valid: %s. "+
+			"Object reference: %s", o.Type(), o.Hash())
+	}
+}
+
+func (w *filterWalker) addCommit(h plumbing.Hash) {
+	w.seen[h] = true
+	// Commits are included regardless of their size, so this can't fail.
+	_ = w.add(h, plumbing.CommitObject, 0)
+}
+
+// add adds the object to the result if it's included by the filter.
+func (w *filterWalker) add(h plumbing.Hash, t plumbing.ObjectType, depth int) error {
+	include, err := w.filter.include(&filterObject{s: w.s, hash: h, typ: t, depth: depth})
+	if err != nil {
+		return err
+	}
+
+	if include {
+		w.result[h] = true
+	}
+
+	return nil
+}
+
+// walked reports whether the tree or blob was already walked at the given
+// depth or closer to the root, recording it otherwise.
+func (w *filterWalker) walked(h plumbing.Hash, depth int) bool {
+	if w.seen[h] {
+		return true
+	}
+
+	if d, ok := w.depths[h]; ok && d <= depth {
+		return true
+	}
+
+	w.depths[h] = depth
+	return false
+}
+
+func (w *filterWalker) walkTree(h plumbing.Hash, depth int) error {
+	if w.walked(h, depth) {
+		return nil
+	}
+
+	if err := w.add(h, plumbing.TreeObject, depth); err != nil {
+		return err
+	}
+
+	if !w.filter.walkTree(depth) {
+		return nil
+	}
+
+	tree, err := object.GetTree(w.s, h)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range tree.Entries {
+		switch {
+		case e.Mode == filemode.Submodule:
+			continue
+		case e.Mode == filemode.Dir:
+			err = w.walkTree(e.Hash, depth+1)
+		default:
+			err = w.walkBlob(e.Hash, depth+1)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *filterWalker) walkBlob(h plumbing.Hash, depth int) error {
+	if w.walked(h, depth) {
+		return nil
+	}
+
+	return w.add(h, plumbing.BlobObject, depth)
+}
@@ -0,0 +1,204 @@
+package revlist
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+)
+
+type FilterSuite struct {
+	suite.Suite
+	Storer *filesystem.Storage
+}
+
+func TestFilterSuite(t *testing.T) {
+	suite.Run(t, new(FilterSuite))
+}
+
+func (s *FilterSuite) SetupTest() {
+	s.Storer = filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+}
+
+func (s *FilterSuite) TestParseFilter() {
+	for _, spec := range []string{
+		"blob:none",
+		"blob:limit=0",
+		"blob:limit=10k",
+		"blob:limit=1M",
+		"tree:0",
+		"tree:3",
+		"object:type=commit",
+		"object:type=tag",
+		"combine:blob%3Anone+tree%3A1",
+	} {
+		_, err := ParseFilter(spec)
+		s.NoError(err, spec)
+	}
+
+	for _, spec := range []string{
+		"",
+		"blob",
+		"blob:some",
+		"blob:limit=",
+		"blob:limit=-1",
+		"blob:limit=10x",
+		"tree:",
+		"tree:-1",
+		"object:type=ofs-delta",
+		"sparse:oid=master:sparse",
+		"combine:blob%3Anone+tree%3Ax",
+	} {
+		_, err := ParseFilter(spec)
+		s.ErrorIs(err, ErrInvalidFilter, spec)
+	}
+}
+
+func (s *FilterSuite) TestBlobNone() {
+	s.testFilter("blob:none", func(t plumbing.ObjectType, _ int, _ int64) bool {
+		return t != plumbing.BlobObject
+	})
+}
+
+func (s *FilterSuite) TestBlobLimit() {
+	s.testFilter("blob:limit=1k", func(t plumbing.ObjectType, _ int, size int64) bool {
+		return t != plumbing.BlobObject || size < 1024
+	})
+}
+
+func (s *FilterSuite) TestTreeDepth() {
+	s.testFilter("tree:0", func(t plumbing.ObjectType, _ int, _ int64) bool {
+		return t == plumbing.CommitObject
+	})
+
+	s.testFilter("tree:2", func(t plumbing.ObjectType, depth int, _ int64) bool {
+		return t == plumbing.CommitObject || depth < 2
+	})
+}
+
+func (s *FilterSuite) TestObjectType() {
+	for _, typ := range []plumbing.ObjectType{
+		plumbing.CommitObject,
+		plumbing.TreeObject,
+		plumbing.BlobObject,
+	} {
+		s.testFilter("object:type="+typ.String(), func(t plumbing.ObjectType, _ int, _ int64) bool {
+			return t == typ
+		})
+	}
+}
+
+func (s *FilterSuite) TestCombine() {
+	s.testFilter("combine:blob%3Anone+tree%3A2", func(t plumbing.ObjectType, depth int, _ int64) bool {
+		return t == plumbing.CommitObject || t == plumbing.TreeObject && depth < 2
+	})
+}
+
+func (s *FilterSuite) TestIgnore() {
+	filter, err := ParseFilter("blob:none")
+	s.Require().NoError(err)
+
+	objs, err := ObjectsWithFilter(s.Storer,
+		[]plumbing.Hash{plumbing.NewHash(secondCommit)},
+		[]plumbing.Hash{plumbing.NewHash(initialCommit)},
+		filter,
+	)
+	s.Require().NoError(err)
+
+	s.ElementsMatch([]plumbing.Hash{
+		plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"), // second commit
+		plumbing.NewHash("c2d30fa8ef288618f65f6eed6e168e0d514886f4"), // init tree
+	}, objs)
+}
+
+func (s *FilterSuite) TestExplicitObjects() {
+	filter, err := ParseFilter("blob:none")
+	s.Require().NoError(err)
+
+	blob := plumbing.NewHash("d3ff53e0564a9f87d8e84b6e28e5060e517008aa")
+	objs, err := ObjectsWithFilter(s.Storer, []plumbing.Hash{blob}, nil, filter)
+	s.Require().NoError(err)
+	s.Equal([]plumbing.Hash{blob}, objs)
+
+	filter, err = ParseFilter("tree:0")
+	s.Require().NoError(err)
+
+	tree := plumbing.NewHash("c2d30fa8ef288618f65f6eed6e168e0d514886f4")
+	objs, err = ObjectsWithFilter(s.Storer, []plumbing.Hash{tree}, nil, filter)
+	s.Require().NoError(err)
+	s.Equal([]plumbing.Hash{tree}, objs)
+}
+
+// testFilter checks that the objects returned by ObjectsWithFilter from HEAD
+// are the ones reachable from it for which include returns true. depth is
+// the lowest depth of trees and blobs from the root trees.
+func (s *FilterSuite) testFilter(
+	spec string,
+	include func(t plumbing.ObjectType, depth int, size int64) bool,
+) {
+	filter, err := ParseFilter(spec)
+	s.Require().NoError(err)
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	objs, err := ObjectsWithFilter(s.Storer, []plumbing.Hash{head}, nil, filter)
+	s.Require().NoError(err)
+
+	depths := make(map[plumbing.Hash]int)
+	var walk func(t *object.Tree, depth int)
+	walk = func(t *object.Tree, depth int) {
+		if d, ok := depths[t.Hash]; ok && d <= depth {
+			return
+		}
+		depths[t.Hash] = depth
+
+		for _, e := range t.Entries {
+			switch e.Mode {
+			case filemode.Submodule:
+			case filemode.Dir:
+				sub, err := object.GetTree(s.Storer, e.Hash)
+				s.Require().NoError(err)
+				walk(sub, depth+1)
+			default:
+				if d, ok := depths[e.Hash]; !ok || depth+1 < d {
+					depths[e.Hash] = depth + 1
+				}
+			}
+		}
+	}
+
+	var expected []plumbing.Hash
+	commit, err := object.GetCommit(s.Storer, head)
+	s.Require().NoError(err)
+
+	err = object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		tree, err := c.Tree()
+		if err != nil {
+			return err
+		}
+
+		walk(tree, 0)
+		if include(plumbing.CommitObject, 0, 0) {
+			expected = append(expected, c.Hash)
+		}
+
+		return nil
+	})
+	s.Require().NoError(err)
+
+	for h, depth := range depths {
+		o, err := s.Storer.EncodedObject(plumbing.AnyObject, h)
+		s.Require().NoError(err)
+
+		if include(o.Type(), depth, o.Size()) {
+			expected = append(expected, h)
+		}
+	}
+
+	s.ElementsMatch(expected, objs, spec)
+}
@@ -16,12 +16,22 @@ import (
 // Objects applies a complementary set. It gets all the hashes from all
 // the reachable objects from the given objects. Ignore param are object hashes
 // that we want to ignore on the result. All that objects must be accessible
-// from the object storer.
+// from the object storer. If the object storer has a reachability bitmap
+// covering them, it's used instead of walking the objects.
 func Objects(
 	s storer.EncodedObjectStorer,
 	objs,
 	ignore []plumbing.Hash,
 ) ([]plumbing.Hash, error) {
+	if idx, b, err := reachableWithBitmap(s, objs, ignore); err == nil {
+		var hashes []plumbing.Hash
+		b.ForEach(func(pos int) {
+			hashes = append(hashes, idx.Hash(pos))
+		})
+
+		return hashes, nil
+	}
+
 	return ObjectsWithStorageForIgnores(s, s, objs, ignore)
 }
 
@@ -124,6 +134,22 @@ func reachableObjects(
 	visited map[plumbing.Hash]bool,
 	ignore []plumbing.Hash,
 	cb func(h plumbing.Hash),
+) error {
+	return reachableCommits(commit, seen, visited, ignore, cb, func(tree *object.Tree) error {
+		return iterateCommitTrees(seen, tree, cb)
+	})
+}
+
+// reachableCommits returns, using the callback function, all the reachable
+// commits from the specified commit, calling walkTree with the tree of each
+// one of them.
+func reachableCommits(
+	commit *object.Commit,
+	seen map[plumbing.Hash]bool,
+	visited map[plumbing.Hash]bool,
+	ignore []plumbing.Hash,
+	cb func(h plumbing.Hash),
+	walkTree func(tree *object.Tree) error,
 ) error {
 	i := object.NewCommitPreorderIter(commit, seen, ignore)
 	pending := make(map[plumbing.Hash]bool)
@@ -159,7 +185,7 @@ func reachableObjects(
 			return err
 		}
 
-		if err := iterateCommitTrees(seen, tree, cb); err != nil {
+		if err := walkTree(tree); err != nil {
 			return err
 		}
 	}
@@ -6,6 +6,11 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bitmap"
+	"github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 )
 
 var (
@@ -91,6 +96,119 @@ type PackedObjectStorer interface {
 	DeleteOldObjectPackAndIndex(plumbing.Hash, time.Time) error
 }
 
+// PromisorPackStorer is an optional method for PackedObjectStorer, it
+// records the packfiles received from promisor remotes, i.e. the remotes a
+// partial clone fetches its missing objects from.
+type PromisorPackStorer interface {
+	// SetPromisorPack marks the given packfile as received from a promisor
+	// remote.
+	SetPromisorPack(plumbing.Hash) error
+	// IsPromisorPack returns true if the given packfile was received from a
+	// promisor remote.
+	IsPromisorPack(plumbing.Hash) (bool, error)
+}
+
+// KeptPackStorer is an optional method for PackedObjectStorer, it records
+// the packfiles which must be kept as they are by the repacks, like git does
+// with .keep files.
+type KeptPackStorer interface {
+	// SetKeptPack marks the given packfile as kept, or unmarks it if keep is
+	// false.
+	SetKeptPack(h plumbing.Hash, keep bool) error
+	// IsKeptPack returns true if the given packfile is kept.
+	IsKeptPack(plumbing.Hash) (bool, error)
+}
+
+// MultiPackIndexStorer is an optional method for PackedObjectStorer, it
+// maintains a multi-pack-index, looking up the objects of all the packfiles
+// at once.
+type MultiPackIndexStorer interface {
+	// HasMultiPackIndex returns true if there is a multi-pack-index.
+	HasMultiPackIndex() (bool, error)
+	// WriteMultiPackIndex writes the multi-pack-index of all the packfiles.
+	WriteMultiPackIndex() error
+}
+
+// BitmapStorer is an optional method for PackedObjectStorer, it stores the
+// reachability bitmaps of the packfiles, used to find the objects reachable
+// from commits without walking them.
+type BitmapStorer interface {
+	// Bitmap returns the reachability bitmap of one of the packfiles, or nil
+	// if none has one.
+	Bitmap() (*bitmap.Index, error)
+	// ObjectPackIndex returns the index of the given packfile.
+	ObjectPackIndex(plumbing.Hash) (idxfile.Index, error)
+	// SetBitmap writes the reachability bitmap of its packfile.
+	SetBitmap(*bitmap.Index) error
+}
+
+// CommitGraphStorer is an optional method for EncodedObjectStorer, it stores
+// the commit-graph, used to walk the commits without decoding them.
+type CommitGraphStorer interface {
+	// CommitGraph returns the commit-graph, or nil if there is none. It must
+	// be closed after use.
+	CommitGraph() (commitgraph.Index, error)
+	// SetCommitGraph replaces the commit-graph with the given one.
+	SetCommitGraph(commitgraph.Index) error
+}
+
+// CommitGraphChainStorer is an optional method for EncodedObjectStorer, it
+// stores the commit-graph as a chain of layers, so the new commits are
+// written without rewriting the whole commit-graph.
+type CommitGraphChainStorer interface {
+	CommitGraphStorer
+	// CommitGraphChain returns the layers of the commit-graph chain, from
+	// the oldest, or nil if there is none. Each layer has the previous one
+	// as parent, so closing the last one closes them all.
+	CommitGraphChain() ([]commitgraph.Index, error)
+	// AddCommitGraphLayer replaces the layers of the commit-graph chain
+	// following the first keep ones with a new layer, made of the commits
+	// of the given commit-graph which follow the kept layers.
+	AddCommitGraphLayer(keep int, idx commitgraph.Index) error
+}
+
+// ObjectVerifier is an optional method for EncodedObjectStorer, it checks
+// the integrity of the objects as they are stored.
+type ObjectVerifier interface {
+	// VerifyLooseObject checks that the given loose object can be inflated
+	// and that its content matches its hash.
+	VerifyLooseObject(plumbing.Hash) error
+	// VerifyObjectPack checks the checksums of the given packfile and of its
+	// index, and that every object of the packfile matches the index.
+	VerifyObjectPack(plumbing.Hash) error
+}
+
+// ObjectPrefetcher is an optional method for EncodedObjectStorer, it enables
+// retrieving in a single batch the objects missing from a partial clone.
+type ObjectPrefetcher interface {
+	// PrefetchObjects makes sure the given objects are available, retrieving
+	// the missing ones at once.
+	PrefetchObjects([]plumbing.Hash) error
+}
+
+// ObjectFormatStorer is an optional method for EncodedObjectStorer, it
+// reports the object format of the stored objects, which the objects
+// returned by NewEncodedObject use. The storers not implementing it store
+// SHA-1 objects.
+type ObjectFormatStorer interface {
+	// ObjectFormat returns the object format of the stored objects.
+	ObjectFormat() format.ObjectFormat
+}
+
+// CompatObjectStorer is an optional method for EncodedObjectStorer, it
+// stores the mapping between the IDs of the objects and their IDs in the
+// compat object format, set by extensions.compatObjectFormat.
+type CompatObjectStorer interface {
+	// CompatObjectID returns the compat object ID of the given object,
+	// plumbing.ErrObjectNotFound if it isn't mapped.
+	CompatObjectID(plumbing.Hash) (plumbing.Hash, error)
+	// ObjectIDFromCompat returns the ID of the object whose compat object
+	// ID is the given one, plumbing.ErrObjectNotFound if it isn't mapped.
+	ObjectIDFromCompat(plumbing.Hash) (plumbing.Hash, error)
+	// SetCompatObjectIDs stores the mappings of m.
+	SetCompatObjectIDs(m *compatmap.Map) error
+}
+
 // PackfileWriter is an optional method for ObjectStorer, it enables directly writing
 // a packfile to storage.
 type PackfileWriter interface {
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
 )
 
 const MaxResolveRecursion = 1024
@@ -28,6 +29,18 @@ type ReferenceStorer interface {
 	PackRefs() error
 }
 
+// ReflogStorer is an optional method for ReferenceStorer, it stores the
+// reflogs, the successive values of the references.
+type ReflogStorer interface {
+	// Reflogs returns the names of the references having a reflog.
+	Reflogs() ([]plumbing.ReferenceName, error)
+	// Reflog returns the entries of the reflog of the given reference,
+	// oldest first.
+	Reflog(plumbing.ReferenceName) ([]*reflog.Entry, error)
+	// SetReflog replaces the entries of the reflog of the given reference.
+	SetReflog(plumbing.ReferenceName, []*reflog.Entry) error
+}
+
 // ReferenceIter is a generic closable interface for iterating over references.
 type ReferenceIter interface {
 	Next() (*plumbing.Reference, error)
@@ -0,0 +1,355 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/internal/repository"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/archive"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+const (
+	uploadArchiveSection     = "uploadarchive"
+	allowUnreachableKey      = "allowUnreachable"
+	archiveArgumentPrefix    = "argument "
+	archiveMaxArguments      = 64
+	archiveFormatArgPrefix   = "--format="
+	archivePrefixArgPrefix   = "--prefix="
+	archiveAckLine           = "ACK"
+	archiveNackLinePrefix    = "NACK "
+	archiveUnreachableReason = "not a valid ref"
+)
+
+// ErrArchiveRejected is returned when the server refuses to create the
+// requested archive.
+var ErrArchiveRejected = errors.New("archive rejected")
+
+// ArchiveRequest holds the arguments of a git-upload-archive request.
+type ArchiveRequest struct {
+	// Treeish is the tree, commit or tag to archive. It can be a reference
+	// name, or an object id when the server allows unreachable objects,
+	// optionally followed by a colon and a path, e.g. "main:docs".
+	Treeish string
+	// Format is the archive format, the server defaults to tar when empty.
+	Format archive.Format
+	// Prefix is prepended to every path in the archive.
+	Prefix string
+	// Paths restricts the archive to the given paths.
+	Paths []string
+	// CompressionLevel is the compression level used by the server, see
+	// [archive.Options].
+	CompressionLevel int
+	// Progress is where the progress messages sent by the server are
+	// written, if any.
+	Progress sideband.Progress
+}
+
+// Archiver is implemented by sessions supporting the git-upload-archive
+// service.
+type Archiver interface {
+	// Archive requests an archive from the remote repository. The returned
+	// reader streams the archive and must be closed by the caller.
+	Archive(ctx context.Context, req *ArchiveRequest) (io.ReadCloser, error)
+}
+
+// UploadArchiveOptions is a set of options for the UploadArchive service.
+type UploadArchiveOptions struct {
+	// AllowUnreachable allows clients to request archives of any object by
+	// its id, not only of references. It's also enabled by the
+	// uploadarchive.allowUnreachable config option.
+	AllowUnreachable bool
+}
+
+// UploadArchive is a server command that serves the upload-archive service.
+func UploadArchive(
+	ctx context.Context,
+	st storage.Storer,
+	r io.ReadCloser,
+	w io.WriteCloser,
+	opts *UploadArchiveOptions,
+) error {
+	if w == nil {
+		return fmt.Errorf("nil writer")
+	}
+
+	if r == nil {
+		return fmt.Errorf("nil reader")
+	}
+
+	if opts == nil {
+		opts = &UploadArchiveOptions{}
+	}
+
+	r = ioutil.NewContextReadCloser(ctx, r)
+	w = ioutil.NewContextWriteCloser(ctx, w)
+
+	args, err := readArchiveArguments(r)
+	if err != nil {
+		return fmt.Errorf("reading arguments: %w", err)
+	}
+
+	cfg, err := st.Config()
+	if err != nil {
+		return err
+	}
+
+	allowUnreachable := opts.AllowUnreachable ||
+		cfg.Raw.Section(uploadArchiveSection).Options.Get(allowUnreachableKey) == "true"
+
+	tree, aopts, err := parseArchiveArguments(st, args, allowUnreachable)
+	if err != nil {
+		if _, werr := pktline.Writef(w, "%s%s\n", archiveNackLinePrefix, err); werr != nil {
+			return werr
+		}
+
+		return err
+	}
+
+	if _, err := pktline.Writef(w, "%s\n", archiveAckLine); err != nil {
+		return err
+	}
+
+	if err := pktline.WriteFlush(w); err != nil {
+		return err
+	}
+
+	mux := sideband.NewMuxer(sideband.Sideband64k, w)
+	// Buffer the archive writes, so they are sent in packets as large as
+	// possible, leaving room for the band byte.
+	bw := bufio.NewWriterSize(mux, pktline.MaxPayloadSize-1)
+	if err := archive.NewEncoder(bw, st).Encode(tree, aopts); err != nil {
+		_, _ = mux.WriteChannel(sideband.ErrorMessage, []byte(err.Error()))
+		return fmt.Errorf("encoding archive: %w", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	if err := pktline.WriteFlush(w); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func readArchiveArguments(r io.Reader) ([]string, error) {
+	var args []string
+	for {
+		l, line, err := pktline.ReadLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == pktline.Flush {
+			return args, nil
+		}
+
+		if len(args) >= archiveMaxArguments {
+			return nil, fmt.Errorf("%w: too many arguments", ErrInvalidRequest)
+		}
+
+		arg, ok := bytes.CutPrefix(bytes.TrimSuffix(line, []byte("\n")), []byte(archiveArgumentPrefix))
+		if !ok {
+			return nil, fmt.Errorf("%w: expected argument, got %q", ErrInvalidRequest, line)
+		}
+
+		args = append(args, string(arg))
+	}
+}
+
+// parseArchiveArguments parses the arguments sent by the client, which are
+// a subset of the ones accepted by git-archive, and resolves the tree to
+// archive.
+func parseArchiveArguments(
+	st storage.Storer,
+	args []string,
+	allowUnreachable bool,
+) (*object.Tree, *archive.Options, error) {
+	opts := &archive.Options{}
+	var treeish string
+	for i, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, archiveFormatArgPrefix):
+			format, err := archive.ParseFormat(arg[len(archiveFormatArgPrefix):])
+			if err != nil {
+				return nil, nil, err
+			}
+			opts.Format = format
+		case strings.HasPrefix(arg, archivePrefixArgPrefix):
+			opts.Prefix = arg[len(archivePrefixArgPrefix):]
+		case len(arg) == 2 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9':
+			opts.CompressionLevel = int(arg[1] - '0')
+			if opts.CompressionLevel == 0 {
+				opts.CompressionLevel = archive.NoCompression
+			}
+		case strings.HasPrefix(arg, "-"):
+			return nil, nil, fmt.Errorf("unknown option: %s", arg)
+		default:
+			treeish = arg
+			opts.Paths = args[i+1:]
+		}
+
+		if treeish != "" {
+			break
+		}
+	}
+
+	if treeish == "" {
+		return nil, nil, fmt.Errorf("%w: missing tree-ish", ErrInvalidRequest)
+	}
+
+	tree, commit, err := resolveArchiveTree(st, treeish, allowUnreachable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if commit != nil {
+		opts.CommitID = commit.Hash
+		opts.ModTime = commit.Committer.When
+	}
+
+	return tree, opts, nil
+}
+
+// resolveArchiveTree resolves a "<rev>[:<path>]" tree-ish. Unless
+// allowUnreachable is set, rev must be a reference, like upstream does.
+func resolveArchiveTree(
+	st storage.Storer,
+	treeish string,
+	allowUnreachable bool,
+) (*object.Tree, *object.Commit, error) {
+	rev, path, _ := strings.Cut(treeish, ":")
+
+	var h plumbing.Hash
+	if ref, err := repository.ExpandRef(st, plumbing.ReferenceName(rev)); err == nil {
+		h = ref.Hash()
+	} else if allowUnreachable && plumbing.IsHash(rev) {
+		h = plumbing.NewHash(rev)
+	} else {
+		return nil, nil, fmt.Errorf("%s: %s", archiveUnreachableReason, rev)
+	}
+
+	obj, err := object.GetObject(st, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var commit *object.Commit
+	var tree *object.Tree
+	for tree == nil {
+		switch o := obj.(type) {
+		case *object.Tag:
+			obj, err = o.Object()
+			if err != nil {
+				return nil, nil, err
+			}
+		case *object.Commit:
+			commit = o
+			tree, err = o.Tree()
+			if err != nil {
+				return nil, nil, err
+			}
+		case *object.Tree:
+			tree = o
+		default:
+			return nil, nil, fmt.Errorf("not a tree object: %s", rev)
+		}
+	}
+
+	if path != "" {
+		tree, err = tree.Tree(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("not a valid object name: %s: %w", treeish, err)
+		}
+	}
+
+	return tree, commit, nil
+}
+
+// RequestArchive is a client command that sends an upload-archive request
+// to w and returns a reader streaming the archive received from r.
+func RequestArchive(
+	ctx context.Context,
+	r io.ReadCloser,
+	w io.WriteCloser,
+	req *ArchiveRequest,
+) (io.ReadCloser, error) {
+	if req == nil || req.Treeish == "" {
+		return nil, fmt.Errorf("%w: missing tree-ish", ErrInvalidRequest)
+	}
+
+	w = ioutil.NewContextWriteCloser(ctx, w)
+	args := make([]string, 0, len(req.Paths)+4)
+	if req.Format != "" {
+		args = append(args, archiveFormatArgPrefix+string(req.Format))
+	}
+	if req.Prefix != "" {
+		args = append(args, archivePrefixArgPrefix+req.Prefix)
+	}
+	switch level := req.CompressionLevel; {
+	case level == archive.NoCompression:
+		args = append(args, "-0")
+	case level > 0 && level <= 9:
+		args = append(args, "-"+strconv.Itoa(level))
+	}
+	args = append(args, req.Treeish)
+	args = append(args, req.Paths...)
+
+	for _, arg := range args {
+		if _, err := pktline.Writef(w, "%s%s\n", archiveArgumentPrefix, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pktline.WriteFlush(w); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	rd := bufio.NewReader(ioutil.NewContextReadCloser(ctx, r))
+	_, line, err := pktline.ReadLine(rd)
+	if err != nil {
+		var errLine *pktline.ErrorLine
+		if errors.As(err, &errLine) {
+			return nil, NewRemoteError(errLine.Text)
+		}
+
+		return nil, fmt.Errorf("reading archive response: %w", err)
+	}
+
+	text := string(bytes.TrimSuffix(line, []byte("\n")))
+	switch {
+	case text == archiveAckLine:
+	case strings.HasPrefix(text, archiveNackLinePrefix):
+		return nil, fmt.Errorf("%w: %s", ErrArchiveRejected, text[len(archiveNackLinePrefix):])
+	default:
+		return nil, fmt.Errorf("%w: expected ACK/NACK, got %q", ErrInvalidResponse, text)
+	}
+
+	if l, _, err := pktline.ReadLine(rd); err != nil {
+		return nil, err
+	} else if l != pktline.Flush {
+		return nil, fmt.Errorf("%w: expected flush after ACK", ErrInvalidResponse)
+	}
+
+	demux := sideband.NewDemuxer(sideband.Sideband64k, rd)
+	demux.Progress = req.Progress
+
+	return ioutil.NewReadCloser(demux, r), nil
+}
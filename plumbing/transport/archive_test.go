@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/archive"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newArchiveStorage(t *testing.T) storage.Storer {
+	t.Helper()
+	return filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+}
+
+// requestArchive runs UploadArchive and RequestArchive connected through
+// pipes and returns the archive contents.
+func requestArchive(
+	t *testing.T,
+	st storage.Storer,
+	opts *UploadArchiveOptions,
+	req *ArchiveRequest,
+) ([]byte, error) {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := UploadArchive(context.TODO(), st, serverR, serverW, opts)
+		serverW.CloseWithError(err)
+		done <- err
+	}()
+
+	rc, err := RequestArchive(context.TODO(), clientR, clientW, req)
+	if err != nil {
+		clientW.Close()
+		clientR.Close()
+		<-done
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+
+	return data, nil
+}
+
+func TestUploadArchiveTar(t *testing.T) {
+	data, err := requestArchive(t, newArchiveStorage(t), nil, &ArchiveRequest{
+		Treeish: "master",
+		Prefix:  "repo/",
+		Paths:   []string{"go"},
+	})
+	require.NoError(t, err)
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			assert.Equal(t, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", hdr.PAXRecords["comment"])
+			continue
+		}
+		names = append(names, hdr.Name)
+	}
+
+	assert.Equal(t, []string{"repo/", "repo/go/", "repo/go/example.go"}, names)
+}
+
+func TestUploadArchiveZipSubtree(t *testing.T) {
+	data, err := requestArchive(t, newArchiveStorage(t), nil, &ArchiveRequest{
+		Treeish:          "refs/heads/master:json",
+		Format:           archive.Zip,
+		CompressionLevel: archive.NoCompression,
+	})
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		assert.Equal(t, zip.Store, f.Method)
+	}
+	assert.ElementsMatch(t, []string{"long.json", "short.json"}, names)
+}
+
+func TestUploadArchiveUnreachable(t *testing.T) {
+	req := &ArchiveRequest{Treeish: "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"}
+
+	st := newArchiveStorage(t)
+	_, err := requestArchive(t, st, nil, req)
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+	assert.ErrorContains(t, err, "not a valid ref")
+
+	_, err = requestArchive(t, st, &UploadArchiveOptions{AllowUnreachable: true}, req)
+	assert.NoError(t, err)
+
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("uploadarchive").SetOption("allowUnreachable", "true")
+	require.NoError(t, st.SetConfig(cfg))
+
+	_, err = requestArchive(t, st, nil, req)
+	assert.NoError(t, err)
+}
+
+func TestUploadArchiveInvalidArguments(t *testing.T) {
+	st := newArchiveStorage(t)
+
+	_, err := requestArchive(t, st, nil, &ArchiveRequest{Treeish: "master", Format: "rar"})
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+	assert.ErrorContains(t, err, "unsupported archive format")
+
+	_, err = requestArchive(t, st, nil, &ArchiveRequest{Treeish: "master:missing"})
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+
+	_, err = requestArchive(t, st, nil, &ArchiveRequest{})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
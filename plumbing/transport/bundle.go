@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// NewBundleSession creates a new session that fetches from a bundle. The
+// bundle is opened on each handshake using open.
+func NewBundleSession(st storage.Storer, open func() (io.ReadCloser, error)) Session {
+	return &bundleSession{st: st, open: open}
+}
+
+type bundleSession struct {
+	st   storage.Storer
+	open func() (io.ReadCloser, error)
+}
+
+var _ Session = &bundleSession{}
+
+// Handshake implements Session. Only the upload-pack service is supported,
+// as bundles are read-only.
+func (s *bundleSession) Handshake(ctx context.Context, service Service, _ ...string) (Connection, error) {
+	if service != UploadPackService {
+		return nil, ErrUnsupportedService
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rc, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	d := bundle.NewDecoder(rc)
+	h := &bundle.Header{}
+	if err := d.Decode(h); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	return &bundleConnection{st: s.st, rc: rc, d: d, h: h}, nil
+}
+
+// bundleConnection is a connection to a bundle. The advertised references
+// are the ones of the bundle header, and fetching unbundles the packfile.
+type bundleConnection struct {
+	st storage.Storer
+	rc io.ReadCloser
+	d  *bundle.Decoder
+	h  *bundle.Header
+}
+
+var (
+	_ Connection   = &bundleConnection{}
+	_ StorerSetter = &bundleConnection{}
+)
+
+// Close implements Connection.
+func (c *bundleConnection) Close() error {
+	return c.rc.Close()
+}
+
+// SetStorer implements StorerSetter.
+func (c *bundleConnection) SetStorer(st storage.Storer) {
+	c.st = st
+}
+
+// Capabilities implements Connection. Only the object format of the bundle
+// is advertised.
+func (c *bundleConnection) Capabilities() *capability.List {
+	caps := capability.NewList()
+	caps.Set(capability.ObjectFormat, c.h.ObjectFormat.String()) //nolint:errcheck
+	return caps
+}
+
+// Version implements Connection.
+func (*bundleConnection) Version() protocol.Version {
+	return protocol.V0
+}
+
+// StatelessRPC implements Connection.
+func (*bundleConnection) StatelessRPC() bool {
+	return false
+}
+
+// GetRemoteRefs implements Connection.
+func (c *bundleConnection) GetRemoteRefs(context.Context) ([]*plumbing.Reference, error) {
+	if len(c.h.References) == 0 {
+		return nil, ErrEmptyRemoteRepository
+	}
+
+	return c.h.References, nil
+}
+
+// Fetch implements Connection. Bundles can't be negotiated, so the whole
+// packfile is stored regardless of the wants and haves of the request, once
+// the prerequisites of the bundle are verified.
+func (c *bundleConnection) Fetch(ctx context.Context, _ *FetchRequest) error {
+	if err := bundle.VerifyPrerequisites(c.st, c.h); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return packfile.UpdateObjectStorage(c.st, c.d)
+}
+
+// Push implements Connection.
+func (*bundleConnection) Push(context.Context, *PushRequest) error {
+	return ErrUnsupportedService
+}
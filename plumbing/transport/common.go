@@ -92,11 +92,22 @@ type Connection interface {
 
 var _ io.Closer = Connection(nil)
 
+// StorerSetter is implemented by the connections whose storer can be
+// replaced after the handshake, e.g. by a view of the repository in the
+// object format of the remote.
+type StorerSetter interface {
+	// SetStorer makes the connection read and write the objects and the
+	// references of st.
+	SetStorer(st storage.Storer)
+}
+
 // FetchRequest contains the parameters for a fetch-pack request.
 // This is used during the pack negotiation phase of the fetch operation.
 // See https://git-scm.com/docs/pack-protocol#_packfile_negotiation
 type FetchRequest struct {
-	// Progress is the progress sideband.
+	// Progress is the progress sideband. When it implements
+	// progress.Reporter, the progress of the indexing of the packfile is
+	// reported to it too.
 	Progress sideband.Progress
 
 	// Wants is the list of references to fetch.
@@ -137,6 +148,10 @@ type PushRequest struct {
 	// If the server supports atomic push, it will update the refs in one
 	// atomic transaction. Either all refs are updated or none.
 	Atomic bool
+
+	// Certificate is a signed push certificate covering Commands, sent
+	// instead of the plain command list. The server must support push-cert.
+	Certificate *packp.PushCertificate
 }
 
 // Session is a Git protocol transfer session.
@@ -0,0 +1,142 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTimeout is the time credentials are kept in a Cache by default,
+// like git-credential-cache.
+const DefaultCacheTimeout = 15 * time.Minute
+
+// defaultCache holds the credentials of the cache helpers created from the
+// configuration, shared by the whole process like the daemon of
+// git-credential-cache.
+var defaultCache = &cacheEntries{}
+
+// Cache is the built-in cache helper, keeping the credentials in memory for
+// a limited time, like git-credential-cache.
+type Cache struct {
+	timeout time.Duration
+	entries *cacheEntries
+}
+
+// NewCache returns a new empty cache, keeping the credentials for the given
+// time, or DefaultCacheTimeout if zero.
+func NewCache(timeout time.Duration) *Cache {
+	if timeout <= 0 {
+		timeout = DefaultCacheTimeout
+	}
+
+	return &Cache{timeout: timeout, entries: &cacheEntries{}}
+}
+
+// newCacheFromArgs returns the cache of a cache helper, with the given
+// --timeout option in seconds if any. The credentials are kept in a cache
+// shared by the process.
+func newCacheFromArgs(args []string) (*Cache, error) {
+	c := &Cache{timeout: DefaultCacheTimeout, entries: defaultCache}
+	for i := 0; i < len(args); i++ {
+		var value string
+		switch arg := args[i]; {
+		case strings.HasPrefix(arg, "--timeout="):
+			value = strings.TrimPrefix(arg, "--timeout=")
+		case arg == "--timeout" && i+1 < len(args):
+			i++
+			value = args[i]
+		case strings.HasPrefix(arg, "--socket"):
+			// There is no daemon, so its socket is ignored.
+			if arg == "--socket" {
+				i++
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("%w: unknown cache option %q", ErrInvalidCredential, arg)
+		}
+
+		secs, err := strconv.Atoi(value)
+		if err != nil || secs <= 0 {
+			return nil, fmt.Errorf("%w: invalid cache timeout %q", ErrInvalidCredential, value)
+		}
+
+		c.timeout = time.Duration(secs) * time.Second
+	}
+
+	return c, nil
+}
+
+type cacheEntry struct {
+	cred    *Credential
+	expires time.Time
+}
+
+type cacheEntries struct {
+	mu      sync.Mutex
+	entries []*cacheEntry
+}
+
+// remove removes the expired entries and the ones matching q, if not nil.
+// The lock must be held.
+func (e *cacheEntries) remove(q *Credential, matchPassword bool) {
+	now := time.Now()
+	kept := e.entries[:0]
+	for _, entry := range e.entries {
+		if now.After(entry.expires) || q != nil && entry.cred.Match(q, matchPassword) {
+			continue
+		}
+
+		kept = append(kept, entry)
+	}
+
+	e.entries = kept
+}
+
+// Get implements Helper.
+func (c *Cache) Get(_ context.Context, q *Credential) (*Credential, error) {
+	c.entries.mu.Lock()
+	defer c.entries.mu.Unlock()
+
+	c.entries.remove(nil, false)
+	for _, entry := range c.entries.entries {
+		if entry.cred.Match(q, false) {
+			return &Credential{Username: entry.cred.Username, Password: entry.cred.Password}, nil
+		}
+	}
+
+	return &Credential{}, nil
+}
+
+// Store implements Helper.
+func (c *Cache) Store(_ context.Context, cred *Credential) error {
+	if cred.Protocol == "" || cred.Host == "" || cred.Username == "" || cred.Password == "" {
+		return nil
+	}
+
+	c.entries.mu.Lock()
+	defer c.entries.mu.Unlock()
+
+	query := *cred
+	query.Password = ""
+	c.entries.remove(&query, false)
+
+	stored := *cred
+	c.entries.entries = append(c.entries.entries, &cacheEntry{
+		cred:    &stored,
+		expires: time.Now().Add(c.timeout),
+	})
+
+	return nil
+}
+
+// Erase implements Helper.
+func (c *Cache) Erase(_ context.Context, q *Credential) error {
+	c.entries.mu.Lock()
+	defer c.entries.mu.Unlock()
+
+	c.entries.remove(q, true)
+	return nil
+}
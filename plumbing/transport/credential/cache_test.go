@@ -0,0 +1,36 @@
+package credential
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(0)
+	require.Equal(t, DefaultCacheTimeout, cache.timeout)
+
+	q := &Credential{Protocol: "https", Host: "example.com"}
+	stored := &Credential{Protocol: "https", Host: "example.com", Username: "user", Password: "secret"}
+	require.NoError(t, cache.Store(ctx, stored))
+
+	c, err := cache.Get(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, &Credential{Username: "user", Password: "secret"}, c)
+
+	require.NoError(t, cache.Erase(ctx, stored))
+	c, err = cache.Get(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, &Credential{}, c)
+
+	cache = NewCache(time.Millisecond)
+	require.NoError(t, cache.Store(ctx, stored))
+	time.Sleep(5 * time.Millisecond)
+	c, err = cache.Get(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, &Credential{}, c)
+	require.Empty(t, cache.entries.entries)
+}
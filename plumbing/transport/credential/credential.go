@@ -0,0 +1,155 @@
+// Package credential implements the git credential helper protocol, used to
+// get, store and erase the credentials of remote repositories with helper
+// programs, like git credential does. The store and cache helpers of git are
+// also implemented, so they are available without a git installation.
+package credential
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrInvalidCredential is returned when a credential can't be encoded or
+	// decoded.
+	ErrInvalidCredential = errors.New("invalid credential")
+	// ErrCredentialNotFound is returned by Manager.Fill when no helper
+	// provides a username and password.
+	ErrCredentialNotFound = errors.New("credential not found")
+)
+
+// Credential holds the attributes of a credential, as exchanged with the
+// credential helpers.
+type Credential struct {
+	// Protocol is the protocol of the remote, such as https.
+	Protocol string
+	// Host is the host name of the remote, including the port if any.
+	Host string
+	// Path is the path of the remote repository, without the leading slash.
+	// It's only set when credential.useHttpPath is enabled.
+	Path     string
+	Username string
+	Password string
+}
+
+// FromURL returns the credential of the given URL, including the username
+// and password, if any.
+func FromURL(u *url.URL) *Credential {
+	c := &Credential{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+	}
+
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+
+	return c
+}
+
+// URL returns the URL of the credential, including the username and
+// password, if any.
+func (c *Credential) URL() *url.URL {
+	u := &url.URL{
+		Scheme: c.Protocol,
+		Host:   c.Host,
+	}
+
+	if c.Path != "" {
+		u.Path = "/" + c.Path
+	}
+
+	switch {
+	case c.Password != "":
+		u.User = url.UserPassword(c.Username, c.Password)
+	case c.Username != "":
+		u.User = url.User(c.Username)
+	}
+
+	return u
+}
+
+// Match reports whether all the attributes set in the query q are equal to
+// the ones of c. The password is only compared if matchPassword is true.
+func (c *Credential) Match(q *Credential, matchPassword bool) bool {
+	return matchAttr(q.Protocol, c.Protocol) &&
+		matchAttr(q.Host, c.Host) &&
+		matchAttr(q.Path, c.Path) &&
+		matchAttr(q.Username, c.Username) &&
+		(!matchPassword || matchAttr(q.Password, c.Password))
+}
+
+func matchAttr(want, have string) bool {
+	return want == "" || want == have
+}
+
+// attrs returns the attributes of the credential, in the order they are
+// encoded.
+func (c *Credential) attrs() []*string {
+	return []*string{&c.Protocol, &c.Host, &c.Path, &c.Username, &c.Password}
+}
+
+var attrNames = []string{"protocol", "host", "path", "username", "password"}
+
+// Encode writes the credential in the format of the credential helper
+// protocol, one key=value line for each attribute set.
+func (c *Credential) Encode(w io.Writer) error {
+	for i, v := range c.attrs() {
+		if *v == "" {
+			continue
+		}
+
+		if strings.ContainsAny(*v, "\n\x00") {
+			return fmt.Errorf("%w: %s contains a newline or NUL", ErrInvalidCredential, attrNames[i])
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", attrNames[i], *v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads a credential in the format of the credential helper protocol,
+// until a blank line or the end of the input. The attributes read replace the
+// ones of c, and the unknown ones are ignored.
+func (c *Credential) Decode(r io.Reader) error {
+	attrs := c.attrs()
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%w: invalid line %q", ErrInvalidCredential, line)
+		}
+
+		if key == "url" {
+			u, err := url.Parse(value)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+			}
+
+			*c = *FromURL(u)
+			continue
+		}
+
+		for i, name := range attrNames {
+			if name == key {
+				*attrs[i] = value
+			}
+		}
+	}
+
+	return s.Err()
+}
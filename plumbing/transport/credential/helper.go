@@ -0,0 +1,110 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Helper is a credential helper, used to get the credentials of remotes and
+// to store or erase them once they are known to be valid or invalid.
+type Helper interface {
+	// Get returns the attributes the helper has for the credential c, such as
+	// the username and password. The returned credential may be empty.
+	Get(ctx context.Context, c *Credential) (*Credential, error)
+	// Store stores the credential c, known to be valid.
+	Store(ctx context.Context, c *Credential) error
+	// Erase erases the credentials matching c, known to be invalid.
+	Erase(ctx context.Context, c *Credential) error
+}
+
+// NewHelper returns the helper of a credential.helper value. The store and
+// cache helpers are the built-in ones, and any other is run as a program
+// following the rules of git:
+//   - a value starting with ! is run as a shell command.
+//   - an absolute path is run as is.
+//   - any other name is run as git credential-<name>.
+//
+// In all cases, the arguments of the value are kept.
+func NewHelper(spec string) (Helper, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("%w: empty helper", ErrInvalidCredential)
+	}
+
+	name, args, _ := strings.Cut(spec, " ")
+	switch name {
+	case "store":
+		return newFileStoreFromArgs(strings.Fields(args))
+	case "cache":
+		return newCacheFromArgs(strings.Fields(args))
+	}
+
+	switch {
+	case strings.HasPrefix(spec, "!"):
+		return &ExecHelper{Command: spec[1:]}, nil
+	case filepath.IsAbs(name):
+		return &ExecHelper{Command: spec}, nil
+	default:
+		return &ExecHelper{Command: "git credential-" + spec}, nil
+	}
+}
+
+// ExecHelper is a helper program, run in a shell with the action as its last
+// argument, and exchanging the credentials through its standard input and
+// output.
+type ExecHelper struct {
+	// Command is the shell command running the helper.
+	Command string
+}
+
+// Get implements Helper.
+func (h *ExecHelper) Get(ctx context.Context, c *Credential) (*Credential, error) {
+	out, err := h.run(ctx, "get", c)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Credential{}
+	if err := res.Decode(bytes.NewReader(out)); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Store implements Helper.
+func (h *ExecHelper) Store(ctx context.Context, c *Credential) error {
+	_, err := h.run(ctx, "store", c)
+	return err
+}
+
+// Erase implements Helper.
+func (h *ExecHelper) Erase(ctx context.Context, c *Credential) error {
+	_, err := h.run(ctx, "erase", c)
+	return err
+}
+
+func (h *ExecHelper) run(ctx context.Context, action string, c *Credential) ([]byte, error) {
+	var in, out, stderr bytes.Buffer
+	if err := c.Encode(&in); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command+" "+action)
+	cmd.Stdin = &in
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("credential helper %q: %w: %s", h.Command, err, msg)
+		}
+
+		return nil, fmt.Errorf("credential helper %q: %w", h.Command, err)
+	}
+
+	return out.Bytes(), nil
+}
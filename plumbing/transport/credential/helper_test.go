@@ -0,0 +1,60 @@
+package credential
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHelper(t *testing.T) {
+	for spec, expected := range map[string]Helper{
+		"store":                    &FileStore{},
+		"store --file=/tmp/creds":  &FileStore{Files: []string{"/tmp/creds"}},
+		"store --file /tmp/creds":  &FileStore{Files: []string{"/tmp/creds"}},
+		"cache":                    &Cache{timeout: DefaultCacheTimeout, entries: defaultCache},
+		"cache --timeout=60":       &Cache{timeout: time.Minute, entries: defaultCache},
+		"cache --socket /tmp/sock": &Cache{timeout: DefaultCacheTimeout, entries: defaultCache},
+		"manager --option":         &ExecHelper{Command: "git credential-manager --option"},
+		"/usr/bin/helper --option": &ExecHelper{Command: "/usr/bin/helper --option"},
+		"!f() { echo $1; }; f":     &ExecHelper{Command: "f() { echo $1; }; f"},
+	} {
+		h, err := NewHelper(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, expected, h, spec)
+	}
+
+	for _, spec := range []string{"", "store --unknown", "cache --timeout=never"} {
+		_, err := NewHelper(spec)
+		require.ErrorIs(t, err, ErrInvalidCredential, spec)
+	}
+}
+
+func TestExecHelper(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	h, err := NewHelper(`!f() { echo "$1" >>` + log + `; cat >>` + log + `; if [ "$1" = get ]; then echo username=user; echo password=secret; fi; }; f`)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	q := &Credential{Protocol: "https", Host: "example.com"}
+	c, err := h.Get(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, &Credential{Username: "user", Password: "secret"}, c)
+
+	c = &Credential{Protocol: "https", Host: "example.com", Username: "user", Password: "secret"}
+	require.NoError(t, h.Store(ctx, c))
+	require.NoError(t, h.Erase(ctx, c))
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	require.Equal(t, "get\nprotocol=https\nhost=example.com\n"+
+		"store\nprotocol=https\nhost=example.com\nusername=user\npassword=secret\n"+
+		"erase\nprotocol=https\nhost=example.com\nusername=user\npassword=secret\n", string(data))
+
+	h = &ExecHelper{Command: "echo failure >&2; exit 1; true"}
+	_, err = h.Get(ctx, q)
+	require.ErrorContains(t, err, "failure")
+}
@@ -0,0 +1,162 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	giturl "github.com/go-git/go-git/v6/internal/url"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// Manager gets, approves and rejects credentials using a list of helpers,
+// like git credential fill, approve and reject.
+type Manager struct {
+	// Helpers are the credential helpers, asked in order.
+	Helpers []Helper
+	// UseHTTPPath makes the path of HTTP URLs part of the credentials, like
+	// credential.useHttpPath. Otherwise, the credentials of a host are used
+	// for all its repositories.
+	UseHTTPPath bool
+	// Username is the default username, like credential.username.
+	Username string
+}
+
+// NewManagerFromConfig returns the manager configured by the credential
+// section of the given configs, in increasing order of priority, for the
+// given URL. The credential.helper options are accumulated, an empty value
+// resetting the list, and the credential.<url>.* options are used for the
+// URLs they match.
+func NewManagerFromConfig(u *url.URL, cfgs ...*format.Config) (*Manager, error) {
+	var specs []string
+	m := &Manager{}
+	for _, cfg := range cfgs {
+		if cfg == nil || !cfg.HasSection("credential") {
+			continue
+		}
+
+		sec := cfg.Section("credential")
+		opts := []format.Options{sec.Options}
+		for _, sub := range sec.Subsections {
+			if _, ok := giturl.MatchConfig(sub.Name, u); ok {
+				opts = append(opts, sub.Options)
+			}
+		}
+
+		for _, o := range opts {
+			for _, opt := range o {
+				switch {
+				case opt.IsKey("helper"):
+					if opt.Value == "" {
+						specs = nil
+					} else {
+						specs = append(specs, opt.Value)
+					}
+				case opt.IsKey("useHttpPath"):
+					v, err := strconv.ParseBool(opt.Value)
+					if err != nil {
+						return nil, fmt.Errorf("invalid credential.useHttpPath: %w", err)
+					}
+
+					m.UseHTTPPath = v
+				case opt.IsKey("username"):
+					m.Username = opt.Value
+				}
+			}
+		}
+	}
+
+	for _, spec := range specs {
+		h, err := NewHelper(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Helpers = append(m.Helpers, h)
+	}
+
+	return m, nil
+}
+
+// query returns the credential sent to the helpers for c.
+func (m *Manager) query(c *Credential) *Credential {
+	q := *c
+	if q.Username == "" {
+		q.Username = m.Username
+	}
+
+	if !m.UseHTTPPath && (q.Protocol == "http" || q.Protocol == "https") {
+		q.Path = ""
+	}
+
+	return &q
+}
+
+// Fill returns the credential c, with the username and password provided by
+// the first helpers having them. It returns ErrCredentialNotFound if no
+// helper has them.
+func (m *Manager) Fill(ctx context.Context, c *Credential) (*Credential, error) {
+	q := m.query(c)
+	if q.Username != "" && q.Password != "" {
+		return q, nil
+	}
+
+	var errs []error
+	for _, h := range m.Helpers {
+		res, err := h.Get(ctx, q)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			// Like git, a failing helper doesn't prevent the next ones from
+			// being asked.
+			errs = append(errs, err)
+			continue
+		}
+
+		if res.Username != "" {
+			q.Username = res.Username
+		}
+
+		if res.Password != "" {
+			q.Password = res.Password
+		}
+
+		if q.Username != "" && q.Password != "" {
+			return q, nil
+		}
+	}
+
+	return nil, errors.Join(append([]error{ErrCredentialNotFound}, errs...)...)
+}
+
+// Approve stores the credential c in all the helpers, once it's known to be
+// valid.
+func (m *Manager) Approve(ctx context.Context, c *Credential) error {
+	q := m.query(c)
+	if q.Username == "" || q.Password == "" {
+		return nil
+	}
+
+	var errs []error
+	for _, h := range m.Helpers {
+		errs = append(errs, h.Store(ctx, q))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reject erases the credential c from all the helpers, once it's known to be
+// invalid.
+func (m *Manager) Reject(ctx context.Context, c *Credential) error {
+	q := m.query(c)
+	var errs []error
+	for _, h := range m.Helpers {
+		errs = append(errs, h.Erase(ctx, q))
+	}
+
+	return errors.Join(errs...)
+}
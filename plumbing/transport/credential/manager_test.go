@@ -0,0 +1,100 @@
+package credential
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManagerFromConfig(t *testing.T) {
+	decode := func(s string) *format.Config {
+		cfg := format.New()
+		require.NoError(t, format.NewDecoder(strings.NewReader(s)).Decode(cfg))
+		return cfg
+	}
+
+	system := decode(`[credential]
+	helper = cache
+	username = system
+`)
+	global := decode(`[credential]
+	helper =
+	helper = store --file=/tmp/global
+[credential "https://example.com"]
+	useHttpPath = true
+	username = user
+[credential "https://example.org"]
+	helper = cache
+`)
+	local := decode(`[credential "https://example.com/repo.git"]
+	helper = !helper
+`)
+
+	u, err := url.Parse("https://example.com/repo.git")
+	require.NoError(t, err)
+	m, err := NewManagerFromConfig(u, system, global, local)
+	require.NoError(t, err)
+	require.Equal(t, &Manager{
+		Helpers: []Helper{
+			&FileStore{Files: []string{"/tmp/global"}},
+			&ExecHelper{Command: "helper"},
+		},
+		UseHTTPPath: true,
+		Username:    "user",
+	}, m)
+
+	_, err = NewManagerFromConfig(u, decode("[credential]\n\tuseHttpPath = maybe\n"))
+	require.Error(t, err)
+}
+
+type mockHelper struct {
+	get            *Credential
+	stored, erased []*Credential
+}
+
+func (h *mockHelper) Get(_ context.Context, _ *Credential) (*Credential, error) {
+	return h.get, nil
+}
+
+func (h *mockHelper) Store(_ context.Context, c *Credential) error {
+	h.stored = append(h.stored, c)
+	return nil
+}
+
+func (h *mockHelper) Erase(_ context.Context, c *Credential) error {
+	h.erased = append(h.erased, c)
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	first := &mockHelper{get: &Credential{Username: "user"}}
+	second := &mockHelper{get: &Credential{Username: "other", Password: "secret"}}
+	m := &Manager{Helpers: []Helper{first, second}}
+
+	q := &Credential{Protocol: "https", Host: "example.com", Path: "repo.git"}
+	c, err := m.Fill(ctx, q)
+	require.NoError(t, err)
+	expected := &Credential{Protocol: "https", Host: "example.com", Username: "other", Password: "secret"}
+	require.Equal(t, expected, c)
+
+	require.NoError(t, m.Approve(ctx, c))
+	require.Equal(t, []*Credential{expected}, first.stored)
+	require.NoError(t, m.Reject(ctx, c))
+	require.Equal(t, []*Credential{expected}, second.erased)
+
+	m.UseHTTPPath = true
+	m.Helpers = []Helper{first}
+	_, err = m.Fill(ctx, q)
+	require.ErrorIs(t, err, ErrCredentialNotFound)
+
+	m.Username = "default"
+	m.Helpers = []Helper{&mockHelper{get: &Credential{Password: "secret"}}}
+	c, err = m.Fill(ctx, q)
+	require.NoError(t, err)
+	require.Equal(t, &Credential{Protocol: "https", Host: "example.com", Path: "repo.git", Username: "default", Password: "secret"}, c)
+}
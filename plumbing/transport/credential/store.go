@@ -0,0 +1,204 @@
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore is the built-in store helper, like git-credential-store. The
+// credentials are stored in plain text files, one URL per line.
+type FileStore struct {
+	// Files are the credential files. Credentials are read from all of them,
+	// stored in the first one existing, or the first one if none exists, and
+	// erased from all of them. When empty, ~/.git-credentials and
+	// $XDG_CONFIG_HOME/git/credentials are used.
+	Files []string
+}
+
+// newFileStoreFromArgs returns the store of a store helper, with the given
+// --file option if any.
+func newFileStoreFromArgs(args []string) (*FileStore, error) {
+	s := &FileStore{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case strings.HasPrefix(arg, "--file="):
+			s.Files = []string{strings.TrimPrefix(arg, "--file=")}
+		case arg == "--file" && i+1 < len(args):
+			i++
+			s.Files = []string{args[i]}
+		default:
+			return nil, fmt.Errorf("%w: unknown store option %q", ErrInvalidCredential, arg)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) files() ([]string, error) {
+	if len(s.Files) > 0 {
+		return s.Files, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	return []string{
+		filepath.Join(home, ".git-credentials"),
+		filepath.Join(xdg, "git", "credentials"),
+	}, nil
+}
+
+// Get implements Helper.
+func (s *FileStore) Get(_ context.Context, c *Credential) (*Credential, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		creds, err := readCredentialFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, stored := range creds {
+			if stored.Match(c, false) && stored.Username != "" && stored.Password != "" {
+				return &Credential{Username: stored.Username, Password: stored.Password}, nil
+			}
+		}
+	}
+
+	return &Credential{}, nil
+}
+
+// Store implements Helper.
+func (s *FileStore) Store(_ context.Context, c *Credential) error {
+	if c.Protocol == "" || c.Host == "" || c.Username == "" || c.Password == "" {
+		return nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	file := files[0]
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			file = f
+			break
+		}
+	}
+
+	creds, err := readCredentialFile(file)
+	if err != nil {
+		return err
+	}
+
+	query := *c
+	query.Password = ""
+	kept := []*Credential{c}
+	for _, stored := range creds {
+		if !stored.Match(&query, false) {
+			kept = append(kept, stored)
+		}
+	}
+
+	return writeCredentialFile(file, kept)
+}
+
+// Erase implements Helper.
+func (s *FileStore) Erase(_ context.Context, c *Credential) error {
+	if c.Protocol == "" && c.Host == "" && c.Path == "" && c.Username == "" {
+		return nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		creds, err := readCredentialFile(file)
+		if err != nil {
+			return err
+		}
+
+		kept := make([]*Credential, 0, len(creds))
+		for _, stored := range creds {
+			if !stored.Match(c, true) {
+				kept = append(kept, stored)
+			}
+		}
+
+		if len(kept) == len(creds) {
+			continue
+		}
+
+		if err := writeCredentialFile(file, kept); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readCredentialFile reads the credentials of a file, ignoring the invalid
+// lines. A missing file has no credentials.
+func readCredentialFile(file string) ([]*Credential, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []*Credential
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		u, err := url.Parse(strings.TrimSpace(s.Text()))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			continue
+		}
+
+		creds = append(creds, FromURL(u))
+	}
+
+	return creds, s.Err()
+}
+
+// writeCredentialFile replaces the content of a credential file, only
+// readable by its owner.
+func writeCredentialFile(file string, creds []*Credential) error {
+	var buf bytes.Buffer
+	for _, c := range creds {
+		buf.WriteString(c.URL().String())
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+
+	tmp := file + ".lock"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
@@ -39,7 +40,13 @@ func FetchPack(
 		reader = demuxer
 	}
 
-	if err := packfile.UpdateObjectStorage(st, reader); err != nil {
+	// The local progress is reported when the progress accepts events.
+	var opts []packfile.ParserOption
+	if r, ok := req.Progress.(progress.Reporter); ok {
+		opts = append(opts, packfile.WithProgress(r))
+	}
+
+	if err := packfile.UpdateObjectStorage(st, reader, opts...); err != nil {
 		return err
 	}
 
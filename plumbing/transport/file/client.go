@@ -5,9 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
 )
 
 func init() {
@@ -22,17 +25,52 @@ type runner struct {
 }
 
 // NewTransport returns a new file transport that users go-git built-in server
-// implementation to serve repositories.
+// implementation to serve repositories. Endpoints pointing to bundle files
+// are fetched from directly, like git does.
 func NewTransport(loader transport.Loader) transport.Transport {
 	if loader == nil {
 		loader = transport.DefaultLoader
 	}
-	return transport.NewPackTransport(&runner{loader})
+	return &fileTransport{transport.NewPackTransport(&runner{loader})}
+}
+
+type fileTransport struct {
+	transport.Transport
+}
+
+// NewSession returns a new session for an endpoint.
+func (t *fileTransport) NewSession(st storage.Storer, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	if isBundle(ep.Path) {
+		return transport.NewBundleSession(st, func() (io.ReadCloser, error) {
+			return os.Open(ep.Path)
+		}), nil
+	}
+
+	return t.Transport.NewSession(st, ep, auth)
+}
+
+// isBundle returns true if path is a regular file starting with a bundle
+// signature.
+func isBundle(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	ok, _ := bundle.IsBundle(f)
+	return ok
 }
 
 func (r *runner) Command(ctx context.Context, cmd string, ep *transport.Endpoint, auth transport.AuthMethod, params ...string) (transport.Command, error) {
 	switch transport.Service(cmd) {
-	case transport.UploadPackService, transport.ReceivePackService:
+	case transport.UploadPackService, transport.ReceivePackService,
+		transport.UploadArchiveService:
 		// do nothing
 	default:
 		return nil, transport.ErrUnsupportedService
@@ -110,6 +148,20 @@ func (c *command) Start() error {
 			}
 		}()
 		return nil
+	case transport.UploadArchiveService:
+		go func() {
+			if err := transport.UploadArchive(
+				c.ctx,
+				st,
+				io.NopCloser(c.stdin),
+				c.stdout,
+				&transport.UploadArchiveOptions{},
+			); err != nil {
+				_, _ = fmt.Fprintln(c.stderr, err)
+				_ = c.Close()
+			}
+		}()
+		return nil
 	}
 	return fmt.Errorf("unsupported service: %s", c.service)
 }
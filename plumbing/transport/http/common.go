@@ -12,17 +12,20 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
 	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/credential"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/trace"
@@ -118,10 +121,11 @@ func modifyRedirect(res *http.Response, ep *transport.Endpoint) {
 const infoRefsPath = "/info/refs"
 
 type client struct {
-	client     *http.Client
-	transports *lru.Cache
-	mutex      sync.RWMutex
-	useDumb    bool // When true, the client will always use the dumb protocol.
+	client       *http.Client
+	transports   *lru.Cache
+	mutex        sync.RWMutex
+	useDumb      bool // When true, the client will always use the dumb protocol.
+	useGitConfig bool // When true, the system and global configs are read too.
 }
 
 // TransportOptions holds user configurable options for the client.
@@ -140,6 +144,11 @@ type TransportOptions struct {
 	// UseDumb is a flag that when set to true, the client will always use the
 	// dumb protocol.
 	UseDumb bool
+
+	// UseGitConfig is a flag that when set to true, the client also honors the
+	// http.* and credential.* options of the system and global git configs,
+	// like git. Only the repository config is read otherwise.
+	UseGitConfig bool
 }
 
 var (
@@ -160,6 +169,11 @@ var (
 // If the net/http client is nil or empty, it will use a net/http client configured
 // with http.DefaultTransport.
 //
+// The sessions also honor the http.* options of the repository config, and of
+// the system and global configs if UseGitConfig is set, matching the URL of
+// their endpoint, see Config. The options of the endpoint take precedence over
+// them.
+//
 // Note that for HTTP client cannot distinguish between private repositories and
 // unexistent repositories on GitHub. So it returns `ErrAuthorizationRequired`
 // for both.
@@ -176,8 +190,9 @@ func NewTransport(opts *TransportOptions) transport.Transport {
 	}
 
 	cl := &client{
-		client:  opts.Client,
-		useDumb: opts.UseDumb,
+		client:       opts.Client,
+		useDumb:      opts.UseDumb,
+		useGitConfig: opts.UseGitConfig,
 	}
 	if opts.CacheMaxEntries > 0 {
 		cl.transports = lru.New(opts.CacheMaxEntries)
@@ -211,6 +226,12 @@ type HTTPSession struct {
 	version     protocol.Version  // the server's protocol version
 	useDumb     bool              // When true, the client will always use the dumb protocol
 	isSmart     bool              // This is true if the session is using the smart protocol
+
+	cfgs       []*format.Config // the configs holding the http.* options
+	postBuffer int              // the size of the bodies sent at once, if not zero
+
+	creds *credential.Manager    // the credential helpers, until the credential is checked
+	cred  *credential.Credential // the credential filled by the helpers, if any
 }
 
 // IsSmart returns true if the session is using the smart protocol.
@@ -247,32 +268,102 @@ func transportWithProxy(transport *http.Transport, proxyURL *url.URL) {
 	transport.Proxy = http.ProxyURL(proxyURL)
 }
 
-func configureTransport(transport *http.Transport, ep *transport.Endpoint) error {
-	if len(ep.CaBundle) > 0 {
-		if err := transportWithCABundle(transport, ep.CaBundle); err != nil {
+func transportWithClientCert(transport *http.Transport, certFile, keyFile string) error {
+	if keyFile == "" {
+		keyFile = certFile
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
+
+func configureTransport(transport *http.Transport, opts transportOptions) error {
+	if len(opts.caBundle) > 0 {
+		if err := transportWithCABundle(transport, []byte(opts.caBundle)); err != nil {
 			return err
 		}
 	}
-	if ep.InsecureSkipTLS {
+	if opts.insecureSkipTLS {
 		transportWithInsecureTLS(transport)
 	}
 
-	if ep.Proxy.URL != "" {
-		proxyURL, err := ep.Proxy.FullURL()
-		if err != nil {
+	if opts.proxyURL != (url.URL{}) {
+		transportWithProxy(transport, &opts.proxyURL)
+	}
+
+	if opts.clientCert != "" {
+		if err := transportWithClientCert(transport, opts.clientCert, opts.clientKey); err != nil {
 			return err
 		}
-		transportWithProxy(transport, proxyURL)
 	}
 	return nil
 }
 
+// newTransportOptions returns the transport options of the endpoint, falling
+// back to the ones of the http.* config.
+func newTransportOptions(ep *transport.Endpoint, config *Config) (transportOptions, error) {
+	opts := transportOptions{
+		insecureSkipTLS: ep.InsecureSkipTLS || !config.SSLVerify,
+		caBundle:        string(ep.CaBundle),
+		clientCert:      config.SSLCert,
+		clientKey:       config.SSLKey,
+	}
+
+	if len(opts.caBundle) == 0 && config.SSLCAInfo != "" {
+		caBundle, err := os.ReadFile(config.SSLCAInfo)
+		if err != nil {
+			return opts, err
+		}
+		opts.caBundle = string(caBundle)
+	}
+
+	var proxyURL *url.URL
+	var err error
+	switch {
+	case ep.Proxy.URL != "":
+		proxyURL, err = ep.Proxy.FullURL()
+	case config.Proxy != "":
+		proxyURL, err = config.proxyURL()
+	}
+	if err != nil {
+		return opts, err
+	}
+	if proxyURL != nil {
+		opts.proxyURL = *proxyURL
+	}
+
+	return opts, nil
+}
+
 func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth transport.AuthMethod, useDumb bool) (*HTTPSession, error) {
-	var httpClient *http.Client
+	cfgs := loadConfigs(st, c.useGitConfig)
+	u, err := url.Parse(ep.String())
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := NewConfig(u, cfgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	transportOpts, err := newTransportOptions(ep, config)
+	if err != nil {
+		return nil, err
+	}
 
+	httpClient := c.client
 	// We need to configure the http transport if there are transport specific
-	// options present in the endpoint.
-	if len(ep.CaBundle) > 0 || ep.InsecureSkipTLS || ep.Proxy.URL != "" {
+	// options present in the endpoint or the config.
+	if transportOpts != (transportOptions{}) {
 		var transport *http.Transport
 		// if the client wasn't configured to have a cache for transports then just configure
 		// the transport and use it directly, otherwise try to use the cache.
@@ -284,25 +375,18 @@ func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth trans
 			}
 
 			transport = tr.Clone()
-			configureTransport(transport, ep)
-		} else {
-			transportOpts := transportOptions{
-				caBundle:        string(ep.CaBundle),
-				insecureSkipTLS: ep.InsecureSkipTLS,
-			}
-			if ep.Proxy.URL != "" {
-				proxyURL, err := ep.Proxy.FullURL()
-				if err != nil {
-					return nil, err
-				}
-				transportOpts.proxyURL = *proxyURL
+			if err := configureTransport(transport, transportOpts); err != nil {
+				return nil, err
 			}
+		} else {
 			var found bool
 			transport, found = c.fetchTransport(transportOpts)
 
 			if !found {
 				transport = c.client.Transport.(*http.Transport).Clone()
-				configureTransport(transport, ep)
+				if err := configureTransport(transport, transportOpts); err != nil {
+					return nil, err
+				}
 				c.addTransport(transportOpts, transport)
 			}
 		}
@@ -313,16 +397,28 @@ func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth trans
 			Jar:           c.client.Jar,
 			Timeout:       c.client.Timeout,
 		}
-	} else {
-		httpClient = c.client
+	}
+
+	if rt := newConfigTransport(httpClient.Transport, config); rt != httpClient.Transport || config.CookieFile != "" {
+		configured := *httpClient
+		configured.Transport = rt
+		if config.CookieFile != "" {
+			if configured.Jar, err = config.cookieJar(); err != nil {
+				return nil, err
+			}
+		}
+
+		httpClient = &configured
 	}
 
 	s := &HTTPSession{
-		st:      st,
-		auth:    basicAuthFromEndpoint(ep),
-		client:  httpClient,
-		ep:      ep,
-		useDumb: useDumb,
+		st:         st,
+		auth:       basicAuthFromEndpoint(ep),
+		client:     httpClient,
+		ep:         ep,
+		useDumb:    useDumb,
+		cfgs:       cfgs,
+		postBuffer: config.PostBuffer,
 	}
 	if auth != nil {
 		a, ok := auth.(AuthMethod)
@@ -347,19 +443,30 @@ func (s *HTTPSession) Handshake(ctx context.Context, service transport.Service,
 	}
 
 	s.svc = service
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-
 	if len(params) > 0 {
 		s.gitProtocol = strings.Join(params, ":")
 	}
 
-	applyHeaders(req, service.String(), s.ep, s.auth, s.gitProtocol, !s.useDumb)
-	res, err := doRequest(s.client, req)
-	if err != nil {
-		return nil, err
+	var res *http.Response
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		applyHeaders(req, service.String(), s.ep, s.auth, s.gitProtocol, !s.useDumb)
+		res, err = doRequest(s.client, req)
+		if err == transport.ErrAuthenticationRequired && s.fillCredential(ctx) {
+			res.Body.Close() //nolint:errcheck
+			continue
+		}
+
+		s.checkCredential(ctx, err)
+		if err != nil {
+			return nil, err
+		}
+
+		break
 	}
 
 	if contentType := res.Header.Get("Content-Type"); !s.useDumb {
@@ -444,7 +551,15 @@ func (s *HTTPSession) Handshake(ctx context.Context, service transport.Service,
 	return s, nil
 }
 
-var _ transport.Connection = &HTTPSession{}
+var (
+	_ transport.Connection   = &HTTPSession{}
+	_ transport.StorerSetter = &HTTPSession{}
+)
+
+// SetStorer implements transport.StorerSetter.
+func (s *HTTPSession) SetStorer(st storage.Storer) {
+	s.st = st
+}
 
 // Capabilities implements transport.Connection.
 func (s *HTTPSession) Capabilities() *capability.List {
@@ -505,6 +620,22 @@ func (s *HTTPSession) Push(ctx context.Context, req *transport.PushRequest) (err
 	return transport.SendPack(ctx, s.st, s, rwc, rwc.BodyCloser(), req)
 }
 
+var _ transport.Archiver = &HTTPSession{}
+
+// Archive implements transport.Archiver.
+func (s *HTTPSession) Archive(ctx context.Context, req *transport.ArchiveRequest) (io.ReadCloser, error) {
+	if s.useDumb {
+		return nil, transport.ErrUnsupportedService
+	}
+
+	// git-upload-archive has no reference discovery phase, and it's only
+	// available through the smart protocol.
+	s.isSmart = true
+
+	rwc := newRequester(ctx, s, transport.UploadArchiveService)
+	return transport.RequestArchive(ctx, rwc.BodyCloser(), rwc, req)
+}
+
 // Version implements transport.Connection.
 func (s *HTTPSession) Version() protocol.Version {
 	return s.version
@@ -555,8 +686,15 @@ func (r *requester) Read(p []byte) (n int, err error) {
 func (r *requester) Close() (err error) {
 	defer r.reqBuf.Reset()
 
+	var body io.Reader = &r.reqBuf
+	if r.postBuffer > 0 && r.reqBuf.Len() > r.postBuffer {
+		// Hiding the length of the body sends it with a chunked transfer
+		// encoding, like git for bodies larger than http.postBuffer.
+		body = io.NopCloser(body)
+	}
+
 	url := fmt.Sprintf("%s/%s", r.ep.String(), r.service)
-	r.req, err = http.NewRequestWithContext(r.ctx, http.MethodPost, url, &r.reqBuf)
+	r.req, err = http.NewRequestWithContext(r.ctx, http.MethodPost, url, body)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,275 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	giturl "github.com/go-git/go-git/v6/internal/url"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+const httpSection = "http"
+
+// multiValued are the keys whose values accumulate, whatever the specificity
+// of the URL they're set for.
+var multiValued = map[string]bool{
+	"extraheader": true,
+}
+
+// Config holds the http.* options of git applying to a remote URL.
+type Config struct {
+	// ExtraHeaders are added to all the requests, like http.extraHeader.
+	ExtraHeaders http.Header
+	// SSLVerify verifies the certificate of the server, like http.sslVerify.
+	// It's true by default.
+	SSLVerify bool
+	// SSLCAInfo is a file holding additional certificates to verify the
+	// server with, like http.sslCAInfo.
+	SSLCAInfo string
+	// SSLCert and SSLKey are the files holding the client certificate and
+	// its key, like http.sslCert and http.sslKey. The key is read from the
+	// certificate file when SSLKey is empty.
+	SSLCert, SSLKey string
+	// Proxy is the URL of the proxy, like http.proxy.
+	Proxy string
+	// CookieFile is a file holding the cookies to send, in the Netscape
+	// format, like http.cookieFile.
+	CookieFile string
+	// UserAgent replaces the default user agent, like http.userAgent.
+	UserAgent string
+	// LowSpeedLimit and LowSpeedTime abort the requests transferring less
+	// than LowSpeedLimit bytes per second during LowSpeedTime, like
+	// http.lowSpeedLimit and http.lowSpeedTime.
+	LowSpeedLimit int
+	LowSpeedTime  time.Duration
+	// PostBuffer is the maximum size of the bodies sent at once, larger ones
+	// being sent with a chunked transfer encoding, like http.postBuffer. Zero
+	// means no limit.
+	PostBuffer int
+}
+
+// NewConfig returns the http.* options of the given configs, in increasing
+// order of priority, applying to u. Like git, the http.<url>.* options are
+// used for the URLs they match, and the value of the most specific URL wins,
+// the http.* options being the least specific ones. The http.extraHeader
+// values accumulate instead, an empty one clearing the previous ones.
+func NewConfig(u *url.URL, cfgs ...*format.Config) (*Config, error) {
+	c := &Config{SSLVerify: true}
+	specificities := make(map[string]int)
+	for _, cfg := range cfgs {
+		if cfg == nil || !cfg.HasSection(httpSection) {
+			continue
+		}
+
+		sec := cfg.Section(httpSection)
+		if err := c.apply(sec.Options, -1, specificities); err != nil {
+			return nil, err
+		}
+
+		for _, sub := range sec.Subsections {
+			specificity, ok := giturl.MatchConfig(sub.Name, u)
+			if !ok {
+				continue
+			}
+
+			if err := c.apply(sub.Options, specificity, specificities); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Config) apply(opts format.Options, specificity int, specificities map[string]int) error {
+	for _, opt := range opts {
+		key := strings.ToLower(opt.Key)
+		if s, ok := specificities[key]; ok && s > specificity && !multiValued[key] {
+			continue
+		}
+
+		specificities[key] = specificity
+		if err := c.set(key, opt.Value); err != nil {
+			return fmt.Errorf("invalid http.%s: %w", opt.Key, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) set(key, value string) (err error) {
+	switch key {
+	case "extraheader":
+		if value == "" {
+			c.ExtraHeaders = nil
+			return nil
+		}
+
+		name, v, ok := strings.Cut(value, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q", value)
+		}
+
+		if c.ExtraHeaders == nil {
+			c.ExtraHeaders = make(http.Header)
+		}
+		c.ExtraHeaders.Add(strings.TrimSpace(name), strings.TrimSpace(v))
+	case "sslverify":
+		c.SSLVerify, err = parseBool(value)
+	case "sslcainfo":
+		c.SSLCAInfo = value
+	case "sslcert":
+		c.SSLCert = value
+	case "sslkey":
+		c.SSLKey = value
+	case "proxy":
+		c.Proxy = value
+	case "cookiefile":
+		c.CookieFile = value
+	case "useragent":
+		c.UserAgent = value
+	case "lowspeedlimit":
+		c.LowSpeedLimit, err = parseInt(value)
+	case "lowspeedtime":
+		var secs int
+		secs, err = parseInt(value)
+		c.LowSpeedTime = time.Duration(secs) * time.Second
+	case "postbuffer":
+		c.PostBuffer, err = parseInt(value)
+	}
+
+	return err
+}
+
+// parseBool parses a boolean value of git.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// parseInt parses an integer value of git, with an optional k, m or g unit.
+func parseInt(value string) (int, error) {
+	unit := 1
+	switch strings.ToLower(value[max(len(value)-1, 0):]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+
+	if unit != 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid integer %q", value)
+	}
+
+	return n * unit, nil
+}
+
+// proxyURL returns the URL of the proxy, using http as the default scheme
+// like git.
+func (c *Config) proxyURL() (*url.URL, error) {
+	proxy := c.Proxy
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	return url.Parse(proxy)
+}
+
+// cookieJar returns a cookie jar holding the cookies of the cookie file.
+func (c *Config) cookieJar() (http.CookieJar, error) {
+	f, err := os.Open(c.CookieFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiration, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+
+		cookie := &http.Cookie{
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+
+		host := strings.TrimPrefix(fields[0], ".")
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = host
+		}
+
+		if secs, err := strconv.ParseInt(fields[4], 10, 64); err == nil && secs > 0 {
+			cookie.Expires = time.Unix(secs, 0)
+		}
+
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: cookie.Path}, []*http.Cookie{cookie})
+	}
+
+	return jar, s.Err()
+}
+
+// loadConfigs returns the local config, preceded by the system and global
+// ones if global is true, in increasing order of priority.
+func loadConfigs(st storage.Storer, global bool) []*format.Config {
+	var cfgs []*format.Config
+	if global {
+		for _, scope := range []config.Scope{config.SystemScope, config.GlobalScope} {
+			if cfg, err := config.LoadConfig(scope); err == nil {
+				cfgs = append(cfgs, cfg.Raw)
+			}
+		}
+	}
+
+	if st != nil {
+		if cfg, err := st.Config(); err == nil {
+			cfgs = append(cfgs, cfg.Raw)
+		}
+	}
+
+	return cfgs
+}
@@ -0,0 +1,278 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeConfig(t testing.TB, s string) *format.Config {
+	t.Helper()
+
+	cfg := format.New()
+	require.NoError(t, format.NewDecoder(strings.NewReader(s)).Decode(cfg))
+	return cfg
+}
+
+func TestNewConfig(t *testing.T) {
+	global := decodeConfig(t, `[http]
+	sslVerify = false
+	userAgent = global
+	extraHeader = X-Global: 1
+	postBuffer = 1m
+[http "https://example.com/repo.git"]
+	userAgent = repo
+	extraHeader = X-Repo: 1
+[http "https://*.example.com"]
+	proxy = wildcard:3128
+[http "https://example.org"]
+	userAgent = other
+`)
+	local := decodeConfig(t, `[http]
+	userAgent = local
+	lowSpeedLimit = 1k
+	lowSpeedTime = 30
+	extraHeader = X-Local: 1
+[http "https://example.com"]
+	sslVerify = true
+	sslCAInfo = /ca.pem
+	sslCert = /cert.pem
+	sslKey = /key.pem
+	proxy = proxy:3128
+	cookieFile = /cookies
+`)
+
+	u, err := url.Parse("https://example.com/repo.git")
+	require.NoError(t, err)
+	cfg, err := NewConfig(u, global, local)
+	require.NoError(t, err)
+	require.Equal(t, &Config{
+		ExtraHeaders:  http.Header{"X-Global": {"1"}, "X-Repo": {"1"}, "X-Local": {"1"}},
+		SSLVerify:     true,
+		SSLCAInfo:     "/ca.pem",
+		SSLCert:       "/cert.pem",
+		SSLKey:        "/key.pem",
+		Proxy:         "proxy:3128",
+		CookieFile:    "/cookies",
+		UserAgent:     "repo",
+		LowSpeedLimit: 1024,
+		LowSpeedTime:  30 * time.Second,
+		PostBuffer:    1 << 20,
+	}, cfg)
+
+	proxyURL, err := cfg.proxyURL()
+	require.NoError(t, err)
+	require.Equal(t, "http://proxy:3128", proxyURL.String())
+
+	cfg, err = NewConfig(u, decodeConfig(t, "[http]\n\textraHeader = X-A: 1\n\textraHeader =\n\textraHeader = X-B: 2\n"))
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"X-B": {"2"}}, cfg.ExtraHeaders)
+
+	// The extra headers of a less specific URL are added after the ones of
+	// a more specific URL.
+	cfg, err = NewConfig(u,
+		decodeConfig(t, "[http \"https://example.com\"]\n\textraHeader = X-A: 1\n"),
+		decodeConfig(t, "[http]\n\textraHeader = X-A: 2\n"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"X-A": {"1", "2"}}, cfg.ExtraHeaders)
+
+	for _, invalid := range []string{"sslVerify = maybe", "postBuffer = big", "extraHeader = invalid"} {
+		_, err = NewConfig(u, decodeConfig(t, "[http]\n\t"+invalid+"\n"))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestConfigTransportOptions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, []byte("certificates"), 0o600))
+
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw = decodeConfig(t, fmt.Sprintf(`[http "https://example.com"]
+	sslVerify = false
+	sslCAInfo = %s
+	proxy = proxy:3128
+`, ca))
+	require.NoError(t, st.SetConfig(cfg))
+
+	ep, err := transport.NewEndpoint("https://example.com/repo.git")
+	require.NoError(t, err)
+
+	cl := NewTransport(&TransportOptions{CacheMaxEntries: 1}).(*client)
+	session, err := newSession(st, cl, ep, nil, false)
+	require.NoError(t, err)
+
+	tr := session.client.Transport.(*http.Transport)
+	require.True(t, tr.TLSClientConfig.InsecureSkipVerify)
+	require.NotNil(t, tr.TLSClientConfig.RootCAs)
+	proxyURL, err := tr.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "example.com"}})
+	require.NoError(t, err)
+	require.Equal(t, "http://proxy:3128", proxyURL.String())
+
+	// The options of the endpoint take precedence over the config.
+	ep.Proxy.URL = "http://other:3128"
+	session, err = newSession(st, cl, ep, nil, false)
+	require.NoError(t, err)
+	tr = session.client.Transport.(*http.Transport)
+	proxyURL, err = tr.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "example.com"}})
+	require.NoError(t, err)
+	require.Equal(t, "http://other:3128", proxyURL.String())
+
+	cfg.Raw.Section(httpSection).Subsection("https://example.com").SetOption("sslCert", filepath.Join(t.TempDir(), "missing.pem"))
+	require.NoError(t, st.SetConfig(cfg))
+	_, err = newSession(st, cl, ep, nil, false)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestConfigUseGitConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[http]\n\tuserAgent = global\n"), 0o600))
+
+	st := memory.NewStorage()
+	ep, err := transport.NewEndpoint("https://example.com/repo.git")
+	require.NoError(t, err)
+
+	// The global config is only read when requested.
+	session, err := newSession(st, NewTransport(nil).(*client), ep, nil, false)
+	require.NoError(t, err)
+	cfg, err := NewConfig(&url.URL{Scheme: "https", Host: "example.com"}, session.cfgs...)
+	require.NoError(t, err)
+	require.Empty(t, cfg.UserAgent)
+
+	cl := NewTransport(&TransportOptions{UseGitConfig: true}).(*client)
+	session, err = newSession(st, cl, ep, nil, false)
+	require.NoError(t, err)
+	cfg, err = NewConfig(&url.URL{Scheme: "https", Host: "example.com"}, session.cfgs...)
+	require.NoError(t, err)
+	require.Equal(t, "global", cfg.UserAgent)
+}
+
+func TestConfigRequests(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+
+		if r.Method == http.MethodPost {
+			w.Write([]byte("result")) //nolint:errcheck
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	cookies := filepath.Join(t.TempDir(), "cookies")
+	require.NoError(t, os.WriteFile(cookies, []byte("# Netscape HTTP Cookie File\n"+
+		u.Hostname()+"\tFALSE\t/\tFALSE\t0\tsession\tcookie\n"+
+		"other.com\tFALSE\t/\tFALSE\t0\tother\tcookie\n"), 0o600))
+
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw = decodeConfig(t, fmt.Sprintf(`[http]
+	extraHeader = X-Extra: 1
+	userAgent = agent/1.0
+	postBuffer = 4
+[http "%s"]
+	cookieFile = %s
+	extraHeader = X-Extra: 2
+`, server.URL, cookies))
+	require.NoError(t, st.SetConfig(cfg))
+
+	ep, err := transport.NewEndpoint(server.URL + "/repo.git")
+	require.NoError(t, err)
+	session, err := NewTransport(nil).NewSession(st, ep, nil)
+	require.NoError(t, err)
+
+	_, err = session.Handshake(context.Background(), transport.UploadPackService)
+	require.ErrorIs(t, err, transport.ErrRepositoryNotFound)
+
+	s := session.(*HTTPSession)
+	for _, body := range []string{"1234", "12345"} {
+		r := newRequester(context.Background(), s, transport.UploadPackService)
+		_, err = r.Write([]byte(body))
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.NoError(t, r.BodyCloser().Close())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 3)
+	for _, r := range requests {
+		require.Equal(t, []string{"1", "2"}, r.Header.Values("X-Extra"))
+		require.Equal(t, "agent/1.0", r.UserAgent())
+		require.Equal(t, "session=cookie", r.Header.Get("Cookie"))
+	}
+
+	require.Equal(t, int64(4), requests[1].ContentLength)
+	require.Equal(t, int64(-1), requests[2].ContentLength)
+	require.Equal(t, []string{"chunked"}, requests[2].TransferEncoding)
+}
+
+func TestConfigLowSpeed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 10)) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw = decodeConfig(t, "[http]\n\tlowSpeedLimit = 100\n\tlowSpeedTime = 1\n")
+	require.NoError(t, st.SetConfig(cfg))
+
+	ep, err := transport.NewEndpoint(server.URL + "/repo.git")
+	require.NoError(t, err)
+	session, err := NewTransport(nil).NewSession(st, ep, nil)
+	require.NoError(t, err)
+
+	r := newRequester(context.Background(), session.(*HTTPSession), transport.UploadPackService)
+	require.NoError(t, r.Close())
+	defer r.BodyCloser().Close() //nolint:errcheck
+
+	start := time.Now()
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrLowSpeed)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
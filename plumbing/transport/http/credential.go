@@ -0,0 +1,78 @@
+package http
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/credential"
+)
+
+// fillCredential asks the credential helpers configured for the endpoint for
+// a username and password, once the server required an authentication. It
+// reports whether they have been found, and set as the auth of the session.
+// The helpers are only asked once, and never when the auth of the session
+// isn't a basic auth missing its password.
+func (s *HTTPSession) fillCredential(ctx context.Context) bool {
+	if s.cred != nil {
+		return false
+	}
+
+	var username string
+	switch a := s.auth.(type) {
+	case nil:
+	case *BasicAuth:
+		if a != nil {
+			if a.Password != "" {
+				return false
+			}
+
+			username = a.Username
+		}
+	default:
+		return false
+	}
+
+	u, err := url.Parse(s.ep.String())
+	if err != nil {
+		return false
+	}
+
+	m, err := credential.NewManagerFromConfig(u, s.cfgs...)
+	if err != nil || len(m.Helpers) == 0 {
+		return false
+	}
+
+	query := credential.FromURL(u)
+	query.Username = username
+	query.Password = ""
+	cred, err := m.Fill(ctx, query)
+	if err != nil {
+		return false
+	}
+
+	s.creds = m
+	s.cred = cred
+	s.auth = &BasicAuth{Username: cred.Username, Password: cred.Password}
+	return true
+}
+
+// checkCredential approves the credential filled by the helpers if the
+// request succeeded, or rejects it if the server still required an
+// authentication.
+func (s *HTTPSession) checkCredential(ctx context.Context, err error) {
+	if s.creds == nil {
+		return
+	}
+
+	switch err {
+	case nil:
+		s.creds.Approve(ctx, s.cred) //nolint:errcheck
+	case transport.ErrAuthenticationRequired:
+		s.creds.Reject(ctx, s.cred) //nolint:errcheck
+	default:
+		return
+	}
+
+	s.creds = nil
+}
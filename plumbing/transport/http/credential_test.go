@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialHelper(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		password string
+		auth     transport.AuthMethod
+		err      error
+		stored   bool
+	}{
+		{name: "valid", password: "secret", stored: true},
+		{name: "username", password: "secret", auth: &BasicAuth{Username: "user"}, stored: true},
+		{name: "invalid", password: "wrong", err: transport.ErrAuthenticationRequired},
+		{name: "explicit", password: "secret", auth: &BasicAuth{Username: "user", Password: "wrong"}, err: transport.ErrAuthenticationRequired, stored: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+			base := t.TempDir()
+			prepareDumbRepository(t, base, "basic.git")
+			port := startDumbServer(t, base, func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+
+					h.ServeHTTP(w, r)
+				})
+			})
+
+			file := filepath.Join(t.TempDir(), "credentials")
+			stored := fmt.Sprintf("http://user:%s@localhost:%d\n", tc.password, port)
+			require.NoError(t, os.WriteFile(file, []byte(stored), 0o600))
+
+			st := memory.NewStorage()
+			cfg, err := st.Config()
+			require.NoError(t, err)
+			cfg.Raw.Section("credential").AddOption("helper", "store --file="+file)
+			require.NoError(t, st.SetConfig(cfg))
+
+			client := NewTransport(&TransportOptions{UseDumb: true})
+			sess, err := client.NewSession(st, newEndpoint(t, port, "basic.git"), tc.auth)
+			require.NoError(t, err)
+
+			conn, err := sess.Handshake(context.Background(), transport.UploadPackService)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+				require.NoError(t, conn.Close())
+			}
+
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			if tc.stored {
+				require.Equal(t, stored, string(data))
+			} else {
+				require.Empty(t, data)
+			}
+		})
+	}
+}
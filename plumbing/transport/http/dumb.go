@@ -2,32 +2,58 @@ package http
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"io/fs"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
-	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/go-git/go-billy/v6"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/format/objfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	gogithash "github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
+const (
+	// dumbMaxRequests is the maximum number of files downloaded at the same
+	// time by the dumb protocol, like the default http.maxRequests of git.
+	dumbMaxRequests = 5
+	// dumbMaxRetries is the number of times an interrupted pack download is
+	// resumed before giving up.
+	dumbMaxRetries = 3
+)
+
+// ErrInvalidChecksum is returned by the dumb protocol when a downloaded file
+// doesn't match its checksum.
+var ErrInvalidChecksum = errors.New("invalid checksum")
+
+// errDownloadInterrupted is returned when the body of a response can't be
+// read completely, so the download can be resumed.
+var errDownloadInterrupted = errors.New("download interrupted")
+
 func (s *HTTPSession) fetchDumb(ctx context.Context, req *transport.FetchRequest) error {
 	if req.Depth != 0 {
 		return errors.New("dumb http protocol does not support shallow capabilities")
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	fsi, ok := s.st.(interface {
 		Filesystem() billy.Filesystem
 	})
@@ -37,7 +63,7 @@ func (s *HTTPSession) fetchDumb(ctx context.Context, req *transport.FetchRequest
 
 	repoFs := fsi.Filesystem()
 	r := newFetchWalker(s, ctx, repoFs)
-	if err := r.process(); err != nil {
+	if err := r.process(req.Wants); err != nil {
 		return err
 	}
 
@@ -51,10 +77,39 @@ func (s *HTTPSession) fetchDumb(ctx context.Context, req *transport.FetchRequest
 // fetchWalker implements the Dumb protocol for fetching objects.
 type fetchWalker struct {
 	*HTTPSession
-	ctx     context.Context
-	fs      billy.Filesystem
-	queue   []plumbing.Hash
-	packIdx map[plumbing.Hash]string
+	ctx   context.Context
+	fs    billy.Filesystem
+	queue []plumbing.Hash
+	// bases holds the object directories the objects are fetched from, the
+	// one of the repository followed by its alternates, once needed.
+	bases      []*objectsBase
+	alternates bool
+	// installed holds the packs installed during the fetch, whose objects
+	// are walked even if they are now available locally.
+	installed []*dumbPack
+	walked    map[plumbing.Hash]bool
+}
+
+// objectsBase is a remote object directory.
+type objectsBase struct {
+	url string
+	// auth is only set for the object directories in the same host as the
+	// repository, so credentials aren't sent to other hosts.
+	auth AuthMethod
+	// packs holds the packs of the directory not available locally, once
+	// indexed is true.
+	packs   []*dumbPack
+	indexed bool
+}
+
+// dumbPack is a remote packfile, whose index has been downloaded.
+type dumbPack struct {
+	base *objectsBase
+	hash plumbing.Hash
+	idx  *idxfile.MemoryIndex
+	// waiting holds the objects to walk once the pack is installed. The pack
+	// is being downloaded once it's not empty.
+	waiting []plumbing.Hash
 }
 
 func newFetchWalker(s *HTTPSession, ctx context.Context, fs billy.Filesystem) *fetchWalker {
@@ -63,103 +118,303 @@ func newFetchWalker(s *HTTPSession, ctx context.Context, fs billy.Filesystem) *f
 	walker.ctx = ctx
 	walker.fs = fs
 	walker.queue = make([]plumbing.Hash, 0)
-	walker.packIdx = make(map[plumbing.Hash]string)
+	walker.walked = make(map[plumbing.Hash]bool)
 	return walker
 }
 
-func (r *fetchWalker) getInfoPacks() ([]string, error) {
-	url, err := url.JoinPath(r.ep.String(), "objects", "info", "packs")
+// newRequest returns a GET request for the given URL.
+func (r *fetchWalker) newRequest(url string, auth AuthMethod) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
+
+	applyHeaders(req, "", r.ep, auth, "", false)
+	return req, nil
+}
+
+// getInfoFile returns the lines of a file in the info directory of the given
+// object directory, or nil if it doesn't exist.
+func (r *fetchWalker) getInfoFile(b *objectsBase, name string) ([]string, error) {
+	url, err := url.JoinPath(b.url, "info", name)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := r.newRequest(url, b.auth)
 	if err != nil {
 		return nil, err
 	}
 
-	applyHeaders(req, "", r.ep, r.auth, "", false)
 	res, err := doRequest(r.client, req)
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	defer res.Body.Close()
-	switch res.StatusCode {
-	case http.StatusOK:
-		// continue
-	case http.StatusNotFound:
-		return nil, transport.ErrRepositoryNotFound
-	default:
-		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
-	}
 
-	var packs []string
+	lines := make([]string, 0)
 	s := bufio.NewScanner(res.Body)
 	for s.Scan() {
-		line := s.Text()
-		hash := strings.TrimPrefix(line, "P pack-")
-		hash = strings.TrimSuffix(hash, ".pack")
-		packs = append(packs, hash)
+		lines = append(lines, s.Text())
 	}
 
-	return packs, s.Err()
+	return lines, s.Err()
 }
 
-// downloadFile downloads a file from the server and saves it to the filesystem.
-func (r *fetchWalker) downloadFile(fp string) (rErr error) {
-	url, err := url.JoinPath(r.ep.String(), fp)
+// getInfoPacks returns the packs listed in the objects/info/packs file of the
+// given object directory.
+func (r *fetchWalker) getInfoPacks(b *objectsBase) ([]plumbing.Hash, error) {
+	lines, err := r.getInfoFile(b, "packs")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
+
+	var packs []plumbing.Hash
+	for _, line := range lines {
+		name, ok := strings.CutPrefix(line, "P pack-")
+		if !ok {
+			continue
+		}
+
+		h, ok := plumbing.FromHex(strings.TrimSuffix(name, ".pack"))
+		if !ok || h.IsZero() {
+			continue
+		}
+
+		packs = append(packs, h)
+	}
+
+	return packs, nil
+}
+
+// loadIndices downloads the indices of the packs of the given object
+// directory not available locally.
+func (r *fetchWalker) loadIndices(b *objectsBase) error {
+	b.indexed = true
+	hashes, err := r.getInfoPacks(b)
 	if err != nil {
 		return err
 	}
 
-	applyHeaders(req, "", r.ep, r.auth, "", false)
+	packs := make([]*dumbPack, 0, len(hashes))
+	for _, h := range hashes {
+		idx := path.Join("objects", "pack", fmt.Sprintf("pack-%s.idx", h))
+		if _, err := r.fs.Stat(idx); err == nil {
+			continue
+		}
+
+		packs = append(packs, &dumbPack{base: b, hash: h})
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dumbMaxRequests)
+	errs := make([]error, len(packs))
+	for i, p := range packs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			p.idx, errs[i] = r.getIndex(p)
+		}()
+	}
+
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	b.packs = packs
+	return nil
+}
+
+// getIndex downloads and verifies the index of the given pack.
+func (r *fetchWalker) getIndex(p *dumbPack) (*idxfile.MemoryIndex, error) {
+	url, err := url.JoinPath(p.base.url, "pack", fmt.Sprintf("pack-%s.idx", p.hash))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := r.newRequest(url, p.base.auth)
+	if err != nil {
+		return nil, err
+	}
+
 	res, err := doRequest(r.client, req)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error downloading index of pack %s: %w", p.hash, err)
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	defer res.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := ioutil.CopyBufferPool(&buf, res.Body); err != nil {
+		return nil, err
 	}
 
-	copy := func(w io.Writer) error {
-		if _, err := ioutil.CopyBufferPool(w, res.Body); err != nil {
-			return err
-		}
+	if _, err := verifyChecksum(bytes.NewReader(buf.Bytes()), p.hash.Size()); err != nil {
+		return nil, fmt.Errorf("index of pack %s: %w", p.hash, err)
+	}
 
-		if err := res.Body.Close(); err != nil {
-			return err
+	idx := idxfile.NewMemoryIndex(p.hash.Size())
+	if err := idxfile.NewDecoder(&buf).Decode(idx); err != nil {
+		return nil, fmt.Errorf("error decoding index of pack %s: %w", p.hash, err)
+	}
+
+	return idx, nil
+}
+
+// downloadPack downloads the given pack to a temporary file, returning its
+// name once verified against the pack index. The download resumes from the
+// file left by a previous attempt, if any.
+func (r *fetchWalker) downloadPack(p *dumbPack) (string, error) {
+	name := fmt.Sprintf("pack-%s.pack", p.hash)
+	url, err := url.JoinPath(p.base.url, "pack", name)
+	if err != nil {
+		return "", err
+	}
+
+	tmp := path.Join("objects", "pack", name+".temp")
+	for attempt := 0; ; attempt++ {
+		err = r.resumeDownload(url, p.base.auth, tmp)
+		if err == nil {
+			break
 		}
 
-		if closer, ok := w.(io.Closer); ok {
-			return closer.Close()
+		if !errors.Is(err, errDownloadInterrupted) || attempt >= dumbMaxRetries || r.ctx.Err() != nil {
+			return "", err
 		}
+	}
 
-		return nil
+	f, err := r.fs.Open(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	sum, err := verifyChecksum(f, p.hash.Size())
+	_ = f.Close()
+	if err == nil && !sum.Equal(p.idx.PackfileChecksum) {
+		err = fmt.Errorf("%w: pack %s doesn't match its index", ErrInvalidChecksum, p.hash)
 	}
 
-	f, err := r.fs.TempFile(filepath.Dir(fp), filepath.Base(fp)+".temp")
 	if err != nil {
-		copy(io.Discard)
+		_ = r.fs.Remove(tmp)
+		return "", err
+	}
+
+	return tmp, nil
+}
+
+// resumeDownload downloads a file from the server to fp. If fp already
+// exists, only the rest of the file is requested, using a Range request.
+func (r *fetchWalker) resumeDownload(url string, auth AuthMethod, fp string) (err error) {
+	f, err := r.fs.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
 		return err
 	}
 
-	defer func() {
-		if err := f.Close(); err != nil {
-			rErr = err
+	defer ioutil.CheckClose(f, &err)
+
+	fi, err := r.fs.Stat(fp)
+	if err != nil {
+		return err
+	}
+
+	req, err := r.newRequest(url, auth)
+	if err != nil {
+		return err
+	}
+
+	offset := fi.Size()
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := doRequest(r.client, req)
+	if err != nil {
+		if res == nil {
+			return err
+		}
+
+		res.Body.Close() //nolint:errcheck
+		if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			// The file was already completely downloaded, its checksum is
+			// verified by the caller.
+			return nil
 		}
-	}()
 
-	if err := copy(f); err != nil {
 		return err
 	}
 
-	// TODO: support hardlinks and "core.createobject" configuration
-	return r.fs.Rename(f.Name(), fp)
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("unexpected content range: %q", res.Header.Get("Content-Range"))
+		}
+	default:
+		// The server sent the whole file.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ioutil.CopyBufferPool(f, res.Body); err != nil {
+		return fmt.Errorf("%w: %w", errDownloadInterrupted, err)
+	}
+
+	return nil
+}
+
+// checksumWriter hashes the data written to it, except its trailing
+// checksum, which is kept in sum.
+type checksumWriter struct {
+	hash hash.Hash
+	sum  []byte
+	size int
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.sum = append(w.sum, p...)
+	if extra := len(w.sum) - w.size; extra > 0 {
+		w.hash.Write(w.sum[:extra])
+		w.sum = append(w.sum[:0], w.sum[extra:]...)
+	}
+
+	return len(p), nil
+}
+
+// verifyChecksum verifies the content read from r against its trailing
+// checksum of the given size, like the one of pack and index files, and
+// returns it.
+func verifyChecksum(r io.Reader, size int) (plumbing.Hash, error) {
+	f := format.SHA1
+	if size == format.SHA256Size {
+		f = format.SHA256
+	}
+
+	h, err := gogithash.FromObjectFormat(f)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	w := &checksumWriter{hash: h, size: size}
+	if _, err := ioutil.CopyBufferPool(w, r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(w.sum) != size || !bytes.Equal(h.Sum(nil), w.sum) {
+		return plumbing.ZeroHash, ErrInvalidChecksum
+	}
+
+	sum, _ := plumbing.FromBytes(w.sum)
+	return sum, nil
 }
 
 // getHead returns the HEAD reference from the server.
@@ -215,8 +470,9 @@ func (r *fetchWalker) getHead() (ref *plumbing.Reference, err error) {
 	return plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash(line)), nil
 }
 
-// process calculates the objects to fetch and downloads them.
-func (r *fetchWalker) process() error {
+// process calculates the objects to fetch, starting from the wanted ones or,
+// if none, from HEAD and the advertised references.
+func (r *fetchWalker) process(wants []plumbing.Hash) error {
 	var head plumbing.Hash
 	if r.refs.Head == nil {
 		hash, err := r.getHead()
@@ -245,31 +501,16 @@ func (r *fetchWalker) process() error {
 		return transport.ErrRepositoryNotFound
 	}
 
-	infoPacks, err := r.getInfoPacks()
+	objects, err := url.JoinPath(r.ep.String(), "objects")
 	if err != nil {
 		return err
 	}
 
-	for _, hash := range infoPacks {
-		h := plumbing.NewHash(hash)
-		if h.IsZero() {
-			continue
-		}
+	r.bases = append(r.bases, &objectsBase{url: objects, auth: r.auth})
 
-		// XXX: we need to check if the index file exists. Currently, there is
-		// no way to do so using the storer interfaces except useing
-		// HasEncodedObject which might be an expensive operation.
-		packIdx := path.Join("objects", "pack", fmt.Sprintf("pack-%s.idx", hash))
-		if _, err := r.fs.Stat(packIdx); errors.Is(err, fs.ErrExist) {
-			r.packIdx[h] = packIdx
-		} else {
-			if err := r.downloadFile(packIdx); err != nil {
-				return err
-			}
-
-			// TODO: parse and checksum the index file
-			r.packIdx[h] = packIdx
-		}
+	if len(wants) > 0 {
+		r.queue = append(r.queue, wants...)
+		return nil
 	}
 
 	r.queue = append(r.queue, head)
@@ -283,193 +524,349 @@ func (r *fetchWalker) process() error {
 		}
 	}
 
-	r.queue = append(r.queue, head)
-
 	return nil
 }
 
-func (r *fetchWalker) fetchObject(hash plumbing.Hash, obj plumbing.EncodedObject) (err error) {
-	if r.st.HasEncodedObject(hash) == nil {
+// loadAlternates adds the alternates of the repository to the object
+// directories, listed in objects/info/http-alternates or, if missing,
+// objects/info/alternates. Like git, the alternates of the alternates are not
+// followed.
+func (r *fetchWalker) loadAlternates() error {
+	r.alternates = true
+	repo := r.bases[0]
+	for _, name := range []string{"http-alternates", "alternates"} {
+		lines, err := r.getInfoFile(repo, name)
+		if err != nil {
+			return err
+		}
+
+		if lines == nil {
+			continue
+		}
+
+		for _, line := range lines {
+			b, ok := newAlternate(repo, line, name == "http-alternates")
+			if ok && !r.hasBase(b.url) {
+				r.bases = append(r.bases, b)
+			}
+		}
+
 		return nil
 	}
 
+	return nil
+}
+
+func (r *fetchWalker) hasBase(url string) bool {
+	for _, b := range r.bases {
+		if b.url == url {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newAlternate returns the object directory of an alternates line, relative
+// to the object directory of the repository. Absolute URLs are only allowed
+// in http-alternates.
+func newAlternate(repo *objectsBase, line string, allowURL bool) (*objectsBase, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, false
+	}
+
+	ref, err := url.Parse(line)
+	if err != nil {
+		return nil, false
+	}
+
+	if ref.Scheme != "" && (!allowURL || ref.Scheme != "http" && ref.Scheme != "https") {
+		return nil, false
+	}
+
+	base, err := url.Parse(repo.url + "/")
+	if err != nil {
+		return nil, false
+	}
+
+	u := base.ResolveReference(ref)
+	b := &objectsBase{url: strings.TrimSuffix(u.String(), "/")}
+	if u.Host == base.Host {
+		b.auth = repo.auth
+	}
+
+	return b, true
+}
+
+// fetchObject fetches a loose object from the given object directory,
+// returning plumbing.ErrObjectNotFound if it doesn't exist.
+func (r *fetchWalker) fetchObject(b *objectsBase, hash plumbing.Hash) (obj plumbing.EncodedObject, err error) {
 	h := hash.String()
-	url, err := url.JoinPath(r.ep.String(), "objects", h[:2], h[2:])
+	url, err := url.JoinPath(b.url, h[:2], h[2:])
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
+
+	req, err := r.newRequest(url, b.auth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	applyHeaders(req, "", r.ep, r.auth, "", false)
 	res, err := doRequest(r.client, req)
 	if errors.Is(err, transport.ErrRepositoryNotFound) {
-		// TODO: better error handling
-		return io.EOF
+		return nil, plumbing.ErrObjectNotFound
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer res.Body.Close()
-	switch res.StatusCode {
-	case http.StatusOK:
-	case http.StatusNotFound:
-		return io.EOF
-	default:
-		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
-	}
 
 	rd, err := objfile.NewReader(res.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	ioutil.CheckClose(rd, &err)
+	defer ioutil.CheckClose(rd, &err)
 
 	t, size, err := rd.Header()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	obj = r.st.NewEncodedObject()
 	obj.SetType(t)
 	obj.SetSize(size)
 
 	w, err := obj.Writer()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	ioutil.CheckClose(w, &err)
-
 	if _, err := ioutil.CopyBufferPool(w, rd); err != nil {
-		return err
+		_ = w.Close()
+		return nil, err
 	}
 
-	return nil
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if obj.Hash() != hash {
+		return nil, fmt.Errorf("%w: object %s", ErrInvalidChecksum, hash)
+	}
+
+	return obj, nil
 }
 
-func (r *fetchWalker) fetch() error {
-	packs := map[string]struct{}{}
-	processed := map[string]struct{}{}
-	indicies := []*idxfile.MemoryIndex{}
+// fetchMissing fetches an object from the first object directory having it,
+// including the alternates once the repository doesn't. It returns the pack
+// having the object, or nil if it was fetched as a loose object.
+func (r *fetchWalker) fetchMissing(h plumbing.Hash) (*dumbPack, error) {
+	for i := 0; i < len(r.bases); i++ {
+		b := r.bases[i]
+		if !b.indexed {
+			if err := r.loadIndices(b); err != nil {
+				return nil, err
+			}
+		}
 
-LOOP:
-	for len(r.queue) > 0 {
-		objHash := r.queue[0]
-		r.queue = r.queue[1:]
-		if _, ok := processed[objHash.String()]; ok {
-			continue
+		for _, p := range b.packs {
+			if ok, err := p.idx.Contains(h); err == nil && ok {
+				return p, nil
+			}
 		}
 
-		for _, idx := range indicies {
-			if ok, err := idx.Contains(objHash); err == nil && ok {
-				continue LOOP
+		obj, err := r.fetchObject(b, h)
+		switch {
+		case err == nil:
+			r.walked[h] = true
+			if err := r.walk(obj); err != nil {
+				return nil, err
 			}
+
+			_, err := r.st.SetEncodedObject(obj)
+			return nil, err
+		case !errors.Is(err, plumbing.ErrObjectNotFound):
+			return nil, err
 		}
 
-		obj := r.st.NewEncodedObject()
-		err := r.fetchObject(objHash, obj)
-		if errors.Is(err, io.EOF) {
-			// TODO: support http-alternates
-			for packHash, packIdxPath := range r.packIdx {
-				idxFile, err := r.fs.Open(packIdxPath)
-				if err != nil {
-					return fmt.Errorf("error opening index file: %w", err)
-				}
+		if i == len(r.bases)-1 && !r.alternates {
+			if err := r.loadAlternates(); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-				idx := idxfile.NewMemoryIndex(packHash.Size())
-				d := idxfile.NewDecoder(idxFile)
-				if err := d.Decode(idx); err != nil {
-					_ = idxFile.Close()
-					return fmt.Errorf("error decoding index file: %w", err)
-				}
+	return nil, fmt.Errorf("%w: %s", plumbing.ErrObjectNotFound, h)
+}
 
-				indicies = append(indicies, idx)
-				packPath := path.Join("objects", "pack", fmt.Sprintf("pack-%s.pack", packHash.String()))
-				if ok, err := idx.Contains(objHash); err == nil && ok {
-					processed[objHash.String()] = struct{}{}
-					if _, ok := packs[packPath]; ok {
-						continue LOOP
-					}
-
-					if _, err := r.fs.Stat(packPath); errors.Is(err, fs.ErrExist) {
-						packs[packPath] = struct{}{}
-						continue LOOP
-					}
-
-					if err := r.downloadFile(packPath); err != nil {
-						return fmt.Errorf("error downloading pack file: %w", err)
-					}
-
-					packs[packPath] = struct{}{}
-					continue LOOP
-				}
+// walk queues the objects referenced by the given object.
+func (r *fetchWalker) walk(obj plumbing.EncodedObject) error {
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		commit, err := object.DecodeCommit(r.st, obj)
+		if err != nil {
+			return err
+		}
+
+		r.queue = append(r.queue, commit.ParentHashes...)
+		r.queue = append(r.queue, commit.TreeHash)
+	case plumbing.TreeObject:
+		tree, err := object.DecodeTree(r.st, obj)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range tree.Entries {
+			if e.Mode == filemode.Submodule {
+				continue
 			}
-		} else if err != nil {
+
+			r.queue = append(r.queue, e.Hash)
+		}
+	case plumbing.TagObject:
+		tag, err := object.DecodeTag(r.st, obj)
+		if err != nil {
 			return err
 		}
 
-		switch obj.Type() {
-		case plumbing.CommitObject:
-			commit, err := object.DecodeCommit(r.st, obj)
-			if err != nil {
-				return err
+		r.queue = append(r.queue, tag.Target)
+	case plumbing.BlobObject:
+	default:
+		return plumbing.ErrInvalidType
+	}
+
+	return nil
+}
+
+// isInstalled reports whether the object is in a pack installed during the
+// fetch.
+func (r *fetchWalker) isInstalled(h plumbing.Hash) bool {
+	for _, p := range r.installed {
+		if ok, err := p.idx.Contains(h); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// installPack adds the objects of the downloaded pack to the storage.
+func (r *fetchWalker) installPack(p *dumbPack, tmp string) error {
+	f, err := r.fs.Open(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := packfile.UpdateObjectStorage(r.st, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	r.installed = append(r.installed, p)
+	return r.fs.Remove(tmp)
+}
+
+// packDownload is the result of a pack download.
+type packDownload struct {
+	pack *dumbPack
+	tmp  string
+	err  error
+}
+
+// fetch walks the objects reachable from the queue, fetching the missing
+// ones. The packs having missing objects are downloaded concurrently while
+// the walk goes on, and the objects waiting for them are walked once they
+// are installed.
+func (r *fetchWalker) fetch() error {
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.ctx = ctx
+
+	done := make(chan packDownload)
+	sem := make(chan struct{}, dumbMaxRequests)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var pending int
+	for len(r.queue) > 0 || pending > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if len(r.queue) == 0 {
+			d := <-done
+			pending--
+			if d.err != nil {
+				return fmt.Errorf("error downloading pack %s: %w", d.pack.hash, d.err)
 			}
 
-			r.queue = append(r.queue, commit.ParentHashes...)
-			r.queue = append(r.queue, commit.TreeHash)
-		case plumbing.TreeObject:
-			tree, err := object.DecodeTree(r.st, obj)
-			if err != nil {
-				return err
+			if err := r.installPack(d.pack, d.tmp); err != nil {
+				return fmt.Errorf("error installing pack %s: %w", d.pack.hash, err)
 			}
 
-			r.queue = append(r.queue, tree.Hash)
-			for _, e := range tree.Entries {
-				r.queue = append(r.queue, e.Hash)
+			r.queue = append(r.queue, d.pack.waiting...)
+			continue
+		}
+
+		h := r.queue[0]
+		r.queue = r.queue[1:]
+		if r.walked[h] {
+			continue
+		}
+
+		if r.st.HasEncodedObject(h) == nil {
+			r.walked[h] = true
+			if !r.isInstalled(h) {
+				continue
 			}
-		case plumbing.TagObject:
-			tag, err := object.DecodeTag(r.st, obj)
+
+			obj, err := r.st.EncodedObject(plumbing.AnyObject, h)
 			if err != nil {
 				return err
 			}
 
-			r.queue = append(r.queue, tag.Hash)
-			r.queue = append(r.queue, tag.Target)
-		case plumbing.BlobObject:
-			blob, err := object.DecodeBlob(obj)
-			if err != nil {
+			if err := r.walk(obj); err != nil {
 				return err
 			}
 
-			r.queue = append(r.queue, blob.Hash)
-		default:
-			return plumbing.ErrInvalidType
-		}
-
-		if _, err := r.st.SetEncodedObject(obj); err != nil {
-			return err
+			continue
 		}
-		processed[objHash.String()] = struct{}{}
-	}
 
-	for packPath := range packs {
-		f, err := r.fs.Open(packPath)
+		p, err := r.fetchMissing(h)
 		if err != nil {
 			return err
 		}
 
-		if err := packfile.UpdateObjectStorage(r.st, f); err != nil {
-			_ = f.Close()
-			return err
+		if p == nil {
+			continue
 		}
 
-		if err := f.Close(); err != nil {
-			return err
+		if len(p.waiting) == 0 {
+			pending++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				tmp, err := r.downloadPack(p)
+				select {
+				case done <- packDownload{pack: p, tmp: tmp, err: err}:
+				case <-ctx.Done():
+				}
+			}()
 		}
+
+		p.waiting = append(p.waiting, h)
 	}
 
 	return nil
@@ -1,14 +1,33 @@
 package http
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/go-git/go-git/v6/internal/trace"
 	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -62,3 +81,291 @@ func (*DumbSuite) TestUploadPackInvalidReq()                  {}
 func (*DumbSuite) TestUploadPackMulti()                       {}
 func (*DumbSuite) TestUploadPackNoChanges()                   {}
 func (*DumbSuite) TestUploadPackPartial()                     {}
+
+// TestUploadPackWithContext is overwritten, as the wanted objects are
+// available locally, so the fetch completes without any request unless the
+// context is already done.
+func (s *DumbSuite) TestUploadPackWithContext() {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	defer cancel()
+
+	r, err := s.Client.NewSession(s.Storer, s.Endpoint, s.EmptyAuth)
+	s.Require().NoError(err)
+	conn, err := r.Handshake(context.TODO(), transport.UploadPackService)
+	s.Require().NoError(err)
+	defer func() { s.Require().Nil(conn.Close()) }()
+
+	req := &transport.FetchRequest{}
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+
+	<-ctx.Done()
+	err = conn.Fetch(ctx, req)
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+}
+
+// startDumbServer serves the files in base, through the optional middleware.
+func startDumbServer(t testing.TB, base string, middleware func(http.Handler) http.Handler) int {
+	t.Helper()
+
+	l := test.ListenTCP(t)
+	var h http.Handler = http.FileServer(http.Dir(base))
+	if middleware != nil {
+		h = middleware(h)
+	}
+
+	server := &http.Server{Handler: h}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.ErrorIs(t, server.Serve(l), http.ErrServerClosed)
+	}()
+
+	t.Cleanup(func() {
+		require.NoError(t, server.Close())
+		<-done
+	})
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// prepareDumbRepository prepares the basic fixture at base/name, with a new
+// loose commit on top of master, returning it.
+func prepareDumbRepository(t testing.TB, base, name string) (billy.Filesystem, plumbing.Hash) {
+	t.Helper()
+
+	fs := test.PrepareRepository(t, fixtures.Basic().One(), base, name)
+	st := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	master, err := st.Reference(plumbing.Master)
+	require.NoError(t, err)
+	parent, err := object.GetCommit(st, master.Hash())
+	require.NoError(t, err)
+
+	commit := &object.Commit{
+		Author:       parent.Author,
+		Committer:    parent.Committer,
+		Message:      "loose commit",
+		TreeHash:     parent.TreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+
+	obj := st.NewEncodedObject()
+	require.NoError(t, commit.Encode(obj))
+	h, err := st.SetEncodedObject(obj)
+	require.NoError(t, err)
+
+	require.NoError(t, st.SetReference(plumbing.NewHashReference(plumbing.Master, h)))
+	require.NoError(t, transport.UpdateServerInfo(st, fs))
+
+	return fs, h
+}
+
+// dumbFetch fetches the wanted object from the repository at ep into a new
+// repository, returning its storage.
+func dumbFetch(t testing.TB, ep *transport.Endpoint, want plumbing.Hash) (*filesystem.Storage, error) {
+	t.Helper()
+
+	fs := osfs.New(t.TempDir())
+	st := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	client := NewTransport(&TransportOptions{UseDumb: true})
+	sess, err := client.NewSession(st, ep, nil)
+	require.NoError(t, err)
+
+	conn, err := sess.Handshake(context.Background(), transport.UploadPackService)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	return st, conn.Fetch(context.Background(), &transport.FetchRequest{
+		Wants: []plumbing.Hash{want},
+	})
+}
+
+// requireObjects checks that all the objects reachable from h in the server
+// storage are in st, and no temporary pack is left.
+func requireObjects(t testing.TB, server storer.EncodedObjectStorer, st *filesystem.Storage, h plumbing.Hash) {
+	t.Helper()
+
+	objs, err := revlist.Objects(server, []plumbing.Hash{h}, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, objs)
+
+	for _, h := range objs {
+		require.NoError(t, st.HasEncodedObject(h), h.String())
+	}
+
+	temps, err := util.Glob(st.Filesystem(), "objects/pack/*.temp")
+	require.NoError(t, err)
+	require.Empty(t, temps)
+}
+
+func TestDumbFetch(t *testing.T) {
+	base := t.TempDir()
+	fs, head := prepareDumbRepository(t, base, "basic.git")
+	port := startDumbServer(t, base, nil)
+
+	st, err := dumbFetch(t, newEndpoint(t, port, "basic.git"), head)
+	require.NoError(t, err)
+	requireObjects(t, filesystem.NewStorage(fs, nil), st, head)
+
+	_, err = dumbFetch(t, newEndpoint(t, port, "basic.git"), plumbing.NewHash("1111111111111111111111111111111111111111"))
+	require.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+}
+
+func TestDumbFetchAlternates(t *testing.T) {
+	for _, tc := range []struct {
+		file, alternate string
+	}{
+		{"http-alternates", "../../basic.git/objects"},
+		{"http-alternates", "/basic.git/objects"},
+		{"alternates", "../../basic.git/objects"},
+	} {
+		t.Run(tc.file+" "+tc.alternate, func(t *testing.T) {
+			base := t.TempDir()
+			fs, head := prepareDumbRepository(t, base, "basic.git")
+			port := startDumbServer(t, base, nil)
+
+			// The repository has no objects, they are all in the alternate.
+			alt := filepath.Join(base, "alt.git")
+			for _, name := range []string{"HEAD", "info/refs"} {
+				data, err := util.ReadFile(fs, name)
+				require.NoError(t, err)
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(alt, name)), 0o755))
+				require.NoError(t, os.WriteFile(filepath.Join(alt, name), data, 0o644))
+			}
+
+			info := filepath.Join(alt, "objects", "info")
+			require.NoError(t, os.MkdirAll(info, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(info, tc.file), []byte(tc.alternate+"\n"), 0o644))
+
+			st, err := dumbFetch(t, newEndpoint(t, port, "alt.git"), head)
+			require.NoError(t, err)
+			requireObjects(t, filesystem.NewStorage(fs, nil), st, head)
+		})
+	}
+}
+
+func TestDumbFetchResume(t *testing.T) {
+	base := t.TempDir()
+	fs, head := prepareDumbRepository(t, base, "basic.git")
+
+	var mu sync.Mutex
+	var ranges []string
+	port := startDumbServer(t, base, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, ".pack") {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			first := len(ranges) == 1
+			mu.Unlock()
+
+			if first {
+				// Interrupt the first download halfway.
+				h.ServeHTTP(&abortWriter{ResponseWriter: w, remaining: 1024}, r)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	st, err := dumbFetch(t, newEndpoint(t, port, "basic.git"), head)
+	require.NoError(t, err)
+	requireObjects(t, filesystem.NewStorage(fs, nil), st, head)
+
+	require.Len(t, ranges, 2)
+	require.Equal(t, "", ranges[0])
+	require.Equal(t, "bytes=1024-", ranges[1])
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// closeBody is a response body recording whether it's closed.
+type closeBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDumbResumeDownloadComplete(t *testing.T) {
+	ep, err := transport.NewEndpoint("http://example.com/basic.git")
+	require.NoError(t, err)
+
+	var ranges []string
+	body := &closeBody{Reader: strings.NewReader("")}
+	s := &HTTPSession{ep: ep, client: &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			ranges = append(ranges, req.Header.Get("Range"))
+			return &http.Response{
+				StatusCode: http.StatusRequestedRangeNotSatisfiable,
+				Header:     make(http.Header),
+				Body:       body,
+				Request:    req,
+			}, nil
+		}),
+	}}
+
+	fs := memfs.New()
+	require.NoError(t, util.WriteFile(fs, "pack.temp", []byte("PACK"), 0o644))
+
+	// The file was already downloaded, the response is closed.
+	r := newFetchWalker(s, context.Background(), fs)
+	require.NoError(t, r.resumeDownload(ep.String()+"/objects/pack/pack.pack", nil, "pack.temp"))
+	require.Equal(t, []string{"bytes=4-"}, ranges)
+	require.True(t, body.closed)
+}
+
+func TestDumbFetchInvalidChecksum(t *testing.T) {
+	base := t.TempDir()
+	fs, head := prepareDumbRepository(t, base, "basic.git")
+	port := startDumbServer(t, base, nil)
+
+	packs, err := util.Glob(fs, "objects/pack/*.pack")
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+
+	data, err := util.ReadFile(fs, packs[0])
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, util.WriteFile(fs, packs[0], data, 0o644))
+
+	st, err := dumbFetch(t, newEndpoint(t, port, "basic.git"), head)
+	require.ErrorIs(t, err, ErrInvalidChecksum)
+
+	temps, err := util.Glob(st.Filesystem(), "objects/pack/*.temp")
+	require.NoError(t, err)
+	require.Empty(t, temps)
+}
+
+// abortWriter aborts the response once the given number of bytes of the body
+// are written.
+type abortWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (w *abortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.remaining {
+		n, _ := w.ResponseWriter.Write(p[:w.remaining])
+		w.remaining -= n
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.remaining -= n
+	return n, err
+}
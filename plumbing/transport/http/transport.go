@@ -1,16 +1,29 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrLowSpeed is returned when a request transfers less than http.lowSpeedLimit
+// bytes per second during http.lowSpeedTime.
+var ErrLowSpeed = errors.New("transfer too slow")
+
 // transportOptions contains transport specific configuration.
 type transportOptions struct {
 	insecureSkipTLS bool
 	// []byte is not comparable.
 	caBundle string
 	proxyURL url.URL
+	// The files of the client certificate and its key.
+	clientCert, clientKey string
 }
 
 func (c *client) addTransport(opts transportOptions, transport *http.Transport) {
@@ -38,3 +51,138 @@ func (c *client) fetchTransport(opts transportOptions) (*http.Transport, bool) {
 	}
 	return transport, true
 }
+
+// configTransport applies the options of a Config holding per request
+// settings to the requests of the underlying round tripper.
+type configTransport struct {
+	base   http.RoundTripper
+	config *Config
+}
+
+func newConfigTransport(base http.RoundTripper, config *Config) http.RoundTripper {
+	if len(config.ExtraHeaders) == 0 && config.UserAgent == "" &&
+		(config.LowSpeedLimit <= 0 || config.LowSpeedTime <= 0) {
+		return base
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &configTransport{base: base, config: config}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *configTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.config.ExtraHeaders {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	if t.config.UserAgent != "" {
+		req.Header.Set("User-Agent", t.config.UserAgent)
+	}
+
+	if t.config.LowSpeedLimit <= 0 || t.config.LowSpeedTime <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	m := newSpeedMonitor(int64(t.config.LowSpeedLimit), t.config.LowSpeedTime, cancel)
+	req = req.WithContext(ctx)
+	if req.Body != nil {
+		req.Body = &monitoredBody{ReadCloser: req.Body, m: m, request: true}
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		m.stop()
+		if m.slow.Load() {
+			return nil, fmt.Errorf("%w: %w", ErrLowSpeed, err)
+		}
+
+		return nil, err
+	}
+
+	res.Body = &monitoredBody{ReadCloser: res.Body, m: m}
+	return res, nil
+}
+
+// speedMonitor cancels a request transferring less than limit bytes per
+// second during a window of time, like the low speed options of curl.
+type speedMonitor struct {
+	limit  int64
+	window time.Duration
+	cancel context.CancelFunc
+
+	n    atomic.Int64
+	slow atomic.Bool
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+func newSpeedMonitor(limit int64, window time.Duration, cancel context.CancelFunc) *speedMonitor {
+	m := &speedMonitor{limit: limit, window: window, cancel: cancel}
+	m.mu.Lock()
+	m.timer = time.AfterFunc(window, m.check)
+	m.mu.Unlock()
+	return m
+}
+
+func (m *speedMonitor) check() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return
+	}
+
+	if m.n.Swap(0) < m.limit*int64(m.window/time.Second) {
+		m.slow.Store(true)
+		m.stopped = true
+		m.cancel()
+		return
+	}
+
+	m.timer.Reset(m.window)
+}
+
+func (m *speedMonitor) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.stopped {
+		m.stopped = true
+		m.timer.Stop()
+		m.cancel()
+	}
+}
+
+// monitoredBody counts the bytes read from a body. The monitor is stopped
+// when the body of the response is closed.
+type monitoredBody struct {
+	io.ReadCloser
+	m       *speedMonitor
+	request bool
+}
+
+func (b *monitoredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.m.n.Add(int64(n))
+	if err != nil && err != io.EOF && b.m.slow.Load() {
+		err = fmt.Errorf("%w: %w", ErrLowSpeed, err)
+	}
+
+	return n, err
+}
+
+func (b *monitoredBody) Close() error {
+	err := b.ReadCloser.Close()
+	if !b.request {
+		b.m.stop()
+	}
+
+	return err
+}
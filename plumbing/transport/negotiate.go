@@ -66,6 +66,12 @@ func NegotiatePack(
 		upreq.Capabilities.Set(capability.Agent, capability.DefaultAgent()) // nolint: errcheck
 	}
 
+	// The object format of the repository matches the one of the server,
+	// as checked by the caller.
+	if f := caps.Get(capability.ObjectFormat); len(f) == 1 {
+		upreq.Capabilities.Set(capability.ObjectFormat, f[0]) // nolint: errcheck
+	}
+
 	if req.IncludeTags && caps.Supports(capability.IncludeTag) {
 		upreq.Capabilities.Set(capability.IncludeTag) // nolint: errcheck
 	}
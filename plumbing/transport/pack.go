@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"strings"
 
@@ -124,6 +125,53 @@ func (p *PackSession) Handshake(ctx context.Context, service Service, params ...
 	return c, nil
 }
 
+var _ Archiver = &PackSession{}
+
+// Archive implements Archiver.
+func (p *PackSession) Archive(ctx context.Context, req *ArchiveRequest) (rc io.ReadCloser, err error) {
+	cmd, err := p.cmdr.Command(ctx, UploadArchiveService.String(), p.ep, p.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var stderrBuf bytes.Buffer
+	if stderr != nil {
+		go ioutil.CopyBufferPool(&stderrBuf, stderr) // nolint: errcheck
+	}
+
+	if err := cmd.Start(); err != nil {
+		_ = cmd.Close()
+		return nil, err
+	}
+
+	rc, err = RequestArchive(ctx, ioutil.NewReadCloser(stdout, cmd), stdin, req)
+	if err != nil {
+		_ = cmd.Close()
+		if s := strings.TrimSpace(stderrBuf.String()); s != "" && !errors.Is(err, ErrArchiveRejected) {
+			return nil, NewRemoteError(s)
+		}
+
+		return nil, err
+	}
+
+	return rc, nil
+}
+
 // packConnection is a convenience type that implements io.ReadWriteCloser.
 type packConnection struct {
 	st        storage.Storer
@@ -138,7 +186,10 @@ type packConnection struct {
 	refs    *packp.AdvRefs
 }
 
-var _ Connection = &packConnection{}
+var (
+	_ Connection   = &packConnection{}
+	_ StorerSetter = &packConnection{}
+)
 
 // stderr returns stderr of the command if it's not empty. This will always
 // return a RemoteError.
@@ -156,6 +207,11 @@ func (p *packConnection) Close() error {
 	return p.cmd.Close()
 }
 
+// SetStorer implements StorerSetter.
+func (p *packConnection) SetStorer(st storage.Storer) {
+	p.st = st
+}
+
 // Capabilities implements Connection.
 func (p *packConnection) Capabilities() *capability.List {
 	return p.caps
@@ -59,8 +59,14 @@ func buildUpdateRequests(caps *capability.List, req *PushRequest) *packp.UpdateR
 	if caps.Supports(capability.Agent) {
 		upreq.Capabilities.Set(capability.Agent, capability.DefaultAgent()) //nolint:errcheck
 	}
+	// The object format of the repository matches the one of the server, as
+	// checked by the caller.
+	if f := caps.Get(capability.ObjectFormat); len(f) == 1 {
+		upreq.Capabilities.Set(capability.ObjectFormat, f[0]) //nolint:errcheck
+	}
 
 	upreq.Commands = req.Commands
+	upreq.Certificate = req.Certificate
 
 	return upreq
 }
@@ -93,6 +99,13 @@ func SendPack(
 	}
 
 	caps := conn.Capabilities()
+	if req.Certificate != nil && !caps.Supports(capability.PushCert) {
+		return fmt.Errorf("server does not support push-cert")
+	}
+	if len(req.Options) > 0 && !caps.Supports(capability.PushOptions) {
+		return fmt.Errorf("server does not support push-options")
+	}
+
 	upreq := buildUpdateRequests(caps, req)
 	if err := upreq.Encode(writer); err != nil {
 		return err
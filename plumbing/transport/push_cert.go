@@ -0,0 +1,227 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+const (
+	receiveSection         = "receive"
+	certNonceSeedKey       = "certNonceSeed"
+	certNonceSlopKey       = "certNonceSlop"
+	pushCertSignatureBegin = "-----BEGIN "
+)
+
+// PushCertNonceStatus is the result of checking the nonce of a push
+// certificate against the one advertised by the server. The values match
+// the ones upstream exposes to hooks as GIT_PUSH_CERT_NONCE_STATUS.
+type PushCertNonceStatus string
+
+const (
+	// PushCertNonceUnsolicited means the client sent a nonce although the
+	// server did not ask for one.
+	PushCertNonceUnsolicited PushCertNonceStatus = "UNSOLICITED"
+	// PushCertNonceMissing means the server asked for a nonce but the
+	// certificate does not contain one.
+	PushCertNonceMissing PushCertNonceStatus = "MISSING"
+	// PushCertNonceBad means the certificate nonce was not generated by the
+	// server.
+	PushCertNonceBad PushCertNonceStatus = "BAD"
+	// PushCertNonceOK means the certificate nonce is the one the server
+	// advertised.
+	PushCertNonceOK PushCertNonceStatus = "OK"
+	// PushCertNonceSlop means the certificate nonce was generated by the
+	// server, but too long ago. This can only happen on stateless
+	// connections.
+	PushCertNonceSlop PushCertNonceStatus = "SLOP"
+)
+
+// PushCertSignatureStatus is the result of verifying the signature of a push
+// certificate. The values match the ones upstream exposes to hooks as
+// GIT_PUSH_CERT_STATUS.
+type PushCertSignatureStatus byte
+
+const (
+	// PushCertSignatureGood means the signature is valid.
+	PushCertSignatureGood PushCertSignatureStatus = 'G'
+	// PushCertSignatureBad means the signature is invalid.
+	PushCertSignatureBad PushCertSignatureStatus = 'B'
+	// PushCertSignatureUnchecked means the signature could not be checked,
+	// e.g. there is no verifier configured.
+	PushCertSignatureUnchecked PushCertSignatureStatus = 'E'
+	// PushCertSignatureNone means the certificate is not signed.
+	PushCertSignatureNone PushCertSignatureStatus = 'N'
+)
+
+// PushCertVerifier is an interface for verifying push certificate signatures.
+// message is a reader containing the certificate payload and signature is
+// the detached signature sent along with it.
+// Implementors should return the identity of the signer and the key that
+// made the signature, or an error if the signature is invalid.
+type PushCertVerifier interface {
+	Verify(message io.Reader, signature []byte) (signer string, key string, err error)
+}
+
+// PushCertStatus holds the verification result of a push certificate.
+type PushCertStatus struct {
+	// Certificate is the push certificate sent by the client.
+	Certificate *packp.PushCertificate
+	// Signer is the signer identity returned by the verifier.
+	Signer string
+	// Key is the signing key returned by the verifier.
+	Key string
+	// Signature is the signature verification status.
+	Signature PushCertSignatureStatus
+	// SignatureError is the error returned by the verifier, if any.
+	SignatureError error
+	// Nonce is the nonce the server generated for this request.
+	Nonce string
+	// NonceStatus is the nonce verification status.
+	NonceStatus PushCertNonceStatus
+	// NonceSlop is the difference between the time the certificate nonce
+	// and the server nonce were generated. It's only set on stateless
+	// connections.
+	NonceSlop time.Duration
+}
+
+// Verified returns true when the certificate signature is good and the
+// nonce is the one the server generated.
+func (s *PushCertStatus) Verified() bool {
+	return s.Signature == PushCertSignatureGood && s.NonceStatus == PushCertNonceOK
+}
+
+// pushCertConfig holds the receive.certNonce* configuration.
+type pushCertConfig struct {
+	seed string
+	slop time.Duration
+}
+
+func loadPushCertConfig(st storage.Storer) (*pushCertConfig, error) {
+	cfg, err := st.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	s := cfg.Raw.Section(receiveSection)
+	pc := &pushCertConfig{seed: s.Options.Get(certNonceSeedKey)}
+	if slop := s.Options.Get(certNonceSlopKey); slop != "" {
+		secs, err := strconv.ParseInt(slop, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s.%s: %w", receiveSection, certNonceSlopKey, err)
+		}
+		pc.slop = time.Duration(secs) * time.Second
+	}
+
+	return pc, nil
+}
+
+// nonce returns the nonce for the given timestamp, or an empty string when
+// no receive.certNonceSeed is configured.
+func (c *pushCertConfig) nonce(stamp int64) string {
+	if c == nil || c.seed == "" {
+		return ""
+	}
+
+	return generatePushCertNonce(c.seed, stamp)
+}
+
+// generatePushCertNonce returns a nonce in the same format upstream uses,
+// which is the timestamp followed by the HMAC-SHA1 of it, keyed with the
+// configured seed.
+func generatePushCertNonce(seed string, stamp int64) string {
+	mac := hmac.New(sha1.New, []byte(seed))
+	fmt.Fprintf(mac, "%d", stamp)
+	return fmt.Sprintf("%d-%s", stamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// checkPushCertNonce checks the nonce sent by the client against the one
+// generated by the server. Stateless connections can't match the nonce
+// exactly, since it was advertised in another request, so the nonce is
+// recomputed from its timestamp instead.
+func checkPushCertNonce(
+	c *pushCertConfig,
+	nonce, sent string,
+	stateless bool,
+) (PushCertNonceStatus, time.Duration) {
+	switch {
+	case nonce == "":
+		return PushCertNonceUnsolicited, 0
+	case sent == "":
+		return PushCertNonceMissing, 0
+	case sent == nonce:
+		return PushCertNonceOK, 0
+	case !stateless:
+		return PushCertNonceBad, 0
+	}
+
+	stamp, ok := parseNonceStamp(sent)
+	if !ok || c.nonce(stamp) != sent {
+		return PushCertNonceBad, 0
+	}
+
+	ours, _ := parseNonceStamp(nonce)
+	slop := time.Duration(ours-stamp) * time.Second
+	if c.slop > 0 && slop.Abs() <= c.slop {
+		return PushCertNonceOK, slop
+	}
+
+	return PushCertNonceSlop, slop
+}
+
+func parseNonceStamp(nonce string) (int64, bool) {
+	stamp, _, ok := strings.Cut(nonce, "-")
+	if !ok {
+		return 0, false
+	}
+
+	v, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// verifyPushCert verifies the given certificate signature and nonce.
+func verifyPushCert(
+	cert *packp.PushCertificate,
+	c *pushCertConfig,
+	nonce string,
+	stateless bool,
+	verifier PushCertVerifier,
+) *PushCertStatus {
+	status := &PushCertStatus{
+		Certificate: cert,
+		Nonce:       nonce,
+	}
+
+	status.NonceStatus, status.NonceSlop = checkPushCertNonce(c, nonce, cert.Nonce, stateless)
+
+	switch {
+	case !bytes.HasPrefix(cert.Signature, []byte(pushCertSignatureBegin)):
+		status.Signature = PushCertSignatureNone
+	case verifier == nil:
+		status.Signature = PushCertSignatureUnchecked
+	default:
+		signer, key, err := verifier.Verify(bytes.NewReader(cert.Payload()), cert.Signature)
+		status.Signer, status.Key = signer, key
+		if err != nil {
+			status.Signature = PushCertSignatureBad
+			status.SignatureError = err
+		} else {
+			status.Signature = PushCertSignatureGood
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPushCertVerifier struct {
+	err error
+}
+
+func (v mockPushCertVerifier) Verify(message io.Reader, signature []byte) (string, string, error) {
+	return "John Doe <john@example.com>", "ABCDEF", v.err
+}
+
+func TestCheckPushCertNonce(t *testing.T) {
+	cfg := &pushCertConfig{seed: "secret", slop: 10 * time.Second}
+	now := time.Now().Unix()
+	nonce := cfg.nonce(now)
+
+	tests := []struct {
+		name      string
+		nonce     string
+		sent      string
+		stateless bool
+		status    PushCertNonceStatus
+	}{
+		{"unsolicited", "", "123-abc", false, PushCertNonceUnsolicited},
+		{"missing", nonce, "", false, PushCertNonceMissing},
+		{"ok", nonce, nonce, false, PushCertNonceOK},
+		{"bad", nonce, cfg.nonce(now - 1), false, PushCertNonceBad},
+		{"stateless ok", nonce, cfg.nonce(now - 5), true, PushCertNonceOK},
+		{"stateless slop", nonce, cfg.nonce(now - 60), true, PushCertNonceSlop},
+		{"stateless forged", nonce, generatePushCertNonce("other", now), true, PushCertNonceBad},
+		{"stateless malformed", nonce, "not-a-nonce", true, PushCertNonceBad},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, _ := checkPushCertNonce(cfg, tc.nonce, tc.sent, tc.stateless)
+			assert.Equal(t, tc.status, status)
+		})
+	}
+}
+
+func TestAdvertiseReferencesPushCert(t *testing.T) {
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("receive").SetOption("certNonceSeed", "secret")
+	require.NoError(t, st.SetConfig(cfg))
+
+	var buf bytes.Buffer
+	err = AdvertiseReferences(context.TODO(), st, &buf, ReceivePackService, false)
+	require.NoError(t, err)
+
+	ar := packp.NewAdvRefs()
+	require.NoError(t, ar.Decode(&buf))
+	require.True(t, ar.Capabilities.Supports(capability.PushCert))
+
+	nonce := ar.Capabilities.Get(capability.PushCert)[0]
+	stamp, ok := parseNonceStamp(nonce)
+	require.True(t, ok)
+	assert.Equal(t, generatePushCertNonce("secret", stamp), nonce)
+}
+
+func TestAdvertiseReferencesNoPushCert(t *testing.T) {
+	var buf bytes.Buffer
+	err := AdvertiseReferences(context.TODO(), memory.NewStorage(), &buf, ReceivePackService, false)
+	require.NoError(t, err)
+
+	ar := packp.NewAdvRefs()
+	require.NoError(t, ar.Decode(&buf))
+	assert.False(t, ar.Capabilities.Supports(capability.PushCert))
+}
+
+func testReceivePackPushCert(t *testing.T, opts *ReceivePackOptions) (*memory.Storage, *bytes.Buffer) {
+	t.Helper()
+
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("receive").
+		SetOption("certNonceSeed", "secret").
+		SetOption("certNonceSlop", "60")
+	require.NoError(t, st.SetConfig(cfg))
+
+	name := plumbing.ReferenceName("refs/heads/master")
+	hash := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	require.NoError(t, st.SetReference(plumbing.NewHashReference(name, hash)))
+
+	req := packp.NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	req.Certificate = &packp.PushCertificate{
+		Version:   packp.PushCertVersion,
+		Pusher:    "John Doe <john@example.com> 1234567890 +0000",
+		Nonce:     generatePushCertNonce("secret", time.Now().Unix()),
+		Commands:  []*packp.Command{{Name: name, Old: hash, New: plumbing.ZeroHash}},
+		Signature: []byte("-----BEGIN PGP SIGNATURE-----\nsig\n-----END PGP SIGNATURE-----\n"),
+	}
+
+	var in bytes.Buffer
+	require.NoError(t, req.Encode(&in))
+
+	var out bytes.Buffer
+	opts.StatelessRPC = true
+	err = ReceivePack(context.TODO(), st, io.NopCloser(&in), ioutil.WriteNopCloser(&out), opts)
+	if err != nil {
+		require.ErrorContains(t, err, "rejected")
+	}
+
+	return st, &out
+}
+
+func TestReceivePackPushCert(t *testing.T) {
+	var status *PushCertStatus
+	st, out := testReceivePackPushCert(t, &ReceivePackOptions{
+		PushCertVerifier: mockPushCertVerifier{},
+		PushCertHandler: func(_ context.Context, s *PushCertStatus) error {
+			status = s
+			return nil
+		},
+	})
+
+	require.NotNil(t, status)
+	assert.True(t, status.Verified())
+	assert.Equal(t, PushCertSignatureGood, status.Signature)
+	assert.Equal(t, PushCertNonceOK, status.NonceStatus)
+	assert.Equal(t, "ABCDEF", status.Key)
+	assert.Equal(t, "John Doe <john@example.com>", status.Signer)
+
+	rs := packp.NewReportStatus()
+	require.NoError(t, rs.Decode(out))
+	require.NoError(t, rs.Error())
+
+	_, err := st.Reference(plumbing.ReferenceName("refs/heads/master"))
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestReceivePackPushCertRejected(t *testing.T) {
+	var status *PushCertStatus
+	st, out := testReceivePackPushCert(t, &ReceivePackOptions{
+		PushCertVerifier: mockPushCertVerifier{err: errors.New("bad signature")},
+		PushCertHandler: func(_ context.Context, s *PushCertStatus) error {
+			status = s
+			if !s.Verified() {
+				return errors.New("rejected: unverified push certificate")
+			}
+			return nil
+		},
+	})
+
+	require.NotNil(t, status)
+	assert.Equal(t, PushCertSignatureBad, status.Signature)
+	assert.EqualError(t, status.SignatureError, "bad signature")
+
+	rs := packp.NewReportStatus()
+	require.NoError(t, rs.Decode(out))
+	assert.ErrorContains(t, rs.Error(), "unverified push certificate")
+
+	_, err := st.Reference(plumbing.ReferenceName("refs/heads/master"))
+	assert.NoError(t, err)
+}
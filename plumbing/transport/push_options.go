@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/storage"
+)
+
+const (
+	advertisePushOptionsKey = "advertisePushOptions"
+	maxPushOptionsKey       = "maxPushOptions"
+)
+
+var (
+	// ErrPushOptionsNotAdvertised is returned by ReceivePack when the client
+	// sends push options although receive.advertisePushOptions is false.
+	ErrPushOptionsNotAdvertised = errors.New("push-options not advertised")
+	// ErrTooManyPushOptions is returned by ReceivePack when the client sends
+	// more push options than receive.maxPushOptions.
+	ErrTooManyPushOptions = errors.New("too many push options")
+)
+
+// pushOptionsConfig holds the receive.* options about the push options.
+type pushOptionsConfig struct {
+	// advertise is receive.advertisePushOptions. Unlike upstream, where it
+	// is opt-in, the push options are advertised unless it's set to false.
+	advertise bool
+	// max is receive.maxPushOptions, the maximum number of push options
+	// accepted from the client, zero meaning unlimited.
+	max int
+}
+
+func loadPushOptionsConfig(st storage.Storer) (*pushOptionsConfig, error) {
+	cfg, err := st.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	s := cfg.Raw.Section(receiveSection)
+	pc := &pushOptionsConfig{advertise: true}
+	switch v := s.Options.Get(advertisePushOptionsKey); strings.ToLower(v) {
+	case "", "true", "yes", "on", "1":
+	case "false", "no", "off", "0":
+		pc.advertise = false
+	default:
+		return nil, fmt.Errorf("invalid %s.%s: %q", receiveSection, advertisePushOptionsKey, v)
+	}
+
+	if v := s.Options.Get(maxPushOptionsKey); v != "" {
+		if pc.max, err = strconv.Atoi(v); err != nil || pc.max < 0 {
+			return nil, fmt.Errorf("invalid %s.%s: %q", receiveSection, maxPushOptionsKey, v)
+		}
+	}
+
+	return pc, nil
+}
+
+// check returns an error if the push options sent by the client aren't
+// accepted.
+func (c *pushOptionsConfig) check(options []string) error {
+	if !c.advertise {
+		return ErrPushOptionsNotAdvertised
+	}
+
+	if c.max > 0 && len(options) > c.max {
+		return fmt.Errorf("%w: %d, the maximum is %d", ErrTooManyPushOptions, len(options), c.max)
+	}
+
+	return nil
+}
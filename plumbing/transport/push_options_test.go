@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setReceiveOption(t *testing.T, st *memory.Storage, key, value string) {
+	t.Helper()
+
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section(receiveSection).SetOption(key, value)
+	require.NoError(t, st.SetConfig(cfg))
+}
+
+func TestAdvertiseReferencesPushOptions(t *testing.T) {
+	for value, advertised := range map[string]bool{
+		"":      true,
+		"true":  true,
+		"yes":   true,
+		"false": false,
+		"off":   false,
+	} {
+		st := memory.NewStorage()
+		if value != "" {
+			setReceiveOption(t, st, advertisePushOptionsKey, value)
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, AdvertiseReferences(context.TODO(), st, &buf, ReceivePackService, false))
+
+		ar := packp.NewAdvRefs()
+		require.NoError(t, ar.Decode(&buf))
+		assert.Equal(t, advertised, ar.Capabilities.Supports(capability.PushOptions), value)
+	}
+
+	st := memory.NewStorage()
+	setReceiveOption(t, st, advertisePushOptionsKey, "maybe")
+	err := AdvertiseReferences(context.TODO(), st, io.Discard, ReceivePackService, false)
+	assert.ErrorContains(t, err, "receive.advertisePushOptions")
+}
+
+func TestReceivePackPushOptionsConfig(t *testing.T) {
+	var out bytes.Buffer
+	var useSideband bool
+	receive := func(st *memory.Storage, options []string) error {
+		req := packp.NewUpdateRequests()
+		req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+		req.Capabilities.Set(capability.PushOptions)  //nolint:errcheck
+		if useSideband {
+			req.Capabilities.Set(capability.Sideband64k) //nolint:errcheck
+		}
+		req.Commands = []*packp.Command{{Name: "refs/heads/main", Old: hookOldHash}}
+
+		var in bytes.Buffer
+		require.NoError(t, req.Encode(&in))
+		po := packp.PushOptions{Options: options}
+		require.NoError(t, po.Encode(&in))
+
+		out.Reset()
+		return ReceivePack(context.TODO(), st, io.NopCloser(&in), ioutil.WriteNopCloser(&out),
+			&ReceivePackOptions{StatelessRPC: true})
+	}
+
+	st := newHooksStorage(t)
+	setReceiveOption(t, st, maxPushOptionsKey, "2")
+	assert.ErrorIs(t, receive(st, []string{"a", "b", "c"}), ErrTooManyPushOptions)
+	_, err := st.Reference("refs/heads/main")
+	require.NoError(t, err)
+
+	// The rejection is reported to the client.
+	rs := packp.NewReportStatus()
+	require.NoError(t, rs.Decode(&out))
+	require.Equal(t, "ok", rs.UnpackStatus)
+	require.Len(t, rs.CommandStatuses, 1)
+	assert.Contains(t, rs.CommandStatuses[0].Status, ErrTooManyPushOptions.Error())
+
+	require.NoError(t, receive(st, []string{"a", "b"}))
+	_, err = st.Reference("refs/heads/main")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	st = newHooksStorage(t)
+	setReceiveOption(t, st, advertisePushOptionsKey, "false")
+	useSideband = true
+	assert.ErrorIs(t, receive(st, []string{"ci.skip"}), ErrPushOptionsNotAdvertised)
+	rs = packp.NewReportStatus()
+	require.NoError(t, rs.Decode(sideband.NewDemuxer(sideband.Sideband64k, &out)))
+	require.Len(t, rs.CommandStatuses, 1)
+	assert.Contains(t, rs.CommandStatuses[0].Status, ErrPushOptionsNotAdvertised.Error())
+	useSideband = false
+
+	setReceiveOption(t, st, maxPushOptionsKey, "-1")
+	assert.ErrorContains(t, receive(st, nil), "receive.maxPushOptions")
+}
+
+func TestSendPackPushOptionsNotSupported(t *testing.T) {
+	caps := capability.NewList()
+	caps.Add(capability.ReportStatus) //nolint:errcheck
+	req := &PushRequest{
+		Commands: []*packp.Command{{Name: "refs/heads/main", Old: hookOldHash}},
+		Options:  []string{"ci.skip"},
+	}
+
+	err := SendPack(context.TODO(), memory.NewStorage(), &mockConnection{caps: caps}, newMockRWC(nil), newMockRWC(nil), req)
+	assert.ErrorContains(t, err, "push-options")
+}
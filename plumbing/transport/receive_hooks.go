@@ -0,0 +1,330 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+const procReceiveRefsKey = "procReceiveRefs"
+
+var (
+	// ErrProcReceiveNoStatus is reported for the commands handled by the
+	// proc-receive hook that were not given a status by it.
+	ErrProcReceiveNoStatus = errors.New("proc-receive failed to report status")
+	// ErrAtomicPushFailed is reported for the commands of an atomic push
+	// that were rejected because another command failed.
+	ErrAtomicPushFailed = errors.New("atomic push failure")
+	// ErrAtomicTransactionFailed is reported for all the commands of an
+	// atomic push when the reference updates couldn't be committed.
+	ErrAtomicTransactionFailed = errors.New("atomic transaction failed")
+)
+
+// ReceiveHookRequest holds the information passed to the ReceivePack hooks.
+type ReceiveHookRequest struct {
+	// Commands are the reference update commands the hook is called for.
+	// Hooks called after the references are updated only get the commands
+	// that succeeded.
+	Commands []*packp.Command
+	// PushOptions are the push options sent by the client, if any.
+	PushOptions []string
+	// Storer gives access to the repository, including the objects received
+	// with the push.
+	Storer storage.Storer
+	// PushCert is the verification status of the push certificate sent by
+	// the client, if any.
+	PushCert *PushCertStatus
+}
+
+// withCommands returns a copy of the request for the given commands.
+func (r *ReceiveHookRequest) withCommands(cmds []*packp.Command) *ReceiveHookRequest {
+	req := *r
+	req.Commands = cmds
+	return &req
+}
+
+// receiveHooks runs the reference update commands of a push, calling the
+// hooks set in the options, the same way upstream runs the hooks of the
+// same names.
+type receiveHooks struct {
+	opts            *ReceivePackOptions
+	procReceiveRefs []string
+}
+
+func newReceiveHooks(st storage.Storer, opts *ReceivePackOptions) (*receiveHooks, error) {
+	h := &receiveHooks{opts: opts}
+	if opts.ProcReceiveHook == nil {
+		return h, nil
+	}
+
+	cfg, err := st.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	h.procReceiveRefs = append(h.procReceiveRefs, opts.ProcReceiveRefs...)
+	h.procReceiveRefs = append(h.procReceiveRefs,
+		cfg.Raw.Section(receiveSection).Options.GetAll(procReceiveRefsKey)...)
+
+	return h, nil
+}
+
+// isProcReceive returns true if the command must be handled by the
+// proc-receive hook. Like upstream, receive.procReceiveRefs values are
+// reference prefixes, negated when starting with "!".
+func (h *receiveHooks) isProcReceive(name plumbing.ReferenceName) bool {
+	if h.opts.ProcReceiveHook == nil {
+		return false
+	}
+
+	var match bool
+	for _, prefix := range h.procReceiveRefs {
+		negated := strings.HasPrefix(prefix, "!")
+		prefix = strings.TrimSuffix(strings.TrimPrefix(prefix, "!"), "/")
+		rest, ok := strings.CutPrefix(name.String(), prefix)
+		if !ok || (rest != "" && rest[0] != '/') {
+			continue
+		}
+
+		if negated {
+			return false
+		}
+
+		match = true
+	}
+
+	return match
+}
+
+// execute runs the hooks and the commands of the request, setting the
+// status of each command in cmdStatus. When atomic is true, either all the
+// references are updated or none of them.
+func (h *receiveHooks) execute(
+	ctx context.Context,
+	st storage.Storer,
+	req *ReceiveHookRequest,
+	atomic bool,
+	cmdStatus map[plumbing.ReferenceName]error,
+	firstErr *error,
+) {
+	if h.opts.PreReceiveHook != nil {
+		if err := h.opts.PreReceiveHook(ctx, req); err != nil {
+			for _, cmd := range req.Commands {
+				setStatus(cmdStatus, firstErr, cmd.Name, err)
+			}
+			return
+		}
+	}
+
+	var procCmds, cmds []*packp.Command
+	for _, cmd := range req.Commands {
+		if h.isProcReceive(cmd.Name) {
+			procCmds = append(procCmds, cmd)
+		} else {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	if len(procCmds) > 0 {
+		h.procReceive(ctx, req.withCommands(procCmds), cmdStatus, firstErr)
+	}
+
+	if atomic {
+		h.updateAtomic(ctx, st, req, cmds, cmdStatus, firstErr)
+	} else {
+		for _, cmd := range cmds {
+			if h.opts.UpdateHook != nil {
+				if err := h.opts.UpdateHook(ctx, req, cmd); err != nil {
+					setStatus(cmdStatus, firstErr, cmd.Name, err)
+					continue
+				}
+			}
+
+			updateReference(st, cmd, cmdStatus, firstErr)
+		}
+	}
+
+	var updated []*packp.Command
+	for _, cmd := range req.Commands {
+		if cmdStatus[cmd.Name] == nil {
+			updated = append(updated, cmd)
+		}
+	}
+
+	if len(updated) == 0 {
+		return
+	}
+
+	if h.opts.PostReceiveHook != nil {
+		h.opts.PostReceiveHook(ctx, req.withCommands(updated))
+	}
+
+	if h.opts.PostUpdateHook != nil {
+		refs := make([]plumbing.ReferenceName, 0, len(updated))
+		for _, cmd := range updated {
+			refs = append(refs, cmd.Name)
+		}
+
+		h.opts.PostUpdateHook(ctx, refs)
+	}
+}
+
+// updateAtomic updates the references of all the given commands or none of
+// them. Every reference is checked before any of them is written, and the
+// references already written are restored if a write fails. Commands
+// handled by the proc-receive hook can't be rolled back, but their failure
+// still aborts the rest of the push.
+func (h *receiveHooks) updateAtomic(
+	ctx context.Context,
+	st storage.Storer,
+	req *ReceiveHookRequest,
+	cmds []*packp.Command,
+	cmdStatus map[plumbing.ReferenceName]error,
+	firstErr *error,
+) {
+	var failed error
+	for _, cmd := range req.Commands {
+		if err, ok := cmdStatus[cmd.Name]; ok && err != nil {
+			failed = err
+			break
+		}
+	}
+
+	prev := make(map[plumbing.ReferenceName]*plumbing.Reference, len(cmds))
+	staged := make(map[plumbing.ReferenceName]error)
+	for _, cmd := range cmds {
+		if failed != nil {
+			break
+		}
+
+		if h.opts.UpdateHook != nil {
+			if err := h.opts.UpdateHook(ctx, req, cmd); err != nil {
+				setStatus(staged, &failed, cmd.Name, err)
+				continue
+			}
+		}
+
+		ref, err := checkReference(st, cmd)
+		if err != nil {
+			setStatus(staged, &failed, cmd.Name, err)
+			continue
+		}
+
+		prev[cmd.Name] = ref
+	}
+
+	if failed == nil {
+		if err := commitAtomic(st, cmds, prev); err != nil {
+			failed = fmt.Errorf("%w: %w", ErrAtomicTransactionFailed, err)
+			for _, cmd := range cmds {
+				staged[cmd.Name] = failed
+			}
+		}
+	}
+
+	for _, cmd := range cmds {
+		var err error
+		if failed != nil {
+			err = staged[cmd.Name]
+			if err == nil {
+				err = ErrAtomicPushFailed
+			}
+		}
+
+		setStatus(cmdStatus, firstErr, cmd.Name, err)
+	}
+
+	if failed == nil {
+		return
+	}
+
+	// Like upstream, the commands that succeeded on their own are reported
+	// as failed because of the rest.
+	for _, cmd := range req.Commands {
+		if cmdStatus[cmd.Name] == nil {
+			setStatus(cmdStatus, firstErr, cmd.Name, ErrAtomicPushFailed)
+		}
+	}
+}
+
+// checkReference returns the current value of the reference of cmd, nil if
+// it doesn't exist, or ErrUpdateReference if cmd can't be applied to it.
+func checkReference(st storer.ReferenceStorer, cmd *packp.Command) (*plumbing.Reference, error) {
+	ref, err := st.Reference(cmd.Name)
+	if err == plumbing.ErrReferenceNotFound {
+		ref, err = nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if (ref == nil) != (cmd.Action() == packp.Create) {
+		return nil, ErrUpdateReference
+	}
+
+	return ref, nil
+}
+
+// commitAtomic applies the commands to st, whose references had the values
+// of prev when checked. If a reference fails to be written, the ones
+// already written are restored, so none of the commands is applied.
+func commitAtomic(st storer.ReferenceStorer, cmds []*packp.Command, prev map[plumbing.ReferenceName]*plumbing.Reference) error {
+	for i, cmd := range cmds {
+		var err error
+		if cmd.Action() == packp.Delete {
+			err = st.RemoveReference(cmd.Name)
+		} else {
+			err = st.CheckAndSetReference(plumbing.NewHashReference(cmd.Name, cmd.New), prev[cmd.Name])
+		}
+
+		if err != nil {
+			return errors.Join(err, restoreReferences(st, cmds[:i], prev))
+		}
+	}
+
+	return nil
+}
+
+// restoreReferences restores the references of the commands to the values
+// of prev, removing the ones which didn't exist.
+func restoreReferences(st storer.ReferenceStorer, cmds []*packp.Command, prev map[plumbing.ReferenceName]*plumbing.Reference) error {
+	var errs []error
+	for i := len(cmds) - 1; i >= 0; i-- {
+		if ref := prev[cmds[i].Name]; ref != nil {
+			errs = append(errs, st.SetReference(ref))
+		} else {
+			errs = append(errs, st.RemoveReference(cmds[i].Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (h *receiveHooks) procReceive(
+	ctx context.Context,
+	req *ReceiveHookRequest,
+	cmdStatus map[plumbing.ReferenceName]error,
+	firstErr *error,
+) {
+	status, err := h.opts.ProcReceiveHook(ctx, req)
+	for _, cmd := range req.Commands {
+		if err != nil {
+			setStatus(cmdStatus, firstErr, cmd.Name, err)
+			continue
+		}
+
+		cmdErr, ok := status[cmd.Name]
+		if !ok {
+			cmdErr = ErrProcReceiveNoStatus
+		}
+
+		setStatus(cmdStatus, firstErr, cmd.Name, cmdErr)
+	}
+}
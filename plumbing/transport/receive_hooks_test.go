@@ -0,0 +1,387 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	hookContent = []byte("hooks")
+	hookOldHash = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	hookNewHash = plumbing.ComputeHash(plumbing.BlobObject, hookContent)
+)
+
+// testReceivePackHooks sends the given commands and push options to
+// ReceivePack, along with any extra capabilities, and returns the resulting
+// report status.
+func testReceivePackHooks(
+	t *testing.T,
+	st storage.Storer,
+	opts *ReceivePackOptions,
+	cmds []*packp.Command,
+	pushOptions []string,
+	caps ...capability.Capability,
+) *packp.ReportStatus {
+	t.Helper()
+
+	req := packp.NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	for _, c := range caps {
+		req.Capabilities.Set(c) //nolint:errcheck
+	}
+	req.Commands = cmds
+	if len(pushOptions) > 0 {
+		req.Capabilities.Set(capability.PushOptions) //nolint:errcheck
+	}
+
+	in := encodeReceivePackRequest(t, req, pushOptions)
+
+	var out bytes.Buffer
+	opts.StatelessRPC = true
+	_ = ReceivePack(context.TODO(), st, io.NopCloser(in), ioutil.WriteNopCloser(&out), opts)
+
+	rs := packp.NewReportStatus()
+	require.NoError(t, rs.Decode(&out))
+	require.Equal(t, "ok", rs.UnpackStatus)
+	return rs
+}
+
+// encodeReceivePackRequest encodes the update request req, its push options
+// and a packfile with the blob of hookNewHash.
+func encodeReceivePackRequest(t *testing.T, req *packp.UpdateRequests, pushOptions []string) *bytes.Buffer {
+	t.Helper()
+
+	var in bytes.Buffer
+	require.NoError(t, req.Encode(&in))
+	if len(pushOptions) > 0 {
+		po := packp.PushOptions{Options: pushOptions}
+		require.NoError(t, po.Encode(&in))
+	}
+
+	src := memory.NewStorage()
+	obj := src.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	require.NoError(t, err)
+	_, err = w.Write(hookContent)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, err = src.SetEncodedObject(obj)
+	require.NoError(t, err)
+
+	_, err = packfile.NewEncoder(&in, src, false).Encode([]plumbing.Hash{hookNewHash}, 0)
+	require.NoError(t, err)
+	return &in
+}
+
+func newHooksStorage(t *testing.T) *memory.Storage {
+	t.Helper()
+
+	st := memory.NewStorage()
+	for _, name := range []string{"refs/heads/main", "refs/heads/protected"} {
+		ref := plumbing.NewHashReference(plumbing.ReferenceName(name), hookOldHash)
+		require.NoError(t, st.SetReference(ref))
+	}
+
+	return st
+}
+
+func commandStatuses(rs *packp.ReportStatus) map[plumbing.ReferenceName]string {
+	m := make(map[plumbing.ReferenceName]string)
+	for _, cs := range rs.CommandStatuses {
+		m[cs.ReferenceName] = cs.Status
+	}
+	return m
+}
+
+func updateCommands() []*packp.Command {
+	return []*packp.Command{
+		{Name: "refs/heads/main", Old: hookOldHash, New: hookNewHash},
+		{Name: "refs/heads/protected", Old: hookOldHash, New: hookNewHash},
+	}
+}
+
+func TestReceivePackHooks(t *testing.T) {
+	st := newHooksStorage(t)
+
+	var calls []string
+	var preReq, postReq *ReceiveHookRequest
+	var postUpdateRefs []plumbing.ReferenceName
+	rs := testReceivePackHooks(t, st, &ReceivePackOptions{
+		PreReceiveHook: func(_ context.Context, req *ReceiveHookRequest) error {
+			calls = append(calls, "pre-receive")
+			preReq = req
+			return nil
+		},
+		UpdateHook: func(_ context.Context, _ *ReceiveHookRequest, cmd *packp.Command) error {
+			calls = append(calls, "update "+cmd.Name.String())
+			if cmd.Name == "refs/heads/protected" {
+				return errors.New("protected branch")
+			}
+			return nil
+		},
+		PostReceiveHook: func(_ context.Context, req *ReceiveHookRequest) {
+			calls = append(calls, "post-receive")
+			postReq = req
+		},
+		PostUpdateHook: func(_ context.Context, refs []plumbing.ReferenceName) {
+			calls = append(calls, "post-update")
+			postUpdateRefs = refs
+		},
+	}, updateCommands(), []string{"ci.skip"})
+
+	assert.Equal(t, []string{
+		"pre-receive",
+		"update refs/heads/main",
+		"update refs/heads/protected",
+		"post-receive",
+		"post-update",
+	}, calls)
+
+	require.NotNil(t, preReq)
+	assert.Len(t, preReq.Commands, 2)
+	assert.Equal(t, []string{"ci.skip"}, preReq.PushOptions)
+	assert.Equal(t, st, preReq.Storer)
+
+	require.NotNil(t, postReq)
+	require.Len(t, postReq.Commands, 1)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/main"), postReq.Commands[0].Name)
+	assert.Equal(t, []plumbing.ReferenceName{"refs/heads/main"}, postUpdateRefs)
+
+	statuses := commandStatuses(rs)
+	assert.Equal(t, "ok", statuses["refs/heads/main"])
+	assert.Equal(t, "protected branch", statuses["refs/heads/protected"])
+
+	ref, err := st.Reference("refs/heads/main")
+	require.NoError(t, err)
+	assert.Equal(t, hookNewHash, ref.Hash())
+
+	ref, err = st.Reference("refs/heads/protected")
+	require.NoError(t, err)
+	assert.Equal(t, hookOldHash, ref.Hash())
+}
+
+func TestReceivePackWithoutReportStatus(t *testing.T) {
+	st := newHooksStorage(t)
+
+	var calls []string
+	req := packp.NewUpdateRequests()
+	req.Commands = updateCommands()
+	in := encodeReceivePackRequest(t, req, nil)
+
+	var out bytes.Buffer
+	err := ReceivePack(context.TODO(), st, io.NopCloser(in), ioutil.WriteNopCloser(&out), &ReceivePackOptions{
+		StatelessRPC: true,
+		UpdateHook: func(_ context.Context, _ *ReceiveHookRequest, cmd *packp.Command) error {
+			calls = append(calls, "update "+cmd.Name.String())
+			if cmd.Name == "refs/heads/protected" {
+				return errors.New("protected branch")
+			}
+			return nil
+		},
+		PostReceiveHook: func(context.Context, *ReceiveHookRequest) {
+			calls = append(calls, "post-receive")
+		},
+	})
+	assert.ErrorContains(t, err, "protected branch")
+	assert.Zero(t, out.Len())
+
+	assert.Equal(t, []string{
+		"update refs/heads/main",
+		"update refs/heads/protected",
+		"post-receive",
+	}, calls)
+
+	ref, err := st.Reference("refs/heads/main")
+	require.NoError(t, err)
+	assert.Equal(t, hookNewHash, ref.Hash())
+
+	ref, err = st.Reference("refs/heads/protected")
+	require.NoError(t, err)
+	assert.Equal(t, hookOldHash, ref.Hash())
+}
+
+func TestReceivePackPreReceiveHookDeclined(t *testing.T) {
+	st := newHooksStorage(t)
+
+	var postReceiveCalled bool
+	rs := testReceivePackHooks(t, st, &ReceivePackOptions{
+		PreReceiveHook: func(context.Context, *ReceiveHookRequest) error {
+			return errors.New("pre-receive hook declined")
+		},
+		UpdateHook: func(context.Context, *ReceiveHookRequest, *packp.Command) error {
+			t.Fatal("update hook must not be called")
+			return nil
+		},
+		PostReceiveHook: func(context.Context, *ReceiveHookRequest) {
+			postReceiveCalled = true
+		},
+	}, updateCommands(), nil)
+
+	assert.False(t, postReceiveCalled)
+	for _, status := range commandStatuses(rs) {
+		assert.Equal(t, "pre-receive hook declined", status)
+	}
+
+	ref, err := st.Reference("refs/heads/main")
+	require.NoError(t, err)
+	assert.Equal(t, hookOldHash, ref.Hash())
+}
+
+func TestReceivePackProcReceiveHook(t *testing.T) {
+	st := newHooksStorage(t)
+	cfg, err := st.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("receive").AddOption("procReceiveRefs", "refs/for")
+	require.NoError(t, st.SetConfig(cfg))
+
+	cmds := []*packp.Command{
+		{Name: "refs/heads/main", Old: hookOldHash, New: hookNewHash},
+		{Name: "refs/for/main", Old: plumbing.ZeroHash, New: hookNewHash},
+		{Name: "refs/for/topic", Old: plumbing.ZeroHash, New: hookNewHash},
+		{Name: "refs/drafts/main", Old: plumbing.ZeroHash, New: hookNewHash},
+	}
+
+	var procRefs []plumbing.ReferenceName
+	var updateRefs []plumbing.ReferenceName
+	rs := testReceivePackHooks(t, st, &ReceivePackOptions{
+		ProcReceiveRefs: []string{"refs/drafts/"},
+		ProcReceiveHook: func(_ context.Context, req *ReceiveHookRequest) (map[plumbing.ReferenceName]error, error) {
+			for _, cmd := range req.Commands {
+				procRefs = append(procRefs, cmd.Name)
+			}
+
+			return map[plumbing.ReferenceName]error{
+				"refs/for/main":    nil,
+				"refs/drafts/main": errors.New("drafts are disabled"),
+			}, nil
+		},
+		UpdateHook: func(_ context.Context, _ *ReceiveHookRequest, cmd *packp.Command) error {
+			updateRefs = append(updateRefs, cmd.Name)
+			return nil
+		},
+	}, cmds, nil)
+
+	assert.ElementsMatch(t, []plumbing.ReferenceName{
+		"refs/for/main", "refs/for/topic", "refs/drafts/main",
+	}, procRefs)
+	assert.Equal(t, []plumbing.ReferenceName{"refs/heads/main"}, updateRefs)
+
+	statuses := commandStatuses(rs)
+	assert.Equal(t, "ok", statuses["refs/heads/main"])
+	assert.Equal(t, "ok", statuses["refs/for/main"])
+	assert.Equal(t, ErrProcReceiveNoStatus.Error(), statuses["refs/for/topic"])
+	assert.Equal(t, "drafts are disabled", statuses["refs/drafts/main"])
+
+	// References handled by proc-receive are not updated by ReceivePack.
+	_, err = st.Reference("refs/for/main")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestReceiveHooksIsProcReceive(t *testing.T) {
+	h := &receiveHooks{
+		opts: &ReceivePackOptions{
+			ProcReceiveHook: func(context.Context, *ReceiveHookRequest) (map[plumbing.ReferenceName]error, error) {
+				return nil, nil
+			},
+		},
+		procReceiveRefs: []string{"refs/for/", "!refs/for/internal"},
+	}
+
+	assert.True(t, h.isProcReceive("refs/for/main"))
+	assert.False(t, h.isProcReceive("refs/for/internal"))
+	assert.False(t, h.isProcReceive("refs/for/internal/x"))
+	assert.False(t, h.isProcReceive("refs/forks/main"))
+	assert.False(t, h.isProcReceive("refs/heads/main"))
+}
+
+func TestReceivePackAtomic(t *testing.T) {
+	st := newHooksStorage(t)
+
+	var postReceiveCalled bool
+	rs := testReceivePackHooks(t, st, &ReceivePackOptions{
+		UpdateHook: func(_ context.Context, _ *ReceiveHookRequest, cmd *packp.Command) error {
+			if cmd.Name == "refs/heads/protected" {
+				return errors.New("protected branch")
+			}
+			return nil
+		},
+		PostReceiveHook: func(context.Context, *ReceiveHookRequest) {
+			postReceiveCalled = true
+		},
+	}, updateCommands(), nil, capability.Atomic)
+
+	assert.False(t, postReceiveCalled)
+
+	statuses := commandStatuses(rs)
+	assert.Equal(t, ErrAtomicPushFailed.Error(), statuses["refs/heads/main"])
+	assert.Equal(t, "protected branch", statuses["refs/heads/protected"])
+
+	for _, name := range []plumbing.ReferenceName{"refs/heads/main", "refs/heads/protected"} {
+		ref, err := st.Reference(name)
+		require.NoError(t, err)
+		assert.Equal(t, hookOldHash, ref.Hash())
+	}
+}
+
+func TestReceivePackAtomicSuccess(t *testing.T) {
+	st := newHooksStorage(t)
+
+	rs := testReceivePackHooks(t, st, &ReceivePackOptions{}, updateCommands(), nil, capability.Atomic)
+	for _, status := range commandStatuses(rs) {
+		assert.Equal(t, "ok", status)
+	}
+
+	for _, name := range []plumbing.ReferenceName{"refs/heads/main", "refs/heads/protected"} {
+		ref, err := st.Reference(name)
+		require.NoError(t, err)
+		assert.Equal(t, hookNewHash, ref.Hash())
+	}
+}
+
+// setReferenceFailStorage is a storage failing to write a reference.
+type setReferenceFailStorage struct {
+	*memory.Storage
+	name plumbing.ReferenceName
+}
+
+func (s *setReferenceFailStorage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	if ref.Name() == s.name {
+		return errors.New("write failed")
+	}
+
+	return s.Storage.CheckAndSetReference(ref, old)
+}
+
+func TestReceivePackAtomicWriteFailure(t *testing.T) {
+	st := &setReferenceFailStorage{Storage: newHooksStorage(t), name: "refs/heads/protected"}
+	cmds := append(updateCommands(), &packp.Command{Name: "refs/heads/new", New: hookNewHash})
+	rs := testReceivePackHooks(t, st, &ReceivePackOptions{}, cmds, nil, capability.Atomic)
+
+	for _, status := range commandStatuses(rs) {
+		assert.Contains(t, status, ErrAtomicTransactionFailed.Error())
+	}
+
+	// The references written before the failure are restored.
+	for _, name := range []plumbing.ReferenceName{"refs/heads/main", "refs/heads/protected"} {
+		ref, err := st.Reference(name)
+		require.NoError(t, err)
+		assert.Equal(t, hookOldHash, ref.Hash())
+	}
+
+	_, err := st.Reference("refs/heads/new")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
@@ -23,10 +24,43 @@ type ReceivePackOptions struct {
 	GitProtocol   string
 	AdvertiseRefs bool
 	StatelessRPC  bool
+
+	// PushCertVerifier verifies the signature of push certificates sent by
+	// clients. Certificates are only requested when receive.certNonceSeed
+	// is set in the repository configuration.
+	PushCertVerifier PushCertVerifier
+	// PushCertHandler is called with the verification result when the
+	// client sends a push certificate, before any reference is updated.
+	// Returning an error rejects all the reference updates with the error
+	// message.
+	PushCertHandler func(ctx context.Context, status *PushCertStatus) error
+
+	// PreReceiveHook is called with all the commands before any reference
+	// is updated, like the pre-receive hook. Returning an error rejects all
+	// the commands with the error message.
+	PreReceiveHook func(ctx context.Context, req *ReceiveHookRequest) error
+	// UpdateHook is called for each command right before its reference is
+	// updated, like the update hook. Returning an error rejects the
+	// command with the error message.
+	UpdateHook func(ctx context.Context, req *ReceiveHookRequest, cmd *packp.Command) error
+	// PostReceiveHook is called with the commands that succeeded once all
+	// the references are updated, like the post-receive hook.
+	PostReceiveHook func(ctx context.Context, req *ReceiveHookRequest)
+	// PostUpdateHook is called with the names of the updated references,
+	// like the post-update hook.
+	PostUpdateHook func(ctx context.Context, refs []plumbing.ReferenceName)
+	// ProcReceiveHook handles the commands for the references matching
+	// ProcReceiveRefs, instead of updating them, like the proc-receive hook.
+	// It returns the status of each command, where a nil error means the
+	// command succeeded. Returning an error rejects all of them.
+	ProcReceiveHook func(ctx context.Context, req *ReceiveHookRequest) (map[plumbing.ReferenceName]error, error)
+	// ProcReceiveRefs are the reference prefixes handled by
+	// ProcReceiveHook, in addition to the ones set with
+	// receive.procReceiveRefs. Prefixes starting with "!" are excluded.
+	ProcReceiveRefs []string
 }
 
 // ReceivePack is a server command that serves the receive-pack service.
-// TODO: support hooks
 func ReceivePack(
 	ctx context.Context,
 	st storage.Storer,
@@ -44,6 +78,26 @@ func ReceivePack(
 		opts = &ReceivePackOptions{}
 	}
 
+	certCfg, err := loadPushCertConfig(st)
+	if err != nil {
+		return err
+	}
+
+	pushOptsCfg, err := loadPushOptionsConfig(st)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := newReceiveHooks(st, opts)
+	if err != nil {
+		return err
+	}
+
+	advOpts := &advertiseOptions{
+		pushCertNonce: certCfg.nonce(time.Now().Unix()),
+		pushOptions:   pushOptsCfg.advertise,
+	}
+
 	if opts.AdvertiseRefs || !opts.StatelessRPC {
 		switch version := ProtocolVersion(opts.GitProtocol); version {
 		case protocol.V1:
@@ -56,7 +110,7 @@ func ReceivePack(
 			return fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
 		}
 
-		if err := AdvertiseReferences(ctx, st, w, ReceivePackService, opts.StatelessRPC); err != nil {
+		if err := advertiseReferences(ctx, st, w, ReceivePackService, opts.StatelessRPC, advOpts); err != nil {
 			return err
 		}
 	}
@@ -93,13 +147,17 @@ func ReceivePack(
 		caps         = updreq.Capabilities
 		needPackfile bool
 		pushOpts     packp.PushOptions
+		pushOptsErr  error
 	)
 
-	// TODO: Pass the options to the server-side hooks.
 	if updreq.Capabilities.Supports(capability.PushOptions) {
 		if err := pushOpts.Decode(rd); err != nil {
 			return fmt.Errorf("decoding push-options: %w", err)
 		}
+
+		// Like git, the commands are rejected in the report, once the
+		// packfile is received.
+		pushOptsErr = pushOptsCfg.check(pushOpts.Options)
 	}
 
 	// Should we expect a packfile?
@@ -122,16 +180,32 @@ func ReceivePack(
 		return fmt.Errorf("closing reader: %w", err)
 	}
 
-	// Report status if the client supports it
-	if !updreq.Capabilities.Supports(capability.ReportStatus) {
-		return unpackErr
+	hookReq := &ReceiveHookRequest{
+		Commands:    updreq.Commands,
+		PushOptions: pushOpts.Options,
+		Storer:      st,
+	}
+
+	// All the commands are rejected when the push options or the push
+	// certificate aren't accepted.
+	rejectErr := pushOptsErr
+	if updreq.Certificate != nil && unpackErr == nil && rejectErr == nil {
+		hookReq.PushCert = verifyPushCert(updreq.Certificate, certCfg,
+			advOpts.pushCertNonce, opts.StatelessRPC, opts.PushCertVerifier)
+		if opts.PushCertHandler != nil {
+			rejectErr = opts.PushCertHandler(ctx, hookReq.PushCert)
+		}
 	}
 
+	// Report status if the client supports it. Otherwise, the references
+	// are still updated, only the report is skipped.
+	reportStatus := updreq.Capabilities.Supports(capability.ReportStatus)
+
 	var (
 		useSideband bool
 		writer      io.Writer = w
 	)
-	if !caps.Supports(capability.NoProgress) {
+	if reportStatus && !caps.Supports(capability.NoProgress) {
 		if caps.Supports(capability.Sideband64k) {
 			writer = sideband.NewMuxer(sideband.Sideband64k, w)
 			useSideband = true
@@ -143,6 +217,10 @@ func ReceivePack(
 
 	writeCloser := ioutil.NewWriteCloser(writer, w)
 	if unpackErr != nil {
+		if !reportStatus {
+			return unpackErr
+		}
+
 		res := sendReportStatus(writeCloser, unpackErr, nil)
 		closeWriter(w)
 		return res
@@ -150,9 +228,21 @@ func ReceivePack(
 
 	var firstErr error
 	cmdStatus := make(map[plumbing.ReferenceName]error)
-	updateReferences(st, updreq, cmdStatus, &firstErr)
+	if rejectErr != nil {
+		for _, cmd := range updreq.Commands {
+			setStatus(cmdStatus, &firstErr, cmd.Name, rejectErr)
+		}
+	} else {
+		hooks.execute(ctx, st, hookReq, caps.Supports(capability.Atomic), cmdStatus, &firstErr)
+	}
 
-	if err := sendReportStatus(writeCloser, firstErr, cmdStatus); err != nil {
+	if !reportStatus {
+		return firstErr
+	}
+
+	// The packfile was unpacked successfully at this point, failed commands
+	// are only reported in their own status.
+	if err := sendReportStatus(writeCloser, nil, cmdStatus); err != nil {
 		return err
 	}
 
@@ -216,41 +306,39 @@ func referenceExists(s storer.ReferenceStorer, n plumbing.ReferenceName) (bool,
 	return err == nil, err
 }
 
-func updateReferences(st storage.Storer, req *packp.UpdateRequests, cmdStatus map[plumbing.ReferenceName]error, firstErr *error) {
-	for _, cmd := range req.Commands {
-		exists, err := referenceExists(st, cmd.Name)
-		if err != nil {
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
-			continue
-		}
-
-		switch cmd.Action() {
-		case packp.Create:
-			if exists {
-				setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
-				continue
-			}
+func updateReference(st storer.ReferenceStorer, cmd *packp.Command, cmdStatus map[plumbing.ReferenceName]error, firstErr *error) {
+	exists, err := referenceExists(st, cmd.Name)
+	if err != nil {
+		setStatus(cmdStatus, firstErr, cmd.Name, err)
+		return
+	}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := st.SetReference(ref)
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
-		case packp.Delete:
-			if !exists {
-				setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
-				continue
-			}
+	switch cmd.Action() {
+	case packp.Create:
+		if exists {
+			setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
+			return
+		}
 
-			err := st.RemoveReference(cmd.Name)
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
-		case packp.Update:
-			if !exists {
-				setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
-				continue
-			}
+		ref := plumbing.NewHashReference(cmd.Name, cmd.New)
+		err := st.SetReference(ref)
+		setStatus(cmdStatus, firstErr, cmd.Name, err)
+	case packp.Delete:
+		if !exists {
+			setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
+			return
+		}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := st.SetReference(ref)
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
+		err := st.RemoveReference(cmd.Name)
+		setStatus(cmdStatus, firstErr, cmd.Name, err)
+	case packp.Update:
+		if !exists {
+			setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
+			return
 		}
+
+		ref := plumbing.NewHashReference(cmd.Name, cmd.New)
+		err := st.SetReference(ref)
+		setStatus(cmdStatus, firstErr, cmd.Name, err)
 	}
 }
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
@@ -24,6 +26,52 @@ func AdvertiseReferences(
 	w io.Writer,
 	service Service,
 	smart bool,
+) error {
+	var opts advertiseOptions
+	if service == ReceivePackService {
+		pc, err := loadPushCertConfig(st)
+		if err != nil {
+			return err
+		}
+
+		opts.pushCertNonce = pc.nonce(time.Now().Unix())
+
+		po, err := loadPushOptionsConfig(st)
+		if err != nil {
+			return err
+		}
+
+		opts.pushOptions = po.advertise
+	} else {
+		allowFilter, err := loadAllowFilter(st)
+		if err != nil {
+			return err
+		}
+
+		opts.filter = allowFilter
+	}
+
+	return advertiseReferences(ctx, st, w, service, smart, &opts)
+}
+
+// advertiseOptions holds the per-request capabilities advertised by the
+// server.
+type advertiseOptions struct {
+	// pushCertNonce is the nonce advertised with push-cert, if any.
+	pushCertNonce string
+	// pushOptions is true if push-options is advertised.
+	pushOptions bool
+	// filter is true if filter is advertised.
+	filter bool
+}
+
+func advertiseReferences(
+	ctx context.Context,
+	st storage.Storer,
+	w io.Writer,
+	service Service,
+	smart bool,
+	opts *advertiseOptions,
 ) error {
 	switch service {
 	case UploadPackService, ReceivePackService:
@@ -31,6 +79,11 @@ func AdvertiseReferences(
 		return fmt.Errorf("%w: %s", ErrUnsupportedService, service)
 	}
 
+	cfg, err := st.Config()
+	if err != nil {
+		return err
+	}
+
 	forPush := service == ReceivePackService
 	ar := packp.NewAdvRefs()
 
@@ -38,16 +91,27 @@ func AdvertiseReferences(
 	ar.Capabilities.Set(capability.Agent, capability.DefaultAgent()) //nolint:errcheck
 	ar.Capabilities.Set(capability.OFSDelta)                         //nolint:errcheck
 	ar.Capabilities.Set(capability.Sideband64k)                      //nolint:errcheck
+
+	// Clients assume SHA-1 when no object format is advertised, so it is only
+	// announced for the other formats.
+	if f := cfg.Extensions.ObjectFormat; f != config.SHA1 {
+		ar.Capabilities.Set(capability.ObjectFormat, f.String()) //nolint:errcheck
+	}
+
 	if forPush {
 		// TODO: support thin-pack
-		ar.Capabilities.Set(capability.NoThin) //nolint:errcheck
-		// TODO: support atomic
+		ar.Capabilities.Set(capability.NoThin)       //nolint:errcheck
+		ar.Capabilities.Set(capability.Atomic)       //nolint:errcheck
 		ar.Capabilities.Set(capability.DeleteRefs)   //nolint:errcheck
 		ar.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
-		ar.Capabilities.Set(capability.PushOptions)  //nolint:errcheck
 		ar.Capabilities.Set(capability.Quiet)        //nolint:errcheck
+		if opts.pushOptions {
+			ar.Capabilities.Set(capability.PushOptions) //nolint:errcheck
+		}
+		if opts.pushCertNonce != "" {
+			ar.Capabilities.Set(capability.PushCert, opts.pushCertNonce) //nolint:errcheck
+		}
 	} else {
-		// TODO: support include-tag
 		// TODO: support deepen
 		// TODO: support deepen-since
 		ar.Capabilities.Set(capability.MultiACK)         //nolint:errcheck
@@ -56,6 +120,10 @@ func AdvertiseReferences(
 		ar.Capabilities.Set(capability.NoProgress)       //nolint:errcheck
 		ar.Capabilities.Set(capability.SymRef)           //nolint:errcheck
 		ar.Capabilities.Set(capability.Shallow)          //nolint:errcheck
+		ar.Capabilities.Set(capability.IncludeTag)       //nolint:errcheck
+		if opts.filter {
+			ar.Capabilities.Set(capability.Filter) //nolint:errcheck
+		}
 	}
 
 	// Set references
@@ -29,16 +29,19 @@ func testAdvertise[T UploadPackOptions | ReceivePackOptions](
 	var out bytes.Buffer
 	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
 	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+	opts := new(T)
+	switch o := any(opts).(type) {
+	case *UploadPackOptions:
+		o.GitProtocol, o.AdvertiseRefs, o.StatelessRPC = proto, true, stateless
+	case *ReceivePackOptions:
+		o.GitProtocol, o.AdvertiseRefs, o.StatelessRPC = proto, true, stateless
+	}
 	err := fun(
 		context.TODO(),
 		st,
 		io.NopCloser(bytes.NewBuffer(nil)),
 		ioutil.WriteNopCloser(&out),
-		&T{
-			GitProtocol:   proto,
-			AdvertiseRefs: true,
-			StatelessRPC:  stateless,
-		},
+		opts,
 	)
 	require.NoError(t, err)
 	require.Greater(t, out.Len(), 0)
@@ -258,6 +258,9 @@ func newKnownHostsDb(files ...string) (*knownhosts.HostKeyDB, error) {
 		return nil, err
 	}
 	trace.SSH.Printf("ssh: filtered known_hosts sources %s", files)
+	if len(files) == 0 {
+		return nil, errNoKnownHosts
+	}
 
 	return knownhosts.NewDB(files...)
 }
@@ -294,10 +297,6 @@ func filterKnownHostsFiles(files ...string) ([]string, error) {
 		}
 	}
 
-	if len(out) == 0 {
-		return nil, fmt.Errorf("unable to find any valid known_hosts file, set SSH_KNOWN_HOSTS env variable")
-	}
-
 	return out, nil
 }
 
@@ -305,21 +304,17 @@ func filterKnownHostsFiles(files ...string) ([]string, error) {
 // configure HostKeyCallback into a ssh.ClientConfig.
 type HostKeyCallbackHelper struct {
 	// HostKeyCallback is the function type used for verifying server keys.
-	// If nil default callback will be create using NewKnownHostsCallback
-	// without argument.
+	// If nil, the default callback verifies them with the known_hosts files
+	// of ssh_config, adding the unknown ones to the UserKnownHostsFile when
+	// StrictHostKeyChecking is accept-new or no.
 	HostKeyCallback ssh.HostKeyCallback
 }
 
 // SetHostKeyCallback sets the field HostKeyCallback in the given cfg. If
-// HostKeyCallback is empty a default callback is created using
-// NewKnownHostsCallback.
+// HostKeyCallback is empty the default callback is used.
 func (m *HostKeyCallbackHelper) SetHostKeyCallback(cfg *ssh.ClientConfig) (*ssh.ClientConfig, error) {
 	if m.HostKeyCallback == nil {
-		db, err := newKnownHostsDb()
-		if err != nil {
-			return cfg, err
-		}
-		m.HostKeyCallback = db.HostKeyCallback()
+		m.HostKeyCallback = defaultHostKeyCallback
 	}
 
 	cfg.HostKeyCallback = m.traceHostKeyCallback
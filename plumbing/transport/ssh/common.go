@@ -137,18 +137,19 @@ func (c *command) connect(ctx context.Context) error {
 	}
 	hostWithPort := c.getHostWithPort()
 	if config.HostKeyCallback == nil {
-		db, err := newKnownHostsDb()
-		if err != nil {
-			return err
-		}
+		config.HostKeyCallback = defaultHostKeyCallback
+	}
 
-		config.HostKeyCallback = db.HostKeyCallback()
-		config.HostKeyAlgorithms = db.HostKeyAlgorithms(hostWithPort)
-	} else if len(config.HostKeyAlgorithms) == 0 {
+	if len(config.HostKeyAlgorithms) == 0 {
 		// Set the HostKeyAlgorithms based on HostKeyCallback.
 		// For background see https://github.com/go-git/go-git/issues/411 as well as
 		// https://github.com/golang/go/issues/29286 for root cause.
-		db, err := newKnownHostsDb()
+		khc, err := newKnownHostsConfig(c.endpoint.Host)
+		if err != nil {
+			return err
+		}
+
+		db, err := khc.db()
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh/knownhosts"
+	"github.com/go-git/go-git/v6/utils/trace"
+	"golang.org/x/crypto/ssh"
+)
+
+var errNoKnownHosts = errors.New("unable to find any valid known_hosts file, set SSH_KNOWN_HOSTS env variable")
+
+// knownHostsConfig holds the known_hosts options of ssh_config for a host.
+type knownHostsConfig struct {
+	files  []string
+	policy knownhosts.Policy
+}
+
+// newKnownHostsConfig returns the known_hosts options of ssh_config for the
+// given host: UserKnownHostsFile, GlobalKnownHostsFile, StrictHostKeyChecking
+// and HashKnownHosts. When set, the SSH_KNOWN_HOSTS environment variable
+// replaces the known_hosts files.
+func newKnownHostsConfig(host string) (*knownHostsConfig, error) {
+	get := func(string) string { return "" }
+	if DefaultSSHConfig != nil {
+		get = func(key string) string { return DefaultSSHConfig.Get(host, key) }
+	}
+
+	c := &knownHostsConfig{}
+	var err error
+	c.policy.StrictHostKeyChecking, err = knownhosts.ParseStrictHostKeyChecking(get("StrictHostKeyChecking"))
+	if err != nil {
+		return nil, err
+	}
+	c.policy.HashKnownHosts = strings.EqualFold(get("HashKnownHosts"), "yes")
+
+	if c.files = filepath.SplitList(os.Getenv("SSH_KNOWN_HOSTS")); len(c.files) != 0 {
+		trace.SSH.Printf("ssh: loading known_hosts from SSH_KNOWN_HOSTS")
+		c.policy.File = c.files[0]
+		return c, nil
+	}
+
+	userFiles := strings.Fields(get("UserKnownHostsFile"))
+	globalFiles := strings.Fields(get("GlobalKnownHostsFile"))
+	if len(userFiles) == 0 || len(globalFiles) == 0 {
+		defaults, err := getDefaultKnownHostsFiles()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(userFiles) == 0 {
+			userFiles = defaults[:1]
+		}
+		if len(globalFiles) == 0 {
+			globalFiles = defaults[1:]
+		}
+	}
+
+	for _, file := range append(userFiles, globalFiles...) {
+		// The none file disables the known_hosts files, like OpenSSH.
+		if strings.EqualFold(file, "none") {
+			continue
+		}
+
+		if file, err = expandKnownHostsFile(file); err != nil {
+			return nil, err
+		}
+		c.files = append(c.files, file)
+	}
+
+	if len(userFiles) > 0 && !strings.EqualFold(userFiles[0], "none") {
+		c.policy.File = c.files[0]
+	}
+
+	return c, nil
+}
+
+// expandKnownHostsFile expands the ~ and %d home directory prefixes of a
+// known_hosts file.
+func expandKnownHostsFile(file string) (string, error) {
+	var rest string
+	switch {
+	case file == "~", file == "%d":
+	case strings.HasPrefix(file, "~/"), strings.HasPrefix(file, "%d/"):
+		rest = file[2:]
+	default:
+		return file, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, rest), nil
+}
+
+// db returns the database of the existing known_hosts files. Unless unknown
+// host keys may be accepted, at least one file must exist.
+func (c *knownHostsConfig) db() (*knownhosts.HostKeyDB, error) {
+	trace.SSH.Printf("ssh: known_hosts sources %s", c.files)
+	files, err := filterKnownHostsFiles(c.files...)
+	if err != nil {
+		return nil, err
+	}
+	trace.SSH.Printf("ssh: filtered known_hosts sources %s", files)
+	if len(files) == 0 && c.policy.StrictHostKeyChecking == knownhosts.StrictHostKeyCheckingYes {
+		return nil, errNoKnownHosts
+	}
+
+	return knownhosts.NewDB(files...)
+}
+
+// hostKeyCallback returns a callback verifying the host keys following the
+// options.
+func (c *knownHostsConfig) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	db, err := c.db()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.HostKeyCallbackWithPolicy(c.policy), nil
+}
+
+// defaultHostKeyCallback verifies the host keys with the known_hosts files
+// and options of ssh_config for each host. The unknown host keys are only
+// accepted when StrictHostKeyChecking is accept-new or no.
+func defaultHostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host = hostname
+	}
+
+	c, err := newKnownHostsConfig(host)
+	if err != nil {
+		return err
+	}
+
+	callback, err := c.hostKeyCallback()
+	if errors.Is(err, errNoKnownHosts) {
+		return fmt.Errorf("%w, or set StrictHostKeyChecking to accept-new in ssh_config", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return callback(hostname, remote, key)
+}
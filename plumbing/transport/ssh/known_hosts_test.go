@@ -0,0 +1,103 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh/knownhosts"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func setSSHConfig(t *testing.T, values map[string]map[string]string) {
+	t.Helper()
+
+	old := DefaultSSHConfig
+	DefaultSSHConfig = &mockSSHConfig{Values: values}
+	t.Cleanup(func() { DefaultSSHConfig = old })
+}
+
+func TestNewKnownHostsConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_KNOWN_HOSTS", "")
+
+	setSSHConfig(t, map[string]map[string]string{
+		"github.com": {
+			"UserKnownHostsFile":    "~/.ssh/github_known_hosts %d/other",
+			"GlobalKnownHostsFile":  "/etc/ssh/github_known_hosts",
+			"StrictHostKeyChecking": "accept-new",
+			"HashKnownHosts":        "yes",
+		},
+		"none.example.com": {
+			"UserKnownHostsFile": "none",
+		},
+	})
+
+	c, err := newKnownHostsConfig("github.com")
+	require.NoError(t, err)
+	require.Equal(t, &knownHostsConfig{
+		files: []string{
+			filepath.Join(home, ".ssh", "github_known_hosts"),
+			filepath.Join(home, "other"),
+			"/etc/ssh/github_known_hosts",
+		},
+		policy: knownhosts.Policy{
+			StrictHostKeyChecking: knownhosts.StrictHostKeyCheckingAcceptNew,
+			File:                  filepath.Join(home, ".ssh", "github_known_hosts"),
+			HashKnownHosts:        true,
+		},
+	}, c)
+
+	c, err = newKnownHostsConfig("example.com")
+	require.NoError(t, err)
+	require.Equal(t, &knownHostsConfig{
+		files:  []string{filepath.Join(home, ".ssh", "known_hosts"), "/etc/ssh/ssh_known_hosts"},
+		policy: knownhosts.Policy{File: filepath.Join(home, ".ssh", "known_hosts")},
+	}, c)
+
+	c, err = newKnownHostsConfig("none.example.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/etc/ssh/ssh_known_hosts"}, c.files)
+	require.Empty(t, c.policy.File)
+
+	t.Setenv("SSH_KNOWN_HOSTS", "/tmp/a"+string(filepath.ListSeparator)+"/tmp/b")
+	c, err = newKnownHostsConfig("github.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/tmp/a", "/tmp/b"}, c.files)
+	require.Equal(t, "/tmp/a", c.policy.File)
+}
+
+func TestDefaultHostKeyCallback(t *testing.T) {
+	t.Setenv("SSH_KNOWN_HOSTS", "")
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	values := map[string]string{
+		"UserKnownHostsFile":   file,
+		"GlobalKnownHostsFile": "none",
+	}
+	setSSHConfig(t, map[string]map[string]string{"github.com": values})
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+	err = defaultHostKeyCallback("github.com:22", addr, key)
+	require.ErrorIs(t, err, errNoKnownHosts)
+	require.ErrorContains(t, err, "StrictHostKeyChecking")
+
+	values["StrictHostKeyChecking"] = "accept-new"
+	require.NoError(t, defaultHostKeyCallback("github.com:22", addr, key))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "github.com,127.0.0.1 ssh-ed25519 "), string(data))
+
+	// The key is now known, even with the strict checking.
+	values["StrictHostKeyChecking"] = "yes"
+	require.NoError(t, defaultHostKeyCallback("github.com:22", addr, key))
+}
@@ -0,0 +1,174 @@
+package knownhosts
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v6/utils/trace"
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// StrictHostKeyChecking defines how the host keys unknown to the known_hosts
+// files are handled, like the StrictHostKeyChecking option of ssh_config.
+type StrictHostKeyChecking int
+
+const (
+	// StrictHostKeyCheckingYes refuses the unknown host keys. It's the
+	// default.
+	StrictHostKeyCheckingYes StrictHostKeyChecking = iota
+	// StrictHostKeyCheckingAcceptNew adds the unknown host keys to the
+	// known_hosts file, but refuses the changed ones.
+	StrictHostKeyCheckingAcceptNew
+	// StrictHostKeyCheckingNo adds the unknown host keys to the known_hosts
+	// file, and accepts the changed ones.
+	StrictHostKeyCheckingNo
+)
+
+// ParseStrictHostKeyChecking parses a value of the StrictHostKeyChecking
+// option of ssh_config. Since there is no user to ask, ask is the same as
+// yes.
+func ParseStrictHostKeyChecking(s string) (StrictHostKeyChecking, error) {
+	switch strings.ToLower(s) {
+	case "yes", "ask", "":
+		return StrictHostKeyCheckingYes, nil
+	case "accept-new":
+		return StrictHostKeyCheckingAcceptNew, nil
+	case "no", "off":
+		return StrictHostKeyCheckingNo, nil
+	}
+
+	return StrictHostKeyCheckingYes, fmt.Errorf("knownhosts: invalid StrictHostKeyChecking %q", s)
+}
+
+// String returns the value of the StrictHostKeyChecking option of ssh_config.
+func (s StrictHostKeyChecking) String() string {
+	switch s {
+	case StrictHostKeyCheckingAcceptNew:
+		return "accept-new"
+	case StrictHostKeyCheckingNo:
+		return "no"
+	}
+
+	return "yes"
+}
+
+// Policy defines how the host keys unknown to a HostKeyDB are handled, like
+// the StrictHostKeyChecking and HashKnownHosts options of ssh_config.
+type Policy struct {
+	StrictHostKeyChecking StrictHostKeyChecking
+	// File is the known_hosts file the accepted host keys are added to,
+	// usually the first UserKnownHostsFile. It's created if missing.
+	File string
+	// HashKnownHosts hashes the host names of the added host keys.
+	HashKnownHosts bool
+}
+
+// HostKeyCallbackWithPolicy returns an ssh.HostKeyCallback verifying the host
+// keys with the known_hosts files of hkdb, and handling the unknown and
+// changed ones following p. The revoked host keys are always refused.
+func (hkdb *HostKeyDB) HostKeyCallbackWithPolicy(p Policy) ssh.HostKeyCallback {
+	callback := hkdb.HostKeyCallback()
+	if p.StrictHostKeyChecking == StrictHostKeyCheckingYes {
+		return callback
+	}
+
+	var mu sync.Mutex
+	added := make(map[string]ssh.PublicKey)
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		switch {
+		case err == nil:
+			return nil
+		case IsHostKeyChanged(err):
+			if p.StrictHostKeyChecking != StrictHostKeyCheckingNo {
+				return err
+			}
+
+			trace.SSH.Printf("ssh: accepting changed host key for %s: %s", hostname, ssh.FingerprintSHA256(key))
+			return nil
+		case !IsHostUnknown(err):
+			return err
+		}
+
+		if cert, ok := key.(*ssh.Certificate); ok {
+			key = cert.Key
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		address := Normalize(hostname)
+		if known, ok := added[address]; ok {
+			if bytes.Equal(known.Marshal(), key.Marshal()) {
+				return nil
+			}
+
+			if p.StrictHostKeyChecking != StrictHostKeyCheckingNo {
+				return &xknownhosts.KeyError{Want: []xknownhosts.KnownKey{{Key: known, Filename: p.File}}}
+			}
+		}
+
+		trace.SSH.Printf("ssh: adding host key for %s to %s: %s", hostname, p.File, ssh.FingerprintSHA256(key))
+		if err := appendKnownHost(p.File, hostname, remote, key, p.HashKnownHosts); err != nil {
+			return err
+		}
+
+		added[address] = key
+		return nil
+	}
+}
+
+// appendKnownHost appends the known_hosts line of a host key to file, with
+// hashed host names if hash is true.
+func appendKnownHost(file, hostname string, remote net.Addr, key ssh.PublicKey, hash bool) error {
+	if file == "" {
+		return fmt.Errorf("knownhosts: no known_hosts file to add the key of %s to", hostname)
+	}
+
+	var buf bytes.Buffer
+	if hash {
+		// Each host name is hashed in its own line, like ssh-keygen -H.
+		for _, address := range knownHostAddresses(hostname, remote) {
+			buf.WriteString(Line([]string{xknownhosts.HashHostname(address)}, key))
+			buf.WriteByte('\n')
+		}
+	} else if err := WriteKnownHost(&buf, hostname, remote, key); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+
+	return f.Close()
+}
+
+// knownHostAddresses returns the normalized addresses written by
+// WriteKnownHost for a host.
+func knownHostAddresses(hostname string, remote net.Addr) []string {
+	addresses := []string{Normalize(hostname)}
+	if remote != nil {
+		r := Normalize(remote.String())
+		if r != "[0.0.0.0]:0" && r != addresses[0] && !strings.ContainsAny(r, "\t ") {
+			addresses = append(addresses, r)
+		}
+	}
+
+	return addresses
+}
@@ -0,0 +1,170 @@
+package knownhosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseStrictHostKeyChecking(t *testing.T) {
+	for value, expected := range map[string]StrictHostKeyChecking{
+		"":           StrictHostKeyCheckingYes,
+		"yes":        StrictHostKeyCheckingYes,
+		"ask":        StrictHostKeyCheckingYes,
+		"accept-new": StrictHostKeyCheckingAcceptNew,
+		"No":         StrictHostKeyCheckingNo,
+		"off":        StrictHostKeyCheckingNo,
+	} {
+		s, err := ParseStrictHostKeyChecking(value)
+		require.NoError(t, err, value)
+		require.Equal(t, expected, s, value)
+	}
+
+	_, err := ParseStrictHostKeyChecking("maybe")
+	require.Error(t, err)
+	require.Equal(t, "accept-new", StrictHostKeyCheckingAcceptNew.String())
+}
+
+func TestHostKeyCallbackWithPolicy(t *testing.T) {
+	dir := t.TempDir()
+	known := filepath.Join(dir, "known_hosts")
+	knownKey := generatePubKeyEd25519(t)
+	f, err := os.Create(known)
+	require.NoError(t, err)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	require.NoError(t, WriteKnownHost(f, "known.example.test:22", addr, knownKey))
+	require.NoError(t, f.Close())
+
+	db, err := NewDB(known)
+	require.NoError(t, err)
+
+	newKey := generatePubKeyEd25519(t)
+	otherKey := generatePubKeyEd25519(t)
+	for _, tc := range []struct {
+		strict      StrictHostKeyChecking
+		hash        bool
+		unknown     bool
+		changed     bool
+		addedLines  int
+		changedLast bool
+	}{
+		{strict: StrictHostKeyCheckingYes},
+		{strict: StrictHostKeyCheckingAcceptNew, unknown: true, addedLines: 1},
+		{strict: StrictHostKeyCheckingAcceptNew, hash: true, unknown: true, addedLines: 2},
+		{strict: StrictHostKeyCheckingNo, unknown: true, changed: true, addedLines: 1, changedLast: true},
+	} {
+		t.Run(tc.strict.String(), func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+			cb := db.HostKeyCallbackWithPolicy(Policy{
+				StrictHostKeyChecking: tc.strict,
+				File:                  file,
+				HashKnownHosts:        tc.hash,
+			})
+
+			require.NoError(t, cb("known.example.test:22", addr, knownKey))
+
+			err := cb("known.example.test:22", addr, newKey)
+			if tc.changed {
+				require.NoError(t, err)
+			} else {
+				require.True(t, IsHostKeyChanged(err))
+			}
+
+			err = cb("new.example.test:22", addr, newKey)
+			if !tc.unknown {
+				require.True(t, IsHostUnknown(err))
+				require.NoFileExists(t, file)
+				return
+			}
+			require.NoError(t, err)
+
+			// The added key is accepted again, but not a different one.
+			require.NoError(t, cb("new.example.test:22", addr, newKey))
+			err = cb("new.example.test:22", addr, otherKey)
+			if tc.changedLast {
+				require.NoError(t, err)
+			} else {
+				require.True(t, IsHostKeyChanged(err))
+			}
+
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			require.Len(t, lines, tc.addedLines+boolToInt(tc.changedLast))
+			for _, line := range lines {
+				require.Equal(t, tc.hash, strings.HasPrefix(line, "|1|"), line)
+			}
+
+			fi, err := os.Stat(file)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+			// The added key is known to a new database.
+			added, err := NewDB(file)
+			require.NoError(t, err)
+			require.NoError(t, added.HostKeyCallback()("new.example.test:22", addr, newKey))
+		})
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func TestHostKeyCallbackWithPolicyRevoked(t *testing.T) {
+	key := generatePubKeyEd25519(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(file, []byte("@revoked * "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))+"\n"), 0o600))
+
+	db, err := NewDB(file)
+	require.NoError(t, err)
+	cb := db.HostKeyCallbackWithPolicy(Policy{StrictHostKeyChecking: StrictHostKeyCheckingNo, File: file})
+
+	var revoked *xknownhosts.RevokedError
+	err = cb("revoked.example.test:22", &net.TCPAddr{}, key)
+	require.True(t, errors.As(err, &revoked))
+}
+
+func TestHostKeyCallbackWithPolicyCertAuthority(t *testing.T) {
+	_, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ca, err := ssh.NewSignerFromKey(caPriv)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	f, err := os.Create(file)
+	require.NoError(t, err)
+	require.NoError(t, WriteKnownHostCA(f, "*.example.test", ca.PublicKey()))
+	require.NoError(t, f.Close())
+
+	hostKey := generatePubKeyEd25519(t)
+	cert := &ssh.Certificate{
+		Key:             hostKey,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"host.example.test"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+
+	db, err := NewDB(file)
+	require.NoError(t, err)
+	cb := db.HostKeyCallbackWithPolicy(Policy{StrictHostKeyChecking: StrictHostKeyCheckingAcceptNew, File: file})
+	require.NoError(t, cb("host.example.test:22", &net.TCPAddr{}, cert))
+	require.Equal(t, []string{ssh.CertAlgoED25519v01}, db.HostKeyAlgorithms("host.example.test:22"))
+
+	// The certificate is refused for other hosts.
+	require.Error(t, cb("other.example.test:22", &net.TCPAddr{}, cert))
+}
@@ -3,9 +3,11 @@ package transport
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strings"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
@@ -20,6 +22,15 @@ import (
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
+const (
+	uploadPackSection = "uploadpack"
+	allowFilterKey    = "allowFilter"
+)
+
+// ErrFilterNotAllowed is returned by UploadPack when the client sends a filter
+// although uploadpack.allowFilter isn't set.
+var ErrFilterNotAllowed = errors.New("filter not allowed")
+
 // UploadPackOptions is a set of options for the UploadPack service.
 type UploadPackOptions struct {
 	GitProtocol   string
@@ -244,12 +255,32 @@ func UploadPack(
 		return fmt.Errorf("closing reader: %w", err)
 	}
 
-	objs, err := objectsToUpload(st, wants, haves)
+	if upreq.Filter != "" {
+		if err := checkFilter(st, upreq.Filter); err != nil {
+			// Like git, the error is reported to the client.
+			if werr := (&pktline.ErrorLine{Text: err.Error()}).Encode(w); werr != nil {
+				return werr
+			}
+
+			w.Close() //nolint:errcheck
+			return err
+		}
+	}
+
+	objs, err := objectsToUpload(st, wants, haves, upreq.Filter)
 	if err != nil {
 		w.Close() //nolint:errcheck
 		return fmt.Errorf("getting objects to upload: %w", err)
 	}
 
+	if caps.Supports(capability.IncludeTag) {
+		objs, err = includeTags(st, objs)
+		if err != nil {
+			w.Close() //nolint:errcheck
+			return fmt.Errorf("including tags: %w", err)
+		}
+	}
+
 	var (
 		useSideband bool
 		writer      io.Writer = w
@@ -285,8 +316,103 @@ func UploadPack(
 	return nil
 }
 
-func objectsToUpload(st storage.Storer, wants, haves []plumbing.Hash) ([]plumbing.Hash, error) {
-	return revlist.Objects(st, wants, haves)
+// loadAllowFilter returns uploadpack.allowFilter, false by default.
+func loadAllowFilter(st storage.Storer) (bool, error) {
+	cfg, err := st.Config()
+	if err != nil {
+		return false, err
+	}
+
+	switch v := cfg.Raw.Section(uploadPackSection).Options.Get(allowFilterKey); strings.ToLower(v) {
+	case "", "false", "no", "off", "0":
+		return false, nil
+	case "true", "yes", "on", "1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid %s.%s: %q", uploadPackSection, allowFilterKey, v)
+	}
+}
+
+// checkFilter returns an error if the filter sent by the client isn't
+// allowed or can't be parsed.
+func checkFilter(st storage.Storer, filter packp.Filter) error {
+	allowFilter, err := loadAllowFilter(st)
+	if err != nil {
+		return err
+	}
+
+	if !allowFilter {
+		return ErrFilterNotAllowed
+	}
+
+	_, err = revlist.ParseFilter(string(filter))
+	return err
+}
+
+func objectsToUpload(st storage.Storer, wants, haves []plumbing.Hash, filter packp.Filter) ([]plumbing.Hash, error) {
+	if filter == "" {
+		return revlist.Objects(st, wants, haves)
+	}
+
+	f, err := revlist.ParseFilter(string(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	return revlist.ObjectsWithFilter(st, wants, haves, f)
+}
+
+// includeTags appends to objs the annotated tags pointing, directly or
+// through other tags, to any of the objects being sent, as requested by
+// the include-tag capability.
+func includeTags(st storage.Storer, objs []plumbing.Hash) ([]plumbing.Hash, error) {
+	sending := make(map[plumbing.Hash]struct{}, len(objs))
+	for _, h := range objs {
+		sending[h] = struct{}{}
+	}
+
+	iter, err := st.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !ref.Name().IsTag() {
+			return nil
+		}
+
+		var chain []plumbing.Hash
+		h := ref.Hash()
+		for {
+			if _, ok := sending[h]; ok {
+				break
+			}
+
+			tag, err := object.GetTag(st, h)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				// Lightweight tags and tags pointing to missing objects.
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			chain = append(chain, h)
+			h = tag.Target
+		}
+
+		for _, h := range chain {
+			objs = append(objs, h)
+			sending[h] = struct{}{}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objs, nil
 }
 
 func getShallowCommits(st storage.Storer, heads []plumbing.Hash, depth int, upd *packp.ShallowUpdate) error {
@@ -1,8 +1,18 @@
 package transport
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"testing"
 
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -27,3 +37,67 @@ func (s *UploadPackSuite) TestUploadPackAdvertiseV1() {
 	buf := testAdvertise(s.T(), UploadPack, "version=1", false)
 	s.Containsf(buf.String(), "version 1", "advertisement should contain version 1")
 }
+
+func (s *UploadPackSuite) TestIncludeTags() {
+	st := filesystem.NewStorage(fixtures.ByTag("tags").One().DotGit(), cache.NewObjectLRUDefault())
+
+	master := plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f")
+	objs, err := objectsToUpload(st, []plumbing.Hash{master}, nil, "")
+	s.Require().NoError(err)
+
+	withTags, err := includeTags(st, objs)
+	s.Require().NoError(err)
+	s.Subset(withTags, objs)
+
+	tags := withTags[len(objs):]
+	s.ElementsMatch([]plumbing.Hash{
+		plumbing.NewHash("b742a2a9fa0afcfa9a6fad080980fbc26b007c69"),
+		plumbing.NewHash("ad7897c0fb8e7d9a9ba41fa66072cf06095a6cfc"),
+		plumbing.NewHash("152175bf7e5580299fa1f0ba41ef6474cc043b70"),
+		plumbing.NewHash("fe6cb94756faa81e5ed9240f9191b833db5f40ae"),
+	}, tags)
+}
+
+func (s *UploadPackSuite) TestUploadPackFilter() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	upload := func(filter packp.Filter) (string, error) {
+		upreq := packp.NewUploadRequest()
+		upreq.Wants = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+		upreq.Capabilities.Set(capability.Filter) //nolint:errcheck
+		upreq.Filter = filter
+
+		var in, out bytes.Buffer
+		s.Require().NoError(upreq.Encode(&in))
+		s.Require().NoError((&packp.UploadHaves{Done: true}).Encode(&in))
+
+		err := UploadPack(context.TODO(), st, io.NopCloser(&in), ioutil.WriteNopCloser(&out),
+			&UploadPackOptions{StatelessRPC: true})
+		return out.String(), err
+	}
+
+	// The filters are only accepted with uploadpack.allowFilter.
+	adv := testAdvertise(s.T(), UploadPack, "", false)
+	s.NotContains(adv.String(), " filter")
+	out, err := upload(packp.FilterBlobNone())
+	s.ErrorIs(err, ErrFilterNotAllowed)
+	s.Contains(out, "ERR "+ErrFilterNotAllowed.Error())
+
+	cfg, err := st.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section(uploadPackSection).SetOption(allowFilterKey, "true")
+	s.Require().NoError(st.SetConfig(cfg))
+
+	var buf bytes.Buffer
+	s.Require().NoError(AdvertiseReferences(context.TODO(), st, &buf, UploadPackService, false))
+	s.Contains(buf.String(), " filter")
+
+	_, err = upload(packp.FilterBlobNone())
+	s.NoError(err)
+
+	// The errors parsing the filter are reported to the client.
+	out, err = upload("invalid")
+	s.Error(err)
+	s.Contains(out, "ERR "+err.Error())
+}
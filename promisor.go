@@ -0,0 +1,170 @@
+package git
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/promisor"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// SetPromisorOptions sets how the objects missing from a partial clone are
+// fetched from its promisor remote, such as the credentials and the context
+// of the fetches. It does nothing if the repository isn't a partial clone.
+func (r *Repository) SetPromisorOptions(o *PromisorOptions) error {
+	return r.setupPromisor(o)
+}
+
+// setupPromisor wraps the storer of a partial clone, so the objects missing
+// from it are fetched from its promisor remote when needed. The promisor
+// remote is the one set in extensions.partialClone, or the first remote
+// with remote.<name>.promisor set.
+func (r *Repository) setupPromisor(o *PromisorOptions) error {
+	base := baseStorer(r.Storer)
+	cfg, err := base.Config()
+	if err != nil {
+		return err
+	}
+
+	name := cfg.Extensions.PartialClone
+	if name == "" {
+		for _, rc := range cfg.Remotes {
+			if rc.Promisor {
+				name = rc.Name
+				break
+			}
+		}
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	f := &promisorFetcher{s: base, remote: name, o: o}
+	r.Storer = promisor.NewStorageWithOptions(base, f, promisor.Options{Context: o.Context})
+	return nil
+}
+
+// setPartialClone records the given remote as the promisor remote of the
+// repository, in extensions.partialClone.
+func (r *Repository) setPartialClone(remote string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.PartialClone = remote
+	return r.SetConfig(cfg)
+}
+
+// baseStorer returns the storer wrapped by the promisor storage of partial
+// clones, or s itself.
+func baseStorer(s storage.Storer) storage.Storer {
+	if ps, ok := s.(promisor.Storage); ok {
+		return ps.Base()
+	}
+
+	return s
+}
+
+// promisorFetcher fetches the objects missing from a partial clone from its
+// promisor remote.
+type promisorFetcher struct {
+	s      storage.Storer
+	remote string
+	o      *PromisorOptions
+}
+
+// FetchObjects implements promisor.Fetcher. Like git, only the requested
+// objects are fetched when the remote supports filters, e.g. fetching a
+// missing commit doesn't fetch all the blobs of its history.
+func (f *promisorFetcher) FetchObjects(ctx context.Context, hashes []plumbing.Hash) (err error) {
+	cfg, err := f.s.Config()
+	if err != nil {
+		return err
+	}
+
+	rc, ok := cfg.Remotes[f.remote]
+	if !ok {
+		return ErrRemoteNotFound
+	}
+
+	if len(rc.URLs) == 0 {
+		return ErrEmptyUrls
+	}
+
+	c, ep, err := newClient(rc.URLs[0], f.o.InsecureSkipTLS, f.o.CABundle, f.o.ProxyOptions)
+	if err != nil {
+		return err
+	}
+
+	sess, err := c.NewSession(f.s, ep, f.o.Auth)
+	if err != nil {
+		return err
+	}
+
+	conn, err := sess.Handshake(ctx, transport.UploadPackService)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(conn, &err)
+
+	req := &transport.FetchRequest{Wants: hashes}
+	if conn.Capabilities().Supports(capability.Filter) {
+		req.Filter = packp.FilterBlobNone()
+	}
+
+	return fetchPromisorPack(f.s, func() error {
+		return conn.Fetch(ctx, req)
+	})
+}
+
+// fetchPromisorPack runs fetch, marking the packfiles it adds to s as
+// received from a promisor remote.
+func fetchPromisorPack(s storage.Storer, fetch func() error) error {
+	s = baseStorer(s)
+	pps, ok := s.(storer.PromisorPackStorer)
+	pos, isPacked := s.(storer.PackedObjectStorer)
+	if !ok || !isPacked {
+		return fetch()
+	}
+
+	before, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	if err := fetch(); err != nil {
+		return err
+	}
+
+	after, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[plumbing.Hash]struct{}, len(before))
+	for _, h := range before {
+		existing[h] = struct{}{}
+	}
+
+	var errs []error
+	for _, h := range after {
+		if _, ok := existing[h]; ok {
+			continue
+		}
+
+		errs = append(errs, pps.SetPromisorPack(h))
+	}
+
+	return errors.Join(errs...)
+}
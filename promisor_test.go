@@ -0,0 +1,127 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/promisor"
+	"github.com/stretchr/testify/suite"
+)
+
+type PromisorSuite struct {
+	BaseSuite
+}
+
+func TestPromisorSuite(t *testing.T) {
+	suite.Run(t, new(PromisorSuite))
+}
+
+// newPartialClone returns an empty repository with the basic fixture as its
+// promisor remote.
+func (s *PromisorSuite) newPartialClone() (*Repository, string) {
+	dir := s.T().TempDir()
+	r, err := PlainInit(dir, true)
+	s.Require().NoError(err)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:               DefaultRemoteName,
+		URLs:               []string{s.GetBasicFilterLocalRepositoryURL()},
+		Promisor:           true,
+		PartialCloneFilter: "blob:none",
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(r.setPartialClone(DefaultRemoteName))
+
+	r, err = PlainOpen(dir)
+	s.Require().NoError(err)
+	return r, dir
+}
+
+func (s *PromisorSuite) TestConfig() {
+	r, _ := s.newPartialClone()
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.Equal(DefaultRemoteName, cfg.Extensions.PartialClone)
+	s.True(cfg.Remotes[DefaultRemoteName].Promisor)
+	s.Equal("blob:none", cfg.Remotes[DefaultRemoteName].PartialCloneFilter)
+}
+
+func (s *PromisorSuite) TestLazyFetch() {
+	r, dir := s.newPartialClone()
+	s.Require().Implements((*promisor.Storage)(nil), r.Storer)
+
+	blob, err := r.BlobObject(plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d"))
+	s.Require().NoError(err)
+	s.Equal(int64(76110), blob.Size)
+
+	matches, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "pack-*.promisor"))
+	s.Require().NoError(err)
+	s.Len(matches, 1)
+
+	// Objects unknown to the remote are reported by the fetch.
+	_, err = r.BlobObject(plumbing.NewHash("0000000000000000000000000000000000000001"))
+	s.Error(err)
+}
+
+func (s *PromisorSuite) TestLazyFetchCommit() {
+	r, _ := s.newPartialClone()
+
+	commit, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.Require().NoError(err)
+
+	file, err := commit.File("CHANGELOG")
+	s.Require().NoError(err)
+
+	content, err := file.Contents()
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(content, "Initial changelog"))
+}
+
+func (s *PromisorSuite) TestSetPromisorOptions() {
+	r, _ := s.newPartialClone()
+	h := plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.Require().NoError(r.SetPromisorOptions(&PromisorOptions{Context: ctx}))
+	_, err := r.BlobObject(h)
+	s.ErrorIs(err, context.Canceled)
+
+	s.Require().NoError(r.SetPromisorOptions(&PromisorOptions{Context: context.Background()}))
+	_, err = r.BlobObject(h)
+	s.NoError(err)
+}
+
+func (s *PromisorSuite) TestEmptyUrls() {
+	r, dir := s.newPartialClone()
+
+	// A promisor remote without URLs can't be set with SetConfig.
+	cfg := "[core]\n\trepositoryformatversion = 1\n\tbare = true\n" +
+		"[remote \"origin\"]\n\tpromisor = true\n" +
+		"[extensions]\n\tpartialclone = origin\n"
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "config"), []byte(cfg), 0o644))
+
+	f := &promisorFetcher{s: baseStorer(r.Storer), remote: DefaultRemoteName}
+	err := f.FetchObjects(context.Background(), []plumbing.Hash{plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d")})
+	s.ErrorIs(err, ErrEmptyUrls)
+
+	matches, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "pack-*.promisor"))
+	s.Require().NoError(err)
+	s.Empty(matches)
+}
+
+func (s *PromisorSuite) TestNotPartialClone() {
+	r, err := PlainInit(s.T().TempDir(), true)
+	s.Require().NoError(err)
+	s.Require().NoError(r.setupPromisor(&PromisorOptions{}))
+
+	_, ok := r.Storer.(promisor.Storage)
+	s.False(ok)
+}
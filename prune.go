@@ -22,7 +22,7 @@ var ErrLooseObjectsNotSupported = errors.New("loose objects not supported")
 // DeleteObject deletes an object from a repository.
 // The type conveniently matches PruneHandler.
 func (r *Repository) DeleteObject(hash plumbing.Hash) error {
-	los, ok := r.Storer.(storer.LooseObjectStorer)
+	los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer)
 	if !ok {
 		return ErrLooseObjectsNotSupported
 	}
@@ -31,7 +31,7 @@ func (r *Repository) DeleteObject(hash plumbing.Hash) error {
 }
 
 func (r *Repository) Prune(opt PruneOptions) error {
-	los, ok := r.Storer.(storer.LooseObjectStorer)
+	los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer)
 	if !ok {
 		return ErrLooseObjectsNotSupported
 	}
@@ -41,6 +41,13 @@ func (r *Repository) Prune(opt PruneOptions) error {
 	if err != nil {
 		return err
 	}
+
+	return pruneObjects(los, pw, opt)
+}
+
+// pruneObjects calls the handler of opt with the loose objects of los which
+// weren't seen by pw.
+func pruneObjects(los storer.LooseObjectStorer, pw *objectWalker, opt PruneOptions) error {
 	// Now walk all (loose) objects in storage.
 	return los.ForEachObjectHash(func(hash plumbing.Hash) error {
 		// Get out if we have seen this object.
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -15,6 +16,8 @@ import (
 	"github.com/go-git/go-git/v6/internal/url"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/archive"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
@@ -30,12 +33,15 @@ import (
 )
 
 var (
-	NoErrAlreadyUpToDate     = errors.New("already up-to-date")
-	ErrDeleteRefNotSupported = errors.New("server does not support delete-refs")
-	ErrForceNeeded           = errors.New("some refs were not updated")
-	ErrExactSHA1NotSupported = errors.New("server does not support exact SHA1 refspec")
-	ErrEmptyUrls             = errors.New("URLs cannot be empty")
-	ErrRemoteRefNotFound     = errors.New("couldn't find remote ref")
+	NoErrAlreadyUpToDate      = errors.New("already up-to-date")
+	ErrDeleteRefNotSupported  = errors.New("server does not support delete-refs")
+	ErrForceNeeded            = errors.New("some refs were not updated")
+	ErrExactSHA1NotSupported  = errors.New("server does not support exact SHA1 refspec")
+	ErrEmptyUrls              = errors.New("URLs cannot be empty")
+	ErrRemoteRefNotFound      = errors.New("couldn't find remote ref")
+	ErrSignedPushNotSupported = errors.New("server does not support signed push")
+	ErrMissingPusher          = errors.New("signed push requires a committer or user identity")
+	ErrObjectFormatMismatch   = errors.New("object format of the remote doesn't match the one of the repository")
 )
 
 const (
@@ -117,6 +123,67 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 		return err
 	}
 
+	translate, err := r.checkObjectFormat(conn.Capabilities(), false)
+	if err != nil {
+		return err
+	}
+
+	if translate {
+		return r.pushCompat(ctx, conn, func(st storage.Storer) (transport.Connection, error) {
+			sess, err := c.NewSession(st, ep, o.Auth)
+			if err != nil {
+				return nil, err
+			}
+
+			return sess.Handshake(ctx, transport.ReceivePackService)
+		}, o)
+	}
+
+	return r.push(ctx, conn, o)
+}
+
+// pushCompat pushes to a remote using the compat object format of the
+// repository, through a view of the repository in that format used by conn,
+// or by a new connection from connect if conn can't use it.
+func (r *Remote) pushCompat(ctx context.Context, conn transport.Connection, connect func(storage.Storer) (transport.Connection, error), o *PushOptions) error {
+	cs, err := newCompatStorage(r.s)
+	if err != nil {
+		return err
+	}
+
+	conn, err = useStorer(conn, cs, connect)
+	if err != nil {
+		return err
+	}
+
+	err = (&Remote{c: r.c, s: cs}).push(ctx, conn, o)
+	if err != nil && !errors.Is(err, NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	if err := cs.flush(); err != nil {
+		return err
+	}
+
+	return err
+}
+
+// useStorer makes conn use st, or returns a new connection using st from
+// connect if conn can't change its storer.
+func useStorer(conn transport.Connection, st storage.Storer, connect func(storage.Storer) (transport.Connection, error)) (transport.Connection, error) {
+	if ss, ok := conn.(transport.StorerSetter); ok {
+		ss.SetStorer(st)
+		return conn, nil
+	}
+
+	if err := conn.Close(); err != nil {
+		return nil, fmt.Errorf("error closing connection: %w", err)
+	}
+
+	return connect(st)
+}
+
+func (r *Remote) push(ctx context.Context, conn transport.Connection, o *PushOptions) error {
 	rRefs, err := conn.GetRemoteRefs(ctx)
 	if err != nil {
 		return err
@@ -150,6 +217,10 @@ func (r *Remote) sendPack(ctx context.Context, conn transport.Connection, remote
 		return ErrDeleteRefNotSupported
 	}
 
+	if o.SignedPush != nil && !caps.Supports(capability.PushCert) {
+		return ErrSignedPushNotSupported
+	}
+
 	if o.Force {
 		for i := 0; i < len(o.RefSpecs); i++ {
 			rs := &o.RefSpecs[i]
@@ -339,7 +410,7 @@ func (r *Remote) updateRemoteReferenceStorage(
 // operation is complete, an error is returned. The context only affects the
 // transport operations.
 func (r *Remote) FetchContext(ctx context.Context, o *FetchOptions) error {
-	_, err := r.fetch(ctx, o)
+	_, err := r.fetch(ctx, o, false)
 	return err
 }
 
@@ -352,7 +423,9 @@ func (r *Remote) Fetch(o *FetchOptions) error {
 	return r.FetchContext(context.Background(), o)
 }
 
-func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.ReferenceStorer, err error) {
+// fetch fetches from the remote. When clone is true, the repository is the
+// new one of a clone, which takes the object format of the remote.
+func (r *Remote) fetch(ctx context.Context, o *FetchOptions, clone bool) (sto storer.ReferenceStorer, err error) {
 	if o.RemoteName == "" {
 		o.RemoteName = r.c.Name
 	}
@@ -388,6 +461,26 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 		return nil, err
 	}
 
+	translate, err := r.checkObjectFormat(conn.Capabilities(), clone)
+	if err != nil {
+		return nil, err
+	}
+
+	if translate {
+		return r.fetchCompat(ctx, conn, func(st storage.Storer) (transport.Connection, error) {
+			sess, err := c.NewSession(st, ep, o.Auth)
+			if err != nil {
+				return nil, err
+			}
+
+			return sess.Handshake(ctx, transport.UploadPackService)
+		}, o)
+	}
+
+	return r.fetchPack(ctx, conn, o)
+}
+
+func (r *Remote) fetchPack(ctx context.Context, conn transport.Connection, o *FetchOptions) (sto storer.ReferenceStorer, err error) {
 	rRefs, err := conn.GetRemoteRefs(ctx)
 	if err != nil {
 		return nil, err
@@ -436,7 +529,20 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 			Filter:      o.Filter,
 		}
 
-		if err := conn.Fetch(ctx, req); err != nil && !errors.Is(err, transport.ErrNoChange) {
+		fetch := func() error { return conn.Fetch(ctx, req) }
+		if r.c.Promisor {
+			// Like git, later fetches from a promisor remote use the filter
+			// of the partial clone.
+			if req.Filter == "" {
+				req.Filter = packp.Filter(r.c.PartialCloneFilter)
+			}
+
+			fetch = func() error {
+				return fetchPromisorPack(r.s, func() error { return conn.Fetch(ctx, req) })
+			}
+		}
+
+		if err := fetch(); err != nil && !errors.Is(err, transport.ErrNoChange) {
 			// Note: We receive ErrNoChange when remote is the same as local. At
 			// this point, we have everything we're asking for.
 			return nil, err
@@ -485,6 +591,60 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 	return remoteRefs, nil
 }
 
+// fetchCompat fetches from a remote using the compat object format of the
+// repository, through a view of the repository in that format used by conn,
+// or by a new connection from connect if conn can't use it. The references
+// of the remote returned are converted back, the ones whose objects weren't
+// fetched are left out.
+func (r *Remote) fetchCompat(ctx context.Context, conn transport.Connection, connect func(storage.Storer) (transport.Connection, error), o *FetchOptions) (storer.ReferenceStorer, error) {
+	cs, err := newCompatStorage(r.s)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err = useStorer(conn, cs, connect)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteRefs, err := (&Remote{c: r.c, s: cs}).fetchPack(ctx, conn, o)
+	if err != nil && !errors.Is(err, NoErrAlreadyUpToDate) {
+		return nil, err
+	}
+
+	if err := cs.flush(); err != nil {
+		return nil, err
+	}
+
+	iter, ierr := remoteRefs.IterReferences()
+	if ierr != nil {
+		return nil, ierr
+	}
+
+	refs := memory.ReferenceStorage{}
+	ierr = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			id, err := cs.objectID(ref.Hash())
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			ref = plumbing.NewHashReference(ref.Name(), id)
+		}
+
+		return refs.SetReference(ref)
+	})
+	if ierr != nil {
+		return nil, ierr
+	}
+
+	return refs, err
+}
+
 func referenceStorageFromRefs(refs []*plumbing.Reference, filterPeeled bool) memory.ReferenceStorage {
 	refStore := memory.ReferenceStorage{}
 	for _, ref := range refs {
@@ -1013,7 +1173,7 @@ func objectExists(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
 }
 
 func checkFastForwardUpdate(s storer.EncodedObjectStorer, remoteRefs storer.ReferenceStorer, cmd *packp.Command) error {
-	if cmd.Old == plumbing.ZeroHash {
+	if cmd.Old.IsZero() {
 		_, err := remoteRefs.Reference(cmd.Name)
 		if err == plumbing.ErrReferenceNotFound {
 			return nil
@@ -1091,6 +1251,92 @@ func (r *Remote) isSupportedRefSpec(refs []config.RefSpec, caps *capability.List
 	return ErrExactSHA1NotSupported
 }
 
+// checkObjectFormat checks that the object format advertised by the remote,
+// SHA-1 when it's not, is the one of the repository. When adopt is true, an
+// empty repository, as the one of a clone, takes the object format of the
+// remote instead. When the object format of the remote is the compat object
+// format of the repository, translate is true and the objects must be
+// converted to talk to the remote.
+func (r *Remote) checkObjectFormat(caps *capability.List, adopt bool) (translate bool, err error) {
+	remote := formatcfg.SHA1
+	if f := caps.Get(capability.ObjectFormat); len(f) == 1 {
+		switch f[0] {
+		case formatcfg.SHA1.String():
+		case formatcfg.SHA256.String():
+			remote = formatcfg.SHA256
+		default:
+			return false, fmt.Errorf("%w: %s", formatcfg.ErrInvalidObjectFormat, f[0])
+		}
+	}
+
+	cfg, err := r.s.Config()
+	if err != nil {
+		return false, err
+	}
+
+	if cfg.Extensions.ObjectFormat == remote {
+		return false, nil
+	}
+
+	if compat := cfg.Extensions.CompatObjectFormat; compat != nil && *compat == remote {
+		if _, ok := baseStorer(r.s).(storer.CompatObjectStorer); ok {
+			return true, nil
+		}
+	}
+
+	if !adopt {
+		return false, fmt.Errorf("%w: %s, expected %s", ErrObjectFormatMismatch, remote, cfg.Extensions.ObjectFormat)
+	}
+
+	empty, err := isEmptyStorage(r.s)
+	if err != nil {
+		return false, err
+	}
+
+	if !empty {
+		return false, fmt.Errorf("%w: %s, expected %s", ErrObjectFormatMismatch, remote, cfg.Extensions.ObjectFormat)
+	}
+
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.ObjectFormat = remote
+	return false, r.s.SetConfig(cfg)
+}
+
+// isEmptyStorage returns true if s has no object and no reference other than
+// the symbolic ones.
+func isEmptyStorage(s storage.Storer) (bool, error) {
+	refs, err := s.IterReferences()
+	if err != nil {
+		return false, err
+	}
+
+	var found bool
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			found = true
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil || found {
+		return false, err
+	}
+
+	objs, err := s.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return false, err
+	}
+
+	defer objs.Close()
+
+	if _, err := objs.Next(); !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func buildSidebandIfSupported(l *capability.List, reader io.Reader, p sideband.Progress) io.Reader {
 	var t sideband.Type
 
@@ -1283,10 +1529,57 @@ func (r *Remote) list(ctx context.Context, o *ListOptions) (rfs []*plumbing.Refe
 	return resultRefs, nil
 }
 
+// Archive requests an archive of the given tree-ish from the remote
+// repository, using the git-upload-archive service. The returned reader
+// streams the archive in the given format and must be closed by the caller.
+func (r *Remote) Archive(ctx context.Context, treeish string, format archive.Format, prefix string) (io.ReadCloser, error) {
+	return r.ArchiveWithOptions(ctx, &ArchiveOptions{
+		Treeish: treeish,
+		Format:  format,
+		Prefix:  prefix,
+	})
+}
+
+// ArchiveWithOptions requests an archive from the remote repository, like
+// Archive does, using the given options.
+func (r *Remote) ArchiveWithOptions(ctx context.Context, o *ArchiveOptions) (io.ReadCloser, error) {
+	if r.c == nil || len(r.c.URLs) == 0 {
+		return nil, ErrEmptyUrls
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	c, ep, err := newClient(r.c.URLs[0], o.InsecureSkipTLS, o.CABundle, o.ProxyOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := c.NewSession(r.s, ep, o.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	archiver, ok := s.(transport.Archiver)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", transport.ErrUnsupportedService, transport.UploadArchiveService)
+	}
+
+	return archiver.Archive(ctx, &transport.ArchiveRequest{
+		Treeish:          o.Treeish,
+		Format:           o.Format,
+		Prefix:           o.Prefix,
+		Paths:            o.Paths,
+		CompressionLevel: o.CompressionLevel,
+		Progress:         o.Progress,
+	})
+}
+
 func objectsToPush(commands []*packp.Command) []plumbing.Hash {
 	objects := make([]plumbing.Hash, 0, len(commands))
 	for _, cmd := range commands {
-		if cmd.New == plumbing.ZeroHash {
+		if cmd.New.IsZero() {
 			continue
 		}
 		objects = append(objects, cmd.New)
@@ -1344,6 +1637,13 @@ func pushHashes(
 		Atomic:   o.Atomic,
 	}
 
+	if o.SignedPush != nil {
+		req.Certificate, err = signPushCertificate(conn.Capabilities(), s, cmds, o)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !allDelete {
 		req.Packfile = rd
 		go func() {
@@ -1372,6 +1672,80 @@ func pushHashes(
 	return nil
 }
 
+// signPushCertificate builds a push certificate for the given commands and
+// signs it with PushOptions.SignedPush.
+func signPushCertificate(
+	caps *capability.List,
+	s storage.Storer,
+	cmds []*packp.Command,
+	o *PushOptions,
+) (*packp.PushCertificate, error) {
+	pusher, err := pusherIdentity(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var ident bytes.Buffer
+	if err := pusher.Encode(&ident); err != nil {
+		return nil, err
+	}
+
+	cert := &packp.PushCertificate{
+		Version:  packp.PushCertVersion,
+		Pusher:   ident.String(),
+		Commands: cmds,
+	}
+
+	if nonce := caps.Get(capability.PushCert); len(nonce) > 0 {
+		cert.Nonce = nonce[0]
+	}
+
+	// The pushee is the remote URL without any credentials.
+	if ep, err := transport.NewEndpoint(o.RemoteURL); err == nil {
+		ep.User, ep.Password = "", ""
+		cert.Pushee = ep.String()
+	}
+
+	if caps.Supports(capability.PushOptions) {
+		cert.Options = o.Options
+	}
+
+	sig, err := o.SignedPush.Sign(bytes.NewReader(cert.Payload()))
+	if err != nil {
+		return nil, fmt.Errorf("signing push certificate: %w", err)
+	}
+
+	cert.Signature = sig
+	return cert, nil
+}
+
+// pusherIdentity returns the identity used to sign push certificates, which
+// like upstream, is the committer identity.
+func pusherIdentity(s storage.Storer) (*object.Signature, error) {
+	local, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	global, err := config.LoadConfig(config.GlobalScope)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cfg := range []*config.Config{local, global} {
+		name, email := cfg.Committer.Name, cfg.Committer.Email
+		if name == "" || email == "" {
+			name, email = cfg.User.Name, cfg.User.Email
+		}
+
+		if name != "" && email != "" {
+			return &object.Signature{Name: name, Email: email, When: time.Now()}, nil
+		}
+	}
+
+	return nil, ErrMissingPusher
+}
+
 func (r *Remote) checkRequireRemoteRefs(requires []config.RefSpec, remoteRefs storer.ReferenceStorer) error {
 	for _, require := range requires {
 		if require.IsWildcard() {
@@ -1,6 +1,8 @@
 package git
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"context"
 	"errors"
@@ -20,10 +22,12 @@ import (
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/archive"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
@@ -657,6 +661,76 @@ func (s *RemoteSuite) TestPushPushOptions() {
 	s.Require().NoError(err)
 }
 
+func (s *RemoteSuite) TestPushSignedPush() {
+	url := s.T().TempDir()
+	server, err := PlainInit(url, true)
+	s.Require().NoError(err)
+
+	cfg, err := server.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section("receive").SetOption("certNonceSeed", "secret")
+	s.Require().NoError(server.SetConfig(cfg))
+
+	fs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	cfg, err = sto.Config()
+	s.Require().NoError(err)
+	cfg.User.Name = "John Doe"
+	cfg.User.Email = "john@example.com"
+	s.Require().NoError(sto.SetConfig(cfg))
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	var signed []byte
+	err = r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"},
+		SignedPush: signerFunc(func(message io.Reader) ([]byte, error) {
+			signed, _ = io.ReadAll(message)
+			return []byte("-----BEGIN SSH SIGNATURE-----\nc2ln\n-----END SSH SIGNATURE-----\n"), nil
+		}),
+	})
+	s.Require().NoError(err)
+
+	s.Contains(string(signed), "certificate version 0.1\n")
+	s.Contains(string(signed), "pusher John Doe <john@example.com> ")
+	s.Contains(string(signed), "nonce ")
+	s.Contains(string(signed), " refs/heads/master\n")
+
+	ref, err := server.Reference(plumbing.Master, false)
+	s.Require().NoError(err)
+	s.Equal("6ecf0ef2c2dffb796033e5a02219af86ec6584e5", ref.Hash().String())
+}
+
+func (s *RemoteSuite) TestPushSignedPushNotSupported() {
+	url := s.T().TempDir()
+	_, err := PlainInit(url, true)
+	s.Require().NoError(err)
+
+	fs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	err = r.Push(&PushOptions{
+		RefSpecs:   []config.RefSpec{"refs/heads/master:refs/heads/master"},
+		SignedPush: b64signer{},
+	})
+	s.ErrorIs(err, ErrSignedPushNotSupported)
+}
+
+type signerFunc func(message io.Reader) ([]byte, error)
+
+func (f signerFunc) Sign(message io.Reader) ([]byte, error) {
+	return f(message)
+}
+
 func eventually(s *RemoteSuite, condition func() bool) {
 	select {
 	case <-time.After(5 * time.Second):
@@ -1383,6 +1457,69 @@ func (s *RemoteSuite) TestList() {
 	}
 }
 
+func (s *RemoteSuite) TestArchive() {
+	remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	rc, err := remote.Archive(context.Background(), "master", archive.Tar, "basic/")
+	s.Require().NoError(err)
+	defer rc.Close()
+
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		s.Require().NoError(err)
+		names = append(names, hdr.Name)
+	}
+
+	s.Contains(names, "basic/")
+	s.Contains(names, "basic/go/example.go")
+	s.Contains(names, "basic/CHANGELOG")
+}
+
+func (s *RemoteSuite) TestArchiveWithOptions() {
+	remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	rc, err := remote.ArchiveWithOptions(context.Background(), &ArchiveOptions{
+		Treeish: "master",
+		Format:  archive.Zip,
+		Paths:   []string{"CHANGELOG"},
+	})
+	s.Require().NoError(err)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	s.Require().NoError(err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	s.Require().NoError(err)
+	s.Len(zr.File, 1)
+	s.Equal("CHANGELOG", zr.File[0].Name)
+	s.Equal("6ecf0ef2c2dffb796033e5a02219af86ec6584e5", zr.Comment)
+}
+
+func (s *RemoteSuite) TestArchiveInvalidRef() {
+	remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	_, err := remote.Archive(context.Background(), "missing", archive.Tar, "")
+	s.ErrorIs(err, transport.ErrArchiveRejected)
+
+	_, err = remote.Archive(context.Background(), "", archive.Tar, "")
+	s.ErrorIs(err, ErrMissingTreeish)
+}
+
 func (s *RemoteSuite) TestListPeeling() {
 	remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
 		Name: DefaultRemoteName,
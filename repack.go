@@ -0,0 +1,388 @@
+package git
+
+import (
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// packOptions are the settings of the delta compression, from the pack
+// section of the configuration.
+type packOptions struct {
+	window       uint
+	depth        uint
+	windowMemory uint64
+}
+
+func newPackOptions(cfg *config.Config) packOptions {
+	return packOptions{
+		window:       cfg.Pack.Window,
+		depth:        cfg.Pack.Depth,
+		windowMemory: cfg.Pack.WindowMemory,
+	}
+}
+
+// keptPacks returns which of the given packfiles are kept, the promisor
+// packfiles included, so the promisor objects of a partial clone are never
+// dropped.
+func (r *Repository) keptPacks(packs []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	kept := make(map[plumbing.Hash]bool)
+	kps, isKept := baseStorer(r.Storer).(storer.KeptPackStorer)
+	pps, isPromisor := baseStorer(r.Storer).(storer.PromisorPackStorer)
+	if !isKept && !isPromisor {
+		return kept, nil
+	}
+
+	for _, h := range packs {
+		var k, p bool
+		var err error
+		if isKept {
+			if k, err = kps.IsKeptPack(h); err != nil {
+				return nil, err
+			}
+		}
+
+		if isPromisor && !k {
+			if p, err = pps.IsPromisorPack(h); err != nil {
+				return nil, err
+			}
+		}
+
+		if k || p {
+			kept[h] = true
+		}
+	}
+
+	return kept, nil
+}
+
+// excludePackedObjects removes from objs the objects of the given packfiles.
+func (r *Repository) excludePackedObjects(objs []plumbing.Hash, packs map[plumbing.Hash]bool) ([]plumbing.Hash, error) {
+	bs, ok := baseStorer(r.Storer).(storer.BitmapStorer)
+	if !ok || len(packs) == 0 {
+		return objs, nil
+	}
+
+	idxs := make([]idxfile.Index, 0, len(packs))
+	for h := range packs {
+		idx, err := bs.ObjectPackIndex(h)
+		if err != nil {
+			return nil, err
+		}
+
+		idxs = append(idxs, idx)
+	}
+
+	return excludeIndexedObjects(objs, idxs)
+}
+
+func excludeIndexedObjects(objs []plumbing.Hash, idxs []idxfile.Index) ([]plumbing.Hash, error) {
+	kept := objs[:0]
+	for _, h := range objs {
+		var found bool
+		for _, idx := range idxs {
+			ok, err := idx.Contains(h)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			kept = append(kept, h)
+		}
+	}
+
+	return kept, nil
+}
+
+// unpackUnreachable writes the objects of the packfile h which aren't seen by
+// ow as loose objects, unless the packfile was modified before expire, in
+// which case it's deleted along with them and true is returned. The loose
+// objects are written now, so they expire later than the packfile would
+// have.
+func (r *Repository) unpackUnreachable(pos storer.PackedObjectStorer, h plumbing.Hash, ow *objectWalker, expire time.Time) (bool, error) {
+	bs, ok := baseStorer(r.Storer).(storer.BitmapStorer)
+	if !ok {
+		return false, ErrPackedObjectsNotSupported
+	}
+
+	if err := pos.DeleteOldObjectPackAndIndex(h, expire); err != nil {
+		return false, err
+	}
+
+	packs, err := pos.ObjectPacks()
+	if err != nil || !slices.Contains(packs, h) {
+		return err == nil, err
+	}
+
+	idx, err := bs.ObjectPackIndex(h)
+	if err != nil {
+		return false, err
+	}
+
+	objs, err := appendIndexedObjects(nil, idx)
+	if err != nil {
+		return false, err
+	}
+
+	s := baseStorer(r.Storer)
+	for _, oh := range objs {
+		if ow.isSeen(oh) {
+			continue
+		}
+
+		o, err := s.EncodedObject(plumbing.AnyObject, oh)
+		if err != nil {
+			return false, err
+		}
+
+		if _, err := s.SetEncodedObject(o); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// repackIncremental packs the loose objects seen by ow, which aren't packed
+// yet, in a new packfile.
+func (r *Repository) repackIncremental(cfg *RepackConfig, ow *objectWalker, pack packOptions) error {
+	los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer)
+	if !ok {
+		return r.updateMultiPackIndex(cfg)
+	}
+
+	var objs []plumbing.Hash
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		if ow.isSeen(h) {
+			objs = append(objs, h)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Like git, the loose objects which are already packed are left alone.
+	if pos, ok := baseStorer(r.Storer).(storer.PackedObjectStorer); ok {
+		hs, err := pos.ObjectPacks()
+		if err != nil {
+			return err
+		}
+
+		packs := make(map[plumbing.Hash]bool, len(hs))
+		for _, h := range hs {
+			packs[h] = true
+		}
+
+		if objs, err = r.excludePackedObjects(objs, packs); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.createNewObjectPack(cfg, objs, pack); err != nil {
+		return err
+	}
+
+	return r.updateMultiPackIndex(cfg)
+}
+
+// geometryPack is a packfile considered by a geometric repack.
+type geometryPack struct {
+	hash  plumbing.Hash
+	idx   idxfile.Index
+	count int64
+}
+
+// repackGeometric combines the loose objects and the smallest packfiles in
+// a new packfile, so the packfiles which aren't kept form a geometric
+// progression of the given factor.
+func (r *Repository) repackGeometric(cfg *RepackConfig, pack packOptions) error {
+	pos, ok := baseStorer(r.Storer).(storer.PackedObjectStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	bs, ok := baseStorer(r.Storer).(storer.BitmapStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	hs, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	kept, err := r.keptPacks(hs)
+	if err != nil {
+		return err
+	}
+
+	var packs []geometryPack
+	var keptIdxs []idxfile.Index
+	for _, h := range hs {
+		idx, err := bs.ObjectPackIndex(h)
+		if err != nil {
+			return err
+		}
+
+		if kept[h] {
+			keptIdxs = append(keptIdxs, idx)
+			continue
+		}
+
+		count, err := idx.Count()
+		if err != nil {
+			return err
+		}
+
+		packs = append(packs, geometryPack{hash: h, idx: idx, count: count})
+	}
+
+	sort.SliceStable(packs, func(i, j int) bool { return packs[i].count < packs[j].count })
+	counts := make([]int64, len(packs))
+	for i, p := range packs {
+		counts[i] = p.count
+	}
+
+	split := geometricSplit(counts, int64(cfg.Geometric))
+
+	var objs []plumbing.Hash
+	if los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer); ok {
+		err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+			objs = append(objs, h)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// A single packfile, without loose objects, is already in the
+	// progression.
+	if len(objs) == 0 && split < 2 {
+		return r.updateMultiPackIndex(cfg)
+	}
+
+	for _, p := range packs[:split] {
+		if objs, err = appendIndexedObjects(objs, p.idx); err != nil {
+			return err
+		}
+	}
+
+	objs = uniqueHashes(objs)
+	remaining := keptIdxs
+	for _, p := range packs[split:] {
+		remaining = append(remaining, p.idx)
+	}
+
+	if objs, err = excludeIndexedObjects(objs, remaining); err != nil {
+		return err
+	}
+
+	nh, err := r.createNewObjectPack(cfg, objs, pack)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range packs[:split] {
+		if p.hash == nh {
+			continue
+		}
+
+		if err := pos.DeleteOldObjectPackAndIndex(p.hash, cfg.OnlyDeletePacksOlderThan); err != nil {
+			return err
+		}
+	}
+
+	return r.updateMultiPackIndex(cfg)
+}
+
+// geometricSplit returns how many of the packfiles, sorted by their number
+// of objects, must be combined so the remaining ones and the combined one
+// form a geometric progression of the given factor, the way git does.
+func geometricSplit(counts []int64, factor int64) int {
+	if len(counts) == 0 {
+		return 0
+	}
+
+	// Find the smallest packfile which is in the progression along with
+	// the bigger ones.
+	i := len(counts) - 1
+	for ; i > 0; i-- {
+		if counts[i] < factor*counts[i-1] {
+			break
+		}
+	}
+
+	split := i
+	if split > 0 {
+		// The bigger packfile of the last compared pair isn't in the
+		// progression either.
+		split++
+	}
+
+	// The combined packfile may be too big for the progression of the
+	// bigger ones, which have to be combined too.
+	var total int64
+	for _, c := range counts[:split] {
+		total += c
+	}
+
+	for ; split < len(counts); split++ {
+		if counts[split] >= factor*total {
+			break
+		}
+
+		total += counts[split]
+	}
+
+	return split
+}
+
+func appendIndexedObjects(objs []plumbing.Hash, idx idxfile.Index) ([]plumbing.Hash, error) {
+	entries, err := idx.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	defer entries.Close() //nolint:errcheck
+
+	for {
+		e, err := entries.Next()
+		if err == io.EOF {
+			return objs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, e.Hash)
+	}
+}
+
+func uniqueHashes(hs []plumbing.Hash) []plumbing.Hash {
+	seen := make(map[plumbing.Hash]struct{}, len(hs))
+	unique := hs[:0]
+	for _, h := range hs {
+		if _, ok := seen[h]; !ok {
+			seen[h] = struct{}{}
+			unique = append(unique, h)
+		}
+	}
+
+	return unique
+}
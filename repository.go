@@ -26,6 +26,8 @@ import (
 	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/progress"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
@@ -64,6 +66,14 @@ var (
 	ErrUnsupportedMergeStrategy    = errors.New("unsupported merge strategy")
 	ErrFastForwardMergeNotPossible = errors.New("not possible to fast-forward merge changes")
 	ErrTargetDirNotEmpty           = errors.New("destination path already exists and is not empty")
+	ErrInvalidRepackConfig         = errors.New("invalid repack config")
+	ErrCommitGraphNotSupported     = errors.New("commit-graph not supported")
+	// ErrCompatObjectFormatNotSupported is returned when the storer can't
+	// map the object IDs to another object format.
+	ErrCompatObjectFormatNotSupported = errors.New("compat object format not supported")
+	// ErrCompatSubmodule is returned when converting a tree with a submodule
+	// whose commit isn't mapped to the other object format.
+	ErrCompatSubmodule = errors.New("submodule commit can't be converted to another object format")
 )
 
 // Repository represents a git repository
@@ -141,6 +151,12 @@ func Init(s storage.Storer, opts ...InitOption) (*Repository, error) {
 		return nil, err
 	}
 
+	if options.objectFormat != formatcfg.SHA1 {
+		if err := initObjectFormat(r, options.objectFormat); err != nil {
+			return nil, err
+		}
+	}
+
 	h := plumbing.NewSymbolicReference(plumbing.HEAD, options.defaultBranch)
 	if err := s.SetReference(h); err != nil {
 		return nil, err
@@ -154,6 +170,19 @@ func Init(s storage.Storer, opts ...InitOption) (*Repository, error) {
 	return r, setWorktreeAndStoragePaths(r, options.workTree)
 }
 
+// initObjectFormat sets the object format of a new repository, which
+// requires the version 1 of the repository format.
+func initObjectFormat(r *Repository, f formatcfg.ObjectFormat) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.ObjectFormat = f
+	return r.SetConfig(cfg)
+}
+
 func initStorer(s storer.Storer) error {
 	i, ok := s.(storer.Initializer)
 	if !ok {
@@ -238,7 +267,12 @@ func Open(s storage.Storer, worktree billy.Filesystem) (*Repository, error) {
 		return nil, err
 	}
 
-	return newRepository(s, worktree), nil
+	r := newRepository(s, worktree)
+	if err := r.setupPromisor(&PromisorOptions{}); err != nil {
+		return nil, err
+	}
+
+	return r, nil
 }
 
 // Clone a repository into the given Storer and worktree Filesystem with the
@@ -284,11 +318,6 @@ func PlainInit(path string, isBare bool, options ...InitOption) (*Repository, er
 	var wt, dot billy.Filesystem
 	var initFn func(s *filesystem.Storage) (*Repository, error)
 
-	o := newInitOptions()
-	for _, oFn := range options {
-		oFn(&o)
-	}
-
 	if isBare {
 		dot = osfs.New(path, osfs.WithBoundOS())
 		initFn = func(s *filesystem.Storage) (*Repository, error) {
@@ -314,11 +343,6 @@ func PlainInit(path string, isBare bool, options ...InitOption) (*Repository, er
 		return nil, err
 	}
 
-	if o.objectFormat != formatcfg.SHA1 {
-		cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
-		cfg.Extensions.ObjectFormat = o.objectFormat
-	}
-
 	err = r.Storer.SetConfig(cfg)
 	if err != nil {
 		return nil, err
@@ -565,6 +589,17 @@ func checkTargetDirIsEmpty(path string) (empty bool, err error) {
 	return false, nil
 }
 
+// objectFormat returns the object format of the repository, SHA-1 when its
+// config fails to load.
+func (r *Repository) objectFormat() formatcfg.ObjectFormat {
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return formatcfg.SHA1
+	}
+
+	return cfg.Extensions.ObjectFormat
+}
+
 // Config return the repository config. In a filesystem backed repository this
 // means read the `.git/config`.
 func (r *Repository) Config() (*config.Config, error) {
@@ -901,7 +936,7 @@ func (r *Repository) resolveToCommitHash(h plumbing.Hash) (plumbing.Hash, error)
 }
 
 // Clone clones a remote repository
-func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
+func (r *Repository) clone(ctx context.Context, o *CloneOptions) (err error) {
 	if err := o.Validate(); err != nil {
 		return err
 	}
@@ -913,10 +948,21 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		Mirror: o.Mirror,
 	}
 
+	if o.Filter != "" {
+		c.Promisor = true
+		c.PartialCloneFilter = string(o.Filter)
+	}
+
 	if _, err := r.CreateRemote(c); err != nil {
 		return err
 	}
 
+	if c.Promisor {
+		if err := r.setPartialClone(c.Name); err != nil {
+			return err
+		}
+	}
+
 	// When the repository to clone is on the local machine,
 	// instead of using hard links, automatically setup .git/objects/info/alternates
 	// to share the objects with the source repository
@@ -957,6 +1003,25 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		return err
 	}
 
+	// The lazy fetches of the checkout use the context of the clone, while
+	// the ones of the returned repository only keep its credentials.
+	po := &PromisorOptions{
+		Context:         ctx,
+		Auth:            o.Auth,
+		InsecureSkipTLS: o.InsecureSkipTLS,
+		CABundle:        o.CABundle,
+		ProxyOptions:    o.ProxyOptions,
+	}
+	if err := r.setupPromisor(po); err != nil {
+		return err
+	}
+	defer func() {
+		po.Context = nil
+		if serr := r.setupPromisor(po); err == nil {
+			err = serr
+		}
+	}()
+
 	if r.wt != nil && !o.NoCheckout {
 		w, err := r.Worktree()
 		if err != nil {
@@ -968,9 +1033,11 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 			return err
 		}
 
+		pr, _ := o.Progress.(progress.Reporter)
 		if err := w.Reset(&ResetOptions{
-			Mode:   MergeReset,
-			Commit: head.Hash(),
+			Mode:     MergeReset,
+			Commit:   head.Hash(),
+			Progress: pr,
 		}); err != nil {
 			return err
 		}
@@ -1086,7 +1153,7 @@ func (r *Repository) fetchAndUpdateReferences(
 	}
 
 	objsUpdated := true
-	remoteRefs, err := remote.fetch(ctx, o)
+	remoteRefs, err := remote.fetch(ctx, o, true)
 	if err == NoErrAlreadyUpToDate {
 		objsUpdated = false
 	} else if err == packfile.ErrEmptyPackfile {
@@ -1109,6 +1176,12 @@ func (r *Repository) fetchAndUpdateReferences(
 		return nil, NoErrAlreadyUpToDate
 	}
 
+	if objsUpdated {
+		if err := r.writeFetchedCommitGraph(); err != nil {
+			return nil, err
+		}
+	}
+
 	return resolvedRef, nil
 }
 
@@ -1226,7 +1299,11 @@ func (r *Repository) FetchContext(ctx context.Context, o *FetchOptions) error {
 		return err
 	}
 
-	return remote.FetchContext(ctx, o)
+	if err := remote.FetchContext(ctx, o); err != nil {
+		return err
+	}
+
+	return r.writeFetchedCommitGraph()
 }
 
 // Push performs a push to the remote. Returns NoErrAlreadyUpToDate if
@@ -1295,7 +1372,7 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 
 func (r *Repository) log(from plumbing.Hash, commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
 	h := from
-	if from == plumbing.ZeroHash {
+	if from.IsZero() {
 		head, err := r.Head()
 		if err != nil {
 			return nil, err
@@ -1711,13 +1788,13 @@ func (r *Repository) ResolveRevision(in plumbing.Revision) (*plumbing.Hash, erro
 // is a prefix of. It quietly swallows errors, returning nil.
 func (r *Repository) resolveHashPrefix(hashStr string) []plumbing.Hash {
 	// Handle complete and partial hashes.
-	// plumbing.NewHash forces args into a full 20 byte hash, which isn't suitable
+	// plumbing.NewHash forces args into a full hash, which isn't suitable
 	// for partial hashes since they will become zero-filled.
 
 	if hashStr == "" {
 		return nil
 	}
-	if len(hashStr) == plumbing.ZeroHash.HexSize() {
+	if len(hashStr) == r.objectFormat().HexSize() {
 		h, ok := plumbing.FromHex(hashStr)
 		if !ok {
 			return nil
@@ -1754,10 +1831,72 @@ type RepackConfig struct {
 	// OnlyDeletePacksOlderThan if set to non-zero value
 	// selects only objects older than the time provided.
 	OnlyDeletePacksOlderThan time.Time
+	// WriteMultiPackIndex writes the multi-pack-index after repacking. It's
+	// always rewritten if the repository already has one.
+	WriteMultiPackIndex bool
+	// WriteBitmaps writes the reachability bitmap of the new packfile, used
+	// to find the objects reachable from commits without walking them. The
+	// objects of the kept packfiles are packed too. It's ignored by the
+	// geometric and incremental repacks, whose packfile doesn't have all
+	// the reachable objects.
+	WriteBitmaps bool
+	// Geometric, if not 0, only combines the smallest packfiles along with
+	// the loose objects, so that each remaining packfile has at least
+	// Geometric times more objects than the next smaller one, like git
+	// repack --geometric. It must be at least 2. The objects of the
+	// combined packfiles are kept whether they are reachable or not.
+	Geometric int
+	// Incremental only packs the reachable loose objects in a new packfile,
+	// keeping the existing packfiles.
+	Incremental bool
+	// PackKeptObjects packs the objects of the kept packfiles too, which
+	// are skipped otherwise. The kept packfiles are never deleted.
+	PackKeptObjects bool
+	// UnpackUnreachable, if not zero, writes the unreachable objects of the
+	// deleted packfiles modified after this time as loose objects instead
+	// of dropping them, like git repack -A --unpack-unreachable, so they
+	// can be pruned once they expire.
+	UnpackUnreachable time.Time
 }
 
 func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
-	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if _, ok := baseStorer(r.Storer).(storer.PackedObjectStorer); !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	switch {
+	case cfg.Geometric < 0 || cfg.Geometric == 1:
+		return fmt.Errorf("%w: geometric factor %d is lower than 2", ErrInvalidRepackConfig, cfg.Geometric)
+	case cfg.Geometric > 0 && cfg.Incremental:
+		return fmt.Errorf("%w: geometric and incremental repacks are exclusive", ErrInvalidRepackConfig)
+	}
+
+	scfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	pack := newPackOptions(scfg)
+	if cfg.Geometric > 0 {
+		return r.repackGeometric(cfg, pack)
+	}
+
+	ow := newObjectWalker(r.Storer)
+	if err := ow.walkAllRefs(); err != nil {
+		return err
+	}
+
+	if cfg.Incremental {
+		return r.repackIncremental(cfg, ow, pack)
+	}
+
+	return r.repackObjects(cfg, ow, pack)
+}
+
+// repackObjects replaces the packfiles, except the kept ones, with one of
+// the objects seen by ow.
+func (r *Repository) repackObjects(cfg *RepackConfig, ow *objectWalker, pack packOptions) (err error) {
+	pos, ok := baseStorer(r.Storer).(storer.PackedObjectStorer)
 	if !ok {
 		return ErrPackedObjectsNotSupported
 	}
@@ -1768,27 +1907,131 @@ func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
 		return err
 	}
 
+	kept, err := r.keptPacks(hs)
+	if err != nil {
+		return err
+	}
+
+	objs := make([]plumbing.Hash, 0, len(ow.seen))
+	for h := range ow.seen {
+		objs = append(objs, h)
+	}
+
+	if !cfg.PackKeptObjects && !cfg.WriteBitmaps {
+		if objs, err = r.excludePackedObjects(objs, kept); err != nil {
+			return err
+		}
+	}
+
 	// Create a new pack.
-	nh, err := r.createNewObjectPack(cfg)
+	nh, err := r.createNewObjectPack(cfg, objs, pack)
 	if err != nil {
 		return err
 	}
 
+	if cfg.WriteBitmaps && !nh.IsZero() {
+		if err := r.writeBitmap(nh); err != nil {
+			return err
+		}
+	}
+
 	// Delete old packs.
 	for _, h := range hs {
 		// Skip if new hash is the same as an old one.
-		if h == nh {
+		if h == nh || kept[h] {
 			continue
 		}
+
+		if !cfg.UnpackUnreachable.IsZero() {
+			deleted, err := r.unpackUnreachable(pos, h, ow, cfg.UnpackUnreachable)
+			if err != nil {
+				return err
+			}
+
+			if deleted {
+				continue
+			}
+		}
+
 		err = pos.DeleteOldObjectPackAndIndex(h, cfg.OnlyDeletePacksOlderThan)
 		if err != nil {
 			return err
 		}
 	}
 
+	return r.updateMultiPackIndex(cfg)
+}
+
+// updateMultiPackIndex rewrites the multi-pack-index after a repack, if
+// requested or if there's already one.
+func (r *Repository) updateMultiPackIndex(cfg *RepackConfig) (err error) {
+	if mis, ok := baseStorer(r.Storer).(storer.MultiPackIndexStorer); ok {
+		write := cfg.WriteMultiPackIndex
+		if !write {
+			if write, err = mis.HasMultiPackIndex(); err != nil {
+				return err
+			}
+		}
+
+		if write {
+			return mis.WriteMultiPackIndex()
+		}
+	}
+
 	return nil
 }
 
+// writeBitmap writes the reachability bitmap of the given packfile, with the
+// bitmaps of the commits pointed by the references.
+func (r *Repository) writeBitmap(pack plumbing.Hash) error {
+	bs, ok := baseStorer(r.Storer).(storer.BitmapStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	idx, err := bs.ObjectPackIndex(pack)
+	if err != nil {
+		return err
+	}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var tips []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := revlist.BuildBitmap(r.Storer, pack, idx, tips)
+	if err != nil {
+		return err
+	}
+
+	return bs.SetBitmap(b)
+}
+
+// WriteMultiPackIndex writes the multi-pack-index of the packfiles of the
+// repository, so their objects are looked up at once instead of once per
+// packfile. It's usually called after fetching or repacking objects, as new
+// packfiles aren't covered by the existing multi-pack-index.
+func (r *Repository) WriteMultiPackIndex() error {
+	mis, ok := baseStorer(r.Storer).(storer.MultiPackIndexStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	return mis.WriteMultiPackIndex()
+}
+
 // Merge merges the reference branch into the current branch.
 //
 // If the merge is not possible (or supported) returns an error without changing
@@ -1825,19 +2068,16 @@ func (r *Repository) Merge(ref plumbing.Reference, opts MergeOptions) error {
 }
 
 // createNewObjectPack is a helper for RepackObjects taking care
-// of creating a new pack. It is used so the PackfileWriter
-// deferred close has the right scope.
-func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, err error) {
-	ow := newObjectWalker(r.Storer)
-	err = ow.walkAllRefs()
-	if err != nil {
-		return h, err
-	}
-	objs := make([]plumbing.Hash, 0, len(ow.seen))
-	for h := range ow.seen {
-		objs = append(objs, h)
+// of creating a new pack of the given objects, and deleting the loose
+// ones. It is used so the PackfileWriter deferred close has the right
+// scope. Nothing is written if there are no objects, and the zero hash is
+// returned.
+func (r *Repository) createNewObjectPack(cfg *RepackConfig, objs []plumbing.Hash, pack packOptions) (h plumbing.Hash, err error) {
+	if len(objs) == 0 {
+		return h, nil
 	}
-	pfw, ok := r.Storer.(storer.PackfileWriter)
+
+	pfw, ok := baseStorer(r.Storer).(storer.PackfileWriter)
 	if !ok {
 		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
 	}
@@ -1846,20 +2086,24 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 		return h, err
 	}
 	defer ioutil.CheckClose(wc, &err)
-	scfg, err := r.Config()
-	if err != nil {
-		return h, err
-	}
-	enc := packfile.NewEncoder(wc, r.Storer, cfg.UseRefDeltas)
-	h, err = enc.Encode(objs, scfg.Pack.Window)
+	enc := packfile.NewEncoder(wc, r.Storer, cfg.UseRefDeltas,
+		packfile.WithDeltaDepth(pack.depth),
+		packfile.WithWindowMemory(pack.windowMemory),
+	)
+	h, err = enc.Encode(objs, pack.window)
 	if err != nil {
 		return h, err
 	}
 
 	// Delete the packed, loose objects.
-	if los, ok := r.Storer.(storer.LooseObjectStorer); ok {
+	if los, ok := baseStorer(r.Storer).(storer.LooseObjectStorer); ok {
+		packed := make(map[plumbing.Hash]struct{}, len(objs))
+		for _, o := range objs {
+			packed[o] = struct{}{}
+		}
+
 		err = los.ForEachObjectHash(func(hash plumbing.Hash) error {
-			if ow.isSeen(hash) {
+			if _, ok := packed[hash]; ok {
 				err = los.DeleteLooseObject(hash)
 				if err != nil {
 					return err
@@ -27,8 +27,11 @@ import (
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/midx"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage"
@@ -78,6 +81,36 @@ func (s *RepositorySuite) TestInitWithOptions() {
 	s.Equal("refs/heads/foo", ref.Name().String())
 }
 
+func (s *RepositorySuite) TestInitWithObjectFormat() {
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()),
+		WithObjectFormat(formatcfg.SHA256),
+	)
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	s.EqualValues(formatcfg.Version_1, cfg.Core.RepositoryFormatVersion)
+	s.Equal(formatcfg.SHA256, cfg.Extensions.ObjectFormat)
+
+	h := createCommit(s, r)
+	s.Equal(formatcfg.SHA256Size, h.Size())
+
+	commit, err := r.CommitObject(h)
+	s.NoError(err)
+	s.Equal(formatcfg.SHA256Size, commit.TreeHash.Size())
+
+	wt, err := r.Worktree()
+	s.NoError(err)
+	status, err := wt.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	// A SHA-1 sized hash is a prefix of a SHA-256 one.
+	resolved, err := r.ResolveRevision(plumbing.Revision(h.String()[:40]))
+	s.NoError(err)
+	s.Equal(h, *resolved)
+}
+
 func (s *RepositorySuite) TestInitWithInvalidDefaultBranch() {
 	_, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()),
 		WithDefaultBranch("foo"),
@@ -675,6 +708,61 @@ func (s *RepositorySuite) TestPlainInitWithOptions() {
 	s.Equal("refs/heads/foo", ref.Name().String())
 }
 
+func (s *RepositorySuite) TestPlainCloneSHA256() {
+	origin, err := PlainInit(s.T().TempDir(), false, WithObjectFormat(formatcfg.SHA256))
+	s.NoError(err)
+	head := createCommit(s, origin)
+
+	dir := s.T().TempDir()
+	r, err := PlainClone(dir, &CloneOptions{URL: origin.wt.Root()})
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	s.Equal(formatcfg.SHA256, cfg.Extensions.ObjectFormat)
+
+	ref, err := r.Head()
+	s.NoError(err)
+	s.Equal(head, ref.Hash())
+
+	h := createCommit(s, r)
+	s.NoError(r.Push(&PushOptions{}))
+
+	ref, err = origin.Reference(plumbing.Master, false)
+	s.NoError(err)
+	s.Equal(h, ref.Hash())
+
+	sha1, err := PlainInit(s.T().TempDir(), false)
+	s.NoError(err)
+	createCommit(s, sha1)
+
+	_, err = sha1.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{origin.wt.Root()},
+	})
+	s.NoError(err)
+
+	err = sha1.Fetch(&FetchOptions{})
+	s.ErrorIs(err, ErrObjectFormatMismatch)
+
+	// Only the repository of a clone takes the object format of the
+	// remote, not the empty ones fetching from it.
+	empty, err := PlainInit(s.T().TempDir(), false)
+	s.NoError(err)
+	_, err = empty.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{origin.wt.Root()},
+	})
+	s.NoError(err)
+
+	err = empty.Fetch(&FetchOptions{})
+	s.ErrorIs(err, ErrObjectFormatMismatch)
+
+	cfg, err = empty.Config()
+	s.NoError(err)
+	s.Equal(formatcfg.SHA1, cfg.Extensions.ObjectFormat)
+}
+
 func (s *RepositorySuite) TestPlainInitAlreadyExists() {
 	dir, err := os.MkdirTemp("", "")
 	s.NoError(err)
@@ -1290,6 +1378,32 @@ func (s *RepositorySuite) TestFetchContext() {
 }
 
 func (s *RepositorySuite) TestFetchWithFilters() {
+	r, _ := Init(memory.NewStorage())
+	_, err := r.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicFilterLocalRepositoryURL()},
+	})
+	s.NoError(err)
+
+	err = r.Fetch(&FetchOptions{
+		Filter: packp.FilterBlobNone(),
+	})
+	s.NoError(err)
+
+	commit, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.NoError(err)
+	s.NotNil(commit)
+
+	tree, err := r.TreeObject(plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	s.NoError(err)
+	s.NotNil(tree)
+
+	blob, err := r.BlobObject(plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492"))
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+	s.Nil(blob)
+}
+
+func (s *RepositorySuite) TestFetchWithFiltersNotAllowed() {
 	r, _ := Init(memory.NewStorage())
 	_, err := r.CreateRemote(&config.RemoteConfig{
 		Name: DefaultRemoteName,
@@ -3343,6 +3457,88 @@ func (s *RepositorySuite) TestRepackObjectsWithNoDelete() {
 	s.testRepackObjects(time.Unix(0, 1), 3)
 }
 
+func (s *RepositorySuite) TestRepackObjectsWriteMultiPackIndex() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, fs)
+	s.Require().NoError(err)
+
+	s.Require().NoError(r.RepackObjects(&RepackConfig{WriteMultiPackIndex: true}))
+	ok, err := sto.HasMultiPackIndex()
+	s.Require().NoError(err)
+	s.True(ok)
+
+	// The existing multi-pack-index is kept up to date.
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err = Open(sto, fs)
+	s.Require().NoError(err)
+	s.Require().NoError(r.RepackObjects(&RepackConfig{}))
+
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Len(packs, 1)
+
+	f, err := fs.Open("objects/pack/multi-pack-index")
+	s.Require().NoError(err)
+	defer f.Close()
+	m, err := midx.Decode(f)
+	s.Require().NoError(err)
+	s.Equal([]string{fmt.Sprintf("pack-%s.idx", packs[0])}, m.PackNames())
+
+	r, err = Open(sto, fs)
+	s.Require().NoError(err)
+	head, err := r.Head()
+	s.Require().NoError(err)
+	_, err = r.CommitObject(head.Hash())
+	s.NoError(err)
+}
+
+func (s *RepositorySuite) TestRepackObjectsWriteBitmaps() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, fs)
+	s.Require().NoError(err)
+	s.Require().NoError(r.RepackObjects(&RepackConfig{WriteBitmaps: true}))
+
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	b, err := sto.Bitmap()
+	s.Require().NoError(err)
+	s.Require().NotNil(b)
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	reachable, ok := b.Bitmap(head.Hash())
+	s.Require().True(ok)
+
+	objs, err := revlist.ObjectsWithStorageForIgnores(sto, sto, []plumbing.Hash{head.Hash()}, nil)
+	s.Require().NoError(err)
+	s.Equal(len(objs), reachable.Count())
+}
+
+func (s *RepositorySuite) TestWriteMultiPackIndex() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+	s.ErrorIs(r.WriteMultiPackIndex(), ErrPackedObjectsNotSupported)
+
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err = Open(sto, fs)
+	s.Require().NoError(err)
+	s.Require().NoError(r.WriteMultiPackIndex())
+
+	_, err = fs.Stat("objects/pack/multi-pack-index")
+	s.NoError(err)
+}
+
 func ExecuteOnPath(t *testing.T, path string, cmds ...string) error {
 	for _, cmd := range cmds {
 		err := executeOnPath(path, cmd)
@@ -3513,3 +3709,110 @@ func BenchmarkPlainClone(b *testing.B) {
 		clone(b)
 	}
 }
+
+func (s *RepositorySuite) TestRepackObjectsInvalidConfig() {
+	r, err := Init(memory.NewStorage())
+	s.Require().NoError(err)
+
+	s.ErrorIs(r.RepackObjects(&RepackConfig{Geometric: 1}), ErrInvalidRepackConfig)
+	s.ErrorIs(r.RepackObjects(&RepackConfig{Geometric: -2}), ErrInvalidRepackConfig)
+	s.ErrorIs(r.RepackObjects(&RepackConfig{Geometric: 2, Incremental: true}), ErrInvalidRepackConfig)
+}
+
+func (s *RepositorySuite) testRepackObjectsPacks(cfg *RepackConfig, keep int, expected []int64) {
+	fs := fixtures.ByTag("unpacked").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	r, err := Open(sto, fs)
+	s.Require().NoError(err)
+
+	// The fixture has a pack of 141 objects, and another of 1946.
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(packs, 2)
+	if keep >= 0 {
+		s.Require().NoError(sto.SetKeptPack(packs[keep], true))
+	}
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	s.Require().NoError(r.RepackObjects(cfg))
+
+	sto = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	packs, err = sto.ObjectPacks()
+	s.Require().NoError(err)
+
+	var counts []int64
+	for _, h := range packs {
+		idx, err := sto.ObjectPackIndex(h)
+		s.Require().NoError(err)
+		count, err := idx.Count()
+		s.Require().NoError(err)
+		counts = append(counts, count)
+	}
+
+	s.ElementsMatch(expected, counts)
+
+	objs, err := revlist.Objects(sto, []plumbing.Hash{head.Hash()}, nil)
+	s.Require().NoError(err)
+	for _, h := range objs {
+		_, err := sto.EncodedObject(plumbing.AnyObject, h)
+		s.Require().NoError(err)
+	}
+}
+
+func (s *RepositorySuite) TestRepackObjectsGeometric() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	// The packs are already in the progression, only the loose objects are
+	// packed.
+	s.testRepackObjectsPacks(&RepackConfig{Geometric: 2}, -1, []int64{141, 1946, 46})
+}
+
+func (s *RepositorySuite) TestRepackObjectsGeometricCombine() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	// All the objects are combined in a single pack.
+	s.testRepackObjectsPacks(&RepackConfig{Geometric: 20}, -1, []int64{2133})
+}
+
+func (s *RepositorySuite) TestRepackObjectsIncremental() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	s.testRepackObjectsPacks(&RepackConfig{Incremental: true}, -1, []int64{141, 1946, 46})
+}
+
+func (s *RepositorySuite) TestRepackObjectsKeptPack() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	s.testRepackObjectsPacks(&RepackConfig{}, 0, []int64{141, 1992})
+}
+
+func TestGeometricSplit(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		counts []int64
+		factor int64
+		split  int
+	}{
+		{nil, 2, 0},
+		{[]int64{10}, 2, 0},
+		{[]int64{1, 2, 4, 8}, 2, 0},
+		{[]int64{1, 1, 4, 8}, 2, 2},
+		{[]int64{1, 3, 4, 16}, 2, 3},
+		{[]int64{5, 6, 7, 100}, 2, 3},
+		{[]int64{5, 6, 7, 20}, 2, 4},
+		{[]int64{141, 1946}, 2, 0},
+		{[]int64{141, 1946}, 20, 2},
+	} {
+		assert.Equal(t, tc.split, geometricSplit(tc.counts, tc.factor), "%v", tc.counts)
+	}
+}
@@ -0,0 +1,137 @@
+package filesystem
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// maxLooseCompatObjectIDs is the largest number of mappings appended at once
+// to the loose object index, the larger batches are written in a map file.
+const maxLooseCompatObjectIDs = 64
+
+// CompatObjectID honors the storer.CompatObjectStorer interface.
+func (s *ObjectStorage) CompatObjectID(h plumbing.Hash) (plumbing.Hash, error) {
+	mappings, err := s.compatMappings()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, m := range mappings {
+		if c, ok := m.CompatID(h); ok {
+			return c, nil
+		}
+	}
+
+	return plumbing.ZeroHash, plumbing.ErrObjectNotFound
+}
+
+// ObjectIDFromCompat honors the storer.CompatObjectStorer interface.
+func (s *ObjectStorage) ObjectIDFromCompat(h plumbing.Hash) (plumbing.Hash, error) {
+	mappings, err := s.compatMappings()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, m := range mappings {
+		if id, ok := m.ID(h); ok {
+			return id, nil
+		}
+	}
+
+	return plumbing.ZeroHash, plumbing.ErrObjectNotFound
+}
+
+// SetCompatObjectIDs honors the storer.CompatObjectStorer interface. Like
+// git, the mappings are appended to the loose object index, but for the
+// large batches, such as the objects of a packfile, written in a map file.
+func (s *ObjectStorage) SetCompatObjectIDs(m *compatmap.Map) error {
+	if m.Len() == 0 {
+		return nil
+	}
+
+	s.muC.Lock()
+	defer s.muC.Unlock()
+
+	s.compat = nil
+	if m.Len() <= maxLooseCompatObjectIDs {
+		return s.dir.AppendLooseObjectIndex(m)
+	}
+
+	// The object formats are the ones of the IDs, since the mappings of
+	// a repository being converted are written before its config.
+	f, compat := format.SHA1, format.SHA1
+	_ = m.ForEach(func(id, c plumbing.Hash) error {
+		if id.Size() == format.SHA256Size {
+			f = format.SHA256
+		}
+
+		if c.Size() == format.SHA256Size {
+			compat = format.SHA256
+		}
+
+		return storer.ErrStop
+	})
+
+	return s.dir.AddCompatMap(func(w io.Writer) (plumbing.Hash, error) {
+		return compatmap.NewEncoder(w, f, compat).Encode(m)
+	})
+}
+
+// compatMappings returns the mappings of the loose object index and of the
+// map files, loading them if needed.
+func (s *ObjectStorage) compatMappings() ([]compatmap.Mapping, error) {
+	s.muC.Lock()
+	defer s.muC.Unlock()
+
+	if s.compat != nil {
+		return s.compat, nil
+	}
+
+	loose := compatmap.NewMap()
+	if err := s.loadLooseObjectIndex(loose); err != nil {
+		return nil, err
+	}
+
+	mappings := []compatmap.Mapping{loose}
+	maps, err := s.dir.CompatMaps()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range maps {
+		m, err := s.loadCompatMap(h)
+		if err != nil {
+			return nil, err
+		}
+
+		mappings = append(mappings, m)
+	}
+
+	s.compat = mappings
+	return mappings, nil
+}
+
+func (s *ObjectStorage) loadLooseObjectIndex(m *compatmap.Map) (err error) {
+	f, err := s.dir.LooseObjectIndex()
+	if err != nil || f == nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return compatmap.DecodeLooseIndex(f, m)
+}
+
+func (s *ObjectStorage) loadCompatMap(h plumbing.Hash) (m *compatmap.File, err error) {
+	f, err := s.dir.CompatMap(h)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return compatmap.Decode(f)
+}
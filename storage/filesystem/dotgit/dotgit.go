@@ -12,11 +12,16 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 
@@ -41,6 +46,11 @@ const (
 	logsPath       = "logs"
 	worktreesPath  = "worktrees"
 	alternatesPath = "alternates"
+	midxPath       = "multi-pack-index"
+
+	commitGraphPath      = "commit-graph"
+	commitGraphsPath     = "commit-graphs"
+	commitGraphChainPath = "commit-graph-chain"
 
 	tmpPackedRefsPrefix = "._packed-refs"
 
@@ -96,6 +106,9 @@ type DotGit struct {
 	options Options
 	fs      billy.Filesystem
 
+	// objectFormat is the object format of the objects written.
+	objectFormat format.ObjectFormat
+
 	// incoming object directory information
 	incomingChecked bool
 	incomingDirName string
@@ -124,6 +137,18 @@ func NewWithOptions(fs billy.Filesystem, o Options) *DotGit {
 	}
 }
 
+// ObjectFormat returns the object format of the objects written to the
+// repository.
+func (d *DotGit) ObjectFormat() format.ObjectFormat {
+	return d.objectFormat
+}
+
+// SetObjectFormat sets the object format of the objects written to the
+// repository, which is extensions.objectFormat in its config.
+func (d *DotGit) SetObjectFormat(f format.ObjectFormat) {
+	d.objectFormat = f
+}
+
 // Initialize creates all the folder scaffolding.
 func (d *DotGit) Initialize() error {
 	mustExists := []string{
@@ -213,10 +238,12 @@ func (d *DotGit) Shallow() (billy.File, error) {
 }
 
 // NewObjectPack return a writer for a new packfile, it saves the packfile to
-// disk and also generates and save the index for the given packfile.
-func (d *DotGit) NewObjectPack() (*PackWriter, error) {
+// disk and also generates and save the index for the given packfile, parsed
+// with the given options.
+func (d *DotGit) NewObjectPack(opts ...packfile.ParserOption) (*PackWriter, error) {
 	d.cleanPackList()
-	return newPackWrite(d.fs)
+	opts = append([]packfile.ParserOption{packfile.WithObjectFormat(d.objectFormat)}, opts...)
+	return newPackWrite(d.fs, opts...)
 }
 
 // ObjectPacks returns the list of availables packfiles
@@ -338,14 +365,431 @@ func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) er
 	if err != nil {
 		return err
 	}
+
+	for _, ext := range []string{`promisor`, `keep`, `bitmap`} {
+		err = d.fs.Remove(d.objectPackPath(hash, ext))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	return d.fs.Remove(d.objectPackPath(hash, `idx`))
 }
 
+// SetObjectPackPromisor creates the .promisor file of the given packfile,
+// marking it as received from a promisor remote.
+func (d *DotGit) SetObjectPackPromisor(hash plumbing.Hash) error {
+	err := d.hasPack(hash)
+	if err != nil {
+		return err
+	}
+
+	f, err := d.fs.Create(d.objectPackPath(hash, `promisor`))
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// ObjectPackPromisor returns true if the given packfile has a .promisor
+// file.
+func (d *DotGit) ObjectPackPromisor(hash plumbing.Hash) (bool, error) {
+	_, err := d.fs.Stat(d.objectPackPath(hash, `promisor`))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetObjectPackKeep creates the .keep file of the given packfile, so it's
+// kept by the repacks, or removes it if keep is false.
+func (d *DotGit) SetObjectPackKeep(hash plumbing.Hash, keep bool) error {
+	err := d.hasPack(hash)
+	if err != nil {
+		return err
+	}
+
+	path := d.objectPackPath(hash, `keep`)
+	if !keep {
+		err := d.fs.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	f, err := d.fs.Create(path)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// ObjectPackKeep returns true if the given packfile has a .keep file.
+func (d *DotGit) ObjectPackKeep(hash plumbing.Hash) (bool, error) {
+	_, err := d.fs.Stat(d.objectPackPath(hash, `keep`))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MultiPackIndex returns a file pointer for read to the multi-pack-index
+// file, or nil if it doesn't exist.
+func (d *DotGit) MultiPackIndex() (billy.File, error) {
+	f, err := d.fs.Open(d.fs.Join(objectsPath, packPath, midxPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetMultiPackIndex replaces the multi-pack-index file with the one written
+// by encode, or removes it if encode is nil.
+func (d *DotGit) SetMultiPackIndex(encode func(io.Writer) error) error {
+	return d.writeFile(d.fs.Join(objectsPath, packPath, midxPath), encode)
+}
+
+// ObjectPackBitmap returns a fs.File of the reachability bitmap file of the
+// given packfile, or nil if it doesn't exist.
+func (d *DotGit) ObjectPackBitmap(hash plumbing.Hash) (billy.File, error) {
+	f, err := d.fs.Open(d.objectPackPath(hash, `bitmap`))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetObjectPackBitmap replaces the reachability bitmap file of the given
+// packfile with the one written by encode, or removes it if encode is nil.
+func (d *DotGit) SetObjectPackBitmap(hash plumbing.Hash, encode func(io.Writer) error) error {
+	if encode != nil {
+		if err := d.hasPack(hash); err != nil {
+			return err
+		}
+	}
+
+	return d.writeFile(d.objectPackPath(hash, `bitmap`), encode)
+}
+
+// CommitGraph returns a fs.File of the commit-graph file, or nil if it
+// doesn't exist. Commit-graph chains aren't returned.
+func (d *DotGit) CommitGraph() (billy.File, error) {
+	f, err := d.fs.Open(d.fs.Join(objectsPath, infoPath, commitGraphPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetCommitGraph replaces the commit-graph with the file written by encode,
+// or removes it if encode is nil. Any commit-graph chain is removed.
+func (d *DotGit) SetCommitGraph(encode func(io.Writer) error) error {
+	old, err := d.CommitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeFile(d.fs.Join(objectsPath, infoPath, commitGraphPath), encode); err != nil {
+		return err
+	}
+
+	err = d.fs.Remove(d.fs.Join(objectsPath, infoPath, commitGraphsPath, commitGraphChainPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return d.removeCommitGraphLayers(old, nil)
+}
+
+// CommitGraphChain returns the checksums of the layers of the commit-graph
+// chain, from the oldest, or nil if there is none.
+func (d *DotGit) CommitGraphChain() ([]string, error) {
+	f, err := d.fs.Open(d.fs.Join(objectsPath, infoPath, commitGraphsPath, commitGraphChainPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+	return commitgraph.OpenChainFile(f)
+}
+
+// CommitGraphLayer returns a fs.File of the layer of the commit-graph chain
+// with the given checksum.
+func (d *DotGit) CommitGraphLayer(checksum string) (billy.File, error) {
+	return d.fs.Open(d.commitGraphLayerPath(checksum))
+}
+
+// AddCommitGraphLayer writes a layer of the commit-graph chain with encode,
+// which returns its checksum, and replaces the chain with the given layers
+// followed by the new one. The commit-graph file and the layers which
+// aren't in the chain anymore are removed.
+func (d *DotGit) AddCommitGraphLayer(layers []string, encode func(io.Writer) (plumbing.Hash, error)) error {
+	old, err := d.CommitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	dir := d.fs.Join(objectsPath, infoPath, commitGraphsPath)
+	if err := d.fs.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := d.fs.TempFile(dir, "tmp_graph_")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() {
+		_ = d.fs.Remove(tmpName) // don't check err, we might have renamed it
+	}()
+
+	h, err := encode(tmp)
+	if err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := d.fs.Rename(tmpName, d.commitGraphLayerPath(h.String())); err != nil {
+		return err
+	}
+
+	layers = append(layers[:len(layers):len(layers)], h.String())
+	err = d.writeFile(d.fs.Join(dir, commitGraphChainPath), func(w io.Writer) error {
+		for _, l := range layers {
+			if _, err := fmt.Fprintln(w, l); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.fs.Remove(d.fs.Join(objectsPath, infoPath, commitGraphPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return d.removeCommitGraphLayers(old, layers)
+}
+
+// removeCommitGraphLayers removes the layers of the commit-graph chain in
+// old which aren't in keep.
+func (d *DotGit) removeCommitGraphLayers(old, keep []string) error {
+	for _, l := range old {
+		if slices.Contains(keep, l) {
+			continue
+		}
+
+		err := d.fs.Remove(d.commitGraphLayerPath(l))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DotGit) commitGraphLayerPath(checksum string) string {
+	return d.fs.Join(objectsPath, infoPath, commitGraphsPath, fmt.Sprintf("graph-%s.graph", checksum))
+}
+
+// LooseObjectIndex returns a file pointer for read to the loose object
+// index, mapping the loose objects to their compat object IDs, or nil if it
+// doesn't exist.
+func (d *DotGit) LooseObjectIndex() (billy.File, error) {
+	f, err := d.fs.Open(d.fs.Join(objectsPath, compatmap.LooseIndexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// AppendLooseObjectIndex appends the mappings of m to the loose object
+// index, creating it if needed.
+func (d *DotGit) AppendLooseObjectIndex(m *compatmap.Map) (err error) {
+	path := d.fs.Join(objectsPath, compatmap.LooseIndexFileName)
+	f, err := d.fs.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	if err := f.Lock(); err != nil {
+		return err
+	}
+
+	defer func() { _ = f.Unlock() }()
+
+	fi, err := d.fs.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() == 0 {
+		return compatmap.EncodeLooseIndex(f, m)
+	}
+
+	return compatmap.AppendLooseIndex(f, m)
+}
+
+// CompatMaps returns the checksums of the map files of compat object IDs.
+func (d *DotGit) CompatMaps() ([]plumbing.Hash, error) {
+	files, err := d.fs.ReadDir(d.fs.Join(objectsPath, packPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var maps []plumbing.Hash
+	ext := "." + compatmap.Extension
+	for _, f := range files {
+		n := f.Name()
+		if !strings.HasPrefix(n, compatmap.Prefix) || !strings.HasSuffix(n, ext) {
+			continue
+		}
+
+		h, ok := plumbing.FromHex(n[len(compatmap.Prefix) : len(n)-len(ext)])
+		if !ok {
+			// Ignore files with badly-formatted names.
+			continue
+		}
+
+		maps = append(maps, h)
+	}
+
+	return maps, nil
+}
+
+// CompatMap returns a file pointer for read to the map file of compat
+// object IDs with the given checksum.
+func (d *DotGit) CompatMap(h plumbing.Hash) (billy.File, error) {
+	return d.fs.Open(d.compatMapPath(h))
+}
+
+// AddCompatMap writes a new map file of compat object IDs with encode,
+// which returns its checksum.
+func (d *DotGit) AddCompatMap(encode func(io.Writer) (plumbing.Hash, error)) error {
+	dir := d.fs.Join(objectsPath, packPath)
+	if err := d.fs.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := d.fs.TempFile(dir, "tmp_map_")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() {
+		_ = d.fs.Remove(tmpName) // don't check err, we might have renamed it
+	}()
+
+	h, err := encode(tmp)
+	if err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return d.fs.Rename(tmpName, d.compatMapPath(h))
+}
+
+func (d *DotGit) compatMapPath(h plumbing.Hash) string {
+	return d.fs.Join(objectsPath, packPath, fmt.Sprintf("%s%s.%s", compatmap.Prefix, h, compatmap.Extension))
+}
+
+// writeFile replaces the file at path with the one written by encode, or
+// removes it if encode is nil.
+func (d *DotGit) writeFile(path string, encode func(io.Writer) error) (err error) {
+	if encode == nil {
+		err := d.fs.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	tmp, err := d.fs.TempFile(filepath.Dir(path), "tmp_")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() {
+		_ = d.fs.Remove(tmpName) // don't check err, we might have renamed it
+	}()
+
+	if err := encode(tmp); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return d.fs.Rename(tmpName, path)
+}
+
 // NewObject return a writer for a new object file.
 func (d *DotGit) NewObject() (*ObjectWriter, error) {
 	d.cleanObjectList()
 
-	return newObjectWriter(d.fs)
+	return newObjectWriter(d.fs, d.objectFormat)
 }
 
 // ObjectsWithPrefix returns the hashes of objects that have the given prefix.
@@ -353,7 +797,7 @@ func (d *DotGit) ObjectsWithPrefix(prefix []byte) ([]plumbing.Hash, error) {
 	// Handle edge cases.
 	if len(prefix) < 1 {
 		return d.Objects()
-	} else if len(prefix) > plumbing.ZeroHash.Size() {
+	} else if len(prefix) > d.objectFormat.Size() {
 		return nil, nil
 	}
 
@@ -905,7 +1349,7 @@ func (d *DotGit) rewritePackedRefsWithoutRef(name plumbing.ReferenceName) (err e
 
 	// Creating the temp file in the same directory as the target file
 	// improves our chances for rename operation to be atomic.
-	tmp, err := d.fs.TempFile("", tmpPackedRefsPrefix)
+	tmp, err := d.fs.TempFile(".", tmpPackedRefsPrefix)
 	if err != nil {
 		return err
 	}
@@ -1081,6 +1525,12 @@ func (d *DotGit) PackRefs() (err error) {
 	if err = d.addRefsFromRefDir(&refs, seen); err != nil {
 		return err
 	}
+
+	// Like git, the symbolic references are kept loose, the packed-refs
+	// file only having hash references.
+	refs = slices.DeleteFunc(refs, func(ref *plumbing.Reference) bool {
+		return ref.Type() != plumbing.HashReference
+	})
 	if len(refs) == 0 {
 		// Nothing to do!
 		return nil
@@ -1091,7 +1541,7 @@ func (d *DotGit) PackRefs() (err error) {
 	}
 
 	// Write them all to a new temp packed-refs file.
-	tmp, err := d.fs.TempFile("", tmpPackedRefsPrefix)
+	tmp, err := d.fs.TempFile(".", tmpPackedRefsPrefix)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,86 @@
+package dotgit
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+)
+
+// Reflogs returns the names of the references having a reflog.
+func (d *DotGit) Reflogs() ([]plumbing.ReferenceName, error) {
+	var names []plumbing.ReferenceName
+	if err := d.walkReflogs(&names, []string{logsPath}); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func (d *DotGit) walkReflogs(names *[]plumbing.ReferenceName, relPath []string) error {
+	files, err := d.fs.ReadDir(d.fs.Join(relPath...))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, f := range files {
+		newRelPath := append(append([]string(nil), relPath...), f.Name())
+		if f.IsDir() {
+			if err := d.walkReflogs(names, newRelPath); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		name := strings.Join(newRelPath[1:], "/")
+		if strings.HasPrefix(f.Name(), "tmp_") || !isReflogName(name) {
+			continue
+		}
+
+		*names = append(*names, plumbing.ReferenceName(name))
+	}
+
+	return nil
+}
+
+// isReflogName returns true if name is the name of a reference which may
+// have a reflog, i.e. a pseudo-reference such as HEAD or a reference under
+// refs/.
+func isReflogName(name string) bool {
+	if strings.HasPrefix(name, refsPath+"/") {
+		return true
+	}
+
+	return !strings.Contains(name, "/") && strings.ToUpper(name) == name
+}
+
+// Reflog returns the entries of the reflog of the given reference, oldest
+// first, or none if it has no reflog.
+func (d *DotGit) Reflog(name plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	f, err := d.fs.Open(d.fs.Join(logsPath, name.String()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	return reflog.Decode(f)
+}
+
+// SetReflog replaces the entries of the reflog of the given reference.
+func (d *DotGit) SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) error {
+	return d.writeFile(d.fs.Join(logsPath, name.String()), func(w io.Writer) error {
+		return reflog.Encode(w, entries)
+	})
+}
@@ -796,6 +796,40 @@ func (s *SuiteDotGit) TestPackRefs() {
 	s.Equal("b8d3ffab552895c19b9fcf7aa264d277cde33881", ref.Hash().String())
 }
 
+func (s *SuiteDotGit) TestPackRefsSymbolic() {
+	fs := s.EmptyFS()
+
+	dir := New(fs)
+
+	err := dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/remotes/origin/master",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil)
+	s.Require().NoError(err)
+	err = dir.SetRef(plumbing.NewSymbolicReference(
+		"refs/remotes/origin/HEAD",
+		"refs/remotes/origin/master",
+	), nil)
+	s.Require().NoError(err)
+
+	err = dir.PackRefs()
+	s.Require().NoError(err)
+
+	// The symbolic reference stays loose and the packed-refs file is valid.
+	looseCount, err := dir.CountLooseRefs()
+	s.Require().NoError(err)
+	s.Equal(1, looseCount)
+
+	refs, err := dir.Refs()
+	s.Require().NoError(err)
+	s.Len(refs, 2)
+
+	ref, err := dir.Ref("refs/remotes/origin/HEAD")
+	s.Require().NoError(err)
+	s.Equal(plumbing.SymbolicReference, ref.Type())
+	s.Equal(plumbing.ReferenceName("refs/remotes/origin/master"), ref.Target())
+}
+
 func TestAlternatesDefault(t *testing.T) {
 	// Create a new dotgit object.
 	dotFS := osfs.New(t.TempDir())
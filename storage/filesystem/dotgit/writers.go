@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/format/objfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
@@ -28,10 +29,11 @@ type PackWriter struct {
 	checksum plumbing.Hash
 	parser   *packfile.Parser
 	writer   *idxfile.Writer
+	opts     []packfile.ParserOption
 	result   chan error
 }
 
-func newPackWrite(fs billy.Filesystem) (*PackWriter, error) {
+func newPackWrite(fs billy.Filesystem, opts ...packfile.ParserOption) (*PackWriter, error) {
 	fw, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_pack_")
 	if err != nil {
 		return nil, err
@@ -47,6 +49,7 @@ func newPackWrite(fs billy.Filesystem) (*PackWriter, error) {
 		fw:     fw,
 		fr:     fr,
 		synced: newSyncedReader(fw, fr),
+		opts:   opts,
 		result: make(chan error),
 	}
 
@@ -58,7 +61,8 @@ func (w *PackWriter) buildIndex() {
 	w.writer = new(idxfile.Writer)
 	var err error
 
-	w.parser = packfile.NewParser(w.synced, packfile.WithScannerObservers(w.writer))
+	opts := append([]packfile.ParserOption{packfile.WithScannerObservers(w.writer)}, w.opts...)
+	w.parser = packfile.NewParser(w.synced, opts...)
 
 	h, err := w.parser.Parse()
 	if err != nil {
@@ -247,16 +251,16 @@ type ObjectWriter struct {
 	f  billy.File
 }
 
-func newObjectWriter(fs billy.Filesystem) (*ObjectWriter, error) {
-	f, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_obj_")
+func newObjectWriter(fs billy.Filesystem, f format.ObjectFormat) (*ObjectWriter, error) {
+	tmp, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_obj_")
 	if err != nil {
 		return nil, err
 	}
 
 	return &ObjectWriter{
-		Writer: (*objfile.NewWriter(f)),
+		Writer: (*objfile.NewWriterWithObjectFormat(tmp, f)),
 		fs:     fs,
-		f:      f,
+		f:      tmp,
 	}, nil
 }
 
@@ -27,7 +27,7 @@ func (s *IndexStorage) SetIndex(idx *index.Index) (err error) {
 		}
 	}()
 
-	e := index.NewEncoder(bw)
+	e := index.NewEncoder(bw, index.WithObjectFormat(s.dir.ObjectFormat()))
 	err = e.Encode(idx)
 	return err
 }
@@ -48,7 +48,7 @@ func (s *IndexStorage) Index() (i *index.Index, err error) {
 
 	defer ioutil.CheckClose(f, &err)
 
-	d := index.NewDecoder(f)
+	d := index.NewDecoder(f, index.WithObjectFormat(s.dir.ObjectFormat()))
 	err = d.Decode(idx)
 	return idx, err
 }
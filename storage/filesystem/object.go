@@ -1,19 +1,27 @@
 package filesystem
 
 import (
+	"bytes"
 	"crypto"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/bitmap"
+	"github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/midx"
 	"github.com/go-git/go-git/v6/plumbing/format/objfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
 	"github.com/go-git/go-git/v6/utils/ioutil"
@@ -29,11 +37,25 @@ type ObjectStorage struct {
 	dir   *dotgit.DotGit
 	index map[plumbing.Hash]idxfile.Index
 
+	// midx is the multi-pack-index, if any. The indexes of the packfiles it
+	// covers are loaded lazily, only when an object is read from them.
+	midx        *midx.MultiPackIndex
+	midxPacks   []plumbing.Hash
+	midxCovered map[plumbing.Hash]struct{}
+
+	// bitmap is the reachability bitmap, if any, loaded when bitmapLoaded.
+	bitmap       *bitmap.Index
+	bitmapLoaded bool
+
+	// compat are the mappings to the compat object IDs, loaded lazily.
+	compat []compatmap.Mapping
+
 	packList    []plumbing.Hash
 	packListIdx int
 	packfiles   map[plumbing.Hash]*packfile.Packfile
 	muI         sync.RWMutex
 	muP         sync.RWMutex
+	muC         sync.Mutex
 }
 
 // NewObjectStorage creates a new ObjectStorage with the given .git directory and cache.
@@ -61,13 +83,25 @@ func (s *ObjectStorage) requireIndex() error {
 	s.muI.Lock()
 	defer s.muI.Unlock()
 
+	if s.index != nil {
+		return nil
+	}
+
 	s.index = make(map[plumbing.Hash]idxfile.Index)
 	packs, err := s.dir.ObjectPacks()
 	if err != nil {
 		return err
 	}
 
+	if err := s.loadMultiPackIndex(packs); err != nil {
+		return err
+	}
+
 	for _, h := range packs {
+		if _, ok := s.midxCovered[h]; ok {
+			continue
+		}
+
 		if err := s.loadIdxFile(h); err != nil {
 			return err
 		}
@@ -76,9 +110,304 @@ func (s *ObjectStorage) requireIndex() error {
 	return nil
 }
 
+// loadMultiPackIndex loads the multi-pack-index, if any. It's ignored when
+// it's corrupted or it covers packfiles which don't exist anymore, like git
+// does.
+func (s *ObjectStorage) loadMultiPackIndex(packs []plumbing.Hash) (err error) {
+	s.midx, s.midxPacks, s.midxCovered = nil, nil, nil
+
+	f, err := s.dir.MultiPackIndex()
+	if err != nil || f == nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	m, err := midx.Decode(f)
+	if err != nil {
+		return nil
+	}
+
+	existing := hashListAsMap(packs)
+	hashes := make([]plumbing.Hash, len(m.PackNames()))
+	for i, name := range m.PackNames() {
+		h, ok := plumbing.FromHex(strings.TrimSuffix(strings.TrimPrefix(name, "pack-"), ".idx"))
+		if !ok || name != fmt.Sprintf("pack-%s.idx", h) {
+			return nil
+		}
+
+		if _, ok := existing[h]; !ok {
+			return nil
+		}
+
+		hashes[i] = h
+	}
+
+	s.midx, s.midxPacks = m, hashes
+	s.midxCovered = hashListAsMap(hashes)
+	return nil
+}
+
+// packIndex returns the index of the given packfile, loading it if needed.
+func (s *ObjectStorage) packIndex(pack plumbing.Hash) (idxfile.Index, error) {
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	if idx, ok := s.index[pack]; ok {
+		return idx, nil
+	}
+
+	if err := s.loadIdxFile(pack); err != nil {
+		return nil, err
+	}
+
+	return s.index[pack], nil
+}
+
 // Reindex indexes again all packfiles. Useful if git changed packfiles externally
 func (s *ObjectStorage) Reindex() {
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
 	s.index = nil
+	s.midx, s.midxPacks, s.midxCovered = nil, nil, nil
+	s.bitmap, s.bitmapLoaded = nil, false
+}
+
+// ObjectPackIndex returns the index of the given packfile.
+func (s *ObjectStorage) ObjectPackIndex(h plumbing.Hash) (idxfile.Index, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	return s.packIndex(h)
+}
+
+// Bitmap returns the reachability bitmap of the first packfile having one,
+// or nil if none has one. The bitmaps which can't be read are ignored.
+func (s *ObjectStorage) Bitmap() (*bitmap.Index, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	s.muI.RLock()
+	if s.bitmapLoaded {
+		defer s.muI.RUnlock()
+		return s.bitmap, nil
+	}
+	s.muI.RUnlock()
+
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	var idx *bitmap.Index
+	for _, h := range packs {
+		if idx, err = s.loadBitmap(h); err != nil {
+			return nil, err
+		}
+
+		if idx != nil {
+			break
+		}
+	}
+
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	s.bitmap, s.bitmapLoaded = idx, true
+	return idx, nil
+}
+
+func (s *ObjectStorage) loadBitmap(pack plumbing.Hash) (_ *bitmap.Index, err error) {
+	f, err := s.dir.ObjectPackBitmap(pack)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := bitmap.Decode(f, pack, idx)
+	if err != nil {
+		return nil, nil
+	}
+
+	return b, nil
+}
+
+// SetBitmap writes the reachability bitmap of its packfile.
+func (s *ObjectStorage) SetBitmap(idx *bitmap.Index) error {
+	err := s.dir.SetObjectPackBitmap(idx.Pack(), func(w io.Writer) error {
+		return bitmap.NewEncoder(w).Encode(idx)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	s.bitmap, s.bitmapLoaded = nil, false
+	return nil
+}
+
+// CommitGraph returns the commit-graph, read from the commit-graph file or
+// else from the commit-graph chain, or nil if there is none.
+func (s *ObjectStorage) CommitGraph() (commitgraph.Index, error) {
+	idx, err := commitgraph.OpenChainOrFileIndex(s.dir.Fs())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return idx, err
+}
+
+// SetCommitGraph replaces the commit-graph with the given one, written to
+// the commit-graph file.
+func (s *ObjectStorage) SetCommitGraph(idx commitgraph.Index) error {
+	return s.dir.SetCommitGraph(func(w io.Writer) error {
+		return commitgraph.NewEncoder(w, commitGraphFormat(idx)).Encode(idx)
+	})
+}
+
+// CommitGraphChain returns the layers of the commit-graph chain, from the
+// oldest, or nil if there is none.
+func (s *ObjectStorage) CommitGraphChain() ([]commitgraph.Index, error) {
+	checksums, err := s.dir.CommitGraphChain()
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []commitgraph.Index
+	var parent commitgraph.Index
+	for _, c := range checksums {
+		f, err := s.dir.CommitGraphLayer(c)
+		if err == nil {
+			var idx commitgraph.Index
+			if idx, err = commitgraph.OpenFileIndexWithParent(f, parent); err == nil {
+				layers = append(layers, idx)
+				parent = idx
+				continue
+			}
+
+			f.Close() //nolint:errcheck
+		}
+
+		if parent != nil {
+			parent.Close() //nolint:errcheck
+		}
+
+		return nil, err
+	}
+
+	return layers, nil
+}
+
+// AddCommitGraphLayer replaces the layers of the commit-graph chain
+// following the first keep ones with a new layer, written to its own file,
+// made of the commits of idx which follow the kept layers. The commit-graph
+// file, if any, is removed.
+func (s *ObjectStorage) AddCommitGraphLayer(keep int, idx commitgraph.Index) error {
+	checksums, err := s.dir.CommitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	if keep < 0 || keep > len(checksums) {
+		return fmt.Errorf("cannot keep %d commit-graph layers out of %d", keep, len(checksums))
+	}
+
+	layers, err := s.CommitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	if len(layers) > 0 {
+		defer layers[len(layers)-1].Close() //nolint:errcheck
+	}
+
+	var base commitgraph.Index
+	hashes := make([]plumbing.Hash, keep)
+	for i, c := range checksums[:keep] {
+		hashes[i] = plumbing.NewHash(c)
+		base = layers[i]
+	}
+
+	return s.dir.AddCommitGraphLayer(checksums[:keep], func(w io.Writer) (plumbing.Hash, error) {
+		return commitgraph.NewEncoder(w, commitGraphFormat(idx)).EncodeLayer(idx, base, hashes)
+	})
+}
+
+// commitGraphFormat returns the option setting the object format of the
+// commits of idx.
+func commitGraphFormat(idx commitgraph.Index) commitgraph.EncoderOption {
+	objectFormat := format.SHA1
+	if n := idx.MaximumNumberOfHashes(); n > 0 {
+		if h, err := idx.GetHashByIndex(n - 1); err == nil && h.Size() == format.SHA256Size {
+			objectFormat = format.SHA256
+		}
+	}
+
+	return commitgraph.WithObjectFormat(objectFormat)
+}
+
+// HasMultiPackIndex returns true if there is a multi-pack-index, even if
+// it's ignored because it's outdated.
+func (s *ObjectStorage) HasMultiPackIndex() (bool, error) {
+	f, err := s.dir.MultiPackIndex()
+	if err != nil || f == nil {
+		return false, err
+	}
+
+	return true, f.Close()
+}
+
+// WriteMultiPackIndex writes the multi-pack-index of all the packfiles, or
+// removes it if there are none.
+func (s *ObjectStorage) WriteMultiPackIndex() error {
+	if err := s.requireIndex(); err != nil {
+		return err
+	}
+
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	if len(packs) == 0 {
+		return s.dir.SetMultiPackIndex(nil)
+	}
+
+	indexes := make([]midx.Pack, 0, len(packs))
+	for _, h := range packs {
+		idx, err := s.packIndex(h)
+		if err != nil {
+			return err
+		}
+
+		indexes = append(indexes, midx.Pack{Name: fmt.Sprintf("pack-%s.idx", h), Index: idx})
+	}
+
+	objectFormat := format.SHA1
+	if packs[0].Size() == format.SHA256Size {
+		objectFormat = format.SHA256
+	}
+
+	err = s.dir.SetMultiPackIndex(func(w io.Writer) error {
+		return midx.NewEncoder(w, objectFormat).Encode(indexes)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Reindex()
+	return nil
 }
 
 func (s *ObjectStorage) loadIdxFile(h plumbing.Hash) (err error) {
@@ -114,15 +443,26 @@ func (s *ObjectStorage) RawObjectWriter(typ plumbing.ObjectType, sz int64) (w io
 }
 
 func (s *ObjectStorage) NewEncodedObject() plumbing.EncodedObject {
-	return &plumbing.MemoryObject{}
+	return plumbing.NewMemoryObject(s.dir.ObjectFormat())
+}
+
+// ObjectFormat honors the storer.ObjectFormatStorer interface.
+func (s *ObjectStorage) ObjectFormat() format.ObjectFormat {
+	return s.dir.ObjectFormat()
 }
 
 func (s *ObjectStorage) PackfileWriter() (io.WriteCloser, error) {
+	return s.PackfileWriterWithOptions()
+}
+
+// PackfileWriterWithOptions honors packfile.ParserPackfileWriter, the
+// packfile being parsed with the given options to build its index.
+func (s *ObjectStorage) PackfileWriterWithOptions(opts ...packfile.ParserOption) (io.WriteCloser, error) {
 	if err := s.requireIndex(); err != nil {
 		return nil, err
 	}
 
-	w, err := s.dir.NewObjectPack()
+	w, err := s.dir.NewObjectPack(opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -309,7 +649,11 @@ func (s *ObjectStorage) encodedObjectSizeFromPackfile(h plumbing.Hash) (size int
 		return 0, plumbing.ErrObjectNotFound
 	}
 
-	idx := s.index[pack]
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return 0, err
+	}
+
 	hash, err := idx.FindHash(offset)
 	if err == nil {
 		obj, ok := s.objectCache.Get(hash)
@@ -483,9 +827,10 @@ func (s *ObjectStorage) getFromPackfile(h plumbing.Hash, canBeDelta bool) (plumb
 		return nil, plumbing.ErrObjectNotFound
 	}
 
-	s.muI.RLock()
-	idx := s.index[pack]
-	s.muI.RUnlock()
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return nil, err
+	}
 
 	p, err := s.packfile(idx, pack)
 	if err != nil {
@@ -556,7 +901,18 @@ func (s *ObjectStorage) findObjectInPackfile(h plumbing.Hash) (plumbing.Hash, pl
 	defer s.muI.Unlock()
 	s.muI.Lock()
 
+	if s.midx != nil {
+		pack, offset, err := s.midx.FindOffset(h)
+		if err == nil {
+			return s.midxPacks[pack], h, offset
+		}
+	}
+
 	for packfile, index := range s.index {
+		if _, ok := s.midxCovered[packfile]; ok {
+			continue
+		}
+
 		offset, err := index.FindOffset(h)
 		if err == nil {
 			return packfile, h, offset
@@ -581,7 +937,26 @@ func (s *ObjectStorage) HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
 	if err := s.requireIndex(); err != nil {
 		return nil, err
 	}
-	for _, index := range s.index {
+
+	s.muI.RLock()
+	defer s.muI.RUnlock()
+
+	if s.midx != nil {
+		for _, h := range s.midx.HashesWithPrefix(prefix) {
+			if _, ok := seen[h]; ok {
+				continue
+			}
+
+			seen[h] = struct{}{}
+			hashes = append(hashes, h)
+		}
+	}
+
+	for pack, index := range s.index {
+		if _, ok := s.midxCovered[pack]; ok {
+			continue
+		}
+
 		ei, err := index.Entries()
 		if err != nil {
 			return nil, err
@@ -645,13 +1020,18 @@ func (s *ObjectStorage) buildPackfileIters(
 	return &lazyPackfilesIter{
 		hashes: packs,
 		open: func(h plumbing.Hash) (storer.EncodedObjectIter, error) {
+			idx, err := s.packIndex(h)
+			if err != nil {
+				return nil, err
+			}
+
 			pack, err := s.dir.ObjectPack(h)
 			if err != nil {
 				return nil, err
 			}
 			return newPackfileIter(
-				s.dir.Fs(), pack, t, seen, s.index[h],
-				s.objectCache, s.options.KeepDescriptors, crypto.SHA1.Size(),
+				s.dir.Fs(), pack, t, seen, idx,
+				s.objectCache, s.options.KeepDescriptors, h.Size(),
 			)
 		},
 	}, nil
@@ -712,5 +1092,197 @@ func (s *ObjectStorage) ObjectPacks() ([]plumbing.Hash, error) {
 }
 
 func (s *ObjectStorage) DeleteOldObjectPackAndIndex(h plumbing.Hash, t time.Time) error {
-	return s.dir.DeleteOldObjectPackAndIndex(h, t)
+	if err := s.dir.DeleteOldObjectPackAndIndex(h, t); err != nil {
+		return err
+	}
+
+	// The packfile may be indexed, also by the multi-pack-index, and the
+	// cached objects may be read from it.
+	s.Reindex()
+	s.objectCache.Clear()
+	return nil
+}
+
+// SetPromisorPack marks the given packfile as received from a promisor
+// remote.
+func (s *ObjectStorage) SetPromisorPack(h plumbing.Hash) error {
+	return s.dir.SetObjectPackPromisor(h)
+}
+
+// IsPromisorPack returns true if the given packfile was received from a
+// promisor remote.
+func (s *ObjectStorage) IsPromisorPack(h plumbing.Hash) (bool, error) {
+	return s.dir.ObjectPackPromisor(h)
+}
+
+// SetKeptPack marks the given packfile as kept by the repacks, or unmarks
+// it if keep is false.
+func (s *ObjectStorage) SetKeptPack(h plumbing.Hash, keep bool) error {
+	return s.dir.SetObjectPackKeep(h, keep)
+}
+
+// IsKeptPack returns true if the given packfile is kept by the repacks.
+func (s *ObjectStorage) IsKeptPack(h plumbing.Hash) (bool, error) {
+	return s.dir.ObjectPackKeep(h)
+}
+
+// VerifyLooseObject checks that the given loose object can be inflated and
+// that its content matches its hash.
+func (s *ObjectStorage) VerifyLooseObject(h plumbing.Hash) (err error) {
+	f, err := s.dir.Object(h)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return plumbing.ErrObjectNotFound
+		}
+
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	r, err := objfile.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	t, size, err := r.Header()
+	if err != nil {
+		return err
+	}
+
+	objectFormat := format.SHA1
+	if h.Size() == format.SHA256Size {
+		objectFormat = format.SHA256
+	}
+
+	hasher := plumbing.NewHasher(objectFormat, t, size)
+	n, err := ioutil.CopyBufferPool(hasher, r)
+	if err != nil {
+		return packfile.ErrZLib.AddDetails(err.Error())
+	}
+
+	if n != size {
+		return fmt.Errorf("%w: object %s has size %d, expected %d", objfile.ErrHeader, h, n, size)
+	}
+
+	if actual := hasher.Sum(); !actual.Equal(h) {
+		return fmt.Errorf("hash mismatch for object %s: found %s", h, actual)
+	}
+
+	return nil
+}
+
+// VerifyObjectPack checks the checksums of the given packfile and of its
+// index, and that every object of the packfile matches the index.
+func (s *ObjectStorage) VerifyObjectPack(h plumbing.Hash) error {
+	idx, err := s.verifyObjectPackIdx(h)
+	if err != nil {
+		return err
+	}
+
+	f, err := s.dir.ObjectPack(h)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	w := new(idxfile.Writer)
+	checksum, err := packfile.NewParser(f,
+		packfile.WithObjectFormat(s.dir.ObjectFormat()),
+		packfile.WithScannerObservers(w),
+	).Parse()
+	if err != nil {
+		return err
+	}
+
+	if !checksum.Equal(h) || !checksum.Equal(idx.PackfileChecksum) {
+		return fmt.Errorf("%w: checksum %s doesn't match the pack %s", packfile.ErrMalformedPackfile, checksum, h)
+	}
+
+	parsed, err := w.Index()
+	if err != nil {
+		return err
+	}
+
+	expected, err := idx.Count()
+	if err != nil {
+		return err
+	}
+
+	if count, _ := parsed.Count(); count != expected {
+		return fmt.Errorf("%w: %d objects in the pack %s, expected %d", idxfile.ErrMalformedIdxFile, count, h, expected)
+	}
+
+	entries, err := parsed.Entries()
+	if err != nil {
+		return err
+	}
+
+	defer entries.Close() //nolint:errcheck
+
+	for {
+		e, err := entries.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		offset, err := idx.FindOffset(e.Hash)
+		if err != nil {
+			return fmt.Errorf("%w: object %s of the pack %s: %w", idxfile.ErrMalformedIdxFile, e.Hash, h, err)
+		}
+
+		crc, err := idx.FindCRC32(e.Hash)
+		if err != nil {
+			return err
+		}
+
+		if offset != int64(e.Offset) || crc != e.CRC32 {
+			return fmt.Errorf("%w: object %s of the pack %s doesn't match", idxfile.ErrMalformedIdxFile, e.Hash, h)
+		}
+	}
+}
+
+// verifyObjectPackIdx decodes the index of the given packfile, checking its
+// checksum.
+func (s *ObjectStorage) verifyObjectPackIdx(h plumbing.Hash) (_ *idxfile.MemoryIndex, err error) {
+	f, err := s.dir.ObjectPackIdx(h)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	hf := crypto.SHA1
+	if h.Size() == format.SHA256Size {
+		hf = crypto.SHA256
+	}
+
+	if len(data) < h.Size() {
+		return nil, idxfile.ErrMalformedIdxFile
+	}
+
+	sum := hash.New(hf)
+	sum.Write(data[:len(data)-h.Size()]) //nolint:errcheck
+	if !bytes.Equal(sum.Sum(nil), data[len(data)-h.Size():]) {
+		return nil, fmt.Errorf("%w: checksum mismatch of the index of the pack %s", idxfile.ErrMalformedIdxFile, h)
+	}
+
+	idx := idxfile.NewMemoryIndex(h.Size())
+	if err := idxfile.NewDecoder(bytes.NewReader(data)).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
 }
@@ -8,10 +8,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-billy/v6"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/bitmap"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
 	"github.com/stretchr/testify/suite"
 
@@ -197,6 +199,182 @@ func (s *FsSuite) TestGetFromPackfileMultiplePackfilesLargeObjectThreshold() {
 	s.Equal(expected, obj.Hash())
 }
 
+func countObjects(s *FsSuite, o *ObjectStorage) int {
+	iter, err := o.IterEncodedObjects(plumbing.AnyObject)
+	s.Require().NoError(err)
+
+	var count int
+	s.Require().NoError(iter.ForEach(func(plumbing.EncodedObject) error {
+		count++
+		return nil
+	}))
+
+	return count
+}
+
+func (s *FsSuite) TestMultiPackIndex() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	count := countObjects(s, o)
+
+	ok, err := o.HasMultiPackIndex()
+	s.Require().NoError(err)
+	s.False(ok)
+
+	s.Require().NoError(o.WriteMultiPackIndex())
+	ok, err = o.HasMultiPackIndex()
+	s.Require().NoError(err)
+	s.True(ok)
+
+	o = NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	s.Require().NoError(o.requireIndex())
+	s.NotNil(o.midx)
+	s.Len(o.midxPacks, 2)
+	s.Empty(o.index)
+
+	for _, h := range []string{
+		"8d45a34641d73851e01d3754320b33bb5be3c4d3",
+		"e9cfa4c9ca160546efd7e8582ec77952a27b17db",
+	} {
+		expected := plumbing.NewHash(h)
+		obj, err := o.EncodedObject(plumbing.AnyObject, expected)
+		s.Require().NoError(err)
+		s.Equal(expected, obj.Hash())
+
+		hashes, err := o.HashesWithPrefix(expected.Bytes()[:4])
+		s.Require().NoError(err)
+		s.Equal([]plumbing.Hash{expected}, hashes)
+	}
+
+	// Only the indexes of the packfiles read from are loaded.
+	s.Len(o.index, 2)
+	s.Equal(count, countObjects(s, o))
+}
+
+func (s *FsSuite) TestMultiPackIndexOutdated() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	s.Require().NoError(o.WriteMultiPackIndex())
+
+	packs, err := o.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().NoError(o.DeleteOldObjectPackAndIndex(packs[0], time.Time{}))
+
+	// The multi-pack-index covering a deleted packfile is ignored.
+	o = NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	s.Require().NoError(o.requireIndex())
+	s.Nil(o.midx)
+	s.Len(o.index, 1)
+}
+
+func (s *FsSuite) TestBitmap() {
+	fs := fixtures.Basic().One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	b, err := o.Bitmap()
+	s.Require().NoError(err)
+	s.Nil(b)
+
+	packs, err := o.ObjectPacks()
+	s.Require().NoError(err)
+	idx, err := o.ObjectPackIndex(packs[0])
+	s.Require().NoError(err)
+	b, err = bitmap.NewIndex(packs[0], idx)
+	s.Require().NoError(err)
+	s.Require().NoError(o.SetBitmap(b))
+
+	b, err = NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault()).Bitmap()
+	s.Require().NoError(err)
+	s.Require().NotNil(b)
+	s.Equal(packs[0], b.Pack())
+
+	// The bitmap is removed along with its packfile.
+	s.Require().NoError(o.DeleteOldObjectPackAndIndex(packs[0], time.Time{}))
+	_, err = fs.Stat(fmt.Sprintf("objects/pack/pack-%s.bitmap", packs[0]))
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *FsSuite) TestVerifyLooseObject() {
+	fs := fixtures.ByTag(".git").ByTag("unpacked").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	var hashes []plumbing.Hash
+	s.Require().NoError(o.ForEachObjectHash(func(h plumbing.Hash) error {
+		hashes = append(hashes, h)
+		return nil
+	}))
+	s.Require().NotEmpty(hashes)
+
+	for _, h := range hashes {
+		s.NoError(o.VerifyLooseObject(h), h.String())
+	}
+
+	s.ErrorIs(o.VerifyLooseObject(plumbing.NewHash("0000000000000000000000000000000000000001")), plumbing.ErrObjectNotFound)
+
+	// A valid object stored under another name.
+	path := filepath.Join("objects", hashes[0].String()[:2], hashes[0].String()[2:])
+	renamed := filepath.Join("objects", hashes[1].String()[:2], hashes[1].String()[2:])
+	s.Require().NoError(fs.Remove(renamed))
+	s.Require().NoError(copyPath(fs, renamed, path))
+	s.ErrorContains(o.VerifyLooseObject(hashes[1]), "hash mismatch")
+
+	s.Require().NoError(corruptFile(fs, path, 10))
+	s.Error(o.VerifyLooseObject(hashes[0]))
+}
+
+func (s *FsSuite) TestVerifyObjectPack() {
+	fs := fixtures.Basic().One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	packs, err := o.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(packs, 1)
+	s.NoError(o.VerifyObjectPack(packs[0]))
+
+	idx := fmt.Sprintf("objects/pack/pack-%s.idx", packs[0])
+	s.Require().NoError(corruptFile(fs, idx, 1100))
+	s.ErrorContains(o.VerifyObjectPack(packs[0]), "checksum mismatch")
+
+	fs = fixtures.Basic().One().DotGit()
+	o = NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	pack := fmt.Sprintf("objects/pack/pack-%s.pack", packs[0])
+	s.Require().NoError(corruptFile(fs, pack, 1000))
+	s.Error(o.VerifyObjectPack(packs[0]))
+}
+
+// corruptFile flips the bits of the byte at the given offset of a file.
+func corruptFile(fs billy.Filesystem, path string, offset int64) error {
+	f, err := fs.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, offset); err != nil {
+		return err
+	}
+
+	b[0] ^= 0xff
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	return err
+}
+
+func copyPath(fs billy.Filesystem, dst, src string) error {
+	f, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	return copyFile(fs, dst, f)
+}
+
 func (s *FsSuite) TestIter() {
 	for _, f := range fixtures.ByTag(".git").ByTag("packfile") {
 		fs := f.DotGit()
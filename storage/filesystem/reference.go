@@ -2,28 +2,64 @@ package filesystem
 
 import (
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/format/reftable"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
 )
 
 type ReferenceStorage struct {
 	dir *dotgit.DotGit
+	// reftable is the reftable stack of the references, when
+	// extensions.refStorage is reftable, nil for the files backend.
+	reftable *reftable.Stack
+	// err is the error selecting the reference storage when the storage
+	// was created, returned by the reference operations until a config is
+	// set successfully.
+	err error
 }
 
 func (r *ReferenceStorage) SetReference(ref *plumbing.Reference) error {
-	return r.dir.SetRef(ref, nil)
+	return r.CheckAndSetReference(ref, nil)
 }
 
 func (r *ReferenceStorage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.reftable != nil && !isFilesPseudoRef(ref.Name()) {
+		return r.reftableSetReference(ref, old)
+	}
+
 	return r.dir.SetRef(ref, old)
 }
 
 func (r *ReferenceStorage) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.reftable != nil && !isFilesPseudoRef(n) {
+		return r.reftableReference(n)
+	}
+
 	return r.dir.Ref(n)
 }
 
 func (r *ReferenceStorage) IterReferences() (storer.ReferenceIter, error) {
-	refs, err := r.dir.Refs()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var refs []*plumbing.Reference
+	var err error
+	if r.reftable != nil {
+		refs, err = r.reftableReferences()
+	} else {
+		refs, err = r.dir.Refs()
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -32,13 +68,79 @@ func (r *ReferenceStorage) IterReferences() (storer.ReferenceIter, error) {
 }
 
 func (r *ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.reftable != nil && !isFilesPseudoRef(n) {
+		return r.reftableRemoveReference(n)
+	}
+
 	return r.dir.RemoveRef(n)
 }
 
 func (r *ReferenceStorage) CountLooseRefs() (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.reftable != nil {
+		// The reftable stack has no loose references.
+		return 0, nil
+	}
+
 	return r.dir.CountLooseRefs()
 }
 
 func (r *ReferenceStorage) PackRefs() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.reftable != nil {
+		return r.reftable.Compact()
+	}
+
 	return r.dir.PackRefs()
 }
+
+// Reflogs returns the names of the references having a reflog. The reflogs
+// of the reftable backend are stored in its log records.
+func (r *ReferenceStorage) Reflogs() ([]plumbing.ReferenceName, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.reftable != nil {
+		return r.reftableReflogs()
+	}
+
+	return r.dir.Reflogs()
+}
+
+// Reflog returns the entries of the reflog of the given reference, oldest
+// first.
+func (r *ReferenceStorage) Reflog(n plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.reftable != nil {
+		return r.reftableReflog(n)
+	}
+
+	return r.dir.Reflog(n)
+}
+
+// SetReflog replaces the entries of the reflog of the given reference.
+func (r *ReferenceStorage) SetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.reftable != nil {
+		return r.reftableSetReflog(n, entries)
+	}
+
+	return r.dir.SetReflog(n, entries)
+}
@@ -0,0 +1,420 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/format/reftable"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+const (
+	reftableDir    = "reftable"
+	packedRefsFile = "packed-refs"
+	// invalidHEAD is the target of the HEAD file of the repositories using
+	// reftable, so the older versions of git don't recognize them.
+	invalidHEAD = plumbing.ReferenceName("refs/heads/.invalid")
+)
+
+// isFilesPseudoRef returns true for the pseudo references which are stored in
+// files even by the reftable backend.
+func isFilesPseudoRef(n plumbing.ReferenceName) bool {
+	return n == "FETCH_HEAD" || n == "MERGE_HEAD"
+}
+
+// usesReftable returns true if cfg selects the reftable backend.
+func usesReftable(cfg *config.Config) bool {
+	return cfg.Core.RepositoryFormatVersion == format.Version_1 &&
+		cfg.Extensions.RefStorage == config.RefStorageReftable
+}
+
+// newStack returns the reftable stack of the repository.
+func (r *ReferenceStorage) newStack(cfg *config.Config) (*reftable.Stack, error) {
+	fs, err := r.dir.Fs().Chroot(reftableDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return reftable.NewStack(fs, &reftable.StackOptions{
+		ObjectFormat: cfg.Extensions.ObjectFormat,
+	}), nil
+}
+
+// setRefStorage selects the reference storage of cfg.
+func (r *ReferenceStorage) setRefStorage(cfg *config.Config) error {
+	if !usesReftable(cfg) {
+		r.reftable = nil
+		return nil
+	}
+
+	if r.reftable != nil {
+		return nil
+	}
+
+	stack, err := r.newStack(cfg)
+	if err != nil {
+		return err
+	}
+
+	r.reftable = stack
+	return nil
+}
+
+// migrateRefStorage copies the references and the reflogs of the files
+// backend to the reftable stack, when cfg enables it on a repository without
+// one, and returns true if it did. The files are kept until removeFilesRefs
+// is called, once cfg is written.
+func (r *ReferenceStorage) migrateRefStorage(cfg *config.Config) (bool, error) {
+	if !usesReftable(cfg) || r.reftable != nil {
+		return false, nil
+	}
+
+	stack, err := r.newStack(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := stack.Exists()
+	if err != nil || ok {
+		return false, err
+	}
+
+	if err := r.migrateToReftable(stack); err != nil {
+		return false, errors.Join(err, r.removeReftable())
+	}
+
+	return true, nil
+}
+
+// migrateToReftable copies the references and the reflogs of the files
+// backend to stack.
+func (r *ReferenceStorage) migrateToReftable(stack *reftable.Stack) error {
+	refs, err := r.dir.Refs()
+	if err != nil {
+		return err
+	}
+
+	names, err := r.dir.Reflogs()
+	if err != nil {
+		return err
+	}
+
+	a, err := stack.NewAddition()
+	if err != nil {
+		return err
+	}
+
+	defer a.Close() //nolint:errcheck
+	for _, ref := range refs {
+		a.AddRef(recordFromRef(ref))
+	}
+
+	for _, n := range names {
+		entries, err := r.dir.Reflog(n)
+		if err != nil {
+			return err
+		}
+
+		addLogRecords(a, n, entries)
+	}
+
+	return a.Commit()
+}
+
+// removeReftable removes the reftable stack of a failed migration.
+func (r *ReferenceStorage) removeReftable() error {
+	return util.RemoveAll(r.dir.Fs(), reftableDir)
+}
+
+// removeFilesRefs removes the references of the files backend once they're
+// migrated, and points the HEAD file to an invalid branch.
+func (r *ReferenceStorage) removeFilesRefs() error {
+	refs, err := r.dir.Refs()
+	if err != nil {
+		return err
+	}
+
+	// The packed-refs file is removed first, so it isn't rewritten for each
+	// loose reference.
+	if err := r.dir.Fs().Remove(packedRefsFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			continue
+		}
+
+		if err := r.dir.RemoveRef(ref.Name()); err != nil {
+			return err
+		}
+	}
+
+	return r.dir.SetRef(plumbing.NewSymbolicReference(plumbing.HEAD, invalidHEAD), nil)
+}
+
+func recordFromRef(ref *plumbing.Reference) *reftable.RefRecord {
+	rec := &reftable.RefRecord{RefName: ref.Name().String()}
+	switch ref.Type() {
+	case plumbing.SymbolicReference:
+		rec.Type = reftable.RefValueSymbolic
+		rec.Target = ref.Target().String()
+	default:
+		rec.Type = reftable.RefValueHash
+		rec.Hash = ref.Hash()
+	}
+
+	return rec
+}
+
+func refFromRecord(rec *reftable.RefRecord) *plumbing.Reference {
+	name := plumbing.ReferenceName(rec.RefName)
+	if rec.Type == reftable.RefValueSymbolic {
+		return plumbing.NewSymbolicReference(name, plumbing.ReferenceName(rec.Target))
+	}
+
+	return plumbing.NewHashReference(name, rec.Hash)
+}
+
+// reftableSetReference sets ref, if old is the current value when not nil.
+// As with the files backend, no reflog entry is written.
+func (r *ReferenceStorage) reftableSetReference(ref, old *plumbing.Reference) error {
+	a, err := r.reftable.NewAddition()
+	if err != nil {
+		return err
+	}
+
+	defer a.Close() //nolint:errcheck
+	if old != nil {
+		rec, err := a.Merged().Ref(old.Name().String())
+		if err != nil {
+			return err
+		}
+
+		if rec == nil {
+			return plumbing.ErrReferenceNotFound
+		}
+
+		if refFromRecord(rec).Hash() != old.Hash() {
+			return storage.ErrReferenceHasChanged
+		}
+	}
+
+	a.AddRef(recordFromRef(ref))
+	return a.Commit()
+}
+
+func (r *ReferenceStorage) reftableReference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	rec, err := r.reftable.Ref(n.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+
+	return refFromRecord(rec), nil
+}
+
+func (r *ReferenceStorage) reftableReferences() ([]*plumbing.Reference, error) {
+	m, err := r.reftable.Merged()
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := m.Refs()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	for {
+		rec, err := it.Next()
+		if err == io.EOF {
+			return refs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// As with the files backend, only HEAD and the references under
+		// refs/ are listed, not the other pseudo references.
+		if rec.RefName != plumbing.HEAD.String() && !strings.HasPrefix(rec.RefName, "refs/") {
+			continue
+		}
+
+		refs = append(refs, refFromRecord(rec))
+	}
+}
+
+func (r *ReferenceStorage) reftableRemoveReference(n plumbing.ReferenceName) error {
+	a, err := r.reftable.NewAddition()
+	if err != nil {
+		return err
+	}
+
+	defer a.Close() //nolint:errcheck
+	rec, err := a.Merged().Ref(n.String())
+	if err != nil || rec == nil {
+		return err
+	}
+
+	a.AddRef(&reftable.RefRecord{RefName: n.String(), Type: reftable.RefValueDeletion})
+	return a.Commit()
+}
+
+func (r *ReferenceStorage) reftableReflogs() ([]plumbing.ReferenceName, error) {
+	m, err := r.reftable.Merged()
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := m.Logs()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []plumbing.ReferenceName
+	for {
+		rec, err := it.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The records are sorted by name.
+		n := plumbing.ReferenceName(rec.RefName)
+		if len(names) == 0 || names[len(names)-1] != n {
+			names = append(names, n)
+		}
+	}
+}
+
+func (r *ReferenceStorage) reftableReflog(n plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	m, err := r.reftable.Merged()
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := m.RefLogs(n.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*reflog.Entry
+	for {
+		rec, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entryFromRecord(rec))
+	}
+
+	// The records are sorted from the newest to the oldest.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+// reftableSetReflog replaces the log records of n in a single table, deleting
+// the current records and adding the entries.
+func (r *ReferenceStorage) reftableSetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	a, err := r.reftable.NewAddition()
+	if err != nil {
+		return err
+	}
+
+	defer a.Close() //nolint:errcheck
+	it, err := a.Merged().RefLogs(n.String())
+	if err != nil {
+		return err
+	}
+
+	for {
+		rec, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		a.AddLog(&reftable.LogRecord{RefName: rec.RefName, UpdateIndex: rec.UpdateIndex, Deleted: true})
+	}
+
+	addLogRecords(a, n, entries)
+	return a.Commit()
+}
+
+// addLogRecords adds the log records of the entries of n, oldest first. The
+// update indexes of the records only order them, so they are numbered from the
+// update index of the addition, past the ones of the deleted records.
+func addLogRecords(a *reftable.Addition, n plumbing.ReferenceName, entries []*reflog.Entry) {
+	index := a.UpdateIndex()
+	for i, e := range entries {
+		a.AddLog(recordFromEntry(n, index+uint64(i), e))
+	}
+}
+
+func recordFromEntry(n plumbing.ReferenceName, updateIndex uint64, e *reflog.Entry) *reftable.LogRecord {
+	sec := e.When.Unix()
+	if sec < 0 {
+		sec = 0
+	}
+
+	_, offset := e.When.Zone()
+	tz := offset / 60 / 60 * 100
+	tz += offset / 60 % 60
+
+	msg := e.Message
+	if msg != "" && !strings.HasSuffix(msg, "\n") {
+		// git terminates the messages of the log records with a newline.
+		msg += "\n"
+	}
+
+	return &reftable.LogRecord{
+		RefName:     n.String(),
+		UpdateIndex: updateIndex,
+		OldHash:     e.Old,
+		NewHash:     e.New,
+		Name:        e.Name,
+		Email:       e.Email,
+		Time:        uint64(sec),
+		TZOffset:    int16(tz),
+		Message:     msg,
+	}
+}
+
+func entryFromRecord(rec *reftable.LogRecord) *reflog.Entry {
+	offset := int(rec.TZOffset)/100*60*60 + int(rec.TZOffset)%100*60
+	return &reflog.Entry{
+		Old:     rec.OldHash,
+		New:     rec.NewHash,
+		Name:    rec.Name,
+		Email:   rec.Email,
+		When:    time.Unix(int64(rec.Time), 0).In(time.FixedZone("", offset)),
+		Message: strings.TrimSuffix(rec.Message, "\n"),
+	}
+}
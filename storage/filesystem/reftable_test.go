@@ -0,0 +1,242 @@
+package filesystem_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/format/reftable"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReftableRefStorage(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	sto := filesystem.NewStorage(fs, nil)
+	require.NoError(t, sto.Init())
+
+	main := plumbing.NewHashReference("refs/heads/main", plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	require.NoError(t, sto.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, main.Name())))
+	require.NoError(t, sto.SetReference(main))
+
+	cfg, err := sto.Config()
+	require.NoError(t, err)
+	cfg.Core.RepositoryFormatVersion = format.Version_1
+	cfg.Extensions.RefStorage = config.RefStorageReftable
+	require.NoError(t, sto.SetConfig(cfg))
+
+	// The references are migrated, and HEAD is invalid for the older git.
+	_, err = fs.Stat("reftable/tables.list")
+	require.NoError(t, err)
+	head, err := util.ReadFile(fs, "HEAD")
+	require.NoError(t, err)
+	require.Equal(t, "ref: refs/heads/.invalid\n", string(head))
+
+	ref, err := sto.Reference(plumbing.HEAD)
+	require.NoError(t, err)
+	require.Equal(t, main.Name(), ref.Target())
+
+	other := plumbing.NewHashReference("refs/heads/other", main.Hash())
+	require.NoError(t, sto.SetReference(other))
+
+	// The reftable backend is selected when opening the repository.
+	sto = filesystem.NewStorage(fs, nil)
+	ref, err = sto.Reference(other.Name())
+	require.NoError(t, err)
+	require.Equal(t, other, ref)
+
+	moved := plumbing.NewHashReference(main.Name(), plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	require.ErrorIs(t, sto.CheckAndSetReference(moved, plumbing.NewHashReference(main.Name(), plumbing.ZeroHash)),
+		storage.ErrReferenceHasChanged)
+	require.NoError(t, sto.CheckAndSetReference(moved, main))
+
+	require.NoError(t, sto.RemoveReference(other.Name()))
+	_, err = sto.Reference(other.Name())
+	require.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	iter, err := sto.IterReferences()
+	require.NoError(t, err)
+	var refs []*plumbing.Reference
+	require.NoError(t, iter.ForEach(func(r *plumbing.Reference) error {
+		refs = append(refs, r)
+		return nil
+	}))
+	require.Equal(t, []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, main.Name()),
+		moved,
+	}, refs)
+
+	require.NoError(t, sto.PackRefs())
+	n, err := sto.CountLooseRefs()
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	resolved, err := storer.ResolveReference(sto, plumbing.HEAD)
+	require.NoError(t, err)
+	require.Equal(t, moved.Hash(), resolved.Hash())
+}
+
+func TestReftableMigration(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	sto := filesystem.NewStorage(fs, nil)
+	require.NoError(t, sto.Init())
+
+	packed := plumbing.NewHashReference("refs/heads/packed", plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	loose := plumbing.NewHashReference("refs/heads/loose", plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	require.NoError(t, sto.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, packed.Name())))
+	require.NoError(t, sto.SetReference(packed))
+	require.NoError(t, sto.PackRefs())
+	require.NoError(t, sto.SetReference(loose))
+
+	// A config failing to be written leaves the files backend untouched.
+	cfg, err := sto.Config()
+	require.NoError(t, err)
+	cfg.Core.RepositoryFormatVersion = format.Version_1
+	cfg.Extensions.RefStorage = config.RefStorageReftable
+	cfg.Remotes["origin"] = &config.RemoteConfig{Name: "other"}
+	require.ErrorIs(t, sto.SetConfig(cfg), config.ErrInvalid)
+
+	_, err = fs.Stat("reftable")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	head, err := util.ReadFile(fs, "HEAD")
+	require.NoError(t, err)
+	require.Equal(t, "ref: refs/heads/packed\n", string(head))
+	ref, err := sto.Reference(loose.Name())
+	require.NoError(t, err)
+	require.Equal(t, loose, ref)
+
+	// Once the config is written, the files of the references are removed.
+	delete(cfg.Remotes, "origin")
+	require.NoError(t, sto.SetConfig(cfg))
+	for _, name := range []string{"packed-refs", "refs/heads/loose"} {
+		_, err = fs.Stat(name)
+		require.ErrorIs(t, err, os.ErrNotExist, name)
+	}
+
+	sto = filesystem.NewStorage(fs, nil)
+	for _, want := range []*plumbing.Reference{packed, loose} {
+		ref, err = sto.Reference(want.Name())
+		require.NoError(t, err)
+		require.Equal(t, want, ref)
+	}
+}
+
+// chrootFailFS is a filesystem failing to chroot.
+type chrootFailFS struct {
+	billy.Filesystem
+}
+
+func (fs *chrootFailFS) Chroot(string) (billy.Filesystem, error) {
+	return nil, errors.New("chroot failed")
+}
+
+func TestReftableRefStorageError(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	sto := filesystem.NewStorage(fs, nil)
+	require.NoError(t, sto.Init())
+
+	cfg, err := sto.Config()
+	require.NoError(t, err)
+	cfg.Core.RepositoryFormatVersion = format.Version_1
+	cfg.Extensions.RefStorage = config.RefStorageReftable
+	require.NoError(t, sto.SetConfig(cfg))
+
+	// The reftable stack can't be opened, so the references aren't read
+	// from the files backend instead.
+	sto = filesystem.NewStorage(&chrootFailFS{fs}, nil)
+	_, err = sto.Reference(plumbing.HEAD)
+	require.ErrorContains(t, err, "chroot failed")
+	_, err = sto.IterReferences()
+	require.ErrorContains(t, err, "chroot failed")
+	ref := plumbing.NewHashReference("refs/heads/main", plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	require.ErrorContains(t, sto.SetReference(ref), "chroot failed")
+}
+
+func TestReftableReflog(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	sto := filesystem.NewStorage(fs, nil)
+	require.NoError(t, sto.Init())
+
+	first := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	second := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	when := time.Unix(1700000000, 0).In(time.FixedZone("", -(7*60+30)*60))
+	entries := []*reflog.Entry{
+		{Old: plumbing.ZeroHash, New: first, Name: "A", Email: "a@example.com", When: when, Message: "commit (initial): first"},
+		{Old: first, New: second, Name: "A", Email: "a@example.com", When: when.Add(time.Minute), Message: "commit: second"},
+	}
+	require.NoError(t, sto.SetReflog("refs/heads/main", entries))
+
+	cfg, err := sto.Config()
+	require.NoError(t, err)
+	cfg.Core.RepositoryFormatVersion = format.Version_1
+	cfg.Extensions.RefStorage = config.RefStorageReftable
+	require.NoError(t, sto.SetConfig(cfg))
+
+	// The reflogs are migrated to the log records.
+	require.NoError(t, util.RemoveAll(fs, "logs"))
+	sto = filesystem.NewStorage(fs, nil)
+	got, err := sto.Reflog("refs/heads/main")
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	for i, e := range got {
+		require.True(t, entries[i].When.Equal(e.When))
+		_, offset := e.When.Zone()
+		require.Equal(t, -(7*60+30)*60, offset)
+		e.When = entries[i].When
+		require.Equal(t, entries[i], e)
+	}
+
+	// The entries are replaced, in a single table.
+	head := []*reflog.Entry{entries[1]}
+	require.NoError(t, sto.SetReflog(plumbing.HEAD, head))
+	require.NoError(t, sto.SetReflog("refs/heads/main", entries[1:]))
+	got, err = sto.Reflog("refs/heads/main")
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, second, got[0].New)
+
+	// The records are numbered within the update indexes of their table.
+	stackFS, err := fs.Chroot("reftable")
+	require.NoError(t, err)
+	m, err := reftable.NewStack(stackFS, nil).Merged()
+	require.NoError(t, err)
+	it, err := m.RefLogs("refs/heads/main")
+	require.NoError(t, err)
+	rec, err := it.Next()
+	require.NoError(t, err)
+	require.Equal(t, m.MaxUpdateIndex(), rec.UpdateIndex)
+
+	names, err := sto.Reflogs()
+	require.NoError(t, err)
+	require.Equal(t, []plumbing.ReferenceName{plumbing.HEAD, "refs/heads/main"}, names)
+
+	require.NoError(t, sto.SetReflog("refs/heads/main", nil))
+	require.NoError(t, sto.PackRefs())
+	names, err = sto.Reflogs()
+	require.NoError(t, err)
+	require.Equal(t, []plumbing.ReferenceName{plumbing.HEAD}, names)
+	got, err = sto.Reflog("refs/heads/main")
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	_, err = fs.Stat("logs")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
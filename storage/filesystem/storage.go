@@ -2,6 +2,9 @@
 package filesystem
 
 import (
+	"errors"
+
+	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
 
@@ -66,7 +69,7 @@ func NewStorageWithOptions(fs billy.Filesystem, c cache.Object, ops Options) *St
 		c = cache.NewObjectLRUDefault()
 	}
 
-	return &Storage{
+	s := &Storage{
 		fs:  fs,
 		dir: dir,
 
@@ -77,6 +80,55 @@ func NewStorageWithOptions(fs billy.Filesystem, c cache.Object, ops Options) *St
 		ConfigStorage:    ConfigStorage{dir: dir},
 		ModuleStorage:    ModuleStorage{dir: dir},
 	}
+
+	// The reference storage is selected by extensions.refStorage, and the
+	// object format by extensions.objectFormat. A config failing to load is
+	// reported when the repository reads it, the storage falling back to the
+	// files backend and SHA-1 meanwhile. A reference storage failing to be
+	// selected is reported by the reference operations.
+	if cfg, err := s.ConfigStorage.Config(); err == nil {
+		s.dir.SetObjectFormat(cfg.Extensions.ObjectFormat)
+		s.ReferenceStorage.err = s.ReferenceStorage.setRefStorage(cfg)
+	}
+
+	return s
+}
+
+// SetConfig stores the config, selecting the reference storage of
+// extensions.refStorage and the object format of extensions.objectFormat.
+// The references are migrated to the reftable stack when it's enabled on a
+// repository without one.
+func (s *Storage) SetConfig(cfg *config.Config) error {
+	// The references are migrated before the config is written, and the
+	// ones of the files backend removed after, so the repository is left
+	// on the files backend if anything fails before the config is written.
+	migrated, err := s.ReferenceStorage.migrateRefStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ConfigStorage.SetConfig(cfg); err != nil {
+		if migrated {
+			err = errors.Join(err, s.ReferenceStorage.removeReftable())
+		}
+
+		return err
+	}
+
+	s.dir.SetObjectFormat(cfg.Extensions.ObjectFormat)
+
+	if err := s.ReferenceStorage.setRefStorage(cfg); err != nil {
+		return err
+	}
+
+	if migrated {
+		if err := s.ReferenceStorage.removeFilesRefs(); err != nil {
+			return err
+		}
+	}
+
+	s.ReferenceStorage.err = nil
+	return nil
 }
 
 // Filesystem returns the underlying filesystem
@@ -0,0 +1,582 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+var (
+	// ErrMalformedFile is returned by OpenFileKV when the file isn't a
+	// FileKV file or is corrupted.
+	ErrMalformedFile = errors.New("malformed kv file")
+	// ErrUnsupportedFileVersion is returned by OpenFileKV when the version
+	// of the file isn't supported.
+	ErrUnsupportedFileVersion = errors.New("unsupported kv file version")
+	// ErrFrameTooLarge is returned when the operations of a batch don't fit
+	// in a frame, whose length is stored on 4 bytes.
+	ErrFrameTooLarge = errors.New("kv frame too large")
+)
+
+var fileSignature = []byte{'G', 'K', 'V', 'S'}
+
+const (
+	fileVersion    uint32 = 1
+	fileHeaderSize        = 8
+	// frameOverhead is the size of the length and of the checksum of a
+	// frame.
+	frameOverhead = 8
+)
+
+// FileKV is a KV stored in a single append-only file, suited to the small
+// repositories and to the tests. The keys are kept in memory along with the
+// position of their values in the file, read when needed.
+//
+// The file starts with the 4 bytes signature "GKVS" and a version, 1, in
+// network byte order. Then each batch, or single Put or Delete, is appended
+// as a frame: the length of its operations in network byte order, the
+// operations, and their CRC-32 checksum. Each operation is its type, the
+// length of its key as a varint and its key, followed for the puts by the
+// length of the value as a varint and the value. An incomplete frame at the
+// end of the file, left by an interrupted write, is dropped when the file is
+// opened.
+//
+// The values replaced or deleted stay in the file until it's compacted with
+// Compact.
+type FileKV struct {
+	fs   billy.Filesystem
+	name string
+
+	mu     sync.RWMutex
+	f      billy.File
+	size   int64
+	values map[string]fileValue
+}
+
+// fileValue is the position of a value in the file.
+type fileValue struct {
+	offset int64
+	size   int
+}
+
+// OpenFileKV opens the FileKV stored in the file name of fs, creating it if
+// it doesn't exist. The file is locked until the FileKV is closed.
+func OpenFileKV(fs billy.Filesystem, name string) (*FileKV, error) {
+	m := &FileKV{fs: fs, name: name}
+	if err := m.open(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *FileKV) open() (err error) {
+	f, err := m.fs.OpenFile(m.name, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close() //nolint:errcheck
+		}
+	}()
+
+	if err := f.Lock(); err != nil {
+		return err
+	}
+
+	m.f = f
+	m.values = make(map[string]fileValue)
+	return m.load()
+}
+
+// load reads the values of the file, writing its header if it's empty.
+func (m *FileKV) load() error {
+	end, err := m.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(m.f)
+	header := make([]byte, fileHeaderSize)
+	n, err := io.ReadFull(r, header)
+	switch {
+	case n == 0 && errors.Is(err, io.EOF):
+		if err := m.writeHeader(); err != nil {
+			return err
+		}
+
+		return m.sync()
+	case err != nil:
+		return fmt.Errorf("%w: %w", ErrMalformedFile, err)
+	case !bytes.Equal(header[:4], fileSignature):
+		return fmt.Errorf("%w: bad signature", ErrMalformedFile)
+	case binary.BigEndian.Uint32(header[4:]) != fileVersion:
+		return ErrUnsupportedFileVersion
+	}
+
+	m.size = fileHeaderSize
+	for {
+		ops, size, err := m.readFrame(r, end-m.size)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The last write was interrupted.
+			return m.f.Truncate(m.size)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		m.apply(ops, m.size+4)
+		m.size += size
+	}
+}
+
+func (m *FileKV) writeHeader() error {
+	header := make([]byte, fileHeaderSize)
+	copy(header, fileSignature)
+	binary.BigEndian.PutUint32(header[4:], fileVersion)
+	if _, err := m.f.Write(header); err != nil {
+		return err
+	}
+
+	m.size = fileHeaderSize
+	return nil
+}
+
+// readFrame reads a frame, returning its operations and its size, with
+// remaining bytes left in the file.
+func (m *FileKV) readFrame(r *bufio.Reader, remaining int64) ([]Op, int64, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, 0, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(head[:]))
+	if n+frameOverhead > remaining {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := make([]byte, n+4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, 0, err
+	}
+
+	payload, sum := payload[:len(payload)-4], payload[len(payload)-4:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(sum) {
+		return nil, 0, fmt.Errorf("%w: bad checksum at offset %d", ErrMalformedFile, m.size)
+	}
+
+	ops, err := decodeOps(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ops, int64(len(payload) + frameOverhead), nil
+}
+
+func decodeOps(b []byte) ([]Op, error) {
+	var ops []Op
+	for len(b) > 0 {
+		op := Op{Type: OpType(b[0])}
+		b = b[1:]
+
+		var err error
+		if op.Key, b, err = decodeBytes(b); err != nil {
+			return nil, err
+		}
+
+		switch op.Type {
+		case PutOp:
+			if op.Value, b, err = decodeBytes(b); err != nil {
+				return nil, err
+			}
+		case DeleteOp:
+		default:
+			return nil, fmt.Errorf("%w: unknown operation %d", ErrMalformedFile, op.Type)
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+func decodeBytes(b []byte) (v, rest []byte, err error) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || uint64(len(b)-size) < n {
+		return nil, nil, fmt.Errorf("%w: truncated operation", ErrMalformedFile)
+	}
+
+	b = b[size:]
+	return b[:n:n], b[n:], nil
+}
+
+func encodeOps(ops []Op) []byte {
+	var b []byte
+	for _, op := range ops {
+		if op.Type == CheckOp {
+			continue
+		}
+
+		b = append(b, byte(op.Type))
+		b = binary.AppendUvarint(b, uint64(len(op.Key)))
+		b = append(b, op.Key...)
+		if op.Type == PutOp {
+			b = binary.AppendUvarint(b, uint64(len(op.Value)))
+			b = append(b, op.Value...)
+		}
+	}
+
+	return b
+}
+
+// apply records the operations of a frame whose payload starts at offset.
+func (m *FileKV) apply(ops []Op, offset int64) {
+	for _, op := range ops {
+		if op.Type == CheckOp {
+			continue
+		}
+
+		offset += 1 + int64(uvarintSize(len(op.Key))+len(op.Key))
+		switch op.Type {
+		case PutOp:
+			offset += int64(uvarintSize(len(op.Value)))
+			m.values[string(op.Key)] = fileValue{offset: offset, size: len(op.Value)}
+			offset += int64(len(op.Value))
+		case DeleteOp:
+			delete(m.values, string(op.Key))
+		}
+	}
+}
+
+func uvarintSize(n int) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], uint64(n))
+}
+
+// append appends the operations to the file as a frame, flushed to the
+// disk.
+func (m *FileKV) append(ops []Op) error {
+	return m.appendFrame(ops, true)
+}
+
+// appendFrame appends the operations to the file as a frame, flushing it to
+// the disk if sync is true.
+func (m *FileKV) appendFrame(ops []Op, sync bool) error {
+	payload := encodeOps(ops)
+	if len(payload) == 0 {
+		return nil
+	}
+
+	if uint64(len(payload)) > math.MaxUint32 {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 0, len(payload)+frameOverhead)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(payload))
+
+	if err := m.writeFrame(frame, sync); err != nil {
+		// The partial frame is removed, so it's not followed by the next
+		// ones.
+		m.f.Truncate(m.size) //nolint:errcheck
+		return err
+	}
+
+	m.apply(ops, m.size+4)
+	m.size += int64(len(frame))
+	return nil
+}
+
+func (m *FileKV) writeFrame(frame []byte, sync bool) error {
+	if _, err := m.f.Seek(m.size, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := m.f.Write(frame); err != nil {
+		return err
+	}
+
+	if sync {
+		return m.sync()
+	}
+
+	return nil
+}
+
+// sync flushes the file to the disk, if supported by the filesystem.
+func (m *FileKV) sync() error {
+	if s, ok := m.f.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+
+	return nil
+}
+
+func (m *FileKV) read(v fileValue) ([]byte, error) {
+	b := make([]byte, v.size)
+	if n, err := m.f.ReadAt(b, v.offset); n < len(b) {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Get honors the KV interface.
+func (m *FileKV) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.values[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return m.read(v)
+}
+
+// Put honors the KV interface.
+func (m *FileKV) Put(key, value []byte) error {
+	return m.Batch([]Op{Put(key, value)})
+}
+
+// Delete honors the KV interface.
+func (m *FileKV) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.values[string(key)]; !ok {
+		return nil
+	}
+
+	return m.append([]Op{Delete(key)})
+}
+
+// Iterate honors the KV interface. The keys iterated are the ones existing
+// when it's called, their values being read before fn is called, so they
+// aren't affected by the concurrent writes or compactions.
+func (m *FileKV) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	m.mu.RLock()
+	keys := m.keys(prefix)
+	values := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		v, err := m.read(m.values[k])
+		if err != nil {
+			m.mu.RUnlock()
+			return err
+		}
+
+		values[k] = v
+	}
+	m.mu.RUnlock()
+
+	return iterate(keys, func(k string) error {
+		return fn([]byte(k), values[k])
+	})
+}
+
+// IterateKeys honors the KeyIterator interface. The keys iterated are the
+// ones existing when it's called, none of the values being read.
+func (m *FileKV) IterateKeys(prefix []byte, fn func(key []byte) error) error {
+	m.mu.RLock()
+	keys := m.keys(prefix)
+	m.mu.RUnlock()
+
+	return iterate(keys, func(k string) error {
+		return fn([]byte(k))
+	})
+}
+
+// keys returns the sorted keys with the given prefix. m.mu must be held.
+func (m *FileKV) keys(prefix []byte) []string {
+	keys := make([]string, 0)
+	for k := range m.values {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// iterate calls fn for each of the keys until it returns an error, ErrStop
+// stopping the iteration without error.
+func iterate(keys []string, fn func(string) error) error {
+	for _, k := range keys {
+		if err := fn(k); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Batch honors the KV interface. The operations are appended to the file
+// in a single frame, so they are applied atomically even if the write is
+// interrupted.
+func (m *FileKV) Batch(ops []Op) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rerr error
+	err := checkOps(ops, func(key []byte) ([]byte, bool) {
+		v, ok := m.values[string(key)]
+		if !ok {
+			return nil, false
+		}
+
+		b, err := m.read(v)
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+
+		return b, true
+	})
+	if rerr != nil {
+		return rerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return m.append(ops)
+}
+
+// Compact rewrites the file with only the current values, dropping the ones
+// replaced or deleted. The original file is kept if it fails.
+func (m *FileKV) Compact() (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	tmp, err := m.fs.TempFile(filepath.Dir(m.name), "tmp_kv_")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = m.fs.Remove(tmpName)
+		}
+	}()
+
+	if err := m.writeCompacted(tmp, keys); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := m.replace(tmpName); err != nil {
+		return errors.Join(err, m.open())
+	}
+
+	return nil
+}
+
+// writeCompacted writes the values of the given keys to f, which is flushed
+// to the disk once, after the last one.
+func (m *FileKV) writeCompacted(f billy.File, keys []string) error {
+	compacted := &FileKV{f: f, values: make(map[string]fileValue)}
+	if err := compacted.writeHeader(); err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		v, err := m.read(m.values[k])
+		if err != nil {
+			return err
+		}
+
+		if err := compacted.appendFrame([]Op{Put([]byte(k), v)}, false); err != nil {
+			return err
+		}
+	}
+
+	return compacted.sync()
+}
+
+// replace replaces the file with the one named tmpName, and opens it. The
+// original file is restored, closed, if it fails.
+func (m *FileKV) replace(tmpName string) (err error) {
+	if err := m.close(); err != nil {
+		return err
+	}
+
+	old := tmpName + "_old"
+	if err := m.fs.Rename(m.name, old); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, m.fs.Rename(old, m.name))
+		}
+	}()
+
+	if err := m.fs.Rename(tmpName, m.name); err != nil {
+		return err
+	}
+
+	if err := m.open(); err != nil {
+		return err
+	}
+
+	_ = m.fs.Remove(old)
+	return nil
+}
+
+// Close closes the file, unlocking it.
+func (m *FileKV) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.close()
+}
+
+func (m *FileKV) close() (err error) {
+	defer ioutil.CheckClose(m.f, &err)
+	return m.f.Unlock()
+}
@@ -0,0 +1,111 @@
+// Package kv implements a storage on top of a key-value store, so the
+// repositories can be kept in any database providing the few operations of
+// the KV interface.
+package kv
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned by KV.Get when the key doesn't exist.
+	ErrNotFound = errors.New("key not found")
+	// ErrConflict is returned by KV.Batch when one of its checks fails.
+	ErrConflict = errors.New("batch check failed")
+	// ErrStop stops KV.Iterate without error when returned by its callback.
+	ErrStop = errors.New("stop iteration")
+)
+
+// KV is a key-value store. The keys are compared as bytes, and the values
+// passed to and returned by a KV must not be modified afterwards.
+// Implementations must be safe for concurrent use.
+type KV interface {
+	// Get returns the value of key, or ErrNotFound if it doesn't exist.
+	Get(key []byte) ([]byte, error)
+	// Put sets the value of key.
+	Put(key, value []byte) error
+	// Delete deletes key, if it exists.
+	Delete(key []byte) error
+	// Iterate calls fn for each key with the given prefix, in the key order,
+	// until it returns an error. ErrStop stops the iteration without error.
+	// The KV must not be changed by fn.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+	// Batch applies all the operations atomically, or none of them if one of
+	// the checks fails, returning ErrConflict.
+	Batch(ops []Op) error
+}
+
+// KeyIterator is implemented by the KVs able to iterate over the keys without
+// reading their values, used instead of KV.Iterate when only the keys are
+// needed.
+type KeyIterator interface {
+	// IterateKeys calls fn for each key with the given prefix, as
+	// KV.Iterate does.
+	IterateKeys(prefix []byte, fn func(key []byte) error) error
+}
+
+// iterateKeys calls fn for each key of kv with the given prefix, without
+// reading the values if kv is a KeyIterator.
+func iterateKeys(kv KV, prefix []byte, fn func(key []byte) error) error {
+	if ki, ok := kv.(KeyIterator); ok {
+		return ki.IterateKeys(prefix, fn)
+	}
+
+	return kv.Iterate(prefix, func(key, _ []byte) error {
+		return fn(key)
+	})
+}
+
+// OpType is the type of an operation of a batch.
+type OpType int8
+
+const (
+	// PutOp sets the value of the key.
+	PutOp OpType = iota
+	// DeleteOp deletes the key.
+	DeleteOp
+	// CheckOp checks that the key has the given value, or that it doesn't
+	// exist if the value is nil, failing the whole batch otherwise.
+	CheckOp
+)
+
+// Op is an operation of a batch.
+type Op struct {
+	Type  OpType
+	Key   []byte
+	Value []byte
+}
+
+// Put returns an operation setting the value of key.
+func Put(key, value []byte) Op {
+	return Op{Type: PutOp, Key: key, Value: value}
+}
+
+// Delete returns an operation deleting key.
+func Delete(key []byte) Op {
+	return Op{Type: DeleteOp, Key: key}
+}
+
+// Check returns an operation checking that key has the given value, or that
+// it doesn't exist if value is nil.
+func Check(key, value []byte) Op {
+	return Op{Type: CheckOp, Key: key, Value: value}
+}
+
+// checkOps returns ErrConflict if one of the checks of ops fails, get
+// returning the current values of the keys.
+func checkOps(ops []Op, get func(key []byte) ([]byte, bool)) error {
+	for _, op := range ops {
+		if op.Type != CheckOp {
+			continue
+		}
+
+		v, ok := get(op.Key)
+		if ok != (op.Value != nil) || !bytes.Equal(v, op.Value) {
+			return ErrConflict
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,498 @@
+package kv_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/kv"
+	"github.com/stretchr/testify/require"
+)
+
+func openFileKV(t *testing.T, fs billy.Filesystem) *kv.FileKV {
+	f, err := kv.OpenFileKV(fs, "repository.kv")
+	require.NoError(t, err)
+	return f
+}
+
+func testKV(t *testing.T, m kv.KV) {
+	_, err := m.Get([]byte("foo"))
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, m.Put([]byte("foo"), []byte("1")))
+	require.NoError(t, m.Put([]byte("foo/b"), []byte("2")))
+	require.NoError(t, m.Put([]byte("foo/a"), []byte("3")))
+	require.NoError(t, m.Put([]byte("bar"), []byte{}))
+
+	v, err := m.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+
+	v, err = m.Get([]byte("bar"))
+	require.NoError(t, err)
+	require.Empty(t, v)
+
+	var keys []string
+	require.NoError(t, m.Iterate([]byte("foo/"), func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	require.Equal(t, []string{"foo/a", "foo/b"}, keys)
+
+	keys = nil
+	require.NoError(t, m.Iterate(nil, func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return kv.ErrStop
+	}))
+	require.Equal(t, []string{"bar"}, keys)
+
+	err = m.Batch([]kv.Op{
+		kv.Check([]byte("foo"), []byte("2")),
+		kv.Put([]byte("foo"), []byte("4")),
+	})
+	require.ErrorIs(t, err, kv.ErrConflict)
+
+	err = m.Batch([]kv.Op{
+		kv.Check([]byte("missing"), []byte("1")),
+		kv.Delete([]byte("foo")),
+	})
+	require.ErrorIs(t, err, kv.ErrConflict)
+
+	v, err = m.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+
+	require.NoError(t, m.Batch([]kv.Op{
+		kv.Check([]byte("foo"), []byte("1")),
+		kv.Check([]byte("missing"), nil),
+		kv.Put([]byte("foo"), []byte("4")),
+		kv.Delete([]byte("foo/a")),
+	}))
+
+	v, err = m.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("4"), v)
+
+	_, err = m.Get([]byte("foo/a"))
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, m.Delete([]byte("foo/b")))
+	require.NoError(t, m.Delete([]byte("foo/b")))
+	_, err = m.Get([]byte("foo/b"))
+	require.ErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestMemoryKV(t *testing.T) {
+	t.Parallel()
+
+	testKV(t, kv.NewMemoryKV())
+}
+
+func TestFileKV(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	f := openFileKV(t, fs)
+	testKV(t, f)
+	require.NoError(t, f.Close())
+
+	// The values are read back when the file is opened again.
+	f = openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	v, err := f.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("4"), v)
+
+	var keys []string
+	require.NoError(t, f.Iterate(nil, func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	require.Equal(t, []string{"bar", "foo"}, keys)
+}
+
+func TestFileKVCompact(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	f := openFileKV(t, fs)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, f.Put([]byte("foo"), []byte{byte(i)}))
+	}
+
+	require.NoError(t, f.Put([]byte("bar"), []byte("bar")))
+	require.NoError(t, f.Delete([]byte("bar")))
+
+	before, err := fs.Stat("repository.kv")
+	require.NoError(t, err)
+
+	require.NoError(t, f.Compact())
+
+	after, err := fs.Stat("repository.kv")
+	require.NoError(t, err)
+	require.Less(t, after.Size(), before.Size())
+
+	v, err := f.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{9}, v)
+
+	_, err = f.Get([]byte("bar"))
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, f.Put([]byte("bar"), []byte("bar")))
+	require.NoError(t, f.Close())
+
+	f = openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	v, err = f.Get([]byte("bar"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), v)
+}
+
+func TestFileKVIterateCompact(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	f := openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, f.Put([]byte(k), []byte("old "+k)))
+		require.NoError(t, f.Put([]byte(k), []byte("value "+k)))
+	}
+
+	// The values moved by a compaction during the iteration are the ones
+	// existing when it started.
+	values := make(map[string]string)
+	require.NoError(t, f.Iterate(nil, func(key, value []byte) error {
+		if len(values) == 0 {
+			require.NoError(t, f.Compact())
+		}
+
+		values[string(key)] = string(value)
+		return nil
+	}))
+	require.Equal(t, map[string]string{"a": "value a", "b": "value b", "c": "value c"}, values)
+}
+
+// renameFailFS is a filesystem failing the next rename of a file to name.
+type renameFailFS struct {
+	billy.Filesystem
+	name string
+}
+
+func (fs *renameFailFS) Rename(from, to string) error {
+	if to == fs.name {
+		fs.name = ""
+		return errors.New("rename failed")
+	}
+
+	return fs.Filesystem.Rename(from, to)
+}
+
+func TestFileKVCompactFailure(t *testing.T) {
+	t.Parallel()
+
+	fs := &renameFailFS{Filesystem: memfs.New()}
+	f := openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	require.NoError(t, f.Put([]byte("foo"), []byte("1")))
+	require.NoError(t, f.Put([]byte("foo"), []byte("2")))
+
+	fs.name = "repository.kv"
+	require.ErrorContains(t, f.Compact(), "rename failed")
+
+	// The original file is still in use.
+	v, err := f.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), v)
+
+	require.NoError(t, f.Put([]byte("bar"), []byte("bar")))
+	require.NoError(t, f.Close())
+
+	files, err := fs.ReadDir("")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	f = openFileKV(t, fs)
+	v, err = f.Get([]byte("bar"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), v)
+}
+
+func TestFileKVInterruptedWrite(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	f := openFileKV(t, fs)
+	require.NoError(t, f.Put([]byte("foo"), []byte("foo")))
+	require.NoError(t, f.Close())
+
+	info, err := fs.Stat("repository.kv")
+	require.NoError(t, err)
+
+	// A frame whose write was interrupted after its length.
+	file, err := fs.OpenFile("repository.kv", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 42, 0})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	f = openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	truncated, err := fs.Stat("repository.kv")
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), truncated.Size())
+
+	v, err := f.Get([]byte("foo"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), v)
+
+	require.NoError(t, f.Put([]byte("bar"), []byte("bar")))
+	v, err = f.Get([]byte("bar"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), v)
+}
+
+// writeFailFS is a filesystem whose files fail their writes, after writing
+// half of them, when fail is set.
+type writeFailFS struct {
+	billy.Filesystem
+	fail bool
+}
+
+func (fs *writeFailFS) OpenFile(name string, flag int, perm os.FileMode) (billy.File, error) {
+	f, err := fs.Filesystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writeFailFile{File: f, fs: fs}, nil
+}
+
+type writeFailFile struct {
+	billy.File
+	fs *writeFailFS
+}
+
+func (f *writeFailFile) Write(p []byte) (int, error) {
+	if !f.fs.fail {
+		return f.File.Write(p)
+	}
+
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, errors.New("write failed")
+}
+
+func TestFileKVFailedWrite(t *testing.T) {
+	t.Parallel()
+
+	fs := &writeFailFS{Filesystem: memfs.New()}
+	f := openFileKV(t, fs)
+	require.NoError(t, f.Put([]byte("foo"), []byte("foo")))
+
+	info, err := fs.Stat("repository.kv")
+	require.NoError(t, err)
+
+	fs.fail = true
+	require.ErrorContains(t, f.Put([]byte("bar"), []byte("a longer value than the next one")), "write failed")
+	fs.fail = false
+
+	// The partial frame was removed.
+	truncated, err := fs.Stat("repository.kv")
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), truncated.Size())
+
+	require.NoError(t, f.Put([]byte("baz"), []byte("baz")))
+	require.NoError(t, f.Close())
+
+	f = openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	var keys []string
+	require.NoError(t, f.Iterate(nil, func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	require.Equal(t, []string{"baz", "foo"}, keys)
+}
+
+func TestFileKVMalformed(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	f := openFileKV(t, fs)
+	require.NoError(t, f.Put([]byte("foo"), []byte("foo")))
+	require.NoError(t, f.Put([]byte("bar"), []byte("bar")))
+	require.NoError(t, f.Close())
+
+	file, err := fs.OpenFile("repository.kv", os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("x"), 16)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	_, err = kv.OpenFileKV(fs, "repository.kv")
+	require.ErrorIs(t, err, kv.ErrMalformedFile)
+
+	require.NoError(t, writeFile(fs, "other.kv", []byte("not a kv file")))
+	_, err = kv.OpenFileKV(fs, "other.kv")
+	require.ErrorIs(t, err, kv.ErrMalformedFile)
+}
+
+func writeFile(fs billy.Filesystem, name string, data []byte) error {
+	f, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+
+	return f.Close()
+}
+
+func TestStorageCheckAndSetReferenceMissing(t *testing.T) {
+	t.Parallel()
+
+	s := kv.NewStorage(kv.NewMemoryKV())
+	ref := plumbing.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	err := s.CheckAndSetReference(ref, ref)
+	require.ErrorIs(t, err, storage.ErrReferenceHasChanged)
+
+	_, err = s.Reference(ref.Name())
+	require.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestStorageModule(t *testing.T) {
+	t.Parallel()
+
+	m := kv.NewMemoryKV()
+	s := kv.NewStorage(m)
+
+	sub, err := s.Module("foo")
+	require.NoError(t, err)
+	nested, err := s.Module("foo/refs")
+	require.NoError(t, err)
+
+	ref := plumbing.NewReferenceFromStrings("refs/heads/foo", "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+	require.NoError(t, sub.SetReference(ref))
+	require.NoError(t, nested.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, ref.Name())))
+
+	for _, sto := range []storage.Storer{s, nested} {
+		_, err = sto.Reference(ref.Name())
+		require.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+	}
+
+	iter, err := sub.IterReferences()
+	require.NoError(t, err)
+
+	var refs []*plumbing.Reference
+	require.NoError(t, iter.ForEach(func(r *plumbing.Reference) error {
+		refs = append(refs, r)
+		return nil
+	}))
+	require.Equal(t, []*plumbing.Reference{ref}, refs)
+
+	// The submodule is kept in the KV.
+	sub, err = kv.NewStorage(m).Module("foo")
+	require.NoError(t, err)
+	r, err := sub.Reference(ref.Name())
+	require.NoError(t, err)
+	require.Equal(t, ref, r)
+}
+
+func TestStoragePackfile(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	f := openFileKV(t, fs)
+
+	fixture := fixtures.Basic().One()
+	require.NoError(t, packfile.UpdateObjectStorage(kv.NewStorage(f), fixture.Packfile()))
+	require.NoError(t, f.Close())
+
+	f = openFileKV(t, fs)
+	defer f.Close() //nolint:errcheck
+
+	s := kv.NewStorage(f)
+	c, err := object.GetCommit(s, plumbing.NewHash(fixture.Head))
+	require.NoError(t, err)
+
+	var commits int
+	require.NoError(t, object.NewCommitPreorderIter(c, nil, nil).ForEach(func(*object.Commit) error {
+		commits++
+		return nil
+	}))
+	require.Equal(t, 8, commits)
+
+	size, err := s.EncodedObjectSize(c.TreeHash)
+	require.NoError(t, err)
+	require.Positive(t, size)
+}
+
+// keysOnlyKV is a FileKV failing the iterations reading the values.
+type keysOnlyKV struct {
+	*kv.FileKV
+}
+
+func (*keysOnlyKV) Iterate([]byte, func(key, value []byte) error) error {
+	return errors.New("values read")
+}
+
+func TestStorageIterateKeys(t *testing.T) {
+	t.Parallel()
+
+	f := openFileKV(t, memfs.New())
+	defer f.Close() //nolint:errcheck
+
+	fixture := fixtures.Basic().One()
+	require.NoError(t, packfile.UpdateObjectStorage(kv.NewStorage(f), fixture.Packfile()))
+
+	s := kv.NewStorage(&keysOnlyKV{f})
+	ref := plumbing.NewReferenceFromStrings("refs/heads/master", fixture.Head)
+	require.NoError(t, s.SetReference(ref))
+
+	count, err := s.CountLooseRefs()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	var objects int
+	require.NoError(t, s.ForEachObjectHash(func(plumbing.Hash) error {
+		objects++
+		return nil
+	}))
+	require.Equal(t, 31, objects)
+
+	var stopped int
+	require.NoError(t, s.ForEachObjectHash(func(plumbing.Hash) error {
+		stopped++
+		return storer.ErrStop
+	}))
+	require.Equal(t, 1, stopped)
+
+	iter, err := s.IterEncodedObjects(plumbing.CommitObject)
+	require.NoError(t, err)
+
+	var commits int
+	require.NoError(t, iter.ForEach(func(o plumbing.EncodedObject) error {
+		require.Equal(t, plumbing.CommitObject, o.Type())
+		commits++
+		return nil
+	}))
+	require.Equal(t, 9, commits)
+}
@@ -0,0 +1,107 @@
+package kv
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryKV is a KV keeping the values in memory, being ephemeral. It's the
+// reference implementation of KV.
+type MemoryKV struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryKV returns a new empty MemoryKV.
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{values: make(map[string][]byte)}
+}
+
+// Get honors the KV interface.
+func (m *MemoryKV) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.values[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return v, nil
+}
+
+// Put honors the KV interface.
+func (m *MemoryKV) Put(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[string(key)] = value
+	return nil
+}
+
+// Delete honors the KV interface.
+func (m *MemoryKV) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.values, string(key))
+	return nil
+}
+
+// Iterate honors the KV interface. The keys iterated are the ones existing
+// when it's called.
+func (m *MemoryKV) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	m.mu.RLock()
+	keys := make([]string, 0)
+	for k := range m.values {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+
+	values := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		values[k] = m.values[k]
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), values[k]); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Batch honors the KV interface.
+func (m *MemoryKV) Batch(ops []Op) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := checkOps(ops, func(key []byte) ([]byte, bool) {
+		v, ok := m.values[string(key)]
+		return v, ok
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		switch op.Type {
+		case PutOp:
+			m.values[string(op.Key)] = op.Value
+		case DeleteOp:
+			delete(m.values, string(op.Key))
+		}
+	}
+
+	return nil
+}
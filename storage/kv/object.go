@@ -0,0 +1,343 @@
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+var (
+	// ErrUnsupportedObjectType is returned when storing a delta object.
+	ErrUnsupportedObjectType = errors.New("unsupported object type")
+	// ErrLooseObjectTimeNotSupported is returned by LooseObjectTime, the
+	// time of the objects not being stored.
+	ErrLooseObjectTimeNotSupported = errors.New("loose object time not supported")
+)
+
+func (s *Storage) objectKey(h plumbing.Hash) []byte {
+	return s.key(objectsPrefix + h.String())
+}
+
+// NewEncodedObject returns a new plumbing.MemoryObject of the object format
+// of the repository.
+func (s *Storage) NewEncodedObject() plumbing.EncodedObject {
+	return plumbing.NewMemoryObject(s.objectFormat)
+}
+
+// ObjectFormat honors the storer.ObjectFormatStorer interface.
+func (s *Storage) ObjectFormat() format.ObjectFormat {
+	return s.objectFormat
+}
+
+// RawObjectWriter returns a writer of an object stored when it's closed.
+func (s *Storage) RawObjectWriter(typ plumbing.ObjectType, sz int64) (io.WriteCloser, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(typ)
+	obj.SetSize(sz)
+
+	w, err := obj.Writer()
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NewWriteCloser(w, closerFunc(func() error {
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		_, err := s.SetEncodedObject(obj)
+		return err
+	})), nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// SetEncodedObject stores the object.
+func (s *Storage) SetEncodedObject(o plumbing.EncodedObject) (plumbing.Hash, error) {
+	v, err := encodeObject(o)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h := o.Hash()
+	return h, s.kv.Put(s.objectKey(h), v)
+}
+
+// encodeObject returns the value of the object o, its header followed by its
+// content as in a loose object.
+func encodeObject(o plumbing.EncodedObject) (v []byte, err error) {
+	switch o.Type() {
+	case plumbing.CommitObject, plumbing.TreeObject, plumbing.BlobObject, plumbing.TagObject:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedObjectType, o.Type())
+	}
+
+	r, err := o.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	buf := bytes.NewBuffer(make([]byte, 0, o.Size()+32))
+	buf.Write(o.Type().Bytes())
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(o.Size(), 10))
+	buf.WriteByte(0)
+	if _, err := io.Copy(buf, r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// objectHeader returns the type and the size of the object of the value v,
+// along with its content.
+func objectHeader(v []byte) (plumbing.ObjectType, int64, []byte, error) {
+	header, content, ok := bytes.Cut(v, []byte{0})
+	if !ok {
+		return plumbing.InvalidObject, 0, nil, fmt.Errorf("%w: missing object header", ErrMalformedValue)
+	}
+
+	typ, size, ok := bytes.Cut(header, []byte{' '})
+	if !ok {
+		return plumbing.InvalidObject, 0, nil, fmt.Errorf("%w: object header %q", ErrMalformedValue, header)
+	}
+
+	t, err := plumbing.ParseObjectType(string(typ))
+	if err != nil {
+		return plumbing.InvalidObject, 0, nil, err
+	}
+
+	sz, err := strconv.ParseInt(string(size), 10, 64)
+	if err != nil || sz != int64(len(content)) {
+		return plumbing.InvalidObject, 0, nil, fmt.Errorf("%w: object header %q", ErrMalformedValue, header)
+	}
+
+	return t, sz, content, nil
+}
+
+func (s *Storage) decodeObject(h plumbing.Hash, v []byte) (plumbing.EncodedObject, error) {
+	t, size, content, err := objectHeader(v)
+	if err != nil {
+		return nil, err
+	}
+
+	o := plumbing.NewMemoryObject(s.objectFormat)
+	o.SetType(t)
+	o.SetSize(size)
+	if len(content) > 0 {
+		if _, err := o.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Hash() != h {
+		return nil, fmt.Errorf("%w: object %s has a different ID", ErrMalformedValue, h)
+	}
+
+	return o, nil
+}
+
+// EncodedObject returns the object h, if it's of type t.
+func (s *Storage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	v, err := s.get(objectsPrefix + h.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	o, err := s.decodeObject(h, v)
+	if err != nil {
+		return nil, err
+	}
+
+	if t != plumbing.AnyObject && o.Type() != t {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return o, nil
+}
+
+// HasEncodedObject returns plumbing.ErrObjectNotFound if the object h isn't
+// stored.
+func (s *Storage) HasEncodedObject(h plumbing.Hash) error {
+	v, err := s.get(objectsPrefix + h.String())
+	if err == nil && v == nil {
+		err = plumbing.ErrObjectNotFound
+	}
+
+	return err
+}
+
+// EncodedObjectSize returns the size of the object h.
+func (s *Storage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	v, err := s.get(objectsPrefix + h.String())
+	if err != nil {
+		return 0, err
+	}
+
+	if v == nil {
+		return 0, plumbing.ErrObjectNotFound
+	}
+
+	_, size, _, err := objectHeader(v)
+	return size, err
+}
+
+// IterEncodedObjects returns an iterator of the objects of type t, read when
+// they are iterated.
+func (s *Storage) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	var hashes []plumbing.Hash
+	err := s.forEachObjectHash(func(h plumbing.Hash) error {
+		hashes = append(hashes, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if t == plumbing.AnyObject {
+		return storer.NewEncodedObjectLookupIter(s, t, hashes), nil
+	}
+
+	return &typedObjectIter{s: s, t: t, hashes: hashes}, nil
+}
+
+// typedObjectIter iterates over the objects of type t among hashes, the
+// type of each object being known only once it's read.
+type typedObjectIter struct {
+	s      *Storage
+	t      plumbing.ObjectType
+	hashes []plumbing.Hash
+}
+
+// Next returns the next object of type t, skipping the other objects.
+func (it *typedObjectIter) Next() (plumbing.EncodedObject, error) {
+	for len(it.hashes) > 0 {
+		o, err := it.s.EncodedObject(plumbing.AnyObject, it.hashes[0])
+		if err != nil {
+			return nil, err
+		}
+
+		it.hashes = it.hashes[1:]
+		if o.Type() == it.t {
+			return o, nil
+		}
+	}
+
+	return nil, io.EOF
+}
+
+// ForEach calls cb for each of the remaining objects of type t.
+func (it *typedObjectIter) ForEach(cb func(plumbing.EncodedObject) error) error {
+	return storer.ForEachIterator(it, cb)
+}
+
+// Close releases the remaining hashes.
+func (it *typedObjectIter) Close() {
+	it.hashes = nil
+}
+
+func (s *Storage) forEachObjectHash(fn func(plumbing.Hash) error) error {
+	prefix := s.key(objectsPrefix)
+	return iterateKeys(s.kv, prefix, func(key []byte) error {
+		h, ok := plumbing.FromHex(string(key[len(prefix):]))
+		if !ok {
+			return fmt.Errorf("%w: object key %q", ErrMalformedValue, key)
+		}
+
+		return fn(h)
+	})
+}
+
+// ForEachObjectHash honors the storer.LooseObjectStorer interface, all the
+// objects being loose.
+func (s *Storage) ForEachObjectHash(fn func(plumbing.Hash) error) error {
+	err := s.forEachObjectHash(fn)
+	if errors.Is(err, storer.ErrStop) {
+		return nil
+	}
+
+	return err
+}
+
+// LooseObjectTime honors the storer.LooseObjectStorer interface.
+func (s *Storage) LooseObjectTime(plumbing.Hash) (time.Time, error) {
+	return time.Time{}, ErrLooseObjectTimeNotSupported
+}
+
+// DeleteLooseObject honors the storer.LooseObjectStorer interface.
+func (s *Storage) DeleteLooseObject(h plumbing.Hash) error {
+	return s.kv.Delete(s.objectKey(h))
+}
+
+// AddAlternate returns ErrAlternatesNotSupported.
+func (s *Storage) AddAlternate(string) error {
+	return ErrAlternatesNotSupported
+}
+
+// Begin honors the storer.Transactioner interface. The objects of the
+// transaction are stored in a single KV batch when it's committed.
+func (s *Storage) Begin() storer.Transaction {
+	return &transaction{s: s, objects: make(map[plumbing.Hash]plumbing.EncodedObject)}
+}
+
+type transaction struct {
+	s       *Storage
+	objects map[plumbing.Hash]plumbing.EncodedObject
+}
+
+func (tx *transaction) SetEncodedObject(o plumbing.EncodedObject) (plumbing.Hash, error) {
+	h := o.Hash()
+	tx.objects[h] = o
+	return h, nil
+}
+
+func (tx *transaction) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	o, ok := tx.objects[h]
+	if !ok || (t != plumbing.AnyObject && o.Type() != t) {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return o, nil
+}
+
+func (tx *transaction) Commit() error {
+	ops := make([]Op, 0, len(tx.objects))
+	for h, o := range tx.objects {
+		v, err := encodeObject(o)
+		if err != nil {
+			return err
+		}
+
+		ops = append(ops, Put(tx.s.objectKey(h), v))
+	}
+
+	if err := tx.s.kv.Batch(ops); err != nil {
+		return err
+	}
+
+	tx.objects = make(map[plumbing.Hash]plumbing.EncodedObject)
+	return nil
+}
+
+func (tx *transaction) Rollback() error {
+	tx.objects = make(map[plumbing.Hash]plumbing.EncodedObject)
+	return nil
+}
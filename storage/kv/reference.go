@@ -0,0 +1,124 @@
+package kv
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+func (s *Storage) refKey(n plumbing.ReferenceName) []byte {
+	return s.key(refsPrefix + n.String())
+}
+
+// encodeReference returns the value of the reference ref, the content of
+// its loose reference file.
+func encodeReference(ref *plumbing.Reference) []byte {
+	return []byte(ref.Strings()[1] + "\n")
+}
+
+func decodeReference(n plumbing.ReferenceName, v []byte) *plumbing.Reference {
+	if len(v) > 0 && v[len(v)-1] == '\n' {
+		v = v[:len(v)-1]
+	}
+
+	return plumbing.NewReferenceFromStrings(n.String(), string(v))
+}
+
+// SetReference stores the reference ref.
+func (s *Storage) SetReference(ref *plumbing.Reference) error {
+	if ref == nil {
+		return nil
+	}
+
+	return s.kv.Put(s.refKey(ref.Name()), encodeReference(ref))
+}
+
+// CheckAndSetReference stores the reference ref if old is nil, or if the
+// reference old.Name() exists and has the hash of old, returning
+// storage.ErrReferenceHasChanged otherwise. The check and the update are
+// done in a single KV batch.
+func (s *Storage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	if ref == nil {
+		return nil
+	}
+
+	if old == nil {
+		return s.SetReference(ref)
+	}
+
+	key := s.refKey(old.Name())
+	v, err := s.kv.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return storage.ErrReferenceHasChanged
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if decodeReference(old.Name(), v).Hash() != old.Hash() {
+		return storage.ErrReferenceHasChanged
+	}
+
+	err = s.kv.Batch([]Op{
+		Check(key, v),
+		Put(s.refKey(ref.Name()), encodeReference(ref)),
+	})
+	if errors.Is(err, ErrConflict) {
+		return storage.ErrReferenceHasChanged
+	}
+
+	return err
+}
+
+// Reference returns the reference n.
+func (s *Storage) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	v, err := s.get(refsPrefix + n.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if v == nil {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+
+	return decodeReference(n, v), nil
+}
+
+// IterReferences returns an iterator of the references, HEAD included.
+func (s *Storage) IterReferences() (storer.ReferenceIter, error) {
+	var refs []*plumbing.Reference
+	prefix := s.key(refsPrefix)
+	err := s.kv.Iterate(prefix, func(key, value []byte) error {
+		refs = append(refs, decodeReference(plumbing.ReferenceName(key[len(prefix):]), value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+// RemoveReference removes the reference n, if it exists.
+func (s *Storage) RemoveReference(n plumbing.ReferenceName) error {
+	return s.kv.Delete(s.refKey(n))
+}
+
+// CountLooseRefs returns the number of references, all of them being loose.
+func (s *Storage) CountLooseRefs() (int, error) {
+	var count int
+	err := iterateKeys(s.kv, s.key(refsPrefix), func([]byte) error {
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// PackRefs does nothing, the references not being packed.
+func (s *Storage) PackRefs() error {
+	return nil
+}
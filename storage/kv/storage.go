@@ -0,0 +1,192 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+var (
+	// ErrMalformedValue is returned when a value of the KV can't be decoded.
+	ErrMalformedValue = errors.New("malformed value")
+	// ErrAlternatesNotSupported is returned by AddAlternate, the objects
+	// being all stored in the KV.
+	ErrAlternatesNotSupported = errors.New("alternates not supported")
+)
+
+const (
+	configKey     = "config"
+	indexKey      = "index"
+	shallowKey    = "shallow"
+	objectsPrefix = "objects/"
+	refsPrefix    = "refs/"
+	modulesPrefix = "modules/"
+)
+
+// Storage is a storage.Storer keeping the repository in a KV:
+//
+//   - the config, the index and the shallow commits in the keys "config",
+//     "index" and "shallow", encoded as in their files of a .git directory,
+//   - the objects in the keys "objects/<id>", as the loose objects of a .git
+//     directory without the compression,
+//   - the references in the keys "refs/<name>", as the loose references of
+//     a .git directory, HEAD being "refs/HEAD",
+//   - the submodules in the keys prefixed by "modules/<name>/", with the name
+//     escaped so it doesn't contain any slash.
+//
+// The references are updated with the checks of a KV batch, so
+// CheckAndSetReference is safe for concurrent use by several storages on the
+// same KV.
+type Storage struct {
+	kv     KV
+	prefix string
+
+	objectFormat format.ObjectFormat
+}
+
+// NewStorage returns a new Storage of the repository stored in kv.
+func NewStorage(kv KV) *Storage {
+	return newStorage(kv, "")
+}
+
+func newStorage(kv KV, prefix string) *Storage {
+	s := &Storage{kv: kv, prefix: prefix}
+
+	// Like the filesystem storage, a config failing to load is reported when
+	// the repository reads it, the storage using SHA-1 meanwhile.
+	if cfg, err := s.Config(); err == nil {
+		s.objectFormat = cfg.Extensions.ObjectFormat
+	}
+
+	return s
+}
+
+// KV returns the underlying KV.
+func (s *Storage) KV() KV {
+	return s.kv
+}
+
+func (s *Storage) key(k string) []byte {
+	return []byte(s.prefix + k)
+}
+
+// get returns the value of the key k, or nil if it doesn't exist.
+func (s *Storage) get(k string) ([]byte, error) {
+	v, err := s.kv.Get(s.key(k))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	return v, err
+}
+
+// Config returns the config of the repository, or a new one if it has none.
+func (s *Storage) Config() (*config.Config, error) {
+	v, err := s.get(configKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.NewConfig()
+	if v == nil {
+		return cfg, nil
+	}
+
+	if err := cfg.Unmarshal(v); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// SetConfig stores the config, the new objects using the object format of
+// extensions.objectFormat.
+func (s *Storage) SetConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	b, err := cfg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := s.kv.Put(s.key(configKey), b); err != nil {
+		return err
+	}
+
+	s.objectFormat = cfg.Extensions.ObjectFormat
+	return nil
+}
+
+// Index returns the index of the repository, or an empty one if it has none.
+func (s *Storage) Index() (*index.Index, error) {
+	idx := &index.Index{Version: 2}
+	v, err := s.get(indexKey)
+	if err != nil || v == nil {
+		return idx, err
+	}
+
+	d := index.NewDecoder(bytes.NewReader(v), index.WithObjectFormat(s.objectFormat))
+	return idx, d.Decode(idx)
+}
+
+// SetIndex stores the index.
+func (s *Storage) SetIndex(idx *index.Index) error {
+	var buf bytes.Buffer
+	e := index.NewEncoder(&buf, index.WithObjectFormat(s.objectFormat))
+	if err := e.Encode(idx); err != nil {
+		return err
+	}
+
+	return s.kv.Put(s.key(indexKey), buf.Bytes())
+}
+
+// Shallow returns the shallow commits.
+func (s *Storage) Shallow() ([]plumbing.Hash, error) {
+	v, err := s.get(shallowKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	scanner := bufio.NewScanner(bytes.NewReader(v))
+	for scanner.Scan() {
+		h, ok := plumbing.FromHex(scanner.Text())
+		if !ok {
+			return nil, fmt.Errorf("%w: shallow commit %q", ErrMalformedValue, scanner.Text())
+		}
+
+		hashes = append(hashes, h)
+	}
+
+	return hashes, scanner.Err()
+}
+
+// SetShallow stores the shallow commits, one per line as in the shallow file
+// of a .git directory.
+func (s *Storage) SetShallow(commits []plumbing.Hash) error {
+	if len(commits) == 0 {
+		return s.kv.Delete(s.key(shallowKey))
+	}
+
+	var buf bytes.Buffer
+	for _, h := range commits {
+		fmt.Fprintf(&buf, "%s\n", h)
+	}
+
+	return s.kv.Put(s.key(shallowKey), buf.Bytes())
+}
+
+// Module returns the storage of the submodule name, stored in the same KV.
+func (s *Storage) Module(name string) (storage.Storer, error) {
+	return newStorage(s.kv, s.prefix+modulesPrefix+url.PathEscape(name)+"/"), nil
+}
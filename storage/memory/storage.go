@@ -8,6 +8,8 @@ import (
 
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/compatmap"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
@@ -46,6 +48,17 @@ func NewStorage() *Storage {
 	}
 }
 
+// SetConfig stores the config, the new objects using the object format of
+// extensions.objectFormat.
+func (s *Storage) SetConfig(cfg *config.Config) error {
+	if err := s.ConfigStorage.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	s.ObjectStorage.objectFormat = cfg.Extensions.ObjectFormat
+	return nil
+}
+
 type ConfigStorage struct {
 	config *config.Config
 }
@@ -90,6 +103,9 @@ type ObjectStorage struct {
 	Trees   map[plumbing.Hash]plumbing.EncodedObject
 	Blobs   map[plumbing.Hash]plumbing.EncodedObject
 	Tags    map[plumbing.Hash]plumbing.EncodedObject
+
+	objectFormat format.ObjectFormat
+	compat       *compatmap.Map
 }
 
 type lazyCloser struct {
@@ -126,7 +142,12 @@ func (o *ObjectStorage) RawObjectWriter(typ plumbing.ObjectType, sz int64) (w io
 }
 
 func (o *ObjectStorage) NewEncodedObject() plumbing.EncodedObject {
-	return &plumbing.MemoryObject{}
+	return plumbing.NewMemoryObject(o.objectFormat)
+}
+
+// ObjectFormat returns the object format of the stored objects.
+func (o *ObjectStorage) ObjectFormat() format.ObjectFormat {
+	return o.objectFormat
 }
 
 func (o *ObjectStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
@@ -233,8 +254,49 @@ var errNotSupported = fmt.Errorf("not supported")
 func (o *ObjectStorage) LooseObjectTime(hash plumbing.Hash) (time.Time, error) {
 	return time.Time{}, errNotSupported
 }
-func (o *ObjectStorage) DeleteLooseObject(plumbing.Hash) error {
-	return errNotSupported
+
+// DeleteLooseObject deletes the given object, all the objects being loose.
+func (o *ObjectStorage) DeleteLooseObject(h plumbing.Hash) error {
+	delete(o.Objects, h)
+	delete(o.Commits, h)
+	delete(o.Trees, h)
+	delete(o.Blobs, h)
+	delete(o.Tags, h)
+	return nil
+}
+
+// CompatObjectID honors the storer.CompatObjectStorer interface.
+func (o *ObjectStorage) CompatObjectID(h plumbing.Hash) (plumbing.Hash, error) {
+	if o.compat != nil {
+		if c, ok := o.compat.CompatID(h); ok {
+			return c, nil
+		}
+	}
+
+	return plumbing.ZeroHash, plumbing.ErrObjectNotFound
+}
+
+// ObjectIDFromCompat honors the storer.CompatObjectStorer interface.
+func (o *ObjectStorage) ObjectIDFromCompat(h plumbing.Hash) (plumbing.Hash, error) {
+	if o.compat != nil {
+		if id, ok := o.compat.ID(h); ok {
+			return id, nil
+		}
+	}
+
+	return plumbing.ZeroHash, plumbing.ErrObjectNotFound
+}
+
+// SetCompatObjectIDs honors the storer.CompatObjectStorer interface.
+func (o *ObjectStorage) SetCompatObjectIDs(m *compatmap.Map) error {
+	if o.compat == nil {
+		o.compat = compatmap.NewMap()
+	}
+
+	return m.ForEach(func(id, compat plumbing.Hash) error {
+		o.compat.Add(id, compat)
+		return nil
+	})
 }
 
 func (o *ObjectStorage) AddAlternate(remote string) error {
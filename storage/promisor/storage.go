@@ -0,0 +1,213 @@
+// Package promisor implements a storage for partial clones, fetching the
+// objects missing from the repository from its promisor remote when they
+// are needed.
+package promisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// Fetcher fetches objects from a promisor remote into the base storage.
+type Fetcher interface {
+	// FetchObjects fetches the given objects, and any object the remote
+	// decides to send along with them.
+	FetchObjects(ctx context.Context, hashes []plumbing.Hash) error
+}
+
+// Storage is a storage.Storer that fetches the objects missing from the base
+// storage using a Fetcher. Objects are fetched when they are read, or in
+// batches using PrefetchObjects.
+type Storage interface {
+	storage.Storer
+	storer.ObjectPrefetcher
+	// Base returns the underlying storage.
+	Base() storage.Storer
+}
+
+// Options holds configuration for a Storage.
+type Options struct {
+	// Context is the context of the fetches of the missing objects,
+	// context.Background() when nil.
+	Context context.Context
+}
+
+// basic implements the Storage interface.
+type basic struct {
+	storage.Storer
+	fetcher Fetcher
+	ctx     context.Context
+
+	mu sync.Mutex
+	// unavailable holds the objects the promisor remote failed to send, so
+	// they are not requested again.
+	unavailable map[plumbing.Hash]struct{}
+}
+
+// packfileWriter implements storer.PackfileWriter interface over a Storage
+// with a base storer that supports it.
+type packfileWriter struct {
+	*basic
+	pw storer.PackfileWriter
+}
+
+// NewStorage returns a new Storage fetching the objects missing from base
+// with the given fetcher.
+func NewStorage(base storage.Storer, fetcher Fetcher) Storage {
+	return NewStorageWithOptions(base, fetcher, Options{})
+}
+
+// NewStorageWithOptions returns a new Storage fetching the objects missing
+// from base with the given fetcher and options.
+func NewStorageWithOptions(base storage.Storer, fetcher Fetcher, ops Options) Storage {
+	ctx := ops.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	st := &basic{
+		Storer:      base,
+		fetcher:     fetcher,
+		ctx:         ctx,
+		unavailable: make(map[plumbing.Hash]struct{}),
+	}
+
+	if pw, ok := base.(storer.PackfileWriter); ok {
+		return &packfileWriter{basic: st, pw: pw}
+	}
+
+	return st
+}
+
+// Base implements Storage.
+func (s *basic) Base() storage.Storer {
+	return s.Storer
+}
+
+// ObjectFormat honors the storer.ObjectFormatStorer interface, reporting the
+// object format of the base storage.
+func (s *basic) ObjectFormat() format.ObjectFormat {
+	if fs, ok := s.Storer.(storer.ObjectFormatStorer); ok {
+		return fs.ObjectFormat()
+	}
+
+	return format.SHA1
+}
+
+// EncodedObject honors the storer.EncodedObjectStorer interface, fetching
+// the object if it's missing.
+func (s *basic) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.Storer.EncodedObject(t, h)
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return obj, err
+	}
+
+	fetched, err := s.fetchMissing([]plumbing.Hash{h})
+	if err != nil {
+		return nil, err
+	}
+
+	if !fetched {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return s.Storer.EncodedObject(t, h)
+}
+
+// EncodedObjectSize honors the storer.EncodedObjectStorer interface,
+// fetching the object if it's missing.
+func (s *basic) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	size, err := s.Storer.EncodedObjectSize(h)
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return size, err
+	}
+
+	fetched, err := s.fetchMissing([]plumbing.Hash{h})
+	if err != nil {
+		return 0, err
+	}
+
+	if !fetched {
+		return 0, plumbing.ErrObjectNotFound
+	}
+
+	return s.Storer.EncodedObjectSize(h)
+}
+
+// PrefetchObjects honors the storer.ObjectPrefetcher interface, fetching all
+// the missing objects in a single request.
+func (s *basic) PrefetchObjects(hashes []plumbing.Hash) error {
+	_, err := s.fetchMissing(hashes)
+	return err
+}
+
+// Module honors the storage.ModuleStorer interface. Submodules are not
+// partial clones, so their storage is returned as is.
+func (s *basic) Module(name string) (storage.Storer, error) {
+	return s.Storer.Module(name)
+}
+
+// fetchMissing fetches the given objects missing from the base storage. It
+// returns true if any object was requested from the promisor remote.
+func (s *basic) fetchMissing(hashes []plumbing.Hash) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missing []plumbing.Hash
+	seen := make(map[plumbing.Hash]struct{}, len(hashes))
+	for _, h := range hashes {
+		if h.IsZero() {
+			continue
+		}
+
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+
+		if _, ok := s.unavailable[h]; ok {
+			continue
+		}
+
+		// Objects of another type than the requested one are found
+		// here, and must not be fetched.
+		err := s.Storer.HasEncodedObject(h)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return false, err
+		}
+
+		missing = append(missing, h)
+	}
+
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	if err := s.fetcher.FetchObjects(s.ctx, missing); err != nil {
+		return false, fmt.Errorf("fetching missing objects from promisor remote: %w", err)
+	}
+
+	for _, h := range missing {
+		if err := s.Storer.HasEncodedObject(h); err != nil {
+			s.unavailable[h] = struct{}{}
+		}
+	}
+
+	return true, nil
+}
+
+// PackfileWriter honors storer.PackfileWriter.
+func (s *packfileWriter) PackfileWriter() (io.WriteCloser, error) {
+	return s.pw.PackfileWriter()
+}
@@ -0,0 +1,162 @@
+package promisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFetcher copies the requested objects from a remote storage.
+type testFetcher struct {
+	remote storage.Storer
+	base   storage.Storer
+	calls  [][]plumbing.Hash
+	err    error
+}
+
+func (f *testFetcher) FetchObjects(ctx context.Context, hashes []plumbing.Hash) error {
+	f.calls = append(f.calls, hashes)
+	if f.err != nil {
+		return f.err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		obj, err := f.remote.EncodedObject(plumbing.AnyObject, h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.base.SetEncodedObject(obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newBlob(t *testing.T, s storage.Storer, content string) plumbing.Hash {
+	t.Helper()
+
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	h, err := s.SetEncodedObject(obj)
+	require.NoError(t, err)
+	return h
+}
+
+func newTestStorage(t *testing.T) (Storage, *testFetcher, storage.Storer) {
+	t.Helper()
+
+	remote := memory.NewStorage()
+	base := memory.NewStorage()
+	f := &testFetcher{remote: remote, base: base}
+	return NewStorage(base, f), f, remote
+}
+
+func TestEncodedObjectFetchesMissing(t *testing.T) {
+	st, f, remote := newTestStorage(t)
+	h := newBlob(t, remote, "missing")
+
+	obj, err := st.EncodedObject(plumbing.BlobObject, h)
+	require.NoError(t, err)
+	assert.Equal(t, h, obj.Hash())
+	assert.Equal(t, [][]plumbing.Hash{{h}}, f.calls)
+
+	size, err := st.EncodedObjectSize(h)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("missing")), size)
+
+	// The object is now local.
+	_, err = st.Base().EncodedObject(plumbing.BlobObject, h)
+	require.NoError(t, err)
+	assert.Len(t, f.calls, 1)
+}
+
+func TestEncodedObjectOtherTypeNotFetched(t *testing.T) {
+	st, f, _ := newTestStorage(t)
+	h := newBlob(t, st, "local")
+
+	_, err := st.EncodedObject(plumbing.CommitObject, h)
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+	assert.Empty(t, f.calls)
+}
+
+func TestEncodedObjectUnavailable(t *testing.T) {
+	st, f, _ := newTestStorage(t)
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err := st.EncodedObject(plumbing.AnyObject, h)
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	_, err = st.EncodedObjectSize(h)
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+	assert.Len(t, f.calls, 1)
+}
+
+func TestEncodedObjectFetchError(t *testing.T) {
+	st, f, _ := newTestStorage(t)
+	f.err = errors.New("connection refused")
+
+	_, err := st.EncodedObject(plumbing.AnyObject, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	assert.ErrorIs(t, err, f.err)
+}
+
+func TestContext(t *testing.T) {
+	remote := memory.NewStorage()
+	base := memory.NewStorage()
+	f := &testFetcher{remote: remote, base: base}
+	h := newBlob(t, remote, "missing")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	st := NewStorageWithOptions(base, f, Options{Context: ctx})
+	_, err := st.EncodedObject(plumbing.BlobObject, h)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, f.calls, 1)
+}
+
+func TestPrefetchObjects(t *testing.T) {
+	st, f, remote := newTestStorage(t)
+	a := newBlob(t, remote, "a")
+	b := newBlob(t, remote, "b")
+	local := newBlob(t, st, "local")
+
+	require.NoError(t, st.PrefetchObjects([]plumbing.Hash{a, local, b, a, plumbing.ZeroHash}))
+	assert.Equal(t, [][]plumbing.Hash{{a, b}}, f.calls)
+
+	require.NoError(t, st.PrefetchObjects([]plumbing.Hash{a, b, local}))
+	assert.Len(t, f.calls, 1)
+}
+
+func TestPackfileWriter(t *testing.T) {
+	_, ok := NewStorage(memory.NewStorage(), &testFetcher{}).(storer.PackfileWriter)
+	assert.False(t, ok)
+
+	fs := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	_, ok = NewStorage(fs, &testFetcher{}).(storer.PackfileWriter)
+	assert.True(t, ok)
+}
@@ -11,10 +11,12 @@ import (
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/kv"
 	"github.com/go-git/go-git/v6/storage/memory"
 	"github.com/go-git/go-git/v6/storage/transactional"
 	"github.com/stretchr/testify/assert"
@@ -68,12 +70,29 @@ var storageFactories = []func(t *testing.T) (Storer, string){
 	func(t *testing.T) (Storer, string) {
 		return filesystem.NewStorage(osfs.New(t.TempDir()), nil), "filesystem"
 	},
+	func(t *testing.T) (Storer, string) {
+		sto := filesystem.NewStorage(memfs.New(), nil)
+		cfg := config.NewConfig()
+		cfg.Core.RepositoryFormatVersion = format.Version_1
+		cfg.Extensions.RefStorage = config.RefStorageReftable
+		require.NoError(t, sto.SetConfig(cfg))
+
+		return sto, "reftable"
+	},
 	func(t *testing.T) (Storer, string) {
 		temporal := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
 		base := memory.NewStorage()
 
 		return transactional.NewStorage(base, temporal), "transactional"
 	},
+	func(_ *testing.T) (Storer, string) { return kv.NewStorage(kv.NewMemoryKV()), "kv" },
+	func(t *testing.T) (Storer, string) {
+		f, err := kv.OpenFileKV(osfs.New(t.TempDir()), "repository.kv")
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() }) //nolint:errcheck
+
+		return kv.NewStorage(f), "kv-file"
+	},
 }
 
 func forEachStorage(t *testing.T, tc func(sto Storer, t *testing.T)) {
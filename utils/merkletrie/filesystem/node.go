@@ -23,8 +23,9 @@ var ignore = map[string]bool{
 // This implementation implements a "standard" hash method being able to be
 // compared with any other noder.Noder implementation inside of go-git.
 type node struct {
-	fs         billy.Filesystem
-	submodules map[string]plumbing.Hash
+	fs           billy.Filesystem
+	submodules   map[string]plumbing.Hash
+	objectFormat format.ObjectFormat
 
 	path     string
 	hash     []byte
@@ -43,7 +44,29 @@ func NewRootNode(
 	fs billy.Filesystem,
 	submodules map[string]plumbing.Hash,
 ) noder.Noder {
-	return &node{fs: fs, submodules: submodules, isDir: true}
+	return NewRootNodeWithOptions(fs, submodules, Options{})
+}
+
+// Options holds the options of the root node.
+type Options struct {
+	// ObjectFormat is the object format of the hashes of the files, SHA-1
+	// by default.
+	ObjectFormat format.ObjectFormat
+}
+
+// NewRootNodeWithOptions returns the root node based on a given
+// billy.Filesystem, with extra options.
+func NewRootNodeWithOptions(
+	fs billy.Filesystem,
+	submodules map[string]plumbing.Hash,
+	opts Options,
+) noder.Noder {
+	return &node{
+		fs:           fs,
+		submodules:   submodules,
+		objectFormat: opts.ObjectFormat,
+		isDir:        true,
+	}
 }
 
 // Hash the hash of a filesystem is the result of concatenating the computed
@@ -132,8 +155,9 @@ func (n *node) newChildNode(file os.FileInfo) (*node, error) {
 	path := path.Join(n.path, file.Name())
 
 	node := &node{
-		fs:         n.fs,
-		submodules: n.submodules,
+		fs:           n.fs,
+		submodules:   n.submodules,
+		objectFormat: n.objectFormat,
 
 		path:  path,
 		isDir: file.IsDir(),
@@ -179,7 +203,7 @@ func (n *node) doCalculateHashForRegular() plumbing.Hash {
 
 	defer f.Close()
 
-	h := plumbing.NewHasher(format.SHA1, plumbing.BlobObject, n.size)
+	h := plumbing.NewHasher(n.objectFormat, plumbing.BlobObject, n.size)
 	if _, err := io.Copy(h, f); err != nil {
 		return plumbing.ZeroHash
 	}
@@ -193,7 +217,7 @@ func (n *node) doCalculateHashForSymlink() plumbing.Hash {
 		return plumbing.ZeroHash
 	}
 
-	h := plumbing.NewHasher(format.SHA1, plumbing.BlobObject, n.size)
+	h := plumbing.NewHasher(n.objectFormat, plumbing.BlobObject, n.size)
 	if _, err := h.Write([]byte(target)); err != nil {
 		return plumbing.ZeroHash
 	}
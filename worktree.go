@@ -22,6 +22,7 @@ import (
 	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/merkletrie"
@@ -86,7 +87,7 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		InsecureSkipTLS: o.InsecureSkipTLS,
 		CABundle:        o.CABundle,
 		ProxyOptions:    o.ProxyOptions,
-	})
+	}, false)
 
 	updated := true
 	if err == NoErrAlreadyUpToDate {
@@ -137,9 +138,11 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		return err
 	}
 
+	pr, _ := o.Progress.(progress.Reporter)
 	if err := w.Reset(&ResetOptions{
-		Mode:   MergeReset,
-		Commit: ref.Hash(),
+		Mode:     MergeReset,
+		Commit:   ref.Hash(),
+		Progress: pr,
 	}); err != nil {
 		return err
 	}
@@ -184,6 +187,7 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 		Commit:     c,
 		Mode:       MergeReset,
 		SparseDirs: opts.SparseCheckoutDirectories,
+		Progress:   opts.Progress,
 	}
 	if opts.Force {
 		ro.Mode = HardReset
@@ -332,13 +336,13 @@ func (w *Worktree) Reset(opts *ResetOptions) error {
 	}
 
 	if opts.Mode == MergeReset && len(removedFiles) > 0 {
-		if err := w.resetWorktree(t, removedFiles); err != nil {
+		if err := w.resetWorktree(t, removedFiles, opts.Progress); err != nil {
 			return err
 		}
 	}
 
 	if opts.Mode == HardReset {
-		if err := w.resetWorktree(t, opts.Files); err != nil {
+		if err := w.resetWorktree(t, opts.Files, opts.Progress); err != nil {
 			return err
 		}
 	}
@@ -476,7 +480,7 @@ func inFiles(files []string, v string) bool {
 	return false
 }
 
-func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
+func (w *Worktree) resetWorktree(t *object.Tree, files []string, r progress.Reporter) error {
 	changes, err := w.diffStagingWithWorktree(true, false)
 	if err != nil {
 		return err
@@ -488,6 +492,7 @@ func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
 	}
 	b := newIndexBuilder(idx)
 
+	var selected merkletrie.Changes
 	for _, ch := range changes {
 		if err := w.validChange(ch); err != nil {
 			return err
@@ -511,15 +516,55 @@ func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
 			}
 		}
 
+		selected = append(selected, ch)
+	}
+
+	if err := w.prefetchChanges(selected, t); err != nil {
+		return err
+	}
+
+	meter := progress.NewMeter(r, progress.CheckingOut, uint64(len(selected)))
+	for i, ch := range selected {
 		if err := w.checkoutChange(ch, t, b); err != nil {
 			return err
 		}
+		meter.Update(uint64(i+1), 0)
 	}
+	meter.Done(uint64(len(selected)), 0)
 
 	b.Write(idx)
 	return w.r.Storer.SetIndex(idx)
 }
 
+// prefetchChanges retrieves at once the blobs to be checked out, when the
+// storer supports it, e.g. in partial clones.
+func (w *Worktree) prefetchChanges(changes merkletrie.Changes, t *object.Tree) error {
+	p, ok := w.r.Storer.(storer.ObjectPrefetcher)
+	if !ok {
+		return nil
+	}
+
+	var hashes []plumbing.Hash
+	for _, ch := range changes {
+		if ch.To == nil {
+			continue
+		}
+
+		e, err := t.FindEntry(ch.To.String())
+		if err != nil || e.Mode == filemode.Submodule {
+			continue
+		}
+
+		hashes = append(hashes, e.Hash)
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	return p.PrefetchObjects(hashes)
+}
+
 // worktreeDeny is a list of paths that are not allowed
 // to be used when resetting the worktree.
 var worktreeDeny = map[string]struct{}{
@@ -94,7 +94,15 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
-	return commit, w.updateHEAD(commit)
+	if err := w.updateHEAD(commit); err != nil {
+		return commit, err
+	}
+
+	if opts.WriteCommitGraph {
+		return commit, w.r.WriteCommitGraph(WriteCommitGraphOptions{Reachable: true, Split: true})
+	}
+
+	return commit, nil
 }
 
 func (w *Worktree) autoAddModifiedAndDeleted() error {
@@ -141,7 +141,9 @@ func (w *Worktree) diffStagingWithWorktree(reverse, excludeIgnoredChanges bool)
 		return nil, err
 	}
 
-	to := filesystem.NewRootNode(w.Filesystem, submodules)
+	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, filesystem.Options{
+		ObjectFormat: w.r.objectFormat(),
+	})
 
 	var c merkletrie.Changes
 	if reverse {
@@ -22,6 +22,7 @@ import (
 	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/progress"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
 	"github.com/stretchr/testify/assert"
@@ -371,6 +372,29 @@ func (s *WorktreeSuite) TestCheckout() {
 	s.Len(idx.Entries, 9)
 }
 
+func (s *WorktreeSuite) TestCheckoutProgress() {
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: memfs.New(),
+	}
+
+	var events []progress.Event
+	err := w.Checkout(&CheckoutOptions{
+		Force: true,
+		Progress: progress.ReporterFunc(func(e progress.Event) {
+			events = append(events, e)
+		}),
+	})
+	s.NoError(err)
+
+	s.NotEmpty(events)
+	last := events[len(events)-1]
+	s.Equal(progress.CheckingOut, last.Phase)
+	s.True(last.Done)
+	s.Equal(uint64(9), last.Current)
+	s.Equal(uint64(9), last.Total)
+}
+
 func (s *WorktreeSuite) TestCheckoutForce() {
 	w := &Worktree{
 		r:          s.Repository,